@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sunvim/evm_rpc/pkg/accounts"
+	"github.com/sunvim/evm_rpc/pkg/api/admin"
+	"github.com/sunvim/evm_rpc/pkg/api/eth"
+	"github.com/sunvim/evm_rpc/pkg/api/net"
+	"github.com/sunvim/evm_rpc/pkg/api/token"
+	"github.com/sunvim/evm_rpc/pkg/api/txpool"
+	"github.com/sunvim/evm_rpc/pkg/api/web3"
+	"github.com/sunvim/evm_rpc/pkg/cache"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/evm"
+	"github.com/sunvim/evm_rpc/pkg/forks"
+	"github.com/sunvim/evm_rpc/pkg/ingest"
+	"github.com/sunvim/evm_rpc/pkg/lifecycle"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/middleware"
+	"github.com/sunvim/evm_rpc/pkg/server"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+	"github.com/sunvim/evm_rpc/pkg/txvalidate"
+)
+
+// defaultNamespaces are served by chains that do not list their own
+var defaultNamespaces = []string{"eth", "net", "web3", "txpool"}
+
+// chainStorage holds the storage access a chain's APIs are built on
+type chainStorage struct {
+	blockReader   *storage.BlockReader
+	txReader      *storage.TransactionReader
+	stateReader   *storage.StateReader
+	txPoolStorage *storage.TxPoolStorage
+	filterStore   *storage.FilterStore
+	cacheManager  *cache.Manager
+	webhookStore  *storage.WebhookStore // nil unless webhooks are enabled
+}
+
+// newChainStorage creates the readers of a chain. The tx pool and filters
+// read their own writes, so they bypass replicas.
+func newChainStorage(pikaClient *storage.PikaClient, cfg *config.Config, chainID uint64) *chainStorage {
+	return &chainStorage{
+		blockReader:   storage.NewBlockReader(pikaClient),
+		txReader:      storage.NewTransactionReader(pikaClient),
+		stateReader:   storage.NewStateReader(pikaClient),
+		txPoolStorage: storage.NewTxPoolStorage(pikaClient.Primary(), cfg.TxPool, chainID),
+		filterStore:   storage.NewFilterStore(pikaClient.Primary(), cfg.API.FilterTimeout),
+	}
+}
+
+// listenerSet tracks the RPC servers, which are created after the APIs
+// are registered, and the denylist and priority scheduler they share
+type listenerSet struct {
+	servers  []interface{ Listening() bool }
+	denylist *middleware.Denylist
+	qos      *middleware.QoS
+}
+
+// Listening reports whether any RPC server accepts connections
+func (l *listenerSet) Listening() bool {
+	for _, server := range l.servers {
+		if server.Listening() {
+			return true
+		}
+	}
+	return false
+}
+
+// Connections describes the connections of the RPC servers
+func (l *listenerSet) Connections() *admin.Connections {
+	connections := &admin.Connections{
+		HTTP:      []admin.HTTPConnections{},
+		WebSocket: []admin.WebSocketConnection{},
+	}
+	for _, s := range l.servers {
+		switch s := s.(type) {
+		case *server.HTTPServer:
+			connections.HTTP = append(connections.HTTP, s.ConnectionStats())
+		case *server.WebSocketServer:
+			connections.WebSocket = append(connections.WebSocket, s.ConnectionStats()...)
+		}
+	}
+	return connections
+}
+
+// OrphanedSubscriptions describes the subscriptions of the WebSocket
+// servers that outlived their connection
+func (l *listenerSet) OrphanedSubscriptions() *admin.OrphanedSubscriptions {
+	result := &admin.OrphanedSubscriptions{
+		Subscriptions: []admin.OrphanedSubscription{},
+	}
+	for _, s := range l.servers {
+		if s, ok := s.(*server.WebSocketServer); ok {
+			orphans := s.OrphanedSubscriptions()
+			result.Subscriptions = append(result.Subscriptions, orphans.Subscriptions...)
+			result.Removed += orphans.Removed
+		}
+	}
+	return result
+}
+
+// netStatus backs net_peerCount and net_listening of a chain
+type netStatus struct {
+	*listenerSet
+	ingester *ingest.Ingester // nil unless this process ingests the chain
+}
+
+// PeerCount returns the number of healthy upstream connections
+func (s *netStatus) PeerCount() int {
+	if s.ingester != nil && s.ingester.UpstreamConnected() {
+		return 1
+	}
+	return 0
+}
+
+// registerAPIs registers the listed RPC namespaces of a chain. Signing
+// methods are only served with an accounts backend.
+func registerAPIs(handler *server.JSONRPCHandler, namespaces []string, cfg *config.Config, chainConfig *params.ChainConfig, networkID uint64, status *netStatus, st *chainStorage, signer accounts.Backend) error {
+	chainID := chainConfig.ChainID.Uint64()
+	validator, err := txvalidate.NewValidator(cfg.EVM, chainConfig)
+	if err != nil {
+		return fmt.Errorf("invalid evm config: %w", err)
+	}
+	policy, err := txvalidate.NewPolicy(cfg.TxPool)
+	if err != nil {
+		return fmt.Errorf("invalid txpool config: %w", err)
+	}
+	validator.SetPolicy(policy)
+
+	executor := evm.NewExecutor(st.blockReader, st.stateReader, chainConfig, cfg.EVM.CallGasLimit, cfg.EVM.CallTimeout)
+	callAPI := eth.NewCallAPI(st.blockReader, st.stateReader, executor, chainID)
+	callAPI.SetMaxBundleCalls(cfg.EVM.MaxBundleCalls)
+	txPoolAPI := eth.NewTxPoolAPI(st.blockReader, st.txReader, st.stateReader, st.txPoolStorage, validator, chainID)
+	txPoolAPI.SetCallAPI(callAPI)
+	txPoolAPI.SetMaxSendBatch(cfg.TxPool.MaxSendBatch)
+	var accountAPI *eth.AccountAPI
+	if signer != nil {
+		accountAPI = eth.NewAccountAPI(signer, txPoolAPI)
+	}
+	filterAPI := eth.NewFilterAPI(st.blockReader, st.filterStore)
+	filterAPI.SetLimits(eth.LogLimits{
+		MaxBlockRange: cfg.API.Logs.MaxBlockRange,
+		MaxAddresses:  cfg.API.Logs.MaxAddresses,
+		MaxTopics:     cfg.API.Logs.MaxTopics,
+		MaxResults:    cfg.API.Logs.MaxResults,
+		Timeout:       cfg.API.Logs.Timeout,
+	})
+
+	for _, namespace := range namespaces {
+		var services []interface{}
+		switch namespace {
+		case "eth":
+			blockAPI := eth.NewBlockAPI(st.blockReader, chainConfig)
+			blockAPI.SetTxPool(st.txPoolStorage, st.stateReader)
+			gasAPI := eth.NewGasAPI(st.blockReader, chainConfig, chainID)
+			gasAPI.SetCallAPI(callAPI)
+			gasAPI.SetTxPool(st.txPoolStorage)
+			services = []interface{}{
+				blockAPI,
+				gasAPI,
+				eth.NewStateAPI(st.blockReader, st.stateReader, chainID),
+				callAPI,
+				eth.NewTransactionAPI(st.blockReader, st.txReader, chainID),
+				txPoolAPI,
+				eth.NewSyncAPI(st.blockReader, chainID),
+				filterAPI,
+			}
+			// Registered before AccountAPI, whose eth_accounts replaces the stub
+			if cfg.API.LegacyStubs {
+				services = append(services, eth.NewMiscAPI())
+			}
+			if accountAPI != nil {
+				services = append(services, accountAPI)
+			}
+		case "net":
+			services = []interface{}{net.NewNetAPI(networkID, status)}
+		case "web3":
+			services = []interface{}{web3.NewWeb3API(version, commit)}
+		case "txpool":
+			services = []interface{}{txpool.NewTxPoolAPI(st.txPoolStorage)}
+		case "personal":
+			if accountAPI == nil {
+				return fmt.Errorf("personal namespace requires accounts to be enabled")
+			}
+			services = []interface{}{eth.NewPersonalAPI(accountAPI)}
+		case "admin":
+			adminAPI := admin.NewAdminAPI(st.cacheManager)
+			adminAPI.SetConnections(status.listenerSet)
+			adminAPI.SetDenylist(status.denylist)
+			adminAPI.SetWebhooks(st.webhookStore)
+			services = []interface{}{adminAPI}
+		case "evm":
+			batchStateAPI := eth.NewBatchStateAPI(st.blockReader, st.stateReader, chainID)
+			batchStateAPI.SetMaxBatch(cfg.API.MaxStateBatch)
+			var multicall3 *common.Address
+			if cfg.EVM.Multicall3Address != "" {
+				addr := common.HexToAddress(cfg.EVM.Multicall3Address)
+				multicall3 = &addr
+			}
+			services = []interface{}{eth.NewPagedLogsAPI(filterAPI), batchStateAPI, eth.NewMulticallAPI(callAPI, multicall3)}
+			if ens := cfg.API.ENS; ens.Registry != "" {
+				ensAPI, err := eth.NewENSAPI(callAPI, common.HexToAddress(ens.Registry), eth.ENSOptions{
+					CacheSize:   ens.CacheSize,
+					CacheTTL:    ens.CacheTTL,
+					CCIPRead:    ens.CCIPRead,
+					CCIPTimeout: ens.CCIPTimeout,
+				})
+				if err != nil {
+					return err
+				}
+				services = append(services, ensAPI)
+			}
+		case "token":
+			tokens := make([]common.Address, len(cfg.API.Token.Tokens))
+			for i, addr := range cfg.API.Token.Tokens {
+				tokens[i] = common.HexToAddress(addr)
+			}
+			tokenAPI, err := token.NewTokenAPI(callAPI, st.blockReader, tokens, cfg.API.Token.CacheSize)
+			if err != nil {
+				return err
+			}
+			services = []interface{}{tokenAPI}
+		default:
+			return fmt.Errorf("unknown namespace %q", namespace)
+		}
+
+		for _, service := range services {
+			if err := handler.RegisterService(namespace, service); err != nil {
+				return fmt.Errorf("failed to register %s API: %w", namespace, err)
+			}
+		}
+	}
+	return nil
+}
+
+// newExtraChain sets up a further chain with its own Pika, caches and APIs,
+// sharing the servers, rate limiter, middleware and config reloads of the
+// default chain
+func newExtraChain(ctx context.Context, cfg *config.Config, chainCfg config.ExtraChainConfig, rateLimiter *middleware.RateLimiter, runner *lifecycle.Runner, signer accounts.Backend, listeners *listenerSet, reload *reloader) (*server.Chain, error) {
+	if chainCfg.Name == "" {
+		return nil, fmt.Errorf("chain name is not set")
+	}
+	chainConfig, err := forks.ChainConfig(chainCfg.ChainID, chainCfg.Forks)
+	if err != nil {
+		return nil, fmt.Errorf("invalid forks: %w", err)
+	}
+
+	pikaClient, err := storage.ConnectPika(ctx, chainCfg.Pika)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Pika: %w", err)
+	}
+	st := newChainStorage(pikaClient, cfg, chainCfg.ChainID)
+
+	labels := prometheus.Labels{"chain": chainCfg.Name}
+	poolCollector := storage.NewPoolCollector(pikaClient)
+	health := server.NewHealthChecker(st.blockReader, pikaClient, cfg.Server.Health.MaxBlockLag)
+	chainCollector := server.NewChainCollector(chainCfg.Name, chainCfg.ChainID, health)
+	runner.Add(chainCfg.Name+" pika client", lifecycle.Hooks{
+		OnStart: func(ctx context.Context) error {
+			if err := prometheus.Register(chainCollector); err != nil {
+				return err
+			}
+			return prometheus.WrapRegistererWith(labels, prometheus.DefaultRegisterer).Register(poolCollector)
+		},
+		OnStop: func(ctx context.Context) error {
+			prometheus.WrapRegistererWith(labels, prometheus.DefaultRegisterer).Unregister(poolCollector)
+			prometheus.Unregister(chainCollector)
+			return pikaClient.Close()
+		},
+	})
+	if chainCfg.Pika.Degraded.Enabled {
+		runner.Add(chainCfg.Name+" pika availability", storage.NewAvailabilityMonitor(pikaClient, chainCfg.Pika.Degraded))
+	}
+
+	if cfg.Cache.Enabled {
+		st.cacheManager, err = cache.NewManager(cfg.Cache)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize cache: %w", err)
+		}
+		st.cacheManager.SetChain(chainCfg.Name)
+		st.blockReader.SetCache(st.cacheManager)
+		runner.Add(chainCfg.Name+" cache manager", st.cacheManager)
+	}
+
+	namespaces := chainCfg.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = defaultNamespaces
+	}
+	handler := server.NewJSONRPCHandler(rateLimiter, cfg.Logging.SlowQueryThreshold)
+	handler.SetBindings(cfg.API.Bindings)
+	handler.SetDenylist(listeners.denylist)
+	handler.SetQoS(listeners.qos)
+	handler.EnableHeightPinning(st.blockReader)
+	reload.track(handler, st.cacheManager)
+	if err := registerAPIs(handler, namespaces, cfg, chainConfig, chainCfg.NetworkID, &netStatus{listenerSet: listeners}, st, signer); err != nil {
+		return nil, err
+	}
+	logger.Infof("Exposed RPC methods of chain %s: %s", chainCfg.Name, strings.Join(handler.Methods(), ", "))
+
+	chain := &server.Chain{
+		Name:    chainCfg.Name,
+		Hosts:   chainCfg.Hosts,
+		Handler: handler,
+		Health:  health,
+	}
+	if cfg.Server.WS.Enabled || cfg.Server.HTTP.Events {
+		chain.Subscriptions = server.NewSubscriptionManager(pikaClient, st.blockReader, cfg.Server.WS)
+		chain.Subscriptions.SetTxPool(st.txPoolStorage)
+		runner.Add(chainCfg.Name+" subscription manager", chain.Subscriptions)
+	}
+
+	logger.Infof("Serving chain %s (ID: %d) under /chain/%s", chainCfg.Name, chainCfg.ChainID, chainCfg.Name)
+	return chain, nil
+}
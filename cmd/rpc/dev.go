@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sunvim/evm_rpc/pkg/accounts"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+)
+
+// devChainID is the chain ID of `rpc dev` unless -chain.id is given
+const devChainID = 1337
+
+// devCommand reports whether the service was started as `rpc dev`, and
+// if so removes the subcommand from the arguments so that the remaining
+// flags parse as usual
+func devCommand() bool {
+	if len(os.Args) < 2 || os.Args[1] != "dev" {
+		return false
+	}
+	os.Args = append(os.Args[:1], os.Args[2:]...)
+	return true
+}
+
+// addDevOverrides sets the config of `rpc dev`: a chain mined in process
+// on memory storage, with the features that need external services off
+func addDevOverrides(overrides map[string]interface{}) {
+	overrides["dev.enabled"] = true
+	overrides["storage.pika.mode"] = config.PikaModeMemory
+	for _, key := range []string{
+		"storage.pika.replicas.enabled",
+		"storage.pika.degraded.enabled",
+		"storage.cold.enabled",
+		"cache.l2.enabled",
+		"ingest.enabled",
+		"fallback.enabled",
+		"accounts.enabled",
+		"bridge.enabled",
+	} {
+		overrides[key] = false
+	}
+	overrides["chains"] = []interface{}{}
+
+	// The dev chain has every fork active from genesis, whatever the
+	// chain ID, so a configured preset must not apply
+	overrides["chain.forks.preset"] = ""
+	if _, ok := overrides["chain.chain_id"]; !ok {
+		overrides["chain.name"] = "dev"
+		overrides["chain.chain_id"] = devChainID
+		overrides["chain.network_id"] = devChainID
+	}
+}
+
+// devAccounts derives the keys of the funded dev accounts and logs them,
+// so that wallets and tests can import them
+func devAccounts(cfg config.DevConfig) (*accounts.StaticKeys, []common.Address, error) {
+	keys, err := accounts.DeriveKeys(cfg.Seed, cfg.Accounts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	addresses := make([]common.Address, len(keys))
+	lines := ""
+	for i, key := range keys {
+		addresses[i] = crypto.PubkeyToAddress(key.PublicKey)
+		lines += fmt.Sprintf("\n  (%d) %s  0x%s", i, addresses[i].Hex(), hex.EncodeToString(crypto.FromECDSA(key)))
+	}
+	logger.Warnf("Dev mode: data is kept in memory and lost on exit. These accounts hold %d ETH each; "+
+		"their keys are public, never send real funds to them:%s", cfg.Balance, lines)
+	return accounts.NewStaticKeys(keys), addresses, nil
+}
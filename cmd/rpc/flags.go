@@ -0,0 +1,37 @@
+package main
+
+import "flag"
+
+// configFlags are command line shortcuts for common config keys. They take
+// precedence over environment variables and the config file.
+var configFlags = []struct {
+	name  string
+	key   string
+	usage string
+}{
+	{"http.addr", "server.http.listen_addr", "HTTP listen address"},
+	{"ws.addr", "server.ws.listen_addr", "WebSocket listen address"},
+	{"pika.addr", "storage.pika.addr", "Pika address"},
+	{"chain.id", "chain.chain_id", "Chain ID"},
+	{"log.level", "logging.level", "Log level (debug, info, warn or error)"},
+}
+
+// addConfigFlags registers the config flags on fs. The returned function
+// gives the config overrides of the flags that were set once fs is parsed.
+func addConfigFlags(fs *flag.FlagSet) func() map[string]interface{} {
+	keys := make(map[string]string, len(configFlags))
+	for _, f := range configFlags {
+		fs.String(f.name, "", f.usage)
+		keys[f.name] = f.key
+	}
+
+	return func() map[string]interface{} {
+		overrides := make(map[string]interface{})
+		fs.Visit(func(f *flag.Flag) {
+			if key, ok := keys[f.Name]; ok {
+				overrides[key] = f.Value.String()
+			}
+		})
+		return overrides
+	}
+}
@@ -6,20 +6,31 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"runtime"
+	"strings"
 	"syscall"
-	"time"
 
-	"github.com/sunvim/evm_rpc/pkg/api/eth"
-	"github.com/sunvim/evm_rpc/pkg/api/net"
-	"github.com/sunvim/evm_rpc/pkg/api/txpool"
-	"github.com/sunvim/evm_rpc/pkg/api/web3"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sunvim/evm_rpc/pkg/accounts"
+	"github.com/sunvim/evm_rpc/pkg/bridge"
 	"github.com/sunvim/evm_rpc/pkg/cache"
 	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/dev"
+	"github.com/sunvim/evm_rpc/pkg/forks"
+	"github.com/sunvim/evm_rpc/pkg/ingest"
+	"github.com/sunvim/evm_rpc/pkg/jsonx"
+	"github.com/sunvim/evm_rpc/pkg/lifecycle"
 	"github.com/sunvim/evm_rpc/pkg/logger"
 	"github.com/sunvim/evm_rpc/pkg/metrics"
 	"github.com/sunvim/evm_rpc/pkg/middleware"
+	"github.com/sunvim/evm_rpc/pkg/prune"
+	"github.com/sunvim/evm_rpc/pkg/replay"
 	"github.com/sunvim/evm_rpc/pkg/server"
 	"github.com/sunvim/evm_rpc/pkg/storage"
+	"github.com/sunvim/evm_rpc/pkg/tracing"
+	"github.com/sunvim/evm_rpc/pkg/txsender"
+	"github.com/sunvim/evm_rpc/pkg/webhook"
 )
 
 var (
@@ -28,9 +39,21 @@ var (
 )
 
 func main() {
+	// Subcommands such as export and import have their own flags
+	if len(os.Args) > 1 {
+		if _, ok := tools[os.Args[1]]; ok {
+			runTool(os.Args[1], os.Args[2:])
+		}
+	}
+
+	// `rpc dev` runs a chain mined in process on memory storage
+	devMode := devCommand()
+
 	// Parse command line flags
 	configPath := flag.String("config", "config/config.yaml", "Path to configuration file")
 	showVersion := flag.Bool("version", false, "Show version information")
+	ingestMode := flag.Bool("ingest", false, "Follow the upstream node configured under ingest and write its chain to Pika")
+	configOverrides := addConfigFlags(flag.CommandLine)
 	flag.Parse()
 
 	if *showVersion {
@@ -39,11 +62,22 @@ func main() {
 	}
 
 	// Load configuration
-	cfg, err := config.LoadConfigWithDefaults(*configPath)
+	overrides := configOverrides()
+	if *ingestMode {
+		overrides["ingest.enabled"] = true
+	}
+	if devMode {
+		addDevOverrides(overrides)
+	}
+	cfg, err := config.LoadConfigWithDefaults(*configPath, overrides)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
 		os.Exit(1)
 	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config %s:\n%v\n", *configPath, err)
+		os.Exit(1)
+	}
 
 	// Initialize logger
 	if err := logger.InitLogger(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.Output); err != nil {
@@ -54,21 +88,43 @@ func main() {
 
 	logger.Infof("Starting EVM RPC Service %s", version)
 	logger.Infof("Chain: %s (ID: %d)", cfg.Chain.Name, cfg.Chain.ChainID)
+	if dump, err := cfg.Dump(); err == nil {
+		logger.Infof("Effective configuration:\n%s", dump)
+	}
+
+	chainConfig, err := forks.ChainConfig(cfg.Chain.ChainID, cfg.Chain.Forks)
+	if err != nil {
+		logger.Fatalf("Invalid chain forks: %v", err)
+	}
+
+	// Initialize Pika client. Pika may come up after us during a rollout,
+	// so connections are retried until startup is interrupted.
+	startupCtx, stopStartup := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopStartup()
 
-	// Initialize Pika client
 	logger.Info("Connecting to Pika storage...")
-	pikaClient, err := storage.NewPikaClient(cfg.Storage.Pika)
+	pikaClient, err := storage.ConnectPika(startupCtx, cfg.Storage.Pika)
 	if err != nil {
 		logger.Fatalf("Failed to connect to Pika: %v", err)
 	}
-	defer pikaClient.Close()
 	logger.Info("Connected to Pika storage")
 
+	txsender.SetCacheSize(cfg.Cache.SenderCacheSize)
+
 	// Initialize storage readers
-	blockReader := storage.NewBlockReader(pikaClient)
-	txReader := storage.NewTransactionReader(pikaClient)
-	stateReader := storage.NewStateReader(pikaClient)
-	txPoolStorage := storage.NewTxPoolStorage(pikaClient)
+	st := newChainStorage(pikaClient, cfg, cfg.Chain.ChainID)
+	blockReader := st.blockReader
+
+	// Old blocks may be served from object storage
+	if cfg.Storage.Cold.Enabled {
+		coldStore, err := storage.NewColdStore(cfg.Storage.Cold)
+		if err != nil {
+			logger.Fatalf("Failed to initialize cold storage: %v", err)
+		}
+		blockReader.SetColdStore(coldStore)
+		st.txReader.SetColdStore(coldStore)
+		logger.Infof("Serving blocks below %d from cold storage", cfg.Storage.Cold.BelowBlock)
+	}
 
 	// Initialize cache manager
 	var cacheManager *cache.Manager
@@ -78,188 +134,394 @@ func main() {
 		if err != nil {
 			logger.Fatalf("Failed to initialize cache: %v", err)
 		}
+		blockReader.SetCache(cacheManager)
+		st.cacheManager = cacheManager
 		logger.Info("Cache manager initialized")
 	}
 
-	// Initialize API handlers
-	logger.Info("Initializing API handlers...")
-	blockAPI := eth.NewBlockAPI(blockReader, cfg.Chain.ChainID)
-	gasAPI := eth.NewGasAPI(blockReader, cfg.Chain.ChainID)
-	stateAPI := eth.NewStateAPI(blockReader, stateReader, cfg.Chain.ChainID)
-	txAPI := eth.NewTransactionAPI(blockReader, txReader, cfg.Chain.ChainID)
-	txPoolAPI := eth.NewTxPoolAPI(blockReader, stateReader, txPoolStorage, cfg.Chain.ChainID)
-	netAPI := net.NewNetAPI(cfg.Chain.NetworkID)
-	web3API := web3.NewWeb3API(version)
-	txpoolNS := txpool.NewTxPoolAPI(txPoolStorage)
-
-	// Initialize JSON-RPC handler
-	var rateLimiter *middleware.RateLimiter
+	// Initialize JSON-RPC handler. The rate limiter and CORS origins are
+	// always set up so that they can be enabled by a config reload.
 	if cfg.RateLimit.Enabled {
 		logger.Info("Initializing rate limiter...")
-		rateLimiter = middleware.NewRateLimiter(
-			cfg.RateLimit.Enabled,
-			cfg.RateLimit.Global.RequestsPerSecond,
-			cfg.RateLimit.Global.Burst,
-			cfg.RateLimit.IP.RequestsPerSecond,
-			cfg.RateLimit.IP.Burst,
-			cfg.RateLimit.Method,
-		)
-		logger.Info("Rate limiter initialized")
 	}
+	rateLimiter := middleware.NewRateLimiter(
+		cfg.RateLimit.Enabled,
+		cfg.RateLimit.Global.RequestsPerSecond,
+		cfg.RateLimit.Global.Burst,
+		cfg.RateLimit.IP.RequestsPerSecond,
+		cfg.RateLimit.IP.Burst,
+		cfg.RateLimit.Method,
+	)
+
+	// Adaptive rate limiting sheds load while Pika is slow
+	var adaptiveLimiter *middleware.AdaptiveLimiter
+	if cfg.RateLimit.Adaptive.Enabled {
+		adaptiveLimiter = middleware.NewAdaptiveLimiter(rateLimiter, cfg.RateLimit.Adaptive)
+	}
+	corsMiddleware := middleware.NewCORS(cfg.Server.HTTP.CORSOrigins)
+
+	// Banned clients are refused before rate limiting. Bans are shared
+	// through Pika, so they are read from the primary.
+	var denylist *middleware.Denylist
+	if cfg.Denylist.Enabled {
+		logger.Info("Initializing denylist...")
+		denylist = middleware.NewDenylist(cfg.Denylist, pikaClient.Primary())
+		if cfg.Denylist.AutoBan.Enabled {
+			rateLimiter.OnViolation(denylist.RecordViolation)
+		}
+	}
+
+	// Calls are scheduled by priority once the server is saturated. The
+	// slots are shared by all chains.
+	var qos *middleware.QoS
+	if cfg.QoS.Enabled {
+		qos = middleware.NewQoS(cfg.QoS)
+	}
+
+	reload := newReloader(*configPath, overrides, cfg, rateLimiter, corsMiddleware)
 
 	rpcHandler := server.NewJSONRPCHandler(rateLimiter, cfg.Logging.SlowQueryThreshold)
+	rpcHandler.SetBindings(cfg.API.Bindings)
+	rpcHandler.SetDenylist(denylist)
+	rpcHandler.SetQoS(qos)
+	rpcHandler.EnableHeightPinning(blockReader)
+	reload.track(rpcHandler, cacheManager)
+
+	// Initialize shared response cache
+	var responseCache *cache.ResponseCache
+	if cfg.Cache.L2.Enabled {
+		logger.Infof("Connecting to L2 response cache at %s...", cfg.Cache.L2.Addr)
+		responseCache, err = cache.NewResponseCache(cfg.Cache.L2, cfg.Storage.Pika)
+		if err != nil {
+			logger.Fatalf("Failed to initialize L2 cache: %v", err)
+		}
+		rpcHandler.EnableResponseCache(responseCache, blockReader, cfg.Cache.L2.Confirmations)
+		logger.Info("L2 response cache initialized")
+	}
 
-	// Register API services with their namespaces
-	if err := rpcHandler.RegisterService("eth", blockAPI); err != nil {
-		logger.Fatalf("Failed to register block API: %v", err)
+	// Calls this service cannot answer yet are proxied to an upstream node.
+	// The URL is not logged, as hosted nodes carry credentials in it.
+	var fallback *server.Fallback
+	if cfg.Fallback.Enabled {
+		fallback, err = server.NewFallback(cfg.Fallback)
+		if err != nil {
+			logger.Fatalf("Failed to initialize upstream fallback: %v", err)
+		}
+		rpcHandler.SetFallback(fallback)
+		logger.Info("Upstream fallback initialized")
 	}
-	if err := rpcHandler.RegisterService("eth", gasAPI); err != nil {
-		logger.Fatalf("Failed to register gas API: %v", err)
+
+	// Server-side signing is off unless accounts are configured
+	var signer accounts.Backend
+	if cfg.Accounts.Enabled {
+		signer, err = accounts.NewBackend(cfg.Accounts)
+		if err != nil {
+			logger.Fatalf("Failed to initialize accounts: %v", err)
+		}
 	}
-	if err := rpcHandler.RegisterService("eth", stateAPI); err != nil {
-		logger.Fatalf("Failed to register state API: %v", err)
+
+	// Dev chains fund accounts whose keys sign for eth_sendTransaction
+	var devFunded []common.Address
+	if cfg.Dev.Enabled {
+		devKeys, funded, err := devAccounts(cfg.Dev)
+		if err != nil {
+			logger.Fatalf("Failed to derive dev accounts: %v", err)
+		}
+		signer, devFunded = devKeys, funded
+	}
+
+	// Webhooks are registered through the admin namespace
+	var webhooks *webhook.Dispatcher
+	if cfg.Webhooks.Enabled {
+		webhooks = webhook.NewDispatcher(cfg.Webhooks, pikaClient.Primary(), blockReader)
+		st.webhookStore = webhooks.Store()
 	}
-	if err := rpcHandler.RegisterService("eth", txAPI); err != nil {
-		logger.Fatalf("Failed to register transaction API: %v", err)
+
+	// Register API services with their namespaces. Operator and personal
+	// methods are only exposed when explicitly enabled.
+	namespaces := append([]string{}, defaultNamespaces...)
+	if cfg.API.NamespaceEnabled("admin") {
+		namespaces = append(namespaces, "admin")
 	}
-	if err := rpcHandler.RegisterService("eth", txPoolAPI); err != nil {
-		logger.Fatalf("Failed to register tx pool API: %v", err)
+	if cfg.API.NamespaceEnabled("evm") {
+		namespaces = append(namespaces, "evm")
 	}
-	if err := rpcHandler.RegisterService("net", netAPI); err != nil {
-		logger.Fatalf("Failed to register net API: %v", err)
+	if cfg.API.NamespaceEnabled("token") {
+		namespaces = append(namespaces, "token")
 	}
-	if err := rpcHandler.RegisterService("web3", web3API); err != nil {
-		logger.Fatalf("Failed to register web3 API: %v", err)
+	if cfg.API.NamespaceEnabled("personal") && signer != nil {
+		namespaces = append(namespaces, "personal")
 	}
-	if err := rpcHandler.RegisterService("txpool", txpoolNS); err != nil {
-		logger.Fatalf("Failed to register txpool API: %v", err)
+	listeners := &listenerSet{denylist: denylist, qos: qos}
+	status := &netStatus{listenerSet: listeners}
+	if err := registerAPIs(rpcHandler, namespaces, cfg, chainConfig, cfg.Chain.NetworkID, status, st, signer); err != nil {
+		logger.Fatalf("Failed to register APIs: %v", err)
+	}
+	logger.Infof("Exposed RPC methods: %s", strings.Join(rpcHandler.Methods(), ", "))
+	for namespace, listeners := range cfg.API.Bindings {
+		logger.Infof("Serving namespace %s only on listeners: %s", namespace, strings.Join(listeners, ", "))
 	}
 
-	// Initialize metrics
-	if cfg.Metrics.Enabled {
-		logger.Infof("Starting metrics server on %s", cfg.Metrics.ListenAddr)
-		metricsServer := metrics.NewServer(cfg.Metrics.ListenAddr)
-		go func() {
-			if err := metricsServer.Start(); err != nil {
-				logger.Errorf("Metrics server error: %v", err)
-			}
-		}()
+	// Register subsystems; they are started in order and stopped in reverse
+	runner := lifecycle.NewRunner()
+
+	// Traces are exported until the last subsystem has stopped
+	if cfg.Tracing.Enabled {
+		tracer, err := tracing.NewProvider(cfg.Tracing, version)
+		if err != nil {
+			logger.Fatalf("Failed to initialize tracing: %v", err)
+		}
+		runner.Add("tracing", tracer)
 	}
 
-	// Create context for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	poolCollector := storage.NewPoolCollector(pikaClient)
+	runner.Add("pika client", lifecycle.Hooks{
+		OnStart: func(ctx context.Context) error { return prometheus.Register(poolCollector) },
+		OnStop: func(ctx context.Context) error {
+			prometheus.Unregister(poolCollector)
+			return pikaClient.Close()
+		},
+	})
+	if cfg.Storage.Pika.Degraded.Enabled {
+		runner.Add("pika availability", storage.NewAvailabilityMonitor(pikaClient, cfg.Storage.Pika.Degraded))
+	}
+
+	if cfg.Dev.Enabled {
+		runner.Add("dev miner", dev.NewMiner(cfg.Dev, pikaClient.Primary(), chainConfig, st.txPoolStorage, devFunded))
+	}
+
+	if cfg.Ingest.Enabled {
+		ingestReader := storage.NewBlockReader(pikaClient.Primary())
+		ingester := ingest.NewIngester(cfg.Ingest, pikaClient.Primary(), ingestReader)
+		ingester.SetTxPool(st.txPoolStorage)
+		status.ingester = ingester
+		runner.Add("ingester", ingester)
+	}
+
+	runner.Add("tx pool evictor", prune.NewPoolEvictor(cfg.TxPool, st.txPoolStorage, storage.NewStateReader(pikaClient.Primary())))
+
+	switch cfg.Pruning.Mode {
+	case "", config.PruningModeArchive:
+	case config.PruningModePruned:
+		pruneReader := storage.NewBlockReader(pikaClient.Primary())
+		runner.Add("state pruner", prune.NewPruner(cfg.Pruning, pikaClient.Primary(), pruneReader))
+	default:
+		logger.Fatalf("Unknown pruning mode %q", cfg.Pruning.Mode)
+	}
+
+	if cacheManager != nil {
+		runner.Add("cache manager", cacheManager)
+		runner.Add("cache warmer", cache.NewWarmer(cacheManager, pikaClient, blockReader, cfg.Cache.WarmBlocks))
+	}
+
+	if responseCache != nil {
+		runner.Add("L2 response cache", responseCache)
+	}
+	if fallback != nil {
+		runner.Add("upstream fallback", fallback)
+	}
 
-	// Initialize subscription manager for WebSocket
+	// Initialize metrics. The head of the chain is exported so that stalled
+	// ingestion can be alerted on.
+	metrics.RecordBuildInfo(version, commit, runtime.Version())
+	healthChecker := server.NewHealthChecker(blockReader, pikaClient, cfg.Server.Health.MaxBlockLag)
+	chainCollector := server.NewChainCollector(cfg.Chain.Name, cfg.Chain.ChainID, healthChecker)
+	runner.Add("chain metrics", lifecycle.Hooks{
+		OnStart: func(ctx context.Context) error { return prometheus.Register(chainCollector) },
+		OnStop: func(ctx context.Context) error {
+			prometheus.Unregister(chainCollector)
+			return nil
+		},
+	})
+	if cfg.Metrics.Enabled {
+		runner.Add("metrics server", metrics.NewServer(cfg.Metrics.ListenAddr))
+	}
+
+	// Initialize subscription manager for WebSocket and event streams
 	var subManager *server.SubscriptionManager
-	if cfg.Server.WS.Enabled {
+	if cfg.Server.WS.Enabled || cfg.Server.HTTP.Events {
 		logger.Info("Initializing subscription manager...")
-		subManager = server.NewSubscriptionManager(pikaClient, blockReader)
-		// Subscription manager doesn't have a Run method - it starts listening internally
-		logger.Info("Subscription manager initialized")
+		subManager = server.NewSubscriptionManager(pikaClient, blockReader, cfg.Server.WS)
+		subManager.SetTxPool(st.txPoolStorage)
+		runner.Add("subscription manager", subManager)
+	}
+
+	// Data pipelines may follow the chain through a message broker
+	if cfg.Bridge.Enabled {
+		eventBridge, err := bridge.New(cfg.Bridge, pikaClient, blockReader)
+		if err != nil {
+			logger.Fatalf("Failed to initialize event bridge: %v", err)
+		}
+		logger.Infof("Publishing events to %s under %s.*", cfg.Bridge.Broker, cfg.Bridge.Prefix)
+		runner.Add("event bridge", eventBridge)
+	}
+
+	if webhooks != nil {
+		runner.Add("webhook dispatcher", webhooks)
+	}
+
+	// Further chains share the servers, rate limiter and middleware
+	var chains []*server.Chain
+	for _, chainCfg := range cfg.Chains {
+		chain, err := newExtraChain(startupCtx, cfg, chainCfg, rateLimiter, runner, signer, listeners, reload)
+		if err != nil {
+			logger.Fatalf("Failed to initialize chain %s: %v", chainCfg.Name, err)
+		}
+		chains = append(chains, chain)
+	}
+	stopStartup()
+
+	codec, ok := jsonx.Lookup(cfg.API.JSONCodec)
+	if !ok {
+		logger.Fatalf("Unknown api.json_codec %q", cfg.API.JSONCodec)
+	}
+	rpcHandler.SetCodec(codec)
+	for _, chain := range chains {
+		chain.Handler.SetCodec(codec)
 	}
 
 	// Create middleware
 	loggingMiddleware := middleware.NewLoggingMiddleware(cfg.Logging.SlowQueryThreshold)
-	corsMiddleware := middleware.NewCORS(cfg.Server.HTTP.CORSOrigins)
+	if cfg.Logging.Access.Enabled {
+		accessLog, err := middleware.NewAccessLog(cfg.Logging.Access)
+		if err != nil {
+			logger.Fatalf("Failed to open access log: %v", err)
+		}
+		rpcHandler.SetAccessLog(accessLog)
+		for _, chain := range chains {
+			chain.Handler.SetAccessLog(accessLog)
+		}
+		runner.Add("access log", lifecycle.Hooks{
+			OnStop: func(ctx context.Context) error {
+				accessLog.Close()
+				return nil
+			},
+		})
+	}
+	// Calls of the main chain are recorded for `rpc replay`
+	if cfg.Recorder.Enabled {
+		recorder, err := replay.NewRecorder(cfg.Recorder, pikaClient.Primary())
+		if err != nil {
+			logger.Fatalf("Failed to open recorder: %v", err)
+		}
+		rpcHandler.SetRecorder(recorder)
+		runner.Add("recorder", recorder)
+	}
+	runner.Add("config reloader", reload)
+	if denylist != nil {
+		runner.Add("denylist", denylist)
+	}
+	if adaptiveLimiter != nil {
+		runner.Add("adaptive rate limiter", adaptiveLimiter)
+	}
+
+	// Probes reach the dedicated health server without rate limiting and CORS
+	if cfg.Server.Health.Enabled {
+		healthServer := server.NewHealthServer(cfg.Server.Health, healthChecker, server.BuildInfo{
+			Version:   version,
+			Commit:    commit,
+			GoVersion: runtime.Version(),
+		})
+		for _, chain := range chains {
+			healthServer.AddChain(chain)
+		}
+		runner.Add("health server", healthServer)
+	}
+	if cfg.Server.Admin.Enabled {
+		runner.Add("admin server", server.NewAdminServer(cfg.Server.Admin))
+	}
 
 	// Initialize HTTP server
-	var httpServer *server.HTTPServer
 	if cfg.Server.HTTP.Enabled {
 		logger.Infof("Initializing HTTP server on %s", cfg.Server.HTTP.ListenAddr)
-		httpServer = server.NewHTTPServer(
+		httpServer := server.NewHTTPServer(
 			cfg.Server.HTTP,
 			rpcHandler,
-			blockReader,
+			healthChecker,
 			rateLimiter,
+			denylist,
 			loggingMiddleware,
 			corsMiddleware,
 		)
+		for _, chain := range chains {
+			httpServer.AddChain(chain)
+		}
+		if cfg.Server.HTTP.Events {
+			httpServer.EnableEvents(subManager, cfg.Server.HTTP.MaxEventStreams)
+		}
+		listeners.servers = append(listeners.servers, httpServer)
+		runner.Add("HTTP server", httpServer)
+	}
+
+	// The private listener serves namespaces bound to it, such as operator
+	// ones, on an internal address; browsers are not expected there, and
+	// the denylist does not apply so that operators cannot be locked out
+	if cfg.Server.Private.Enabled {
+		logger.Infof("Initializing private HTTP server on %s", cfg.Server.Private.ListenAddr)
+		privateServer := server.NewHTTPServer(
+			cfg.Server.Private,
+			rpcHandler,
+			healthChecker,
+			rateLimiter,
+			nil,
+			loggingMiddleware,
+			nil,
+		)
+		privateServer.SetListener(server.ListenerPrivate)
+		for _, chain := range chains {
+			privateServer.AddChain(chain)
+		}
+		listeners.servers = append(listeners.servers, privateServer)
+		runner.Add("private HTTP server", privateServer)
 	}
 
 	// Initialize WebSocket server
-	var wsServer *server.WebSocketServer
 	if cfg.Server.WS.Enabled {
 		logger.Infof("Initializing WebSocket server on %s", cfg.Server.WS.ListenAddr)
-		wsServer = server.NewWebSocketServer(
+		wsServer := server.NewWebSocketServer(
 			cfg.Server.WS,
 			rpcHandler,
 			subManager,
-			cfg.Server.HTTP.CORSOrigins,
+			corsMiddleware,
 		)
+		for _, chain := range chains {
+			wsServer.AddChain(chain)
+		}
+		listeners.servers = append(listeners.servers, wsServer)
+		runner.Add("WebSocket server", wsServer)
 	}
 
-	// Start servers
-	errChan := make(chan error, 2)
-
-	if httpServer != nil {
-		go func() {
-			logger.Infof("Starting HTTP server on %s", cfg.Server.HTTP.ListenAddr)
-			if err := httpServer.Start(); err != nil {
-				errChan <- fmt.Errorf("HTTP server error: %w", err)
-			}
-		}()
-	}
-
-	if wsServer != nil {
-		go func() {
-			logger.Infof("Starting WebSocket server on %s", cfg.Server.WS.ListenAddr)
-			if err := wsServer.Start(); err != nil {
-				errChan <- fmt.Errorf("WebSocket server error: %w", err)
-			}
-		}()
-	}
-
-	logger.Info("All servers started successfully")
+	// Create context for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// Log cache statistics periodically
-	if cacheManager != nil {
-		go func() {
-			ticker := time.NewTicker(5 * time.Minute)
-			defer ticker.Stop()
-			for {
-				select {
-				case <-ticker.C:
-					stats := cacheManager.Stats()
-					for name, stat := range stats {
-						logger.Infof("Cache[%s] - Hits: %d, Misses: %d, Size: %d, HitRate: %.2f%%",
-							name, stat.Hits, stat.Misses, stat.Size, stat.HitRate*100)
-					}
-				case <-ctx.Done():
-					return
-				}
-			}
-		}()
-	}
-
-	// Wait for shutdown signal
+	// Start subsystems
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	select {
-	case err := <-errChan:
-		logger.Errorf("Server error: %v", err)
-	case sig := <-sigChan:
-		logger.Infof("Received signal: %v", sig)
+	if err := runner.Start(ctx); err != nil {
+		logger.Errorf("Startup error: %v", err)
+	} else {
+		logger.Info("All servers started successfully")
+
+		// Wait for shutdown signal
+		select {
+		case err := <-runner.Err():
+			logger.Errorf("Server error: %v", err)
+		case sig := <-sigChan:
+			logger.Infof("Received signal: %v", sig)
+		}
 	}
 
 	// Graceful shutdown
 	logger.Info("Shutting down servers...")
 	cancel()
 
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer shutdownCancel()
 
-	if httpServer != nil {
-		if err := httpServer.Stop(shutdownCtx); err != nil {
-			logger.Errorf("HTTP server shutdown error: %v", err)
-		}
-	}
-
-	if wsServer != nil {
-		if err := wsServer.Stop(shutdownCtx); err != nil {
-			logger.Errorf("WebSocket server shutdown error: %v", err)
-		}
+	if err := runner.Stop(shutdownCtx); err != nil {
+		logger.Errorf("Shutdown error: %v", err)
 	}
 
 	logger.Info("Shutdown complete")
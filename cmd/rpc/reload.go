@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sunvim/evm_rpc/pkg/cache"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/middleware"
+	"github.com/sunvim/evm_rpc/pkg/server"
+)
+
+// reloadDebounce collapses the burst of events an editor or a ConfigMap
+// update produces into one reload
+const reloadDebounce = 200 * time.Millisecond
+
+// reloader re-reads the config file on SIGHUP, or when it changes if
+// watching is enabled, and applies the settings that can change at runtime.
+// Connections are not touched; each setting is swapped atomically.
+type reloader struct {
+	path        string
+	overrides   map[string]interface{}
+	watch       bool
+	rateLimiter *middleware.RateLimiter
+	cors        *middleware.CORS
+
+	mu       sync.Mutex
+	current  *config.Config
+	contents []byte
+	handlers []*server.JSONRPCHandler
+	caches   []*cache.Manager
+
+	sigCh   chan os.Signal
+	watcher *fsnotify.Watcher
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+}
+
+// newReloader creates a reloader for the config loaded from path. The
+// command line overrides keep precedence over the file on reload.
+func newReloader(path string, overrides map[string]interface{}, cfg *config.Config, rateLimiter *middleware.RateLimiter, cors *middleware.CORS) *reloader {
+	contents, _ := os.ReadFile(path)
+	return &reloader{
+		path:        path,
+		overrides:   overrides,
+		watch:       cfg.Reload.Watch,
+		rateLimiter: rateLimiter,
+		cors:        cors,
+		current:     cfg,
+		contents:    contents,
+		sigCh:       make(chan os.Signal, 1),
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// track applies reloaded settings to the handler and cache of a chain.
+// The cache may be nil.
+func (r *reloader) track(handler *server.JSONRPCHandler, cacheManager *cache.Manager) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	handler.SetDisabledMethods(r.current.API.DisabledMethods)
+	r.handlers = append(r.handlers, handler)
+	if cacheManager != nil {
+		r.caches = append(r.caches, cacheManager)
+	}
+}
+
+// Start listens for SIGHUP and, if enabled, watches the config file
+func (r *reloader) Start(ctx context.Context) error {
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+	if r.watch {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return fmt.Errorf("failed to watch config: %w", err)
+		}
+		// Watch the directory, as editors and ConfigMap updates replace the
+		// file rather than writing to it
+		if err := watcher.Add(filepath.Dir(r.path)); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch config: %w", err)
+		}
+		r.watcher = watcher
+		events, errs = watcher.Events, watcher.Errors
+		logger.Infof("Watching %s for changes", r.path)
+	}
+
+	signal.Notify(r.sigCh, syscall.SIGHUP)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-r.stopCh:
+				return
+			case <-r.sigCh:
+				logger.Info("Received SIGHUP, reloading configuration")
+				r.reload(true)
+			case <-events:
+				debounce = time.After(reloadDebounce)
+			case err := <-errs:
+				logger.Warnf("Config watcher error: %v", err)
+			case <-debounce:
+				debounce = nil
+				r.reload(false)
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops listening for reloads
+func (r *reloader) Stop(ctx context.Context) error {
+	signal.Stop(r.sigCh)
+	close(r.stopCh)
+	r.wg.Wait()
+	if r.watcher != nil {
+		return r.watcher.Close()
+	}
+	return nil
+}
+
+// reload re-reads the config file and applies it. Unless forced, nothing is
+// done when the file is unchanged. A config that fails to load is ignored.
+func (r *reloader) reload(force bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	contents, err := os.ReadFile(r.path)
+	if err != nil {
+		logger.Errorf("Failed to reload config: %v", err)
+		return
+	}
+	if !force && bytes.Equal(contents, r.contents) {
+		return
+	}
+	cfg, err := config.LoadConfigWithDefaults(r.path, r.overrides)
+	if err != nil {
+		logger.Errorf("Failed to reload config, keeping the current one: %v", err)
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		logger.Errorf("Invalid config, keeping the current one: %v", err)
+		return
+	}
+
+	r.rateLimiter.Update(
+		cfg.RateLimit.Enabled,
+		cfg.RateLimit.Global.RequestsPerSecond,
+		cfg.RateLimit.Global.Burst,
+		cfg.RateLimit.IP.RequestsPerSecond,
+		cfg.RateLimit.IP.Burst,
+		cfg.RateLimit.Method,
+	)
+	if err := logger.SetLevel(cfg.Logging.Level); err != nil {
+		logger.Warnf("Keeping log level %s: %v", logger.Level(), err)
+	}
+	r.cors.SetOrigins(cfg.Server.HTTP.CORSOrigins)
+	for _, handler := range r.handlers {
+		handler.SetDisabledMethods(cfg.API.DisabledMethods)
+	}
+	for _, cacheManager := range r.caches {
+		cacheManager.SetTTL(cfg.Cache.TTL)
+	}
+
+	if !reflect.DeepEqual(staticConfig(r.current), staticConfig(cfg)) {
+		logger.Warn("Config changes other than rate limits, log level, CORS origins, disabled methods and cache TTLs take effect after a restart")
+	}
+	r.current = cfg
+	r.contents = contents
+	logger.Infof("Reloaded configuration from %s", r.path)
+}
+
+// staticConfig returns a copy of cfg without the settings applied on reload
+func staticConfig(cfg *config.Config) config.Config {
+	static := *cfg
+	static.RateLimit = config.RateLimitConfig{Adaptive: cfg.RateLimit.Adaptive}
+	static.Logging.Level = ""
+	static.Server.HTTP.CORSOrigins = nil
+	static.API.DisabledMethods = nil
+	static.Cache.TTL = config.CacheTTLConfig{}
+	return static
+}
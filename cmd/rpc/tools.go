@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/bench"
+	"github.com/sunvim/evm_rpc/pkg/blockio"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/forks"
+	"github.com/sunvim/evm_rpc/pkg/ingest"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/replay"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// tools maps subcommand names to their entry points
+var tools = map[string]func(args []string) error{
+	"export":  runExport,
+	"import":  runImport,
+	"archive": runArchive,
+	"config":  runConfig,
+	"replay":  runReplay,
+	"bench":   runBench,
+}
+
+// runTool runs a subcommand and exits with its status
+func runTool(name string, args []string) {
+	err := tools[name](args)
+	logger.Sync()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// runExport writes stored blocks and receipts to an RLP file
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configPath := fs.String("config", "config/config.yaml", "Path to configuration file")
+	from := fs.Uint64("from", 0, "First block to export")
+	to := fs.Int64("to", -1, "Last block to export (default: latest block)")
+	out := fs.String("out", "", "Output file; a .gz suffix enables gzip compression")
+	configOverrides := addConfigFlags(fs)
+	fs.Parse(args)
+
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+
+	cfg, pikaClient, err := openStorage(*configPath, configOverrides())
+	if err != nil {
+		return err
+	}
+	defer pikaClient.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	reader := storage.NewBlockReader(pikaClient.Primary())
+	if cfg.Storage.Cold.Enabled {
+		cold, err := storage.NewColdStore(cfg.Storage.Cold)
+		if err != nil {
+			return err
+		}
+		reader.SetColdStore(cold)
+	}
+	last := uint64(*to)
+	if *to < 0 {
+		if last, err = reader.GetLatestBlockNumber(ctx); err != nil {
+			return fmt.Errorf("failed to read latest block: %w", err)
+		}
+	}
+	if last < *from {
+		return fmt.Errorf("empty range %d-%d", *from, last)
+	}
+
+	w, err := blockio.CreateFile(*out)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Exporting blocks %d-%d to %s", *from, last, *out)
+	_, err = blockio.Export(ctx, reader, w, *from, last)
+	return errors.Join(err, w.Close())
+}
+
+// runImport writes blocks and receipts from an RLP file or another RPC
+// endpoint to Pika
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	configPath := fs.String("config", "config/config.yaml", "Path to configuration file")
+	in := fs.String("in", "", "Input file written by export")
+	rpcURL := fs.String("rpc", "", "RPC endpoint to copy blocks from instead of a file")
+	from := fs.Uint64("from", 0, "First block to copy from -rpc")
+	to := fs.Int64("to", -1, "Last block to copy from -rpc (default: its latest block)")
+	configOverrides := addConfigFlags(fs)
+	fs.Parse(args)
+
+	if (*in == "") == (*rpcURL == "") {
+		return errors.New("exactly one of -in and -rpc is required")
+	}
+
+	_, pikaClient, err := openStorage(*configPath, configOverrides())
+	if err != nil {
+		return err
+	}
+	defer pikaClient.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var src blockio.Source
+	if *in != "" {
+		file, err := blockio.OpenFile(*in)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		src = file
+		logger.Infof("Importing blocks from %s", *in)
+	} else {
+		upstream, err := ingest.DialUpstream(ctx, *rpcURL)
+		if err != nil {
+			return err
+		}
+		defer upstream.Close()
+
+		last := uint64(*to)
+		if *to < 0 {
+			if last, err = upstream.Head(ctx); err != nil {
+				return fmt.Errorf("failed to get upstream head: %w", err)
+			}
+		}
+		src = blockio.NewUpstreamSource(upstream, *from, last)
+		logger.Infof("Importing blocks %d-%d from %s", *from, last, config.RedactURL(*rpcURL))
+	}
+
+	primary := pikaClient.Primary()
+	_, err = blockio.Import(ctx, storage.NewBlockReader(primary), storage.NewBlockWriter(primary), src)
+	return err
+}
+
+// runArchive copies old blocks from Pika to cold storage
+func runArchive(args []string) error {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	configPath := fs.String("config", "config/config.yaml", "Path to configuration file")
+	from := fs.Uint64("from", 0, "First block to archive")
+	to := fs.Int64("to", -1, "Last block to archive (default: the block below storage.cold.below_block)")
+	drop := fs.Bool("delete", false, "Delete archived headers, bodies and receipts from Pika")
+	configOverrides := addConfigFlags(fs)
+	fs.Parse(args)
+
+	cfg, pikaClient, err := openStorage(*configPath, configOverrides())
+	if err != nil {
+		return err
+	}
+	defer pikaClient.Close()
+
+	coldCfg := cfg.Storage.Cold
+	if coldCfg.Endpoint == "" {
+		return errors.New("storage.cold is not configured")
+	}
+	if coldCfg.BelowBlock == 0 && *to < 0 {
+		return errors.New("-to is required when storage.cold.below_block is 0")
+	}
+	last := uint64(*to)
+	if *to < 0 {
+		last = coldCfg.BelowBlock - 1
+	}
+	if last < *from {
+		return fmt.Errorf("empty range %d-%d", *from, last)
+	}
+	// Deleted blocks are only readable if they are routed to cold storage
+	if *drop && last >= coldCfg.BelowBlock {
+		return fmt.Errorf("-delete requires blocks below storage.cold.below_block (%d)", coldCfg.BelowBlock)
+	}
+
+	cold, err := storage.NewColdStore(coldCfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Infof("Archiving blocks %d-%d", *from, last)
+	primary := pikaClient.Primary()
+	for number := *from; number <= last; number++ {
+		if err := cold.Archive(ctx, primary, number, *drop); err != nil {
+			return fmt.Errorf("block %d: %w", number, err)
+		}
+		if (number-*from+1)%10000 == 0 {
+			logger.Infof("Archived %d blocks, at block %d", number-*from+1, number)
+		}
+	}
+	logger.Infof("Archived %d blocks", last-*from+1)
+	return nil
+}
+
+// runConfig runs the config subcommands. check prints the effective
+// configuration with secrets redacted and validates it.
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("usage: config check [-config path] [flags]")
+	}
+	fs := flag.NewFlagSet("config check", flag.ExitOnError)
+	configPath := fs.String("config", "config/config.yaml", "Path to configuration file")
+	configOverrides := addConfigFlags(fs)
+	fs.Parse(args[1:])
+
+	cfg, err := config.LoadConfigWithDefaults(*configPath, configOverrides())
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	dump, err := cfg.Dump()
+	if err != nil {
+		return err
+	}
+	fmt.Print(dump)
+
+	err = cfg.Validate()
+	if _, forksErr := forks.ChainConfig(cfg.Chain.ChainID, cfg.Chain.Forks); forksErr != nil {
+		err = errors.Join(err, fmt.Errorf("chain.forks: %w", forksErr))
+	}
+	for i, chain := range cfg.Chains {
+		if _, forksErr := forks.ChainConfig(chain.ChainID, chain.Forks); forksErr != nil {
+			err = errors.Join(err, fmt.Errorf("chains[%d].forks: %w", i, forksErr))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
+	}
+	fmt.Fprintln(os.Stderr, "config is valid")
+	return nil
+}
+
+// runReplay re-executes recorded calls against an endpoint and reports the
+// responses that differ from the recorded ones
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	configPath := fs.String("config", "config/config.yaml", "Path to configuration file, for -pika")
+	in := fs.String("in", "", "Recordings file written by the recorder")
+	fromPika := fs.Bool("pika", false, "Read the recordings kept in Pika instead of a file")
+	target := fs.String("target", "http://127.0.0.1:8545", "JSON-RPC endpoint to replay the calls against")
+	methods := fs.String("methods", "", "Comma-separated methods to replay (default: all)")
+	limit := fs.Int("limit", 0, "Replay at most this many calls (default: all)")
+	pin := fs.Bool("pin", true, "Pin every call to the height it was recorded at")
+	timeout := fs.Duration("timeout", 30*time.Second, "Timeout of every call")
+	configOverrides := addConfigFlags(fs)
+	fs.Parse(args)
+
+	if (*in == "") == !*fromPika {
+		return errors.New("exactly one of -in and -pika is required")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var (
+		recordings []*replay.Recording
+		err        error
+	)
+	if *fromPika {
+		_, pikaClient, err := openStorage(*configPath, configOverrides())
+		if err != nil {
+			return err
+		}
+		defer pikaClient.Close()
+		if recordings, err = replay.ReadStore(ctx, storage.NewRecordingStore(pikaClient.Primary())); err != nil {
+			return fmt.Errorf("failed to read recordings: %w", err)
+		}
+	} else if recordings, err = replay.ReadFile(*in); err != nil {
+		return err
+	}
+
+	if *methods != "" {
+		wanted := make(map[string]bool)
+		for _, method := range strings.Split(*methods, ",") {
+			wanted[strings.TrimSpace(method)] = true
+		}
+		filtered := recordings[:0]
+		for _, rec := range recordings {
+			if wanted[rec.Method] {
+				filtered = append(filtered, rec)
+			}
+		}
+		recordings = filtered
+	}
+	if *limit > 0 && len(recordings) > *limit {
+		recordings = recordings[:*limit]
+	}
+
+	fmt.Fprintf(os.Stderr, "Replaying %d calls against %s\n", len(recordings), config.RedactURL(*target))
+	replayer := replay.NewReplayer(*target, *pin, *timeout)
+	report, err := replayer.Replay(ctx, recordings, printReplayResult)
+	fmt.Fprintf(os.Stderr, "%d matched, %d mismatched, %d failed, %d skipped\n",
+		report.Matched, report.Mismatched, report.Failed, report.Skipped)
+	if err != nil {
+		return err
+	}
+	if differ := report.Mismatched + report.Failed; differ > 0 {
+		return fmt.Errorf("%d of %d replayed calls differ from their recordings", differ, report.Matched+differ)
+	}
+	return nil
+}
+
+// printReplayResult prints a call whose replay differs from its recording
+func printReplayResult(result *replay.Result) {
+	if result.Outcome != replay.OutcomeMismatch && result.Outcome != replay.OutcomeFailed {
+		return
+	}
+	rec := result.Recording
+	at := "unknown height"
+	if rec.Height != nil {
+		at = fmt.Sprintf("height %d", *rec.Height)
+	}
+	fmt.Printf("%s %s at %s, recorded %s", result.Outcome, rec.Method, at, rec.Time.Format(time.RFC3339))
+	if rec.RequestID != "" {
+		fmt.Printf(" (request %s)", rec.RequestID)
+	}
+	fmt.Printf(": %s\n  params:   %s\n", result.Detail, abbreviate(rec.Params))
+	if result.Outcome == replay.OutcomeMismatch && rec.Result != nil && result.Response != nil {
+		fmt.Printf("  recorded: %s\n  replayed: %s\n", abbreviate(rec.Result), abbreviate(result.Response))
+	}
+}
+
+// abbreviate shortens JSON for display
+func abbreviate(data []byte) string {
+	const max = 512
+	if len(data) > max {
+		return string(data[:max]) + "..."
+	}
+	return string(data)
+}
+
+// runBench load-tests an endpoint with a weighted mix of calls and reports
+// latency percentiles and error rates per method
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	target := fs.String("target", "http://127.0.0.1:8545", "JSON-RPC endpoint to load-test")
+	mixFlag := fs.String("mix", bench.DefaultMix, "Methods with their weights, as method=weight,... (methods: "+strings.Join(bench.Methods(), ", ")+")")
+	concurrency := fs.Int("concurrency", 16, "Calls in flight")
+	duration := fs.Duration("duration", 30*time.Second, "Duration of the run")
+	callRate := fs.Float64("rate", 0, "Calls per second over all workers (default: as fast as answered)")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout of every call")
+	blocks := fs.Int("blocks", 64, "Latest blocks whose transactions and accounts params are drawn from")
+	seed := fs.Int64("seed", 1, "Seed of the params drawn")
+	fs.Parse(args)
+
+	mix, err := bench.ParseMix(*mixFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -mix: %w", err)
+	}
+	if *concurrency <= 0 || *duration <= 0 || *timeout <= 0 || *callRate < 0 {
+		return errors.New("-concurrency, -duration and -timeout must be positive and -rate not negative")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client, err := bench.Dial(ctx, *target, *concurrency)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	fixture, err := bench.SampleFixture(ctx, client, *blocks)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Sampled %d blocks up to %d: %d transactions, %d addresses, %d calls\n",
+		len(fixture.Blocks), fixture.Head, len(fixture.Txs), len(fixture.Addresses), len(fixture.Calls))
+	fmt.Fprintf(os.Stderr, "Benchmarking %s for %s with %d calls in flight\n", config.RedactURL(*target), *duration, *concurrency)
+
+	report := bench.Run(ctx, client, fixture, bench.Options{
+		Mix:         mix,
+		Concurrency: *concurrency,
+		Duration:    *duration,
+		Rate:        *callRate,
+		Timeout:     *timeout,
+		Seed:        *seed,
+	})
+	printBenchReport(report)
+	return nil
+}
+
+// printBenchReport prints the stats of every method and of all calls,
+// followed by the errors and failures seen
+func printBenchReport(report *bench.Report) {
+	fmt.Printf("%-28s %9s %10s %8s %10s %10s %10s %10s\n", "method", "calls", "error rate", "failed", "p50", "p90", "p99", "max")
+	for _, s := range append(report.Methods, report.Total) {
+		fmt.Printf("%-28s %9d %9.2f%% %8d %10s %10s %10s %10s\n", s.Method, s.Calls, 100*s.ErrorRate(), s.Failures,
+			roundLatency(s.Percentile(50)), roundLatency(s.Percentile(90)), roundLatency(s.Percentile(99)), roundLatency(s.Percentile(100)))
+	}
+	fmt.Printf("\n%d calls in %s, %.1f calls/s\n", report.Total.Calls, report.Elapsed.Round(time.Millisecond), report.Throughput())
+
+	if len(report.Total.Codes) > 0 {
+		codes := make([]int, 0, len(report.Total.Codes))
+		for code := range report.Total.Codes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		fmt.Println("JSON-RPC errors by code:")
+		for _, code := range codes {
+			fmt.Printf("  %d: %d\n", code, report.Total.Codes[code])
+		}
+	}
+	if len(report.Total.Reasons) > 0 {
+		reasons := make([]string, 0, len(report.Total.Reasons))
+		for reason := range report.Total.Reasons {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(i, j int) bool { return report.Total.Reasons[reasons[i]] > report.Total.Reasons[reasons[j]] })
+		fmt.Println("Failures:")
+		for _, reason := range reasons {
+			fmt.Printf("  %s: %d\n", reason, report.Total.Reasons[reason])
+		}
+	}
+}
+
+// roundLatency rounds a latency for display
+func roundLatency(d time.Duration) time.Duration {
+	if d >= time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// openStorage loads the configuration, initializes logging and connects to
+// Pika for a subcommand
+func openStorage(configPath string, overrides map[string]interface{}) (*config.Config, *storage.PikaClient, error) {
+	cfg, err := config.LoadConfigWithDefaults(configPath, overrides)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := logger.InitLogger(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.Output); err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize logger: %w", err)
+	}
+
+	pikaClient, err := storage.NewPikaClient(cfg.Storage.Pika)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to Pika: %w", err)
+	}
+	return cfg, pikaClient, nil
+}
@@ -0,0 +1,102 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/sunvim/evm_rpc/pkg/config"
+)
+
+var (
+	// ErrUnknownAccount is returned for an address the backend holds no key for
+	ErrUnknownAccount = errors.New("unknown account")
+
+	// ErrLocked is returned when a key is held but was not unlocked
+	ErrLocked = errors.New("authentication needed: password or unlock")
+
+	// ErrPassphraseUnsupported is returned by backends that cannot sign with
+	// a passphrase given per request
+	ErrPassphraseUnsupported = errors.New("passphrase signing not supported by this backend")
+
+	// ErrInvalidTypedData is returned for EIP-712 data that cannot be hashed
+	ErrInvalidTypedData = errors.New("invalid typed data")
+)
+
+// Backend signs on behalf of the accounts it manages
+type Backend interface {
+	// Accounts lists the addresses the backend can sign for
+	Accounts(ctx context.Context) ([]common.Address, error)
+
+	// SignTx signs a transaction for the given chain
+	SignTx(ctx context.Context, from common.Address, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+
+	// SignText signs data as an EIP-191 personal message
+	SignText(ctx context.Context, from common.Address, data []byte) ([]byte, error)
+
+	// SignTypedData signs EIP-712 typed data
+	SignTypedData(ctx context.Context, from common.Address, typedData apitypes.TypedData) ([]byte, error)
+}
+
+// PassphraseBackend is implemented by backends that can unlock a key for a
+// single request, as the personal namespace does
+type PassphraseBackend interface {
+	Backend
+	SignTxWithPassphrase(ctx context.Context, from common.Address, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+	SignTextWithPassphrase(ctx context.Context, from common.Address, passphrase string, data []byte) ([]byte, error)
+}
+
+// NewBackend creates the signing backend selected in the config
+func NewBackend(cfg config.AccountsConfig) (Backend, error) {
+	switch cfg.Backend {
+	case "", config.AccountsBackendKeystore:
+		return NewKeystore(cfg.KeystoreDir, cfg.PasswordFile)
+	case config.AccountsBackendRemote:
+		return NewRemoteSigner(cfg.RemoteURL, cfg.Timeout)
+	default:
+		return nil, fmt.Errorf("unknown accounts backend %q", cfg.Backend)
+	}
+}
+
+// TypedDataHash returns the EIP-712 hash of typed data, the digest that is
+// signed
+func TypedDataHash(typedData apitypes.TypedData) ([]byte, error) {
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTypedData, err)
+	}
+	return hash, nil
+}
+
+// RecoverSigner returns the address that produced a signature of hash,
+// with V as 27 or 28 as eth_sign returns it
+func RecoverSigner(hash, sig []byte) (common.Address, error) {
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("signature must be %d bytes long", crypto.SignatureLength)
+	}
+	if sig[crypto.RecoveryIDOffset] != 27 && sig[crypto.RecoveryIDOffset] != 28 {
+		return common.Address{}, errors.New("invalid Ethereum signature (V is not 27 or 28)")
+	}
+	sig = common.CopyBytes(sig)
+	sig[crypto.RecoveryIDOffset] -= 27
+
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// sortAddresses orders addresses so that account lists are stable
+func sortAddresses(addresses []common.Address) {
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i][:], addresses[j][:]) < 0
+	})
+}
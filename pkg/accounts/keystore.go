@@ -0,0 +1,295 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrDecrypt is returned for a wrong passphrase
+var ErrDecrypt = errors.New("could not decrypt key with given password")
+
+// Keystore signs with keys from a directory of encrypted key files in the
+// Web3 Secret Storage format written by geth and clef. Keys are unlocked at
+// startup with the password file, or per request with a passphrase.
+// The key set is fixed after loading, so no locking is needed.
+type Keystore struct {
+	files    map[common.Address]*keyFile
+	unlocked map[common.Address]*ecdsa.PrivateKey
+}
+
+// keyFile is an encrypted key file (version 3)
+type keyFile struct {
+	Address string `json:"address"`
+	Crypto  struct {
+		Cipher       string `json:"cipher"`
+		CipherText   string `json:"ciphertext"`
+		CipherParams struct {
+			IV string `json:"iv"`
+		} `json:"cipherparams"`
+		KDF       string                 `json:"kdf"`
+		KDFParams map[string]interface{} `json:"kdfparams"`
+		MAC       string                 `json:"mac"`
+	} `json:"crypto"`
+	Version int `json:"version"`
+}
+
+// NewKeystore loads the key files in dir and unlocks them with the password
+// in passwordFile, if set. Keys the password does not decrypt stay locked.
+func NewKeystore(dir, passwordFile string) (*Keystore, error) {
+	if dir == "" {
+		return nil, errors.New("accounts keystore_dir is not set")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore: %w", err)
+	}
+
+	ks := &Keystore{
+		files:    make(map[common.Address]*keyFile),
+		unlocked: make(map[common.Address]*ecdsa.PrivateKey),
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file %s: %w", name, err)
+		}
+		kf := new(keyFile)
+		if err := json.Unmarshal(data, kf); err != nil || kf.Version != 3 || !common.IsHexAddress(kf.Address) ||
+			common.HexToAddress(kf.Address) == (common.Address{}) {
+			logger.Warnf("Skipping %s in keystore: not a version 3 key file", name)
+			continue
+		}
+		ks.files[common.HexToAddress(kf.Address)] = kf
+	}
+
+	if passwordFile != "" {
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password file: %w", err)
+		}
+		password := strings.TrimRight(string(data), "\r\n")
+		for address, kf := range ks.files {
+			key, err := kf.decrypt(password)
+			if err != nil {
+				logger.Warnf("Account %s stays locked: %v", address.Hex(), err)
+				continue
+			}
+			ks.unlocked[address] = key
+		}
+	}
+
+	logger.Infof("Loaded %d accounts from keystore, %d unlocked", len(ks.files), len(ks.unlocked))
+	return ks, nil
+}
+
+// Accounts lists the addresses of all key files
+func (ks *Keystore) Accounts(ctx context.Context) ([]common.Address, error) {
+	addresses := make([]common.Address, 0, len(ks.files))
+	for address := range ks.files {
+		addresses = append(addresses, address)
+	}
+	sortAddresses(addresses)
+	return addresses, nil
+}
+
+// SignTx signs a transaction with an unlocked key
+func (ks *Keystore) SignTx(ctx context.Context, from common.Address, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	key, err := ks.unlockedKey(from)
+	if err != nil {
+		return nil, err
+	}
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+}
+
+// SignText signs a personal message with an unlocked key
+func (ks *Keystore) SignText(ctx context.Context, from common.Address, data []byte) ([]byte, error) {
+	key, err := ks.unlockedKey(from)
+	if err != nil {
+		return nil, err
+	}
+	return signText(key, data)
+}
+
+// SignTypedData signs EIP-712 typed data with an unlocked key
+func (ks *Keystore) SignTypedData(ctx context.Context, from common.Address, typedData apitypes.TypedData) ([]byte, error) {
+	key, err := ks.unlockedKey(from)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := TypedDataHash(typedData)
+	if err != nil {
+		return nil, err
+	}
+	return signHash(key, hash)
+}
+
+// SignTxWithPassphrase signs a transaction, decrypting the key for this
+// request only
+func (ks *Keystore) SignTxWithPassphrase(ctx context.Context, from common.Address, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	key, err := ks.decryptKey(from, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+}
+
+// SignTextWithPassphrase signs a personal message, decrypting the key for
+// this request only
+func (ks *Keystore) SignTextWithPassphrase(ctx context.Context, from common.Address, passphrase string, data []byte) ([]byte, error) {
+	key, err := ks.decryptKey(from, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return signText(key, data)
+}
+
+// unlockedKey returns the key of an account unlocked at startup
+func (ks *Keystore) unlockedKey(from common.Address) (*ecdsa.PrivateKey, error) {
+	if key, ok := ks.unlocked[from]; ok {
+		return key, nil
+	}
+	if _, ok := ks.files[from]; ok {
+		return nil, ErrLocked
+	}
+	return nil, ErrUnknownAccount
+}
+
+// decryptKey decrypts the key of an account with a passphrase
+func (ks *Keystore) decryptKey(from common.Address, passphrase string) (*ecdsa.PrivateKey, error) {
+	kf, ok := ks.files[from]
+	if !ok {
+		return nil, ErrUnknownAccount
+	}
+	return kf.decrypt(passphrase)
+}
+
+// RecoverText returns the address that signed data as an EIP-191 personal
+// message
+func RecoverText(data, sig []byte) (common.Address, error) {
+	return RecoverSigner(accounts.TextHash(data), sig)
+}
+
+// signText signs the EIP-191 hash of data, returning the signature with V
+// as 27 or 28 as eth_sign does
+func signText(key *ecdsa.PrivateKey, data []byte) ([]byte, error) {
+	return signHash(key, accounts.TextHash(data))
+}
+
+// signHash signs a digest, returning the signature with V as 27 or 28
+func signHash(key *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		return nil, err
+	}
+	sig[crypto.RecoveryIDOffset] += 27
+	return sig, nil
+}
+
+// decrypt derives the key encryption key from the passphrase, checks the
+// MAC and decrypts the private key
+func (kf *keyFile) decrypt(passphrase string) (*ecdsa.PrivateKey, error) {
+	if kf.Crypto.Cipher != "aes-128-ctr" {
+		return nil, fmt.Errorf("cipher not supported: %s", kf.Crypto.Cipher)
+	}
+	mac, err := hex.DecodeString(kf.Crypto.MAC)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := hex.DecodeString(kf.Crypto.CipherParams.IV)
+	if err != nil {
+		return nil, err
+	}
+	cipherText, err := hex.DecodeString(kf.Crypto.CipherText)
+	if err != nil {
+		return nil, err
+	}
+
+	derivedKey, err := kf.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(derivedKey) < 32 {
+		return nil, fmt.Errorf("derived key too short: %d bytes", len(derivedKey))
+	}
+	if !bytes.Equal(crypto.Keccak256(derivedKey[16:32], cipherText), mac) {
+		return nil, ErrDecrypt
+	}
+
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid IV length: %d bytes", len(iv))
+	}
+	block, err := aes.NewCipher(derivedKey[:16])
+	if err != nil {
+		return nil, err
+	}
+	plainText := make([]byte, len(cipherText))
+	cipher.NewCTR(block, iv).XORKeyStream(plainText, cipherText)
+
+	key, err := crypto.ToECDSA(plainText)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.PubkeyToAddress(key.PublicKey) != common.HexToAddress(kf.Address) {
+		return nil, errors.New("key does not match the address of its file")
+	}
+	return key, nil
+}
+
+// deriveKey runs the key derivation function named in the key file
+func (kf *keyFile) deriveKey(passphrase string) ([]byte, error) {
+	params := kf.Crypto.KDFParams
+	salt, err := hex.DecodeString(stringParam(params, "salt"))
+	if err != nil {
+		return nil, err
+	}
+	dkLen := intParam(params, "dklen")
+
+	switch kf.Crypto.KDF {
+	case "scrypt":
+		return scrypt.Key([]byte(passphrase), salt, intParam(params, "n"), intParam(params, "r"), intParam(params, "p"), dkLen)
+	case "pbkdf2":
+		if prf := stringParam(params, "prf"); prf != "hmac-sha256" {
+			return nil, fmt.Errorf("unsupported PBKDF2 PRF: %s", prf)
+		}
+		return pbkdf2.Key([]byte(passphrase), salt, intParam(params, "c"), dkLen, sha256.New), nil
+	default:
+		return nil, fmt.Errorf("unsupported KDF: %s", kf.Crypto.KDF)
+	}
+}
+
+// stringParam returns a string KDF parameter
+func stringParam(params map[string]interface{}, name string) string {
+	s, _ := params[name].(string)
+	return s
+}
+
+// intParam returns a numeric KDF parameter, which JSON decodes as float64
+func intParam(params map[string]interface{}, name string) int {
+	f, _ := params[name].(float64)
+	return int(f)
+}
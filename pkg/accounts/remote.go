@@ -0,0 +1,151 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// defaultRemoteTimeout bounds a request to the remote signer
+const defaultRemoteTimeout = 10 * time.Second
+
+// RemoteSigner signs through an external signer speaking the eth_accounts,
+// eth_sign, eth_signTransaction and eth_signTypedData JSON-RPC methods, such
+// as web3signer or clef. Keys never leave the signer, which may keep them in
+// a KMS or HSM.
+type RemoteSigner struct {
+	client  *rpc.Client
+	timeout time.Duration
+}
+
+// NewRemoteSigner connects to a remote signer
+func NewRemoteSigner(url string, timeout time.Duration) (*RemoteSigner, error) {
+	if url == "" {
+		return nil, errors.New("accounts remote_url is not set")
+	}
+	if timeout <= 0 {
+		timeout = defaultRemoteTimeout
+	}
+	client, err := rpc.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to remote signer: %w", err)
+	}
+	return &RemoteSigner{client: client, timeout: timeout}, nil
+}
+
+// Accounts lists the addresses the remote signer holds keys for
+func (s *RemoteSigner) Accounts(ctx context.Context) ([]common.Address, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var addresses []common.Address
+	if err := s.client.CallContext(ctx, &addresses, "eth_accounts"); err != nil {
+		return nil, fmt.Errorf("remote signer: %w", err)
+	}
+	sortAddresses(addresses)
+	return addresses, nil
+}
+
+// SignTx has the remote signer sign a transaction and checks that it signed
+// the transaction asked for, from the expected account
+func (s *RemoteSigner) SignTx(ctx context.Context, from common.Address, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var result json.RawMessage
+	if err := s.client.CallContext(ctx, &result, "eth_signTransaction", remoteTxArgs(from, tx, chainID)); err != nil {
+		return nil, fmt.Errorf("remote signer: %w", err)
+	}
+
+	// web3signer returns the raw transaction, clef an object holding it
+	var raw hexutil.Bytes
+	if err := json.Unmarshal(result, &raw); err != nil {
+		var signed struct {
+			Raw hexutil.Bytes `json:"raw"`
+		}
+		if err := json.Unmarshal(result, &signed); err != nil {
+			return nil, fmt.Errorf("remote signer returned unexpected result: %s", result)
+		}
+		raw = signed.Raw
+	}
+
+	signedTx := new(types.Transaction)
+	if err := signedTx.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("remote signer returned invalid transaction: %w", err)
+	}
+	signer := types.LatestSignerForChainID(chainID)
+	if signer.Hash(signedTx) != signer.Hash(tx) {
+		return nil, errors.New("remote signer signed a different transaction")
+	}
+	if sender, err := types.Sender(signer, signedTx); err != nil || sender != from {
+		return nil, errors.New("remote signer signed with a different account")
+	}
+	return signedTx, nil
+}
+
+// SignText has the remote signer sign a personal message
+func (s *RemoteSigner) SignText(ctx context.Context, from common.Address, data []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var sig hexutil.Bytes
+	if err := s.client.CallContext(ctx, &sig, "eth_sign", from, hexutil.Bytes(data)); err != nil {
+		return nil, fmt.Errorf("remote signer: %w", err)
+	}
+	return sig, nil
+}
+
+// SignTypedData has the remote signer sign EIP-712 typed data and checks
+// that it signed with the expected account
+func (s *RemoteSigner) SignTypedData(ctx context.Context, from common.Address, typedData apitypes.TypedData) ([]byte, error) {
+	hash, err := TypedDataHash(typedData)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var sig hexutil.Bytes
+	if err := s.client.CallContext(ctx, &sig, "eth_signTypedData", from, typedData); err != nil {
+		return nil, fmt.Errorf("remote signer: %w", err)
+	}
+	if signer, err := RecoverSigner(hash, sig); err != nil || signer != from {
+		return nil, errors.New("remote signer signed with a different account")
+	}
+	return sig, nil
+}
+
+// remoteTxArgs renders a transaction as eth_signTransaction arguments
+func remoteTxArgs(from common.Address, tx *types.Transaction, chainID *big.Int) map[string]interface{} {
+	args := map[string]interface{}{
+		"from":    from,
+		"gas":     hexutil.Uint64(tx.Gas()),
+		"value":   (*hexutil.Big)(tx.Value()),
+		"nonce":   hexutil.Uint64(tx.Nonce()),
+		"data":    hexutil.Bytes(tx.Data()),
+		"chainId": (*hexutil.Big)(chainID),
+	}
+	if tx.To() != nil {
+		args["to"] = tx.To()
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		args["maxFeePerGas"] = (*hexutil.Big)(tx.GasFeeCap())
+		args["maxPriorityFeePerGas"] = (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		args["gasPrice"] = (*hexutil.Big)(tx.GasPrice())
+	}
+	if tx.Type() != types.LegacyTxType {
+		args["accessList"] = tx.AccessList()
+	}
+	return args
+}
@@ -0,0 +1,84 @@
+package accounts
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// StaticKeys signs with plaintext keys held in memory, such as the well
+// known keys of a dev chain. It must never hold keys of real funds.
+type StaticKeys struct {
+	keys      map[common.Address]*ecdsa.PrivateKey
+	addresses []common.Address // in the order the keys were given
+}
+
+// NewStaticKeys creates a backend signing with keys
+func NewStaticKeys(keys []*ecdsa.PrivateKey) *StaticKeys {
+	s := &StaticKeys{keys: make(map[common.Address]*ecdsa.PrivateKey, len(keys))}
+	for _, key := range keys {
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		if _, ok := s.keys[address]; !ok {
+			s.addresses = append(s.addresses, address)
+		}
+		s.keys[address] = key
+	}
+	return s
+}
+
+// DeriveKeys derives n keys from a seed, the i-th being the keccak256 hash
+// of "{seed}/{i}". Anyone knowing the seed knows the keys.
+func DeriveKeys(seed string, n int) ([]*ecdsa.PrivateKey, error) {
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := range keys {
+		key, err := crypto.ToECDSA(crypto.Keccak256([]byte(fmt.Sprintf("%s/%d", seed, i))))
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive key %d: %w", i, err)
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// Accounts lists the addresses of the keys in the order they were given,
+// so that the first one is the default sender of tools
+func (s *StaticKeys) Accounts(ctx context.Context) ([]common.Address, error) {
+	return append([]common.Address(nil), s.addresses...), nil
+}
+
+// SignTx signs a transaction
+func (s *StaticKeys) SignTx(ctx context.Context, from common.Address, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	key, ok := s.keys[from]
+	if !ok {
+		return nil, ErrUnknownAccount
+	}
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+}
+
+// SignText signs a personal message
+func (s *StaticKeys) SignText(ctx context.Context, from common.Address, data []byte) ([]byte, error) {
+	key, ok := s.keys[from]
+	if !ok {
+		return nil, ErrUnknownAccount
+	}
+	return signText(key, data)
+}
+
+// SignTypedData signs EIP-712 typed data
+func (s *StaticKeys) SignTypedData(ctx context.Context, from common.Address, typedData apitypes.TypedData) ([]byte, error) {
+	key, ok := s.keys[from]
+	if !ok {
+		return nil, ErrUnknownAccount
+	}
+	hash, err := TypedDataHash(typedData)
+	if err != nil {
+		return nil, err
+	}
+	return signHash(key, hash)
+}
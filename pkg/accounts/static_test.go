@@ -0,0 +1,67 @@
+package accounts
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestDeriveKeys(t *testing.T) {
+	keys, err := DeriveKeys("test seed", 5)
+	if err != nil {
+		t.Fatalf("DeriveKeys: %v", err)
+	}
+	if len(keys) != 5 {
+		t.Fatalf("got %d keys, want 5", len(keys))
+	}
+
+	// The i-th key is keccak256("{seed}/{i}")
+	if got, want := crypto.FromECDSA(keys[0]), crypto.Keccak256([]byte("test seed/0")); string(got) != string(want) {
+		t.Fatalf("key 0 = %x, want %x", got, want)
+	}
+
+	again, err := DeriveKeys("test seed", 5)
+	if err != nil {
+		t.Fatalf("DeriveKeys: %v", err)
+	}
+	other, err := DeriveKeys("other seed", 5)
+	if err != nil {
+		t.Fatalf("DeriveKeys: %v", err)
+	}
+	seen := make(map[string]bool)
+	for i, key := range keys {
+		if !key.Equal(again[i]) {
+			t.Fatalf("key %d differs between derivations of the same seed", i)
+		}
+		if key.Equal(other[i]) {
+			t.Fatalf("key %d is the same for different seeds", i)
+		}
+		address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+		if seen[address] {
+			t.Fatalf("key %d repeats address %s", i, address)
+		}
+		seen[address] = true
+	}
+}
+
+func TestStaticKeysAccounts(t *testing.T) {
+	keys, err := DeriveKeys("test seed", 3)
+	if err != nil {
+		t.Fatalf("DeriveKeys: %v", err)
+	}
+	// A repeated key is listed once, in its first position
+	backend := NewStaticKeys(append(keys, keys[0]))
+	accounts, err := backend.Accounts(context.Background())
+	if err != nil {
+		t.Fatalf("Accounts: %v", err)
+	}
+	if len(accounts) != len(keys) {
+		t.Fatalf("got %d accounts, want %d", len(accounts), len(keys))
+	}
+	for i, key := range keys {
+		if want := crypto.PubkeyToAddress(key.PublicKey); accounts[i] != want {
+			t.Fatalf("account %d = %s, want %s", i, accounts[i], want)
+		}
+	}
+}
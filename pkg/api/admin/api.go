@@ -0,0 +1,357 @@
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/cache"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/middleware"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// AdminAPI provides operator methods for inspecting the service
+type AdminAPI struct {
+	cacheManager *cache.Manager
+	connections  ConnectionSource
+	denylist     *middleware.Denylist
+	webhooks     *storage.WebhookStore
+}
+
+// ConnectionSource reports the connections of the RPC listeners and the
+// subscriptions that outlived theirs
+type ConnectionSource interface {
+	Connections() *Connections
+	OrphanedSubscriptions() *OrphanedSubscriptions
+}
+
+// NewAdminAPI creates a new AdminAPI. cacheManager may be nil when caching
+// is disabled.
+func NewAdminAPI(cacheManager *cache.Manager) *AdminAPI {
+	return &AdminAPI{
+		cacheManager: cacheManager,
+	}
+}
+
+// SetConnections makes admin_connections and admin_orphanedSubscriptions
+// report on source. It must be called before serving.
+func (a *AdminAPI) SetConnections(source ConnectionSource) {
+	a.connections = source
+}
+
+// SetDenylist makes admin_ban, admin_unban and admin_bans manage denylist.
+// It must be called before serving.
+func (a *AdminAPI) SetDenylist(denylist *middleware.Denylist) {
+	a.denylist = denylist
+}
+
+// SetWebhooks makes admin_addWebhook, admin_removeWebhook and
+// admin_webhooks manage the webhooks of store. It must be called before
+// serving.
+func (a *AdminAPI) SetWebhooks(store *storage.WebhookStore) {
+	a.webhooks = store
+}
+
+// Connections describes the open connections of the RPC listeners
+type Connections struct {
+	HTTP      []HTTPConnections     `json:"http"`
+	WebSocket []WebSocketConnection `json:"webSocket"`
+}
+
+// HTTPConnections counts the connections of an HTTP listener. Idle ones
+// are kept alive between requests.
+type HTTPConnections struct {
+	Listener string         `json:"listener"`
+	Addr     string         `json:"addr"`
+	Open     int            `json:"open"`
+	Active   int            `json:"active"`
+	Idle     int            `json:"idle"`
+	Clients  map[string]int `json:"clients"` // open connections per client IP
+}
+
+// WebSocketConnection describes a WebSocket connection
+type WebSocketConnection struct {
+	ClientIP      string         `json:"clientIp"`
+	RequestID     string         `json:"requestId"`
+	Chain         string         `json:"chain,omitempty"` // empty for the default chain
+	Subscriptions map[string]int `json:"subscriptions"`   // by type
+	Queued        int            `json:"queued"`          // messages waiting to be written
+	Pending       int            `json:"pending"`         // calls read but not yet served
+	ConnectedAt   time.Time      `json:"connectedAt"`
+	Uptime        string         `json:"uptime"`
+}
+
+// Connections returns the open HTTP and WebSocket connections, so that
+// clients holding many connections, subscriptions or unread messages can be
+// told apart
+func (a *AdminAPI) Connections(ctx context.Context) (*Connections, error) {
+	if a.connections == nil {
+		return nil, api.NewRPCError(api.ErrCodeResourceUnavail, "connection statistics are unavailable")
+	}
+	return a.connections.Connections(), nil
+}
+
+// OrphanedSubscriptions describes the subscriptions whose WebSocket
+// connection is closed. They are removed by the sweep following the one
+// that marked them orphaned.
+type OrphanedSubscriptions struct {
+	Subscriptions []OrphanedSubscription `json:"subscriptions"`
+	Removed       uint64                 `json:"removed"` // by sweeps since start
+}
+
+// OrphanedSubscription describes a subscription whose connection is closed
+type OrphanedSubscription struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`
+	Chain      string     `json:"chain,omitempty"` // empty for the default chain
+	ClientIP   string     `json:"clientIp"`
+	RequestID  string     `json:"requestId"`
+	OrphanedAt *time.Time `json:"orphanedAt,omitempty"` // unset until a sweep marks it
+}
+
+// OrphanedSubscriptions returns the subscriptions that outlived their
+// connection, which should be empty unless connection teardown is broken
+func (a *AdminAPI) OrphanedSubscriptions(ctx context.Context) (*OrphanedSubscriptions, error) {
+	if a.connections == nil {
+		return nil, api.NewRPCError(api.ErrCodeResourceUnavail, "connection statistics are unavailable")
+	}
+	return a.connections.OrphanedSubscriptions(), nil
+}
+
+// BanArgs selects a client by IP address or CIDR range, or by API key
+type BanArgs struct {
+	IP       string `json:"ip,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Duration string `json:"duration,omitempty"` // e.g. "30m"; bans without one are permanent
+	Reason   string `json:"reason,omitempty"`
+}
+
+// client returns the ban kind and value of the selected client
+func (args *BanArgs) client() (string, string, error) {
+	switch {
+	case args.IP != "" && args.Key != "":
+		return "", "", api.NewRPCError(api.ErrCodeInvalidParams, "only one of ip and key may be given")
+	case args.IP != "":
+		return storage.BanKindIP, args.IP, nil
+	case args.Key != "":
+		return storage.BanKindKey, args.Key, nil
+	default:
+		return "", "", api.NewRPCError(api.ErrCodeInvalidParams, "ip or key is required")
+	}
+}
+
+// Ban refuses the requests of a client on every replica, for the given
+// duration or until it is unbanned
+func (a *AdminAPI) Ban(ctx context.Context, args BanArgs) (*storage.Ban, error) {
+	if a.denylist == nil {
+		return nil, api.NewRPCError(api.ErrCodeResourceUnavail, "denylist is disabled")
+	}
+	kind, value, err := args.client()
+	if err != nil {
+		return nil, err
+	}
+
+	var duration time.Duration
+	if args.Duration != "" {
+		duration, err = time.ParseDuration(args.Duration)
+		if err != nil || duration <= 0 {
+			return nil, api.NewRPCError(api.ErrCodeInvalidParams, fmt.Sprintf("invalid duration: %q", args.Duration))
+		}
+	}
+
+	ban, err := a.denylist.Ban(ctx, kind, value, args.Reason, duration)
+	if err != nil {
+		return nil, banError(err)
+	}
+	logger.Infof("Banned %s %s: duration=%v, reason=%q", kind, ban.Value, duration, args.Reason)
+	return ban, nil
+}
+
+// Unban lifts the ban of a client and reports whether it was banned
+func (a *AdminAPI) Unban(ctx context.Context, args BanArgs) (bool, error) {
+	if a.denylist == nil {
+		return false, api.NewRPCError(api.ErrCodeResourceUnavail, "denylist is disabled")
+	}
+	kind, value, err := args.client()
+	if err != nil {
+		return false, err
+	}
+
+	removed, err := a.denylist.Unban(ctx, kind, value)
+	if err != nil {
+		return false, banError(err)
+	}
+	if removed {
+		logger.Infof("Unbanned %s %s", kind, value)
+	}
+	return removed, nil
+}
+
+// Bans returns the bans in force, including automatic ones
+func (a *AdminAPI) Bans(ctx context.Context) ([]*storage.Ban, error) {
+	if a.denylist == nil {
+		return nil, api.NewRPCError(api.ErrCodeResourceUnavail, "denylist is disabled")
+	}
+	bans, err := a.denylist.Bans(ctx)
+	if err != nil {
+		return nil, api.NewRPCError(api.ErrCodeInternal, err.Error())
+	}
+	return bans, nil
+}
+
+// banError maps a denylist error to an RPC error: invalid clients are the
+// caller's fault, anything else is a storage failure
+func banError(err error) error {
+	if errors.Is(err, middleware.ErrInvalidBan) {
+		return api.NewRPCError(api.ErrCodeInvalidParams, err.Error())
+	}
+	return api.NewRPCError(api.ErrCodeInternal, err.Error())
+}
+
+// WebhookArgs registers a webhook. Logs match the address and topics as in
+// eth_getLogs, transactions match the recipients in to.
+type WebhookArgs struct {
+	URL     string           `json:"url"`
+	Secret  string           `json:"secret,omitempty"` // generated if empty
+	Address []common.Address `json:"address,omitempty"`
+	Topics  [][]common.Hash  `json:"topics,omitempty"`
+	To      []common.Address `json:"to,omitempty"`
+}
+
+// AddWebhook registers a webhook notified of the matching logs and
+// transactions of new blocks. The result carries the secret signing its
+// deliveries, which is not shown again.
+func (a *AdminAPI) AddWebhook(ctx context.Context, args WebhookArgs) (*storage.Webhook, error) {
+	if a.webhooks == nil {
+		return nil, api.NewRPCError(api.ErrCodeResourceUnavail, "webhooks are disabled")
+	}
+	u, err := url.Parse(args.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, api.NewRPCError(api.ErrCodeInvalidParams, fmt.Sprintf("invalid webhook url: %q", args.URL))
+	}
+	if len(args.Address) == 0 && len(args.Topics) == 0 && len(args.To) == 0 {
+		return nil, api.NewRPCError(api.ErrCodeInvalidParams, "address, topics or to is required")
+	}
+
+	secret := args.Secret
+	if secret == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, api.NewRPCError(api.ErrCodeInternal, err.Error())
+		}
+		secret = hex.EncodeToString(key)
+	}
+	hook := &storage.Webhook{
+		ID:        uuid.NewString(),
+		URL:       args.URL,
+		Secret:    secret,
+		Addresses: args.Address,
+		Topics:    args.Topics,
+		To:        args.To,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := a.webhooks.Add(ctx, hook); err != nil {
+		return nil, api.NewRPCError(api.ErrCodeInternal, err.Error())
+	}
+	logger.Infof("Added webhook %s: url=%s", hook.ID, config.RedactURL(hook.URL))
+	return hook, nil
+}
+
+// RemoveWebhook unregisters a webhook and reports whether it existed
+func (a *AdminAPI) RemoveWebhook(ctx context.Context, id string) (bool, error) {
+	if a.webhooks == nil {
+		return false, api.NewRPCError(api.ErrCodeResourceUnavail, "webhooks are disabled")
+	}
+	removed, err := a.webhooks.Remove(ctx, id)
+	if err != nil {
+		return false, api.NewRPCError(api.ErrCodeInternal, err.Error())
+	}
+	if removed {
+		logger.Infof("Removed webhook %s", id)
+	}
+	return removed, nil
+}
+
+// Webhooks returns the registered webhooks without their secrets
+func (a *AdminAPI) Webhooks(ctx context.Context) ([]*storage.Webhook, error) {
+	if a.webhooks == nil {
+		return nil, api.NewRPCError(api.ErrCodeResourceUnavail, "webhooks are disabled")
+	}
+	hooks, err := a.webhooks.List(ctx)
+	if err != nil {
+		return nil, api.NewRPCError(api.ErrCodeInternal, err.Error())
+	}
+	for _, hook := range hooks {
+		hook.Secret = ""
+	}
+	return hooks, nil
+}
+
+// CacheStats describes a single cache
+type CacheStats struct {
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	Size    int     `json:"size"`
+	HitRate float64 `json:"hitRate"`
+}
+
+// CacheStats returns hit, miss, size and hit rate statistics per cache
+func (a *AdminAPI) CacheStats(ctx context.Context) (map[string]CacheStats, error) {
+	if a.cacheManager == nil {
+		return nil, api.NewRPCError(api.ErrCodeResourceUnavail, "cache is disabled")
+	}
+
+	result := make(map[string]CacheStats)
+	for name, stat := range a.cacheManager.Stats() {
+		result[name] = CacheStats{
+			Hits:    stat.Hits,
+			Misses:  stat.Misses,
+			Size:    stat.Size,
+			HitRate: stat.HitRate,
+		}
+	}
+	return result, nil
+}
+
+// ClearCache clears the named cache, or all caches when no name is given,
+// and resets their statistics
+func (a *AdminAPI) ClearCache(ctx context.Context, name *string) (bool, error) {
+	if a.cacheManager == nil {
+		return false, api.NewRPCError(api.ErrCodeResourceUnavail, "cache is disabled")
+	}
+
+	if name == nil || *name == "" {
+		a.cacheManager.Clear()
+		return true, nil
+	}
+
+	if !a.cacheManager.ClearCache(*name) {
+		return false, api.NewRPCError(api.ErrCodeInvalidParams, fmt.Sprintf("unknown cache: %s", *name))
+	}
+	return true, nil
+}
+
+// LogLevel returns the current log level
+func (a *AdminAPI) LogLevel(ctx context.Context) (string, error) {
+	return logger.Level(), nil
+}
+
+// SetLogLevel changes the log level (debug, info, warn or error) until the
+// next change or config reload
+func (a *AdminAPI) SetLogLevel(ctx context.Context, level string) (bool, error) {
+	previous := logger.Level()
+	if err := logger.SetLevel(level); err != nil {
+		return false, api.NewRPCError(api.ErrCodeInvalidParams, err.Error())
+	}
+	logger.Infof("Log level changed from %s to %s", previous, level)
+	return true, nil
+}
@@ -0,0 +1,176 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/accounts"
+	"github.com/sunvim/evm_rpc/pkg/api"
+)
+
+// AccountAPI provides server-side signing in the eth namespace. It is only
+// registered when an accounts backend is configured.
+type AccountAPI struct {
+	backend accounts.Backend
+	txPool  *TxPoolAPI
+	chainID *big.Int
+}
+
+// NewAccountAPI creates a new AccountAPI that submits through txPool
+func NewAccountAPI(backend accounts.Backend, txPool *TxPoolAPI) *AccountAPI {
+	return &AccountAPI{
+		backend: backend,
+		txPool:  txPool,
+		chainID: new(big.Int).SetUint64(txPool.chainID),
+	}
+}
+
+// Accounts returns the addresses the node can sign for
+func (a *AccountAPI) Accounts(ctx context.Context) ([]common.Address, error) {
+	addresses, err := a.backend.Accounts(ctx)
+	if err != nil {
+		return nil, signerError(err)
+	}
+	return addresses, nil
+}
+
+// SendTransaction fills in, signs and submits a transaction
+func (a *AccountAPI) SendTransaction(ctx context.Context, args api.TransactionArgs) (common.Hash, error) {
+	tx, err := a.txPool.filler.fill(ctx, &args)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	signed, err := a.backend.SignTx(ctx, *args.From, tx, a.chainID)
+	if err != nil {
+		return common.Hash{}, signerError(err)
+	}
+	return a.txPool.submit(ctx, signed)
+}
+
+// SignTransaction fills in and signs a transaction without submitting it
+func (a *AccountAPI) SignTransaction(ctx context.Context, args api.TransactionArgs) (*api.SignTransactionResult, error) {
+	tx, err := a.txPool.filler.fill(ctx, &args)
+	if err != nil {
+		return nil, err
+	}
+	signed, err := a.backend.SignTx(ctx, *args.From, tx, a.chainID)
+	if err != nil {
+		return nil, signerError(err)
+	}
+	return signResult(signed)
+}
+
+// Sign signs data as an EIP-191 personal message
+func (a *AccountAPI) Sign(ctx context.Context, address common.Address, data hexutil.Bytes) (hexutil.Bytes, error) {
+	sig, err := a.backend.SignText(ctx, address, data)
+	if err != nil {
+		return nil, signerError(err)
+	}
+	return sig, nil
+}
+
+// SignTypedDataV4 signs EIP-712 typed data, served as eth_signTypedData_v4
+func (a *AccountAPI) SignTypedDataV4(ctx context.Context, address common.Address, typedData api.TypedData) (hexutil.Bytes, error) {
+	sig, err := a.backend.SignTypedData(ctx, address, typedData.TypedData)
+	if err != nil {
+		return nil, signerError(err)
+	}
+	return sig, nil
+}
+
+// PersonalAPI provides the personal namespace, signing with a passphrase
+// given per request instead of keys unlocked at startup
+type PersonalAPI struct {
+	accounts *AccountAPI
+}
+
+// NewPersonalAPI creates a new PersonalAPI
+func NewPersonalAPI(accounts *AccountAPI) *PersonalAPI {
+	return &PersonalAPI{accounts: accounts}
+}
+
+// ListAccounts returns the addresses the node can sign for
+func (p *PersonalAPI) ListAccounts(ctx context.Context) ([]common.Address, error) {
+	return p.accounts.Accounts(ctx)
+}
+
+// SendTransaction fills in, signs and submits a transaction, unlocking the
+// sender's key with the passphrase
+func (p *PersonalAPI) SendTransaction(ctx context.Context, args api.TransactionArgs, passphrase string) (common.Hash, error) {
+	backend, err := p.passphraseBackend()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	tx, err := p.accounts.txPool.filler.fill(ctx, &args)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	signed, err := backend.SignTxWithPassphrase(ctx, *args.From, passphrase, tx, p.accounts.chainID)
+	if err != nil {
+		return common.Hash{}, signerError(err)
+	}
+	return p.accounts.txPool.submit(ctx, signed)
+}
+
+// Sign signs data as an EIP-191 personal message, unlocking the key with
+// the passphrase. Without one, as tooling like hardhat calls it, the key
+// must have been unlocked at startup.
+func (p *PersonalAPI) Sign(ctx context.Context, data hexutil.Bytes, address common.Address, passphrase *string) (hexutil.Bytes, error) {
+	if passphrase == nil {
+		return p.accounts.Sign(ctx, address, data)
+	}
+	backend, err := p.passphraseBackend()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := backend.SignTextWithPassphrase(ctx, address, *passphrase, data)
+	if err != nil {
+		return nil, signerError(err)
+	}
+	return sig, nil
+}
+
+// EcRecover returns the address that signed data as an EIP-191 personal
+// message, the inverse of personal_sign
+func (p *PersonalAPI) EcRecover(ctx context.Context, data, sig hexutil.Bytes) (common.Address, error) {
+	address, err := accounts.RecoverText(data, sig)
+	if err != nil {
+		return common.Address{}, api.NewRPCError(api.ErrCodeInvalidParams, err.Error())
+	}
+	return address, nil
+}
+
+// passphraseBackend returns the backend if it can sign with a passphrase
+func (p *PersonalAPI) passphraseBackend() (accounts.PassphraseBackend, error) {
+	backend, ok := p.accounts.backend.(accounts.PassphraseBackend)
+	if !ok {
+		return nil, signerError(accounts.ErrPassphraseUnsupported)
+	}
+	return backend, nil
+}
+
+// signResult encodes a transaction for eth_signTransaction and
+// eth_fillTransaction
+func signResult(tx *types.Transaction) (*api.SignTransactionResult, error) {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to encode transaction: %v", err)}
+	}
+	return &api.SignTransactionResult{Raw: raw, Tx: tx}, nil
+}
+
+// signerError maps a signing backend error to an RPC error
+func signerError(err error) *api.RPCError {
+	switch {
+	case errors.Is(err, accounts.ErrUnknownAccount), errors.Is(err, accounts.ErrLocked),
+		errors.Is(err, accounts.ErrDecrypt), errors.Is(err, accounts.ErrPassphraseUnsupported),
+		errors.Is(err, accounts.ErrInvalidTypedData):
+		return &api.RPCError{Code: api.ErrCodeInvalidInput, Message: err.Error()}
+	}
+	return &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to sign: %v", err)}
+}
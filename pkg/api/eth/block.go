@@ -3,9 +3,12 @@ package eth
 import (
 	"context"
 	"fmt"
+	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/sunvim/evm_rpc/pkg/api"
 	"github.com/sunvim/evm_rpc/pkg/storage"
 )
@@ -13,14 +16,19 @@ import (
 // BlockAPI provides block-related RPC methods
 type BlockAPI struct {
 	blockReader *storage.BlockReader
-	chainID     uint64
+	chainConfig *params.ChainConfig
+
+	// The pool the pending block is assembled from; nil resolves it to
+	// the latest block
+	txPool      *storage.TxPoolStorage
+	stateReader *storage.StateReader
 }
 
-// NewBlockAPI creates a new BlockAPI
-func NewBlockAPI(blockReader *storage.BlockReader, chainID uint64) *BlockAPI {
+// NewBlockAPI creates a new BlockAPI rendering blocks by the chain's forks
+func NewBlockAPI(blockReader *storage.BlockReader, chainConfig *params.ChainConfig) *BlockAPI {
 	return &BlockAPI{
 		blockReader: blockReader,
-		chainID:     chainID,
+		chainConfig: chainConfig,
 	}
 }
 
@@ -35,6 +43,16 @@ func (a *BlockAPI) resolveBlockNumber(ctx context.Context, blockNr api.BlockNumb
 	return blockNr.ToUint64()
 }
 
+// totalDifficulty returns the total difficulty of a canonical block, or nil
+// if it is unknown
+func (a *BlockAPI) totalDifficulty(ctx context.Context, block *types.Block) *big.Int {
+	td, err := a.blockReader.GetTotalDifficulty(ctx, block.NumberU64(), block.Hash())
+	if err != nil {
+		return nil
+	}
+	return td
+}
+
 // BlockNumber returns the current block number
 func (a *BlockAPI) BlockNumber(ctx context.Context) (hexutil.Uint64, error) {
 	number, err := a.blockReader.GetLatestBlockNumber(ctx)
@@ -50,6 +68,9 @@ func (a *BlockAPI) GetBlockByNumber(ctx context.Context, blockNr string, fullTx
 	if err != nil {
 		return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: fmt.Sprintf("invalid block number: %v", err)}
 	}
+	if bn == api.PendingBlockNumber && a.txPool != nil {
+		return a.pendingBlock(ctx, fullTx)
+	}
 
 	number, err := a.resolveBlockNumber(ctx, bn)
 	if err != nil {
@@ -64,9 +85,7 @@ func (a *BlockAPI) GetBlockByNumber(ctx context.Context, blockNr string, fullTx
 		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get block: %v", err)}
 	}
 
-	// For simplicity, using nil for total difficulty
-	// In production, you'd calculate or store this
-	return api.NewRPCBlock(block, fullTx, nil), nil
+	return api.NewRPCBlock(block, fullTx, a.totalDifficulty(ctx, block), a.chainConfig), nil
 }
 
 // GetBlockByHash returns a block by hash
@@ -79,7 +98,7 @@ func (a *BlockAPI) GetBlockByHash(ctx context.Context, blockHash common.Hash, fu
 		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get block: %v", err)}
 	}
 
-	return api.NewRPCBlock(block, fullTx, nil), nil
+	return api.NewRPCBlock(block, fullTx, a.totalDifficulty(ctx, block), a.chainConfig), nil
 }
 
 // GetBlockTransactionCountByNumber returns the number of transactions in a block by number
@@ -0,0 +1,358 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/evm"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// defaultMaxBundleCalls bounds the calls of eth_callMany until
+// SetMaxBundleCalls is called
+const defaultMaxBundleCalls = 100
+
+// CallAPI provides the methods that execute calls on stored state
+type CallAPI struct {
+	blockReader    *storage.BlockReader
+	state          *StateAPI
+	executor       *evm.Executor
+	maxBundleCalls int
+}
+
+// NewCallAPI creates a new CallAPI
+func NewCallAPI(blockReader *storage.BlockReader, stateReader *storage.StateReader, executor *evm.Executor, chainID uint64) *CallAPI {
+	return &CallAPI{
+		blockReader:    blockReader,
+		state:          NewStateAPI(blockReader, stateReader, chainID),
+		executor:       executor,
+		maxBundleCalls: defaultMaxBundleCalls,
+	}
+}
+
+// SetMaxBundleCalls limits the calls across the bundles of eth_callMany;
+// 0 is unlimited. It must be called before serving.
+func (a *CallAPI) SetMaxBundleCalls(max int) {
+	a.maxBundleCalls = max
+}
+
+// Bundle is a list of calls executed in order on shared state
+type Bundle struct {
+	Transactions  []api.CallArgs  `json:"transactions"`
+	BlockOverride *BlockOverrides `json:"blockOverride"`
+}
+
+// BlockOverrides replace fields of the block a bundle runs in
+type BlockOverrides struct {
+	Number     *hexutil.Big    `json:"blockNumber"`
+	Difficulty *hexutil.Big    `json:"difficulty"`
+	Time       *hexutil.Uint64 `json:"blockTimestamp"`
+	GasLimit   *hexutil.Uint64 `json:"gasLimit"`
+	Coinbase   *common.Address `json:"coinbase"`
+	BaseFee    *hexutil.Big    `json:"baseFee"`
+}
+
+// SimulationContext is the state bundles start from: the state at a block,
+// or with a transaction index, the state before that transaction of the
+// block. Without one bundles run on the latest state.
+type SimulationContext struct {
+	BlockNumber      api.BlockNumberOrHash `json:"blockNumber"`
+	TransactionIndex *int                  `json:"transactionIndex"`
+}
+
+// BundleCallResult is the outcome of a call of a bundle: its return value
+// or its error
+type BundleCallResult struct {
+	Value   *hexutil.Bytes `json:"value,omitempty"`
+	Error   string         `json:"error,omitempty"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+}
+
+// CallMany executes bundles of calls one after another, each call seeing
+// the state changes of the calls before it, and returns the outcome of
+// every call. A call that fails reports its error and leaves the state as
+// it was; the remaining calls still run.
+func (a *CallAPI) CallMany(ctx context.Context, bundles []Bundle, simulation *SimulationContext) ([][]*BundleCallResult, error) {
+	calls := 0
+	for _, bundle := range bundles {
+		calls += len(bundle.Transactions)
+	}
+	if max := a.maxBundleCalls; max > 0 && calls > max {
+		return nil, limitError("max_bundle_calls", max, calls, "too many calls: %d, max %d", calls, max)
+	}
+
+	ctx, cancel := a.executor.WithTimeout(ctx)
+	defer cancel()
+
+	if simulation == nil {
+		simulation = &SimulationContext{}
+	}
+	header, state, err := a.simulationState(ctx, simulation)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]*BundleCallResult, len(bundles))
+	for i, bundle := range bundles {
+		blockCtx := a.executor.BlockContext(ctx, header)
+		if o := bundle.BlockOverride; o != nil {
+			if o.Number != nil {
+				blockCtx.BlockNumber = o.Number.ToInt()
+			}
+			if o.Difficulty != nil {
+				blockCtx.Difficulty = o.Difficulty.ToInt()
+			}
+			if o.Time != nil {
+				blockCtx.Time = uint64(*o.Time)
+			}
+			if o.GasLimit != nil {
+				blockCtx.GasLimit = uint64(*o.GasLimit)
+			}
+			if o.Coinbase != nil {
+				blockCtx.Coinbase = *o.Coinbase
+			}
+			if o.BaseFee != nil {
+				blockCtx.BaseFee = o.BaseFee.ToInt()
+			}
+		}
+
+		results[i] = make([]*BundleCallResult, len(bundle.Transactions))
+		for j, args := range bundle.Transactions {
+			msg, err := evm.CallMessage(args, blockCtx.BaseFee, a.executor.GasCap())
+			if err != nil {
+				return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: fmt.Sprintf("bundle %d transaction %d: %v", i, j, err)}
+			}
+			gasPool := uint64(math.MaxUint64)
+			result, err := a.executor.Apply(ctx, blockCtx, state, msg, &gasPool)
+			if err != nil && (ctx.Err() != nil || state.Error() != nil) {
+				return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: err.Error()}
+			}
+			switch {
+			case err != nil:
+				results[i][j] = &BundleCallResult{Error: err.Error()}
+			case result.Failed():
+				results[i][j] = &BundleCallResult{Error: callError(result).Message, GasUsed: hexutil.Uint64(result.UsedGas)}
+			default:
+				value := hexutil.Bytes(result.Return())
+				results[i][j] = &BundleCallResult{Value: &value, GasUsed: hexutil.Uint64(result.UsedGas)}
+			}
+		}
+	}
+	return results, nil
+}
+
+// Call executes a call on the state at a block, latest by default, and
+// returns its return data. A call that reverts with data fails with code 3,
+// the revert data and its decoded reason, as in geth.
+func (a *CallAPI) Call(ctx context.Context, args api.CallArgs, blockNrOrHash *api.BlockNumberOrHash) (hexutil.Bytes, error) {
+	ctx, cancel := a.executor.WithTimeout(ctx)
+	defer cancel()
+
+	header, state, err := a.callState(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	result, err := a.execute(ctx, a.executor.BlockContext(ctx, header), state, args)
+	if err != nil {
+		return nil, executionError(ctx, state, err)
+	}
+	if result.Failed() {
+		return nil, callError(result)
+	}
+	return result.Return(), nil
+}
+
+// estimateGas finds the lowest gas limit a call succeeds with by binary
+// search, as geth's eth_estimateGas does. The search is bounded by the
+// given gas, the block gas limit, the gas cap and the gas the sender can
+// pay for.
+func (a *CallAPI) estimateGas(ctx context.Context, args api.CallArgs, blockNrOrHash *api.BlockNumberOrHash) (hexutil.Uint64, error) {
+	ctx, cancel := a.executor.WithTimeout(ctx)
+	defer cancel()
+
+	header, state, err := a.callState(ctx, blockNrOrHash)
+	if err != nil {
+		return 0, err
+	}
+	blockCtx := a.executor.BlockContext(ctx, header)
+
+	hi := header.GasLimit
+	if args.Gas != nil && uint64(*args.Gas) >= params.TxGas {
+		hi = uint64(*args.Gas)
+	}
+	var feeCap *big.Int
+	switch {
+	case args.GasPrice != nil:
+		feeCap = args.GasPrice.ToInt()
+	case args.MaxFeePerGas != nil:
+		feeCap = args.MaxFeePerGas.ToInt()
+	}
+	if feeCap != nil && feeCap.Sign() > 0 && args.From != nil {
+		available := state.GetBalance(*args.From)
+		if args.Value != nil {
+			if args.Value.ToInt().Cmp(available) > 0 {
+				return 0, &api.RPCError{Code: api.ErrCodeExecutionFailed, Message: evm.ErrInsufficientFundsForTransfer.Error()}
+			}
+			available.Sub(available, args.Value.ToInt())
+		}
+		if allowance := new(big.Int).Div(available, feeCap); allowance.IsUint64() && hi > allowance.Uint64() {
+			hi = allowance.Uint64()
+		}
+	}
+	if gasCap := a.executor.GasCap(); gasCap != 0 && hi > gasCap {
+		hi = gasCap
+	}
+
+	// Every run starts from a copy of the state, keeping what was loaded
+	run := func(gas uint64) (*evm.ExecutionResult, error) {
+		args.Gas = (*hexutil.Uint64)(&gas)
+		runState := state.Copy()
+		result, err := a.execute(ctx, blockCtx, runState, args)
+		if errors.Is(err, evm.ErrIntrinsicGas) {
+			return &evm.ExecutionResult{Err: err}, nil
+		}
+		if err != nil {
+			return nil, executionError(ctx, runState, err)
+		}
+		return result, nil
+	}
+
+	result, err := run(hi)
+	if err != nil {
+		return 0, err
+	}
+	if result.Failed() {
+		if result.Err != vm.ErrOutOfGas {
+			return 0, callError(result)
+		}
+		return 0, &api.RPCError{
+			Code:    api.ErrCodeExecutionFailed,
+			Message: fmt.Sprintf("gas required exceeds allowance (%d)", hi),
+			Data:    map[string]interface{}{"reason": "out_of_gas", "allowance": hi},
+		}
+	}
+
+	// Less than the gas used cannot succeed
+	lo := result.UsedGas - 1
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		result, err := run(mid)
+		if err != nil {
+			return 0, err
+		}
+		if result.Failed() {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hexutil.Uint64(hi), nil
+}
+
+// callState returns the header of a block, latest by default, and the
+// state calls on it run on
+func (a *CallAPI) callState(ctx context.Context, blockNrOrHash *api.BlockNumberOrHash) (*types.Header, *evm.StateDB, error) {
+	simulation := &SimulationContext{}
+	if blockNrOrHash != nil {
+		simulation.BlockNumber = *blockNrOrHash
+	}
+	return a.simulationState(ctx, simulation)
+}
+
+// execute runs a call on a state with an unlimited gas pool. Errors other
+// than invalid arguments are the executor's.
+func (a *CallAPI) execute(ctx context.Context, blockCtx vm.BlockContext, state *evm.StateDB, args api.CallArgs) (*evm.ExecutionResult, error) {
+	msg, err := evm.CallMessage(args, blockCtx.BaseFee, a.executor.GasCap())
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: err.Error()}
+	}
+	gasPool := uint64(math.MaxUint64)
+	return a.executor.Apply(ctx, blockCtx, state, msg, &gasPool)
+}
+
+// executionError converts an error of execute: aborted executions and
+// failed state reads are internal errors, rejected calls failed executions
+func executionError(ctx context.Context, state *evm.StateDB, err error) error {
+	var rpcErr *api.RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	if ctx.Err() != nil || state.Error() != nil {
+		return &api.RPCError{Code: api.ErrCodeInternal, Message: err.Error()}
+	}
+	return &api.RPCError{Code: api.ErrCodeExecutionFailed, Message: err.Error()}
+}
+
+// callError returns the error of a failed execution: a revert with data
+// carries the data and its decoded reason
+func callError(result *evm.ExecutionResult) *api.RPCError {
+	if revert := result.Revert(); len(revert) > 0 {
+		return api.NewRevertError(revert)
+	}
+	return &api.RPCError{Code: api.ErrCodeExecutionFailed, Message: result.Err.Error()}
+}
+
+// simulationState returns the header of the simulation block and the state
+// bundles start from
+func (a *CallAPI) simulationState(ctx context.Context, simulation *SimulationContext) (*types.Header, *evm.StateDB, error) {
+	blockNumStr, err := a.state.resolveBlock(ctx, simulation.BlockNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+	number, err := strconv.ParseUint(blockNumStr, 10, 64)
+	if err != nil {
+		// latest and pending run on the latest state
+		if number, err = a.blockReader.GetLatestBlockNumber(ctx); err != nil {
+			return nil, nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get latest block: %v", err)}
+		}
+	}
+
+	index := -1
+	if simulation.TransactionIndex != nil {
+		index = *simulation.TransactionIndex
+	}
+	if index < 0 {
+		header, err := a.blockReader.GetHeader(ctx, number)
+		if err == storage.ErrNotFound {
+			return nil, nil, &api.RPCError{Code: api.ErrCodeUnknownBlock, Message: "header not found"}
+		}
+		if err != nil {
+			return nil, nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get block: %v", err)}
+		}
+		return header, a.executor.NewState(ctx, blockNumStr), nil
+	}
+
+	// Run the block's transactions before the index on its parent state
+	block, err := a.blockReader.GetBlock(ctx, number)
+	if err == storage.ErrNotFound {
+		return nil, nil, &api.RPCError{Code: api.ErrCodeUnknownBlock, Message: "header not found"}
+	}
+	if err != nil {
+		return nil, nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get block: %v", err)}
+	}
+	if index > len(block.Transactions()) {
+		return nil, nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: fmt.Sprintf("transaction index %d out of range, block has %d transactions", index, len(block.Transactions()))}
+	}
+	if number == 0 {
+		return block.Header(), a.executor.NewState(ctx, "0"), nil
+	}
+	parentStr := strconv.FormatUint(number-1, 10)
+	if err := a.state.checkPruned(ctx, parentStr); err != nil {
+		return nil, nil, err
+	}
+	state := a.executor.NewState(ctx, parentStr)
+	if err := a.executor.ReplayBlock(ctx, block, state, index); err != nil {
+		return nil, nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to replay block %d: %v", number, err)}
+	}
+	return block.Header(), state, nil
+}
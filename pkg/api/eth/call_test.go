@@ -0,0 +1,103 @@
+package eth
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/evm"
+	"github.com/sunvim/evm_rpc/pkg/forks"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// counterCode increments slot 0 and returns its new value
+var counterCode = common.FromHex("0x6000546001018060005560005260206000f3")
+
+// revertCode reverts without data
+var revertCode = common.FromHex("0x60006000fd")
+
+func TestCallMany(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain(t)
+	chain.setHead(chain.writeBlock(1, ""))
+
+	var (
+		sender   = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		counter  = common.HexToAddress("0x00000000000000000000000000000000000c0de0")
+		reverter = common.HexToAddress("0x00000000000000000000000000000000000c0de1")
+	)
+	diff := storage.NewStateDiff()
+	diff.Accounts[sender] = &storage.AccountState{Balance: big.NewInt(1e18)}
+	for addr, code := range map[common.Address][]byte{counter: counterCode, reverter: revertCode} {
+		hash := crypto.Keccak256Hash(code)
+		diff.Accounts[addr] = &storage.AccountState{Nonce: 1, Balance: new(big.Int), CodeHash: hash.Hex()}
+		diff.Code[hash] = code
+	}
+	diff.Storage[counter] = map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(5))}
+	if err := storage.NewStateWriter(chain.client).WriteLatestState(ctx, diff); err != nil {
+		t.Fatalf("WriteLatestState: %v", err)
+	}
+
+	chainConfig, err := forks.ChainConfig(testChainID, config.ForksConfig{})
+	if err != nil {
+		t.Fatalf("ChainConfig: %v", err)
+	}
+	blockReader := storage.NewBlockReader(chain.client)
+	stateReader := storage.NewStateReader(chain.client)
+	callAPI := NewCallAPI(blockReader, stateReader, evm.NewExecutor(blockReader, stateReader, chainConfig, 50_000_000, 5*time.Second), testChainID)
+
+	value := func(v int64) *hexutil.Big { return (*hexutil.Big)(big.NewInt(v)) }
+	increment := api.CallArgs{From: &sender, To: &counter}
+	bundles := []Bundle{
+		{Transactions: []api.CallArgs{increment, increment, {From: &sender, To: &testTo, Value: value(1)}}},
+		{Transactions: []api.CallArgs{
+			{From: &sender, To: &reverter},
+			{From: &sender, To: &testTo, Value: (*hexutil.Big)(new(big.Int).Mul(big.NewInt(2), big.NewInt(1e18)))},
+			increment,
+		}},
+	}
+	results, err := callAPI.CallMany(ctx, bundles, nil)
+	if err != nil {
+		t.Fatalf("CallMany: %v", err)
+	}
+
+	// A cold SLOAD and an SSTORE changing a committed slot on top of the
+	// intrinsic gas; every call starts with cold slots and committed storage.
+	// The transfer of bundle 0 is still paid for in bundle 1.
+	const incrementGas = 21000 + 2100 + 2900 + 6*3 + 3 + 3 + 3 + 3
+	want := [][]struct {
+		value   int64 // returned word, -1 for none
+		err     string
+		gasUsed uint64
+	}{
+		{{6, "", incrementGas}, {7, "", incrementGas}, {-1, "", 21000}},
+		{
+			{-1, "execution reverted", 21000 + 2*3},
+			{-1, "insufficient funds for gas * price + value: address 0x00000000000000000000000000000000000000AA have 999999999999999999 want 2000000000000000000", 0},
+			{8, "", incrementGas},
+		},
+	}
+	for i := range want {
+		for j, w := range want[i] {
+			got := results[i][j]
+			if got.Error != w.err {
+				t.Errorf("bundle %d call %d: error = %q, want %q", i, j, got.Error, w.err)
+			}
+			if uint64(got.GasUsed) != w.gasUsed {
+				t.Errorf("bundle %d call %d: gas used = %d, want %d", i, j, got.GasUsed, w.gasUsed)
+			}
+			switch {
+			case w.value < 0 && got.Value != nil && len(*got.Value) > 0:
+				t.Errorf("bundle %d call %d: value = %x, want none", i, j, *got.Value)
+			case w.value >= 0 && (got.Value == nil || new(big.Int).SetBytes(*got.Value).Int64() != w.value):
+				t.Errorf("bundle %d call %d: value = %v, want %d", i, j, got.Value, w.value)
+			}
+		}
+	}
+}
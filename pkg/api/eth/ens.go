@@ -0,0 +1,391 @@
+package eth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/cache"
+)
+
+const (
+	// maxCCIPLookups bounds the offchain lookups of a call, as EIP-3668
+	// recommends
+	maxCCIPLookups = 4
+	// maxCCIPResponse bounds the size of a gateway response
+	maxCCIPResponse = 1 << 20
+)
+
+// Selectors of the ENS methods called
+var (
+	selectorResolver       = common.FromHex("0x0178b8bf") // resolver(bytes32)
+	selectorAddr           = common.FromHex("0x3b3b57de") // addr(bytes32)
+	selectorName           = common.FromHex("0x691f3431") // name(bytes32)
+	selectorResolve        = common.FromHex("0x9061b923") // resolve(bytes,bytes), also the ENSIP-10 interface
+	selectorSupports       = common.FromHex("0x01ffc9a7") // supportsInterface(bytes4)
+	selectorOffchainLookup = common.FromHex("0x556f1830") // OffchainLookup(address,string[],bytes,bytes4,bytes)
+)
+
+var (
+	ensAddressType, _     = abi.NewType("address", "", nil)
+	ensBytesType, _       = abi.NewType("bytes", "", nil)
+	ensBytes4Type, _      = abi.NewType("bytes4", "", nil)
+	ensStringType, _      = abi.NewType("string", "", nil)
+	ensStringSliceType, _ = abi.NewType("string[]", "", nil)
+
+	offchainLookupArgs = abi.Arguments{{Type: ensAddressType}, {Type: ensStringSliceType}, {Type: ensBytesType}, {Type: ensBytes4Type}, {Type: ensBytesType}}
+	bytesPairArgs      = abi.Arguments{{Type: ensBytesType}, {Type: ensBytesType}}
+)
+
+// ENSOptions configure an ENSAPI
+type ENSOptions struct {
+	CacheSize   int
+	CacheTTL    time.Duration // 0 caches until evicted
+	CCIPRead    bool          // follow EIP-3668 offchain lookups
+	CCIPTimeout time.Duration // per gateway request; 0 is unlimited
+}
+
+// ENSAPI provides evm_resolveName and evm_lookupAddress, which resolve
+// names with an ENS-compatible registry through eth_call on the latest
+// state, for web3 clients of chains without ENS support in their library
+type ENSAPI struct {
+	calls    *CallAPI
+	registry common.Address
+	options  ENSOptions
+	client   *http.Client
+	names    *cache.Cache[string, *common.Address]
+	reverse  *cache.Cache[common.Address, *string]
+}
+
+// NewENSAPI creates a new ENSAPI resolving names with the registry at
+// registry
+func NewENSAPI(calls *CallAPI, registry common.Address, options ENSOptions) (*ENSAPI, error) {
+	names, err := cache.NewCache[string, *common.Address](options.CacheSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create name cache: %w", err)
+	}
+	reverse, err := cache.NewCache[common.Address, *string](options.CacheSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reverse name cache: %w", err)
+	}
+	return &ENSAPI{
+		calls:    calls,
+		registry: registry,
+		options:  options,
+		client:   &http.Client{Timeout: options.CCIPTimeout},
+		names:    names,
+		reverse:  reverse,
+	}, nil
+}
+
+// ResolveName returns the address of a name, or null if it does not
+// resolve. Resolvers of a parent name serve names that have none as in
+// ENSIP-10.
+func (a *ENSAPI) ResolveName(ctx context.Context, name string) (*common.Address, error) {
+	name, err := normalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+	if addr, ok := a.names.Get(name); ok {
+		return addr, nil
+	}
+
+	addr, err := a.resolveName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	a.names.Set(name, addr, a.options.CacheTTL)
+	return addr, nil
+}
+
+// LookupAddress returns the primary name of an address, or null if it has
+// none or the name does not resolve back to the address
+func (a *ENSAPI) LookupAddress(ctx context.Context, address common.Address) (*string, error) {
+	if name, ok := a.reverse.Get(address); ok {
+		return name, nil
+	}
+
+	name, err := a.lookupAddress(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	a.reverse.Set(address, name, a.options.CacheTTL)
+	return name, nil
+}
+
+func (a *ENSAPI) resolveName(ctx context.Context, name string) (*common.Address, error) {
+	resolver, exact, err := a.findResolver(ctx, name)
+	if err != nil || resolver == (common.Address{}) {
+		return nil, err
+	}
+
+	node := namehash(name)
+	addrCall := append(append([]byte{}, selectorAddr...), node[:]...)
+	wildcard, err := a.supportsInterface(ctx, resolver, selectorResolve)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	switch {
+	case wildcard:
+		encoded, err := dnsEncode(name)
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: err.Error()}
+		}
+		args, err := bytesPairArgs.Pack(encoded, addrCall)
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: err.Error()}
+		}
+		result, err := a.call(ctx, resolver, append(append([]byte{}, selectorResolve...), args...))
+		if err != nil {
+			return nil, err
+		}
+		values, err := abi.Arguments{{Type: ensBytesType}}.Unpack(result)
+		if err != nil {
+			return nil, nil
+		}
+		out = values[0].([]byte)
+	case exact:
+		if out, err = a.call(ctx, resolver, addrCall); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	if len(out) < 32 {
+		return nil, nil
+	}
+	addr := common.BytesToAddress(out[12:32])
+	if addr == (common.Address{}) {
+		return nil, nil
+	}
+	return &addr, nil
+}
+
+func (a *ENSAPI) lookupAddress(ctx context.Context, address common.Address) (*string, error) {
+	reverseName := strings.ToLower(address.Hex()[2:]) + ".addr.reverse"
+	resolver, err := a.resolver(ctx, reverseName)
+	if err != nil || resolver == (common.Address{}) {
+		return nil, err
+	}
+
+	node := namehash(reverseName)
+	out, err := a.call(ctx, resolver, append(append([]byte{}, selectorName...), node[:]...))
+	if err != nil {
+		return nil, err
+	}
+	values, err := abi.Arguments{{Type: ensStringType}}.Unpack(out)
+	if err != nil {
+		return nil, nil
+	}
+	name := values[0].(string)
+	if name == "" {
+		return nil, nil
+	}
+
+	// The reverse record is set by the address owner alone, so it only
+	// counts if the name resolves back
+	resolved, err := a.ResolveName(ctx, name)
+	var rpcErr *api.RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Code == api.ErrCodeInvalidParams {
+		return nil, nil
+	}
+	if err != nil || resolved == nil || *resolved != address {
+		return nil, err
+	}
+	return &name, nil
+}
+
+// findResolver returns the resolver of a name, or of its closest parent
+// with one, and whether it was set for the name itself
+func (a *ENSAPI) findResolver(ctx context.Context, name string) (common.Address, bool, error) {
+	for current := name; ; {
+		resolver, err := a.resolver(ctx, current)
+		if err != nil || resolver != (common.Address{}) {
+			return resolver, current == name, err
+		}
+		i := strings.IndexByte(current, '.')
+		if i < 0 {
+			return common.Address{}, false, nil
+		}
+		current = current[i+1:]
+	}
+}
+
+// resolver returns the resolver the registry holds for a name
+func (a *ENSAPI) resolver(ctx context.Context, name string) (common.Address, error) {
+	node := namehash(name)
+	out, err := a.call(ctx, a.registry, append(append([]byte{}, selectorResolver...), node[:]...))
+	if err != nil || len(out) < 32 {
+		return common.Address{}, err
+	}
+	return common.BytesToAddress(out[12:32]), nil
+}
+
+// supportsInterface reports whether a contract implements an ERC-165
+// interface. Contracts that fail the call do not; offchain lookups are not
+// followed.
+func (a *ENSAPI) supportsInterface(ctx context.Context, contract common.Address, id []byte) (bool, error) {
+	out, err := a.staticCall(ctx, contract, append(append([]byte{}, selectorSupports...), common.RightPadBytes(id, 32)...))
+	var rpcErr *api.RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Code == api.ErrCodeInternal {
+		return false, err
+	}
+	return err == nil && len(out) == 32 && out[31] == 1, nil
+}
+
+// call executes a call on the latest state, following EIP-3668 offchain
+// lookups when enabled
+func (a *ENSAPI) call(ctx context.Context, to common.Address, input []byte) ([]byte, error) {
+	for lookups := 0; ; lookups++ {
+		out, err := a.staticCall(ctx, to, input)
+		if err == nil {
+			return out, nil
+		}
+		var rpcErr *api.RPCError
+		if !errors.As(err, &rpcErr) || rpcErr.Code != api.ErrCodeExecutionReverted {
+			return nil, err
+		}
+		revert, _ := hexutil.Decode(fmt.Sprint(rpcErr.Data))
+		if len(revert) < 4 || !bytes.Equal(revert[:4], selectorOffchainLookup) {
+			return nil, err
+		}
+		if !a.options.CCIPRead {
+			return nil, &api.RPCError{Code: api.ErrCodeExecutionFailed, Message: "offchain lookup required, but CCIP-read is disabled"}
+		}
+		if lookups == maxCCIPLookups {
+			return nil, &api.RPCError{Code: api.ErrCodeExecutionFailed, Message: fmt.Sprintf("too many offchain lookups, max %d", maxCCIPLookups)}
+		}
+
+		values, err := offchainLookupArgs.Unpack(revert[4:])
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeExecutionFailed, Message: fmt.Sprintf("invalid offchain lookup: %v", err)}
+		}
+		sender, urls, callData := values[0].(common.Address), values[1].([]string), values[2].([]byte)
+		callback, extraData := values[3].([4]byte), values[4].([]byte)
+		if sender != to {
+			return nil, &api.RPCError{Code: api.ErrCodeExecutionFailed, Message: fmt.Sprintf("offchain lookup sender %s is not the called contract", sender.Hex())}
+		}
+		response, err := a.fetch(ctx, sender, urls, callData)
+		if err != nil {
+			return nil, err
+		}
+		args, err := bytesPairArgs.Pack(response, extraData)
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: err.Error()}
+		}
+		input = append(callback[:], args...)
+	}
+}
+
+// staticCall executes a call on the latest state
+func (a *ENSAPI) staticCall(ctx context.Context, to common.Address, input []byte) ([]byte, error) {
+	data := hexutil.Bytes(input)
+	return a.calls.Call(ctx, api.CallArgs{To: &to, Data: &data}, nil)
+}
+
+// fetch queries the gateways of an offchain lookup in order, as EIP-3668
+// specifies: URLs with {data} are fetched with GET, others with POST.
+// Server errors move on to the next gateway.
+func (a *ENSAPI) fetch(ctx context.Context, sender common.Address, urls []string, callData []byte) ([]byte, error) {
+	senderHex, dataHex := strings.ToLower(sender.Hex()), hexutil.Encode(callData)
+	err := errors.New("no gateway urls")
+	for _, url := range urls {
+		url = strings.ReplaceAll(url, "{sender}", senderHex)
+		var req *http.Request
+		if strings.Contains(url, "{data}") {
+			req, err = http.NewRequestWithContext(ctx, http.MethodGet, strings.ReplaceAll(url, "{data}", dataHex), nil)
+		} else {
+			body, _ := json.Marshal(map[string]string{"data": dataHex, "sender": senderHex})
+			req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+			if req != nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+		}
+		if err != nil {
+			continue
+		}
+
+		var (
+			resp *http.Response
+			body []byte
+		)
+		if resp, err = a.client.Do(req); err != nil {
+			continue
+		}
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxCCIPResponse))
+		resp.Body.Close()
+		if err != nil {
+			continue
+		}
+		if resp.StatusCode >= 500 {
+			err = fmt.Errorf("gateway %s: %s", req.URL.Host, resp.Status)
+			continue
+		}
+		if resp.StatusCode >= 400 {
+			return nil, &api.RPCError{Code: api.ErrCodeExecutionFailed, Message: fmt.Sprintf("offchain lookup failed: gateway %s: %s", req.URL.Host, resp.Status)}
+		}
+		var result struct {
+			Data hexutil.Bytes `json:"data"`
+		}
+		if err = json.Unmarshal(body, &result); err != nil {
+			err = fmt.Errorf("gateway %s: invalid response: %w", req.URL.Host, err)
+			continue
+		}
+		return result.Data, nil
+	}
+	return nil, &api.RPCError{Code: api.ErrCodeResourceUnavail, Message: fmt.Sprintf("offchain lookup failed: %v", err)}
+}
+
+// normalizeName lowercases a name and checks that it has no empty labels.
+// Full ENSIP-15 normalization is left to clients.
+func normalizeName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", &api.RPCError{Code: api.ErrCodeInvalidParams, Message: "empty name"}
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return "", &api.RPCError{Code: api.ErrCodeInvalidParams, Message: fmt.Sprintf("invalid name %q: empty label", name)}
+		}
+	}
+	return name, nil
+}
+
+// namehash returns the EIP-137 node of a name
+func namehash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = crypto.Keccak256Hash(node[:], crypto.Keccak256([]byte(labels[i])))
+	}
+	return node
+}
+
+// dnsEncode returns a name in DNS wire format, as ENSIP-10 resolve takes it
+func dnsEncode(name string) ([]byte, error) {
+	var encoded []byte
+	for _, label := range strings.Split(name, ".") {
+		if len(label) > 63 {
+			return nil, fmt.Errorf("invalid name %q: label longer than 63 bytes", name)
+		}
+		encoded = append(encoded, byte(len(label)))
+		encoded = append(encoded, label...)
+	}
+	return append(encoded, 0), nil
+}
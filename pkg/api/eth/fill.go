@@ -0,0 +1,147 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// txFiller completes transaction arguments with the sender's pending nonce,
+// a gas estimate and fees from the gas oracle, as geth does before signing
+type txFiller struct {
+	blockReader *storage.BlockReader
+	stateReader *storage.StateReader
+	txPool      *storage.TxPoolStorage
+	gas         *GasAPI
+	chainID     *big.Int
+}
+
+// newTxFiller creates a transaction filler for a chain
+func newTxFiller(blockReader *storage.BlockReader, stateReader *storage.StateReader, txPool *storage.TxPoolStorage, chainID uint64) *txFiller {
+	return &txFiller{
+		blockReader: blockReader,
+		stateReader: stateReader,
+		txPool:      txPool,
+		gas:         NewGasAPI(blockReader, nil, chainID), // only prices and estimates gas
+		chainID:     new(big.Int).SetUint64(chainID),
+	}
+}
+
+// fill builds an unsigned transaction from args, filling in what is missing.
+// A dynamic fee transaction is built unless a gas price is given or the
+// chain has no base fee.
+func (f *txFiller) fill(ctx context.Context, args *api.TransactionArgs) (*types.Transaction, error) {
+	if args.From == nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: "missing from address"}
+	}
+	if args.ChainID != nil && args.ChainID.ToInt().Cmp(f.chainID) != 0 {
+		return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: fmt.Sprintf("chainId does not match node's (have=%v, want=%v)", args.ChainID.ToInt(), f.chainID)}
+	}
+	if args.GasPrice != nil && (args.MaxFeePerGas != nil || args.MaxPriorityFeePerGas != nil) {
+		return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: "both gasPrice and (maxFeePerGas or maxPriorityFeePerGas) specified"}
+	}
+	if args.Data != nil && args.Input != nil && string(*args.Data) != string(*args.Input) {
+		return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: `both "data" and "input" are set and not equal`}
+	}
+	data := args.CallData()
+	if args.To == nil && len(data) == 0 {
+		return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: "contract creation without any data provided"}
+	}
+
+	value := new(big.Int)
+	if args.Value != nil {
+		value = args.Value.ToInt()
+	}
+
+	var nonce uint64
+	if args.Nonce != nil {
+		nonce = uint64(*args.Nonce)
+	} else {
+		accountNonce, err := f.stateReader.GetNonce(ctx, *args.From, "latest")
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get nonce: %v", err)}
+		}
+		nonce, err = f.txPool.PendingNonce(ctx, *args.From, accountNonce)
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get pending nonce: %v", err)}
+		}
+	}
+
+	var gas uint64
+	if args.Gas != nil {
+		gas = uint64(*args.Gas)
+	} else {
+		dataBytes := hexutil.Bytes(data)
+		estimate, err := f.gas.EstimateGas(ctx, api.CallArgs{
+			From:                 args.From,
+			To:                   args.To,
+			GasPrice:             args.GasPrice,
+			MaxFeePerGas:         args.MaxFeePerGas,
+			MaxPriorityFeePerGas: args.MaxPriorityFeePerGas,
+			Value:                args.Value,
+			Data:                 &dataBytes,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		gas = uint64(estimate)
+	}
+
+	var accessList types.AccessList
+	if args.AccessList != nil {
+		accessList = *args.AccessList
+	}
+
+	var baseFee *big.Int
+	if latest, err := f.blockReader.GetLatestBlockNumber(ctx); err == nil {
+		if head, err := f.blockReader.GetHeader(ctx, latest); err == nil {
+			baseFee = head.BaseFee
+		}
+	}
+
+	if args.GasPrice != nil || baseFee == nil {
+		gasPrice := args.GasPrice
+		if gasPrice == nil {
+			price, err := f.gas.GasPrice(ctx)
+			if err != nil {
+				return nil, err
+			}
+			gasPrice = price
+		}
+		if args.AccessList != nil {
+			return types.NewTx(&types.AccessListTx{
+				ChainID: f.chainID, Nonce: nonce, GasPrice: gasPrice.ToInt(), Gas: gas,
+				To: args.To, Value: value, Data: data, AccessList: accessList,
+			}), nil
+		}
+		return types.NewTx(&types.LegacyTx{
+			Nonce: nonce, GasPrice: gasPrice.ToInt(), Gas: gas, To: args.To, Value: value, Data: data,
+		}), nil
+	}
+
+	tip := args.MaxPriorityFeePerGas
+	if tip == nil {
+		suggested, err := f.gas.MaxPriorityFeePerGas(ctx)
+		if err != nil {
+			return nil, err
+		}
+		tip = suggested
+	}
+	feeCap := args.MaxFeePerGas
+	if feeCap == nil {
+		// Leave room for the base fee to double
+		feeCap = (*hexutil.Big)(new(big.Int).Add(tip.ToInt(), new(big.Int).Mul(baseFee, big.NewInt(2))))
+	}
+	if feeCap.ToInt().Cmp(tip.ToInt()) < 0 {
+		return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: fmt.Sprintf("maxFeePerGas (%v) < maxPriorityFeePerGas (%v)", feeCap, tip)}
+	}
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID: f.chainID, Nonce: nonce, GasTipCap: tip.ToInt(), GasFeeCap: feeCap.ToInt(), Gas: gas,
+		To: args.To, Value: value, Data: data, AccessList: accessList,
+	}), nil
+}
@@ -0,0 +1,275 @@
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// maxFilterBlockRange bounds the number of blocks scanned per filter call
+const maxFilterBlockRange = 1000
+
+// FilterAPI provides the polling filter RPC methods.
+// Filters are persisted in Pika, so IDs stay valid across restarts and
+// can be polled through any replica.
+type FilterAPI struct {
+	blockReader *storage.BlockReader
+	filters     *storage.FilterStore
+	limits      LogLimits
+}
+
+// NewFilterAPI creates a new FilterAPI
+func NewFilterAPI(blockReader *storage.BlockReader, filters *storage.FilterStore) *FilterAPI {
+	return &FilterAPI{
+		blockReader: blockReader,
+		filters:     filters,
+		limits:      DefaultLogLimits,
+	}
+}
+
+// NewFilter installs a log filter and returns its ID
+func (a *FilterAPI) NewFilter(ctx context.Context, query api.FilterQuery) (string, error) {
+	if query.BlockHash != nil {
+		return "", &api.RPCError{Code: api.ErrCodeInvalidParams, Message: "blockHash is not supported for filters"}
+	}
+	if err := a.checkQuery(&query); err != nil {
+		return "", err
+	}
+
+	latest, err := a.blockReader.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return "", &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get latest block: %v", err)}
+	}
+
+	criteria, err := json.Marshal(query)
+	if err != nil {
+		return "", &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to encode filter: %v", err)}
+	}
+
+	filter, err := a.filters.Install(ctx, storage.FilterTypeLogs, criteria, latest)
+	if err != nil {
+		return "", &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to install filter: %v", err)}
+	}
+
+	return filter.ID, nil
+}
+
+// NewBlockFilter installs a filter that reports new block hashes
+func (a *FilterAPI) NewBlockFilter(ctx context.Context) (string, error) {
+	latest, err := a.blockReader.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return "", &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get latest block: %v", err)}
+	}
+
+	filter, err := a.filters.Install(ctx, storage.FilterTypeBlocks, nil, latest)
+	if err != nil {
+		return "", &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to install filter: %v", err)}
+	}
+
+	return filter.ID, nil
+}
+
+// UninstallFilter removes a filter
+func (a *FilterAPI) UninstallFilter(ctx context.Context, id string) (bool, error) {
+	removed, err := a.filters.Uninstall(ctx, id)
+	if err != nil {
+		return false, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to uninstall filter: %v", err)}
+	}
+	return removed, nil
+}
+
+// GetFilterChanges returns the logs or block hashes produced since the
+// previous poll and advances the filter cursor
+func (a *FilterAPI) GetFilterChanges(ctx context.Context, id string) (interface{}, error) {
+	filter, err := a.getFilter(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := a.blockReader.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get latest block: %v", err)}
+	}
+
+	from := filter.Cursor + 1
+	to := latest
+	if to >= from && to-from+1 > maxFilterBlockRange {
+		// Deliver the backlog over several polls
+		to = from + maxFilterBlockRange - 1
+	}
+
+	var result interface{}
+	switch filter.Type {
+	case storage.FilterTypeBlocks:
+		hashes := []common.Hash{}
+		for n := from; n <= to; n++ {
+			header, err := a.blockReader.GetHeader(ctx, n)
+			if err != nil {
+				return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get block %d: %v", n, err)}
+			}
+			hashes = append(hashes, header.Hash())
+		}
+		result = hashes
+
+	case storage.FilterTypeLogs:
+		query, err := decodeFilterQuery(filter)
+		if err != nil {
+			return nil, err
+		}
+
+		// Respect the filter's own block range
+		if query.ToBlock != "" {
+			if bn, err := api.ParseBlockNumber(query.ToBlock); err == nil && bn >= 0 && uint64(bn) < to {
+				to = uint64(bn)
+			}
+		}
+
+		logs, err := a.collectLogs(ctx, query, from, to)
+		if err != nil {
+			return nil, err
+		}
+		result = logs
+
+	default:
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("unknown filter type: %s", filter.Type)}
+	}
+
+	cursor := filter.Cursor
+	if to >= from {
+		cursor = to
+	}
+	if err := a.filters.UpdateCursor(ctx, filter, cursor); err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to update filter: %v", err)}
+	}
+
+	return result, nil
+}
+
+// GetFilterLogs returns all logs matching a log filter's full criteria
+func (a *FilterAPI) GetFilterLogs(ctx context.Context, id string) ([]*types.Log, error) {
+	filter, err := a.getFilter(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Type != storage.FilterTypeLogs {
+		return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: "filter is not a log filter"}
+	}
+
+	query, err := decodeFilterQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := a.blockReader.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get latest block: %v", err)}
+	}
+
+	from, err := resolveFilterBlock(query.FromBlock, latest)
+	if err != nil {
+		return nil, err
+	}
+	to, err := resolveFilterBlock(query.ToBlock, latest)
+	if err != nil {
+		return nil, err
+	}
+	if from > to {
+		return []*types.Log{}, nil
+	}
+	if err := a.checkRange(from, to); err != nil {
+		return nil, err
+	}
+
+	if err := a.filters.Touch(ctx, id); err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to update filter: %v", err)}
+	}
+
+	return a.collectLogs(ctx, query, from, to)
+}
+
+// getFilter loads an installed filter
+func (a *FilterAPI) getFilter(ctx context.Context, id string) (*storage.StoredFilter, error) {
+	filter, err := a.filters.Get(ctx, id)
+	if err == storage.ErrNotFound {
+		return nil, &api.RPCError{Code: api.ErrCodeInvalidInput, Message: "filter not found"}
+	}
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get filter: %v", err)}
+	}
+	return filter, nil
+}
+
+// collectLogs returns the logs in [from, to] matching the query, failing
+// once they exceed the result limit or the query its time limit. Only the
+// blocks whose blooms may match are read.
+func (a *FilterAPI) collectLogs(ctx context.Context, query *api.FilterQuery, from, to uint64) ([]*types.Log, error) {
+	logs := []*types.Log{}
+	if from > to {
+		return logs, nil
+	}
+	if a.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.limits.Timeout)
+		defer cancel()
+	}
+
+	filter := storage.LogFilter{Addresses: query.Addresses, Topics: query.Topics}
+	for start := from; start <= to; start += logsChunkSize {
+		end := min(start+logsChunkSize-1, to)
+		numbers, err := a.blockReader.MatchingBlocks(ctx, start, end, filter)
+		var rangeLogs []*types.Log
+		if err == nil {
+			metrics.RecordBloomSkips(int(end-start+1) - len(numbers))
+			rangeLogs, err = a.blockReader.GetLogsBlocks(ctx, numbers)
+		}
+		if ctx.Err() == context.DeadlineExceeded && a.limits.Timeout > 0 {
+			return nil, limitError("timeout", a.limits.Timeout.String(), nil, "query timed out after %v", a.limits.Timeout)
+		}
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get logs for blocks %d-%d: %v", start, end, err)}
+		}
+		for _, log := range rangeLogs {
+			if !query.Matches(log) {
+				continue
+			}
+			logs = append(logs, log)
+			if max := a.limits.MaxResults; max > 0 && len(logs) > max {
+				return nil, limitError("max_results", max, nil, "query returned more than %d results", max)
+			}
+		}
+		if end == to {
+			break
+		}
+	}
+	return logs, nil
+}
+
+// decodeFilterQuery decodes the criteria stored with a log filter
+func decodeFilterQuery(filter *storage.StoredFilter) (*api.FilterQuery, error) {
+	var query api.FilterQuery
+	if err := json.Unmarshal(filter.Criteria, &query); err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to decode filter: %v", err)}
+	}
+	return &query, nil
+}
+
+// resolveFilterBlock resolves a filter block tag, defaulting to latest
+func resolveFilterBlock(tag string, latest uint64) (uint64, error) {
+	if tag == "" {
+		return latest, nil
+	}
+	bn, err := api.ParseBlockNumber(tag)
+	if err != nil {
+		return 0, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: fmt.Sprintf("invalid block number: %v", err)}
+	}
+	if bn == api.LatestBlockNumber || bn == api.PendingBlockNumber {
+		return latest, nil
+	}
+	return uint64(bn), nil
+}
@@ -6,20 +6,28 @@ import (
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/forks"
 	"github.com/sunvim/evm_rpc/pkg/storage"
+	"github.com/sunvim/evm_rpc/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // GasAPI provides gas-related RPC methods
 type GasAPI struct {
 	blockReader *storage.BlockReader
+	chainConfig *params.ChainConfig
 	chainID     uint64
+	calls       *CallAPI
+	txPool      *storage.TxPoolStorage // nil if the pool is not weighed
 }
 
-// NewGasAPI creates a new GasAPI
-func NewGasAPI(blockReader *storage.BlockReader, chainID uint64) *GasAPI {
+// NewGasAPI creates a new GasAPI predicting base fees by the chain's forks
+func NewGasAPI(blockReader *storage.BlockReader, chainConfig *params.ChainConfig, chainID uint64) *GasAPI {
 	return &GasAPI{
 		blockReader: blockReader,
+		chainConfig: chainConfig,
 		chainID:     chainID,
 	}
 }
@@ -40,6 +48,30 @@ func (api *GasAPI) MaxPriorityFeePerGas(ctx context.Context) (*hexutil.Big, erro
 	return (*hexutil.Big)(priorityFee), nil
 }
 
+// BaseFee returns the base fee of the latest block and the one predicted
+// for the next block by EIP-1559, read from the latest header alone so that
+// fee-estimation UIs need not fetch whole blocks. This is a non-standard
+// extension. Fees are null before London.
+func (a *GasAPI) BaseFee(ctx context.Context) (*api.BaseFeeResult, error) {
+	number, err := a.blockReader.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get latest block: %v", err)}
+	}
+	header, err := a.blockReader.GetHeader(ctx, number)
+	if err == storage.ErrNotFound {
+		return nil, api.ErrBlockNotFound
+	}
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get block header: %v", err)}
+	}
+
+	return &api.BaseFeeResult{
+		BlockNumber:       hexutil.Uint64(number),
+		BaseFeePerGas:     (*hexutil.Big)(header.BaseFee),
+		NextBaseFeePerGas: (*hexutil.Big)(forks.NextBaseFee(a.chainConfig, header)),
+	}, nil
+}
+
 // FeeHistory returns the fee history
 func (a *GasAPI) FeeHistory(ctx context.Context, blockCount hexutil.Uint64, lastBlock string, rewardPercentiles []float64) (*api.FeeHistoryResult, error) {
 	// Parse last block
@@ -116,9 +148,23 @@ func (a *GasAPI) FeeHistory(ctx context.Context, blockCount hexutil.Uint64, last
 	return result, nil
 }
 
-// EstimateGas estimates the gas needed for a transaction
-// This is a placeholder - full implementation would require EVM execution
-func (api *GasAPI) EstimateGas(ctx context.Context, args api.CallArgs) (hexutil.Uint64, error) {
+// SetCallAPI makes EstimateGas execute the call on the state of the block
+// instead of returning fixed estimates. It must be called before serving.
+func (a *GasAPI) SetCallAPI(calls *CallAPI) {
+	a.calls = calls
+}
+
+// EstimateGas estimates the gas needed for a transaction by executing it
+// when a CallAPI is set, and returns fixed estimates otherwise. The
+// optional block is accepted for compatibility with geth.
+func (api *GasAPI) EstimateGas(ctx context.Context, args api.CallArgs, blockNrOrHash *api.BlockNumberOrHash) (hexutil.Uint64, error) {
+	ctx, span := tracing.StartSpan(ctx, "evm.estimateGas", trace.SpanKindInternal)
+	defer span.End()
+
+	if api.calls != nil {
+		return api.calls.estimateGas(ctx, args, blockNrOrHash)
+	}
+
 	// Simple estimation: 21000 for transfers, 50000 for contract calls
 	if args.Data == nil || len(*args.Data) == 0 {
 		return hexutil.Uint64(21000), nil
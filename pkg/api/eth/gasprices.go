@@ -0,0 +1,120 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/forks"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+const (
+	// gasPriceBlocks is the number of recent blocks eth_gasPrices samples
+	gasPriceBlocks = 20
+
+	// Percentiles of the sampled tips suggested for each speed
+	gasPriceSlowPercentile     = 30
+	gasPriceStandardPercentile = 60
+	gasPriceFastPercentile     = 90
+)
+
+// defaultPriorityFee is the tip suggested when there is nothing to sample,
+// 1 gwei
+var defaultPriorityFee = big.NewInt(1000000000)
+
+// SetTxPool makes eth_gasPrices weigh the transactions waiting in the pool.
+// It must be called before serving.
+func (a *GasAPI) SetTxPool(txPool *storage.TxPoolStorage) {
+	a.txPool = txPool
+}
+
+// GasPrices returns slow, standard and fast fee suggestions for the next
+// block, so that wallets need not run their own oracle. This is a
+// non-standard extension.
+//
+// The tips paid in the last gasPriceBlocks blocks are sampled together
+// with those of the pending transactions that would fill the next block,
+// so that a backlog in the pool raises the suggestions before it shows in
+// blocks. The fee caps leave room for the base fee to double.
+func (a *GasAPI) GasPrices(ctx context.Context) (*api.GasPricesResult, error) {
+	latest, err := a.blockReader.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get latest block: %v", err)}
+	}
+	from := uint64(0)
+	if latest >= gasPriceBlocks {
+		from = latest - gasPriceBlocks + 1
+	}
+	blocks, err := a.blockReader.GetBlocksRange(ctx, from, latest)
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get blocks: %v", err)}
+	}
+
+	var head *types.Header
+	var tips []*big.Int
+	var sampled, txCount int
+	for _, block := range blocks {
+		if block == nil {
+			continue
+		}
+		head = block.Header()
+		sampled++
+		txCount += len(block.Transactions())
+		for _, tx := range block.Transactions() {
+			tips = append(tips, effectiveTip(tx, block.BaseFee()))
+		}
+	}
+	if head == nil {
+		return nil, api.ErrBlockNotFound
+	}
+	baseFee := forks.NextBaseFee(a.chainConfig, head)
+
+	result := &api.GasPricesResult{
+		BlockNumber:   hexutil.Uint64(head.Number.Uint64()),
+		BaseFeePerGas: (*hexutil.Big)(baseFee),
+	}
+
+	// The pending transactions paying the most would make up the next
+	// block, assuming it holds as many as recent ones did on average
+	if a.txPool != nil {
+		status, err := a.txPool.GetPoolStatus(ctx)
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get pool status: %v", err)}
+		}
+		result.PendingTransactions = hexutil.Uint64(status["pending"])
+
+		pending, err := a.txPool.TopPricedTxs(ctx, (txCount+sampled-1)/sampled)
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get pending transactions: %v", err)}
+		}
+		for _, tx := range pending {
+			tips = append(tips, effectiveTip(tx, baseFee))
+		}
+	}
+
+	sort.Slice(tips, func(i, j int) bool { return tips[i].Cmp(tips[j]) < 0 })
+	result.Slow = gasPriceTier(tips, gasPriceSlowPercentile, baseFee)
+	result.Standard = gasPriceTier(tips, gasPriceStandardPercentile, baseFee)
+	result.Fast = gasPriceTier(tips, gasPriceFastPercentile, baseFee)
+	return result, nil
+}
+
+// gasPriceTier returns the suggestion at a percentile of sorted tips
+func gasPriceTier(tips []*big.Int, percentile int, baseFee *big.Int) *api.GasPriceTier {
+	tip := defaultPriorityFee
+	if len(tips) > 0 {
+		tip = tips[(len(tips)-1)*percentile/100]
+	}
+
+	base := baseFeeOrZero(baseFee)
+	return &api.GasPriceTier{
+		MaxPriorityFeePerGas: (*hexutil.Big)(new(big.Int).Set(tip)),
+		MaxFeePerGas:         (*hexutil.Big)(new(big.Int).Add(new(big.Int).Lsh(base, 1), tip)),
+		GasPrice:             (*hexutil.Big)(new(big.Int).Add(base, tip)),
+	}
+}
@@ -0,0 +1,132 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// logsChunkSize is the number of blocks whose logs are loaded at a time,
+// so that result and time limits are checked while a query runs
+const logsChunkSize = 100
+
+// LogLimits bound log queries so that one cannot monopolize the service.
+// Zero values are unlimited.
+type LogLimits struct {
+	MaxBlockRange uint64        // blocks per query
+	MaxAddresses  int           // addresses per query
+	MaxTopics     int           // alternatives per topic position
+	MaxResults    int           // logs per response
+	Timeout       time.Duration // execution time per query
+}
+
+// DefaultLogLimits are the limits of a FilterAPI until SetLimits is called
+var DefaultLogLimits = LogLimits{MaxBlockRange: maxFilterBlockRange}
+
+// SetLimits replaces the limits of log queries. It must be called before
+// serving.
+func (a *FilterAPI) SetLimits(limits LogLimits) {
+	a.limits = limits
+}
+
+// GetLogs returns the logs matching a filter query
+func (a *FilterAPI) GetLogs(ctx context.Context, query api.FilterQuery) ([]*types.Log, error) {
+	if err := a.checkQuery(&query); err != nil {
+		return nil, err
+	}
+
+	if query.BlockHash != nil {
+		if query.FromBlock != "" || query.ToBlock != "" {
+			return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: "cannot specify both blockHash and fromBlock/toBlock"}
+		}
+		block, err := a.blockReader.GetBlockByHash(ctx, *query.BlockHash)
+		if err == storage.ErrNotFound {
+			return nil, &api.RPCError{Code: api.ErrCodeUnknownBlock, Message: "unknown block"}
+		}
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get block: %v", err)}
+		}
+
+		// The block may have been reorged out; its logs are only served
+		// while it is canonical
+		logs, err := a.collectLogs(ctx, &query, block.NumberU64(), block.NumberU64())
+		if err != nil {
+			return nil, err
+		}
+		matching := logs[:0]
+		for _, log := range logs {
+			if log.BlockHash == *query.BlockHash {
+				matching = append(matching, log)
+			}
+		}
+		return matching, nil
+	}
+
+	latest, err := a.blockReader.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get latest block: %v", err)}
+	}
+	from, err := resolveFilterBlock(query.FromBlock, latest)
+	if err != nil {
+		return nil, err
+	}
+	to, err := resolveFilterBlock(query.ToBlock, latest)
+	if err != nil {
+		return nil, err
+	}
+	if from > to {
+		return []*types.Log{}, nil
+	}
+	if err := a.checkRange(from, to); err != nil {
+		return nil, err
+	}
+
+	return a.collectLogs(ctx, &query, from, to)
+}
+
+// checkQuery checks the addresses and topics of a query against the limits
+func (a *FilterAPI) checkQuery(query *api.FilterQuery) error {
+	if len(query.Topics) > 4 {
+		return &api.RPCError{Code: api.ErrCodeInvalidParams, Message: fmt.Sprintf("too many topic positions: %d, max 4", len(query.Topics))}
+	}
+	if max := a.limits.MaxAddresses; max > 0 && len(query.Addresses) > max {
+		return limitError("max_addresses", max, len(query.Addresses), "too many addresses: %d, max %d", len(query.Addresses), max)
+	}
+	if max := a.limits.MaxTopics; max > 0 {
+		for i, topics := range query.Topics {
+			if len(topics) > max {
+				return limitError("max_topics", max, len(topics), "too many topics at position %d: %d, max %d", i, len(topics), max)
+			}
+		}
+	}
+	return nil
+}
+
+// checkRange checks the block range of a query against the limits
+func (a *FilterAPI) checkRange(from, to uint64) error {
+	if max := a.limits.MaxBlockRange; max > 0 && to-from+1 > max {
+		return limitError("max_block_range", max, to-from+1, "block range too large: %d blocks, max %d", to-from+1, max)
+	}
+	return nil
+}
+
+// limitError reports a query exceeding a limit, naming the limit and the
+// requested amount, if known, in the error data
+func limitError(limit string, max, requested interface{}, format string, args ...interface{}) *api.RPCError {
+	data := map[string]interface{}{
+		"limit": limit,
+		"max":   max,
+	}
+	if requested != nil {
+		data["requested"] = requested
+	}
+	return &api.RPCError{
+		Code:    api.ErrCodeLimitExceeded,
+		Message: fmt.Sprintf(format, args...),
+		Data:    data,
+	}
+}
@@ -0,0 +1,184 @@
+package eth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// defaultLogsPageSize is the number of logs per page when results are not
+// limited
+const defaultLogsPageSize = 10000
+
+// PagedLogsAPI provides evm_getLogsPaged, which walks log ranges of any size
+// in pages bounded by the limits of eth_getLogs
+type PagedLogsAPI struct {
+	filters *FilterAPI
+}
+
+// NewPagedLogsAPI creates a new PagedLogsAPI using the limits of filters
+func NewPagedLogsAPI(filters *FilterAPI) *PagedLogsAPI {
+	return &PagedLogsAPI{filters: filters}
+}
+
+// LogsPage is a page of logs. Cursor continues the query and is absent
+// once the range has been walked.
+type LogsPage struct {
+	Logs   []*types.Log `json:"logs"`
+	Cursor *string      `json:"cursor"`
+}
+
+// logsCursor is the position of a paged query: the log at which to resume
+// and the last block of the range, fixed by the first page so that later
+// pages do not follow the head
+type logsCursor struct {
+	Block uint64 `json:"block"`
+	Index uint   `json:"index"`
+	To    uint64 `json:"to"`
+	Query uint64 `json:"query"` // hash of the addresses and topics
+}
+
+// GetLogsPaged returns the first page of logs matching a query, or with a
+// cursor from a previous page the next one. A page ends once it holds as
+// many logs as max_results allows, spans max_block_range blocks or takes
+// the query time limit, so it never exceeds the limits of eth_getLogs.
+func (a *PagedLogsAPI) GetLogsPaged(ctx context.Context, query api.FilterQuery, cursor *string) (*LogsPage, error) {
+	f := a.filters
+	if query.BlockHash != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: "blockHash is not supported for paged queries"}
+	}
+	if err := f.checkQuery(&query); err != nil {
+		return nil, err
+	}
+
+	var pos logsCursor
+	if cursor != nil && *cursor != "" {
+		var err error
+		if pos, err = decodeLogsCursor(*cursor, &query); err != nil {
+			return nil, err
+		}
+	} else {
+		latest, err := f.blockReader.GetLatestBlockNumber(ctx)
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get latest block: %v", err)}
+		}
+		from, err := resolveFilterBlock(query.FromBlock, latest)
+		if err != nil {
+			return nil, err
+		}
+		to, err := resolveFilterBlock(query.ToBlock, latest)
+		if err != nil {
+			return nil, err
+		}
+		if from > to {
+			return &LogsPage{Logs: []*types.Log{}}, nil
+		}
+		pos = logsCursor{Block: from, To: to, Query: queryHash(&query)}
+	}
+
+	pageSize := defaultLogsPageSize
+	if f.limits.MaxResults > 0 {
+		pageSize = f.limits.MaxResults
+	}
+	end := pos.To
+	if max := f.limits.MaxBlockRange; max > 0 && end-pos.Block+1 > max {
+		end = pos.Block + max - 1
+	}
+	if f.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.limits.Timeout)
+		defer cancel()
+	}
+
+	page := &LogsPage{Logs: []*types.Log{}}
+	next := pos
+	filter := storage.LogFilter{Addresses: query.Addresses, Topics: query.Topics}
+scan:
+	for start := pos.Block; start <= end; start += logsChunkSize {
+		chunkEnd := min(start+logsChunkSize-1, end)
+		numbers, err := f.blockReader.MatchingBlocks(ctx, start, chunkEnd, filter)
+		var logs []*types.Log
+		if err == nil {
+			logs, err = f.blockReader.GetLogsBlocks(ctx, numbers)
+		}
+		if ctx.Err() == context.DeadlineExceeded && f.limits.Timeout > 0 {
+			// End the page with the chunks read so far
+			if next == pos {
+				return nil, limitError("timeout", f.limits.Timeout.String(), nil, "query timed out after %v", f.limits.Timeout)
+			}
+			break
+		}
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get logs for blocks %d-%d: %v", start, chunkEnd, err)}
+		}
+
+		for _, log := range logs {
+			if log.BlockNumber == pos.Block && log.Index < pos.Index {
+				continue
+			}
+			if !query.Matches(log) {
+				continue
+			}
+			if len(page.Logs) == pageSize {
+				next.Block, next.Index = log.BlockNumber, log.Index
+				break scan
+			}
+			page.Logs = append(page.Logs, log)
+		}
+		next.Block, next.Index = chunkEnd+1, 0
+
+		if chunkEnd == end {
+			break
+		}
+	}
+
+	if next.Block <= next.To {
+		encoded := encodeLogsCursor(next)
+		page.Cursor = &encoded
+	}
+	return page, nil
+}
+
+// encodeLogsCursor encodes a cursor as an opaque string
+func encodeLogsCursor(c logsCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeLogsCursor decodes a cursor, checking that it belongs to the query
+func decodeLogsCursor(s string, query *api.FilterQuery) (logsCursor, error) {
+	var c logsCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil || c.Block > c.To {
+		return logsCursor{}, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: "invalid cursor"}
+	}
+	if c.Query != queryHash(query) {
+		return logsCursor{}, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: "cursor does not belong to this query"}
+	}
+	return c, nil
+}
+
+// queryHash identifies the addresses and topics of a query, so that a
+// cursor is not continued with different criteria
+func queryHash(query *api.FilterQuery) uint64 {
+	h := fnv.New64a()
+	for _, address := range query.Addresses {
+		h.Write(address.Bytes())
+	}
+	for _, topics := range query.Topics {
+		h.Write([]byte{0})
+		for _, topic := range topics {
+			h.Write(topic.Bytes())
+		}
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,46 @@
+package eth
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// protocolVersion is the eth wire protocol version reported to clients
+const protocolVersion = 68
+
+// MiscAPI answers the node-identity methods that legacy clients probe on
+// connect, as a node that does not mine and holds no accounts would
+type MiscAPI struct{}
+
+// NewMiscAPI creates a new MiscAPI
+func NewMiscAPI() *MiscAPI {
+	return &MiscAPI{}
+}
+
+// Coinbase returns the zero address, as no blocks are mined
+func (a *MiscAPI) Coinbase(ctx context.Context) (common.Address, error) {
+	return common.Address{}, nil
+}
+
+// Mining returns false
+func (a *MiscAPI) Mining(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+// Hashrate returns 0
+func (a *MiscAPI) Hashrate(ctx context.Context) (hexutil.Uint64, error) {
+	return 0, nil
+}
+
+// ProtocolVersion returns the eth protocol version
+func (a *MiscAPI) ProtocolVersion(ctx context.Context) (hexutil.Uint, error) {
+	return protocolVersion, nil
+}
+
+// Accounts returns an empty list. With signing configured, AccountAPI
+// serves eth_accounts instead.
+func (a *MiscAPI) Accounts(ctx context.Context) ([]common.Address, error) {
+	return []common.Address{}, nil
+}
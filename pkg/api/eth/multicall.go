@@ -0,0 +1,166 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/evm"
+)
+
+// multicall3ABI is the aggregate3 method of the Multicall3 contract
+const multicall3ABI = `[{"name":"aggregate3","type":"function","stateMutability":"payable",
+	"inputs":[{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}]}],
+	"outputs":[{"name":"returnData","type":"tuple[]","components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}]}]}]`
+
+var multicall3, _ = abi.JSON(strings.NewReader(multicall3ABI))
+
+// multicall3Call is a call of aggregate3
+type multicall3Call struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+// multicall3Result is a result of aggregate3
+type multicall3Result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// MulticallAPI provides evm_multicall, which executes independent calls on
+// the same state in one request
+type MulticallAPI struct {
+	calls      *CallAPI
+	multicall3 *common.Address
+}
+
+// NewMulticallAPI creates a new MulticallAPI executing calls with calls.
+// multicall3 is the address of the Multicall3 contract, nil if none.
+func NewMulticallAPI(calls *CallAPI, multicall3 *common.Address) *MulticallAPI {
+	return &MulticallAPI{calls: calls, multicall3: multicall3}
+}
+
+// MulticallOptions are the options of evm_multicall
+type MulticallOptions struct {
+	// Multicall3 executes the calls through the Multicall3 contract, as
+	// client-side multicall does, if it is deployed
+	Multicall3 bool `json:"multicall3"`
+}
+
+// MulticallResult is the outcome of a call of evm_multicall. ReturnData is
+// the revert data of a failed call. GasUsed is absent for calls executed
+// through Multicall3.
+type MulticallResult struct {
+	Success    bool            `json:"success"`
+	ReturnData hexutil.Bytes   `json:"returnData"`
+	GasUsed    *hexutil.Uint64 `json:"gasUsed,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// Multicall executes calls on the state at a block, latest by default.
+// Unlike eth_callMany the calls do not see each other's changes: each runs
+// on the state of the block. Failed calls report their error; the others
+// still run.
+func (a *MulticallAPI) Multicall(ctx context.Context, calls []api.CallArgs, blockNrOrHash *api.BlockNumberOrHash, options *MulticallOptions) ([]*MulticallResult, error) {
+	if max := a.calls.maxBundleCalls; max > 0 && len(calls) > max {
+		return nil, limitError("max_bundle_calls", max, len(calls), "too many calls: %d, max %d", len(calls), max)
+	}
+
+	ctx, cancel := a.calls.executor.WithTimeout(ctx)
+	defer cancel()
+
+	header, state, err := a.calls.callState(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if options != nil && options.Multicall3 && a.multicall3 != nil {
+		deployed := state.GetCodeSize(*a.multicall3) > 0
+		if err := state.Error(); err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to read state: %v", err)}
+		}
+		if deployed {
+			return a.multicall3Calls(ctx, header, state, calls)
+		}
+	}
+
+	blockCtx := a.calls.executor.BlockContext(ctx, header)
+	results := make([]*MulticallResult, len(calls))
+	for i, args := range calls {
+		callState := state.Copy()
+		result, err := a.calls.execute(ctx, blockCtx, callState, args)
+		var rpcErr *api.RPCError
+		switch {
+		case errors.As(err, &rpcErr):
+			return nil, &api.RPCError{Code: rpcErr.Code, Message: fmt.Sprintf("call %d: %s", i, rpcErr.Message)}
+		case err != nil && (ctx.Err() != nil || callState.Error() != nil):
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: err.Error()}
+		case err != nil:
+			results[i] = &MulticallResult{Error: err.Error()}
+		default:
+			gasUsed := hexutil.Uint64(result.UsedGas)
+			results[i] = &MulticallResult{Success: !result.Failed(), ReturnData: result.ReturnData, GasUsed: &gasUsed}
+			if result.Failed() {
+				results[i].Error = callError(result).Message
+			}
+		}
+	}
+	return results, nil
+}
+
+// multicall3Calls executes calls in one aggregate3 call of Multicall3, so
+// that they see Multicall3 as their sender
+func (a *MulticallAPI) multicall3Calls(ctx context.Context, header *types.Header, state *evm.StateDB, calls []api.CallArgs) ([]*MulticallResult, error) {
+	aggregated := make([]multicall3Call, len(calls))
+	for i, args := range calls {
+		if args.To == nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: fmt.Sprintf("call %d: contract creation is not supported with multicall3", i)}
+		}
+		if args.Value != nil && args.Value.ToInt().Sign() != 0 {
+			return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: fmt.Sprintf("call %d: value is not supported with multicall3", i)}
+		}
+		aggregated[i] = multicall3Call{Target: *args.To, AllowFailure: true}
+		if args.Data != nil {
+			aggregated[i].CallData = *args.Data
+		}
+	}
+	input, err := multicall3.Pack("aggregate3", aggregated)
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: err.Error()}
+	}
+
+	data := hexutil.Bytes(input)
+	result, err := a.calls.execute(ctx, a.calls.executor.BlockContext(ctx, header), state, api.CallArgs{To: a.multicall3, Data: &data})
+	if err != nil {
+		return nil, executionError(ctx, state, err)
+	}
+	if result.Failed() {
+		return nil, callError(result)
+	}
+	out, err := multicall3.Unpack("aggregate3", result.ReturnData)
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeExecutionFailed, Message: fmt.Sprintf("failed to decode multicall3 result: %v", err)}
+	}
+	aggregatedResults := *abi.ConvertType(out[0], new([]multicall3Result)).(*[]multicall3Result)
+	if len(aggregatedResults) != len(calls) {
+		return nil, &api.RPCError{Code: api.ErrCodeExecutionFailed, Message: fmt.Sprintf("multicall3 returned %d results for %d calls", len(aggregatedResults), len(calls))}
+	}
+
+	results := make([]*MulticallResult, len(calls))
+	for i, r := range aggregatedResults {
+		results[i] = &MulticallResult{Success: r.Success, ReturnData: r.ReturnData}
+		if !r.Success {
+			results[i].Error = "execution reverted"
+			if len(r.ReturnData) > 0 {
+				results[i].Error = api.NewRevertError(r.ReturnData).Message
+			}
+		}
+	}
+	return results, nil
+}
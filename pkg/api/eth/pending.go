@@ -0,0 +1,183 @@
+package eth
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/forks"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// SetTxPool makes the pending block be assembled from the pool's
+// executable transactions instead of resolving to the latest block
+func (a *BlockAPI) SetTxPool(txPool *storage.TxPoolStorage, stateReader *storage.StateReader) {
+	a.txPool = txPool
+	a.stateReader = stateReader
+}
+
+// pendingBlock returns the block the pool's transactions would form on top
+// of the latest block. Without executing them its state and receipts are
+// unknown, so the roots, bloom and gas used are left empty and, as in geth,
+// the hash and nonce are null.
+func (a *BlockAPI) pendingBlock(ctx context.Context, fullTx bool) (*api.RPCBlock, error) {
+	number, err := a.blockReader.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := a.blockReader.GetHeader(ctx, number)
+	if err == storage.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get block: %v", err)}
+	}
+
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		UncleHash:  types.EmptyUncleHash,
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		Difficulty: new(big.Int),
+		GasLimit:   parent.GasLimit,
+		Time:       max(uint64(time.Now().Unix()), parent.Time+1),
+		BaseFee:    forks.NextBaseFee(a.chainConfig, parent),
+	}
+
+	txs, err := a.pendingTransactions(ctx, header.BaseFee, header.GasLimit)
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get pending transactions: %v", err)}
+	}
+
+	block := types.NewBlockWithHeader(header).WithBody(txs, nil)
+	result := api.NewRPCBlock(block, fullTx, nil, a.chainConfig)
+	result.Hash = nil
+	result.Nonce = nil
+	if full, ok := result.Transactions.([]*api.RPCTransaction); ok {
+		for _, tx := range full {
+			tx.BlockHash = nil
+		}
+	}
+	return result, nil
+}
+
+// pendingTransactions selects the pool transactions for the pending block:
+// per sender in nonce order from its account nonce, across senders by
+// effective tip, until the gas limit is reached
+func (a *BlockAPI) pendingTransactions(ctx context.Context, baseFee *big.Int, gasLimit uint64) (types.Transactions, error) {
+	pooled, err := a.txPool.GetPendingTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bySender := make(map[common.Address]types.Transactions)
+	for _, tx := range pooled {
+		from, err := a.txPool.Sender(tx)
+		if err != nil {
+			continue
+		}
+		bySender[from] = append(bySender[from], tx)
+	}
+
+	heads := make(txsByTip, 0, len(bySender))
+	for from, txs := range bySender {
+		nonce, err := a.stateReader.GetNonce(ctx, from, "latest")
+		if err != nil {
+			return nil, err
+		}
+		txs = executable(txs, nonce)
+		if len(txs) == 0 || txs[0].GasFeeCapIntCmp(baseFeeOrZero(baseFee)) < 0 {
+			continue
+		}
+		heads = append(heads, &senderTxs{txs: txs, tip: effectiveTip(txs[0], baseFee)})
+	}
+	heap.Init(&heads)
+
+	var (
+		selected types.Transactions
+		gasLeft  = gasLimit
+	)
+	for heads.Len() > 0 {
+		head := heads[0]
+		tx := head.txs[0]
+		if tx.Gas() > gasLeft {
+			// Later nonces of the sender cannot be included either
+			heap.Pop(&heads)
+			continue
+		}
+		selected = append(selected, tx)
+		gasLeft -= tx.Gas()
+
+		head.txs = head.txs[1:]
+		if len(head.txs) == 0 || head.txs[0].GasFeeCapIntCmp(baseFeeOrZero(baseFee)) < 0 {
+			heap.Pop(&heads)
+			continue
+		}
+		head.tip = effectiveTip(head.txs[0], baseFee)
+		heap.Fix(&heads, 0)
+	}
+	return selected, nil
+}
+
+// executable returns a sender's transactions that follow its account nonce
+// without a gap, in nonce order
+func executable(txs types.Transactions, nonce uint64) types.Transactions {
+	sort.Slice(txs, func(i, j int) bool { return txs[i].Nonce() < txs[j].Nonce() })
+	var result types.Transactions
+	for _, tx := range txs {
+		if tx.Nonce() < nonce {
+			continue
+		}
+		if tx.Nonce() > nonce {
+			break
+		}
+		result = append(result, tx)
+		nonce++
+	}
+	return result
+}
+
+// effectiveTip returns the tip a transaction pays at a base fee
+func effectiveTip(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	tip, err := tx.EffectiveGasTip(baseFee)
+	if err != nil {
+		return new(big.Int)
+	}
+	return tip
+}
+
+// baseFeeOrZero returns the base fee, or zero before London
+func baseFeeOrZero(baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return common.Big0
+	}
+	return baseFee
+}
+
+// senderTxs are the executable transactions of a sender, keyed by the tip
+// of the next one
+type senderTxs struct {
+	txs types.Transactions
+	tip *big.Int
+}
+
+// txsByTip is a max-heap of senders by the tip of their next transaction
+type txsByTip []*senderTxs
+
+func (h txsByTip) Len() int           { return len(h) }
+func (h txsByTip) Less(i, j int) bool { return h[i].tip.Cmp(h[j].tip) > 0 }
+func (h txsByTip) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *txsByTip) Push(x interface{}) { *h = append(*h, x.(*senderTxs)) }
+
+func (h *txsByTip) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,169 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// defaultMaxSendBatch bounds the transactions of eth_sendRawTransactions
+// until SetMaxSendBatch is called
+const defaultMaxSendBatch = 100
+
+// SetMaxSendBatch limits the transactions of an eth_sendRawTransactions
+// call; 0 is unlimited. It must be called before serving.
+func (a *TxPoolAPI) SetMaxSendBatch(max int) {
+	a.maxSendBatch = max
+}
+
+// SendRawTransactionsOptions configures eth_sendRawTransactions
+type SendRawTransactionsOptions struct {
+	// Atomic enqueues none of the transactions unless all of them pass
+	// validation and are accepted by the pool
+	Atomic bool `json:"atomic"`
+}
+
+// SendRawTransactionResult is the outcome of one transaction of
+// eth_sendRawTransactions: its hash if it was pooled, the error otherwise
+type SendRawTransactionResult struct {
+	Hash  *common.Hash  `json:"hash,omitempty"`
+	Error *api.RPCError `json:"error,omitempty"`
+}
+
+// errBatchRejected answers the valid transactions of an atomic batch that
+// was not enqueued
+var errBatchRejected = &api.RPCError{
+	Code:    api.ErrCodeTransactionReject,
+	Message: "batch rejected: another transaction is invalid",
+	Data:    map[string]string{"reason": "batch_rejected"},
+}
+
+// errBatchRolledBack answers the transactions of an atomic batch that were
+// pooled and removed again because the pool refused another one
+var errBatchRolledBack = &api.RPCError{
+	Code:    api.ErrCodeTransactionReject,
+	Message: "batch rolled back: the pool refused another transaction",
+	Data:    map[string]string{"reason": "batch_rolled_back"},
+}
+
+// SendRawTransactions submits many raw transactions in one call, for
+// clients that would otherwise send hundreds of eth_sendRawTransaction
+// calls, and returns the outcome of each in order. All transactions are
+// validated against the same head before any is enqueued. Atomic batches
+// are dropped entirely if one is invalid, and rolled back if the pool
+// refuses one. This is a non-standard extension.
+func (a *TxPoolAPI) SendRawTransactions(ctx context.Context, inputs []hexutil.Bytes, options *SendRawTransactionsOptions) ([]*SendRawTransactionResult, error) {
+	if max := a.maxSendBatch; max > 0 && len(inputs) > max {
+		return nil, limitError("max_send_batch", max, len(inputs), "too many transactions: %d, max %d", len(inputs), max)
+	}
+	atomic := options != nil && options.Atomic
+
+	results := make([]*SendRawTransactionResult, len(inputs))
+	txs := make([]*types.Transaction, len(inputs))
+	head := a.head(ctx)
+	valid := true
+	for i, input := range inputs {
+		results[i] = &SendRawTransactionResult{}
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(input, tx); err != nil {
+			results[i].Error = &api.RPCError{Code: api.ErrCodeInvalidInput, Message: fmt.Sprintf("invalid transaction: %v", err)}
+			valid = false
+			continue
+		}
+		if err := a.validate(ctx, tx, head); err != nil {
+			// Nothing is pooled yet, so storage failures fail the call
+			if err.Code == api.ErrCodeInternal {
+				return nil, err
+			}
+			results[i].Error = err
+			valid = false
+			continue
+		}
+		txs[i] = tx
+	}
+
+	var pooled []pooledTx
+	for i, tx := range txs {
+		if tx == nil {
+			continue
+		}
+		if atomic && !valid {
+			results[i].Error = errBatchRejected
+			continue
+		}
+		var replaced *types.Transaction
+		if atomic {
+			replaced = a.pendingWithNonce(ctx, tx)
+		}
+		// Some may be pooled already, so failures are reported per item
+		if err := a.enqueue(ctx, tx); err != nil {
+			results[i].Error = err
+			if atomic {
+				// The rest is not enqueued and the pooled ones are removed
+				valid = false
+				a.rollback(context.WithoutCancel(ctx), pooled)
+				for _, p := range pooled {
+					results[p.index] = &SendRawTransactionResult{Error: errBatchRolledBack}
+				}
+			}
+			continue
+		}
+		hash := tx.Hash()
+		results[i].Hash = &hash
+		pooled = append(pooled, pooledTx{index: i, tx: tx, replaced: replaced})
+	}
+	return results, nil
+}
+
+// pooledTx is a transaction of an atomic batch that entered the pool,
+// with the pending transaction it replaced, if any
+type pooledTx struct {
+	index    int
+	tx       *types.Transaction
+	replaced *types.Transaction
+}
+
+// pendingWithNonce returns the pending transaction that tx would replace,
+// or nil
+func (a *TxPoolAPI) pendingWithNonce(ctx context.Context, tx *types.Transaction) *types.Transaction {
+	from, err := a.txPool.Sender(tx)
+	if err != nil {
+		return nil
+	}
+	pending, err := a.txPool.GetAddressTransactions(ctx, from)
+	if err != nil {
+		return nil
+	}
+	for _, p := range pending {
+		if p.Nonce() == tx.Nonce() && p.Hash() != tx.Hash() {
+			return p
+		}
+	}
+	return nil
+}
+
+// rollback removes the pooled transactions of an atomic batch, newest
+// first, and restores the transactions they replaced. Subscribers have
+// seen them arrive, so they are dropped with pool:dropped events.
+func (a *TxPoolAPI) rollback(ctx context.Context, pooled []pooledTx) {
+	for i := len(pooled) - 1; i >= 0; i-- {
+		p := pooled[i]
+		if err := a.txPool.DropTx(ctx, p.tx.Hash(), storage.DropRolledBack); err != nil {
+			logger.Warnf("Failed to roll back tx %s of an atomic batch: %v", p.tx.Hash().Hex(), err)
+			continue
+		}
+		if p.replaced == nil {
+			continue
+		}
+		if err := a.txPool.AddPendingTx(ctx, p.replaced, "rpc"); err != nil {
+			logger.Warnf("Failed to restore tx %s replaced by an atomic batch: %v", p.replaced.Hash().Hex(), err)
+		}
+	}
+}
@@ -3,9 +3,12 @@ package eth
 import (
 	"context"
 	"fmt"
+	"math/big"
+	"strconv"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/sunvim/evm_rpc/pkg/api"
 	"github.com/sunvim/evm_rpc/pkg/storage"
 )
@@ -45,15 +48,71 @@ func (a *StateAPI) resolveBlockNumber(ctx context.Context, blockNr api.BlockNumb
 	return fmt.Sprintf("%d", num), nil
 }
 
-// GetBalance returns the balance of an account at a given block
-func (a *StateAPI) GetBalance(ctx context.Context, address common.Address, blockNr string) (*hexutil.Big, error) {
-	// Parse block number
-	bn, err := api.ParseBlockNumber(blockNr)
+// resolveBlock resolves an EIP-1898 block parameter to a block number
+// string. Blocks addressed by hash must be canonical since state is only
+// kept for the canonical chain.
+func (a *StateAPI) resolveBlock(ctx context.Context, block api.BlockNumberOrHash) (string, error) {
+	if block.BlockHash == nil {
+		bn := api.LatestBlockNumber
+		if block.BlockNumber != nil {
+			bn = *block.BlockNumber
+		}
+		blockNumStr, err := a.resolveBlockNumber(ctx, bn)
+		if err != nil {
+			return "", err
+		}
+		return blockNumStr, a.checkPruned(ctx, blockNumStr)
+	}
+
+	hash := *block.BlockHash
+	number, err := a.blockReader.GetBlockNumberByHash(ctx, hash)
+	if err == storage.ErrNotFound {
+		return "", &api.RPCError{Code: api.ErrCodeUnknownBlock, Message: fmt.Sprintf("header for hash %s not found", hash.Hex())}
+	}
 	if err != nil {
-		return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: fmt.Sprintf("invalid block number: %v", err)}
+		return "", &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get block number: %v", err)}
+	}
+
+	canonical, err := a.blockReader.IsCanonical(ctx, hash, number)
+	if err != nil && err != storage.ErrNotFound {
+		return "", &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to check canonical chain: %v", err)}
+	}
+	if !canonical {
+		if block.RequireCanonical {
+			return "", &api.RPCError{Code: api.ErrCodeUnknownBlock, Message: fmt.Sprintf("hash %s is not currently canonical", hash.Hex())}
+		}
+		return "", &api.RPCError{Code: api.ErrCodeResourceUnavail, Message: fmt.Sprintf("state of non-canonical block %s is not available", hash.Hex())}
 	}
 
-	blockNumStr, err := a.resolveBlockNumber(ctx, bn)
+	blockNumStr := fmt.Sprintf("%d", number)
+	return blockNumStr, a.checkPruned(ctx, blockNumStr)
+}
+
+// checkPruned rejects historical blocks whose state has been pruned with the
+// error geth returns for missing state
+func (a *StateAPI) checkPruned(ctx context.Context, blockNumStr string) error {
+	number, err := strconv.ParseUint(blockNumStr, 10, 64)
+	if err != nil {
+		// latest and pending are never pruned
+		return nil
+	}
+
+	pruned, err := a.stateReader.GetPrunedBlock(ctx)
+	if err == storage.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get pruned block: %v", err)}
+	}
+	if number <= pruned {
+		return &api.RPCError{Code: api.ErrCodeUnknownBlock, Message: fmt.Sprintf("missing trie node: state at block %d is pruned, oldest available is %d", number, pruned+1)}
+	}
+	return nil
+}
+
+// GetBalance returns the balance of an account at a given block
+func (a *StateAPI) GetBalance(ctx context.Context, address common.Address, blockNrOrHash api.BlockNumberOrHash) (*hexutil.Big, error) {
+	blockNumStr, err := a.resolveBlock(ctx, blockNrOrHash)
 	if err != nil {
 		return nil, err
 	}
@@ -67,14 +126,8 @@ func (a *StateAPI) GetBalance(ctx context.Context, address common.Address, block
 }
 
 // GetCode returns the code of an account at a given block
-func (a *StateAPI) GetCode(ctx context.Context, address common.Address, blockNr string) (hexutil.Bytes, error) {
-	// Parse block number
-	bn, err := api.ParseBlockNumber(blockNr)
-	if err != nil {
-		return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: fmt.Sprintf("invalid block number: %v", err)}
-	}
-
-	blockNumStr, err := a.resolveBlockNumber(ctx, bn)
+func (a *StateAPI) GetCode(ctx context.Context, address common.Address, blockNrOrHash api.BlockNumberOrHash) (hexutil.Bytes, error) {
+	blockNumStr, err := a.resolveBlock(ctx, blockNrOrHash)
 	if err != nil {
 		return nil, err
 	}
@@ -88,14 +141,8 @@ func (a *StateAPI) GetCode(ctx context.Context, address common.Address, blockNr
 }
 
 // GetStorageAt returns the storage value at a given key for an account at a given block
-func (a *StateAPI) GetStorageAt(ctx context.Context, address common.Address, key common.Hash, blockNr string) (hexutil.Bytes, error) {
-	// Parse block number
-	bn, err := api.ParseBlockNumber(blockNr)
-	if err != nil {
-		return nil, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: fmt.Sprintf("invalid block number: %v", err)}
-	}
-
-	blockNumStr, err := a.resolveBlockNumber(ctx, bn)
+func (a *StateAPI) GetStorageAt(ctx context.Context, address common.Address, key common.Hash, blockNrOrHash api.BlockNumberOrHash) (hexutil.Bytes, error) {
+	blockNumStr, err := a.resolveBlock(ctx, blockNrOrHash)
 	if err != nil {
 		return nil, err
 	}
@@ -112,15 +159,45 @@ func (a *StateAPI) GetStorageAt(ctx context.Context, address common.Address, key
 	return result, nil
 }
 
-// GetTransactionCount returns the nonce of an account at a given block
-func (a *StateAPI) GetTransactionCount(ctx context.Context, address common.Address, blockNr string) (hexutil.Uint64, error) {
-	// Parse block number
-	bn, err := api.ParseBlockNumber(blockNr)
+// GetAccount returns the code hash, balance and nonce of an account at a
+// given block in one call. Accounts that do not exist are empty.
+func (a *StateAPI) GetAccount(ctx context.Context, address common.Address, blockNrOrHash api.BlockNumberOrHash) (*api.AccountResult, error) {
+	blockNumStr, err := a.resolveBlock(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := a.stateReader.GetAccountState(ctx, address, blockNumStr)
 	if err != nil {
-		return 0, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: fmt.Sprintf("invalid block number: %v", err)}
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get account: %v", err)}
 	}
 
-	blockNumStr, err := a.resolveBlockNumber(ctx, bn)
+	return newAccountResult(state), nil
+}
+
+// newAccountResult converts a stored account state
+func newAccountResult(state *storage.AccountState) *api.AccountResult {
+	result := &api.AccountResult{
+		CodeHash: types.EmptyCodeHash,
+		Balance:  (*hexutil.Big)(new(big.Int)),
+		Nonce:    hexutil.Uint64(state.Nonce),
+	}
+	if hash := common.HexToHash(state.CodeHash); state.CodeHash != "" && hash != (common.Hash{}) {
+		result.CodeHash = hash
+	}
+	if state.Balance != nil {
+		result.Balance = (*hexutil.Big)(new(big.Int).Set(state.Balance))
+	}
+	if result.CodeHash == types.EmptyCodeHash {
+		root := types.EmptyRootHash
+		result.StorageRoot = &root
+	}
+	return result
+}
+
+// GetTransactionCount returns the nonce of an account at a given block
+func (a *StateAPI) GetTransactionCount(ctx context.Context, address common.Address, blockNrOrHash api.BlockNumberOrHash) (hexutil.Uint64, error) {
+	blockNumStr, err := a.resolveBlock(ctx, blockNrOrHash)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,132 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// defaultMaxStateBatch bounds the addresses and storage slots of a batched
+// state query until SetMaxBatch is called
+const defaultMaxStateBatch = 1000
+
+// BatchStateAPI provides evm_getBalances and evm_getAccounts, which read
+// the state of many accounts in one request, for portfolio trackers that
+// would otherwise send large JSON-RPC batches
+type BatchStateAPI struct {
+	state    *StateAPI
+	maxBatch int
+}
+
+// NewBatchStateAPI creates a new BatchStateAPI
+func NewBatchStateAPI(blockReader *storage.BlockReader, stateReader *storage.StateReader, chainID uint64) *BatchStateAPI {
+	return &BatchStateAPI{
+		state:    NewStateAPI(blockReader, stateReader, chainID),
+		maxBatch: defaultMaxStateBatch,
+	}
+}
+
+// SetMaxBatch limits the addresses plus storage slots of a request; 0 is
+// unlimited. It must be called before serving.
+func (a *BatchStateAPI) SetMaxBatch(max int) {
+	a.maxBatch = max
+}
+
+// AccountQuery is an account of evm_getAccounts and the storage slots to
+// read from it
+type AccountQuery struct {
+	Address     common.Address `json:"address"`
+	StorageKeys []common.Hash  `json:"storageKeys"`
+}
+
+// BatchAccountResult is an account returned by evm_getAccounts
+type BatchAccountResult struct {
+	Address  common.Address              `json:"address"`
+	Balance  *hexutil.Big                `json:"balance"`
+	Nonce    hexutil.Uint64              `json:"nonce"`
+	CodeHash common.Hash                 `json:"codeHash"`
+	Storage  map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// GetBalances returns the balances of accounts at a block, indexed like
+// addresses
+func (a *BatchStateAPI) GetBalances(ctx context.Context, addresses []common.Address, blockNrOrHash api.BlockNumberOrHash) ([]*hexutil.Big, error) {
+	if err := a.checkBatch(len(addresses)); err != nil {
+		return nil, err
+	}
+	blockNumStr, err := a.state.resolveBlock(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := a.state.stateReader.GetAccountStates(ctx, addresses, blockNumStr)
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get accounts: %v", err)}
+	}
+	balances := make([]*hexutil.Big, len(states))
+	for i, state := range states {
+		balances[i] = (*hexutil.Big)(state.Balance)
+	}
+	return balances, nil
+}
+
+// GetAccounts returns the balance, nonce, code hash and requested storage
+// slots of accounts at a block, indexed like queries
+func (a *BatchStateAPI) GetAccounts(ctx context.Context, queries []AccountQuery, blockNrOrHash api.BlockNumberOrHash) ([]*BatchAccountResult, error) {
+	addresses := make([]common.Address, len(queries))
+	var slots []storage.StorageSlot
+	for i, query := range queries {
+		addresses[i] = query.Address
+		for _, key := range query.StorageKeys {
+			slots = append(slots, storage.StorageSlot{Address: query.Address, Key: key})
+		}
+	}
+	if err := a.checkBatch(len(addresses) + len(slots)); err != nil {
+		return nil, err
+	}
+	blockNumStr, err := a.state.resolveBlock(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := a.state.stateReader.GetAccountStates(ctx, addresses, blockNumStr)
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get accounts: %v", err)}
+	}
+	values, err := a.state.stateReader.GetStorageSlots(ctx, slots, blockNumStr)
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get storage: %v", err)}
+	}
+
+	results := make([]*BatchAccountResult, len(queries))
+	for i, query := range queries {
+		account := newAccountResult(states[i])
+		result := &BatchAccountResult{
+			Address:  query.Address,
+			Balance:  account.Balance,
+			Nonce:    account.Nonce,
+			CodeHash: account.CodeHash,
+		}
+		if len(query.StorageKeys) > 0 {
+			result.Storage = make(map[common.Hash]common.Hash, len(query.StorageKeys))
+			for _, key := range query.StorageKeys {
+				result.Storage[key] = values[0]
+				values = values[1:]
+			}
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// checkBatch enforces the batch limit
+func (a *BatchStateAPI) checkBatch(n int) error {
+	if max := a.maxBatch; max > 0 && n > max {
+		return limitError("max_state_batch", max, n, "too many accounts and storage slots: %d, max %d", n, max)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// SyncAPI provides the chain ID and sync status RPC methods
+type SyncAPI struct {
+	blockReader *storage.BlockReader
+	chainID     uint64
+}
+
+// NewSyncAPI creates a new SyncAPI
+func NewSyncAPI(blockReader *storage.BlockReader, chainID uint64) *SyncAPI {
+	return &SyncAPI{
+		blockReader: blockReader,
+		chainID:     chainID,
+	}
+}
+
+// ChainId returns the chain ID used to sign transactions (EIP-155)
+func (a *SyncAPI) ChainId(ctx context.Context) (hexutil.Uint64, error) {
+	return hexutil.Uint64(a.chainID), nil
+}
+
+// Syncing returns false when the indexer is caught up, or an object
+// describing the catch-up progress otherwise
+func (a *SyncAPI) Syncing(ctx context.Context) (interface{}, error) {
+	status, err := a.blockReader.GetSyncStatus(ctx, storage.DefaultSyncLagThreshold)
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get sync status: %v", err)}
+	}
+
+	if !status.Syncing {
+		return false, nil
+	}
+
+	return api.NewRPCSyncStatus(status.StartingBlock, status.CurrentBlock, status.HighestBlock), nil
+}
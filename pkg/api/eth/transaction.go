@@ -49,13 +49,13 @@ func (a *TransactionAPI) GetTransactionByHash(ctx context.Context, txHash common
 	}
 
 	// Get lookup information
-	lookup, err := a.txReader.GetTransactionLookup(ctx, txHash)
-	if err == storage.ErrNotFound {
-		// Transaction exists but not yet included in a block
-		return api.NewRPCPendingTransaction(tx), nil
-	}
+	lookup, err := a.minedLookup(ctx, txHash)
 	if err != nil {
-		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get transaction lookup: %v", err)}
+		return nil, err
+	}
+	if lookup == nil {
+		// Transaction exists but not yet included in a served block
+		return api.NewRPCPendingTransaction(tx), nil
 	}
 
 	blockHash := common.HexToHash(lookup.BlockHash)
@@ -110,19 +110,36 @@ func (a *TransactionAPI) GetTransactionByBlockNumberAndIndex(ctx context.Context
 	return api.NewRPCTransaction(tx, header.Hash(), number, uint64(index)), nil
 }
 
-// GetTransactionReceipt returns a transaction receipt by hash
+// GetTransactionReceipt returns the receipt of a mined transaction.
+// Pending transactions, whether in the pool or in a block that is not
+// served yet, and unknown ones have no receipt and yield null, as in geth.
 func (a *TransactionAPI) GetTransactionReceipt(ctx context.Context, txHash common.Hash) (*api.RPCReceipt, error) {
-	// Get receipt and lookup
-	receipt, lookup, err := a.txReader.GetReceipt(ctx, txHash)
+	lookup, err := a.minedLookup(ctx, txHash)
+	if lookup == nil || err != nil {
+		return nil, err
+	}
+
+	receipt, err := a.txReader.GetReceiptByLookup(ctx, lookup)
 	if err == storage.ErrNotFound {
+		// The receipts of the block are still being written
 		return nil, nil
 	}
 	if err != nil {
 		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get receipt: %v", err)}
 	}
 
-	// Get transaction
+	// The transaction is indexed by hash with its block; the body of the
+	// block holds it all the same
 	tx, err := a.txReader.GetTransaction(ctx, txHash)
+	if err == storage.ErrNotFound {
+		tx, err = a.txReader.GetTransactionByBlockNumberAndIndex(ctx, lookup.BlockNumber, lookup.Index)
+		if err == nil && tx.Hash() != txHash {
+			err = storage.ErrNotFound
+		}
+	}
+	if err == storage.ErrNotFound {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get transaction: %v", err)}
 	}
@@ -131,9 +148,32 @@ func (a *TransactionAPI) GetTransactionReceipt(ctx context.Context, txHash commo
 	return api.NewRPCReceipt(receipt, tx, blockHash, lookup.BlockNumber, lookup.Index), nil
 }
 
-// GetTransactionCount returns the nonce of an account at a given block
-func (a *TransactionAPI) GetTransactionCount(ctx context.Context, address common.Address, blockNr string) (hexutil.Uint64, error) {
-	// This is handled by StateAPI, but included here for reference
-	// In practice, this would call the state reader
-	return 0, &api.RPCError{Code: api.ErrCodeMethodNotSupported, Message: "use StateAPI.GetTransactionCount"}
+// minedLookup returns where a transaction was mined, or nil while it is
+// pending: not in a block yet, or in one past the latest block or no
+// longer canonical, as while a block is ingested or reorged out
+func (a *TransactionAPI) minedLookup(ctx context.Context, txHash common.Hash) (*storage.TxLookup, error) {
+	lookup, err := a.txReader.GetTransactionLookup(ctx, txHash)
+	if err == storage.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get transaction lookup: %v", err)}
+	}
+
+	latest, err := a.blockReader.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get latest block: %v", err)}
+	}
+	if lookup.BlockNumber > latest {
+		return nil, nil
+	}
+
+	canonical, err := a.blockReader.IsCanonical(ctx, common.HexToHash(lookup.BlockHash), lookup.BlockNumber)
+	if err != nil && err != storage.ErrNotFound {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to check canonical chain: %v", err)}
+	}
+	if !canonical {
+		return nil, nil
+	}
+	return lookup, nil
 }
@@ -0,0 +1,208 @@
+package eth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+const testChainID = 1337
+
+var testTo = common.HexToAddress("0x000000000000000000000000000000000000dead")
+
+// testChain writes blocks of signed transfers to in-memory storage
+type testChain struct {
+	t      *testing.T
+	client *storage.PikaClient
+	writer *storage.BlockWriter
+	key    *ecdsa.PrivateKey
+	nonce  uint64
+}
+
+func newTestChain(t *testing.T) *testChain {
+	client, err := storage.NewPikaClient(config.PikaConfig{Mode: config.PikaModeMemory})
+	if err != nil {
+		t.Fatalf("NewPikaClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testChain{t: t, client: client, writer: storage.NewBlockWriter(client), key: key}
+}
+
+// tx signs the next transfer of the chain's sender
+func (c *testChain) tx() *types.Transaction {
+	c.t.Helper()
+	tx, err := types.SignNewTx(c.key, types.LatestSignerForChainID(big.NewInt(testChainID)), &types.DynamicFeeTx{
+		ChainID:   big.NewInt(testChainID),
+		Nonce:     c.nonce,
+		GasTipCap: big.NewInt(1e9),
+		GasFeeCap: big.NewInt(2e9),
+		Gas:       21000,
+		To:        &testTo,
+		Value:     big.NewInt(1),
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.nonce++
+	return tx
+}
+
+// writeBlock writes a block of txs at a height, with a successful receipt
+// for each. extra tells apart blocks of the same height.
+func (c *testChain) writeBlock(number uint64, extra string, txs ...*types.Transaction) *types.Block {
+	c.t.Helper()
+	header := &types.Header{
+		UncleHash:  types.EmptyUncleHash,
+		Root:       types.EmptyRootHash,
+		Number:     new(big.Int).SetUint64(number),
+		GasLimit:   30_000_000,
+		GasUsed:    21000 * uint64(len(txs)),
+		Difficulty: new(big.Int),
+		Extra:      []byte(extra),
+		BaseFee:    big.NewInt(1e9),
+	}
+	receipts := make(types.Receipts, len(txs))
+	for i, tx := range txs {
+		receipts[i] = &types.Receipt{
+			Type:              tx.Type(),
+			Status:            types.ReceiptStatusSuccessful,
+			CumulativeGasUsed: 21000 * uint64(i+1),
+		}
+	}
+	block := types.NewBlockWithHeader(header).WithBody(txs, nil)
+	if err := c.writer.WriteBlock(context.Background(), block, receipts, nil); err != nil {
+		c.t.Fatalf("WriteBlock: %v", err)
+	}
+	return block
+}
+
+func (c *testChain) setHead(block *types.Block) {
+	c.t.Helper()
+	if err := c.writer.SetHead(context.Background(), block.NumberU64(), block.Hash()); err != nil {
+		c.t.Fatalf("SetHead: %v", err)
+	}
+}
+
+func TestGetTransactionReceipt(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain(t)
+	api := NewTransactionAPI(storage.NewBlockReader(chain.client), storage.NewTransactionReader(chain.client), testChainID)
+	pool := storage.NewTxPoolStorage(chain.client, config.TxPoolConfig{}, testChainID)
+
+	// Block 1 is the head; block 2 is written but not served yet
+	mined := chain.tx()
+	head := chain.writeBlock(1, "", mined)
+	chain.setHead(head)
+	ahead := chain.tx()
+	chain.writeBlock(2, "", ahead)
+
+	// A block reorged out at height 1 keeps its lookups until removed
+	reorged := chain.tx()
+	chain.writeBlock(1, "reorged", reorged)
+	chain.writeBlock(1, "", mined)
+
+	// A block whose receipts are not written yet
+	unreceipted := chain.tx()
+	chain.writeBlock(3, "", unreceipted)
+	if err := chain.client.Del(ctx, "blk:rcpt:3"); err != nil {
+		t.Fatalf("Del: %v", err)
+	}
+
+	pending := chain.tx()
+	if err := pool.AddPendingTx(ctx, pending, "test"); err != nil {
+		t.Fatalf("AddPendingTx: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		hash common.Hash
+		head uint64 // latest block at the time of the lookup
+		want bool
+	}{
+		{"unknown", common.Hash{0x01}, 1, false},
+		{"pending in pool", pending.Hash(), 1, false},
+		{"past latest block", ahead.Hash(), 1, false},
+		{"not canonical", reorged.Hash(), 1, false},
+		{"receipts not written", unreceipted.Hash(), 3, false},
+		{"mined", mined.Hash(), 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := chain.writer.SetLatest(ctx, tt.head); err != nil {
+				t.Fatalf("SetLatest: %v", err)
+			}
+			receipt, err := api.GetTransactionReceipt(ctx, tt.hash)
+			if err != nil {
+				t.Fatalf("GetTransactionReceipt: %v", err)
+			}
+			if !tt.want {
+				if receipt != nil {
+					t.Fatalf("receipt = %+v, want null", receipt)
+				}
+				return
+			}
+			if receipt == nil {
+				t.Fatal("receipt is null")
+			}
+			if receipt.TransactionHash != tt.hash || receipt.BlockHash != head.Hash() || receipt.Status == nil || *receipt.Status != 1 {
+				t.Fatalf("receipt = %+v", receipt)
+			}
+			if from := crypto.PubkeyToAddress(chain.key.PublicKey); receipt.From != from {
+				t.Fatalf("receipt from = %s, want %s", receipt.From, from)
+			}
+		})
+	}
+}
+
+func TestGetTransactionByHashPending(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain(t)
+	api := NewTransactionAPI(storage.NewBlockReader(chain.client), storage.NewTransactionReader(chain.client), testChainID)
+
+	mined := chain.tx()
+	head := chain.writeBlock(1, "", mined)
+	chain.setHead(head)
+	ahead := chain.tx()
+	chain.writeBlock(2, "", ahead)
+
+	tests := []struct {
+		name  string
+		hash  common.Hash
+		block string // block number of the result, "" for null
+	}{
+		{"unknown", common.Hash{0x01}, ""},
+		{"past latest block", ahead.Hash(), "pending"},
+		{"mined", mined.Hash(), "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := api.GetTransactionByHash(ctx, tt.hash)
+			if err != nil {
+				t.Fatalf("GetTransactionByHash: %v", err)
+			}
+			got := ""
+			switch {
+			case tx == nil:
+			case tx.BlockNumber == nil:
+				got = "pending"
+			default:
+				got = tx.BlockNumber.ToInt().String()
+			}
+			if got != tt.block {
+				t.Fatalf("block number = %q, want %q", got, tt.block)
+			}
+		})
+	}
+}
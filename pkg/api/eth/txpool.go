@@ -3,103 +3,277 @@ package eth
 import (
 	"context"
 	"fmt"
-	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/middleware"
 	"github.com/sunvim/evm_rpc/pkg/storage"
+	"github.com/sunvim/evm_rpc/pkg/txsender"
+	"github.com/sunvim/evm_rpc/pkg/txvalidate"
 )
 
 // TxPoolAPI provides transaction pool related RPC methods
 type TxPoolAPI struct {
 	blockReader *storage.BlockReader
+	txReader    *storage.TransactionReader
 	stateReader *storage.StateReader
 	txPool      *storage.TxPoolStorage
+	validator   *txvalidate.Validator
+	filler      *txFiller
 	chainID     uint64
+
+	maxSendBatch int
 }
 
 // NewTxPoolAPI creates a new TxPoolAPI
-func NewTxPoolAPI(blockReader *storage.BlockReader, stateReader *storage.StateReader, txPool *storage.TxPoolStorage, chainID uint64) *TxPoolAPI {
+func NewTxPoolAPI(blockReader *storage.BlockReader, txReader *storage.TransactionReader, stateReader *storage.StateReader, txPool *storage.TxPoolStorage, validator *txvalidate.Validator, chainID uint64) *TxPoolAPI {
 	return &TxPoolAPI{
 		blockReader: blockReader,
+		txReader:    txReader,
 		stateReader: stateReader,
 		txPool:      txPool,
+		validator:   validator,
+		filler:      newTxFiller(blockReader, stateReader, txPool, chainID),
 		chainID:     chainID,
+
+		maxSendBatch: defaultMaxSendBatch,
 	}
 }
 
-// SendRawTransaction submits a raw transaction
-func (a *TxPoolAPI) SendRawTransaction(ctx context.Context, input hexutil.Bytes) (common.Hash, error) {
+// SetCallAPI makes gas estimates of filled transactions execute them; see
+// GasAPI.SetCallAPI. It must be called before serving.
+func (a *TxPoolAPI) SetCallAPI(calls *CallAPI) {
+	a.filler.gas.SetCallAPI(calls)
+}
+
+// Transaction lifecycle states reported by eth_getTransactionStatus
+const (
+	TxStatusUnknown = "unknown"
+	TxStatusPending = "pending"
+	TxStatusQueued  = "queued"
+	TxStatusMined   = "mined"
+)
+
+// TransactionStatus is the lifecycle status of a transaction
+type TransactionStatus struct {
+	Status           string          `json:"status"`
+	BlockNumber      *hexutil.Uint64 `json:"blockNumber,omitempty"`
+	BlockHash        *common.Hash    `json:"blockHash,omitempty"`
+	TransactionIndex *hexutil.Uint64 `json:"transactionIndex,omitempty"`
+	Reason           string          `json:"reason,omitempty"`
+	ReplacedBy       *common.Hash    `json:"replacedBy,omitempty"`
+}
+
+// GetTransactionStatus returns where a transaction is in its lifecycle:
+// mined in a block, pending or queued behind a nonce gap in the pool,
+// dropped from or replaced in the pool, or unknown. This is a non-standard
+// extension.
+func (a *TxPoolAPI) GetTransactionStatus(ctx context.Context, txHash common.Hash) (*TransactionStatus, error) {
+	lookup, err := a.txReader.GetTransactionLookup(ctx, txHash)
+	if err == nil {
+		number := hexutil.Uint64(lookup.BlockNumber)
+		index := hexutil.Uint64(lookup.Index)
+		status := &TransactionStatus{Status: TxStatusMined, BlockNumber: &number, TransactionIndex: &index}
+		if lookup.BlockHash != "" {
+			hash := common.HexToHash(lookup.BlockHash)
+			status.BlockHash = &hash
+		}
+		return status, nil
+	}
+	if err != storage.ErrNotFound {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get transaction lookup: %v", err)}
+	}
+
+	tx, err := a.txPool.GetPendingTx(ctx, txHash)
+	if err == nil {
+		from, err := txsender.Recover(tx)
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get sender: %v", err)}
+		}
+		nonce, err := a.stateReader.GetNonce(ctx, from, "latest")
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get nonce: %v", err)}
+		}
+		executable, err := a.txPool.IsExecutable(ctx, tx, nonce)
+		if err != nil {
+			return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to check nonce gap: %v", err)}
+		}
+		if executable {
+			return &TransactionStatus{Status: TxStatusPending}, nil
+		}
+		return &TransactionStatus{Status: TxStatusQueued}, nil
+	}
+	if err != storage.ErrNotFound {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get pending transaction: %v", err)}
+	}
+
+	poolStatus, err := a.txPool.GetTxStatus(ctx, txHash)
+	if err == storage.ErrNotFound {
+		return &TransactionStatus{Status: TxStatusUnknown}, nil
+	}
+	if err != nil {
+		return nil, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get transaction status: %v", err)}
+	}
+	return &TransactionStatus{
+		Status:     poolStatus.Status,
+		Reason:     poolStatus.Reason,
+		ReplacedBy: poolStatus.ReplacedBy,
+	}, nil
+}
+
+// FillTransaction fills in the nonce, gas and fee fields of a transaction
+// and returns it unsigned, for clients that sign elsewhere
+func (a *TxPoolAPI) FillTransaction(ctx context.Context, args api.TransactionArgs) (*api.SignTransactionResult, error) {
+	tx, err := a.filler.fill(ctx, &args)
+	if err != nil {
+		return nil, err
+	}
+	return signResult(tx)
+}
+
+// maxIdempotencyKeyLength bounds idempotency keys, which are stored in Pika
+const maxIdempotencyKeyLength = 256
+
+// SendRawTransaction submits a raw transaction. A retry with the idempotency
+// key of an accepted submission, given as the optional second param or the
+// Idempotency-Key header, returns its hash without validating it again.
+func (a *TxPoolAPI) SendRawTransaction(ctx context.Context, input hexutil.Bytes, idempotencyKey *string) (common.Hash, error) {
 	// Decode transaction
 	tx := new(types.Transaction)
 	if err := rlp.DecodeBytes(input, tx); err != nil {
 		return common.Hash{}, &api.RPCError{Code: api.ErrCodeInvalidInput, Message: fmt.Sprintf("invalid transaction: %v", err)}
 	}
 
-	// Validate transaction signature
-	signer := types.LatestSignerForChainID(tx.ChainId())
-	from, err := types.Sender(signer, tx)
-	if err != nil {
-		return common.Hash{}, &api.RPCError{Code: api.ErrCodeInvalidInput, Message: fmt.Sprintf("invalid signature: %v", err)}
+	key := middleware.IdempotencyKeyFromContext(ctx)
+	if idempotencyKey != nil {
+		key = *idempotencyKey
 	}
-
-	// Verify chain ID
-	if tx.ChainId() != nil && tx.ChainId().Uint64() != a.chainID {
-		return common.Hash{}, &api.RPCError{Code: api.ErrCodeInvalidInput, Message: 
-			fmt.Sprintf("invalid chain id: got %d, expected %d", tx.ChainId().Uint64(), a.chainID)}
+	if key == "" {
+		return a.submit(ctx, tx)
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return common.Hash{}, api.NewRPCError(api.ErrCodeInvalidParams, fmt.Sprintf("idempotency key too long, max %d bytes", maxIdempotencyKeyLength))
 	}
+	return a.submitIdempotent(ctx, tx, key)
+}
 
-	// Get current account nonce
-	currentNonce, err := a.stateReader.GetNonce(ctx, from, "latest")
+// submitIdempotent submits a transaction once per idempotency key of the
+// client, identified by its API key or IP address. The key is released if
+// the submission fails, so that the retry is validated again.
+func (a *TxPoolAPI) submitIdempotent(ctx context.Context, tx *types.Transaction, key string) (common.Hash, error) {
+	client := middleware.ClientIdentity(ctx)
+	claimed, err := a.txPool.ClaimIdempotencyKey(ctx, client, key, tx.Hash())
+	if err == storage.ErrIdempotencyKeyReused {
+		return common.Hash{}, &api.RPCError{Code: api.ErrCodeInvalidParams, Message: err.Error(), Data: map[string]string{"reason": "idempotency_key_reused"}}
+	}
 	if err != nil {
-		return common.Hash{}, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get nonce: %v", err)}
+		return common.Hash{}, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to claim idempotency key: %v", err)}
 	}
-
-	// Check nonce (must be >= current nonce)
-	if tx.Nonce() < currentNonce {
-		return common.Hash{}, &api.RPCError{Code: api.ErrCodeTransactionReject, Message: 
-			fmt.Sprintf("nonce too low: got %d, expected >= %d", tx.Nonce(), currentNonce)}
+	if !claimed {
+		metrics.RecordIdempotentReplay()
+		return tx.Hash(), nil
 	}
 
-	// Get account balance
-	balance, err := a.stateReader.GetBalance(ctx, from, "latest")
+	hash, err := a.submit(ctx, tx)
 	if err != nil {
-		return common.Hash{}, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get balance: %v", err)}
+		// The client may have gone away, the key must go all the same
+		if releaseErr := a.txPool.ReleaseIdempotencyKey(context.WithoutCancel(ctx), client, key); releaseErr != nil {
+			logger.Warnf("Failed to release idempotency key of tx %s: %v", tx.Hash().Hex(), releaseErr)
+		}
+		return common.Hash{}, err
 	}
+	return hash, nil
+}
 
-	// Calculate total cost (value + gas)
-	gasPrice := tx.GasPrice()
-	if gasPrice == nil {
-		gasPrice = tx.GasFeeCap()
+// submit validates a signed transaction and adds it to the pool
+func (a *TxPoolAPI) submit(ctx context.Context, tx *types.Transaction) (common.Hash, error) {
+	if err := a.validate(ctx, tx, a.head(ctx)); err != nil {
+		return common.Hash{}, err
 	}
-	if gasPrice == nil {
-		gasPrice = big.NewInt(0)
+	if err := a.enqueue(ctx, tx); err != nil {
+		return common.Hash{}, err
 	}
+	return tx.Hash(), nil
+}
 
-	gasCost := new(big.Int).Mul(gasPrice, big.NewInt(int64(tx.Gas())))
-	totalCost := new(big.Int).Add(tx.Value(), gasCost)
+// head returns the latest header, nil if it cannot be read, in which case
+// the checks against it are skipped
+func (a *TxPoolAPI) head(ctx context.Context) *types.Header {
+	var head *types.Header
+	if latest, err := a.blockReader.GetLatestBlockNumber(ctx); err == nil {
+		head, _ = a.blockReader.GetHeader(ctx, latest)
+	}
+	return head
+}
+
+// validate checks a signed transaction against the chain rules at head
+// and the account of its sender
+func (a *TxPoolAPI) validate(ctx context.Context, tx *types.Transaction, head *types.Header) *api.RPCError {
+	if err := a.validator.ValidateTx(tx, head); err != nil {
+		return validationError(err)
+	}
 
-	// Check balance
-	if balance.Cmp(totalCost) < 0 {
-		return common.Hash{}, &api.RPCError{Code: api.ErrCodeTransactionReject, Message: 
-			fmt.Sprintf("insufficient funds: balance=%s, required=%s", balance.String(), totalCost.String())}
+	from, err := txsender.Recover(tx)
+	if err != nil {
+		return &api.RPCError{Code: api.ErrCodeInvalidInput, Message: fmt.Sprintf("invalid signature: %v", err)}
 	}
 
-	// Validate gas limit
-	if tx.Gas() < 21000 {
-		return common.Hash{}, &api.RPCError{Code: api.ErrCodeInvalidInput, Message: 
-			fmt.Sprintf("gas limit too low: got %d, minimum 21000", tx.Gas())}
+	nonce, err := a.stateReader.GetNonce(ctx, from, "latest")
+	if err != nil {
+		return &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get nonce: %v", err)}
 	}
+	balance, err := a.stateReader.GetBalance(ctx, from, "latest")
+	if err != nil {
+		return &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get balance: %v", err)}
+	}
+	if err := a.validator.ValidateState(tx, nonce, balance); err != nil {
+		return validationError(err)
+	}
+	return nil
+}
 
-	// Add to transaction pool
+// enqueue adds a validated transaction to the pool
+func (a *TxPoolAPI) enqueue(ctx context.Context, tx *types.Transaction) *api.RPCError {
 	if err := a.txPool.AddPendingTx(ctx, tx, "rpc"); err != nil {
-		return common.Hash{}, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to add transaction: %v", err)}
+		if reason, ok := poolRejections[err]; ok {
+			return rejection(api.ErrCodeTransactionReject, err, reason)
+		}
+		return &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to add transaction: %v", err)}
 	}
+	return nil
+}
 
-	return tx.Hash(), nil
+// poolRejections names the pool's rejection errors
+var poolRejections = map[error]string{
+	storage.ErrAlreadyKnown:       "already_known",
+	storage.ErrReplaceUnderpriced: "replace_underpriced",
+	storage.ErrUnderpriced:        "pool_underpriced",
+	storage.ErrAccountLimit:       "account_limit",
+}
+
+// validationError maps a validator error to an RPC error
+func validationError(err error) *api.RPCError {
+	if txvalidate.Rejected(err) {
+		return rejection(api.ErrCodeTransactionReject, err, txvalidate.Reason(err))
+	}
+	return rejection(api.ErrCodeInvalidInput, err, txvalidate.Reason(err))
+}
+
+// rejection records a rejected submission and returns its RPC error, with
+// the reason and the values that failed the check, e.g. the expected and
+// given nonce, in the error data so clients need not parse the message
+func rejection(code int, err error, reason string) *api.RPCError {
+	metrics.RecordTxRejection(reason)
+	data := map[string]interface{}{"reason": reason}
+	for name, value := range txvalidate.ErrorDetails(err) {
+		data[name] = value
+	}
+	return &api.RPCError{Code: code, Message: err.Error(), Data: data}
 }
 
 // PendingTransactions returns all pending transactions
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// FilterQuery represents the criteria of eth_newFilter and eth_getLogs
+type FilterQuery struct {
+	BlockHash *common.Hash     `json:"blockHash,omitempty"`
+	FromBlock string           `json:"fromBlock,omitempty"`
+	ToBlock   string           `json:"toBlock,omitempty"`
+	Addresses []common.Address `json:"address,omitempty"`
+	Topics    [][]common.Hash  `json:"topics,omitempty"`
+}
+
+// UnmarshalJSON accepts a single address or an address list, and single
+// topics or topic lists, as the JSON-RPC spec allows
+func (q *FilterQuery) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		BlockHash *common.Hash      `json:"blockHash"`
+		FromBlock string            `json:"fromBlock"`
+		ToBlock   string            `json:"toBlock"`
+		Addresses json.RawMessage   `json:"address"`
+		Topics    []json.RawMessage `json:"topics"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	q.BlockHash = raw.BlockHash
+	q.FromBlock = raw.FromBlock
+	q.ToBlock = raw.ToBlock
+	q.Addresses = nil
+	q.Topics = nil
+
+	if len(raw.Addresses) > 0 && string(raw.Addresses) != "null" {
+		var single common.Address
+		if err := json.Unmarshal(raw.Addresses, &single); err == nil {
+			q.Addresses = []common.Address{single}
+		} else if err := json.Unmarshal(raw.Addresses, &q.Addresses); err != nil {
+			return fmt.Errorf("invalid address: %w", err)
+		}
+	}
+
+	for i, rawTopic := range raw.Topics {
+		if len(rawTopic) == 0 || string(rawTopic) == "null" {
+			q.Topics = append(q.Topics, nil) // wildcard
+			continue
+		}
+		var single common.Hash
+		if err := json.Unmarshal(rawTopic, &single); err == nil {
+			q.Topics = append(q.Topics, []common.Hash{single})
+			continue
+		}
+		var set []common.Hash
+		if err := json.Unmarshal(rawTopic, &set); err != nil {
+			return fmt.Errorf("invalid topic %d: %w", i, err)
+		}
+		q.Topics = append(q.Topics, set)
+	}
+
+	return nil
+}
+
+// Matches checks if a log matches the address and topic criteria
+func (q *FilterQuery) Matches(log *types.Log) bool {
+	if len(q.Addresses) > 0 {
+		matched := false
+		for _, addr := range q.Addresses {
+			if log.Address == addr {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(q.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, topicSet := range q.Topics {
+		if len(topicSet) == 0 {
+			continue // wildcard
+		}
+		matched := false
+		for _, topic := range topicSet {
+			if log.Topics[i] == topic {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/sunvim/evm_rpc/pkg/jsonx"
+)
+
+// The response types of block, transaction and receipt methods append their
+// JSON directly, since full blocks spend most of their serialization time in
+// reflection otherwise. Field order and omitempty handling follow the struct
+// tags, so the output is the same as encoding/json's.
+
+// AppendJSON implements jsonx.Appender
+func (b *RPCBlock) AppendJSON(dst []byte) ([]byte, error) {
+	if b == nil {
+		return append(dst, "null"...), nil
+	}
+	dst = append(dst, `{"number":`...)
+	dst = jsonx.AppendBig(dst, (*big.Int)(b.Number))
+	dst = append(dst, `,"hash":`...)
+	dst = jsonx.AppendHashPtr(dst, b.Hash)
+	dst = append(dst, `,"parentHash":`...)
+	dst = jsonx.AppendBytes(dst, b.ParentHash[:])
+	dst = append(dst, `,"nonce":`...)
+	if b.Nonce == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = jsonx.AppendBytes(dst, b.Nonce[:])
+	}
+	dst = append(dst, `,"sha3Uncles":`...)
+	dst = jsonx.AppendBytes(dst, b.Sha3Uncles[:])
+	dst = append(dst, `,"logsBloom":`...)
+	dst = jsonx.AppendBytes(dst, b.LogsBloom[:])
+	dst = append(dst, `,"transactionsRoot":`...)
+	dst = jsonx.AppendBytes(dst, b.TransactionsRoot[:])
+	dst = append(dst, `,"stateRoot":`...)
+	dst = jsonx.AppendBytes(dst, b.StateRoot[:])
+	dst = append(dst, `,"receiptsRoot":`...)
+	dst = jsonx.AppendBytes(dst, b.ReceiptsRoot[:])
+	dst = append(dst, `,"miner":`...)
+	dst = jsonx.AppendBytes(dst, b.Miner[:])
+	dst = append(dst, `,"difficulty":`...)
+	dst = jsonx.AppendBig(dst, (*big.Int)(b.Difficulty))
+	dst = append(dst, `,"totalDifficulty":`...)
+	dst = jsonx.AppendBig(dst, (*big.Int)(b.TotalDifficulty))
+	dst = append(dst, `,"extraData":`...)
+	dst = jsonx.AppendBytes(dst, b.ExtraData)
+	dst = append(dst, `,"size":`...)
+	dst = jsonx.AppendUint64(dst, uint64(b.Size))
+	dst = append(dst, `,"gasLimit":`...)
+	dst = jsonx.AppendUint64(dst, uint64(b.GasLimit))
+	dst = append(dst, `,"gasUsed":`...)
+	dst = jsonx.AppendUint64(dst, uint64(b.GasUsed))
+	dst = append(dst, `,"timestamp":`...)
+	dst = jsonx.AppendUint64(dst, uint64(b.Timestamp))
+	dst = append(dst, `,"transactions":`...)
+	var err error
+	if txs, ok := b.Transactions.([]*RPCTransaction); ok {
+		dst, err = appendTransactions(dst, txs)
+	} else {
+		dst, err = jsonx.AppendValue(dst, b.Transactions)
+	}
+	if err != nil {
+		return dst, err
+	}
+	dst = append(dst, `,"uncles":`...)
+	dst = jsonx.AppendHashes(dst, b.Uncles)
+	dst = append(dst, `,"mixHash":`...)
+	dst = jsonx.AppendBytes(dst, b.MixHash[:])
+	if b.BaseFeePerGas != nil {
+		dst = append(dst, `,"baseFeePerGas":`...)
+		dst = jsonx.AppendBig(dst, (*big.Int)(b.BaseFeePerGas))
+	}
+	if b.WithdrawalsRoot != nil {
+		dst = append(dst, `,"withdrawalsRoot":`...)
+		dst = jsonx.AppendBytes(dst, b.WithdrawalsRoot[:])
+	}
+	if b.Withdrawals != nil {
+		data, err := json.Marshal(b.Withdrawals)
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, `,"withdrawals":`...)
+		dst = append(dst, data...)
+	}
+	if b.BlobGasUsed != nil {
+		dst = append(dst, `,"blobGasUsed":`...)
+		dst = jsonx.AppendUint64Ptr(dst, b.BlobGasUsed)
+	}
+	if b.ExcessBlobGas != nil {
+		dst = append(dst, `,"excessBlobGas":`...)
+		dst = jsonx.AppendUint64Ptr(dst, b.ExcessBlobGas)
+	}
+	if b.ParentBeaconBlockRoot != nil {
+		dst = append(dst, `,"parentBeaconBlockRoot":`...)
+		dst = jsonx.AppendBytes(dst, b.ParentBeaconBlockRoot[:])
+	}
+	return append(dst, '}'), nil
+}
+
+// appendTransactions appends the full transactions of a block
+func appendTransactions(dst []byte, txs []*RPCTransaction) ([]byte, error) {
+	if txs == nil {
+		return append(dst, "null"...), nil
+	}
+	dst = append(dst, '[')
+	for i, tx := range txs {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst, _ = tx.AppendJSON(dst)
+	}
+	return append(dst, ']'), nil
+}
+
+// AppendJSON implements jsonx.Appender
+func (tx *RPCTransaction) AppendJSON(dst []byte) ([]byte, error) {
+	if tx == nil {
+		return append(dst, "null"...), nil
+	}
+	dst = append(dst, `{"blockHash":`...)
+	dst = jsonx.AppendHashPtr(dst, tx.BlockHash)
+	dst = append(dst, `,"blockNumber":`...)
+	dst = jsonx.AppendBig(dst, (*big.Int)(tx.BlockNumber))
+	dst = append(dst, `,"from":`...)
+	dst = jsonx.AppendBytes(dst, tx.From[:])
+	dst = append(dst, `,"gas":`...)
+	dst = jsonx.AppendUint64(dst, uint64(tx.Gas))
+	dst = append(dst, `,"gasPrice":`...)
+	dst = jsonx.AppendBig(dst, (*big.Int)(tx.GasPrice))
+	if tx.GasFeeCap != nil {
+		dst = append(dst, `,"maxFeePerGas":`...)
+		dst = jsonx.AppendBig(dst, (*big.Int)(tx.GasFeeCap))
+	}
+	if tx.GasTipCap != nil {
+		dst = append(dst, `,"maxPriorityFeePerGas":`...)
+		dst = jsonx.AppendBig(dst, (*big.Int)(tx.GasTipCap))
+	}
+	dst = append(dst, `,"hash":`...)
+	dst = jsonx.AppendBytes(dst, tx.Hash[:])
+	dst = append(dst, `,"input":`...)
+	dst = jsonx.AppendBytes(dst, tx.Input)
+	dst = append(dst, `,"nonce":`...)
+	dst = jsonx.AppendUint64(dst, uint64(tx.Nonce))
+	dst = append(dst, `,"to":`...)
+	dst = jsonx.AppendAddressPtr(dst, tx.To)
+	dst = append(dst, `,"transactionIndex":`...)
+	dst = jsonx.AppendUint64Ptr(dst, tx.TransactionIndex)
+	dst = append(dst, `,"value":`...)
+	dst = jsonx.AppendBig(dst, (*big.Int)(tx.Value))
+	dst = append(dst, `,"type":`...)
+	dst = jsonx.AppendUint64(dst, uint64(tx.Type))
+	if tx.ChainID != nil {
+		dst = append(dst, `,"chainId":`...)
+		dst = jsonx.AppendBig(dst, (*big.Int)(tx.ChainID))
+	}
+	dst = append(dst, `,"v":`...)
+	dst = jsonx.AppendBig(dst, (*big.Int)(tx.V))
+	dst = append(dst, `,"r":`...)
+	dst = jsonx.AppendBig(dst, (*big.Int)(tx.R))
+	dst = append(dst, `,"s":`...)
+	dst = jsonx.AppendBig(dst, (*big.Int)(tx.S))
+	return append(dst, '}'), nil
+}
+
+// AppendJSON implements jsonx.Appender
+func (r *RPCReceipt) AppendJSON(dst []byte) ([]byte, error) {
+	if r == nil {
+		return append(dst, "null"...), nil
+	}
+	dst = append(dst, `{"transactionHash":`...)
+	dst = jsonx.AppendBytes(dst, r.TransactionHash[:])
+	dst = append(dst, `,"transactionIndex":`...)
+	dst = jsonx.AppendUint64(dst, uint64(r.TransactionIndex))
+	dst = append(dst, `,"blockHash":`...)
+	dst = jsonx.AppendBytes(dst, r.BlockHash[:])
+	dst = append(dst, `,"blockNumber":`...)
+	dst = jsonx.AppendBig(dst, (*big.Int)(r.BlockNumber))
+	dst = append(dst, `,"from":`...)
+	dst = jsonx.AppendBytes(dst, r.From[:])
+	dst = append(dst, `,"to":`...)
+	dst = jsonx.AppendAddressPtr(dst, r.To)
+	dst = append(dst, `,"cumulativeGasUsed":`...)
+	dst = jsonx.AppendUint64(dst, uint64(r.CumulativeGasUsed))
+	dst = append(dst, `,"gasUsed":`...)
+	dst = jsonx.AppendUint64(dst, uint64(r.GasUsed))
+	dst = append(dst, `,"contractAddress":`...)
+	dst = jsonx.AppendAddressPtr(dst, r.ContractAddress)
+	dst = append(dst, `,"logs":`...)
+	dst = jsonx.AppendLogs(dst, r.Logs)
+	dst = append(dst, `,"logsBloom":`...)
+	dst = jsonx.AppendBytes(dst, r.LogsBloom[:])
+	dst = append(dst, `,"type":`...)
+	dst = jsonx.AppendUint64(dst, uint64(r.Type))
+	if len(r.Root) > 0 {
+		dst = append(dst, `,"root":`...)
+		dst = jsonx.AppendBytes(dst, r.Root)
+	}
+	if r.Status != nil {
+		dst = append(dst, `,"status":`...)
+		dst = jsonx.AppendUint64Ptr(dst, r.Status)
+	}
+	if r.EffectiveGasPrice != nil {
+		dst = append(dst, `,"effectiveGasPrice":`...)
+		dst = jsonx.AppendBig(dst, (*big.Int)(r.EffectiveGasPrice))
+	}
+	return append(dst, '}'), nil
+}
@@ -0,0 +1,271 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+	"github.com/sunvim/evm_rpc/pkg/jsonx"
+)
+
+var (
+	testChainID = big.NewInt(1337)
+	testTo      = common.HexToAddress("0x000000000000000000000000000000000000dead")
+)
+
+// testChainConfig has every fork through Cancun active from genesis
+func testChainConfig() *params.ChainConfig {
+	config := *params.AllEthashProtocolChanges
+	zero := uint64(0)
+	config.ChainID = testChainID
+	config.ShanghaiTime = &zero
+	config.CancunTime = &zero
+	return &config
+}
+
+func testKey(t testing.TB) *ecdsa.PrivateKey {
+	key, err := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// testTxs returns a signed transaction of every type, plus an unprotected
+// legacy one and a contract creation
+func testTxs(t testing.TB) []*types.Transaction {
+	key := testKey(t)
+	sign := func(signer types.Signer, data types.TxData) *types.Transaction {
+		tx, err := types.SignNewTx(key, signer, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	accessList := types.AccessList{{
+		Address:     testTo,
+		StorageKeys: []common.Hash{{0x01}, {0x02}},
+	}}
+	return []*types.Transaction{
+		sign(types.HomesteadSigner{}, &types.LegacyTx{
+			Nonce: 0, GasPrice: big.NewInt(1e9), Gas: 21000, To: &testTo, Value: big.NewInt(1),
+		}),
+		sign(types.NewEIP155Signer(testChainID), &types.LegacyTx{
+			Nonce: 1, GasPrice: big.NewInt(2e9), Gas: 50000, To: &testTo, Value: big.NewInt(0), Data: []byte{0xde, 0xad, 0xbe, 0xef},
+		}),
+		sign(types.NewEIP155Signer(testChainID), &types.LegacyTx{
+			Nonce: 2, GasPrice: big.NewInt(3e9), Gas: 100000, Data: common.FromHex("0x6080604052"),
+		}),
+		sign(types.NewEIP2930Signer(testChainID), &types.AccessListTx{
+			ChainID: testChainID, Nonce: 3, GasPrice: big.NewInt(1e9), Gas: 30000, To: &testTo, AccessList: accessList,
+		}),
+		sign(types.NewLondonSigner(testChainID), &types.DynamicFeeTx{
+			ChainID: testChainID, Nonce: 4, GasTipCap: big.NewInt(1e9), GasFeeCap: big.NewInt(3e10), Gas: 21000,
+			To: &testTo, Value: new(big.Int).Mul(big.NewInt(1e18), big.NewInt(1000)), AccessList: accessList,
+		}),
+		sign(types.NewCancunSigner(testChainID), &types.BlobTx{
+			ChainID: uint256.MustFromBig(testChainID), Nonce: 5, GasTipCap: uint256.NewInt(1e9),
+			GasFeeCap: uint256.NewInt(3e10), Gas: 21000, To: testTo, Value: uint256.NewInt(0),
+			BlobFeeCap: uint256.NewInt(1e9), BlobHashes: []common.Hash{{0x01, 0xaa}},
+		}),
+	}
+}
+
+func testLogs(n int) []*types.Log {
+	logs := make([]*types.Log, n)
+	for i := range logs {
+		logs[i] = &types.Log{
+			Address:     testTo,
+			Topics:      []common.Hash{{0xdd, byte(i)}, {0x01}},
+			Data:        bytes.Repeat([]byte{byte(i)}, 64),
+			BlockNumber: 100,
+			TxHash:      common.Hash{0x0f},
+			TxIndex:     uint(i / 4),
+			BlockHash:   common.Hash{0xbb},
+			Index:       uint(i),
+			Removed:     i%5 == 4,
+		}
+	}
+	return logs
+}
+
+// testBlock builds a block of txs. The block is post-London when baseFee
+// is set and carries the Cancun header fields when cancun is.
+func testBlock(txs []*types.Transaction, baseFee *big.Int, cancun bool) *types.Block {
+	header := &types.Header{
+		ParentHash:  common.Hash{0x01},
+		UncleHash:   types.EmptyUncleHash,
+		Coinbase:    common.HexToAddress("0x00000000000000000000000000000000000000c0"),
+		Root:        common.Hash{0x02},
+		TxHash:      common.Hash{0x03},
+		ReceiptHash: common.Hash{0x04},
+		Difficulty:  big.NewInt(131072),
+		Number:      big.NewInt(100),
+		GasLimit:    30_000_000,
+		GasUsed:     21000 * uint64(len(txs)),
+		Time:        1700000000,
+		Extra:       []byte("evm_rpc"),
+		MixDigest:   common.Hash{0x05},
+		Nonce:       types.EncodeNonce(42),
+		BaseFee:     baseFee,
+	}
+	block := types.NewBlockWithHeader(header)
+	if cancun {
+		blobGasUsed, excessBlobGas := uint64(131072), uint64(0)
+		beaconRoot := common.Hash{0x06}
+		header.WithdrawalsHash = &types.EmptyWithdrawalsHash
+		header.BlobGasUsed = &blobGasUsed
+		header.ExcessBlobGas = &excessBlobGas
+		header.ParentBeaconRoot = &beaconRoot
+		block = types.NewBlockWithHeader(header).WithWithdrawals([]*types.Withdrawal{
+			{Index: 1, Validator: 2, Address: testTo, Amount: 3},
+		})
+	}
+	return block.WithBody(txs, nil)
+}
+
+// assertSameJSON checks that jsonx encodes v exactly as encoding/json does
+func assertSameJSON(t *testing.T, v interface{}) {
+	t.Helper()
+	want, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("encoding/json: %v", err)
+	}
+	got, err := jsonx.Marshal(v)
+	if err != nil {
+		t.Fatalf("jsonx: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("jsonx output differs from encoding/json\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestBlockJSONMatchesEncodingJSON(t *testing.T) {
+	txs := testTxs(t)
+	mainnet := params.MainnetChainConfig
+	pending := NewRPCBlock(testBlock(txs[:2], nil, false), true, nil, mainnet)
+	pending.Hash = nil
+	pending.Nonce = nil
+
+	tests := []struct {
+		name  string
+		block *RPCBlock
+	}{
+		{"frontier hashes", NewRPCBlock(testBlock(txs[:3], nil, false), false, big.NewInt(1000), mainnet)},
+		{"frontier full", NewRPCBlock(testBlock(txs[:3], nil, false), true, big.NewInt(1000), mainnet)},
+		{"london full", NewRPCBlock(testBlock(txs[:5], big.NewInt(7), false), true, big.NewInt(1000), mainnet)},
+		{"cancun full", NewRPCBlock(testBlock(txs, big.NewInt(7), true), true, nil, testChainConfig())},
+		{"cancun hashes", NewRPCBlock(testBlock(txs, big.NewInt(7), true), false, nil, testChainConfig())},
+		{"empty", NewRPCBlock(testBlock(nil, big.NewInt(0), false), true, nil, mainnet)},
+		{"pending", pending},
+		{"nil", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { assertSameJSON(t, tt.block) })
+	}
+}
+
+func TestTransactionJSONMatchesEncodingJSON(t *testing.T) {
+	names := []string{"unprotected legacy", "legacy", "legacy create", "access list", "dynamic fee", "blob"}
+	for i, tx := range testTxs(t) {
+		t.Run(names[i], func(t *testing.T) {
+			assertSameJSON(t, NewRPCTransaction(tx, common.Hash{0xbb}, 100, uint64(i)))
+			assertSameJSON(t, NewRPCPendingTransaction(tx))
+		})
+	}
+	assertSameJSON(t, (*RPCTransaction)(nil))
+}
+
+func TestReceiptJSONMatchesEncodingJSON(t *testing.T) {
+	txs := testTxs(t)
+	logs := testLogs(3)
+	tests := []struct {
+		name    string
+		receipt *types.Receipt
+		tx      *types.Transaction
+	}{
+		{"success with logs", &types.Receipt{
+			Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 63000, GasUsed: 21000,
+			Logs: logs, Bloom: types.CreateBloom(types.Receipts{{Logs: logs}}),
+			EffectiveGasPrice: big.NewInt(2e9),
+		}, txs[4]},
+		{"failed", &types.Receipt{Status: types.ReceiptStatusFailed, CumulativeGasUsed: 30000, GasUsed: 30000}, txs[3]},
+		{"pre-byzantium", &types.Receipt{PostState: common.Hash{0x0a}.Bytes(), CumulativeGasUsed: 21000, GasUsed: 21000}, txs[0]},
+		{"contract creation", &types.Receipt{
+			Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 90000, GasUsed: 90000,
+			ContractAddress: crypto.CreateAddress(testTo, 2),
+		}, txs[2]},
+		{"blob", &types.Receipt{
+			Type: types.BlobTxType, Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000, GasUsed: 21000,
+			Logs: []*types.Log{}, BlobGasUsed: 131072, BlobGasPrice: big.NewInt(1),
+		}, txs[5]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertSameJSON(t, NewRPCReceipt(tt.receipt, tt.tx, common.Hash{0xbb}, 100, 2))
+		})
+	}
+	assertSameJSON(t, (*RPCReceipt)(nil))
+}
+
+// benchBlock is a full block of 200 transactions of mixed types
+func benchBlock(b *testing.B) *RPCBlock {
+	txs := testTxs(b)
+	key := testKey(b)
+	signer := types.NewLondonSigner(testChainID)
+	for nonce := uint64(len(txs)); len(txs) < 200; nonce++ {
+		tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+			ChainID: testChainID, Nonce: nonce, GasTipCap: big.NewInt(1e9), GasFeeCap: big.NewInt(3e10),
+			Gas: 60000, To: &testTo, Value: big.NewInt(int64(nonce)), Data: bytes.Repeat([]byte{0x01}, 68),
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+	return NewRPCBlock(testBlock(txs, big.NewInt(7), true), true, nil, testChainConfig())
+}
+
+func benchmarkCodecs(b *testing.B, v interface{}) {
+	for _, name := range []string{jsonx.CodecStd, jsonx.CodecFast} {
+		codec, _ := jsonx.Lookup(name)
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := codec.Marshal(v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBlockJSON(b *testing.B) {
+	benchmarkCodecs(b, benchBlock(b))
+}
+
+func BenchmarkTransactionJSON(b *testing.B) {
+	tx := testTxs(b)[4]
+	benchmarkCodecs(b, NewRPCTransaction(tx, common.Hash{0xbb}, 100, 0))
+}
+
+func BenchmarkReceiptJSON(b *testing.B) {
+	tx := testTxs(b)[4]
+	logs := testLogs(4)
+	receipt := &types.Receipt{
+		Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 63000, GasUsed: 21000,
+		Logs: logs, Bloom: types.CreateBloom(types.Receipts{{Logs: logs}}), EffectiveGasPrice: big.NewInt(2e9),
+	}
+	benchmarkCodecs(b, NewRPCReceipt(receipt, tx, common.Hash{0xbb}, 100, 0))
+}
+
+func BenchmarkLogsJSON(b *testing.B) {
+	benchmarkCodecs(b, testLogs(500))
+}
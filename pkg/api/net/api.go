@@ -7,15 +7,26 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
+// Status reports the state behind net_peerCount and net_listening
+type Status interface {
+	// PeerCount returns the number of healthy upstream connections
+	PeerCount() int
+	// Listening reports whether an RPC listener is accepting connections
+	Listening() bool
+}
+
 // NetAPI provides network-related RPC methods
 type NetAPI struct {
 	networkID uint64
+	status    Status
 }
 
-// NewNetAPI creates a new NetAPI
-func NewNetAPI(networkID uint64) *NetAPI {
+// NewNetAPI creates a new NetAPI. Without a status, it reports no peers
+// and always listening.
+func NewNetAPI(networkID uint64, status Status) *NetAPI {
 	return &NetAPI{
 		networkID: networkID,
+		status:    status,
 	}
 }
 
@@ -26,13 +37,17 @@ func (api *NetAPI) Version(ctx context.Context) (string, error) {
 
 // Listening returns true if the client is actively listening for network connections
 func (api *NetAPI) Listening(ctx context.Context) (bool, error) {
-	// Always return true for a running RPC server
-	return true, nil
+	if api.status == nil {
+		return true, nil
+	}
+	return api.status.Listening(), nil
 }
 
-// PeerCount returns the number of connected peers
+// PeerCount returns the number of connected peers. The service has no p2p
+// peers, so its healthy upstream connections are reported instead.
 func (api *NetAPI) PeerCount(ctx context.Context) (hexutil.Uint64, error) {
-	// For now, return 0 as this is a read-only RPC service
-	// In a full node, this would return the actual peer count
-	return hexutil.Uint64(0), nil
+	if api.status == nil {
+		return 0, nil
+	}
+	return hexutil.Uint64(api.status.PeerCount()), nil
 }
@@ -0,0 +1,269 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/api/eth"
+	"github.com/sunvim/evm_rpc/pkg/cache"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// Token standards reported by token_metadata
+const (
+	StandardERC20   = "ERC20"
+	StandardERC721  = "ERC721"
+	StandardUnknown = "unknown"
+)
+
+// Selectors of the token methods called
+var (
+	selectorBalanceOf         = common.FromHex("0x70a08231") // balanceOf(address)
+	selectorName              = common.FromHex("0x06fdde03") // name()
+	selectorSymbol            = common.FromHex("0x95d89b41") // symbol()
+	selectorDecimals          = common.FromHex("0x313ce567") // decimals()
+	selectorSupportsInterface = common.FromHex("0x01ffc9a7") // supportsInterface(bytes4)
+
+	interfaceERC721 = common.FromHex("0x80ac58cd")
+)
+
+var stringType, _ = abi.NewType("string", "", nil)
+
+// TokenAPI provides ERC-20 and ERC-721 helpers executed with eth_call on
+// stored state. Metadata is cached until evicted; balances are cached per
+// block, so that only calls on new blocks execute.
+type TokenAPI struct {
+	calls       *eth.CallAPI
+	blockReader *storage.BlockReader
+	tokens      []common.Address
+	metadata    *cache.Cache[common.Address, *Metadata]
+	balances    *cache.Cache[balanceKey, *big.Int]
+}
+
+// balanceKey identifies a cached balance. Balances at latest are keyed by
+// the latest block number with a prefix, apart from balances at that
+// number, since latest may move while the call runs.
+type balanceKey struct {
+	token common.Address
+	owner common.Address
+	block string
+}
+
+// NewTokenAPI creates a new TokenAPI. tokens are the tokens of
+// token_balances; cacheSize bounds the metadata and the balances cached.
+func NewTokenAPI(calls *eth.CallAPI, blockReader *storage.BlockReader, tokens []common.Address, cacheSize int) (*TokenAPI, error) {
+	metadata, err := cache.NewCache[common.Address, *Metadata](cacheSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token metadata cache: %w", err)
+	}
+	balances, err := cache.NewCache[balanceKey, *big.Int](cacheSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token balance cache: %w", err)
+	}
+	return &TokenAPI{
+		calls:       calls,
+		blockReader: blockReader,
+		tokens:      tokens,
+		metadata:    metadata,
+		balances:    balances,
+	}, nil
+}
+
+// Metadata describes a token. Fields a token does not implement are
+// omitted.
+type Metadata struct {
+	Address  common.Address `json:"address"`
+	Standard string         `json:"standard"`
+	Name     string         `json:"name,omitempty"`
+	Symbol   string         `json:"symbol,omitempty"`
+	Decimals *hexutil.Uint  `json:"decimals,omitempty"`
+}
+
+// TokenBalance is the balance of a token in token_balances, or the error
+// reading it
+type TokenBalance struct {
+	Token   common.Address `json:"token"`
+	Balance *hexutil.Big   `json:"balance,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// BalanceOf returns the balance of owner in an ERC-20 or ERC-721 token at
+// a block, latest by default
+func (a *TokenAPI) BalanceOf(ctx context.Context, token, owner common.Address, blockNrOrHash *api.BlockNumberOrHash) (*hexutil.Big, error) {
+	key, cacheable, err := a.cacheBlock(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := a.balanceOf(ctx, token, owner, blockNrOrHash, key, cacheable)
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(balance), nil
+}
+
+// Balances returns the balances of owner in the configured tokens at a
+// block, latest by default, in the configured order. A token whose balance
+// cannot be read reports the error.
+func (a *TokenAPI) Balances(ctx context.Context, owner common.Address, blockNrOrHash *api.BlockNumberOrHash) ([]*TokenBalance, error) {
+	key, cacheable, err := a.cacheBlock(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*TokenBalance, len(a.tokens))
+	for i, token := range a.tokens {
+		balance, err := a.balanceOf(ctx, token, owner, blockNrOrHash, key, cacheable)
+		switch {
+		case isInternal(err):
+			return nil, err
+		case err != nil:
+			results[i] = &TokenBalance{Token: token, Error: errorMessage(err)}
+		default:
+			results[i] = &TokenBalance{Token: token, Balance: (*hexutil.Big)(balance)}
+		}
+	}
+	return results, nil
+}
+
+// Metadata returns the standard, name, symbol and decimals of a token on
+// the latest state. ERC-721 tokens are told apart by ERC-165.
+func (a *TokenAPI) Metadata(ctx context.Context, token common.Address) (*Metadata, error) {
+	if metadata, ok := a.metadata.Get(token); ok {
+		return metadata, nil
+	}
+
+	metadata := &Metadata{Address: token, Standard: StandardUnknown}
+	if name, err := a.callString(ctx, token, selectorName); err == nil {
+		metadata.Name = name
+	} else if isInternal(err) {
+		return nil, err
+	}
+	if symbol, err := a.callString(ctx, token, selectorSymbol); err == nil {
+		metadata.Symbol = symbol
+	} else if isInternal(err) {
+		return nil, err
+	}
+
+	input := append(append([]byte{}, selectorSupportsInterface...), common.RightPadBytes(interfaceERC721, 32)...)
+	out, err := a.call(ctx, token, input, nil)
+	if isInternal(err) {
+		return nil, err
+	}
+	if err == nil && len(out) == 32 && new(big.Int).SetBytes(out).Cmp(common.Big1) == 0 {
+		metadata.Standard = StandardERC721
+	} else {
+		out, err := a.call(ctx, token, selectorDecimals, nil)
+		if isInternal(err) {
+			return nil, err
+		}
+		if err == nil && len(out) == 32 {
+			if decimals := new(big.Int).SetBytes(out); decimals.IsUint64() && decimals.Uint64() <= 255 {
+				d := hexutil.Uint(decimals.Uint64())
+				metadata.Decimals = &d
+				metadata.Standard = StandardERC20
+			}
+		}
+	}
+
+	a.metadata.Set(token, metadata, 0)
+	return metadata, nil
+}
+
+// balanceOf returns a balance, from the cache when the block allows it
+func (a *TokenAPI) balanceOf(ctx context.Context, token, owner common.Address, blockNrOrHash *api.BlockNumberOrHash, block string, cacheable bool) (*big.Int, error) {
+	key := balanceKey{token: token, owner: owner, block: block}
+	if cacheable {
+		if balance, ok := a.balances.Get(key); ok {
+			return new(big.Int).Set(balance), nil
+		}
+	}
+
+	input := append(append([]byte{}, selectorBalanceOf...), common.LeftPadBytes(owner.Bytes(), 32)...)
+	out, err := a.call(ctx, token, input, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) < 32 {
+		return nil, &api.RPCError{Code: api.ErrCodeExecutionFailed, Message: fmt.Sprintf("token %s returned no balance", token.Hex())}
+	}
+	balance := new(big.Int).SetBytes(out[:32])
+	if cacheable {
+		a.balances.Set(key, new(big.Int).Set(balance), 0)
+	}
+	return balance, nil
+}
+
+// cacheBlock returns the cache key of the block of a request, and whether
+// calls on it may be cached. Pending calls are not cached.
+func (a *TokenAPI) cacheBlock(ctx context.Context, blockNrOrHash *api.BlockNumberOrHash) (string, bool, error) {
+	bn := api.LatestBlockNumber
+	if blockNrOrHash != nil {
+		if blockNrOrHash.BlockHash != nil {
+			return blockNrOrHash.BlockHash.Hex(), true, nil
+		}
+		if blockNrOrHash.BlockNumber != nil {
+			bn = *blockNrOrHash.BlockNumber
+		}
+	}
+	switch bn {
+	case api.PendingBlockNumber:
+		return "", false, nil
+	case api.LatestBlockNumber:
+		latest, err := a.blockReader.GetLatestBlockNumber(ctx)
+		if err != nil {
+			return "", false, &api.RPCError{Code: api.ErrCodeInternal, Message: fmt.Sprintf("failed to get latest block: %v", err)}
+		}
+		return "latest:" + strconv.FormatUint(latest, 10), true, nil
+	}
+	return strconv.FormatInt(int64(bn), 10), true, nil
+}
+
+// call executes a call of a token
+func (a *TokenAPI) call(ctx context.Context, token common.Address, input []byte, blockNrOrHash *api.BlockNumberOrHash) ([]byte, error) {
+	data := hexutil.Bytes(input)
+	return a.calls.Call(ctx, api.CallArgs{To: &token, Data: &data}, blockNrOrHash)
+}
+
+// callString calls a method returning a string. Tokens returning bytes32
+// instead, such as MKR, are read up to the first zero byte.
+func (a *TokenAPI) callString(ctx context.Context, token common.Address, selector []byte) (string, error) {
+	out, err := a.call(ctx, token, selector, nil)
+	if err != nil {
+		return "", err
+	}
+	if len(out) == 32 {
+		if i := bytes.IndexByte(out, 0); i >= 0 {
+			out = out[:i]
+		}
+		return string(out), nil
+	}
+	values, err := abi.Arguments{{Type: stringType}}.Unpack(out)
+	if err != nil {
+		return "", err
+	}
+	return values[0].(string), nil
+}
+
+// errorMessage returns the message of an error, without the code of RPC
+// errors
+func errorMessage(err error) string {
+	var rpcErr *api.RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Message
+	}
+	return err.Error()
+}
+
+// isInternal reports whether a call failed for reasons other than the
+// token, such as failed state reads or timeouts
+func isInternal(err error) bool {
+	var rpcErr *api.RPCError
+	return errors.As(err, &rpcErr) && rpcErr.Code == api.ErrCodeInternal
+}
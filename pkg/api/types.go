@@ -1,14 +1,20 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"strconv"
 	"strings"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/sunvim/evm_rpc/pkg/txsender"
 )
 
 // Standard JSON-RPC 2.0 error codes
@@ -30,8 +36,36 @@ const (
 	ErrCodeMethodNotSupported = -32005
 	ErrCodeLimitExceeded      = -32006
 	ErrCodeVersionNotSupport  = -32007
+
+	// ErrCodeExecutionReverted reports a call reverted with data, and
+	// ErrCodeExecutionFailed other failed executions, as geth does
+	ErrCodeExecutionReverted = 3
+	ErrCodeExecutionFailed   = -32000
 )
 
+// Error classes group error codes by who has to act on them
+const (
+	ErrClassClient      = "client_error"
+	ErrClassServer      = "server_error"
+	ErrClassRateLimited = "rate_limited"
+	ErrClassNotFound    = "not_found"
+)
+
+// ErrorClass tells whether an error code reports a mistake of the client, a
+// backend failure, a rate limit or missing data
+func ErrorClass(code int) string {
+	switch code {
+	case ErrCodeLimitExceeded:
+		return ErrClassRateLimited
+	case ErrCodeMethodNotFound, ErrCodeUnknownBlock, ErrCodeResourceNotFound:
+		return ErrClassNotFound
+	case ErrCodeInternal, ErrCodeResourceUnavail:
+		return ErrClassServer
+	default:
+		return ErrClassClient
+	}
+}
+
 // RPCError represents a JSON-RPC error
 type RPCError struct {
 	Code    int         `json:"code"`
@@ -48,6 +82,17 @@ func NewRPCError(code int, message string) *RPCError {
 	return &RPCError{Code: code, Message: message}
 }
 
+// NewRevertError reports an execution reverted with data: the message
+// carries the decoded Error(string) or Panic(uint256) reason and the data
+// the raw revert data, so that clients such as ethers.js can show the reason
+func NewRevertError(revert []byte) *RPCError {
+	message := "execution reverted"
+	if reason, err := abi.UnpackRevert(revert); err == nil {
+		message += ": " + reason
+	}
+	return &RPCError{Code: ErrCodeExecutionReverted, Message: message, Data: hexutil.Encode(revert)}
+}
+
 // Common RPC errors
 var (
 	ErrInvalidParams       = NewRPCError(ErrCodeInvalidParams, "invalid params")
@@ -73,6 +118,51 @@ type BlockNumberOrHash struct {
 	RequireCanonical bool     `json:"requireCanonical,omitempty"`
 }
 
+// UnmarshalJSON accepts a block number or tag, a block hash, or an EIP-1898
+// object of the form {"blockHash": ..., "requireCanonical": ...}
+func (b *BlockNumberOrHash) UnmarshalJSON(data []byte) error {
+	var input string
+	if err := json.Unmarshal(data, &input); err == nil {
+		if len(input) == 2+2*common.HashLength {
+			hash := common.HexToHash(input)
+			b.BlockHash = &hash
+			return nil
+		}
+		bn, err := ParseBlockNumber(input)
+		if err != nil {
+			return err
+		}
+		b.BlockNumber = &bn
+		return nil
+	}
+
+	var obj struct {
+		BlockNumber      *string      `json:"blockNumber"`
+		BlockHash        *common.Hash `json:"blockHash"`
+		RequireCanonical bool         `json:"requireCanonical"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	switch {
+	case obj.BlockNumber != nil && obj.BlockHash != nil:
+		return errors.New("cannot specify both blockHash and blockNumber")
+	case obj.BlockHash != nil:
+		b.BlockHash = obj.BlockHash
+		b.RequireCanonical = obj.RequireCanonical
+	case obj.BlockNumber != nil:
+		bn, err := ParseBlockNumber(*obj.BlockNumber)
+		if err != nil {
+			return err
+		}
+		b.BlockNumber = &bn
+	default:
+		return errors.New("either blockHash or blockNumber must be specified")
+	}
+	return nil
+}
+
 // ParseBlockNumber parses a block number string
 func ParseBlockNumber(input string) (BlockNumber, error) {
 	input = strings.TrimSpace(strings.ToLower(input))
@@ -128,10 +218,18 @@ type RPCBlock struct {
 	Uncles           []common.Hash     `json:"uncles"`
 	MixHash          common.Hash       `json:"mixHash"`
 	BaseFeePerGas    *hexutil.Big      `json:"baseFeePerGas,omitempty"`
+
+	WithdrawalsRoot       *common.Hash       `json:"withdrawalsRoot,omitempty"`
+	Withdrawals           *types.Withdrawals `json:"withdrawals,omitempty"`
+	BlobGasUsed           *hexutil.Uint64    `json:"blobGasUsed,omitempty"`
+	ExcessBlobGas         *hexutil.Uint64    `json:"excessBlobGas,omitempty"`
+	ParentBeaconBlockRoot *common.Hash       `json:"parentBeaconBlockRoot,omitempty"`
 }
 
-// NewRPCBlock creates an RPCBlock from a types.Block
-func NewRPCBlock(block *types.Block, fullTx bool, td *big.Int) *RPCBlock {
+// NewRPCBlock creates an RPCBlock from a types.Block. The fields added by
+// Shanghai and Cancun are rendered when the chain config has them active at
+// the block.
+func NewRPCBlock(block *types.Block, fullTx bool, td *big.Int, chainConfig *params.ChainConfig) *RPCBlock {
 	head := block.Header()
 	hash := head.Hash()
 	
@@ -164,6 +262,31 @@ func NewRPCBlock(block *types.Block, fullTx bool, td *big.Int) *RPCBlock {
 		rpcBlock.BaseFeePerGas = (*hexutil.Big)(head.BaseFee)
 	}
 
+	if chainConfig.IsShanghai(head.Number, head.Time) {
+		withdrawalsRoot := types.EmptyWithdrawalsHash
+		if head.WithdrawalsHash != nil {
+			withdrawalsRoot = *head.WithdrawalsHash
+		}
+		withdrawals := block.Withdrawals()
+		if withdrawals == nil {
+			withdrawals = types.Withdrawals{}
+		}
+		rpcBlock.WithdrawalsRoot = &withdrawalsRoot
+		rpcBlock.Withdrawals = &withdrawals
+	}
+	if chainConfig.IsCancun(head.Number, head.Time) {
+		var blobGasUsed, excessBlobGas hexutil.Uint64
+		if head.BlobGasUsed != nil {
+			blobGasUsed = hexutil.Uint64(*head.BlobGasUsed)
+		}
+		if head.ExcessBlobGas != nil {
+			excessBlobGas = hexutil.Uint64(*head.ExcessBlobGas)
+		}
+		rpcBlock.BlobGasUsed = &blobGasUsed
+		rpcBlock.ExcessBlobGas = &excessBlobGas
+		rpcBlock.ParentBeaconBlockRoot = head.ParentBeaconRoot
+	}
+
 	if fullTx {
 		txs := make([]*RPCTransaction, len(block.Transactions()))
 		for i, tx := range block.Transactions() {
@@ -206,7 +329,7 @@ type RPCTransaction struct {
 // NewRPCTransaction creates an RPCTransaction from a types.Transaction
 func NewRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber uint64, index uint64) *RPCTransaction {
 	v, r, s := tx.RawSignatureValues()
-	from, _ := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	from, _ := txsender.Recover(tx)
 
 	result := &RPCTransaction{
 		Type:     hexutil.Uint64(tx.Type()),
@@ -262,13 +385,14 @@ type RPCReceipt struct {
 	Logs              []*types.Log    `json:"logs"`
 	LogsBloom         types.Bloom     `json:"logsBloom"`
 	Type              hexutil.Uint64  `json:"type"`
-	Status            hexutil.Uint64  `json:"status"`
+	Root              hexutil.Bytes   `json:"root,omitempty"`   // post-state root of pre-Byzantium receipts
+	Status            *hexutil.Uint64 `json:"status,omitempty"` // set for Byzantium and later receipts
 	EffectiveGasPrice *hexutil.Big    `json:"effectiveGasPrice,omitempty"`
 }
 
 // NewRPCReceipt creates an RPCReceipt from a types.Receipt
 func NewRPCReceipt(receipt *types.Receipt, tx *types.Transaction, blockHash common.Hash, blockNumber uint64, index uint64) *RPCReceipt {
-	from, _ := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	from, _ := txsender.Recover(tx)
 
 	rpcReceipt := &RPCReceipt{
 		TransactionHash:   tx.Hash(),
@@ -283,24 +407,32 @@ func NewRPCReceipt(receipt *types.Receipt, tx *types.Transaction, blockHash comm
 		Logs:              receipt.Logs,
 		LogsBloom:         receipt.Bloom,
 		Type:              hexutil.Uint64(tx.Type()),
-		Status:            hexutil.Uint64(receipt.Status),
 	}
 
 	if receipt.Logs == nil {
 		rpcReceipt.Logs = []*types.Log{}
 	}
 
+	// Receipts before Byzantium carry the post-state root instead of a
+	// status, as geth renders them
+	if len(receipt.PostState) > 0 {
+		rpcReceipt.Root = receipt.PostState
+	} else {
+		status := hexutil.Uint64(receipt.Status)
+		rpcReceipt.Status = &status
+	}
+
 	// Set contract address if this is a contract creation
 	if tx.To() == nil && len(receipt.ContractAddress) > 0 {
 		rpcReceipt.ContractAddress = &receipt.ContractAddress
 	}
 
-	// Calculate effective gas price
-	if tx.Type() == types.DynamicFeeTxType {
-		if receipt.EffectiveGasPrice != nil {
-			rpcReceipt.EffectiveGasPrice = (*hexutil.Big)(receipt.EffectiveGasPrice)
-		}
-	} else {
+	// Receipts read from storage carry the effective gas price derived from
+	// the base fee of their block; without one, legacy transactions paid
+	// their gas price
+	if receipt.EffectiveGasPrice != nil {
+		rpcReceipt.EffectiveGasPrice = (*hexutil.Big)(receipt.EffectiveGasPrice)
+	} else if tx.Type() == types.LegacyTxType || tx.Type() == types.AccessListTxType {
 		rpcReceipt.EffectiveGasPrice = (*hexutil.Big)(tx.GasPrice())
 	}
 
@@ -315,6 +447,31 @@ type FeeHistoryResult struct {
 	Reward       [][]*hexutil.Big `json:"reward,omitempty"`
 }
 
+// BaseFeeResult represents the result of eth_baseFee
+type BaseFeeResult struct {
+	BlockNumber       hexutil.Uint64 `json:"blockNumber"`
+	BaseFeePerGas     *hexutil.Big   `json:"baseFeePerGas"`
+	NextBaseFeePerGas *hexutil.Big   `json:"nextBaseFeePerGas"`
+}
+
+// GasPricesResult represents the result of eth_gasPrices
+type GasPricesResult struct {
+	BlockNumber         hexutil.Uint64 `json:"blockNumber"`
+	BaseFeePerGas       *hexutil.Big   `json:"baseFeePerGas"` // of the next block
+	Slow                *GasPriceTier  `json:"slow"`
+	Standard            *GasPriceTier  `json:"standard"`
+	Fast                *GasPriceTier  `json:"fast"`
+	PendingTransactions hexutil.Uint64 `json:"pendingTransactions"`
+}
+
+// GasPriceTier is a fee suggestion of eth_gasPrices, for dynamic fee and
+// legacy transactions
+type GasPriceTier struct {
+	MaxPriorityFeePerGas *hexutil.Big `json:"maxPriorityFeePerGas"`
+	MaxFeePerGas         *hexutil.Big `json:"maxFeePerGas"`
+	GasPrice             *hexutil.Big `json:"gasPrice"`
+}
+
 // CallArgs represents the arguments for a call
 type CallArgs struct {
 	From                 *common.Address `json:"from"`
@@ -326,3 +483,79 @@ type CallArgs struct {
 	Value                *hexutil.Big    `json:"value"`
 	Data                 *hexutil.Bytes  `json:"data"`
 }
+
+// TransactionArgs represents the arguments to construct a new transaction,
+// as taken by eth_sendTransaction and eth_signTransaction
+type TransactionArgs struct {
+	From                 *common.Address   `json:"from"`
+	To                   *common.Address   `json:"to"`
+	Gas                  *hexutil.Uint64   `json:"gas"`
+	GasPrice             *hexutil.Big      `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big      `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big      `json:"maxPriorityFeePerGas"`
+	Value                *hexutil.Big      `json:"value"`
+	Nonce                *hexutil.Uint64   `json:"nonce"`
+	Data                 *hexutil.Bytes    `json:"data"`
+	Input                *hexutil.Bytes    `json:"input"`
+	AccessList           *types.AccessList `json:"accessList,omitempty"`
+	ChainID              *hexutil.Big      `json:"chainId,omitempty"`
+}
+
+// CallData returns the input of the transaction; input takes precedence
+// over data as in geth
+func (args *TransactionArgs) CallData() []byte {
+	if args.Input != nil {
+		return *args.Input
+	}
+	if args.Data != nil {
+		return *args.Data
+	}
+	return nil
+}
+
+// SignTransactionResult represents the result of eth_signTransaction
+type SignTransactionResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+// TypedData is the EIP-712 typed data of eth_signTypedData_v4
+type TypedData struct {
+	apitypes.TypedData
+}
+
+// UnmarshalJSON accepts the typed data as an object or, as MetaMask and
+// ethers send it, as a string holding its JSON
+func (t *TypedData) UnmarshalJSON(data []byte) error {
+	var input string
+	if err := json.Unmarshal(data, &input); err == nil {
+		data = []byte(input)
+	}
+	return json.Unmarshal(data, &t.TypedData)
+}
+
+// AccountResult represents the account returned by eth_getAccount. The
+// storage root is only known for accounts without code, whose storage is
+// empty, since storage tries are not kept.
+type AccountResult struct {
+	CodeHash    common.Hash    `json:"codeHash"`
+	StorageRoot *common.Hash   `json:"storageRoot,omitempty"`
+	Balance     *hexutil.Big   `json:"balance"`
+	Nonce       hexutil.Uint64 `json:"nonce"`
+}
+
+// RPCSyncStatus represents the progress object returned by eth_syncing
+type RPCSyncStatus struct {
+	StartingBlock hexutil.Uint64 `json:"startingBlock"`
+	CurrentBlock  hexutil.Uint64 `json:"currentBlock"`
+	HighestBlock  hexutil.Uint64 `json:"highestBlock"`
+}
+
+// NewRPCSyncStatus creates an RPCSyncStatus from block heights
+func NewRPCSyncStatus(startingBlock, currentBlock, highestBlock uint64) *RPCSyncStatus {
+	return &RPCSyncStatus{
+		StartingBlock: hexutil.Uint64(startingBlock),
+		CurrentBlock:  hexutil.Uint64(currentBlock),
+		HighestBlock:  hexutil.Uint64(highestBlock),
+	}
+}
@@ -3,6 +3,7 @@ package web3
 import (
 	"context"
 	"fmt"
+	"runtime"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -10,22 +11,32 @@ import (
 
 // Web3API provides web3-related RPC methods
 type Web3API struct {
-	version string
+	clientVersion string
 }
 
-// NewWeb3API creates a new Web3API
-func NewWeb3API(version string) *Web3API {
+// NewWeb3API creates a new Web3API reporting the given build
+func NewWeb3API(version, commit string) *Web3API {
+	return &Web3API{
+		clientVersion: clientVersion(version, commit),
+	}
+}
+
+// clientVersion renders a version string in geth's format, e.g.
+// evm-rpc/v1.0.0-3f2a9c1/linux-amd64/go1.24.0, which monitoring systems
+// parse to track the versions of a fleet
+func clientVersion(version, commit string) string {
 	if version == "" {
 		version = "1.0.0"
 	}
-	return &Web3API{
-		version: version,
+	if commit != "" && commit != "unknown" {
+		version += "-" + commit
 	}
+	return fmt.Sprintf("evm-rpc/%s/%s-%s/%s", version, runtime.GOOS, runtime.GOARCH, runtime.Version())
 }
 
 // ClientVersion returns the current client version
 func (api *Web3API) ClientVersion(ctx context.Context) (string, error) {
-	return fmt.Sprintf("evm-rpc/%s", api.version), nil
+	return api.clientVersion, nil
 }
 
 // Sha3 returns the Keccak-256 hash of the given data
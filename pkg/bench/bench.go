@@ -0,0 +1,267 @@
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/time/rate"
+)
+
+// DefaultMix is a read-heavy mix resembling the traffic of a public endpoint
+const DefaultMix = "eth_blockNumber=10,eth_getBalance=15,eth_call=20,eth_getTransactionReceipt=15," +
+	"eth_getTransactionByHash=10,eth_getBlockByNumber=10,eth_getLogs=10,eth_getTransactionCount=5," +
+	"eth_estimateGas=3,eth_chainId=2"
+
+// maxFailureReasons bounds the distinct failure messages counted; further
+// ones are counted as other
+const maxFailureReasons = 20
+
+// Weight is the share of a method in a mix
+type Weight struct {
+	Method string
+	Weight int
+}
+
+// Mix is a weighted set of methods
+type Mix struct {
+	weights []Weight
+	total   int
+}
+
+// ParseMix parses a mix of the form method=weight,method=weight
+func ParseMix(s string) (*Mix, error) {
+	mix := &Mix{}
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		method, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not method=weight", entry)
+		}
+		method = strings.TrimSpace(method)
+		if _, ok := Generators[method]; !ok {
+			return nil, fmt.Errorf("method %s cannot be benchmarked, choose from %s", method, strings.Join(Methods(), ", "))
+		}
+		if seen[method] {
+			return nil, fmt.Errorf("method %s is listed twice", method)
+		}
+		seen[method] = true
+		weight, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("weight of %s must be a positive integer", method)
+		}
+		mix.weights = append(mix.weights, Weight{Method: method, Weight: weight})
+		mix.total += weight
+	}
+	if len(mix.weights) == 0 {
+		return nil, errors.New("mix lists no methods")
+	}
+	return mix, nil
+}
+
+// Weights returns the methods of the mix with their weights
+func (m *Mix) Weights() []Weight {
+	return m.weights
+}
+
+// pick picks a method at random by weight
+func (m *Mix) pick(r *rand.Rand) string {
+	n := r.Intn(m.total)
+	for _, w := range m.weights {
+		if n < w.Weight {
+			return w.Method
+		}
+		n -= w.Weight
+	}
+	return m.weights[len(m.weights)-1].Method
+}
+
+// Options configure a benchmark
+type Options struct {
+	Mix         *Mix
+	Concurrency int           // calls in flight
+	Duration    time.Duration // calls are started until it elapses
+	Rate        float64       // calls per second over all workers, 0 for no limit
+	Timeout     time.Duration // of every call
+	Seed        int64         // of the params drawn from the fixture
+}
+
+// Stats describe the calls of a method
+type Stats struct {
+	Method    string
+	Calls     int
+	Errors    int            // answered with a JSON-RPC error
+	Failures  int            // timed out or failed in transport
+	Codes     map[int]int    // JSON-RPC error codes and how often they were returned
+	Reasons   map[string]int // failure messages and how often they occurred
+	latencies []time.Duration
+}
+
+// ErrorRate returns the share of calls that returned an error or failed
+func (s *Stats) ErrorRate() float64 {
+	if s.Calls == 0 {
+		return 0
+	}
+	return float64(s.Errors+s.Failures) / float64(s.Calls)
+}
+
+// Percentile returns the latency that p percent of the answered calls,
+// with results or errors, stayed within
+func (s *Stats) Percentile(p float64) time.Duration {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(s.latencies))*p/100+0.5) - 1
+	return s.latencies[max(0, min(i, len(s.latencies)-1))]
+}
+
+// merge adds the calls of other to s
+func (s *Stats) merge(other *Stats) {
+	s.Calls += other.Calls
+	s.Errors += other.Errors
+	s.Failures += other.Failures
+	for code, n := range other.Codes {
+		s.Codes[code] += n
+	}
+	for reason, n := range other.Reasons {
+		s.addFailure(reason, n)
+	}
+	s.latencies = append(s.latencies, other.latencies...)
+}
+
+// addFailure counts n failures with a message
+func (s *Stats) addFailure(reason string, n int) {
+	if _, ok := s.Reasons[reason]; !ok && len(s.Reasons) >= maxFailureReasons {
+		reason = "other"
+	}
+	s.Reasons[reason] += n
+}
+
+func newStats(method string) *Stats {
+	return &Stats{Method: method, Codes: make(map[int]int), Reasons: make(map[string]int)}
+}
+
+// Report is the outcome of a benchmark
+type Report struct {
+	Elapsed time.Duration
+	Methods []*Stats // sorted by method
+	Total   *Stats
+}
+
+// Throughput returns the calls made per second
+func (r *Report) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Total.Calls) / r.Elapsed.Seconds()
+}
+
+// Dial connects to the JSON-RPC endpoint at url, keeping enough idle
+// connections for concurrency calls in flight
+func Dial(ctx context.Context, url string, concurrency int) (*rpc.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = concurrency
+	return rpc.DialOptions(ctx, url, rpc.WithHTTPClient(&http.Client{Transport: transport}))
+}
+
+// Run calls the methods of the mix with params drawn from fixture until the
+// duration elapses or ctx is done
+func Run(ctx context.Context, caller Caller, fixture *Fixture, opts Options) *Report {
+	ctx, cancel := context.WithTimeout(ctx, opts.Duration)
+	defer cancel()
+
+	var limiter *rate.Limiter
+	if opts.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.Rate), max(1, int(opts.Rate/10)))
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		merged = make(map[string]*Stats)
+	)
+	start := time.Now()
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func(r *rand.Rand) {
+			defer wg.Done()
+			stats := runWorker(ctx, caller, fixture, opts, limiter, r)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for method, s := range stats {
+				if merged[method] == nil {
+					merged[method] = newStats(method)
+				}
+				merged[method].merge(s)
+			}
+		}(rand.New(rand.NewSource(opts.Seed + int64(i))))
+	}
+	wg.Wait()
+
+	report := &Report{Elapsed: time.Since(start), Total: newStats("total")}
+	for _, s := range merged {
+		sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+		report.Methods = append(report.Methods, s)
+		report.Total.merge(s)
+	}
+	sort.Slice(report.Methods, func(i, j int) bool { return report.Methods[i].Method < report.Methods[j].Method })
+	sort.Slice(report.Total.latencies, func(i, j int) bool { return report.Total.latencies[i] < report.Total.latencies[j] })
+	return report
+}
+
+// runWorker makes calls one after another until ctx is done
+func runWorker(ctx context.Context, caller Caller, fixture *Fixture, opts Options, limiter *rate.Limiter, r *rand.Rand) map[string]*Stats {
+	stats := make(map[string]*Stats)
+	for {
+		if limiter != nil && limiter.Wait(ctx) != nil {
+			return stats
+		}
+		if ctx.Err() != nil {
+			return stats
+		}
+		method := opts.Mix.pick(r)
+		params := Generators[method](r, fixture)
+
+		// Calls in flight when the duration elapses complete, so that the
+		// slowest calls are not left out of the percentiles
+		callCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), opts.Timeout)
+		var result json.RawMessage
+		started := time.Now()
+		err := caller.CallContext(callCtx, &result, method, params...)
+		latency := time.Since(started)
+		cancel()
+
+		s := stats[method]
+		if s == nil {
+			s = newStats(method)
+			stats[method] = s
+		}
+		s.Calls++
+		var rpcErr rpc.Error
+		switch {
+		case err == nil:
+			s.latencies = append(s.latencies, latency)
+		case errors.As(err, &rpcErr):
+			s.Errors++
+			s.Codes[rpcErr.ErrorCode()]++
+			s.latencies = append(s.latencies, latency)
+		default:
+			s.Failures++
+			s.addFailure(strings.TrimSpace(err.Error()), 1)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix(" eth_call=3, eth_getBalance=1 ,")
+	if err != nil {
+		t.Fatalf("ParseMix: %v", err)
+	}
+	weights := mix.Weights()
+	if len(weights) != 2 || weights[0] != (Weight{"eth_call", 3}) || weights[1] != (Weight{"eth_getBalance", 1}) {
+		t.Fatalf("weights = %+v", weights)
+	}
+
+	// Picks follow the weights
+	counts := make(map[string]int)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		counts[mix.pick(r)]++
+	}
+	if share := float64(counts["eth_call"]) / 10000; share < 0.72 || share > 0.78 {
+		t.Fatalf("eth_call picked %.3f of the time, want 0.75", share)
+	}
+
+	if _, err := ParseMix(DefaultMix); err != nil {
+		t.Fatalf("DefaultMix: %v", err)
+	}
+	for _, invalid := range []string{"", "eth_call", "eth_call=0", "eth_call=x", "eth_sendRawTransaction=1", "eth_call=1,eth_call=2"} {
+		if _, err := ParseMix(invalid); err == nil {
+			t.Errorf("ParseMix(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	s := newStats("eth_call")
+	for i := 1; i <= 100; i++ {
+		s.latencies = append(s.latencies, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{50: 50 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond, 0: time.Millisecond} {
+		if got := s.Percentile(p); got != want {
+			t.Errorf("Percentile(%v) = %s, want %s", p, got, want)
+		}
+	}
+	if got := newStats("eth_call").Percentile(50); got != 0 {
+		t.Errorf("Percentile of no calls = %s", got)
+	}
+}
+
+// testError is a JSON-RPC error
+type testError struct{ code int }
+
+func (e testError) Error() string  { return "test error" }
+func (e testError) ErrorCode() int { return e.code }
+
+// testCaller answers eth_call with an error, fails eth_chainId and answers
+// everything else
+type testCaller struct {
+	calls atomic.Int64
+}
+
+func (c *testCaller) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	c.calls.Add(1)
+	switch method {
+	case "eth_call":
+		return testError{code: 3}
+	case "eth_chainId":
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	mix, err := ParseMix("eth_call=1,eth_chainId=1,eth_blockNumber=2")
+	if err != nil {
+		t.Fatalf("ParseMix: %v", err)
+	}
+	caller := &testCaller{}
+	report := Run(context.Background(), caller, &Fixture{}, Options{
+		Mix:         mix,
+		Concurrency: 4,
+		Duration:    100 * time.Millisecond,
+		Rate:        1000,
+		Timeout:     time.Second,
+	})
+
+	if report.Total.Calls == 0 || int64(report.Total.Calls) != caller.calls.Load() {
+		t.Fatalf("report counts %d calls, %d were made", report.Total.Calls, caller.calls.Load())
+	}
+	// The rate limits the calls to about 100, plus the burst
+	if report.Total.Calls > 250 {
+		t.Fatalf("%d calls made at 1000/s in 100ms", report.Total.Calls)
+	}
+
+	var methods []string
+	for _, s := range report.Methods {
+		methods = append(methods, s.Method)
+		switch s.Method {
+		case "eth_call":
+			if s.Errors != s.Calls || s.Codes[3] != s.Calls || s.ErrorRate() != 1 || len(s.latencies) != s.Calls {
+				t.Errorf("eth_call stats = %+v", s)
+			}
+		case "eth_chainId":
+			if s.Failures != s.Calls || s.ErrorRate() != 1 || len(s.latencies) != 0 {
+				t.Errorf("eth_chainId stats = %+v", s)
+			}
+		case "eth_blockNumber":
+			if s.Errors != 0 || s.Failures != 0 || s.Percentile(100) <= 0 {
+				t.Errorf("eth_blockNumber stats = %+v", s)
+			}
+		}
+	}
+	if got := strings.Join(methods, ","); got != "eth_blockNumber,eth_call,eth_chainId" {
+		t.Fatalf("methods = %s", got)
+	}
+}
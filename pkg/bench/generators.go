@@ -0,0 +1,189 @@
+// Package bench load-tests a JSON-RPC endpoint with weighted mixes of calls
+// whose params are drawn from the chain the endpoint serves
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// maxFixtureTxs bounds the transactions kept by a fixture
+const maxFixtureTxs = 10000
+
+// Caller makes JSON-RPC calls; *rpc.Client is one
+type Caller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// Fixture holds chain data that generated params refer to, so that calls
+// hit blocks, transactions and accounts that exist
+type Fixture struct {
+	Head      uint64
+	Blocks    []FixtureBlock
+	Txs       []common.Hash
+	Addresses []common.Address // senders and recipients of the transactions
+	Calls     []FixtureCall    // transactions carrying calldata
+}
+
+// FixtureBlock is a sampled block
+type FixtureBlock struct {
+	Number uint64
+	Hash   common.Hash
+}
+
+// FixtureCall is the target and calldata of a sampled transaction
+type FixtureCall struct {
+	From common.Address
+	To   common.Address
+	Data hexutil.Bytes
+}
+
+// SampleFixture reads the latest blocks, up to blocks of them, with their
+// transactions
+func SampleFixture(ctx context.Context, caller Caller, blocks int) (*Fixture, error) {
+	var head hexutil.Uint64
+	if err := caller.CallContext(ctx, &head, "eth_blockNumber"); err != nil {
+		return nil, fmt.Errorf("failed to read the latest block: %w", err)
+	}
+
+	f := &Fixture{Head: uint64(head)}
+	addresses := make(map[common.Address]struct{})
+	for i := 0; i < blocks && uint64(i) <= f.Head; i++ {
+		number := f.Head - uint64(i)
+		var block *struct {
+			Hash         common.Hash `json:"hash"`
+			Transactions []struct {
+				Hash  common.Hash     `json:"hash"`
+				From  common.Address  `json:"from"`
+				To    *common.Address `json:"to"`
+				Input hexutil.Bytes   `json:"input"`
+			} `json:"transactions"`
+		}
+		if err := caller.CallContext(ctx, &block, "eth_getBlockByNumber", hexutil.Uint64(number), true); err != nil {
+			return nil, fmt.Errorf("failed to read block %d: %w", number, err)
+		}
+		if block == nil {
+			continue
+		}
+		f.Blocks = append(f.Blocks, FixtureBlock{Number: number, Hash: block.Hash})
+		for _, tx := range block.Transactions {
+			if len(f.Txs) >= maxFixtureTxs {
+				break
+			}
+			f.Txs = append(f.Txs, tx.Hash)
+			addresses[tx.From] = struct{}{}
+			if tx.To == nil {
+				continue
+			}
+			addresses[*tx.To] = struct{}{}
+			if len(tx.Input) > 0 {
+				f.Calls = append(f.Calls, FixtureCall{From: tx.From, To: *tx.To, Data: tx.Input})
+			}
+		}
+	}
+
+	for addr := range addresses {
+		f.Addresses = append(f.Addresses, addr)
+	}
+	// Map order is random; sorting keeps a seeded run reproducible
+	sort.Slice(f.Addresses, func(i, j int) bool {
+		return f.Addresses[i].Cmp(f.Addresses[j]) < 0
+	})
+	return f, nil
+}
+
+// block picks a sampled block, or the genesis block if none was sampled
+func (f *Fixture) block(r *rand.Rand) FixtureBlock {
+	if len(f.Blocks) == 0 {
+		return FixtureBlock{}
+	}
+	return f.Blocks[r.Intn(len(f.Blocks))]
+}
+
+// tx picks a sampled transaction, or the zero hash if there is none
+func (f *Fixture) tx(r *rand.Rand) common.Hash {
+	if len(f.Txs) == 0 {
+		return common.Hash{}
+	}
+	return f.Txs[r.Intn(len(f.Txs))]
+}
+
+// address picks a sampled address, or the zero address if there is none
+func (f *Fixture) address(r *rand.Rand) common.Address {
+	if len(f.Addresses) == 0 {
+		return common.Address{}
+	}
+	return f.Addresses[r.Intn(len(f.Addresses))]
+}
+
+// call picks the calldata of a sampled transaction, or else an empty call
+// to a sampled address
+func (f *Fixture) call(r *rand.Rand) map[string]interface{} {
+	if len(f.Calls) == 0 {
+		return map[string]interface{}{"to": f.address(r)}
+	}
+	call := f.Calls[r.Intn(len(f.Calls))]
+	return map[string]interface{}{"from": call.From, "to": call.To, "data": call.Data}
+}
+
+// Generator makes the params of a call from a fixture
+type Generator func(r *rand.Rand, f *Fixture) []interface{}
+
+// Generators make the params of the methods that can be benchmarked. The
+// test suite calls every one of them, so that they stay valid.
+var Generators = map[string]Generator{
+	"eth_blockNumber": func(r *rand.Rand, f *Fixture) []interface{} { return nil },
+	"eth_chainId":     func(r *rand.Rand, f *Fixture) []interface{} { return nil },
+	"eth_gasPrice":    func(r *rand.Rand, f *Fixture) []interface{} { return nil },
+	"eth_feeHistory": func(r *rand.Rand, f *Fixture) []interface{} {
+		return []interface{}{hexutil.Uint64(1 + r.Intn(16)), "latest", []float64{25, 75}}
+	},
+	"eth_getBlockByNumber": func(r *rand.Rand, f *Fixture) []interface{} {
+		return []interface{}{hexutil.Uint64(f.block(r).Number), false}
+	},
+	"eth_getBlockByHash": func(r *rand.Rand, f *Fixture) []interface{} {
+		return []interface{}{f.block(r).Hash, false}
+	},
+	"eth_getTransactionByHash": func(r *rand.Rand, f *Fixture) []interface{} {
+		return []interface{}{f.tx(r)}
+	},
+	"eth_getTransactionReceipt": func(r *rand.Rand, f *Fixture) []interface{} {
+		return []interface{}{f.tx(r)}
+	},
+	"eth_getBalance": func(r *rand.Rand, f *Fixture) []interface{} {
+		return []interface{}{f.address(r), "latest"}
+	},
+	"eth_getTransactionCount": func(r *rand.Rand, f *Fixture) []interface{} {
+		return []interface{}{f.address(r), "latest"}
+	},
+	"eth_getCode": func(r *rand.Rand, f *Fixture) []interface{} {
+		return []interface{}{f.address(r), "latest"}
+	},
+	"eth_getLogs": func(r *rand.Rand, f *Fixture) []interface{} {
+		number := hexutil.Uint64(f.block(r).Number)
+		return []interface{}{map[string]interface{}{"fromBlock": number, "toBlock": number}}
+	},
+	"eth_call": func(r *rand.Rand, f *Fixture) []interface{} {
+		return []interface{}{f.call(r), "latest"}
+	},
+	"eth_estimateGas": func(r *rand.Rand, f *Fixture) []interface{} {
+		// A plain transfer, as the calldata of a sampled transaction may
+		// revert at the latest block
+		return []interface{}{map[string]interface{}{"from": f.address(r), "to": f.address(r)}}
+	},
+}
+
+// Methods returns the methods that can be benchmarked, sorted
+func Methods() []string {
+	methods := make([]string, 0, len(Generators))
+	for method := range Generators {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
@@ -0,0 +1,198 @@
+// Package blockio streams blocks and receipts between Pika and RLP export
+// files or another RPC endpoint, for backfills, migrations between storage
+// deployments and disaster recovery
+package blockio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/ingest"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+const (
+	// exportBatchSize is the number of blocks read from Pika per round trip
+	exportBatchSize = 100
+
+	// progressInterval is how often long-running transfers log progress
+	progressInterval = 8 * time.Second
+)
+
+// Source yields records in ascending block order
+type Source interface {
+	// Next returns the next record, or io.EOF once the source is exhausted
+	Next(ctx context.Context) (*Record, error)
+}
+
+// Export writes the stored blocks in [from, to] with their receipts to w and
+// returns the number of blocks written. Blocks missing from storage abort
+// the export, since the file would otherwise silently have gaps.
+func Export(ctx context.Context, reader *storage.BlockReader, w *FileWriter, from, to uint64) (uint64, error) {
+	progress := newProgress("Exported")
+
+	for start := from; start <= to; start += exportBatchSize {
+		end := min(start+exportBatchSize-1, to)
+
+		blocks, err := reader.GetBlocksRange(ctx, start, end)
+		if err != nil {
+			return progress.count, fmt.Errorf("failed to read blocks %d-%d: %w", start, end, err)
+		}
+		receipts, err := reader.GetReceiptsRange(ctx, start, end)
+		if err != nil {
+			return progress.count, fmt.Errorf("failed to read receipts %d-%d: %w", start, end, err)
+		}
+
+		for i, block := range blocks {
+			number := start + uint64(i)
+			if block == nil || receipts[i] == nil {
+				return progress.count, fmt.Errorf("block %d is missing from storage", number)
+			}
+
+			td, err := reader.GetTotalDifficulty(ctx, number, block.Hash())
+			if err != nil && err != storage.ErrNotFound {
+				return progress.count, fmt.Errorf("failed to read total difficulty of block %d: %w", number, err)
+			}
+
+			if err := w.Write(&Record{Block: block, Receipts: receipts[i], TD: td}); err != nil {
+				return progress.count, fmt.Errorf("failed to write block %d: %w", number, err)
+			}
+			progress.add(number)
+		}
+
+		// Guard against wrapping past the top of the range
+		if end == to {
+			break
+		}
+	}
+
+	progress.done()
+	return progress.count, nil
+}
+
+// Import writes every record from src to Pika and returns the number of
+// blocks written. The latest block is only advanced when the imported
+// blocks extend the stored chain without a gap, so a backfill of old
+// history never moves the head.
+func Import(ctx context.Context, reader *storage.BlockReader, writer *storage.BlockWriter, src Source) (uint64, error) {
+	progress := newProgress("Imported")
+
+	var first, last uint64
+	for {
+		rec, err := src.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return progress.count, err
+		}
+
+		number := rec.Block.NumberU64()
+		if err := writer.WriteBlock(ctx, rec.Block, rec.Receipts, rec.TD); err != nil {
+			return progress.count, err
+		}
+		if progress.count == 0 {
+			first = number
+		}
+		last = number
+		progress.add(number)
+	}
+	progress.done()
+
+	if progress.count == 0 {
+		return 0, nil
+	}
+
+	latest, err := reader.GetLatestBlockNumber(ctx)
+	switch {
+	case err == storage.ErrNotFound:
+		if first != 0 {
+			logger.Warnf("Imported blocks start at %d with no stored chain below them, latest block left unset", first)
+			return progress.count, nil
+		}
+	case err != nil:
+		return progress.count, fmt.Errorf("failed to read latest block: %w", err)
+	case last <= latest:
+		return progress.count, nil
+	case first > latest+1:
+		logger.Warnf("Imported blocks start at %d, leaving a gap after stored head %d; latest block left unchanged", first, latest)
+		return progress.count, nil
+	}
+
+	if err := writer.SetLatest(ctx, last); err != nil {
+		return progress.count, fmt.Errorf("failed to set latest block: %w", err)
+	}
+	logger.Infof("Latest block set to %d", last)
+	return progress.count, nil
+}
+
+// UpstreamSource reads the blocks in a range from another RPC endpoint
+type UpstreamSource struct {
+	upstream *ingest.Upstream
+	next     uint64
+	to       uint64
+	done     bool
+}
+
+// NewUpstreamSource creates a source for the blocks in [from, to]
+func NewUpstreamSource(upstream *ingest.Upstream, from, to uint64) *UpstreamSource {
+	return &UpstreamSource{upstream: upstream, next: from, to: to, done: from > to}
+}
+
+// Next fetches the next block with its receipts and total difficulty
+func (s *UpstreamSource) Next(ctx context.Context) (*Record, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+
+	block, err := s.upstream.Block(ctx, s.next)
+	if err != nil {
+		return nil, err
+	}
+	receipts, err := s.upstream.Receipts(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.next == s.to {
+		s.done = true
+	} else {
+		s.next++
+	}
+	return &Record{
+		Block:    block,
+		Receipts: receipts,
+		TD:       s.upstream.TotalDifficulty(ctx, block.Hash()),
+	}, nil
+}
+
+// progress periodically logs how far a transfer has got
+type progress struct {
+	verb    string
+	count   uint64
+	last    uint64
+	started time.Time
+	logged  time.Time
+}
+
+func newProgress(verb string) *progress {
+	now := time.Now()
+	return &progress{verb: verb, started: now, logged: now}
+}
+
+func (p *progress) add(number uint64) {
+	p.count++
+	p.last = number
+	if time.Since(p.logged) >= progressInterval {
+		p.logged = time.Now()
+		logger.Infof("%s %d blocks, at block %d (%s elapsed)", p.verb, p.count, p.last, time.Since(p.started).Round(time.Second))
+	}
+}
+
+func (p *progress) done() {
+	logger.Infof("%s %d blocks in %s", p.verb, p.count, time.Since(p.started).Round(time.Second))
+}
@@ -0,0 +1,113 @@
+package blockio
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Record is one block in an export file: the block with its receipts and,
+// if known, its total difficulty
+type Record struct {
+	Block    *types.Block
+	Receipts types.Receipts
+	TD       *big.Int `rlp:"optional"`
+}
+
+// FileWriter appends records to an RLP export file. Files ending in .gz are
+// gzip compressed.
+type FileWriter struct {
+	file *os.File
+	gz   *gzip.Writer
+	buf  *bufio.Writer
+}
+
+// CreateFile creates or truncates an export file
+func CreateFile(path string) (*FileWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	w := &FileWriter{file: file}
+	if strings.HasSuffix(path, ".gz") {
+		w.gz = gzip.NewWriter(file)
+		w.buf = bufio.NewWriter(w.gz)
+	} else {
+		w.buf = bufio.NewWriter(file)
+	}
+	return w, nil
+}
+
+// Write appends a record
+func (w *FileWriter) Write(rec *Record) error {
+	return rlp.Encode(w.buf, rec)
+}
+
+// Close flushes buffered records and closes the file
+func (w *FileWriter) Close() error {
+	err := w.buf.Flush()
+	if w.gz != nil {
+		err = errors.Join(err, w.gz.Close())
+	}
+	return errors.Join(err, w.file.Close())
+}
+
+// FileReader reads records back from an export file
+type FileReader struct {
+	file   *os.File
+	gz     *gzip.Reader
+	stream *rlp.Stream
+}
+
+// OpenFile opens an export file written by FileWriter
+func OpenFile(path string) (*FileReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	r := &FileReader{file: file}
+	var src io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		if r.gz, err = gzip.NewReader(file); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		src = r.gz
+	}
+	r.stream = rlp.NewStream(bufio.NewReader(src), 0)
+	return r, nil
+}
+
+// Next returns the next record, or io.EOF at the end of the file
+func (r *FileReader) Next(ctx context.Context) (*Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var rec Record
+	if err := r.stream.Decode(&rec); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to decode record: %w", err)
+	}
+	return &rec, nil
+}
+
+// Close closes the file
+func (r *FileReader) Close() error {
+	if r.gz != nil {
+		r.gz.Close()
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,183 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// Publisher delivers events to a message broker. key groups related
+// messages, such as those of a block, where the broker supports it.
+type Publisher interface {
+	Publish(ctx context.Context, topic, key string, payload []byte) error
+	Close() error
+}
+
+// LogsEvent is the payload of the logs topic: the logs of a new canonical
+// block, or the retraction of a block that was reorged out
+type LogsEvent struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	BlockHash   common.Hash    `json:"blockHash"`
+	Removed     bool           `json:"removed"`
+	Logs        []*types.Log   `json:"logs"`
+}
+
+// PendingEvent is the payload of the pending topic
+type PendingEvent struct {
+	Hash common.Hash `json:"hash"`
+}
+
+// Bridge mirrors the blocks:new and pool:new events of Pika into a message
+// broker, so that data pipelines can follow the chain without keeping
+// WebSocket connections to the service
+type Bridge struct {
+	publisher   Publisher
+	pikaClient  *storage.PikaClient
+	blockReader *storage.BlockReader
+	tracker     *storage.CanonicalTracker
+	prefix      string
+	timeout     time.Duration
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+// New creates a bridge publishing to the broker of cfg
+func New(cfg config.BridgeConfig, pikaClient *storage.PikaClient, blockReader *storage.BlockReader) (*Bridge, error) {
+	var publisher Publisher
+	var err error
+	switch cfg.Broker {
+	case config.BridgeBrokerNATS:
+		publisher, err = newNATSPublisher(cfg.BrokerURL, cfg.Timeout)
+	case config.BridgeBrokerKafka:
+		publisher, err = newKafkaPublisher(cfg.BrokerURL, cfg.Timeout)
+	default:
+		err = fmt.Errorf("unknown broker %q", cfg.Broker)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Bridge{
+		publisher:   publisher,
+		pikaClient:  pikaClient,
+		blockReader: blockReader,
+		tracker:     storage.NewCanonicalTracker(blockReader, storage.DefaultCanonicalDepth),
+		prefix:      cfg.Prefix,
+		timeout:     cfg.Timeout,
+		ctx:         ctx,
+		cancel:      cancel,
+	}, nil
+}
+
+// Start follows new blocks and pending transactions in the background
+func (b *Bridge) Start(ctx context.Context) error {
+	b.wg.Add(2)
+	go b.followBlocks()
+	go b.followPending()
+	return nil
+}
+
+// Stop stops following events and disconnects from the broker
+func (b *Bridge) Stop(ctx context.Context) error {
+	b.cancel()
+	b.wg.Wait()
+	return b.publisher.Close()
+}
+
+// topic names a topic under the configured prefix
+func (b *Bridge) topic(name string) string {
+	return b.prefix + "." + name
+}
+
+// followBlocks publishes the head and logs of every block announced on
+// blocks:new
+func (b *Bridge) followBlocks() {
+	defer b.wg.Done()
+
+	b.pikaClient.Listen(b.ctx, "blocks:new", nil, func(payload string) {
+		block, err := b.blockReader.GetBlockByHash(b.ctx, common.HexToHash(payload))
+		if err != nil {
+			logger.Errorf("Bridge failed to get block %s: %v", payload, err)
+			return
+		}
+		b.handleNewBlock(block)
+	})
+}
+
+// handleNewBlock publishes a new head, retracting the logs of blocks it
+// reorged out first
+func (b *Bridge) handleNewBlock(block *types.Block) {
+	update, err := b.tracker.Apply(b.ctx, block)
+	if err != nil {
+		logger.Errorf("Bridge failed to track canonical chain: %v", err)
+		update = &storage.ChainUpdate{Added: []*types.Block{block}}
+	}
+
+	for _, removed := range update.Removed {
+		b.publish(b.topic("logs"), removed.Hash.Hex(), &LogsEvent{
+			BlockNumber: hexutil.Uint64(removed.Number),
+			BlockHash:   removed.Hash,
+			Removed:     true,
+			Logs:        []*types.Log{},
+		})
+	}
+
+	for _, added := range update.Added {
+		b.publish(b.topic("blocks"), added.Hash().Hex(), added.Header())
+
+		logs, err := b.blockReader.GetBlockLogs(b.ctx, added.NumberU64())
+		if err != nil {
+			logger.Errorf("Bridge failed to get logs of block %d: %v", added.NumberU64(), err)
+			continue
+		}
+		if logs == nil {
+			logs = []*types.Log{}
+		}
+		b.publish(b.topic("logs"), added.Hash().Hex(), &LogsEvent{
+			BlockNumber: hexutil.Uint64(added.NumberU64()),
+			BlockHash:   added.Hash(),
+			Logs:        logs,
+		})
+	}
+}
+
+// followPending publishes the hash of every transaction announced on
+// pool:new
+func (b *Bridge) followPending() {
+	defer b.wg.Done()
+
+	b.pikaClient.Listen(b.ctx, "pool:new", nil, func(payload string) {
+		hash := common.HexToHash(payload)
+		b.publish(b.topic("pending"), hash.Hex(), &PendingEvent{Hash: hash})
+	})
+}
+
+// publish encodes an event as JSON and hands it to the broker. Events the
+// broker does not accept in time are logged and dropped.
+func (b *Bridge) publish(topic, key string, event interface{}) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Errorf("Bridge failed to encode %s event: %v", topic, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, b.timeout)
+	defer cancel()
+	err = b.publisher.Publish(ctx, topic, key, payload)
+	metrics.RecordBridgeMessage(topic, err)
+	if err != nil && b.ctx.Err() == nil {
+		logger.Errorf("Bridge failed to publish to %s: %v", topic, err)
+	}
+}
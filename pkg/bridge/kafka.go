@@ -0,0 +1,82 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// kafkaPublisher produces to Kafka through a REST proxy speaking the
+// Confluent v2 API, which keeps the Kafka wire protocol out of the service
+type kafkaPublisher struct {
+	endpoint *url.URL
+	http     *http.Client
+}
+
+// kafkaRecords is the body of a produce request with JSON values
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+// kafkaRecord is a record keyed for partitioning, with a JSON value
+type kafkaRecord struct {
+	Key   string          `json:"key,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// newKafkaPublisher creates a publisher for the REST proxy at rawURL.
+// Credentials in the URL are sent with basic authentication.
+func newKafkaPublisher(rawURL string, timeout time.Duration) (*kafkaPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Kafka REST proxy url %q", rawURL)
+	}
+	return &kafkaPublisher{endpoint: u, http: &http.Client{Timeout: timeout}}, nil
+}
+
+// Publish produces a record with key to topic
+func (p *kafkaPublisher) Publish(ctx context.Context, topic, key string, payload []byte) error {
+	body, err := json.Marshal(kafkaRecords{Records: []kafkaRecord{{Key: key, Value: payload}}})
+	if err != nil {
+		return err
+	}
+
+	u := *p.endpoint
+	u.User = nil
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/topics/" + url.PathEscape(topic)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if user := p.endpoint.User; user != nil {
+		pass, _ := user.Password()
+		req.SetBasicAuth(user.Username(), pass)
+	}
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("kafka: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("kafka: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Close releases idle connections to the proxy
+func (p *kafkaPublisher) Close() error {
+	p.http.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,186 @@
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/logger"
+)
+
+// natsPublisher publishes to a NATS server over the plain-text client
+// protocol. It connects lazily and reconnects on the next publish after
+// the connection broke.
+type natsPublisher struct {
+	addr    string
+	user    string
+	pass    string
+	token   string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn // nil while disconnected
+	w    *bufio.Writer
+}
+
+// natsConnect is the CONNECT message of the client protocol
+type natsConnect struct {
+	Verbose   bool   `json:"verbose"`
+	Pedantic  bool   `json:"pedantic"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang"`
+	Version   string `json:"version"`
+	User      string `json:"user,omitempty"`
+	Pass      string `json:"pass,omitempty"`
+	AuthToken string `json:"auth_token,omitempty"`
+}
+
+// newNATSPublisher creates a publisher for a nats://[user:pass@]host:port
+// or nats://token@host:port URL
+func newNATSPublisher(rawURL string, timeout time.Duration) (*natsPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS url %q", rawURL)
+	}
+	p := &natsPublisher{addr: u.Host, timeout: timeout}
+	if u.Port() == "" {
+		p.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			p.user, p.pass = u.User.Username(), pass
+		} else {
+			p.token = u.User.Username()
+		}
+	}
+	return p, nil
+}
+
+// Publish sends a message on the subject topic. NATS has no keys, so key
+// is ignored.
+func (p *natsPublisher) Publish(ctx context.Context, topic, key string, payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		if err := p.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	deadline := time.Now().Add(p.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	p.conn.SetWriteDeadline(deadline)
+	fmt.Fprintf(p.w, "PUB %s %d\r\n", topic, len(payload))
+	p.w.Write(payload)
+	p.w.WriteString("\r\n")
+	if err := p.w.Flush(); err != nil {
+		p.disconnect()
+		return fmt.Errorf("nats: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connection to the server
+func (p *natsPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.disconnect()
+	return nil
+}
+
+// connect dials the server and completes the handshake: INFO from the
+// server, CONNECT and a PING answered by PONG once the server accepted
+// the credentials. p.mu must be held.
+func (p *natsPublisher) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: p.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return fmt.Errorf("nats: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(p.timeout))
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("nats: unexpected greeting %q: %v", strings.TrimSpace(line), err)
+	}
+
+	connect, _ := json.Marshal(natsConnect{
+		Name:      "evm_rpc",
+		Lang:      "go",
+		Version:   "1.0.0",
+		User:      p.user,
+		Pass:      p.pass,
+		AuthToken: p.token,
+	})
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "CONNECT %s\r\nPING\r\n", connect)
+	if err := w.Flush(); err != nil {
+		conn.Close()
+		return fmt.Errorf("nats: %w", err)
+	}
+	line, err = r.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "PONG" {
+		conn.Close()
+		return fmt.Errorf("nats: connection refused: %q: %v", strings.TrimSpace(line), err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	p.conn, p.w = conn, w
+	go p.readLoop(conn, r)
+	logger.Infof("Connected to NATS server %s", p.addr)
+	return nil
+}
+
+// readLoop answers the server's PINGs, which keep the connection open, and
+// logs its errors until the connection closes
+func (p *natsPublisher) readLoop(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			p.mu.Lock()
+			if p.conn == conn {
+				if !errors.Is(err, net.ErrClosed) {
+					logger.Warnf("NATS connection lost: %v", err)
+				}
+				p.disconnect()
+			}
+			p.mu.Unlock()
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PING":
+			p.mu.Lock()
+			if p.conn == conn {
+				conn.SetWriteDeadline(time.Now().Add(p.timeout))
+				p.w.WriteString("PONG\r\n")
+				p.w.Flush()
+			}
+			p.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			logger.Warnf("NATS server error: %s", line)
+		}
+	}
+}
+
+// disconnect closes the connection, if any. p.mu must be held.
+func (p *natsPublisher) disconnect() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn, p.w = nil, nil
+	}
+}
@@ -1,130 +1,120 @@
 package cache
 
 import (
-	"sync"
+	"sync/atomic"
 	"time"
 
 	lru "github.com/hashicorp/golang-lru/v2"
 )
 
-// CacheItem represents a cached item with expiration
-type CacheItem struct {
-	Value      interface{}
-	Expiration time.Time
+// item is a cached value with expiration
+type item[V any] struct {
+	value      V
+	expiration time.Time
 }
 
-// IsExpired checks if the item has expired
-func (i *CacheItem) IsExpired() bool {
-	if i.Expiration.IsZero() {
+// expired checks if the item has expired
+func (i *item[V]) expired() bool {
+	if i.expiration.IsZero() {
 		return false // Never expires
 	}
-	return time.Now().After(i.Expiration)
+	return time.Now().After(i.expiration)
 }
 
-// Cache is a thread-safe LRU cache with TTL support
-type Cache struct {
-	cache *lru.Cache[string, *CacheItem]
-	mu    sync.RWMutex
-	
-	hits   uint64
-	misses uint64
+// Cache is a thread-safe, typed LRU cache with TTL support
+type Cache[K comparable, V any] struct {
+	cache *lru.Cache[K, *item[V]]
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
 }
 
 // NewCache creates a new cache with specified size
-func NewCache(size int) (*Cache, error) {
-	cache, err := lru.New[string, *CacheItem](size)
+func NewCache[K comparable, V any](size int) (*Cache[K, V], error) {
+	cache, err := lru.New[K, *item[V]](size)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Cache{
+	return &Cache[K, V]{
 		cache: cache,
 	}, nil
 }
 
 // Get retrieves a value from cache
-func (c *Cache) Get(key string) (interface{}, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	var zero V
 
-	item, ok := c.cache.Get(key)
+	it, ok := c.cache.Get(key)
 	if !ok {
-		c.misses++
-		return nil, false
+		c.misses.Add(1)
+		return zero, false
 	}
 
-	if item.IsExpired() {
-		c.misses++
-		go c.Delete(key) // Async cleanup
-		return nil, false
+	if it.expired() {
+		c.misses.Add(1)
+		c.cache.Remove(key)
+		return zero, false
 	}
 
-	c.hits++
-	return item.Value, true
+	c.hits.Add(1)
+	return it.value, true
 }
 
-// Set stores a value in cache with optional TTL
-func (c *Cache) Set(key string, value interface{}, ttl time.Duration) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// Peek retrieves a value without updating recency or statistics
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	var zero V
+
+	it, ok := c.cache.Peek(key)
+	if !ok || it.expired() {
+		return zero, false
+	}
+	return it.value, true
+}
 
+// Set stores a value in cache with optional TTL
+func (c *Cache[K, V]) Set(key K, value V, ttl time.Duration) {
 	var expiration time.Time
 	if ttl > 0 {
 		expiration = time.Now().Add(ttl)
 	}
 
-	item := &CacheItem{
-		Value:      value,
-		Expiration: expiration,
-	}
-
-	c.cache.Add(key, item)
+	c.cache.Add(key, &item[V]{
+		value:      value,
+		expiration: expiration,
+	})
 }
 
 // Delete removes a value from cache
-func (c *Cache) Delete(key string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+func (c *Cache[K, V]) Delete(key K) {
 	c.cache.Remove(key)
 }
 
-// Clear clears all items from cache
-func (c *Cache) Clear() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// Clear clears all items from cache and resets its statistics
+func (c *Cache[K, V]) Clear() {
 	c.cache.Purge()
+	c.hits.Store(0)
+	c.misses.Store(0)
 }
 
 // Len returns the number of items in cache
-func (c *Cache) Len() int {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+func (c *Cache[K, V]) Len() int {
 	return c.cache.Len()
 }
 
 // HitRate returns the cache hit rate
-func (c *Cache) HitRate() float64 {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	total := c.hits + c.misses
-	if total == 0 {
-		return 0
-	}
-
-	return float64(c.hits) / float64(total)
+func (c *Cache[K, V]) HitRate() float64 {
+	return hitRate(c.hits.Load(), c.misses.Load())
 }
 
 // Stats returns cache statistics
-func (c *Cache) Stats() CacheStats {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
+func (c *Cache[K, V]) Stats() CacheStats {
+	hits, misses := c.hits.Load(), c.misses.Load()
 	return CacheStats{
-		Hits:    c.hits,
-		Misses:  c.misses,
+		Hits:    hits,
+		Misses:  misses,
 		Size:    c.cache.Len(),
-		HitRate: c.HitRate(),
+		HitRate: hitRate(hits, misses),
 	}
 }
 
@@ -135,3 +125,12 @@ type CacheStats struct {
 	Size    int
 	HitRate float64
 }
+
+// hitRate computes the ratio of hits to lookups
+func hitRate(hits, misses uint64) float64 {
+	total := hits + misses
+	if total == 0 {
+		return 0
+	}
+	return float64(hits) / float64(total)
+}
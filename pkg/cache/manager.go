@@ -1,185 +1,292 @@
 package cache
 
 import (
+	"context"
 	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
 )
 
+// statsLogInterval is how often cache statistics are logged
+const statsLogInterval = 5 * time.Minute
+
+// statsCache is the type-independent part of a Cache
+type statsCache interface {
+	Stats() CacheStats
+	Clear()
+}
+
+// balanceKey identifies a balance at a block
+type balanceKey struct {
+	address     common.Address
+	blockNumber string
+}
+
 // Manager manages multiple caches for different data types
 type Manager struct {
-	blockCache   *Cache
-	txCache      *Cache
-	receiptCache *Cache
-	balanceCache *Cache
-	codeCache    *Cache
-	
-	ttl config.CacheTTLConfig
+	blockCache         *Cache[uint64, *types.Block]
+	blockHashCache     *Cache[common.Hash, *types.Block]
+	txCache            *Cache[common.Hash, *types.Transaction]
+	receiptCache       *Cache[common.Hash, *types.Receipt]
+	blockReceiptsCache *Cache[uint64, types.Receipts]
+	balanceCache       *Cache[balanceKey, *big.Int]
+	codeCache          *Cache[common.Address, []byte]
+
+	ttl atomic.Pointer[config.CacheTTLConfig]
+
+	chain     string // metrics label of a further chain, empty for the default one
+	collector *collector
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
 }
 
 // NewManager creates a new cache manager
 func NewManager(cfg config.CacheConfig) (*Manager, error) {
-	blockCache, err := NewCache(cfg.BlockCacheSize)
+	blockCache, err := NewCache[uint64, *types.Block](cfg.BlockCacheSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create block cache: %w", err)
 	}
 
-	txCache, err := NewCache(cfg.TxCacheSize)
+	blockHashCache, err := NewCache[common.Hash, *types.Block](cfg.BlockCacheSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create block hash cache: %w", err)
+	}
+
+	txCache, err := NewCache[common.Hash, *types.Transaction](cfg.TxCacheSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create tx cache: %w", err)
 	}
 
-	receiptCache, err := NewCache(cfg.ReceiptCacheSize)
+	receiptCache, err := NewCache[common.Hash, *types.Receipt](cfg.ReceiptCacheSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create receipt cache: %w", err)
 	}
 
-	balanceCache, err := NewCache(cfg.BalanceCacheSize)
+	blockReceiptsCache, err := NewCache[uint64, types.Receipts](cfg.BlockCacheSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create block receipts cache: %w", err)
+	}
+
+	balanceCache, err := NewCache[balanceKey, *big.Int](cfg.BalanceCacheSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create balance cache: %w", err)
 	}
 
-	codeCache, err := NewCache(cfg.CodeCacheSize)
+	codeCache, err := NewCache[common.Address, []byte](cfg.CodeCacheSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create code cache: %w", err)
 	}
 
-	return &Manager{
-		blockCache:   blockCache,
-		txCache:      txCache,
-		receiptCache: receiptCache,
-		balanceCache: balanceCache,
-		codeCache:    codeCache,
-		ttl:          cfg.TTL,
-	}, nil
+	m := &Manager{
+		blockCache:         blockCache,
+		blockHashCache:     blockHashCache,
+		txCache:            txCache,
+		receiptCache:       receiptCache,
+		blockReceiptsCache: blockReceiptsCache,
+		balanceCache:       balanceCache,
+		codeCache:          codeCache,
+		stopCh:             make(chan struct{}),
+	}
+	m.SetTTL(cfg.TTL)
+	return m, nil
+}
+
+// SetTTL replaces the expiry of newly cached entries. Entries already cached
+// keep theirs.
+func (m *Manager) SetTTL(ttl config.CacheTTLConfig) {
+	m.ttl.Store(&ttl)
+}
+
+// SetChain labels the metrics of a cache serving a further chain of the
+// process. It must be called before Start.
+func (m *Manager) SetChain(name string) {
+	m.chain = name
+}
+
+// registerer returns where cache metrics are registered
+func (m *Manager) registerer() prometheus.Registerer {
+	if m.chain == "" {
+		return prometheus.DefaultRegisterer
+	}
+	return prometheus.WrapRegistererWith(prometheus.Labels{"chain": m.chain}, prometheus.DefaultRegisterer)
+}
+
+// Start exports cache statistics to Prometheus and starts periodic
+// statistics logging
+func (m *Manager) Start(ctx context.Context) error {
+	m.collector = &collector{manager: m}
+	if err := m.registerer().Register(m.collector); err != nil {
+		return fmt.Errorf("failed to register cache metrics: %w", err)
+	}
+
+	m.wg.Add(1)
+	go m.logStats()
+	return nil
+}
+
+// Stop stops background work and releases cached entries
+func (m *Manager) Stop(ctx context.Context) error {
+	close(m.stopCh)
+	m.wg.Wait()
+	m.registerer().Unregister(m.collector)
+	m.Clear()
+	return nil
+}
+
+// logStats logs cache statistics until the manager is stopped
+func (m *Manager) logStats() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(statsLogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for name, stat := range m.Stats() {
+				logger.Infof("Cache[%s] - Hits: %d, Misses: %d, Size: %d, HitRate: %.2f%%",
+					name, stat.Hits, stat.Misses, stat.Size, stat.HitRate*100)
+			}
+		case <-m.stopCh:
+			return
+		}
+	}
 }
 
 // Block cache methods
 
 func (m *Manager) GetBlock(number uint64) (*types.Block, bool) {
-	key := fmt.Sprintf("blk:%d", number)
-	val, ok := m.blockCache.Get(key)
-	if !ok {
-		return nil, false
-	}
-	return val.(*types.Block), true
+	return m.blockCache.Get(number)
 }
 
 func (m *Manager) SetBlock(number uint64, block *types.Block) {
-	key := fmt.Sprintf("blk:%d", number)
-	m.blockCache.Set(key, block, m.ttl.Block)
+	m.blockCache.Set(number, block, m.ttl.Load().Block)
 }
 
 func (m *Manager) GetBlockByHash(hash common.Hash) (*types.Block, bool) {
-	key := fmt.Sprintf("blk:hash:%s", hash.Hex())
-	val, ok := m.blockCache.Get(key)
-	if !ok {
-		return nil, false
-	}
-	return val.(*types.Block), true
+	return m.blockHashCache.Get(hash)
 }
 
 func (m *Manager) SetBlockByHash(hash common.Hash, block *types.Block) {
-	key := fmt.Sprintf("blk:hash:%s", hash.Hex())
-	m.blockCache.Set(key, block, m.ttl.Block)
+	m.blockHashCache.Set(hash, block, m.ttl.Load().Block)
+}
+
+// InvalidateStaleBlock drops the block and receipts cached for a height if
+// they belong to a block other than hash, e.g. after a reorg
+func (m *Manager) InvalidateStaleBlock(number uint64, hash common.Hash) {
+	if block, ok := m.blockCache.Peek(number); ok && block.Hash() != hash {
+		m.InvalidateBlock(number)
+	}
+}
+
+// InvalidateBlock drops the block and receipts cached for a height, e.g.
+// when the block there was reorged out
+func (m *Manager) InvalidateBlock(number uint64) {
+	m.blockCache.Delete(number)
+	m.blockReceiptsCache.Delete(number)
 }
 
 // Transaction cache methods
 
 func (m *Manager) GetTransaction(hash common.Hash) (*types.Transaction, bool) {
-	key := fmt.Sprintf("tx:%s", hash.Hex())
-	val, ok := m.txCache.Get(key)
-	if !ok {
-		return nil, false
-	}
-	return val.(*types.Transaction), true
+	return m.txCache.Get(hash)
 }
 
 func (m *Manager) SetTransaction(hash common.Hash, tx *types.Transaction) {
-	key := fmt.Sprintf("tx:%s", hash.Hex())
-	m.txCache.Set(key, tx, m.ttl.Transaction)
+	m.txCache.Set(hash, tx, m.ttl.Load().Transaction)
 }
 
 // Receipt cache methods
 
 func (m *Manager) GetReceipt(hash common.Hash) (*types.Receipt, bool) {
-	key := fmt.Sprintf("rcpt:%s", hash.Hex())
-	val, ok := m.receiptCache.Get(key)
-	if !ok {
-		return nil, false
-	}
-	return val.(*types.Receipt), true
+	return m.receiptCache.Get(hash)
 }
 
 func (m *Manager) SetReceipt(hash common.Hash, receipt *types.Receipt) {
-	key := fmt.Sprintf("rcpt:%s", hash.Hex())
-	m.receiptCache.Set(key, receipt, m.ttl.Receipt)
+	m.receiptCache.Set(hash, receipt, m.ttl.Load().Receipt)
+}
+
+func (m *Manager) GetReceipts(number uint64) (types.Receipts, bool) {
+	return m.blockReceiptsCache.Get(number)
+}
+
+func (m *Manager) SetReceipts(number uint64, receipts types.Receipts) {
+	m.blockReceiptsCache.Set(number, receipts, m.ttl.Load().Receipt)
 }
 
 // Balance cache methods
 
-func (m *Manager) GetBalance(address common.Address, blockNumber string) (interface{}, bool) {
-	key := fmt.Sprintf("bal:%s:%s", address.Hex(), blockNumber)
-	return m.balanceCache.Get(key)
+func (m *Manager) GetBalance(address common.Address, blockNumber string) (*big.Int, bool) {
+	return m.balanceCache.Get(balanceKey{address: address, blockNumber: blockNumber})
 }
 
-func (m *Manager) SetBalance(address common.Address, blockNumber string, balance interface{}) {
-	key := fmt.Sprintf("bal:%s:%s", address.Hex(), blockNumber)
-	m.balanceCache.Set(key, balance, m.ttl.Balance)
+func (m *Manager) SetBalance(address common.Address, blockNumber string, balance *big.Int) {
+	m.balanceCache.Set(balanceKey{address: address, blockNumber: blockNumber}, balance, m.ttl.Load().Balance)
 }
 
 // Code cache methods
 
 func (m *Manager) GetCode(address common.Address) ([]byte, bool) {
-	key := fmt.Sprintf("code:%s", address.Hex())
-	val, ok := m.codeCache.Get(key)
-	if !ok {
-		return nil, false
-	}
-	return val.([]byte), true
+	return m.codeCache.Get(address)
 }
 
 func (m *Manager) SetCode(address common.Address, code []byte) {
-	key := fmt.Sprintf("code:%s", address.Hex())
-	m.codeCache.Set(key, code, m.ttl.Code)
+	m.codeCache.Set(address, code, m.ttl.Load().Code)
+}
+
+// caches returns the caches by statistics name
+func (m *Manager) caches() map[string]statsCache {
+	return map[string]statsCache{
+		"block":         m.blockCache,
+		"blockHash":     m.blockHashCache,
+		"tx":            m.txCache,
+		"receipt":       m.receiptCache,
+		"blockReceipts": m.blockReceiptsCache,
+		"balance":       m.balanceCache,
+		"code":          m.codeCache,
+	}
 }
 
 // Stats returns statistics for all caches
 func (m *Manager) Stats() map[string]CacheStats {
-	return map[string]CacheStats{
-		"block":   m.blockCache.Stats(),
-		"tx":      m.txCache.Stats(),
-		"receipt": m.receiptCache.Stats(),
-		"balance": m.balanceCache.Stats(),
-		"code":    m.codeCache.Stats(),
+	stats := make(map[string]CacheStats)
+	for name, c := range m.caches() {
+		stats[name] = c.Stats()
 	}
+	return stats
 }
 
 // HitRate returns overall hit rate
 func (m *Manager) HitRate() float64 {
 	var totalHits, totalMisses uint64
-	
-	stats := m.Stats()
-	for _, s := range stats {
+	for _, s := range m.Stats() {
 		totalHits += s.Hits
 		totalMisses += s.Misses
 	}
-	
-	total := totalHits + totalMisses
-	if total == 0 {
-		return 0
+	return hitRate(totalHits, totalMisses)
+}
+
+// ClearCache clears a single cache by name, reporting whether it exists
+func (m *Manager) ClearCache(name string) bool {
+	c, ok := m.caches()[name]
+	if !ok {
+		return false
 	}
-	
-	return float64(totalHits) / float64(total)
+	c.Clear()
+	return true
 }
 
 // Clear clears all caches
 func (m *Manager) Clear() {
-	m.blockCache.Clear()
-	m.txCache.Clear()
-	m.receiptCache.Clear()
-	m.balanceCache.Clear()
-	m.codeCache.Clear()
+	for _, c := range m.caches() {
+		c.Clear()
+	}
 }
@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cacheHitsDesc = prometheus.NewDesc(
+		"rpc_cache_hits_total",
+		"Total number of cache hits",
+		[]string{"type"}, nil,
+	)
+	cacheMissesDesc = prometheus.NewDesc(
+		"rpc_cache_misses_total",
+		"Total number of cache misses",
+		[]string{"type"}, nil,
+	)
+	cacheSizeDesc = prometheus.NewDesc(
+		"rpc_cache_size",
+		"Number of entries in the cache",
+		[]string{"type"}, nil,
+	)
+	cacheHitRateDesc = prometheus.NewDesc(
+		"rpc_cache_hit_rate",
+		"Cache hit rate since startup or the last reset",
+		[]string{"type"}, nil,
+	)
+)
+
+// collector exports cache statistics, read from the manager at scrape time
+type collector struct {
+	manager *Manager
+}
+
+// Describe implements prometheus.Collector
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheHitsDesc
+	ch <- cacheMissesDesc
+	ch <- cacheSizeDesc
+	ch <- cacheHitRateDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	for name, stat := range c.manager.Stats() {
+		ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(stat.Hits), name)
+		ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(stat.Misses), name)
+		ch <- prometheus.MustNewConstMetric(cacheSizeDesc, prometheus.GaugeValue, float64(stat.Size), name)
+		ch <- prometheus.MustNewConstMetric(cacheHitRateDesc, prometheus.GaugeValue, stat.HitRate, name)
+	}
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/jsonx"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// defaultResponseTTL is used when no L2 cache TTL is configured
+const defaultResponseTTL = 24 * time.Hour
+
+// ResponseCache is a second-tier cache of serialized RPC results shared by
+// all replicas. Only immutable results may be stored; keys embed a version
+// so that a change in rendering can invalidate every entry at once.
+type ResponseCache struct {
+	client  *storage.PikaClient
+	version string
+	ttl     time.Duration
+	ttls    map[string]time.Duration // per lowercased method, overriding ttl
+}
+
+// NewResponseCache connects to the L2 cache database
+func NewResponseCache(cfg config.L2CacheConfig, pika config.PikaConfig) (*ResponseCache, error) {
+	pika.Mode = config.PikaModeStandalone
+	pika.Addr = cfg.Addr
+	pika.Password = cfg.Password
+	pika.DB = cfg.DB
+
+	client, err := storage.NewPikaClient(pika)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to L2 cache: %w", err)
+	}
+
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultResponseTTL
+	}
+
+	version := cfg.Version
+	if version == "" {
+		version = "v1"
+	}
+
+	// Config keys are lowercased, so methods are looked up the same way
+	ttls := make(map[string]time.Duration, len(cfg.MethodTTL))
+	for method, methodTTL := range cfg.MethodTTL {
+		ttls[strings.ToLower(method)] = methodTTL
+	}
+
+	return &ResponseCache{
+		client:  client,
+		version: version,
+		ttl:     ttl,
+		ttls:    ttls,
+	}, nil
+}
+
+// Start is a no-op; the connection is established by NewResponseCache
+func (c *ResponseCache) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop closes the L2 cache connection
+func (c *ResponseCache) Stop(ctx context.Context) error {
+	return c.client.Close()
+}
+
+// key builds the versioned cache key of a call
+func (c *ResponseCache) key(method string, params json.RawMessage) string {
+	// Compact the params so that formatting does not split entries
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, params); err != nil {
+		buf.Reset()
+		buf.Write(params)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return fmt.Sprintf("rpc:%s:%s:%s", c.version, method, hex.EncodeToString(sum[:]))
+}
+
+// Get returns the cached result of a call
+func (c *ResponseCache) Get(ctx context.Context, method string, params json.RawMessage) (json.RawMessage, bool) {
+	data, err := c.client.Get(ctx, c.key(method, params))
+	if err != nil {
+		if err != storage.ErrNotFound {
+			logger.Debugf("L2 cache get failed: method=%s, error=%v", method, err)
+		}
+		metrics.RecordResponseCache(method, false)
+		return nil, false
+	}
+
+	metrics.RecordResponseCache(method, true)
+	return data, true
+}
+
+// Set stores the result of a call
+func (c *ResponseCache) Set(ctx context.Context, method string, params json.RawMessage, result interface{}) {
+	data, err := jsonx.Marshal(result)
+	if err != nil {
+		logger.Debugf("L2 cache encode failed: method=%s, error=%v", method, err)
+		return
+	}
+
+	ttl := c.ttl
+	if methodTTL, ok := c.ttls[strings.ToLower(method)]; ok {
+		ttl = methodTTL
+	}
+	if err := c.client.Set(ctx, c.key(method, params), data, ttl); err != nil {
+		logger.Debugf("L2 cache set failed: method=%s, error=%v", method, err)
+	}
+}
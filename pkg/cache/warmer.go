@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// Warmer preloads recent blocks into the cache on startup and eagerly loads
+// every new head, so "latest" queries after a deploy or a new block do not
+// all miss at once and stampede Pika
+type Warmer struct {
+	manager     *Manager
+	pikaClient  *storage.PikaClient
+	blockReader *storage.BlockReader
+	tracker     *storage.CanonicalTracker
+	blocks      uint64
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+// NewWarmer creates a cache warmer. blockReader must be backed by manager;
+// blocks is the number of latest blocks preloaded on startup.
+func NewWarmer(manager *Manager, pikaClient *storage.PikaClient, blockReader *storage.BlockReader, blocks uint64) *Warmer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Warmer{
+		manager:     manager,
+		pikaClient:  pikaClient,
+		blockReader: blockReader,
+		tracker:     storage.NewCanonicalTracker(blockReader, storage.DefaultCanonicalDepth),
+		blocks:      blocks,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Start preloads the latest blocks, then follows new heads in the background.
+// Preloading completes before Start returns so that listeners started later
+// find a warm cache.
+func (w *Warmer) Start(ctx context.Context) error {
+	w.preload(ctx)
+
+	w.wg.Add(1)
+	go w.followNewHeads()
+	return nil
+}
+
+// Stop stops following new heads
+func (w *Warmer) Stop(ctx context.Context) error {
+	w.cancel()
+	w.wg.Wait()
+	return nil
+}
+
+// preload loads the latest blocks with their receipts. They are tracked as
+// canonical, so that a reorg replacing them evicts them.
+func (w *Warmer) preload(ctx context.Context) {
+	if w.blocks == 0 {
+		return
+	}
+
+	latest, err := w.blockReader.GetLatestBlockNumber(ctx)
+	if err != nil {
+		logger.Warnf("Cache warm-up skipped: %v", err)
+		return
+	}
+
+	from := uint64(0)
+	if latest+1 > w.blocks {
+		from = latest + 1 - w.blocks
+	}
+
+	start := time.Now()
+	var loaded []*types.Block
+	for number := latest + 1; number > from; number-- {
+		if ctx.Err() != nil {
+			break
+		}
+		block, err := w.load(ctx, number-1)
+		if err != nil {
+			logger.Debugf("Cache warm-up failed for block %d: %v", number-1, err)
+			continue
+		}
+		loaded = append(loaded, block)
+	}
+	for i := len(loaded) - 1; i >= 0; i-- {
+		if _, err := w.tracker.Apply(ctx, loaded[i]); err != nil {
+			logger.Debugf("Failed to track block %d: %v", loaded[i].NumberU64(), err)
+		}
+	}
+
+	logger.Infof("Cache warmed: blocks=%d, from=%d, to=%d, duration=%v", len(loaded), from, latest, time.Since(start))
+}
+
+// followNewHeads loads every block announced on blocks:new
+func (w *Warmer) followNewHeads() {
+	defer w.wg.Done()
+
+	w.pikaClient.Listen(w.ctx, "blocks:new", nil, func(payload string) {
+		w.applyHead(w.ctx, common.HexToHash(payload))
+	})
+}
+
+// applyHead evicts the cached blocks a new head reorged out, from the fork
+// point up, and loads the head
+func (w *Warmer) applyHead(ctx context.Context, hash common.Hash) {
+	number, err := w.blockReader.GetBlockNumberByHash(ctx, hash)
+	if err != nil {
+		logger.Debugf("Cache warm-up failed for block %s: %v", hash.Hex(), err)
+		return
+	}
+	// A different block cached at this height was reorged out
+	w.manager.InvalidateStaleBlock(number, hash)
+
+	block, err := w.blockReader.GetBlockByHash(ctx, hash)
+	if err != nil {
+		logger.Debugf("Cache warm-up failed for block %d: %v", number, err)
+		return
+	}
+	update, err := w.tracker.Apply(ctx, block)
+	if err != nil {
+		// Deeper than the tracked window; only the head's height was checked
+		logger.Errorf("Failed to track canonical chain: %v", err)
+		update = &storage.ChainUpdate{}
+	}
+	for _, removed := range update.Removed {
+		if removed.Number != number {
+			w.manager.InvalidateBlock(removed.Number)
+		}
+	}
+
+	if _, err := w.load(ctx, number); err != nil {
+		logger.Debugf("Cache warm-up failed for block %d: %v", number, err)
+	}
+}
+
+// load reads a block and its receipts through the cached reader
+func (w *Warmer) load(ctx context.Context, number uint64) (*types.Block, error) {
+	block, err := w.blockReader.GetBlock(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.blockReader.GetReceipts(ctx, number)
+	return block, err
+}
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+func TestWarmerEvictsReorgedBlocks(t *testing.T) {
+	ctx := context.Background()
+	client, err := storage.NewPikaClient(config.PikaConfig{Mode: config.PikaModeMemory})
+	if err != nil {
+		t.Fatalf("NewPikaClient: %v", err)
+	}
+	defer client.Close()
+
+	ttl := config.CacheTTLConfig{Block: time.Minute, Receipt: time.Minute}
+	manager, err := NewManager(config.CacheConfig{BlockCacheSize: 100, TxCacheSize: 100, ReceiptCacheSize: 100, BalanceCacheSize: 100, CodeCacheSize: 100, TTL: ttl})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	reader := storage.NewBlockReader(client)
+	reader.SetCache(manager)
+	writer := storage.NewBlockWriter(client)
+
+	// write stores a block on top of parent, its branch told apart by extra
+	write := func(parent *types.Block, number uint64, extra byte) *types.Block {
+		header := &types.Header{
+			UncleHash:  types.EmptyUncleHash,
+			Root:       types.EmptyRootHash,
+			Number:     new(big.Int).SetUint64(number),
+			GasLimit:   30_000_000,
+			Difficulty: new(big.Int),
+			Time:       number * 12,
+			Extra:      []byte{extra},
+		}
+		if parent != nil {
+			header.ParentHash = parent.Hash()
+		}
+		block := types.NewBlockWithHeader(header)
+		if err := writer.WriteBlock(ctx, block, types.Receipts{}, nil); err != nil {
+			t.Fatalf("WriteBlock: %v", err)
+		}
+		if err := writer.SetLatest(ctx, number); err != nil {
+			t.Fatalf("SetLatest: %v", err)
+		}
+		return block
+	}
+
+	var chain []*types.Block
+	var parent *types.Block
+	for number := uint64(0); number < 4; number++ {
+		parent = write(parent, number, 0)
+		chain = append(chain, parent)
+	}
+
+	warmer := NewWarmer(manager, client, reader, 10)
+	warmer.preload(ctx)
+	for number := uint64(0); number < 4; number++ {
+		if _, ok := manager.GetBlock(number); !ok {
+			t.Fatalf("block %d was not preloaded", number)
+		}
+	}
+
+	// A two block reorg replaces blocks 2 and 3 and extends the chain
+	fork := chain[1]
+	for number := uint64(2); number < 5; number++ {
+		fork = write(fork, number, 1)
+	}
+	warmer.applyHead(ctx, fork.Hash())
+
+	for number := uint64(2); number < 4; number++ {
+		if block, ok := manager.GetBlock(number); ok && block.Hash() == chain[number].Hash() {
+			t.Fatalf("reorged out block %d is still cached", number)
+		}
+		if _, ok := manager.GetReceipts(number); ok {
+			t.Fatalf("receipts of reorged out block %d are still cached", number)
+		}
+		block, err := reader.GetBlock(ctx, number)
+		if err != nil {
+			t.Fatalf("GetBlock(%d): %v", number, err)
+		}
+		if block.Hash() == chain[number].Hash() {
+			t.Fatalf("GetBlock(%d) returned the reorged out block", number)
+		}
+	}
+	if block, ok := manager.GetBlock(4); !ok || block.Hash() != fork.Hash() {
+		t.Fatal("new head was not loaded")
+	}
+	if block, ok := manager.GetBlock(1); !ok || block.Hash() != chain[1].Hash() {
+		t.Fatal("block below the fork point was evicted")
+	}
+}
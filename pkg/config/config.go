@@ -1,72 +1,232 @@
 package config
 
 import (
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Chain       ChainConfig       `mapstructure:"chain"`
-	Server      ServerConfig      `mapstructure:"server"`
-	Storage     StorageConfig     `mapstructure:"storage"`
-	Cache       CacheConfig       `mapstructure:"cache"`
-	RateLimit   RateLimitConfig   `mapstructure:"ratelimit"`
-	WorkerPools WorkerPoolsConfig `mapstructure:"worker_pools"`
-	EVM         EVMConfig         `mapstructure:"evm"`
-	API         APIConfig         `mapstructure:"api"`
-	Metrics     MetricsConfig     `mapstructure:"metrics"`
-	Logging     LoggingConfig     `mapstructure:"logging"`
+	Chain       ChainConfig        `mapstructure:"chain"`
+	Server      ServerConfig       `mapstructure:"server"`
+	Storage     StorageConfig      `mapstructure:"storage"`
+	Cache       CacheConfig        `mapstructure:"cache"`
+	RateLimit   RateLimitConfig    `mapstructure:"ratelimit"`
+	Denylist    DenylistConfig     `mapstructure:"denylist"`
+	QoS         QoSConfig          `mapstructure:"qos"`
+	WorkerPools WorkerPoolsConfig  `mapstructure:"worker_pools"`
+	EVM         EVMConfig          `mapstructure:"evm"`
+	API         APIConfig          `mapstructure:"api"`
+	Metrics     MetricsConfig      `mapstructure:"metrics"`
+	Tracing     TracingConfig      `mapstructure:"tracing"`
+	Logging     LoggingConfig      `mapstructure:"logging"`
+	Reload      ReloadConfig       `mapstructure:"reload"`
+	Ingest      IngestConfig       `mapstructure:"ingest"`
+	Fallback    FallbackConfig     `mapstructure:"fallback"`
+	Pruning     PruningConfig      `mapstructure:"pruning"`
+	TxPool      TxPoolConfig       `mapstructure:"txpool"`
+	Accounts    AccountsConfig     `mapstructure:"accounts"`
+	Bridge      BridgeConfig       `mapstructure:"bridge"`
+	Webhooks    WebhooksConfig     `mapstructure:"webhooks"`
+	Dev         DevConfig          `mapstructure:"dev"`
+	Recorder    RecorderConfig     `mapstructure:"recorder"`
+	Chains      []ExtraChainConfig `mapstructure:"chains"`
 }
 
 type ChainConfig struct {
-	Name      string `mapstructure:"name"`
-	NetworkID uint64 `mapstructure:"network_id"`
-	ChainID   uint64 `mapstructure:"chain_id"`
+	Name      string      `mapstructure:"name"`
+	NetworkID uint64      `mapstructure:"network_id"`
+	ChainID   uint64      `mapstructure:"chain_id"`
+	Forks     ForksConfig `mapstructure:"forks"`
+}
+
+// ForksConfig sets when the hard forks of a chain activate. Forks up to
+// London activate at a block number, later ones at a block timestamp. A
+// preset supplies the schedule of a public network; without one every fork
+// is active from genesis. Activations set here override the preset.
+type ForksConfig struct {
+	Preset              string  `mapstructure:"preset"` // mainnet, sepolia or holesky
+	HomesteadBlock      *uint64 `mapstructure:"homestead_block"`
+	EIP150Block         *uint64 `mapstructure:"eip150_block"`
+	EIP155Block         *uint64 `mapstructure:"eip155_block"`
+	EIP158Block         *uint64 `mapstructure:"eip158_block"`
+	ByzantiumBlock      *uint64 `mapstructure:"byzantium_block"`
+	ConstantinopleBlock *uint64 `mapstructure:"constantinople_block"`
+	PetersburgBlock     *uint64 `mapstructure:"petersburg_block"`
+	IstanbulBlock       *uint64 `mapstructure:"istanbul_block"`
+	BerlinBlock         *uint64 `mapstructure:"berlin_block"`
+	LondonBlock         *uint64 `mapstructure:"london_block"`
+	ShanghaiTime        *uint64 `mapstructure:"shanghai_time"`
+	CancunTime          *uint64 `mapstructure:"cancun_time"`
+}
+
+// ExtraChainConfig configures a further chain served by the same process.
+// Its requests are routed by URL path (/chain/{name}) or Host header.
+type ExtraChainConfig struct {
+	Name       string      `mapstructure:"name"`
+	NetworkID  uint64      `mapstructure:"network_id"`
+	ChainID    uint64      `mapstructure:"chain_id"`
+	Forks      ForksConfig `mapstructure:"forks"`
+	Hosts      []string    `mapstructure:"hosts"`
+	Namespaces []string    `mapstructure:"namespaces"` // defaults to eth, net, web3 and txpool
+	Pika       PikaConfig  `mapstructure:"pika"`       // a separate instance or DB per chain
 }
 
 type ServerConfig struct {
-	HTTP   HTTPConfig   `mapstructure:"http"`
-	WS     WSConfig     `mapstructure:"ws"`
-	Health HealthConfig `mapstructure:"health"`
+	HTTP    HTTPConfig   `mapstructure:"http"`
+	WS      WSConfig     `mapstructure:"ws"`
+	Private HTTPConfig   `mapstructure:"private"` // internal JSON-RPC listener for namespaces bound to it
+	Health  HealthConfig `mapstructure:"health"`
+	Admin   AdminConfig  `mapstructure:"admin"`
+
+	// ShutdownTimeout bounds the drain of in-flight calls on shutdown
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
 }
 
 type HTTPConfig struct {
-	Enabled        bool          `mapstructure:"enabled"`
-	ListenAddr     string        `mapstructure:"listen_addr"`
-	ReadTimeout    time.Duration `mapstructure:"read_timeout"`
-	WriteTimeout   time.Duration `mapstructure:"write_timeout"`
-	IdleTimeout    time.Duration `mapstructure:"idle_timeout"`
-	MaxHeaderBytes int           `mapstructure:"max_header_bytes"`
-	CORSOrigins    []string      `mapstructure:"cors_origins"`
-	VHosts         []string      `mapstructure:"vhosts"`
+	Enabled         bool          `mapstructure:"enabled"`
+	ListenAddr      string        `mapstructure:"listen_addr"`
+	ReadTimeout     time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout    time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout     time.Duration `mapstructure:"idle_timeout"`
+	MaxHeaderBytes  int           `mapstructure:"max_header_bytes"`
+	RequestTimeout  time.Duration `mapstructure:"request_timeout"` // deadline of a request's calls; 0 derives it from write_timeout
+	CORSOrigins     []string      `mapstructure:"cors_origins"`
+	VHosts          []string      `mapstructure:"vhosts"`
+	Events          bool          `mapstructure:"events"`            // serve newHeads and logs as Server-Sent Events under /events
+	MaxEventStreams int           `mapstructure:"max_event_streams"` // 0 is unlimited
 }
 
 type WSConfig struct {
-	Enabled         bool   `mapstructure:"enabled"`
-	ListenAddr      string `mapstructure:"listen_addr"`
-	MaxConnections  int    `mapstructure:"max_connections"`
-	ReadBufferSize  int    `mapstructure:"read_buffer_size"`
-	WriteBufferSize int    `mapstructure:"write_buffer_size"`
+	Enabled           bool          `mapstructure:"enabled"`
+	ListenAddr        string        `mapstructure:"listen_addr"`
+	MaxConnections    int           `mapstructure:"max_connections"`
+	ReadBufferSize    int           `mapstructure:"read_buffer_size"`
+	WriteBufferSize   int           `mapstructure:"write_buffer_size"`
+	MaxBackfillBlocks uint64        `mapstructure:"max_backfill_blocks"`
+	PingInterval      time.Duration `mapstructure:"ping_interval"`    // 0 disables keepalive pings
+	PongTimeout       time.Duration `mapstructure:"pong_timeout"`     // wait for a pong, or any message, after a ping
+	MaxMissedPongs    int           `mapstructure:"max_missed_pongs"` // consecutive missed pongs closing a connection
 }
 
 type HealthConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	ListenAddr  string        `mapstructure:"listen_addr"`
+	MaxBlockLag time.Duration `mapstructure:"max_block_lag"` // age of the latest block after which /health reports degraded; 0 disables
+}
+
+// AdminConfig configures the operator listener. It is unauthenticated, so
+// it should only be reachable from trusted networks.
+type AdminConfig struct {
 	Enabled    bool   `mapstructure:"enabled"`
 	ListenAddr string `mapstructure:"listen_addr"`
 }
 
 type StorageConfig struct {
-	Pika PikaConfig `mapstructure:"pika"`
+	Pika PikaConfig        `mapstructure:"pika"`
+	Cold ColdStorageConfig `mapstructure:"cold"`
+}
+
+// ColdStorageConfig configures serving old blocks from S3-compatible object
+// storage (AWS S3, GCS interoperability, MinIO)
+type ColdStorageConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Endpoint   string        `mapstructure:"endpoint"`
+	Bucket     string        `mapstructure:"bucket"`
+	Region     string        `mapstructure:"region"` // defaults to us-east-1
+	Prefix     string        `mapstructure:"prefix"`
+	AccessKey  string        `mapstructure:"access_key"` // empty for anonymous access
+	SecretKey  string        `mapstructure:"secret_key"`
+	PathStyle  bool          `mapstructure:"path_style"`  // bucket in the path instead of the host, as MinIO expects
+	BelowBlock uint64        `mapstructure:"below_block"` // blocks below this height are read from object storage
+	CacheSize  int           `mapstructure:"cache_size"`  // blocks kept in memory
+	Timeout    time.Duration `mapstructure:"timeout"`
 }
 
 type PikaConfig struct {
-	Addr           string        `mapstructure:"addr"`
-	Password       string        `mapstructure:"password"`
-	DB             int           `mapstructure:"db"`
-	MaxConnections int           `mapstructure:"max_connections"`
-	DialTimeout    time.Duration `mapstructure:"dial_timeout"`
-	ReadTimeout    time.Duration `mapstructure:"read_timeout"`
-	WriteTimeout   time.Duration `mapstructure:"write_timeout"`
+	Mode             string         `mapstructure:"mode"` // standalone (default), cluster, sentinel or memory
+	Addr             string         `mapstructure:"addr"`
+	Addrs            []string       `mapstructure:"addrs"` // cluster nodes or sentinel addresses
+	MasterName       string         `mapstructure:"master_name"`
+	SentinelPassword string         `mapstructure:"sentinel_password"`
+	Password         string         `mapstructure:"password"`
+	DB               int            `mapstructure:"db"`
+	MaxConnections   int            `mapstructure:"max_connections"`
+	DialTimeout      time.Duration  `mapstructure:"dial_timeout"`
+	ReadTimeout      time.Duration  `mapstructure:"read_timeout"`
+	WriteTimeout     time.Duration  `mapstructure:"write_timeout"`
+	TLS              TLSConfig      `mapstructure:"tls"`
+	Replicas         ReplicaConfig  `mapstructure:"replicas"`
+	OpTimeout        time.Duration  `mapstructure:"op_timeout"` // per attempt; 0 relies on read/write timeouts
+	Retry            RetryConfig    `mapstructure:"retry"`
+	Breaker          BreakerConfig  `mapstructure:"breaker"`
+	Degraded         DegradedConfig `mapstructure:"degraded"`
+	Startup          StartupConfig  `mapstructure:"startup"`
+}
+
+// RetryConfig configures retries of idempotent storage reads
+type RetryConfig struct {
+	MaxAttempts int           `mapstructure:"max_attempts"` // including the first attempt
+	Backoff     time.Duration `mapstructure:"backoff"`      // doubled after every attempt
+}
+
+// BreakerConfig configures the storage circuit breaker
+type BreakerConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	FailureThreshold int           `mapstructure:"failure_threshold"` // consecutive failures that open the breaker
+	OpenTimeout      time.Duration `mapstructure:"open_timeout"`      // time before a trial request is let through
+}
+
+// StartupConfig configures waiting for Pika when the service starts
+type StartupConfig struct {
+	MaxAttempts  int           `mapstructure:"max_attempts"`  // connection checks before giving up; 0 retries forever
+	Backoff      time.Duration `mapstructure:"backoff"`       // doubled after every attempt; 0 checks once
+	MaxBackoff   time.Duration `mapstructure:"max_backoff"`   // 0 for no limit
+	StartUnready bool          `mapstructure:"start_unready"` // start anyway and report not ready until Pika is up
+}
+
+// DegradedConfig configures serving cached data read-only while Pika is
+// unreachable
+type DegradedConfig struct {
+	Enabled           bool          `mapstructure:"enabled"`
+	ProbeInterval     time.Duration `mapstructure:"probe_interval"`
+	FailureThreshold  int           `mapstructure:"failure_threshold"`  // consecutive failed probes before degrading
+	RecoveryThreshold int           `mapstructure:"recovery_threshold"` // consecutive successful probes before recovering
+}
+
+// ReplicaConfig configures routing reads to read replicas
+type ReplicaConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	Addrs          []string      `mapstructure:"addrs"`   // replica addresses; unused in cluster mode
+	Balance        string        `mapstructure:"balance"` // round_robin (default) or latency
+	HealthInterval time.Duration `mapstructure:"health_interval"`
+	FailThreshold  int           `mapstructure:"fail_threshold"` // failed probes before a replica is ejected
+}
+
+// Replica balancing strategies
+const (
+	BalanceRoundRobin = "round_robin"
+	BalanceLatency    = "latency"
+)
+
+// Pika connection modes
+const (
+	PikaModeStandalone = "standalone"
+	PikaModeCluster    = "cluster"
+	PikaModeSentinel   = "sentinel"
+	PikaModeMemory     = "memory" // in-process keyspace for demos and tests
+)
+
+// TLSConfig configures TLS for outgoing connections
+type TLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
 }
 
 type CacheConfig struct {
@@ -76,7 +236,10 @@ type CacheConfig struct {
 	ReceiptCacheSize  int                `mapstructure:"receipt_cache_size"`
 	BalanceCacheSize  int                `mapstructure:"balance_cache_size"`
 	CodeCacheSize     int                `mapstructure:"code_cache_size"`
+	SenderCacheSize   int                `mapstructure:"sender_cache_size"`
+	WarmBlocks        uint64             `mapstructure:"warm_blocks"`
 	TTL               CacheTTLConfig     `mapstructure:"ttl"`
+	L2                L2CacheConfig      `mapstructure:"l2"`
 }
 
 type CacheTTLConfig struct {
@@ -87,11 +250,25 @@ type CacheTTLConfig struct {
 	Code        time.Duration `mapstructure:"code"`
 }
 
+// L2CacheConfig configures the shared response cache kept in a separate
+// Redis/Pika database
+type L2CacheConfig struct {
+	Enabled       bool                     `mapstructure:"enabled"`
+	Addr          string                   `mapstructure:"addr"`
+	Password      string                   `mapstructure:"password"`
+	DB            int                      `mapstructure:"db"`
+	Version       string                   `mapstructure:"version"`
+	TTL           time.Duration            `mapstructure:"ttl"`
+	MethodTTL     map[string]time.Duration `mapstructure:"method_ttl"` // per method, overriding ttl
+	Confirmations uint64                   `mapstructure:"confirmations"`
+}
+
 type RateLimitConfig struct {
-	Enabled bool                       `mapstructure:"enabled"`
-	Global  RateLimitRuleConfig        `mapstructure:"global"`
-	IP      RateLimitRuleConfig        `mapstructure:"ip"`
-	Method  map[string]int             `mapstructure:"method"`
+	Enabled  bool                `mapstructure:"enabled"`
+	Global   RateLimitRuleConfig `mapstructure:"global"`
+	IP       RateLimitRuleConfig `mapstructure:"ip"`
+	Method   map[string]int      `mapstructure:"method"`
+	Adaptive AdaptiveLimitConfig `mapstructure:"adaptive"`
 }
 
 type RateLimitRuleConfig struct {
@@ -99,6 +276,48 @@ type RateLimitRuleConfig struct {
 	Burst             int `mapstructure:"burst"`
 }
 
+// AdaptiveLimitConfig configures tightening the rate limits while Pika is
+// slow or too many calls are in flight, so that the storage tier is not
+// overwhelmed by traffic spikes
+type AdaptiveLimitConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	LatencyP99  time.Duration `mapstructure:"latency_p99"`   // Pika p99 latency above which limits tighten, 0 to ignore
+	MaxInFlight int           `mapstructure:"max_in_flight"` // calls in flight above which limits tighten, 0 to ignore
+	Window      time.Duration `mapstructure:"window"`        // latency is measured over, at most 1m
+	Interval    time.Duration `mapstructure:"interval"`      // between adjustments
+	MinFactor   float64       `mapstructure:"min_factor"`    // lowest fraction of the configured limits
+}
+
+// DenylistConfig configures refusing banned clients. Bans are stored in
+// Pika, shared by all replicas and managed through the admin namespace.
+type DenylistConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"` // reload from Pika besides change notifications
+	AutoBan         AutoBanConfig `mapstructure:"auto_ban"`
+}
+
+// AutoBanConfig configures temporary bans of clients that keep exceeding
+// the per-IP rate limit
+type AutoBanConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Violations int           `mapstructure:"violations"` // rejected requests within window that trigger a ban
+	Window     time.Duration `mapstructure:"window"`
+	Duration   time.Duration `mapstructure:"duration"`
+}
+
+// QoSConfig configures priority classes of calls: critical, normal and
+// best_effort. Once max_concurrent calls are executing, further ones wait
+// for a slot in class order and are shed when none frees up in time,
+// best-effort ones first. Critical calls are never held back.
+type QoSConfig struct {
+	Enabled       bool                `mapstructure:"enabled"`
+	MaxConcurrent int                 `mapstructure:"max_concurrent"` // calls executing at once
+	MaxQueued     int                 `mapstructure:"max_queued"`     // calls waiting for a slot
+	QueueTimeout  time.Duration       `mapstructure:"queue_timeout"`  // how long a call waits before it is shed
+	Methods       map[string][]string `mapstructure:"methods"`        // class to methods or namespaces; others are normal
+	Keys          map[string][]string `mapstructure:"keys"`           // class to API keys, overriding the class of their calls
+}
+
 type WorkerPoolsConfig struct {
 	Query   PoolConfig `mapstructure:"query"`
 	Compute PoolConfig `mapstructure:"compute"`
@@ -111,13 +330,63 @@ type PoolConfig struct {
 }
 
 type EVMConfig struct {
-	CallGasLimit         uint64  `mapstructure:"call_gas_limit"`
-	EstimateGasMultiplier float64 `mapstructure:"estimate_gas_multiplier"`
+	CallGasLimit          uint64        `mapstructure:"call_gas_limit"`
+	EstimateGasMultiplier float64       `mapstructure:"estimate_gas_multiplier"`
+	TxTypes               []string      `mapstructure:"tx_types"`              // accepted transaction types; empty accepts legacy, access_list and dynamic_fee
+	AllowUnprotectedTxs   bool          `mapstructure:"allow_unprotected_txs"` // accept legacy transactions without an EIP-155 chain ID
+	MaxTxSize             uint64        `mapstructure:"max_tx_size"`           // bytes; 0 is 128KB
+	MaxInitCodeSize       uint64        `mapstructure:"max_init_code_size"`    // bytes; 0 is the EIP-3860 limit
+	CallTimeout           time.Duration `mapstructure:"call_timeout"`          // per eth_call or eth_callMany; 0 is unlimited
+	MaxBundleCalls        int           `mapstructure:"max_bundle_calls"`      // calls per eth_callMany or evm_multicall; 0 is unlimited
+	Multicall3Address     string        `mapstructure:"multicall3_address"`    // Multicall3 contract of evm_multicall; empty if none
 }
 
 type APIConfig struct {
-	EnabledNamespaces []string `mapstructure:"enabled_namespaces"`
-	DisabledMethods   []string `mapstructure:"disabled_methods"`
+	EnabledNamespaces []string            `mapstructure:"enabled_namespaces"`
+	DisabledMethods   []string            `mapstructure:"disabled_methods"`
+	Bindings          map[string][]string `mapstructure:"bindings"` // namespace to the listeners (http, ws, private) serving it; unbound namespaces are served on all
+	FilterTimeout     time.Duration       `mapstructure:"filter_timeout"`
+	JSONCodec         string              `mapstructure:"json_codec"`   // fast or std
+	LegacyStubs       bool                `mapstructure:"legacy_stubs"` // eth_coinbase, eth_mining, eth_hashrate, eth_protocolVersion, eth_accounts
+	Logs              LogsConfig          `mapstructure:"logs"`
+	MaxStateBatch     int                 `mapstructure:"max_state_batch"` // addresses plus storage slots per evm_getBalances or evm_getAccounts; 0 is unlimited
+	Token             TokenConfig         `mapstructure:"token"`
+	ENS               ENSConfig           `mapstructure:"ens"`
+}
+
+// ENSConfig configures evm_resolveName and evm_lookupAddress
+type ENSConfig struct {
+	Registry    string        `mapstructure:"registry"` // ENS-compatible registry address; empty disables the methods
+	CacheSize   int           `mapstructure:"cache_size"`
+	CacheTTL    time.Duration `mapstructure:"cache_ttl"`    // 0 caches until evicted
+	CCIPRead    bool          `mapstructure:"ccip_read"`    // follow EIP-3668 offchain lookups to gateways
+	CCIPTimeout time.Duration `mapstructure:"ccip_timeout"` // per gateway request
+}
+
+// TokenConfig configures the token namespace
+type TokenConfig struct {
+	Tokens    []string `mapstructure:"tokens"`     // token addresses of token_balances
+	CacheSize int      `mapstructure:"cache_size"` // token metadata and balances cached
+}
+
+// LogsConfig limits eth_getLogs and filter log queries; zero is unlimited
+type LogsConfig struct {
+	MaxBlockRange uint64        `mapstructure:"max_block_range"`
+	MaxAddresses  int           `mapstructure:"max_addresses"`
+	MaxTopics     int           `mapstructure:"max_topics"` // per topic position
+	MaxResults    int           `mapstructure:"max_results"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+}
+
+// NamespaceEnabled reports whether an RPC namespace is listed in
+// enabled_namespaces
+func (c APIConfig) NamespaceEnabled(namespace string) bool {
+	for _, ns := range c.EnabledNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
 }
 
 type MetricsConfig struct {
@@ -125,13 +394,164 @@ type MetricsConfig struct {
 	ListenAddr string `mapstructure:"listen_addr"`
 }
 
+// TracingConfig configures exporting OpenTelemetry traces over OTLP/HTTP
+type TracingConfig struct {
+	Enabled     bool              `mapstructure:"enabled"`
+	Endpoint    string            `mapstructure:"endpoint"` // collector host:port
+	Insecure    bool              `mapstructure:"insecure"` // plain HTTP instead of TLS
+	Headers     map[string]string `mapstructure:"headers"`  // e.g. authentication of a hosted backend
+	ServiceName string            `mapstructure:"service_name"`
+	SampleRatio float64           `mapstructure:"sample_ratio"` // share of new traces recorded; sampled parents are always followed
+}
+
 type LoggingConfig struct {
-	Level              string        `mapstructure:"level"`
-	Format             string        `mapstructure:"format"`
-	Output             string        `mapstructure:"output"`
-	SlowQueryThreshold time.Duration `mapstructure:"slow_query_threshold"`
+	Level              string          `mapstructure:"level"`
+	Format             string          `mapstructure:"format"`
+	Output             string          `mapstructure:"output"`
+	SlowQueryThreshold time.Duration   `mapstructure:"slow_query_threshold"`
+	Access             AccessLogConfig `mapstructure:"access"`
+}
+
+// AccessLogConfig configures a JSON line per RPC call, written to a sink of
+// its own
+type AccessLogConfig struct {
+	Enabled    bool               `mapstructure:"enabled"`
+	Output     string             `mapstructure:"output"`      // file path, stdout or stderr
+	SampleRate float64            `mapstructure:"sample_rate"` // share of calls logged
+	Methods    map[string]float64 `mapstructure:"methods"`     // sample rates overriding sample_rate per method
+}
+
+// ReloadConfig configures applying config file changes at runtime. A
+// reload can always be triggered with SIGHUP.
+type ReloadConfig struct {
+	Watch bool `mapstructure:"watch"` // reload when the config file changes
+}
+
+// IngestConfig configures following an upstream node to populate Pika
+type IngestConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	UpstreamURL  string        `mapstructure:"upstream_url"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	StartBlock   uint64        `mapstructure:"start_block"`
+	StateDiffs   bool          `mapstructure:"state_diffs"`
+}
+
+// FallbackConfig configures proxying the calls this service cannot answer
+// to an upstream node, for running it in front of existing nodes
+type FallbackConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	URL            string        `mapstructure:"url"`             // HTTP or WebSocket endpoint of the upstream node
+	Timeout        time.Duration `mapstructure:"timeout"`         // per attempt
+	Retries        int           `mapstructure:"retries"`         // further attempts of immutable reads after a transport failure
+	Methods        []string      `mapstructure:"methods"`         // unregistered methods proxied; if empty, those of served namespaces
+	MissingMethods []string      `mapstructure:"missing_methods"` // methods also proxied when their data is not indexed yet
+	CacheSize      int           `mapstructure:"cache_size"`      // proxied immutable results kept in memory, 0 disables caching
+	CacheTTL       time.Duration `mapstructure:"cache_ttl"`
+}
+
+// TxPoolConfig configures the transaction pool kept in Pika
+type TxPoolConfig struct {
+	PriceBump      uint64        `mapstructure:"price_bump"`      // minimum fee increase in percent to replace a pending tx
+	MaxTxs         int           `mapstructure:"max_txs"`         // 0 is unlimited
+	MaxPerAccount  int           `mapstructure:"max_per_account"` // 0 is unlimited
+	Lifetime       time.Duration `mapstructure:"lifetime"`        // 0 keeps transactions until evicted otherwise
+	EvictInterval  time.Duration `mapstructure:"evict_interval"`
+	StatusTTL      time.Duration `mapstructure:"status_ttl"`      // how long dropped and replaced txs are remembered
+	IdempotencyTTL time.Duration `mapstructure:"idempotency_ttl"` // how long idempotency keys of submissions are remembered
+	MaxSendBatch   int           `mapstructure:"max_send_batch"`  // transactions per eth_sendRawTransactions; 0 is unlimited
+	PriceLimit     uint64        `mapstructure:"price_limit"`     // minimum gas tip in wei for new txs
+	AllowSenders   []string      `mapstructure:"allow_senders"`   // if set, only these senders may submit
+	DenySenders    []string      `mapstructure:"deny_senders"`
+	AllowTargets   []string      `mapstructure:"allow_targets"` // if set, txs may only call these addresses
+	DenyTargets    []string      `mapstructure:"deny_targets"`
+}
+
+// PruningConfig configures retention of historical state
+type PruningConfig struct {
+	Mode          string        `mapstructure:"mode"`      // archive (default) or pruned
+	Retention     uint64        `mapstructure:"retention"` // blocks of historical state kept in pruned mode
+	Interval      time.Duration `mapstructure:"interval"`
+	SweepInterval time.Duration `mapstructure:"sweep_interval"`  // full keyspace scans for unindexed state; 0 disables
+	BatchSize     int           `mapstructure:"batch_size"`      // keys deleted per round trip
+	KeysPerSecond int           `mapstructure:"keys_per_second"` // 0 disables rate limiting
+}
+
+// AccountsConfig configures server-side signing for eth_sendTransaction
+// and friends
+type AccountsConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	Backend      string        `mapstructure:"backend"`       // keystore or remote
+	KeystoreDir  string        `mapstructure:"keystore_dir"`  // directory of encrypted key files
+	PasswordFile string        `mapstructure:"password_file"` // unlocks the keystore at startup
+	RemoteURL    string        `mapstructure:"remote_url"`    // JSON-RPC endpoint of a remote signer
+	Timeout      time.Duration `mapstructure:"timeout"`
+}
+
+// BridgeConfig configures mirroring new blocks, logs and pending
+// transactions into a message broker for downstream data pipelines
+type BridgeConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Broker    string        `mapstructure:"broker"`     // nats or kafka
+	BrokerURL string        `mapstructure:"broker_url"` // NATS server, or Kafka REST proxy
+	Prefix    string        `mapstructure:"prefix"`     // subjects or topics are <prefix>.blocks, .logs and .pending
+	Timeout   time.Duration `mapstructure:"timeout"`    // per publish
+}
+
+// Message brokers of the event bridge
+const (
+	BridgeBrokerNATS  = "nats"
+	BridgeBrokerKafka = "kafka"
+)
+
+// WebhooksConfig configures POSTing the matching logs and transactions of
+// new blocks to the webhooks registered with admin_addWebhook
+type WebhooksConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	Workers         int           `mapstructure:"workers"`          // concurrent deliveries
+	QueueSize       int           `mapstructure:"queue_size"`       // deliveries waiting for a worker; more are dropped
+	Timeout         time.Duration `mapstructure:"timeout"`          // per attempt
+	MaxRetries      int           `mapstructure:"max_retries"`      // further attempts after failures
+	RetryBackoff    time.Duration `mapstructure:"retry_backoff"`    // delay before the first retry, doubled after each
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"` // reload from Pika besides change notifications
 }
 
+// DevConfig configures the synthetic chain mined in process by `rpc dev`
+type DevConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	BlockTime time.Duration `mapstructure:"block_time"` // interval between mined blocks
+	GasLimit  uint64        `mapstructure:"gas_limit"`  // of every block
+	Accounts  int           `mapstructure:"accounts"`   // funded accounts derived from seed
+	Balance   uint64        `mapstructure:"balance"`    // of every funded account, in ether
+	Seed      string        `mapstructure:"seed"`       // derives the keys of the funded accounts
+}
+
+// RecorderConfig configures recording sampled calls with their responses,
+// to re-execute them with `rpc replay`
+type RecorderConfig struct {
+	Enabled       bool               `mapstructure:"enabled"`
+	Output        string             `mapstructure:"output"`          // file path, or pika
+	SampleRate    float64            `mapstructure:"sample_rate"`     // share of calls recorded
+	Methods       map[string]float64 `mapstructure:"methods"`         // sample rates overriding sample_rate per method
+	TTL           time.Duration      `mapstructure:"ttl"`             // of recordings kept in Pika
+	MaxResultSize int                `mapstructure:"max_result_size"` // larger results are recorded by hash only
+	QueueSize     int                `mapstructure:"queue_size"`      // recordings waiting to be written; more are dropped
+}
+
+// RecorderOutputPika makes the recorder write to Pika instead of a file
+const RecorderOutputPika = "pika"
+
+// Account backends
+const (
+	AccountsBackendKeystore = "keystore"
+	AccountsBackendRemote   = "remote"
+)
+
+// State pruning modes
+const (
+	PruningModeArchive = "archive"
+	PruningModePruned  = "pruned"
+)
+
 // LoadConfig loads configuration from file
 func LoadConfig(path string) (*Config, error) {
 	v := viper.New()
@@ -146,25 +566,79 @@ func LoadConfig(path string) (*Config, error) {
 	if err := v.Unmarshal(&config); err != nil {
 		return nil, err
 	}
+	if err := resolveSecrets(&config); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
 
-// LoadConfigWithDefaults loads configuration with environment variable support
-func LoadConfigWithDefaults(path string) (*Config, error) {
+// EnvPrefix prefixes the environment variables that override config keys.
+// The key storage.pika.addr is read from EVMRPC_STORAGE_PIKA_ADDR.
+const EnvPrefix = "EVMRPC"
+
+// LoadConfigWithDefaults loads configuration from file with environment
+// variable support. Keys are resolved in order of precedence: overrides
+// (from command line flags), environment variables, the file, defaults.
+// Overrides are keyed by the dotted config key.
+func LoadConfigWithDefaults(path string, overrides map[string]interface{}) (*Config, error) {
 	v := viper.New()
 	v.SetConfigFile(path)
 	v.SetConfigType("yaml")
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	v.AutomaticEnv()
+	setDefaults(v)
+
+	// AutomaticEnv only applies to keys viper already knows of, so bind
+	// every key, including those missing from the file
+	for _, key := range configKeys(reflect.TypeOf(Config{}), "") {
+		if err := v.BindEnv(key); err != nil {
+			return nil, err
+		}
+	}
 
 	if err := v.ReadInConfig(); err != nil {
 		return nil, err
 	}
 
+	for key, value := range overrides {
+		v.Set(key, value)
+	}
+
 	var config Config
 	if err := v.Unmarshal(&config); err != nil {
 		return nil, err
 	}
+	if err := resolveSecrets(&config); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
+
+// configKeys lists the dotted keys of the fields of a config struct. Lists
+// of sections, such as chains, can only be set in the file.
+func configKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			keys = append(keys, configKeys(field.Type, key+".")...)
+		case reflect.Slice:
+			if field.Type.Elem().Kind() != reflect.Struct {
+				keys = append(keys, key)
+			}
+		default:
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
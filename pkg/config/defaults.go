@@ -0,0 +1,177 @@
+package config
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaults are used for keys missing from the config file and environment.
+// They match config/config.yaml, so that a file only needs the chain and
+// what differs from it.
+var defaults = map[string]interface{}{
+	"server.http.enabled":           true,
+	"server.http.listen_addr":       "0.0.0.0:8545",
+	"server.http.read_timeout":      30 * time.Second,
+	"server.http.write_timeout":     30 * time.Second,
+	"server.http.idle_timeout":      120 * time.Second,
+	"server.http.max_header_bytes":  1 << 20,
+	"server.http.request_timeout":   0 * time.Second,
+	"server.http.cors_origins":      []string{"*"},
+	"server.http.vhosts":            []string{"*"},
+	"server.http.max_event_streams": 1000,
+
+	"server.ws.enabled":             true,
+	"server.ws.listen_addr":         "0.0.0.0:8546",
+	"server.ws.max_connections":     1000,
+	"server.ws.read_buffer_size":    1024,
+	"server.ws.write_buffer_size":   1024,
+	"server.ws.max_backfill_blocks": 1000,
+	"server.ws.ping_interval":       15 * time.Second,
+	"server.ws.pong_timeout":        10 * time.Second,
+	"server.ws.max_missed_pongs":    2,
+
+	"server.private.listen_addr":      "127.0.0.1:8547",
+	"server.private.read_timeout":     30 * time.Second,
+	"server.private.write_timeout":    30 * time.Second,
+	"server.private.idle_timeout":     120 * time.Second,
+	"server.private.max_header_bytes": 1 << 20,
+	"server.private.vhosts":           []string{"localhost"},
+
+	"server.health.listen_addr":   "0.0.0.0:8080",
+	"server.health.max_block_lag": 5 * time.Minute,
+
+	"server.admin.listen_addr": "127.0.0.1:8081",
+
+	"server.shutdown_timeout": 30 * time.Second,
+
+	"storage.pika.mode":                        PikaModeStandalone,
+	"storage.pika.addr":                        "127.0.0.1:9221",
+	"storage.pika.max_connections":             500,
+	"storage.pika.dial_timeout":                5 * time.Second,
+	"storage.pika.read_timeout":                10 * time.Second,
+	"storage.pika.write_timeout":               10 * time.Second,
+	"storage.pika.op_timeout":                  2 * time.Second,
+	"storage.pika.retry.max_attempts":          3,
+	"storage.pika.retry.backoff":               50 * time.Millisecond,
+	"storage.pika.breaker.enabled":             true,
+	"storage.pika.breaker.failure_threshold":   10,
+	"storage.pika.breaker.open_timeout":        5 * time.Second,
+	"storage.pika.degraded.probe_interval":     time.Second,
+	"storage.pika.degraded.failure_threshold":  3,
+	"storage.pika.degraded.recovery_threshold": 3,
+	"storage.pika.startup.max_attempts":        10,
+	"storage.pika.startup.backoff":             time.Second,
+	"storage.pika.startup.max_backoff":         30 * time.Second,
+	"storage.pika.replicas.balance":            BalanceRoundRobin,
+	"storage.pika.replicas.health_interval":    5 * time.Second,
+	"storage.pika.replicas.fail_threshold":     3,
+
+	"cache.enabled":            true,
+	"cache.block_cache_size":   1000,
+	"cache.tx_cache_size":      5000,
+	"cache.receipt_cache_size": 5000,
+	"cache.balance_cache_size": 10000,
+	"cache.code_cache_size":    1000,
+	"cache.sender_cache_size":  100000,
+	"cache.warm_blocks":        128,
+	"cache.ttl.balance":        10 * time.Second,
+	"cache.ttl.code":           time.Hour,
+
+	"ratelimit.adaptive.latency_p99":   50 * time.Millisecond,
+	"ratelimit.adaptive.max_in_flight": 0,
+	"ratelimit.adaptive.window":        10 * time.Second,
+	"ratelimit.adaptive.interval":      time.Second,
+	"ratelimit.adaptive.min_factor":    0.1,
+
+	"denylist.refresh_interval":    30 * time.Second,
+	"denylist.auto_ban.violations": 100,
+	"denylist.auto_ban.window":     time.Minute,
+	"denylist.auto_ban.duration":   10 * time.Minute,
+
+	"qos.max_concurrent":      256,
+	"qos.max_queued":          1024,
+	"qos.queue_timeout":       2 * time.Second,
+	"qos.methods.critical":    []string{"eth_subscribe", "eth_unsubscribe", "eth_chainId", "net_version", "web3_clientVersion"},
+	"qos.methods.best_effort": []string{"debug", "trace"},
+
+	"evm.call_gas_limit":          50000000,
+	"evm.estimate_gas_multiplier": 1.2,
+	"evm.call_timeout":            5 * time.Second,
+	"evm.max_bundle_calls":        100,
+	"evm.multicall3_address":      "0xcA11bde05977b3631167028862bE2a173976CA11",
+
+	"txpool.max_send_batch": 100,
+
+	"api.enabled_namespaces":   []string{"eth", "net", "web3", "txpool"},
+	"api.filter_timeout":       5 * time.Minute,
+	"api.json_codec":           "fast",
+	"api.logs.max_block_range": 1000,
+	"api.logs.max_addresses":   100,
+	"api.logs.max_topics":      100,
+	"api.logs.max_results":     10000,
+	"api.logs.timeout":         10 * time.Second,
+	"api.max_state_batch":      1000,
+	"api.token.cache_size":     10000,
+	"api.ens.cache_size":       10000,
+	"api.ens.cache_ttl":        5 * time.Minute,
+	"api.ens.ccip_timeout":     10 * time.Second,
+
+	"metrics.listen_addr": "0.0.0.0:9092",
+
+	"tracing.endpoint":     "localhost:4318",
+	"tracing.service_name": "evm-rpc",
+	"tracing.sample_ratio": 1.0,
+
+	"logging.level":                "info",
+	"logging.format":               "json",
+	"logging.output":               "stdout",
+	"logging.slow_query_threshold": time.Second,
+	"logging.access.output":        "stdout",
+	"logging.access.sample_rate":   1.0,
+
+	"fallback.timeout":    5 * time.Second,
+	"fallback.retries":    2,
+	"fallback.cache_size": 10000,
+	"fallback.cache_ttl":  2 * time.Second,
+	"fallback.missing_methods": []string{
+		"eth_getBlockByNumber", "eth_getBlockByHash", "eth_getBlockReceipts",
+		"eth_getTransactionByHash", "eth_getTransactionReceipt",
+		"eth_getBlockTransactionCountByNumber", "eth_getBlockTransactionCountByHash",
+		"eth_getTransactionByBlockNumberAndIndex", "eth_getTransactionByBlockHashAndIndex",
+	},
+
+	"pruning.mode": PruningModeArchive,
+
+	"accounts.backend": AccountsBackendKeystore,
+
+	"bridge.broker":  BridgeBrokerNATS,
+	"bridge.prefix":  "evm_rpc",
+	"bridge.timeout": 5 * time.Second,
+
+	"webhooks.workers":          4,
+	"webhooks.queue_size":       1000,
+	"webhooks.timeout":          10 * time.Second,
+	"webhooks.max_retries":      5,
+	"webhooks.retry_backoff":    time.Second,
+	"webhooks.refresh_interval": 30 * time.Second,
+
+	"dev.block_time": 2 * time.Second,
+	"dev.gas_limit":  30_000_000,
+	"dev.accounts":   10,
+	"dev.balance":    10000,
+	"dev.seed":       "evm_rpc dev",
+
+	"recorder.output":          RecorderOutputPika,
+	"recorder.sample_rate":     0.01,
+	"recorder.ttl":             24 * time.Hour,
+	"recorder.max_result_size": 1 << 20,
+	"recorder.queue_size":      1000,
+}
+
+// setDefaults registers the defaults with v
+func setDefaults(v *viper.Viper) {
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets in a config dump
+const redacted = "<redacted>"
+
+// Dump renders the effective configuration as YAML with secrets redacted,
+// in the layout of the config file
+func (c *Config) Dump() (string, error) {
+	node, err := dumpNode(reflect.ValueOf(*c), "")
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// dumpNode converts a config value to a YAML node, keeping the field order
+// of structs
+func dumpNode(v reflect.Value, key string) (*yaml.Node, error) {
+	if secretKeys[key] && !v.IsZero() {
+		return scalarNode(redacted)
+	}
+	if v.Kind() == reflect.String && (strings.HasSuffix(key, "_url") || key == "endpoint") {
+		return scalarNode(RedactURL(v.String()))
+	}
+
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		return scalarNode(time.Duration(v.Int()).String())
+
+	case v.Kind() == reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for i := 0; i < v.NumField(); i++ {
+			name := v.Type().Field(i).Tag.Get("mapstructure")
+			if name == "" || name == "-" {
+				continue
+			}
+			value, err := dumpNode(v.Field(i), name)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, value)
+		}
+		return node, nil
+
+	case v.Kind() == reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for i := 0; i < v.Len(); i++ {
+			value, err := dumpNode(v.Index(i), "")
+			if err != nil {
+				return nil, err
+			}
+			if value.Kind != yaml.ScalarNode {
+				node.Style = 0
+			}
+			node.Content = append(node.Content, value)
+		}
+		return node, nil
+
+	case v.Kind() == reflect.Map:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, k := range keys {
+			value, err := dumpNode(v.MapIndex(k), "")
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprint(k.Interface())}, value)
+		}
+		return node, nil
+
+	default:
+		return scalarNode(v.Interface())
+	}
+}
+
+// RedactURL hides the password of credentials embedded in a URL, for
+// logging
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// scalarNode encodes a single value as a YAML node
+func scalarNode(value interface{}) (*yaml.Node, error) {
+	node := new(yaml.Node)
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
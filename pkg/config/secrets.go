@@ -0,0 +1,189 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretKeys name the config keys holding secrets. Their values may be given
+// as references resolved at load time, and are never dumped.
+var secretKeys = map[string]bool{
+	"password":          true,
+	"sentinel_password": true,
+	"access_key":        true,
+	"secret_key":        true,
+	"headers":           true, // tracing headers carry backend credentials
+}
+
+// SecretProvider resolves a secret reference such as the path in
+// "vault:secret/data/rpc#pika_password"
+type SecretProvider func(ctx context.Context, ref string) (string, error)
+
+var (
+	secretProvidersMu sync.RWMutex
+	secretProviders   = map[string]SecretProvider{
+		"file":  fileSecret,
+		"env":   envSecret,
+		"vault": vaultSecret,
+	}
+)
+
+// secretTimeout bounds resolving a single secret
+const secretTimeout = 10 * time.Second
+
+// RegisterSecretProvider makes secrets written as "scheme:ref" resolve
+// through provider, e.g. to fetch them from a cloud KMS or secrets manager.
+// It must be called before the config is loaded.
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	secretProviders[scheme] = provider
+}
+
+// resolveSecrets fills in the secrets of cfg. A secret is read from the file
+// named by its environment variable with a _FILE suffix if set, and a value
+// of the form "scheme:ref" is then resolved by the provider of the scheme.
+func resolveSecrets(cfg *Config) error {
+	return resolveSecretFields(reflect.ValueOf(cfg).Elem(), "", true)
+}
+
+// resolveSecretFields resolves the secrets of a config struct. Keys inside
+// lists have no environment variables.
+func resolveSecretFields(v reflect.Value, prefix string, env bool) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+		value := v.Field(i)
+
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			if err := resolveSecretFields(value, key+".", env); err != nil {
+				return err
+			}
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+			for j := 0; j < value.Len(); j++ {
+				if err := resolveSecretFields(value.Index(j), fmt.Sprintf("%s[%d].", key, j), false); err != nil {
+					return err
+				}
+			}
+		case secretKeys[name] && field.Type.Kind() == reflect.String:
+			secret := value.String()
+			if env {
+				envName := EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_")) + "_FILE"
+				if path := os.Getenv(envName); path != "" {
+					s, err := fileSecret(context.Background(), path)
+					if err != nil {
+						return fmt.Errorf("%s: %w", envName, err)
+					}
+					secret = s
+				}
+			}
+			secret, err := resolveSecret(secret)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			value.SetString(secret)
+		}
+	}
+	return nil
+}
+
+// resolveSecret resolves a secret reference. Values without a known scheme
+// are the secret itself.
+func resolveSecret(value string) (string, error) {
+	scheme, ref, ok := strings.Cut(value, ":")
+	if !ok {
+		return value, nil
+	}
+	secretProvidersMu.RLock()
+	provider, ok := secretProviders[scheme]
+	secretProvidersMu.RUnlock()
+	if !ok {
+		return value, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	return provider(ctx, ref)
+}
+
+// fileSecret reads a secret from a file, as mounted by Docker and
+// Kubernetes secrets
+func fileSecret(ctx context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// envSecret reads a secret from an environment variable
+func envSecret(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// vaultSecret reads a field of a HashiCorp Vault secret, referenced as
+// path#field, e.g. secret/data/rpc#pika_password. The server and token are
+// taken from VAULT_ADDR and VAULT_TOKEN. Both KV v1 and v2 are supported.
+func vaultSecret(ctx context.Context, ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("vault reference %q is not path#field", ref)
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault: reading %s: %s", path, resp.Status)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	data := body.Data
+	// KV v2 nests the secret under data.data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, isMeta := data["metadata"]; isMeta {
+			data = nested
+		}
+	}
+	secret, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault: %s has no field %s", path, field)
+	}
+	return secret, nil
+}
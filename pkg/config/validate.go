@@ -0,0 +1,488 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Validate checks the configuration for missing and nonsensical values. All
+// problems are reported at once, each naming the key to fix.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Chain.ChainID == 0 {
+		fail("chain.chain_id is required")
+	}
+
+	if c.Server.HTTP.Enabled {
+		if err := checkListenAddr(c.Server.HTTP.ListenAddr); err != nil {
+			fail("server.http.listen_addr: %v", err)
+		}
+		if http := c.Server.HTTP; http.WriteTimeout > 0 && http.RequestTimeout >= http.WriteTimeout {
+			fail("server.http.request_timeout (%v) must be below server.http.write_timeout (%v), or the error could not be written", http.RequestTimeout, http.WriteTimeout)
+		}
+	}
+	if c.Server.Private.Enabled {
+		if err := checkListenAddr(c.Server.Private.ListenAddr); err != nil {
+			fail("server.private.listen_addr: %v", err)
+		}
+		if private := c.Server.Private; private.WriteTimeout > 0 && private.RequestTimeout >= private.WriteTimeout {
+			fail("server.private.request_timeout (%v) must be below server.private.write_timeout (%v), or the error could not be written", private.RequestTimeout, private.WriteTimeout)
+		}
+	}
+	if c.Server.WS.Enabled {
+		if err := checkListenAddr(c.Server.WS.ListenAddr); err != nil {
+			fail("server.ws.listen_addr: %v", err)
+		}
+		if ws := c.Server.WS; ws.PingInterval > 0 {
+			if ws.PongTimeout <= 0 || ws.PongTimeout >= ws.PingInterval {
+				fail("server.ws.pong_timeout (%v) must be positive and below server.ws.ping_interval (%v)", ws.PongTimeout, ws.PingInterval)
+			}
+			if ws.MaxMissedPongs < 1 {
+				fail("server.ws.max_missed_pongs must be at least 1, got %d", ws.MaxMissedPongs)
+			}
+		}
+	}
+	if c.Server.Health.Enabled {
+		if err := checkListenAddr(c.Server.Health.ListenAddr); err != nil {
+			fail("server.health.listen_addr: %v", err)
+		}
+	}
+	if c.Server.Admin.Enabled {
+		if err := checkListenAddr(c.Server.Admin.ListenAddr); err != nil {
+			fail("server.admin.listen_addr: %v", err)
+		}
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		fail("server.shutdown_timeout must be positive, got %v", c.Server.ShutdownTimeout)
+	}
+	if !c.Server.HTTP.Enabled && !c.Server.WS.Enabled && !c.Ingest.Enabled {
+		fail("server.http and server.ws are both disabled; enable one of them or ingest")
+	}
+	if c.Metrics.Enabled {
+		if err := checkListenAddr(c.Metrics.ListenAddr); err != nil {
+			fail("metrics.listen_addr: %v", err)
+		}
+	}
+	if c.Tracing.Enabled {
+		if c.Tracing.Endpoint == "" {
+			fail("tracing.endpoint is required when tracing is enabled")
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			fail("tracing.sample_ratio must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+		}
+	}
+
+	errs = append(errs, validatePika("storage.pika", c.Storage.Pika)...)
+	if c.Storage.Cold.Enabled && c.Storage.Cold.Bucket == "" {
+		fail("storage.cold.bucket is required when cold storage is enabled")
+	}
+
+	if c.Cache.Enabled {
+		for _, size := range []struct {
+			key   string
+			value int
+		}{
+			{"block_cache_size", c.Cache.BlockCacheSize},
+			{"tx_cache_size", c.Cache.TxCacheSize},
+			{"receipt_cache_size", c.Cache.ReceiptCacheSize},
+			{"balance_cache_size", c.Cache.BalanceCacheSize},
+			{"code_cache_size", c.Cache.CodeCacheSize},
+		} {
+			if size.value <= 0 {
+				fail("cache.%s must be positive when the cache is enabled, got %d", size.key, size.value)
+			}
+		}
+	}
+	if c.Cache.L2.Enabled && c.Cache.L2.Addr == "" {
+		fail("cache.l2.addr is required when the L2 cache is enabled")
+	}
+	for method, ttl := range c.Cache.L2.MethodTTL {
+		if ttl <= 0 {
+			fail("cache.l2.method_ttl.%s must be positive, got %v", method, ttl)
+		}
+	}
+
+	if c.RateLimit.Enabled {
+		for _, rule := range []struct {
+			key  string
+			rule RateLimitRuleConfig
+		}{{"global", c.RateLimit.Global}, {"ip", c.RateLimit.IP}} {
+			if rule.rule.RequestsPerSecond < 0 || rule.rule.Burst < 0 {
+				fail("ratelimit.%s must not be negative", rule.key)
+			} else if rule.rule.RequestsPerSecond > 0 && rule.rule.Burst == 0 {
+				fail("ratelimit.%s.burst must be positive when requests_per_second is set", rule.key)
+			}
+		}
+	}
+
+	if adaptive := c.RateLimit.Adaptive; adaptive.Enabled {
+		if !c.RateLimit.Enabled {
+			fail("ratelimit.adaptive requires rate limiting to be enabled")
+		}
+		if adaptive.LatencyP99 <= 0 && adaptive.MaxInFlight <= 0 {
+			fail("ratelimit.adaptive needs latency_p99 or max_in_flight")
+		}
+		if adaptive.MaxInFlight < 0 {
+			fail("ratelimit.adaptive.max_in_flight must not be negative, got %d", adaptive.MaxInFlight)
+		}
+		if adaptive.Window <= 0 || adaptive.Window > time.Minute {
+			fail("ratelimit.adaptive.window must be between 0 and 1m, got %v", adaptive.Window)
+		}
+		if adaptive.Interval <= 0 {
+			fail("ratelimit.adaptive.interval must be positive, got %v", adaptive.Interval)
+		}
+		if adaptive.MinFactor <= 0 || adaptive.MinFactor > 1 {
+			fail("ratelimit.adaptive.min_factor must be in (0, 1], got %v", adaptive.MinFactor)
+		}
+	}
+
+	if c.Denylist.Enabled && c.Denylist.RefreshInterval <= 0 {
+		fail("denylist.refresh_interval must be positive, got %v", c.Denylist.RefreshInterval)
+	}
+	if c.Denylist.AutoBan.Enabled {
+		if !c.Denylist.Enabled {
+			fail("denylist.auto_ban requires the denylist to be enabled")
+		}
+		if c.Denylist.AutoBan.Violations <= 0 {
+			fail("denylist.auto_ban.violations must be positive, got %d", c.Denylist.AutoBan.Violations)
+		}
+		if c.Denylist.AutoBan.Window <= 0 || c.Denylist.AutoBan.Duration <= 0 {
+			fail("denylist.auto_ban.window and duration must be positive")
+		}
+	}
+
+	if c.QoS.Enabled {
+		if c.QoS.MaxConcurrent <= 0 {
+			fail("qos.max_concurrent must be positive, got %d", c.QoS.MaxConcurrent)
+		}
+		if c.QoS.MaxQueued < 0 {
+			fail("qos.max_queued must not be negative, got %d", c.QoS.MaxQueued)
+		}
+		if c.QoS.QueueTimeout <= 0 {
+			fail("qos.queue_timeout must be positive, got %v", c.QoS.QueueTimeout)
+		}
+		for _, classes := range []struct {
+			key     string
+			classes map[string][]string
+		}{{"methods", c.QoS.Methods}, {"keys", c.QoS.Keys}} {
+			for class := range classes.classes {
+				if class != "critical" && class != "normal" && class != "best_effort" {
+					fail("qos.%s: unknown class %q, expected critical, normal or best_effort", classes.key, class)
+				}
+			}
+		}
+	}
+
+	if c.API.Logs.MaxAddresses < 0 || c.API.Logs.MaxTopics < 0 || c.API.Logs.MaxResults < 0 || c.API.Logs.Timeout < 0 {
+		fail("api.logs limits must not be negative")
+	}
+	if c.API.MaxStateBatch < 0 {
+		fail("api.max_state_batch must not be negative, got %d", c.API.MaxStateBatch)
+	}
+	if c.API.NamespaceEnabled("token") && c.API.Token.CacheSize <= 0 {
+		fail("api.token.cache_size must be positive, got %d", c.API.Token.CacheSize)
+	}
+	if c.API.ENS.Registry != "" {
+		if !common.IsHexAddress(c.API.ENS.Registry) {
+			fail("api.ens.registry: invalid address %q", c.API.ENS.Registry)
+		}
+		if c.API.ENS.CacheSize <= 0 {
+			fail("api.ens.cache_size must be positive, got %d", c.API.ENS.CacheSize)
+		}
+	}
+	if c.API.ENS.CacheTTL < 0 || c.API.ENS.CCIPTimeout < 0 {
+		fail("api.ens.cache_ttl and api.ens.ccip_timeout must not be negative")
+	}
+	for _, token := range c.API.Token.Tokens {
+		if !common.IsHexAddress(token) {
+			fail("api.token.tokens: invalid address %q", token)
+		}
+	}
+	namespaces := make([]string, 0, len(c.API.Bindings))
+	for namespace := range c.API.Bindings {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	listeners := map[string]bool{
+		"http":    c.Server.HTTP.Enabled,
+		"ws":      c.Server.WS.Enabled,
+		"private": c.Server.Private.Enabled,
+	}
+	for _, namespace := range namespaces {
+		served := false
+		for _, listener := range c.API.Bindings[namespace] {
+			enabled, ok := listeners[listener]
+			if !ok {
+				fail("api.bindings.%s: unknown listener %q, expected http, ws or private", namespace, listener)
+			}
+			served = served || enabled
+		}
+		if !served {
+			fail("api.bindings.%s: none of its listeners is enabled", namespace)
+		}
+	}
+
+	if c.EVM.EstimateGasMultiplier != 0 && c.EVM.EstimateGasMultiplier < 1 {
+		fail("evm.estimate_gas_multiplier must be at least 1, got %v", c.EVM.EstimateGasMultiplier)
+	}
+	if c.EVM.CallTimeout < 0 || c.EVM.MaxBundleCalls < 0 {
+		fail("evm.call_timeout and evm.max_bundle_calls must not be negative")
+	}
+	if c.EVM.Multicall3Address != "" && !common.IsHexAddress(c.EVM.Multicall3Address) {
+		fail("evm.multicall3_address: invalid address %q", c.EVM.Multicall3Address)
+	}
+	if c.TxPool.MaxSendBatch < 0 {
+		fail("txpool.max_send_batch must not be negative")
+	}
+
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("logging.level must be debug, info, warn or error, got %q", c.Logging.Level)
+	}
+
+	if c.Logging.Access.Enabled {
+		if c.Logging.Access.Output == "" {
+			fail("logging.access.output is required when the access log is enabled")
+		}
+		if c.Logging.Access.SampleRate < 0 || c.Logging.Access.SampleRate > 1 {
+			fail("logging.access.sample_rate must be between 0 and 1, got %v", c.Logging.Access.SampleRate)
+		}
+		for method, rate := range c.Logging.Access.Methods {
+			if rate < 0 || rate > 1 {
+				fail("logging.access.methods.%s must be between 0 and 1, got %v", method, rate)
+			}
+		}
+	}
+
+	if c.Ingest.Enabled && c.Ingest.UpstreamURL == "" {
+		fail("ingest.upstream_url is required when ingest is enabled")
+	}
+	if c.Fallback.Enabled {
+		if c.Fallback.URL == "" {
+			fail("fallback.url is required when the fallback is enabled")
+		}
+		if c.Fallback.Timeout <= 0 {
+			fail("fallback.timeout must be positive, got %v", c.Fallback.Timeout)
+		}
+		if c.Fallback.Retries < 0 || c.Fallback.CacheSize < 0 || c.Fallback.CacheTTL < 0 {
+			fail("fallback.retries, cache_size and cache_ttl must not be negative")
+		}
+		for _, method := range c.Fallback.Methods {
+			if !strings.Contains(method, "_") {
+				fail("fallback.methods: %q is not a namespaced method", method)
+			}
+		}
+	}
+
+	switch c.Pruning.Mode {
+	case "", PruningModeArchive:
+	case PruningModePruned:
+		if c.Pruning.Retention == 0 {
+			fail("pruning.retention must be positive in pruned mode")
+		}
+	default:
+		fail("pruning.mode must be %s or %s, got %q", PruningModeArchive, PruningModePruned, c.Pruning.Mode)
+	}
+
+	if c.Accounts.Enabled {
+		switch c.Accounts.Backend {
+		case "", AccountsBackendKeystore:
+			if c.Accounts.KeystoreDir == "" {
+				fail("accounts.keystore_dir is required with the keystore backend")
+			}
+		case AccountsBackendRemote:
+			if c.Accounts.RemoteURL == "" {
+				fail("accounts.remote_url is required with the remote backend")
+			}
+		default:
+			fail("accounts.backend must be %s or %s, got %q", AccountsBackendKeystore, AccountsBackendRemote, c.Accounts.Backend)
+		}
+	}
+
+	if c.Bridge.Enabled {
+		switch c.Bridge.Broker {
+		case BridgeBrokerNATS, BridgeBrokerKafka:
+		default:
+			fail("bridge.broker must be %s or %s, got %q", BridgeBrokerNATS, BridgeBrokerKafka, c.Bridge.Broker)
+		}
+		if c.Bridge.BrokerURL == "" {
+			fail("bridge.broker_url is required when the bridge is enabled")
+		}
+		if c.Bridge.Prefix == "" {
+			fail("bridge.prefix must not be empty")
+		}
+		if c.Bridge.Timeout <= 0 {
+			fail("bridge.timeout must be positive, got %v", c.Bridge.Timeout)
+		}
+	}
+
+	if c.Webhooks.Enabled {
+		if c.Webhooks.Workers <= 0 || c.Webhooks.QueueSize <= 0 {
+			fail("webhooks.workers and queue_size must be positive")
+		}
+		if c.Webhooks.Timeout <= 0 || c.Webhooks.RetryBackoff <= 0 || c.Webhooks.RefreshInterval <= 0 {
+			fail("webhooks.timeout, retry_backoff and refresh_interval must be positive")
+		}
+		if c.Webhooks.MaxRetries < 0 {
+			fail("webhooks.max_retries must not be negative, got %d", c.Webhooks.MaxRetries)
+		}
+	}
+
+	if c.Dev.Enabled {
+		if c.Storage.Pika.Mode != PikaModeMemory {
+			fail("dev mode requires storage.pika.mode %s, got %q", PikaModeMemory, c.Storage.Pika.Mode)
+		}
+		if c.Dev.BlockTime <= 0 {
+			fail("dev.block_time must be positive, got %v", c.Dev.BlockTime)
+		}
+		if c.Dev.GasLimit == 0 {
+			fail("dev.gas_limit must be positive")
+		}
+		if c.Dev.Accounts < 1 || c.Dev.Seed == "" {
+			fail("dev.accounts must be at least 1 and dev.seed must not be empty")
+		}
+	}
+
+	if c.Recorder.Enabled {
+		if c.Recorder.Output == "" {
+			fail("recorder.output is required when the recorder is enabled")
+		}
+		if c.Recorder.SampleRate < 0 || c.Recorder.SampleRate > 1 {
+			fail("recorder.sample_rate must be between 0 and 1, got %v", c.Recorder.SampleRate)
+		}
+		for method, rate := range c.Recorder.Methods {
+			if rate < 0 || rate > 1 {
+				fail("recorder.methods.%s must be between 0 and 1, got %v", method, rate)
+			}
+		}
+		if c.Recorder.Output == RecorderOutputPika && c.Recorder.TTL <= 0 {
+			fail("recorder.ttl must be positive, got %v", c.Recorder.TTL)
+		}
+		if c.Recorder.MaxResultSize < 0 || c.Recorder.QueueSize <= 0 {
+			fail("recorder.max_result_size must not be negative and recorder.queue_size must be positive")
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, chain := range c.Chains {
+		key := fmt.Sprintf("chains[%d]", i)
+		switch {
+		case chain.Name == "":
+			fail("%s.name is required", key)
+		case names[chain.Name]:
+			fail("%s.name %q is used by another chain", key, chain.Name)
+		}
+		names[chain.Name] = true
+		if chain.ChainID == 0 {
+			fail("%s.chain_id is required", key)
+		}
+		errs = append(errs, validatePika(key+".pika", chain.Pika)...)
+	}
+
+	errs = append(errs, negativeDurations(reflect.ValueOf(*c), "")...)
+	return errors.Join(errs...)
+}
+
+// validatePika checks the connection settings of a Pika deployment
+func validatePika(key string, cfg PikaConfig) []error {
+	var errs []error
+	switch cfg.Mode {
+	case "", PikaModeStandalone:
+		if cfg.Addr == "" {
+			errs = append(errs, fmt.Errorf("%s.addr is required", key))
+		}
+	case PikaModeCluster:
+		if len(cfg.Addrs) == 0 {
+			errs = append(errs, fmt.Errorf("%s.addrs must list the cluster nodes in cluster mode", key))
+		}
+	case PikaModeSentinel:
+		if len(cfg.Addrs) == 0 {
+			errs = append(errs, fmt.Errorf("%s.addrs must list the sentinels in sentinel mode", key))
+		}
+		if cfg.MasterName == "" {
+			errs = append(errs, fmt.Errorf("%s.master_name is required in sentinel mode", key))
+		}
+	case PikaModeMemory:
+	default:
+		errs = append(errs, fmt.Errorf("%s.mode must be %s, %s, %s or %s, got %q", key, PikaModeStandalone, PikaModeCluster, PikaModeSentinel, PikaModeMemory, cfg.Mode))
+	}
+
+	if cfg.Replicas.Enabled {
+		switch cfg.Replicas.Balance {
+		case "", BalanceRoundRobin, BalanceLatency:
+		default:
+			errs = append(errs, fmt.Errorf("%s.replicas.balance must be %s or %s, got %q", key, BalanceRoundRobin, BalanceLatency, cfg.Replicas.Balance))
+		}
+	}
+	if cfg.Degraded.Enabled {
+		if cfg.Degraded.ProbeInterval <= 0 {
+			errs = append(errs, fmt.Errorf("%s.degraded.probe_interval must be positive, got %v", key, cfg.Degraded.ProbeInterval))
+		}
+		if cfg.Degraded.FailureThreshold < 1 || cfg.Degraded.RecoveryThreshold < 1 {
+			errs = append(errs, fmt.Errorf("%s.degraded.failure_threshold and recovery_threshold must be at least 1", key))
+		}
+	}
+	if cfg.Startup.MaxAttempts < 0 {
+		errs = append(errs, fmt.Errorf("%s.startup.max_attempts must not be negative", key))
+	}
+	if cfg.Startup.MaxBackoff > 0 && cfg.Startup.MaxBackoff < cfg.Startup.Backoff {
+		errs = append(errs, fmt.Errorf("%s.startup.max_backoff (%v) must not be below backoff (%v)", key, cfg.Startup.MaxBackoff, cfg.Startup.Backoff))
+	}
+	if cfg.MaxConnections < 0 {
+		errs = append(errs, fmt.Errorf("%s.max_connections must not be negative", key))
+	}
+	return errs
+}
+
+// checkListenAddr checks that addr is a host:port to listen on
+func checkListenAddr(addr string) error {
+	if addr == "" {
+		return errors.New("required")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return err
+	}
+	return nil
+}
+
+// negativeDurations reports every negative timeout or interval in a config
+// struct
+func negativeDurations(v reflect.Value, prefix string) []error {
+	var errs []error
+	durationType := reflect.TypeOf(time.Duration(0))
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+		value := v.Field(i)
+
+		switch {
+		case field.Type == durationType:
+			if value.Int() < 0 {
+				errs = append(errs, fmt.Errorf("%s must not be negative, got %v", key, time.Duration(value.Int())))
+			}
+		case field.Type.Kind() == reflect.Struct:
+			errs = append(errs, negativeDurations(value, key+".")...)
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+			for j := 0; j < value.Len(); j++ {
+				errs = append(errs, negativeDurations(value.Index(j), fmt.Sprintf("%s[%d].", key, j))...)
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,140 @@
+package dev
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// listHasher computes the Merkle Patricia root of the transactions and
+// receipts of a block, as types.DeriveSha expects of a types.TrieHasher.
+// go-ethereum's trie package would pull in its database stack, and the
+// lists of a block are small enough to build the trie in memory.
+type listHasher struct {
+	keys   [][]byte
+	values map[string][]byte
+}
+
+var _ types.TrieHasher = (*listHasher)(nil)
+
+func newListHasher() *listHasher {
+	return &listHasher{values: make(map[string][]byte)}
+}
+
+// Reset implements types.TrieHasher
+func (h *listHasher) Reset() {
+	h.keys = h.keys[:0]
+	h.values = make(map[string][]byte)
+}
+
+// Update implements types.TrieHasher
+func (h *listHasher) Update(key, value []byte) error {
+	if _, ok := h.values[string(key)]; !ok {
+		h.keys = append(h.keys, keyNibbles(key))
+	}
+	h.values[string(key)] = common.CopyBytes(value)
+	return nil
+}
+
+// Hash implements types.TrieHasher
+func (h *listHasher) Hash() common.Hash {
+	if len(h.keys) == 0 {
+		return types.EmptyRootHash
+	}
+	sort.Slice(h.keys, func(i, j int) bool { return bytes.Compare(h.keys[i], h.keys[j]) < 0 })
+	return crypto.Keccak256Hash(h.node(h.keys, 0))
+}
+
+// node returns the RLP encoding of the trie node holding keys, which share
+// their first depth nibbles
+func (h *listHasher) node(keys [][]byte, depth int) []byte {
+	if len(keys) == 1 {
+		return mustEncode([]interface{}{compactKey(keys[0][depth:], true), h.value(keys[0])})
+	}
+
+	// Keys are sorted, so the first and last bound the shared prefix
+	first, last := keys[0], keys[len(keys)-1]
+	shared := depth
+	for shared < len(first) && shared < len(last) && first[shared] == last[shared] {
+		shared++
+	}
+	if shared > depth {
+		return mustEncode([]interface{}{compactKey(first[depth:shared], false), h.ref(keys, shared)})
+	}
+
+	var branch [17]interface{}
+	for i := range branch {
+		branch[i] = []byte{}
+	}
+	for len(keys) > 0 {
+		if len(keys[0]) == depth {
+			branch[16] = h.value(keys[0])
+			keys = keys[1:]
+			continue
+		}
+		nibble := keys[0][depth]
+		n := sort.Search(len(keys), func(i int) bool { return keys[i][depth] > nibble })
+		branch[nibble] = h.ref(keys[:n], depth+1)
+		keys = keys[n:]
+	}
+	return mustEncode(branch[:])
+}
+
+// ref references the node of keys from its parent: embedded if its
+// encoding is shorter than a hash, by hash otherwise
+func (h *listHasher) ref(keys [][]byte, depth int) rlp.RawValue {
+	node := h.node(keys, depth)
+	if len(node) < 32 {
+		return node
+	}
+	return mustEncode(crypto.Keccak256(node))
+}
+
+// value returns the value stored under the nibbles of a key
+func (h *listHasher) value(nibbles []byte) []byte {
+	key := make([]byte, len(nibbles)/2)
+	for i := range key {
+		key[i] = nibbles[2*i]<<4 | nibbles[2*i+1]
+	}
+	return h.values[string(key)]
+}
+
+// keyNibbles splits a key into nibbles
+func keyNibbles(key []byte) []byte {
+	nibbles := make([]byte, 2*len(key))
+	for i, b := range key {
+		nibbles[2*i], nibbles[2*i+1] = b>>4, b&0x0f
+	}
+	return nibbles
+}
+
+// compactKey hex-prefix encodes a partial key of a leaf or extension node
+func compactKey(nibbles []byte, leaf bool) []byte {
+	var flag byte
+	if leaf {
+		flag = 2
+	}
+	compact := make([]byte, len(nibbles)/2+1)
+	if len(nibbles)%2 == 1 {
+		compact[0] = (flag+1)<<4 | nibbles[0]
+		nibbles = nibbles[1:]
+	} else {
+		compact[0] = flag << 4
+	}
+	for i := 0; i < len(nibbles); i += 2 {
+		compact[i/2+1] = nibbles[i]<<4 | nibbles[i+1]
+	}
+	return compact
+}
+
+func mustEncode(v interface{}) []byte {
+	enc, err := rlp.EncodeToBytes(v)
+	if err != nil {
+		panic(err)
+	}
+	return enc
+}
@@ -0,0 +1,187 @@
+package dev
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestListHasherKnownRoots(t *testing.T) {
+	tests := []struct {
+		pairs [][2]string
+		want  string
+	}{
+		{nil, types.EmptyRootHash.Hex()},
+		// go-ethereum's trie tests: a value in a branch, extensions and
+		// embedded nodes
+		{[][2]string{{"doe", "reindeer"}, {"dog", "puppy"}, {"dogglesworth", "cat"}}, "0x8aad789dff2f538bca5d8ea56e8abe10f4c7ba3a5dea95fea4cd6e7c3a1168d3"},
+		{[][2]string{{"A", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}}, "0xd23786fb4a010da3ce639d66d5e904a11dbc02746d1ce25029e53290cabf28ab"},
+	}
+	for _, tt := range tests {
+		// The reference trie is checked too, as the other tests rely on it
+		for _, h := range []types.TrieHasher{newListHasher(), &refTrie{}} {
+			for _, pair := range tt.pairs {
+				h.Update([]byte(pair[0]), []byte(pair[1]))
+			}
+			if got := h.Hash().Hex(); got != tt.want {
+				t.Errorf("%T root of %q = %s, want %s", h, tt.pairs, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestListHasherBlockTxRoot(t *testing.T) {
+	// Block of go-ethereum's TestBlockEncoding
+	enc := common.FromHex("f90260f901f9a083cafc574e1f51ba9dc0568fc617a08ea2429fb384059c972f13b19fa1c8dd55a01dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347948888f1f195afa192cfee860698584c030f4c9db1a0ef1552a40b7165c3cd773806b9e0c165b75356e0314bf0706f279c729f51e017a05fe50b260da6308036625b850b5d6ced6d0a9f814c0688bc91ffb7b7a3a54b67a0bc37d79753ad738a6dac4921e57392f145d8887476de3f783dfa7edae9283e52b90100000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000008302000001832fefd8825208845506eb0780a0bd4472abb6659ebe3ee06ee4d7b72a00a9f4d001caca51342001075469aff49888a13a5a8c8f2bb1c4f861f85f800a82c35094095e7baea6a6c7c4c2dfeb977efac326af552d870a801ba09bea4c4daac7c7c52e093e6a4c35dbbcf8856f1af7b059ba20253e70848d094fa08a8fae537ce25ed8cb5af9adac3f141af69bd515bd2ba031522df09b97dd72b1c0")
+	var block types.Block
+	if err := rlp.DecodeBytes(enc, &block); err != nil {
+		t.Fatal(err)
+	}
+	if got := types.DeriveSha(block.Transactions(), newListHasher()); got != block.TxHash() {
+		t.Fatalf("tx root = %s, want %s", got.Hex(), block.TxHash().Hex())
+	}
+}
+
+func TestListHasherMatchesReferenceTrie(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	h := newListHasher()
+	for _, n := range []int{1, 2, 16, 17, 127, 128, 129, 255, 256, 1000} {
+		txs := make(types.Transactions, n)
+		for i := range txs {
+			data := make([]byte, r.Intn(100))
+			r.Read(data)
+			to := common.Address{byte(i)}
+			txs[i] = types.NewTx(&types.LegacyTx{Nonce: uint64(i), GasPrice: big.NewInt(r.Int63n(1e12)), Gas: 21000, To: &to, Data: data})
+		}
+		ref := &refTrie{}
+		want := types.DeriveSha(txs, ref)
+		h.Reset()
+		if got := types.DeriveSha(txs, h); got != want {
+			t.Fatalf("%d txs: root %s, reference %s", n, got.Hex(), want.Hex())
+		}
+	}
+}
+
+// refTrie is a plain Merkle Patricia trie built by insertion, which the
+// list hasher must agree with
+type refTrie struct{ root interface{} }
+
+type (
+	refShort struct {
+		key   []byte // nibbles
+		child interface{}
+	}
+	refFull  [17]interface{}
+	refValue []byte
+)
+
+func (r *refTrie) Reset() { r.root = nil }
+
+func (r *refTrie) Update(key, value []byte) error {
+	r.root = refInsert(r.root, keyNibbles(key), refValue(common.CopyBytes(value)))
+	return nil
+}
+
+func (r *refTrie) Hash() common.Hash {
+	if r.root == nil {
+		return types.EmptyRootHash
+	}
+	return crypto.Keccak256Hash(refEncode(r.root))
+}
+
+func refInsert(n interface{}, key []byte, value refValue) interface{} {
+	switch n := n.(type) {
+	case nil:
+		return &refShort{key: key, child: value}
+	case *refShort:
+		match := 0
+		for match < len(key) && match < len(n.key) && key[match] == n.key[match] {
+			match++
+		}
+		if match == len(n.key) {
+			n.child = refInsert(n.child, key[match:], value)
+			if _, ok := n.child.(refValue); !ok && len(n.key) == 0 {
+				// A leaf that became a branch needs no extension
+				return n.child
+			}
+			return n
+		}
+		branch := &refFull{}
+		branch.set(n.key[match:], n.child)
+		branch.set(key[match:], value)
+		if match == 0 {
+			return branch
+		}
+		return &refShort{key: key[:match], child: branch}
+	case *refFull:
+		if len(key) == 0 {
+			n[16] = value
+			return n
+		}
+		n[key[0]] = refInsert(n[key[0]], key[1:], value)
+		return n
+	case refValue:
+		if len(key) == 0 {
+			return value
+		}
+		branch := &refFull{}
+		branch[16] = n
+		branch.set(key, value)
+		return branch
+	}
+	panic("unknown node")
+}
+
+// set puts child under the remaining key of a branch
+func (f *refFull) set(key []byte, child interface{}) {
+	if len(key) == 0 {
+		f[16] = child
+		return
+	}
+	if len(key) == 1 {
+		f[key[0]] = child
+		if _, ok := child.(refValue); ok {
+			f[key[0]] = &refShort{key: []byte{}, child: child}
+		}
+		return
+	}
+	f[key[0]] = &refShort{key: key[1:], child: child}
+}
+
+func refEncode(n interface{}) []byte {
+	switch n := n.(type) {
+	case *refShort:
+		if v, ok := n.child.(refValue); ok {
+			return mustEncode([]interface{}{compactKey(n.key, true), []byte(v)})
+		}
+		return mustEncode([]interface{}{compactKey(n.key, false), refRef(n.child)})
+	case *refFull:
+		items := make([]interface{}, 17)
+		for i, child := range n[:16] {
+			if child == nil {
+				items[i] = []byte{}
+			} else {
+				items[i] = refRef(child)
+			}
+		}
+		items[16] = []byte{}
+		if v, ok := n[16].(refValue); ok {
+			items[16] = []byte(v)
+		}
+		return mustEncode(items)
+	}
+	panic("unexpected node")
+}
+
+func refRef(n interface{}) rlp.RawValue {
+	enc := refEncode(n)
+	if len(enc) < 32 {
+		return enc
+	}
+	return mustEncode(crypto.Keccak256(enc))
+}
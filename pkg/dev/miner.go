@@ -0,0 +1,332 @@
+// Package dev mines a synthetic chain in process, so that the RPC surface
+// can be tried out and integration tests run without Pika or an external
+// data loader
+package dev
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc/eip4844"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/evm"
+	"github.com/sunvim/evm_rpc/pkg/forks"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// Miner produces a block every block time from the transactions pending in
+// the pool, on top of a genesis block funding the dev accounts. Blocks and
+// state go through the storage writers, as the ingester's do, so readers
+// and subscriptions see them as they would a real chain. Blocks carry no
+// state root, as state is not kept in a trie.
+type Miner struct {
+	cfg         config.DevConfig
+	chainConfig *params.ChainConfig
+	funded      []common.Address
+
+	blockWriter *storage.BlockWriter
+	stateWriter *storage.StateWriter
+	executor    *evm.Executor
+	txPool      *storage.TxPoolStorage
+
+	// head is the last mined header
+	head *types.Header
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewMiner creates a miner of a dev chain whose genesis funds the given
+// accounts with the configured balance
+func NewMiner(cfg config.DevConfig, pikaClient *storage.PikaClient, chainConfig *params.ChainConfig, txPool *storage.TxPoolStorage, funded []common.Address) *Miner {
+	blockReader := storage.NewBlockReader(pikaClient)
+	stateReader := storage.NewStateReader(pikaClient)
+	return &Miner{
+		cfg:         cfg,
+		chainConfig: chainConfig,
+		funded:      funded,
+		blockWriter: storage.NewBlockWriter(pikaClient),
+		stateWriter: storage.NewStateWriter(pikaClient),
+		executor:    evm.NewExecutor(blockReader, stateReader, chainConfig, 0, 0),
+		txPool:      txPool,
+	}
+}
+
+// Start writes the genesis block, so that the chain exists before the
+// servers start, and mines in the background
+func (m *Miner) Start(ctx context.Context) error {
+	if err := m.writeGenesis(ctx); err != nil {
+		return fmt.Errorf("failed to write dev genesis: %w", err)
+	}
+
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.wg.Add(1)
+	go m.run()
+
+	logger.Infof("Mining a dev block every %v", m.cfg.BlockTime)
+	return nil
+}
+
+// Stop stops mining and waits for the block being mined
+func (m *Miner) Stop(ctx context.Context) error {
+	if m.cancel == nil {
+		return nil
+	}
+	m.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Miner) run() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.cfg.BlockTime)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.mine(m.ctx); err != nil && m.ctx.Err() == nil {
+				logger.Errorf("Failed to mine dev block %d: %v", m.head.Number.Uint64()+1, err)
+			}
+		}
+	}
+}
+
+// writeGenesis writes block 0 with the funded accounts
+func (m *Miner) writeGenesis(ctx context.Context) error {
+	header := &types.Header{
+		UncleHash:  types.EmptyUncleHash,
+		Root:       types.EmptyRootHash,
+		Number:     new(big.Int),
+		GasLimit:   m.cfg.GasLimit,
+		Time:       uint64(time.Now().Unix()),
+		Difficulty: new(big.Int),
+	}
+	if m.chainConfig.IsLondon(header.Number) {
+		header.BaseFee = big.NewInt(params.InitialBaseFee)
+	}
+	if m.chainConfig.IsCancun(header.Number, header.Time) {
+		header.BlobGasUsed, header.ExcessBlobGas = new(uint64), new(uint64)
+		header.ParentBeaconRoot = new(common.Hash)
+	}
+
+	balance := new(big.Int).Mul(new(big.Int).SetUint64(m.cfg.Balance), big.NewInt(params.Ether))
+	diff := storage.NewStateDiff()
+	for _, address := range m.funded {
+		diff.Accounts[address] = &storage.AccountState{Balance: new(big.Int).Set(balance)}
+	}
+
+	return m.commit(ctx, m.newBlock(header, nil, nil), nil, diff)
+}
+
+// mine executes the pending transactions that fit into the next block and
+// commits it
+func (m *Miner) mine(ctx context.Context) error {
+	header := m.nextHeader()
+	var (
+		blockCtx = m.executor.BlockContext(ctx, header)
+		state    = m.executor.NewState(ctx, "latest")
+		signer   = types.MakeSigner(m.chainConfig, header.Number, header.Time)
+		gasPool  = header.GasLimit
+		txs      types.Transactions
+		receipts types.Receipts
+	)
+
+	pending, err := m.pending(ctx, header.BaseFee)
+	if err != nil {
+		return err
+	}
+	for _, senderTxs := range pending {
+		for _, tx := range senderTxs {
+			if header.BlobGasUsed != nil && *header.BlobGasUsed+tx.BlobGas() > params.MaxBlobGasPerBlock {
+				break
+			}
+			msg, err := evm.TransactionToMessage(tx, signer, header.BaseFee)
+			if err != nil {
+				m.drop(ctx, tx, err)
+				break
+			}
+			result, err := m.executor.Apply(ctx, blockCtx, state, msg, &gasPool)
+			if errors.Is(err, evm.ErrNonceTooLow) {
+				m.drop(ctx, tx, err)
+				continue
+			}
+			if err != nil {
+				// Later nonces of the sender cannot run either; the
+				// transaction may become valid in a later block
+				logger.Debugf("Dev transaction %s not mined: %v", tx.Hash().Hex(), err)
+				break
+			}
+
+			header.GasUsed += result.UsedGas
+			if header.BlobGasUsed != nil {
+				*header.BlobGasUsed += tx.BlobGas()
+			}
+			receipt := &types.Receipt{
+				Type:              tx.Type(),
+				Status:            types.ReceiptStatusSuccessful,
+				CumulativeGasUsed: header.GasUsed,
+				Logs:              result.Logs,
+			}
+			if result.Failed() {
+				receipt.Status = types.ReceiptStatusFailed
+			}
+			receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+			txs = append(txs, tx)
+			receipts = append(receipts, receipt)
+		}
+	}
+
+	if err := state.Error(); err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+
+	block := m.newBlock(header, txs, receipts)
+	if err := m.commit(ctx, block, receipts, state.Diff()); err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		if err := m.txPool.RemovePendingTx(ctx, tx.Hash()); err != nil && err != storage.ErrNotFound {
+			logger.Warnf("Failed to remove mined transaction %s from the pool: %v", tx.Hash().Hex(), err)
+		}
+	}
+	if len(txs) > 0 {
+		logger.Infof("Mined dev block %d with %d transactions", block.NumberU64(), len(txs))
+	}
+	return nil
+}
+
+// pending returns the pending transactions grouped by sender in nonce
+// order, senders ordered by the tip their next transaction pays at the
+// base fee, highest first
+func (m *Miner) pending(ctx context.Context, baseFee *big.Int) ([]types.Transactions, error) {
+	txs, err := m.txPool.GetPendingTransactions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending transactions: %w", err)
+	}
+
+	bySender := make(map[common.Address]types.Transactions)
+	for _, tx := range txs {
+		from, err := m.txPool.Sender(tx)
+		if err != nil {
+			continue
+		}
+		bySender[from] = append(bySender[from], tx)
+	}
+
+	pending := make([]types.Transactions, 0, len(bySender))
+	tips := make(map[common.Hash]*big.Int, len(bySender))
+	for _, senderTxs := range bySender {
+		sort.Sort(types.TxByNonce(senderTxs))
+		pending = append(pending, senderTxs)
+		tips[senderTxs[0].Hash()] = effectiveTip(senderTxs[0], baseFee)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		ti, tj := tips[pending[i][0].Hash()], tips[pending[j][0].Hash()]
+		if c := ti.Cmp(tj); c != 0 {
+			return c > 0
+		}
+		// Same tip: order by hash, so blocks do not depend on map order
+		return pending[i][0].Hash().Cmp(pending[j][0].Hash()) < 0
+	})
+	return pending, nil
+}
+
+// effectiveTip returns the tip a transaction pays at a base fee, or zero if
+// its fee cap is below the base fee
+func effectiveTip(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	tip, err := tx.EffectiveGasTip(baseFee)
+	if err != nil {
+		return new(big.Int)
+	}
+	return tip
+}
+
+// drop evicts a transaction that can never be mined
+func (m *Miner) drop(ctx context.Context, tx *types.Transaction, reason error) {
+	logger.Infof("Dropping dev transaction %s: %v", tx.Hash().Hex(), reason)
+	if err := m.txPool.DropTx(ctx, tx.Hash(), storage.DropStale); err != nil {
+		logger.Warnf("Failed to drop transaction %s: %v", tx.Hash().Hex(), err)
+	}
+}
+
+// nextHeader returns the header of the block on top of the head, before
+// execution
+func (m *Miner) nextHeader() *types.Header {
+	parent := m.head
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Root:       types.EmptyRootHash,
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		GasLimit:   m.cfg.GasLimit,
+		Time:       max(uint64(time.Now().Unix()), parent.Time+1),
+		Difficulty: new(big.Int),
+	}
+	if m.chainConfig.IsLondon(header.Number) {
+		header.BaseFee = forks.NextBaseFee(m.chainConfig, parent)
+	}
+	if m.chainConfig.IsCancun(header.Number, header.Time) {
+		var parentExcess, parentUsed uint64
+		if parent.ExcessBlobGas != nil {
+			parentExcess, parentUsed = *parent.ExcessBlobGas, *parent.BlobGasUsed
+		}
+		excess := eip4844.CalcExcessBlobGas(parentExcess, parentUsed)
+		header.ExcessBlobGas, header.BlobGasUsed = &excess, new(uint64)
+		header.ParentBeaconRoot = new(common.Hash)
+	}
+	return header
+}
+
+// newBlock assembles a block, deriving the roots of its transactions and
+// receipts
+func (m *Miner) newBlock(header *types.Header, txs types.Transactions, receipts types.Receipts) *types.Block {
+	if m.chainConfig.IsShanghai(header.Number, header.Time) {
+		return types.NewBlockWithWithdrawals(header, txs, nil, receipts, []*types.Withdrawal{}, newListHasher())
+	}
+	return types.NewBlock(header, txs, nil, receipts, newListHasher())
+}
+
+// commit writes a block and the state it changed, then makes it the head.
+// Historical state is recorded per block as the ingester records it.
+func (m *Miner) commit(ctx context.Context, block *types.Block, receipts types.Receipts, diff *storage.StateDiff) error {
+	number := block.NumberU64()
+	if err := m.blockWriter.WriteBlock(ctx, block, receipts, new(big.Int)); err != nil {
+		return err
+	}
+
+	if err := m.stateWriter.WriteLatestState(ctx, diff); err != nil {
+		return err
+	}
+	if err := m.stateWriter.WriteHistoricalState(ctx, number, diff); err != nil {
+		return err
+	}
+
+	if err := m.blockWriter.SetHead(ctx, number, block.Hash()); err != nil {
+		return err
+	}
+	m.head = block.Header()
+	return nil
+}
@@ -0,0 +1,137 @@
+package dev
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/sunvim/evm_rpc/pkg/accounts"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/forks"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+const testChainID = 1337
+
+func TestMinerMinesPendingTransaction(t *testing.T) {
+	ctx := context.Background()
+
+	client, err := storage.NewPikaClient(config.PikaConfig{Mode: config.PikaModeMemory})
+	if err != nil {
+		t.Fatalf("NewPikaClient: %v", err)
+	}
+	defer client.Close()
+
+	chainConfig, err := forks.ChainConfig(testChainID, config.ForksConfig{})
+	if err != nil {
+		t.Fatalf("ChainConfig: %v", err)
+	}
+	keys, err := accounts.DeriveKeys("test seed", 2)
+	if err != nil {
+		t.Fatalf("DeriveKeys: %v", err)
+	}
+	from := crypto.PubkeyToAddress(keys[0].PublicKey)
+	to := crypto.PubkeyToAddress(keys[1].PublicKey)
+
+	pool := storage.NewTxPoolStorage(client, config.TxPoolConfig{}, testChainID)
+	cfg := config.DevConfig{BlockTime: time.Hour, GasLimit: 30_000_000, Balance: 100}
+	miner := NewMiner(cfg, client, chainConfig, pool, []common.Address{from, to})
+	if err := miner.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer miner.Stop(ctx)
+
+	blocks := storage.NewBlockReader(client)
+	state := storage.NewStateReader(client)
+	genesis, err := blocks.GetBlock(ctx, 0)
+	if err != nil {
+		t.Fatalf("GetBlock(0): %v", err)
+	}
+
+	value := big.NewInt(params.Ether)
+	tx, err := types.SignNewTx(keys[0], types.LatestSignerForChainID(big.NewInt(testChainID)), &types.DynamicFeeTx{
+		ChainID:   big.NewInt(testChainID),
+		Nonce:     0,
+		GasTipCap: big.NewInt(params.GWei),
+		GasFeeCap: new(big.Int).Add(genesis.BaseFee(), big.NewInt(10*params.GWei)),
+		Gas:       params.TxGas,
+		To:        &to,
+		Value:     value,
+	})
+	if err != nil {
+		t.Fatalf("SignNewTx: %v", err)
+	}
+	if err := pool.AddPendingTx(ctx, tx, "test"); err != nil {
+		t.Fatalf("AddPendingTx: %v", err)
+	}
+
+	if err := miner.mine(ctx); err != nil {
+		t.Fatalf("mine: %v", err)
+	}
+
+	head, err := blocks.GetHeadNumber(ctx)
+	if err != nil || head != 1 {
+		t.Fatalf("head = %d, %v; want 1", head, err)
+	}
+	block, err := blocks.GetBlock(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetBlock(1): %v", err)
+	}
+	if block.ParentHash() != genesis.Hash() {
+		t.Fatalf("parent hash = %s, want %s", block.ParentHash(), genesis.Hash())
+	}
+	if len(block.Transactions()) != 1 || block.Transactions()[0].Hash() != tx.Hash() {
+		t.Fatalf("block transactions = %v, want [%s]", block.Transactions(), tx.Hash())
+	}
+	if want := types.DeriveSha(types.Transactions{tx}, newListHasher()); block.TxHash() != want {
+		t.Fatalf("tx root = %s, want %s", block.TxHash(), want)
+	}
+
+	receipts, err := blocks.GetReceipts(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetReceipts(1): %v", err)
+	}
+	if len(receipts) != 1 {
+		t.Fatalf("got %d receipts, want 1", len(receipts))
+	}
+	receipt := receipts[0]
+	if receipt.Status != types.ReceiptStatusSuccessful || receipt.TxHash != tx.Hash() || receipt.GasUsed != params.TxGas {
+		t.Fatalf("receipt = status %d, tx %s, gas %d", receipt.Status, receipt.TxHash, receipt.GasUsed)
+	}
+
+	if _, err := pool.GetPendingTx(ctx, tx.Hash()); err != storage.ErrNotFound {
+		t.Fatalf("mined transaction still pending: err = %v", err)
+	}
+
+	funded := new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))
+	balance := func(address common.Address, block string) *big.Int {
+		t.Helper()
+		b, err := state.GetBalance(ctx, address, block)
+		if err != nil {
+			t.Fatalf("GetBalance(%s, %s): %v", address, block, err)
+		}
+		return b
+	}
+	if got, want := balance(to, "latest"), new(big.Int).Add(funded, value); got.Cmp(want) != 0 {
+		t.Fatalf("recipient balance = %s, want %s", got, want)
+	}
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), storage.EffectiveGasPrice(tx, block.BaseFee()))
+	if got, want := balance(from, "latest"), new(big.Int).Sub(new(big.Int).Sub(funded, value), fee); got.Cmp(want) != 0 {
+		t.Fatalf("sender balance = %s, want %s", got, want)
+	}
+	if got := balance(to, "1"); got.Cmp(new(big.Int).Add(funded, value)) != 0 {
+		t.Fatalf("recipient balance at block 1 = %s", got)
+	}
+	if got := balance(to, "0"); got.Cmp(funded) != 0 {
+		t.Fatalf("recipient balance at genesis = %s, want %s", got, funded)
+	}
+	nonce, err := state.GetNonce(ctx, from, "latest")
+	if err != nil || nonce != 1 {
+		t.Fatalf("sender nonce = %d, %v; want 1", nonce, err)
+	}
+}
@@ -0,0 +1,163 @@
+package evm
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc/eip4844"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// Executor executes messages on stored state without persisting their
+// effects, for eth_call style methods
+type Executor struct {
+	blockReader *storage.BlockReader
+	stateReader *storage.StateReader
+	chainConfig *params.ChainConfig
+	gasCap      uint64
+	timeout     time.Duration
+}
+
+// NewExecutor creates an executor. gasCap caps the gas of calls, 0 is
+// unlimited; timeout bounds an execution, 0 is unlimited.
+func NewExecutor(blockReader *storage.BlockReader, stateReader *storage.StateReader, chainConfig *params.ChainConfig, gasCap uint64, timeout time.Duration) *Executor {
+	return &Executor{
+		blockReader: blockReader,
+		stateReader: stateReader,
+		chainConfig: chainConfig,
+		gasCap:      gasCap,
+		timeout:     timeout,
+	}
+}
+
+// ChainConfig returns the chain config of executions
+func (e *Executor) ChainConfig() *params.ChainConfig {
+	return e.chainConfig
+}
+
+// GasCap returns the gas cap of calls, 0 if unlimited
+func (e *Executor) GasCap() uint64 {
+	return e.gasCap
+}
+
+// WithTimeout bounds an execution by the configured timeout
+func (e *Executor) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if e.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, e.timeout)
+}
+
+// NewState returns the state at a block, given as a block number string as
+// StateReader takes it
+func (e *Executor) NewState(ctx context.Context, block string) *StateDB {
+	return NewStateDB(ctx, e.stateReader, block)
+}
+
+// BlockContext returns the EVM block context of a header. BLOCKHASH is
+// served from the canonical index.
+func (e *Executor) BlockContext(ctx context.Context, header *types.Header) vm.BlockContext {
+	blockCtx := vm.BlockContext{
+		CanTransfer: canTransfer,
+		Transfer:    transfer,
+		GetHash: func(n uint64) common.Hash {
+			hash, err := e.blockReader.GetCanonicalHash(ctx, n)
+			if err != nil {
+				return common.Hash{}
+			}
+			return hash
+		},
+		Coinbase:    header.Coinbase,
+		GasLimit:    header.GasLimit,
+		BlockNumber: new(big.Int).Set(header.Number),
+		Time:        header.Time,
+		Difficulty:  new(big.Int),
+	}
+	if header.Difficulty != nil {
+		blockCtx.Difficulty.Set(header.Difficulty)
+	}
+	if header.BaseFee != nil {
+		blockCtx.BaseFee = new(big.Int).Set(header.BaseFee)
+	}
+	if blockCtx.Difficulty.Sign() == 0 {
+		random := header.MixDigest
+		blockCtx.Random = &random
+	}
+	if header.ExcessBlobGas != nil {
+		blockCtx.BlobBaseFee = eip4844.CalcBlobFee(*header.ExcessBlobGas)
+	}
+	return blockCtx
+}
+
+// Apply executes a message on a state in a block context, stopping when ctx
+// is done. Calls without fees run with a zero base fee, as in eth_call.
+// gasPool is the gas left in the block.
+func (e *Executor) Apply(ctx context.Context, blockCtx vm.BlockContext, state *StateDB, msg *Message, gasPool *uint64) (*ExecutionResult, error) {
+	txCtx := vm.TxContext{
+		Origin:     msg.From,
+		GasPrice:   new(big.Int).Set(msg.GasPrice),
+		BlobHashes: msg.BlobHashes,
+		BlobFeeCap: msg.BlobGasFeeCap,
+	}
+	evm := vm.NewEVM(blockCtx, txCtx, state, e.chainConfig, vm.Config{NoBaseFee: true})
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			evm.Cancel()
+		case <-done:
+		}
+	}()
+
+	result, err := ApplyMessage(evm, state, msg, gasPool)
+	if evm.Cancelled() {
+		if e.timeout > 0 && ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("execution aborted (timeout = %v)", e.timeout)
+		}
+		return nil, fmt.Errorf("execution aborted: %w", ctx.Err())
+	}
+	if stateErr := state.Error(); stateErr != nil {
+		return nil, fmt.Errorf("failed to read state: %w", stateErr)
+	}
+	return result, err
+}
+
+// ReplayBlock executes the first n transactions of a block on the state
+// before it, bringing the state to the point where transaction n runs
+func (e *Executor) ReplayBlock(ctx context.Context, block *types.Block, state *StateDB, n int) error {
+	var (
+		header   = block.Header()
+		blockCtx = e.BlockContext(ctx, header)
+		signer   = types.MakeSigner(e.chainConfig, header.Number, header.Time)
+		gasPool  = header.GasLimit
+	)
+	for i, tx := range block.Transactions()[:n] {
+		msg, err := TransactionToMessage(tx, signer, header.BaseFee)
+		if err != nil {
+			return fmt.Errorf("transaction %d: %w", i, err)
+		}
+		if _, err := e.Apply(ctx, blockCtx, state, msg, &gasPool); err != nil {
+			return fmt.Errorf("transaction %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// canTransfer reports whether an account can pay amount
+func canTransfer(db vm.StateDB, addr common.Address, amount *big.Int) bool {
+	return db.GetBalance(addr).Cmp(amount) >= 0
+}
+
+// transfer moves amount between accounts
+func transfer(db vm.StateDB, sender, recipient common.Address, amount *big.Int) {
+	db.SubBalance(sender, amount)
+	db.AddBalance(recipient, amount)
+}
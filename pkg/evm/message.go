@@ -0,0 +1,120 @@
+package evm
+
+import (
+	"errors"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/api"
+)
+
+// Message is a call or transaction to execute
+type Message struct {
+	From          common.Address
+	To            *common.Address // nil creates a contract
+	Nonce         uint64
+	Value         *big.Int
+	GasLimit      uint64
+	GasPrice      *big.Int
+	GasFeeCap     *big.Int
+	GasTipCap     *big.Int
+	Data          []byte
+	AccessList    types.AccessList
+	BlobHashes    []common.Hash
+	BlobGasFeeCap *big.Int
+
+	// SkipAccountChecks skips the nonce and EOA checks of the sender, as
+	// for calls
+	SkipAccountChecks bool
+}
+
+// CallMessage converts call arguments to a message as geth does for
+// eth_call. Gas defaults to and is capped at gasCap, or is unlimited if
+// gasCap is 0; fees default to zero so that calls need no funds.
+func CallMessage(args api.CallArgs, baseFee *big.Int, gasCap uint64) (*Message, error) {
+	if args.GasPrice != nil && (args.MaxFeePerGas != nil || args.MaxPriorityFeePerGas != nil) {
+		return nil, errors.New("both gasPrice and (maxFeePerGas or maxPriorityFeePerGas) specified")
+	}
+
+	msg := &Message{
+		To:                args.To,
+		Value:             new(big.Int),
+		SkipAccountChecks: true,
+	}
+	if args.From != nil {
+		msg.From = *args.From
+	}
+	if args.Value != nil {
+		msg.Value = args.Value.ToInt()
+	}
+	if args.Data != nil {
+		msg.Data = *args.Data
+	}
+
+	msg.GasLimit = gasCap
+	if gasCap == 0 {
+		msg.GasLimit = math.MaxUint64 / 2
+	}
+	if args.Gas != nil && (gasCap == 0 || uint64(*args.Gas) < gasCap) {
+		msg.GasLimit = uint64(*args.Gas)
+	}
+
+	switch {
+	case baseFee == nil || args.GasPrice != nil:
+		// Before London, or a legacy price: all fees are the price
+		msg.GasPrice = new(big.Int)
+		if args.GasPrice != nil {
+			msg.GasPrice = args.GasPrice.ToInt()
+		}
+		msg.GasFeeCap, msg.GasTipCap = msg.GasPrice, msg.GasPrice
+	default:
+		msg.GasFeeCap, msg.GasTipCap = new(big.Int), new(big.Int)
+		if args.MaxFeePerGas != nil {
+			msg.GasFeeCap = args.MaxFeePerGas.ToInt()
+		}
+		if args.MaxPriorityFeePerGas != nil {
+			msg.GasTipCap = args.MaxPriorityFeePerGas.ToInt()
+		}
+		// The effective price is only paid if fees were given
+		msg.GasPrice = new(big.Int)
+		if msg.GasFeeCap.Sign() != 0 || msg.GasTipCap.Sign() != 0 {
+			msg.GasPrice = new(big.Int).Add(msg.GasTipCap, baseFee)
+			if msg.GasPrice.Cmp(msg.GasFeeCap) > 0 {
+				msg.GasPrice = new(big.Int).Set(msg.GasFeeCap)
+			}
+		}
+	}
+	return msg, nil
+}
+
+// TransactionToMessage converts a transaction included in a block with the
+// given base fee to a message
+func TransactionToMessage(tx *types.Transaction, signer types.Signer, baseFee *big.Int) (*Message, error) {
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{
+		From:          from,
+		To:            tx.To(),
+		Nonce:         tx.Nonce(),
+		Value:         tx.Value(),
+		GasLimit:      tx.Gas(),
+		GasPrice:      new(big.Int).Set(tx.GasPrice()),
+		GasFeeCap:     new(big.Int).Set(tx.GasFeeCap()),
+		GasTipCap:     new(big.Int).Set(tx.GasTipCap()),
+		Data:          tx.Data(),
+		AccessList:    tx.AccessList(),
+		BlobHashes:    tx.BlobHashes(),
+		BlobGasFeeCap: tx.BlobGasFeeCap(),
+	}
+	if baseFee != nil {
+		msg.GasPrice.Add(msg.GasTipCap, baseFee)
+		if msg.GasPrice.Cmp(msg.GasFeeCap) > 0 {
+			msg.GasPrice.Set(msg.GasFeeCap)
+		}
+	}
+	return msg, nil
+}
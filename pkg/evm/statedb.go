@@ -0,0 +1,521 @@
+package evm
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// StateDB is the state of an execution: the stored state at a block with
+// the changes of the messages applied so far kept in memory. Nothing is
+// written back to storage. Reads of stored state cannot fail through the
+// vm.StateDB interface, so the first read error is kept and returned by
+// Error; results of an execution that saw one must be discarded.
+type StateDB struct {
+	ctx    context.Context
+	reader *storage.StateReader
+	block  string
+
+	accounts  map[common.Address]*account
+	transient map[common.Address]map[common.Hash]common.Hash
+	access    map[common.Address]map[common.Hash]struct{}
+	refund    uint64
+	logs      []*types.Log
+	journal   []func()
+	err       error
+}
+
+// account is an account as seen by an execution
+type account struct {
+	nonce    uint64
+	balance  *big.Int
+	codeHash common.Hash // types.EmptyCodeHash without code
+	code     []byte      // nil until loaded
+
+	// committed holds the storage at the start of the current message,
+	// dirty its changes by the message
+	committed map[common.Hash]common.Hash
+	dirty     map[common.Hash]common.Hash
+
+	stored         bool // exists in stored state
+	created        bool // created by the current message
+	fresh          bool // created during the execution; has no stored storage
+	selfDestructed bool
+}
+
+// NewStateDB creates the state of an execution on top of the stored state
+// at a block, given as a block number string as StateReader takes it
+func NewStateDB(ctx context.Context, reader *storage.StateReader, block string) *StateDB {
+	return &StateDB{
+		ctx:       ctx,
+		reader:    reader,
+		block:     block,
+		accounts:  make(map[common.Address]*account),
+		transient: make(map[common.Address]map[common.Hash]common.Hash),
+		access:    make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+// Error returns the first error reading stored state
+func (s *StateDB) Error() error {
+	return s.err
+}
+
+// setError keeps the first read error
+func (s *StateDB) setError(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// getAccount returns an account, loading it from stored state on first
+// access. Deleted and never existing accounts are nil.
+func (s *StateDB) getAccount(addr common.Address) *account {
+	if acc, ok := s.accounts[addr]; ok {
+		return acc
+	}
+
+	state, err := s.reader.GetAccountState(s.ctx, addr, s.block)
+	if err != nil {
+		s.setError(err)
+		s.accounts[addr] = nil
+		return nil
+	}
+	acc := &account{
+		nonce:     state.Nonce,
+		balance:   new(big.Int),
+		codeHash:  types.EmptyCodeHash,
+		committed: make(map[common.Hash]common.Hash),
+		dirty:     make(map[common.Hash]common.Hash),
+	}
+	if state.Balance != nil {
+		acc.balance.Set(state.Balance)
+	}
+	if hash := common.HexToHash(state.CodeHash); state.CodeHash != "" && hash != (common.Hash{}) {
+		acc.codeHash = hash
+	}
+	// Stored state does not tell empty accounts from missing ones
+	acc.stored = acc.nonce != 0 || acc.balance.Sign() != 0 || acc.codeHash != types.EmptyCodeHash
+	if !acc.stored {
+		acc = nil
+	}
+	s.accounts[addr] = acc
+	return acc
+}
+
+// getOrNewAccount returns an account, creating it if it does not exist
+func (s *StateDB) getOrNewAccount(addr common.Address) *account {
+	if acc := s.getAccount(addr); acc != nil {
+		return acc
+	}
+	return s.newAccount(addr)
+}
+
+// newAccount replaces an account with a new empty one
+func (s *StateDB) newAccount(addr common.Address) *account {
+	prev := s.accounts[addr]
+	acc := &account{
+		balance:   new(big.Int),
+		codeHash:  types.EmptyCodeHash,
+		committed: make(map[common.Hash]common.Hash),
+		dirty:     make(map[common.Hash]common.Hash),
+		fresh:     true,
+	}
+	s.accounts[addr] = acc
+	s.journal = append(s.journal, func() { s.accounts[addr] = prev })
+	return acc
+}
+
+// CreateAccount creates a new account, keeping the balance of an account
+// it replaces
+func (s *StateDB) CreateAccount(addr common.Address) {
+	prev := s.getAccount(addr)
+	acc := s.newAccount(addr)
+	acc.created = true
+	if prev != nil {
+		acc.balance.Set(prev.balance)
+	}
+}
+
+// SubBalance subtracts amount from an account's balance
+func (s *StateDB) SubBalance(addr common.Address, amount *big.Int) {
+	if amount.Sign() == 0 {
+		return
+	}
+	s.setBalance(s.getOrNewAccount(addr), new(big.Int).Sub(s.GetBalance(addr), amount))
+}
+
+// AddBalance adds amount to an account's balance
+func (s *StateDB) AddBalance(addr common.Address, amount *big.Int) {
+	acc := s.getOrNewAccount(addr)
+	s.setBalance(acc, new(big.Int).Add(acc.balance, amount))
+}
+
+func (s *StateDB) setBalance(acc *account, balance *big.Int) {
+	prev := acc.balance
+	acc.balance = balance
+	s.journal = append(s.journal, func() { acc.balance = prev })
+}
+
+// GetBalance returns an account's balance
+func (s *StateDB) GetBalance(addr common.Address) *big.Int {
+	if acc := s.getAccount(addr); acc != nil {
+		return new(big.Int).Set(acc.balance)
+	}
+	return new(big.Int)
+}
+
+// GetNonce returns an account's nonce
+func (s *StateDB) GetNonce(addr common.Address) uint64 {
+	if acc := s.getAccount(addr); acc != nil {
+		return acc.nonce
+	}
+	return 0
+}
+
+// SetNonce sets an account's nonce
+func (s *StateDB) SetNonce(addr common.Address, nonce uint64) {
+	acc := s.getOrNewAccount(addr)
+	prev := acc.nonce
+	acc.nonce = nonce
+	s.journal = append(s.journal, func() { acc.nonce = prev })
+}
+
+// GetCodeHash returns an account's code hash, zero if it does not exist
+func (s *StateDB) GetCodeHash(addr common.Address) common.Hash {
+	if acc := s.getAccount(addr); acc != nil {
+		return acc.codeHash
+	}
+	return common.Hash{}
+}
+
+// GetCode returns an account's code
+func (s *StateDB) GetCode(addr common.Address) []byte {
+	acc := s.getAccount(addr)
+	if acc == nil || acc.codeHash == types.EmptyCodeHash {
+		return nil
+	}
+	if acc.code == nil {
+		code, err := s.reader.GetCode(s.ctx, addr, s.block)
+		if err != nil {
+			s.setError(err)
+			return nil
+		}
+		acc.code = code
+	}
+	return acc.code
+}
+
+// SetCode sets an account's code
+func (s *StateDB) SetCode(addr common.Address, code []byte) {
+	acc := s.getOrNewAccount(addr)
+	prevCode, prevHash := acc.code, acc.codeHash
+	acc.code = code
+	acc.codeHash = crypto.Keccak256Hash(code)
+	if len(code) == 0 {
+		acc.codeHash = types.EmptyCodeHash
+	}
+	s.journal = append(s.journal, func() { acc.code, acc.codeHash = prevCode, prevHash })
+}
+
+// GetCodeSize returns the size of an account's code
+func (s *StateDB) GetCodeSize(addr common.Address) int {
+	return len(s.GetCode(addr))
+}
+
+// AddRefund adds gas to the refund counter
+func (s *StateDB) AddRefund(gas uint64) {
+	prev := s.refund
+	s.refund += gas
+	s.journal = append(s.journal, func() { s.refund = prev })
+}
+
+// SubRefund removes gas from the refund counter
+func (s *StateDB) SubRefund(gas uint64) {
+	prev := s.refund
+	if gas > s.refund {
+		gas = s.refund
+	}
+	s.refund -= gas
+	s.journal = append(s.journal, func() { s.refund = prev })
+}
+
+// GetRefund returns the refund counter
+func (s *StateDB) GetRefund() uint64 {
+	return s.refund
+}
+
+// GetCommittedState returns a storage slot as of the start of the current
+// message
+func (s *StateDB) GetCommittedState(addr common.Address, key common.Hash) common.Hash {
+	acc := s.getAccount(addr)
+	if acc == nil {
+		return common.Hash{}
+	}
+	if value, ok := acc.committed[key]; ok {
+		return value
+	}
+	if acc.fresh {
+		return common.Hash{}
+	}
+	data, err := s.reader.GetStorageAt(s.ctx, addr, key, s.block)
+	if err != nil {
+		s.setError(err)
+		return common.Hash{}
+	}
+	value := common.BytesToHash(data)
+	acc.committed[key] = value
+	return value
+}
+
+// GetState returns a storage slot
+func (s *StateDB) GetState(addr common.Address, key common.Hash) common.Hash {
+	if acc := s.getAccount(addr); acc != nil {
+		if value, ok := acc.dirty[key]; ok {
+			return value
+		}
+	}
+	return s.GetCommittedState(addr, key)
+}
+
+// SetState sets a storage slot
+func (s *StateDB) SetState(addr common.Address, key, value common.Hash) {
+	acc := s.getOrNewAccount(addr)
+	prev, dirty := acc.dirty[key]
+	acc.dirty[key] = value
+	s.journal = append(s.journal, func() {
+		if dirty {
+			acc.dirty[key] = prev
+		} else {
+			delete(acc.dirty, key)
+		}
+	})
+}
+
+// GetTransientState returns an EIP-1153 transient storage slot
+func (s *StateDB) GetTransientState(addr common.Address, key common.Hash) common.Hash {
+	return s.transient[addr][key]
+}
+
+// SetTransientState sets an EIP-1153 transient storage slot
+func (s *StateDB) SetTransientState(addr common.Address, key, value common.Hash) {
+	slots, ok := s.transient[addr]
+	if !ok {
+		slots = make(map[common.Hash]common.Hash)
+		s.transient[addr] = slots
+	}
+	prev := slots[key]
+	slots[key] = value
+	s.journal = append(s.journal, func() { slots[key] = prev })
+}
+
+// SelfDestruct marks an account as destructed and clears its balance. It
+// is deleted when the message ends.
+func (s *StateDB) SelfDestruct(addr common.Address) {
+	acc := s.getAccount(addr)
+	if acc == nil {
+		return
+	}
+	prevBalance, prevDestructed := acc.balance, acc.selfDestructed
+	acc.balance = new(big.Int)
+	acc.selfDestructed = true
+	s.journal = append(s.journal, func() { acc.balance, acc.selfDestructed = prevBalance, prevDestructed })
+}
+
+// HasSelfDestructed reports whether an account was destructed
+func (s *StateDB) HasSelfDestructed(addr common.Address) bool {
+	acc := s.getAccount(addr)
+	return acc != nil && acc.selfDestructed
+}
+
+// Selfdestruct6780 destructs an account only if it was created by the
+// current message, as of EIP-6780
+func (s *StateDB) Selfdestruct6780(addr common.Address) {
+	if acc := s.getAccount(addr); acc != nil && acc.created {
+		s.SelfDestruct(addr)
+	}
+}
+
+// Exist reports whether an account exists
+func (s *StateDB) Exist(addr common.Address) bool {
+	return s.getAccount(addr) != nil
+}
+
+// Empty reports whether an account is empty as of EIP-161
+func (s *StateDB) Empty(addr common.Address) bool {
+	acc := s.getAccount(addr)
+	return acc == nil || (acc.nonce == 0 && acc.balance.Sign() == 0 && acc.codeHash == types.EmptyCodeHash)
+}
+
+// AddressInAccessList reports whether an address is in the access list
+func (s *StateDB) AddressInAccessList(addr common.Address) bool {
+	_, ok := s.access[addr]
+	return ok
+}
+
+// SlotInAccessList reports whether an address and a slot of it are in the
+// access list
+func (s *StateDB) SlotInAccessList(addr common.Address, slot common.Hash) (addressOk bool, slotOk bool) {
+	slots, addressOk := s.access[addr]
+	if !addressOk {
+		return false, false
+	}
+	_, slotOk = slots[slot]
+	return true, slotOk
+}
+
+// AddAddressToAccessList adds an address to the access list
+func (s *StateDB) AddAddressToAccessList(addr common.Address) {
+	if _, ok := s.access[addr]; ok {
+		return
+	}
+	s.access[addr] = make(map[common.Hash]struct{})
+	s.journal = append(s.journal, func() { delete(s.access, addr) })
+}
+
+// AddSlotToAccessList adds an address and a slot of it to the access list
+func (s *StateDB) AddSlotToAccessList(addr common.Address, slot common.Hash) {
+	s.AddAddressToAccessList(addr)
+	slots := s.access[addr]
+	if _, ok := slots[slot]; ok {
+		return
+	}
+	slots[slot] = struct{}{}
+	s.journal = append(s.journal, func() { delete(slots, slot) })
+}
+
+// Prepare resets the access list and transient storage for a message and
+// warms the addresses of EIP-2929, EIP-2930 and EIP-3651
+func (s *StateDB) Prepare(rules params.Rules, sender, coinbase common.Address, dest *common.Address, precompiles []common.Address, txAccesses types.AccessList) {
+	s.access = make(map[common.Address]map[common.Hash]struct{})
+	s.transient = make(map[common.Address]map[common.Hash]common.Hash)
+	if !rules.IsBerlin {
+		return
+	}
+	s.AddAddressToAccessList(sender)
+	if dest != nil {
+		s.AddAddressToAccessList(*dest)
+	}
+	for _, addr := range precompiles {
+		s.AddAddressToAccessList(addr)
+	}
+	for _, tuple := range txAccesses {
+		s.AddAddressToAccessList(tuple.Address)
+		for _, key := range tuple.StorageKeys {
+			s.AddSlotToAccessList(tuple.Address, key)
+		}
+	}
+	if rules.IsShanghai {
+		s.AddAddressToAccessList(coinbase)
+	}
+}
+
+// Snapshot returns an identifier of the current state to revert to
+func (s *StateDB) Snapshot() int {
+	return len(s.journal)
+}
+
+// RevertToSnapshot undoes the changes made since a snapshot
+func (s *StateDB) RevertToSnapshot(id int) {
+	for i := len(s.journal) - 1; i >= id; i-- {
+		s.journal[i]()
+	}
+	s.journal = s.journal[:id]
+}
+
+// AddLog records a log emitted by the current message
+func (s *StateDB) AddLog(log *types.Log) {
+	s.logs = append(s.logs, log)
+	n := len(s.logs) - 1
+	s.journal = append(s.journal, func() { s.logs = s.logs[:n] })
+}
+
+// AddPreimage is a no-op; preimages are not recorded
+func (s *StateDB) AddPreimage(common.Hash, []byte) {}
+
+// Finalise ends a message: destructed accounts are deleted, its storage
+// changes become committed and its logs are returned. The changes can no
+// longer be reverted.
+func (s *StateDB) Finalise() []*types.Log {
+	for addr, acc := range s.accounts {
+		if acc == nil {
+			continue
+		}
+		if acc.selfDestructed {
+			s.accounts[addr] = nil
+			continue
+		}
+		for key, value := range acc.dirty {
+			acc.committed[key] = value
+		}
+		acc.dirty = make(map[common.Hash]common.Hash)
+		acc.created = false
+	}
+	logs := s.logs
+	s.logs = nil
+	s.refund = 0
+	s.journal = nil
+	return logs
+}
+
+// Copy returns an independent copy of a finalised state, keeping the
+// accounts and storage loaded so far, so that a message can be executed
+// several times on the same state
+func (s *StateDB) Copy() *StateDB {
+	cp := NewStateDB(s.ctx, s.reader, s.block)
+	cp.err = s.err
+	for addr, acc := range s.accounts {
+		if acc == nil {
+			cp.accounts[addr] = nil
+			continue
+		}
+		c := *acc
+		c.balance = new(big.Int).Set(acc.balance)
+		c.committed = make(map[common.Hash]common.Hash, len(acc.committed))
+		for key, value := range acc.committed {
+			c.committed[key] = value
+		}
+		c.dirty = make(map[common.Hash]common.Hash)
+		cp.accounts[addr] = &c
+	}
+	return cp
+}
+
+// Diff returns the accounts, storage and code of a finalised state as a
+// state diff, for persisting the state after a block. Accounts and slots
+// that were only read are included with their unchanged values; deleted
+// accounts are nil.
+func (s *StateDB) Diff() *storage.StateDiff {
+	diff := storage.NewStateDiff()
+	for addr, acc := range s.accounts {
+		if acc == nil {
+			diff.Accounts[addr] = nil
+			continue
+		}
+		state := &storage.AccountState{
+			Nonce:   acc.nonce,
+			Balance: new(big.Int).Set(acc.balance),
+		}
+		if acc.codeHash != types.EmptyCodeHash {
+			state.CodeHash = acc.codeHash.Hex()
+			if acc.code != nil {
+				diff.Code[acc.codeHash] = acc.code
+			}
+		}
+		diff.Accounts[addr] = state
+
+		if len(acc.committed) > 0 {
+			slots := make(map[common.Hash]common.Hash, len(acc.committed))
+			for key, value := range acc.committed {
+				slots[key] = value
+			}
+			diff.Storage[addr] = slots
+		}
+	}
+	return diff
+}
@@ -0,0 +1,217 @@
+package evm
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Errors rejecting a message before execution, with geth's messages
+var (
+	ErrNonceTooLow                  = errors.New("nonce too low")
+	ErrNonceTooHigh                 = errors.New("nonce too high")
+	ErrSenderNoEOA                  = errors.New("sender not an eoa")
+	ErrFeeCapTooLow                 = errors.New("max fee per gas less than block base fee")
+	ErrTipAboveFeeCap               = errors.New("max priority fee per gas higher than max fee per gas")
+	ErrInsufficientFunds            = errors.New("insufficient funds for gas * price + value")
+	ErrInsufficientFundsForTransfer = errors.New("insufficient funds for transfer")
+	ErrIntrinsicGas                 = errors.New("intrinsic gas too low")
+	ErrGasLimitReached              = errors.New("gas limit reached")
+	ErrMaxInitCodeSizeExceeded      = errors.New("max initcode size exceeded")
+)
+
+// ExecutionResult is the outcome of an executed message
+type ExecutionResult struct {
+	UsedGas    uint64
+	Err        error // execution error, e.g. vm.ErrExecutionReverted
+	ReturnData []byte
+	Logs       []*types.Log
+}
+
+// Failed reports whether the execution failed
+func (r *ExecutionResult) Failed() bool { return r.Err != nil }
+
+// Return returns the returned data of a successful execution
+func (r *ExecutionResult) Return() []byte {
+	if r.Err != nil {
+		return nil
+	}
+	return common.CopyBytes(r.ReturnData)
+}
+
+// Revert returns the revert data of an execution aborted by REVERT
+func (r *ExecutionResult) Revert() []byte {
+	if r.Err != vm.ErrExecutionReverted {
+		return nil
+	}
+	return common.CopyBytes(r.ReturnData)
+}
+
+// ApplyMessage executes a message on the EVM's state as geth's state
+// transition does: gas is bought, the message is executed, unused gas is
+// refunded and the fee paid to the coinbase. gasPool is the gas left in the
+// block and is reduced by the gas used. An error means the message was
+// rejected and the state is unchanged; execution failures are reported in
+// the result. The state is finalised after execution.
+//
+// It follows core/state_transition.go of the go-ethereum version in go.mod.
+// core.ApplyMessage itself is not used, as package core pulls in the node's
+// databases (core/rawdb and pebble), which this module does not depend on;
+// the eth_callMany tests pin its gas accounting and errors to geth's.
+func ApplyMessage(evm *vm.EVM, state *StateDB, msg *Message, gasPool *uint64) (*ExecutionResult, error) {
+	snapshot, pool := state.Snapshot(), *gasPool
+	result, err := applyMessage(evm, state, msg, gasPool)
+	if err != nil {
+		state.RevertToSnapshot(snapshot)
+		*gasPool = pool
+		return nil, err
+	}
+	result.Logs = state.Finalise()
+	return result, nil
+}
+
+func applyMessage(evm *vm.EVM, state *StateDB, msg *Message, gasPool *uint64) (*ExecutionResult, error) {
+	var (
+		ctx      = evm.Context
+		rules    = evm.ChainConfig().Rules(ctx.BlockNumber, ctx.Random != nil, ctx.Time)
+		creation = msg.To == nil
+	)
+
+	if !msg.SkipAccountChecks {
+		if nonce := state.GetNonce(msg.From); nonce > msg.Nonce {
+			return nil, fmt.Errorf("%w: address %v, tx: %d state: %d", ErrNonceTooLow, msg.From.Hex(), msg.Nonce, nonce)
+		} else if nonce < msg.Nonce {
+			return nil, fmt.Errorf("%w: address %v, tx: %d state: %d", ErrNonceTooHigh, msg.From.Hex(), msg.Nonce, nonce)
+		}
+		if codeHash := state.GetCodeHash(msg.From); codeHash != (common.Hash{}) && codeHash != types.EmptyCodeHash {
+			return nil, fmt.Errorf("%w: address %v, codehash: %s", ErrSenderNoEOA, msg.From.Hex(), codeHash)
+		}
+	}
+	noFees := evm.Config.NoBaseFee && msg.GasFeeCap.Sign() == 0 && msg.GasTipCap.Sign() == 0
+	if rules.IsLondon && !noFees {
+		if msg.GasFeeCap.Cmp(msg.GasTipCap) < 0 {
+			return nil, fmt.Errorf("%w: address %v, maxPriorityFeePerGas: %s, maxFeePerGas: %s", ErrTipAboveFeeCap, msg.From.Hex(), msg.GasTipCap, msg.GasFeeCap)
+		}
+		if msg.GasFeeCap.Cmp(ctx.BaseFee) < 0 {
+			return nil, fmt.Errorf("%w: address %v, maxFeePerGas: %s, baseFee: %s", ErrFeeCapTooLow, msg.From.Hex(), msg.GasFeeCap, ctx.BaseFee)
+		}
+	}
+
+	// Buy gas
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(msg.GasLimit), msg.GasPrice)
+	balanceCheck := new(big.Int).Set(cost)
+	if msg.GasFeeCap != nil {
+		balanceCheck.SetUint64(msg.GasLimit)
+		balanceCheck.Mul(balanceCheck, msg.GasFeeCap)
+	}
+	balanceCheck.Add(balanceCheck, msg.Value)
+	if blobGas := uint64(len(msg.BlobHashes)) * params.BlobTxBlobGasPerBlob; blobGas > 0 && rules.IsCancun && ctx.BlobBaseFee != nil {
+		blobGasBig := new(big.Int).SetUint64(blobGas)
+		if msg.BlobGasFeeCap != nil {
+			balanceCheck.Add(balanceCheck, new(big.Int).Mul(blobGasBig, msg.BlobGasFeeCap))
+		}
+		cost.Add(cost, new(big.Int).Mul(blobGasBig, ctx.BlobBaseFee))
+	}
+	if have := state.GetBalance(msg.From); have.Cmp(balanceCheck) < 0 {
+		return nil, fmt.Errorf("%w: address %v have %v want %v", ErrInsufficientFunds, msg.From.Hex(), have, balanceCheck)
+	}
+	if *gasPool < msg.GasLimit {
+		return nil, ErrGasLimitReached
+	}
+	*gasPool -= msg.GasLimit
+	state.SubBalance(msg.From, cost)
+
+	gas, err := intrinsicGas(msg.Data, msg.AccessList, creation, rules)
+	if err != nil {
+		return nil, err
+	}
+	if msg.GasLimit < gas {
+		return nil, fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, msg.GasLimit, gas)
+	}
+	gasLeft := msg.GasLimit - gas
+
+	if msg.Value.Sign() > 0 && !ctx.CanTransfer(state, msg.From, msg.Value) {
+		return nil, fmt.Errorf("%w: address %v", ErrInsufficientFundsForTransfer, msg.From.Hex())
+	}
+	if rules.IsShanghai && creation && len(msg.Data) > params.MaxInitCodeSize {
+		return nil, fmt.Errorf("%w: code size %v limit %v", ErrMaxInitCodeSizeExceeded, len(msg.Data), params.MaxInitCodeSize)
+	}
+
+	state.Prepare(rules, msg.From, ctx.Coinbase, msg.To, vm.ActivePrecompiles(rules), msg.AccessList)
+
+	var (
+		ret   []byte
+		vmerr error
+	)
+	sender := vm.AccountRef(msg.From)
+	if creation {
+		ret, _, gasLeft, vmerr = evm.Create(sender, msg.Data, gasLeft, msg.Value)
+	} else {
+		state.SetNonce(msg.From, state.GetNonce(msg.From)+1)
+		ret, gasLeft, vmerr = evm.Call(sender, *msg.To, msg.Data, gasLeft, msg.Value)
+	}
+
+	// Refund, capped by EIP-3529 from London
+	quotient := params.RefundQuotient
+	if rules.IsLondon {
+		quotient = params.RefundQuotientEIP3529
+	}
+	gasLeft += min((msg.GasLimit-gasLeft)/quotient, state.GetRefund())
+	state.AddBalance(msg.From, new(big.Int).Mul(new(big.Int).SetUint64(gasLeft), msg.GasPrice))
+	*gasPool += gasLeft
+	used := msg.GasLimit - gasLeft
+
+	if !noFees {
+		tip := msg.GasPrice
+		if rules.IsLondon {
+			tip = new(big.Int).Sub(msg.GasFeeCap, ctx.BaseFee)
+			if tip.Cmp(msg.GasTipCap) > 0 {
+				tip = msg.GasTipCap
+			}
+		}
+		state.AddBalance(ctx.Coinbase, new(big.Int).Mul(new(big.Int).SetUint64(used), tip))
+	}
+
+	return &ExecutionResult{
+		UsedGas:    used,
+		Err:        vmerr,
+		ReturnData: ret,
+	}, nil
+}
+
+// intrinsicGas returns the gas a message costs before execution
+func intrinsicGas(data []byte, accessList types.AccessList, creation bool, rules params.Rules) (uint64, error) {
+	gas := params.TxGas
+	if creation && rules.IsHomestead {
+		gas = params.TxGasContractCreation
+	}
+
+	var nonZero uint64
+	for _, b := range data {
+		if b != 0 {
+			nonZero++
+		}
+	}
+	nonZeroGas := params.TxDataNonZeroGasFrontier
+	if rules.IsIstanbul {
+		nonZeroGas = params.TxDataNonZeroGasEIP2028
+	}
+	dataGas := new(big.Int).SetUint64(nonZero * nonZeroGas)
+	dataGas.Add(dataGas, new(big.Int).SetUint64((uint64(len(data))-nonZero)*params.TxDataZeroGas))
+	if creation && rules.IsShanghai {
+		words := (uint64(len(data)) + 31) / 32
+		dataGas.Add(dataGas, new(big.Int).SetUint64(words*params.InitCodeWordGas))
+	}
+	dataGas.Add(dataGas, new(big.Int).SetUint64(gas))
+	dataGas.Add(dataGas, new(big.Int).SetUint64(uint64(len(accessList))*params.TxAccessListAddressGas))
+	dataGas.Add(dataGas, new(big.Int).SetUint64(uint64(accessList.StorageKeys())*params.TxAccessListStorageKeyGas))
+	if !dataGas.IsUint64() {
+		return 0, errors.New("gas uint64 overflow")
+	}
+	return dataGas.Uint64(), nil
+}
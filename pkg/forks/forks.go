@@ -0,0 +1,145 @@
+package forks
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/sunvim/evm_rpc/pkg/config"
+)
+
+// presets are the fork schedules of public networks
+var presets = map[string]*params.ChainConfig{
+	"mainnet": params.MainnetChainConfig,
+	"sepolia": params.SepoliaChainConfig,
+	"holesky": params.HoleskyChainConfig,
+}
+
+// ChainConfig builds the go-ethereum chain config from a chain's fork
+// settings. It is what execution, transaction validation and rendering
+// consult to learn which rules apply at a block.
+func ChainConfig(chainID uint64, cfg config.ForksConfig) (*params.ChainConfig, error) {
+	var chainConfig params.ChainConfig
+	if cfg.Preset == "" {
+		chainConfig = genesisForks()
+	} else {
+		preset, ok := presets[cfg.Preset]
+		if !ok {
+			return nil, fmt.Errorf("unknown fork preset %q", cfg.Preset)
+		}
+		if preset.ChainID.Uint64() != chainID {
+			return nil, fmt.Errorf("fork preset %s is for chain %d, not %d", cfg.Preset, preset.ChainID, chainID)
+		}
+		chainConfig = *preset
+	}
+	chainConfig.ChainID = new(big.Int).SetUint64(chainID)
+
+	for _, block := range []struct {
+		at    *uint64
+		field **big.Int
+	}{
+		{cfg.HomesteadBlock, &chainConfig.HomesteadBlock},
+		{cfg.EIP150Block, &chainConfig.EIP150Block},
+		{cfg.EIP155Block, &chainConfig.EIP155Block},
+		{cfg.EIP158Block, &chainConfig.EIP158Block},
+		{cfg.ByzantiumBlock, &chainConfig.ByzantiumBlock},
+		{cfg.ConstantinopleBlock, &chainConfig.ConstantinopleBlock},
+		{cfg.PetersburgBlock, &chainConfig.PetersburgBlock},
+		{cfg.IstanbulBlock, &chainConfig.IstanbulBlock},
+		{cfg.BerlinBlock, &chainConfig.BerlinBlock},
+		{cfg.LondonBlock, &chainConfig.LondonBlock},
+	} {
+		if block.at != nil {
+			*block.field = new(big.Int).SetUint64(*block.at)
+		}
+	}
+	if cfg.ShanghaiTime != nil {
+		chainConfig.ShanghaiTime = cfg.ShanghaiTime
+	}
+	if cfg.CancunTime != nil {
+		chainConfig.CancunTime = cfg.CancunTime
+	}
+
+	if err := chainConfig.CheckConfigForkOrder(); err != nil {
+		return nil, err
+	}
+	return &chainConfig, nil
+}
+
+// genesisForks activates every fork up to Cancun at genesis
+func genesisForks() params.ChainConfig {
+	zero := uint64(0)
+	return params.ChainConfig{
+		HomesteadBlock:                big.NewInt(0),
+		EIP150Block:                   big.NewInt(0),
+		EIP155Block:                   big.NewInt(0),
+		EIP158Block:                   big.NewInt(0),
+		ByzantiumBlock:                big.NewInt(0),
+		ConstantinopleBlock:           big.NewInt(0),
+		PetersburgBlock:               big.NewInt(0),
+		IstanbulBlock:                 big.NewInt(0),
+		BerlinBlock:                   big.NewInt(0),
+		LondonBlock:                   big.NewInt(0),
+		ShanghaiTime:                  &zero,
+		CancunTime:                    &zero,
+		TerminalTotalDifficulty:       big.NewInt(0),
+		TerminalTotalDifficultyPassed: true,
+	}
+}
+
+// At returns the rules and signer of a block
+func At(chainConfig *params.ChainConfig, number *big.Int, time uint64) (params.Rules, types.Signer) {
+	isMerge := chainConfig.TerminalTotalDifficulty != nil
+	return chainConfig.Rules(number, isMerge, time), types.MakeSigner(chainConfig, number, time)
+}
+
+// Next returns the rules and signer of the block after head, or of the
+// latest scheduled forks without a head
+func Next(chainConfig *params.ChainConfig, head *types.Header) (params.Rules, types.Signer) {
+	if head == nil {
+		return At(chainConfig, new(big.Int).SetUint64(math.MaxUint64), math.MaxUint64)
+	}
+	return At(chainConfig, new(big.Int).Add(head.Number, big.NewInt(1)), head.Time)
+}
+
+// NextBaseFee returns the base fee of the block after parent by EIP-1559,
+// or nil before London.
+// Chains that keep the base fee at zero, such as BSC, stay at zero.
+func NextBaseFee(config *params.ChainConfig, parent *types.Header) *big.Int {
+	if !config.IsLondon(new(big.Int).Add(parent.Number, big.NewInt(1))) {
+		return nil
+	}
+	if parent.BaseFee == nil {
+		return new(big.Int).SetUint64(params.InitialBaseFee)
+	}
+	if parent.BaseFee.Sign() == 0 {
+		return new(big.Int)
+	}
+
+	target := parent.GasLimit / config.ElasticityMultiplier()
+	if target == 0 || parent.GasUsed == target {
+		return new(big.Int).Set(parent.BaseFee)
+	}
+	denominator := new(big.Int).SetUint64(config.BaseFeeChangeDenominator())
+	if parent.GasUsed > target {
+		delta := new(big.Int).SetUint64(parent.GasUsed - target)
+		delta.Mul(delta, parent.BaseFee)
+		delta.Div(delta, new(big.Int).SetUint64(target))
+		delta.Div(delta, denominator)
+		if delta.Sign() == 0 {
+			delta.SetUint64(1)
+		}
+		return delta.Add(delta, parent.BaseFee)
+	}
+	delta := new(big.Int).SetUint64(target - parent.GasUsed)
+	delta.Mul(delta, parent.BaseFee)
+	delta.Div(delta, new(big.Int).SetUint64(target))
+	delta.Div(delta, denominator)
+	fee := delta.Sub(parent.BaseFee, delta)
+	if fee.Sign() < 0 {
+		fee.SetUint64(0)
+	}
+	return fee
+}
@@ -0,0 +1,414 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+const (
+	// defaultPollInterval is how often the upstream head is polled
+	defaultPollInterval = 3 * time.Second
+
+	// maxReorgDepth bounds how far back a fork point is searched
+	maxReorgDepth = storage.DefaultCanonicalDepth
+)
+
+// errReorg is returned when a block does not extend the local chain
+var errReorg = errors.New("chain reorganization")
+
+// Ingester follows an upstream execution node and writes its chain to Pika,
+// making the service self-contained instead of relying on an external
+// writer to populate storage
+type Ingester struct {
+	cfg         config.IngestConfig
+	blockReader *storage.BlockReader
+	blockWriter *storage.BlockWriter
+	stateReader *storage.StateReader
+	stateWriter *storage.StateWriter
+	txReader    *storage.TransactionReader
+
+	// txPool receives transactions of reorged blocks that the new chain
+	// does not include; nil disables reinjection
+	txPool   *storage.TxPoolStorage
+	reorged  []*types.Transaction
+	upstream *Upstream
+
+	// connected is whether the last upstream head request succeeded
+	connected atomic.Bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewIngester creates a new ingester
+func NewIngester(cfg config.IngestConfig, pikaClient *storage.PikaClient, blockReader *storage.BlockReader) *Ingester {
+	return &Ingester{
+		cfg:         cfg,
+		blockReader: blockReader,
+		blockWriter: storage.NewBlockWriter(pikaClient),
+		stateReader: storage.NewStateReader(pikaClient),
+		stateWriter: storage.NewStateWriter(pikaClient),
+		txReader:    storage.NewTransactionReader(pikaClient),
+	}
+}
+
+// SetTxPool makes the ingester return transactions of reorged blocks to the
+// pool, as a full node does
+func (i *Ingester) SetTxPool(txPool *storage.TxPoolStorage) {
+	i.txPool = txPool
+}
+
+// UpstreamConnected reports whether the upstream node answered the last
+// head request
+func (i *Ingester) UpstreamConnected() bool {
+	return i.connected.Load()
+}
+
+// Start connects to the upstream node and starts following its head
+func (i *Ingester) Start(ctx context.Context) error {
+	if i.cfg.UpstreamURL == "" {
+		return errors.New("ingest upstream_url is not set")
+	}
+
+	upstream, err := DialUpstream(ctx, i.cfg.UpstreamURL)
+	if err != nil {
+		return err
+	}
+	i.upstream = upstream
+	i.connected.Store(true)
+
+	i.ctx, i.cancel = context.WithCancel(context.Background())
+	i.wg.Add(1)
+	go i.run()
+
+	logger.Infof("Ingesting blocks from %s", config.RedactURL(i.cfg.UpstreamURL))
+	return nil
+}
+
+// Stop stops ingesting and disconnects from the upstream node
+func (i *Ingester) Stop(ctx context.Context) error {
+	i.cancel()
+	i.connected.Store(false)
+
+	done := make(chan struct{})
+	go func() {
+		i.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	i.upstream.Close()
+	return nil
+}
+
+// run syncs on every upstream head notification, polling as a fallback
+func (i *Ingester) run() {
+	defer i.wg.Done()
+
+	interval := i.cfg.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	heads := make(chan *types.Header, 16)
+	sub := i.subscribe(heads)
+	defer func() {
+		if sub != nil {
+			sub.Unsubscribe()
+		}
+	}()
+
+	i.sync()
+
+	for {
+		var subErr <-chan error
+		if sub != nil {
+			subErr = sub.Err()
+		}
+
+		select {
+		case <-i.ctx.Done():
+			return
+		case <-heads:
+			i.sync()
+		case <-ticker.C:
+			if sub == nil {
+				sub = i.subscribe(heads)
+			}
+			i.sync()
+		case err := <-subErr:
+			logger.Warnf("Upstream head subscription lost: %v", err)
+			sub = nil
+		}
+	}
+}
+
+// subscribe subscribes to upstream heads if the transport supports it
+func (i *Ingester) subscribe(heads chan<- *types.Header) ethereum.Subscription {
+	if !i.upstream.rpc.SupportsSubscriptions() {
+		return nil
+	}
+	sub, err := i.upstream.client.SubscribeNewHead(i.ctx, heads)
+	if err != nil {
+		logger.Warnf("Failed to subscribe to upstream heads, polling instead: %v", err)
+		return nil
+	}
+	return sub
+}
+
+// sync ingests all blocks up to the upstream head
+func (i *Ingester) sync() {
+	for i.ctx.Err() == nil {
+		head, err := i.upstream.Head(i.ctx)
+		i.connected.Store(err == nil)
+		if err != nil {
+			logger.Warnf("Failed to get upstream head: %v", err)
+			return
+		}
+
+		next, err := i.nextBlock(head)
+		if err != nil {
+			logger.Errorf("Failed to get latest ingested block: %v", err)
+			return
+		}
+
+		for number := next; number <= head; number++ {
+			if i.ctx.Err() != nil {
+				return
+			}
+			err = i.ingest(i.ctx, number)
+			if err != nil {
+				break
+			}
+		}
+
+		switch {
+		case errors.Is(err, errReorg):
+			// Resume from the fork point
+			continue
+		case err == nil:
+			// Caught up, so the new branch is complete
+			i.reinject(i.ctx)
+		case i.ctx.Err() == nil:
+			logger.Errorf("Failed to ingest block: %v", err)
+		}
+		return
+	}
+}
+
+// nextBlock returns the first block not ingested yet
+func (i *Ingester) nextBlock(head uint64) (uint64, error) {
+	latest, err := i.blockReader.GetLatestBlockNumber(i.ctx)
+	if err == storage.ErrNotFound {
+		if i.cfg.StartBlock > 0 {
+			return i.cfg.StartBlock, nil
+		}
+		return head, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return latest + 1, nil
+}
+
+// ingest writes a block with its receipts and state changes and announces
+// it as the new head. errReorg is returned after rewinding if the block
+// does not extend the local chain.
+func (i *Ingester) ingest(ctx context.Context, number uint64) error {
+	block, err := i.upstream.Block(ctx, number)
+	if err != nil {
+		return err
+	}
+
+	if number > 0 {
+		canonical, err := i.blockReader.IsCanonical(ctx, block.ParentHash(), number-1)
+		if err != nil && err != storage.ErrNotFound {
+			return fmt.Errorf("failed to check parent of block %d: %w", number, err)
+		}
+		if err == nil && !canonical {
+			if err := i.rewind(ctx, number-1); err != nil {
+				return err
+			}
+			return errReorg
+		}
+	}
+
+	receipts, err := i.upstream.Receipts(ctx, block)
+	if err != nil {
+		return err
+	}
+
+	var diff *storage.StateDiff
+	if i.cfg.StateDiffs {
+		diff, err = i.stateDiff(ctx, block.Hash(), false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := i.blockWriter.WriteBlock(ctx, block, receipts, i.totalDifficulty(ctx, block)); err != nil {
+		return err
+	}
+	if diff != nil {
+		if err := i.stateWriter.WriteLatestState(ctx, diff); err != nil {
+			return err
+		}
+		if err := i.stateWriter.WriteHistoricalState(ctx, number, diff); err != nil {
+			return err
+		}
+	}
+	if err := i.blockWriter.SetHead(ctx, number, block.Hash()); err != nil {
+		return fmt.Errorf("failed to set head %d: %w", number, err)
+	}
+
+	metrics.RecordIngestedBlock(number)
+	logger.Debugf("Ingested block %d (%s), txs=%d", number, block.Hash().Hex(), len(block.Transactions()))
+	return nil
+}
+
+// rewind unwinds the local blocks above the most recent common ancestor of
+// the local and upstream chains at or below number
+func (i *Ingester) rewind(ctx context.Context, number uint64) error {
+	latest, err := i.blockReader.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	ancestor := number
+	for depth := uint64(0); ; depth++ {
+		if depth >= maxReorgDepth {
+			return fmt.Errorf("reorg at block %d deeper than %d blocks", number, maxReorgDepth)
+		}
+		header, err := i.upstream.client.HeaderByNumber(ctx, new(big.Int).SetUint64(ancestor))
+		if err != nil {
+			return fmt.Errorf("failed to get upstream header %d: %w", ancestor, err)
+		}
+		canonical, err := i.blockReader.IsCanonical(ctx, header.Hash(), ancestor)
+		if err == storage.ErrNotFound || (err == nil && canonical) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check block %d: %w", ancestor, err)
+		}
+		if ancestor == 0 {
+			return errors.New("upstream genesis does not match local chain")
+		}
+		ancestor--
+	}
+
+	for n := latest; n > ancestor; n-- {
+		block, err := i.blockReader.GetBlock(ctx, n)
+		if err == storage.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get reorged block %d: %w", n, err)
+		}
+
+		if i.cfg.StateDiffs {
+			diff, err := i.stateDiff(ctx, block.Hash(), true)
+			if err != nil {
+				logger.Warnf("State of reorged block %d not reverted: %v", n, err)
+			} else {
+				if err := i.stateWriter.WriteLatestState(ctx, diff); err != nil {
+					return err
+				}
+				if err := i.stateWriter.DeleteHistoricalState(ctx, n, diff); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := i.blockWriter.RemoveBlock(ctx, block); err != nil {
+			return fmt.Errorf("failed to remove reorged block %d: %w", n, err)
+		}
+		if i.txPool != nil {
+			i.reorged = append(i.reorged, block.Transactions()...)
+		}
+	}
+
+	if err := i.blockWriter.SetLatest(ctx, ancestor); err != nil {
+		return fmt.Errorf("failed to rewind to block %d: %w", ancestor, err)
+	}
+
+	metrics.RecordIngestReorg(latest - ancestor)
+	logger.Warnf("Chain reorg: rewound from block %d to common ancestor %d", latest, ancestor)
+	return nil
+}
+
+// reinject returns transactions of reorged blocks to the pool unless the new
+// chain includes them or their nonce has been used since
+func (i *Ingester) reinject(ctx context.Context) {
+	if len(i.reorged) == 0 {
+		return
+	}
+	txs := i.reorged
+	i.reorged = nil
+
+	var added int
+	for _, tx := range txs {
+		_, err := i.txReader.GetTransactionLookup(ctx, tx.Hash())
+		if err == nil {
+			continue
+		}
+		if err != storage.ErrNotFound {
+			logger.Warnf("Failed to look up reorged tx %s: %v", tx.Hash().Hex(), err)
+			continue
+		}
+
+		from, err := i.txPool.Sender(tx)
+		if err != nil {
+			continue
+		}
+		nonce, err := i.stateReader.GetNonce(ctx, from, "latest")
+		if err != nil {
+			logger.Warnf("Failed to get nonce of %s: %v", from.Hex(), err)
+			continue
+		}
+		if tx.Nonce() < nonce {
+			continue
+		}
+
+		if err := i.txPool.AddPendingTx(ctx, tx, "reorg"); err != nil {
+			logger.Debugf("Reorged tx %s not reinjected: %v", tx.Hash().Hex(), err)
+			continue
+		}
+		added++
+	}
+
+	metrics.RecordReorgReinjected(added)
+	logger.Infof("Reinjected %d of %d reorged transactions into the pool", added, len(txs))
+}
+
+// totalDifficulty extends the parent's total difficulty, asking the upstream
+// node when it is not known locally. nil is returned if neither knows it.
+func (i *Ingester) totalDifficulty(ctx context.Context, block *types.Block) *big.Int {
+	if block.NumberU64() > 0 {
+		parent, err := i.blockReader.GetTotalDifficulty(ctx, block.NumberU64()-1, block.ParentHash())
+		if err == nil {
+			return new(big.Int).Add(parent, block.Difficulty())
+		}
+	}
+
+	return i.upstream.TotalDifficulty(ctx, block.Hash())
+}
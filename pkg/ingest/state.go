@@ -0,0 +1,137 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// prestateAccount is an account as reported by the prestate tracer.
+// In diff mode pre holds the full account while post only holds the fields
+// changed by a transaction.
+type prestateAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   uint64                      `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+// prestateTrace is the prestate tracer result of one transaction
+type prestateTrace struct {
+	Result struct {
+		Pre  map[common.Address]*prestateAccount `json:"pre"`
+		Post map[common.Address]*prestateAccount `json:"post"`
+	} `json:"result"`
+}
+
+// prestateTracerConfig runs the prestate tracer in diff mode
+var prestateTracerConfig = map[string]interface{}{
+	"tracer":       "prestateTracer",
+	"tracerConfig": map[string]interface{}{"diffMode": true},
+}
+
+// stateDiff traces a block and returns the state it changed. With revert
+// set it returns the state the block overwrote instead, for unwinding it.
+func (i *Ingester) stateDiff(ctx context.Context, hash common.Hash, revert bool) (*storage.StateDiff, error) {
+	var traces []prestateTrace
+	if err := i.upstream.rpc.CallContext(ctx, &traces, "debug_traceBlockByHash", hash, prestateTracerConfig); err != nil {
+		return nil, fmt.Errorf("failed to trace block %s: %w", hash.Hex(), err)
+	}
+
+	diff := storage.NewStateDiff()
+	if revert {
+		for idx := len(traces) - 1; idx >= 0; idx-- {
+			if err := i.applyTrace(ctx, diff, traces[idx].Result.Pre, traces[idx].Result.Post, true); err != nil {
+				return nil, err
+			}
+		}
+		return diff, nil
+	}
+
+	for _, trace := range traces {
+		if err := i.applyTrace(ctx, diff, trace.Result.Post, trace.Result.Pre, false); err != nil {
+			return nil, err
+		}
+	}
+	return diff, nil
+}
+
+// applyTrace merges the state change of one transaction into a diff. after
+// holds the fields afterwards and before their previous values; accounts and
+// slots only present in before no longer exist. full is set if after holds
+// complete accounts, in which case an omitted nonce is zero.
+func (i *Ingester) applyTrace(ctx context.Context, diff *storage.StateDiff, after, before map[common.Address]*prestateAccount, full bool) error {
+	for address, prev := range before {
+		if _, ok := after[address]; ok {
+			continue
+		}
+		diff.Accounts[address] = nil
+		for slot := range prev.Storage {
+			slots(diff, address)[slot] = common.Hash{}
+		}
+	}
+
+	for address, next := range after {
+		state, err := i.account(ctx, diff, address)
+		if err != nil {
+			return err
+		}
+		if next.Balance != nil {
+			state.Balance = next.Balance.ToInt()
+		}
+		if next.Nonce != 0 || full {
+			state.Nonce = next.Nonce
+		}
+		if len(next.Code) > 0 {
+			codeHash := crypto.Keccak256Hash(next.Code)
+			state.CodeHash = codeHash.Hex()
+			diff.Code[codeHash] = next.Code
+		}
+		diff.Accounts[address] = state
+
+		for slot, value := range next.Storage {
+			slots(diff, address)[slot] = value
+		}
+		if prev, ok := before[address]; ok {
+			for slot := range prev.Storage {
+				if _, ok := next.Storage[slot]; !ok {
+					slots(diff, address)[slot] = common.Hash{}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// account returns the state of an account as changed so far by a diff,
+// starting from the latest stored state
+func (i *Ingester) account(ctx context.Context, diff *storage.StateDiff, address common.Address) (*storage.AccountState, error) {
+	if state, ok := diff.Accounts[address]; ok {
+		if state == nil {
+			return &storage.AccountState{Balance: new(big.Int)}, nil
+		}
+		return state, nil
+	}
+
+	state, err := i.stateReader.GetAccountState(ctx, address, "latest")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account %s: %w", address.Hex(), err)
+	}
+	return state, nil
+}
+
+// slots returns the changed storage slots of an account in a diff
+func slots(diff *storage.StateDiff, address common.Address) map[common.Hash]common.Hash {
+	s, ok := diff.Storage[address]
+	if !ok {
+		s = make(map[common.Hash]common.Hash)
+		diff.Storage[address] = s
+	}
+	return s
+}
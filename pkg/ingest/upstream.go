@@ -0,0 +1,94 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Upstream fetches chain data from an execution node over JSON-RPC
+type Upstream struct {
+	rpc    *rpc.Client
+	client *ethclient.Client
+}
+
+// DialUpstream connects to an execution node over HTTP or WebSocket
+func DialUpstream(ctx context.Context, url string) (*Upstream, error) {
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to upstream: %w", err)
+	}
+	return &Upstream{
+		rpc:    client,
+		client: ethclient.NewClient(client),
+	}, nil
+}
+
+// Close disconnects from the node
+func (u *Upstream) Close() {
+	u.rpc.Close()
+}
+
+// Head returns the number of the node's latest block
+func (u *Upstream) Head(ctx context.Context) (uint64, error) {
+	return u.client.BlockNumber(ctx)
+}
+
+// Block returns the block at a height
+func (u *Upstream) Block(ctx context.Context, number uint64) (*types.Block, error) {
+	block, err := u.client.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block %d: %w", number, err)
+	}
+	return block, nil
+}
+
+// Receipts fetches the receipts of a block, falling back to per-transaction
+// requests for nodes without eth_getBlockReceipts
+func (u *Upstream) Receipts(ctx context.Context, block *types.Block) (types.Receipts, error) {
+	txs := block.Transactions()
+
+	receipts, err := u.client.BlockReceipts(ctx, rpc.BlockNumberOrHashWithHash(block.Hash(), false))
+	if err == nil && len(receipts) == len(txs) {
+		return receipts, nil
+	}
+
+	receipts = make(types.Receipts, len(txs))
+	batch := make([]rpc.BatchElem, len(txs))
+	for idx, tx := range txs {
+		receipts[idx] = new(types.Receipt)
+		batch[idx] = rpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args:   []interface{}{tx.Hash()},
+			Result: receipts[idx],
+		}
+	}
+	if err := u.rpc.BatchCallContext(ctx, batch); err != nil {
+		return nil, fmt.Errorf("failed to get receipts of block %d: %w", block.NumberU64(), err)
+	}
+	for _, elem := range batch {
+		if elem.Error != nil {
+			return nil, fmt.Errorf("failed to get receipts of block %d: %w", block.NumberU64(), elem.Error)
+		}
+	}
+
+	return receipts, nil
+}
+
+// TotalDifficulty returns the total difficulty the node reports for a
+// block, nil if it does not report one
+func (u *Upstream) TotalDifficulty(ctx context.Context, hash common.Hash) *big.Int {
+	var head struct {
+		TotalDifficulty *hexutil.Big `json:"totalDifficulty"`
+	}
+	if err := u.rpc.CallContext(ctx, &head, "eth_getBlockByHash", hash, false); err != nil || head.TotalDifficulty == nil {
+		return nil
+	}
+	return head.TotalDifficulty.ToInt()
+}
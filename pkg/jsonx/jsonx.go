@@ -0,0 +1,238 @@
+// Package jsonx serializes JSON-RPC results without reflection where it
+// matters. Blocks, transactions, receipts and logs append their JSON
+// directly; everything else goes through encoding/json. The output is the
+// same as encoding/json's.
+package jsonx
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/big"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Appender is implemented by types that write their own JSON
+type Appender interface {
+	AppendJSON(dst []byte) ([]byte, error)
+}
+
+// Codec serializes JSON-RPC responses
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+}
+
+// Names of the built-in codecs
+const (
+	CodecFast = "fast" // appenders where available, encoding/json otherwise
+	CodecStd  = "std"  // encoding/json only
+)
+
+type fastCodec struct{}
+
+func (fastCodec) Marshal(v interface{}) ([]byte, error) { return Marshal(v) }
+
+type stdCodec struct{}
+
+func (stdCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+var codecs = map[string]Codec{
+	CodecFast: fastCodec{},
+	CodecStd:  stdCodec{},
+}
+
+// Register makes a codec selectable by name, e.g. one backed by another
+// JSON library. It must be called before the config is applied.
+func Register(name string, codec Codec) {
+	codecs[name] = codec
+}
+
+// Lookup returns the codec registered under name
+func Lookup(name string) (Codec, bool) {
+	codec, ok := codecs[name]
+	return codec, ok
+}
+
+// Default is the codec used unless configured otherwise
+var Default Codec = fastCodec{}
+
+// Marshal returns the JSON encoding of v
+func Marshal(v interface{}) ([]byte, error) {
+	return AppendValue(nil, v)
+}
+
+// AppendValue appends the JSON encoding of v to dst, falling back to
+// encoding/json for types without a fast path
+func AppendValue(dst []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(dst, "null"...), nil
+	case Appender:
+		return v.AppendJSON(dst)
+	case bool:
+		return strconv.AppendBool(dst, v), nil
+	case float64:
+		// Request ids are decoded as float64; integral ones format the same
+		// as encoding/json
+		if v == math.Trunc(v) && math.Abs(v) < 1e21 {
+			return strconv.AppendFloat(dst, v, 'f', -1, 64), nil
+		}
+	case string:
+		return AppendString(dst, v)
+	case hexutil.Uint64:
+		return AppendUint64(dst, uint64(v)), nil
+	case *hexutil.Big:
+		return AppendBig(dst, (*big.Int)(v)), nil
+	case hexutil.Bytes:
+		return AppendBytes(dst, v), nil
+	case common.Hash:
+		return AppendBytes(dst, v[:]), nil
+	case *common.Hash:
+		return AppendHashPtr(dst, v), nil
+	case common.Address:
+		return AppendBytes(dst, v[:]), nil
+	case []common.Hash:
+		return AppendHashes(dst, v), nil
+	case *types.Log:
+		return AppendLog(dst, v), nil
+	case []*types.Log:
+		return AppendLogs(dst, v), nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, data...), nil
+}
+
+// AppendString appends a JSON string. Strings that encoding/json would
+// escape are left to it.
+func AppendString(dst []byte, s string) ([]byte, error) {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= utf8.RuneSelf || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			data, err := json.Marshal(s)
+			if err != nil {
+				return dst, err
+			}
+			return append(dst, data...), nil
+		}
+	}
+	dst = append(dst, '"')
+	dst = append(dst, s...)
+	return append(dst, '"'), nil
+}
+
+// AppendUint64 appends a quantity as hexutil.Uint64 does
+func AppendUint64(dst []byte, v uint64) []byte {
+	dst = append(dst, `"0x`...)
+	dst = strconv.AppendUint(dst, v, 16)
+	return append(dst, '"')
+}
+
+// AppendUint64Ptr appends a quantity, or null for nil
+func AppendUint64Ptr(dst []byte, v *hexutil.Uint64) []byte {
+	if v == nil {
+		return append(dst, "null"...)
+	}
+	return AppendUint64(dst, uint64(*v))
+}
+
+// AppendBig appends a quantity as hexutil.Big does, or null for nil
+func AppendBig(dst []byte, v *big.Int) []byte {
+	if v == nil {
+		return append(dst, "null"...)
+	}
+	dst = append(dst, '"')
+	if v.Sign() < 0 {
+		dst = append(dst, '-')
+		v = new(big.Int).Neg(v)
+	}
+	dst = append(dst, "0x"...)
+	dst = v.Append(dst, 16)
+	return append(dst, '"')
+}
+
+// AppendBytes appends 0x-prefixed hex as hexutil.Bytes does
+func AppendBytes(dst []byte, b []byte) []byte {
+	dst = append(dst, `"0x`...)
+	dst = hex.AppendEncode(dst, b)
+	return append(dst, '"')
+}
+
+// AppendHashPtr appends a hash, or null for nil
+func AppendHashPtr(dst []byte, h *common.Hash) []byte {
+	if h == nil {
+		return append(dst, "null"...)
+	}
+	return AppendBytes(dst, h[:])
+}
+
+// AppendAddressPtr appends an address, or null for nil
+func AppendAddressPtr(dst []byte, a *common.Address) []byte {
+	if a == nil {
+		return append(dst, "null"...)
+	}
+	return AppendBytes(dst, a[:])
+}
+
+// AppendHashes appends a list of hashes, or null for a nil slice
+func AppendHashes(dst []byte, hashes []common.Hash) []byte {
+	if hashes == nil {
+		return append(dst, "null"...)
+	}
+	dst = append(dst, '[')
+	for i := range hashes {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = AppendBytes(dst, hashes[i][:])
+	}
+	return append(dst, ']')
+}
+
+// AppendLog appends a log as its gencodec marshaler does
+func AppendLog(dst []byte, log *types.Log) []byte {
+	if log == nil {
+		return append(dst, "null"...)
+	}
+	dst = append(dst, `{"address":`...)
+	dst = AppendBytes(dst, log.Address[:])
+	dst = append(dst, `,"topics":`...)
+	dst = AppendHashes(dst, log.Topics)
+	dst = append(dst, `,"data":`...)
+	dst = AppendBytes(dst, log.Data)
+	dst = append(dst, `,"blockNumber":`...)
+	dst = AppendUint64(dst, log.BlockNumber)
+	dst = append(dst, `,"transactionHash":`...)
+	dst = AppendBytes(dst, log.TxHash[:])
+	dst = append(dst, `,"transactionIndex":`...)
+	dst = AppendUint64(dst, uint64(log.TxIndex))
+	dst = append(dst, `,"blockHash":`...)
+	dst = AppendBytes(dst, log.BlockHash[:])
+	dst = append(dst, `,"logIndex":`...)
+	dst = AppendUint64(dst, uint64(log.Index))
+	dst = append(dst, `,"removed":`...)
+	dst = strconv.AppendBool(dst, log.Removed)
+	return append(dst, '}')
+}
+
+// AppendLogs appends a list of logs, or null for a nil slice
+func AppendLogs(dst []byte, logs []*types.Log) []byte {
+	if logs == nil {
+		return append(dst, "null"...)
+	}
+	dst = append(dst, '[')
+	for i, log := range logs {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = AppendLog(dst, log)
+	}
+	return append(dst, ']')
+}
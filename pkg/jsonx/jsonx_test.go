@@ -0,0 +1,73 @@
+package jsonx
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestMarshalMatchesEncodingJSON(t *testing.T) {
+	hash := common.Hash{0xaa, 0x01}
+	log := &types.Log{
+		Address:     common.HexToAddress("0x000000000000000000000000000000000000dead"),
+		Topics:      []common.Hash{hash},
+		Data:        []byte{0x00, 0x01},
+		BlockNumber: 7,
+		TxHash:      hash,
+		TxIndex:     1,
+		BlockHash:   hash,
+		Index:       3,
+		Removed:     true,
+	}
+
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"nil", nil},
+		{"bool", true},
+		{"integral id", float64(42)},
+		{"negative id", float64(-7)},
+		{"fractional id", 1.5},
+		{"large id", 1e21},
+		{"string", "2.0"},
+		{"escaped string", "a\"b\\c<d>&\né"},
+		{"uint64", hexutil.Uint64(0)},
+		{"big", (*hexutil.Big)(big.NewInt(0x1234))},
+		{"zero big", (*hexutil.Big)(new(big.Int))},
+		{"nil big", (*hexutil.Big)(nil)},
+		{"bytes", hexutil.Bytes{0xde, 0xad}},
+		{"empty bytes", hexutil.Bytes{}},
+		{"hash", hash},
+		{"hash ptr", &hash},
+		{"nil hash ptr", (*common.Hash)(nil)},
+		{"address", log.Address},
+		{"hashes", []common.Hash{hash, {}}},
+		{"no hashes", []common.Hash{}},
+		{"log", log},
+		{"logs", []*types.Log{log, log}},
+		{"no logs", []*types.Log{}},
+		{"nil logs", []*types.Log(nil)},
+		{"fallback", map[string]int{"a": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := json.Marshal(tt.v)
+			if err != nil {
+				t.Fatalf("encoding/json: %v", err)
+			}
+			got, err := Marshal(tt.v)
+			if err != nil {
+				t.Fatalf("jsonx: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sunvim/evm_rpc/pkg/logger"
+)
+
+// Service is a subsystem whose lifetime is managed by a Runner.
+// Start must not block: long-running work belongs in goroutines that
+// end when Stop is called.
+type Service interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// Failer is implemented by services that can fail after a successful Start,
+// such as listeners whose Serve loop exits unexpectedly
+type Failer interface {
+	Err() <-chan error
+}
+
+// Hooks adapts plain start/stop functions to a Service
+type Hooks struct {
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+// Start calls OnStart if set
+func (h Hooks) Start(ctx context.Context) error {
+	if h.OnStart == nil {
+		return nil
+	}
+	return h.OnStart(ctx)
+}
+
+// Stop calls OnStop if set
+func (h Hooks) Stop(ctx context.Context) error {
+	if h.OnStop == nil {
+		return nil
+	}
+	return h.OnStop(ctx)
+}
+
+// entry is a named service registered with a Runner
+type entry struct {
+	name    string
+	service Service
+}
+
+// Runner starts services in registration order and stops them in reverse
+// order, so that dependencies outlive the subsystems using them
+type Runner struct {
+	mu       sync.Mutex
+	services []entry
+	started  []entry
+	errCh    chan error
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewRunner creates a new runner
+func NewRunner() *Runner {
+	return &Runner{
+		errCh: make(chan error, 1),
+		done:  make(chan struct{}),
+	}
+}
+
+// Add registers a service. Services must be added before Start.
+func (r *Runner) Add(name string, service Service) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.services = append(r.services, entry{name: name, service: service})
+}
+
+// Start starts all registered services. On failure the services started so
+// far remain running and must be shut down with Stop.
+func (r *Runner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.services {
+		logger.Debugf("Starting %s", e.name)
+		if err := e.service.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start %s: %w", e.name, err)
+		}
+		r.started = append(r.started, e)
+
+		if f, ok := e.service.(Failer); ok {
+			go r.forward(e.name, f)
+		}
+	}
+
+	return nil
+}
+
+// forward relays asynchronous service failures to the runner
+func (r *Runner) forward(name string, f Failer) {
+	select {
+	case err := <-f.Err():
+		if err == nil {
+			return
+		}
+		select {
+		case r.errCh <- fmt.Errorf("%s: %w", name, err):
+		default:
+			logger.Errorf("%s failed: %v", name, err)
+		}
+	case <-r.done:
+	}
+}
+
+// Err returns a channel receiving the first asynchronous service failure
+func (r *Runner) Err() <-chan error {
+	return r.errCh
+}
+
+// Stop stops all started services in reverse order, continuing past
+// failures, and returns the combined error
+func (r *Runner) Stop(ctx context.Context) error {
+	r.stopOnce.Do(func() { close(r.done) })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	for i := len(r.started) - 1; i >= 0; i-- {
+		e := r.started[i]
+		logger.Debugf("Stopping %s", e.name)
+		if err := e.service.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop %s: %w", e.name, err))
+		}
+	}
+	r.started = nil
+
+	return errors.Join(errs...)
+}
@@ -1,13 +1,21 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"os"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-var globalLogger *zap.SugaredLogger
+var (
+	globalLogger *zap.SugaredLogger
+	globalLevel  = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+)
+
+// ctxKey is the context key of a request's logger
+type ctxKey struct{}
 
 // InitLogger initializes the global logger
 func InitLogger(level, format, output string) error {
@@ -20,18 +28,8 @@ func InitLogger(level, format, output string) error {
 	}
 
 	// Set log level
-	switch level {
-	case "debug":
-		config.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
-	case "info":
-		config.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
-	case "warn":
-		config.Level = zap.NewAtomicLevelAt(zapcore.WarnLevel)
-	case "error":
-		config.Level = zap.NewAtomicLevelAt(zapcore.ErrorLevel)
-	default:
-		config.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
-	}
+	globalLevel.SetLevel(parseLevel(level))
+	config.Level = globalLevel
 
 	// Set output
 	if output == "stdout" {
@@ -49,6 +47,36 @@ func InitLogger(level, format, output string) error {
 	return nil
 }
 
+// SetLevel changes the level of the global logger at runtime
+func SetLevel(level string) error {
+	switch level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	globalLevel.SetLevel(parseLevel(level))
+	return nil
+}
+
+// Level returns the current level of the global logger
+func Level() string {
+	return globalLevel.Level().String()
+}
+
+// parseLevel maps a configured level to a zap level, defaulting to info
+func parseLevel(level string) zapcore.Level {
+	switch level {
+	case "debug":
+		return zapcore.DebugLevel
+	case "warn":
+		return zapcore.WarnLevel
+	case "error":
+		return zapcore.ErrorLevel
+	default:
+		return zapcore.InfoLevel
+	}
+}
+
 // Get returns the global logger
 func Get() *zap.SugaredLogger {
 	if globalLogger == nil {
@@ -116,6 +144,20 @@ func With(args ...interface{}) *zap.SugaredLogger {
 	return Get().With(args...)
 }
 
+// NewContext returns ctx carrying l, so that code handling a request logs
+// with the request's fields
+func NewContext(ctx context.Context, l *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the global logger
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	if l, ok := ctx.Value(ctxKey{}).(*zap.SugaredLogger); ok {
+		return l
+	}
+	return Get()
+}
+
 // Sync flushes any buffered log entries
 func Sync() {
 	if globalLogger != nil {
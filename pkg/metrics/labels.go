@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+// maxClientLabels bounds the distinct values of a label taken from client
+// input, such as origins and hosts
+const maxClientLabels = 100
+
+// otherLabel counts the values of a label beyond maxClientLabels
+const otherLabel = "other"
+
+// clientLabels bounds the values of a label set by clients, so that they
+// cannot create metric series at will. The first values seen keep their own
+// series; later ones are counted together.
+type clientLabels struct {
+	mu     sync.Mutex
+	values map[string]bool
+}
+
+// label returns the label of a value
+func (l *clientLabels) label(value string) string {
+	value = strings.ToLower(value)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.values[value] {
+		return value
+	}
+	if len(l.values) >= maxClientLabels {
+		return otherLabel
+	}
+	if l.values == nil {
+		l.values = make(map[string]bool)
+	}
+	l.values[value] = true
+	return value
+}
@@ -3,6 +3,7 @@ package metrics
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -14,6 +15,7 @@ import (
 type Server struct {
 	server *http.Server
 	addr   string
+	errCh  chan error
 }
 
 // NewServer creates a new metrics server
@@ -29,19 +31,32 @@ func NewServer(addr string) *Server {
 			WriteTimeout: 10 * time.Second,
 			IdleTimeout:  60 * time.Second,
 		},
-		addr: addr,
+		addr:  addr,
+		errCh: make(chan error, 1),
 	}
 }
 
-// Start starts the metrics server
-func (s *Server) Start() error {
-	logger.Infof("Starting metrics server on %s", s.addr)
-	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+// Start binds the listener and serves metrics in the background
+func (s *Server) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
 		return fmt.Errorf("metrics server failed: %w", err)
 	}
+
+	logger.Infof("Starting metrics server on %s", s.addr)
+	go func() {
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.errCh <- fmt.Errorf("metrics server failed: %w", err)
+		}
+	}()
 	return nil
 }
 
+// Err returns a channel receiving serve failures after Start
+func (s *Server) Err() <-chan error {
+	return s.errCh
+}
+
 // Stop gracefully shuts down the metrics server
 func (s *Server) Stop(ctx context.Context) error {
 	logger.Info("Stopping metrics server...")
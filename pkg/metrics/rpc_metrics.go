@@ -1,11 +1,24 @@
 package metrics
 
 import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 var (
+	// BuildInfo identifies the running build
+	BuildInfo = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "evm_rpc_build_info",
+			Help: "Build of the running service, always 1",
+		},
+		[]string{"version", "commit", "go_version"},
+	)
+
 	// RPCRequestsTotal tracks the total number of RPC requests
 	RPCRequestsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -15,6 +28,49 @@ var (
 		[]string{"method", "status"},
 	)
 
+	// RPCErrorsTotal tracks failed RPC calls by JSON-RPC error code
+	RPCErrorsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rpc_errors_total",
+			Help: "Total number of RPC calls answered with an error, by error code and class",
+		},
+		[]string{"method", "code", "class"},
+	)
+
+	// RPCParseErrors tracks request bodies that are not valid JSON
+	RPCParseErrors = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rpc_parse_errors_total",
+			Help: "Total number of requests that failed to parse as JSON",
+		},
+	)
+
+	// RPCInvalidRequests tracks requests that are not valid JSON-RPC
+	RPCInvalidRequests = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rpc_invalid_requests_total",
+			Help: "Total number of requests that are not valid JSON-RPC 2.0",
+		},
+	)
+
+	// RPCAbortedRequests tracks requests whose calls were cut short
+	RPCAbortedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rpc_aborted_requests_total",
+			Help: "Total number of requests aborted by their deadline or by the client going away",
+		},
+		[]string{"reason"}, // reason: timeout, client_gone
+	)
+
+	// RPCPanics tracks method calls that panicked
+	RPCPanics = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rpc_panics_total",
+			Help: "Total number of RPC method calls that panicked",
+		},
+		[]string{"method"},
+	)
+
 	// RPCRequestDuration tracks the duration of RPC requests
 	RPCRequestDuration = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -25,6 +81,25 @@ var (
 		[]string{"method"},
 	)
 
+	// RPCResponseSize tracks the serialized size of responses
+	RPCResponseSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "rpc_response_size_bytes",
+			Help:    "Size of serialized RPC responses in bytes",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 11), // 64B to 64MB
+		},
+		[]string{"method"},
+	)
+
+	// RPCEgressBytes tracks the bytes written to clients
+	RPCEgressBytes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rpc_egress_bytes_total",
+			Help: "Total bytes of responses and notifications written to clients",
+		},
+		[]string{"transport"},
+	)
+
 	// RPCRequestsInFlight tracks the number of in-flight RPC requests
 	RPCRequestsInFlight = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -43,6 +118,86 @@ var (
 		[]string{"type"}, // type: global, ip, method
 	)
 
+	// RPCRateLimitFactor tracks the fraction of the configured rate limits
+	// in force under adaptive rate limiting
+	RPCRateLimitFactor = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "rpc_ratelimit_factor",
+			Help: "Fraction of the configured rate limits in force, below 1 while load is shed",
+		},
+	)
+
+	// PikaLatencyP99 tracks the p99 latency adaptive rate limiting acts on
+	PikaLatencyP99 = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "pika_latency_p99_seconds",
+			Help: "p99 latency of Pika operations over the adaptive rate limiting window",
+		},
+	)
+
+	// RPCOriginRejections tracks requests from origins outside the CORS
+	// allowlist
+	RPCOriginRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rpc_origin_rejections_total",
+			Help: "Total number of requests from disallowed origins, by transport and origin",
+		},
+		[]string{"transport", "origin"}, // origins beyond the first 100 are counted as other
+	)
+
+	// RPCVHostRejections tracks HTTP requests refused for their Host header
+	RPCVHostRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rpc_vhost_rejections_total",
+			Help: "Total number of HTTP requests refused for a host outside the vhosts allowlist",
+		},
+		[]string{"host"}, // hosts beyond the first 100 are counted as other
+	)
+
+	// RPCDeniedRequests tracks requests refused for a ban of their client
+	RPCDeniedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rpc_denied_requests_total",
+			Help: "Total number of requests refused because their client is on the denylist, by ban kind",
+		},
+		[]string{"kind"}, // ip or key
+	)
+
+	// RPCAutoBans tracks clients banned for repeated rate limit violations
+	RPCAutoBans = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rpc_auto_bans_total",
+			Help: "Total number of temporary bans added after repeated rate limit violations",
+		},
+	)
+
+	// RPCQoSQueued tracks calls waiting for an execution slot
+	RPCQoSQueued = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "rpc_qos_queued",
+			Help: "Number of calls waiting for an execution slot, by priority class",
+		},
+		[]string{"class"},
+	)
+
+	// RPCQoSShed tracks calls refused because no execution slot freed up
+	RPCQoSShed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rpc_qos_shed_total",
+			Help: "Total number of calls shed while the server was saturated, by priority class",
+		},
+		[]string{"class"},
+	)
+
+	// RPCFallbackRequests tracks calls proxied to the upstream node
+	RPCFallbackRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rpc_fallback_requests_total",
+			Help: "Total number of calls proxied to the upstream node, by reason and outcome",
+		},
+		[]string{"reason", "outcome"}, // reason: unsupported or missing; outcome: ok, cached, error or unavailable
+	)
+
 	// RPCWebSocketConnections tracks the number of active WebSocket connections
 	RPCWebSocketConnections = promauto.NewGauge(
 		prometheus.GaugeOpts{
@@ -51,6 +206,14 @@ var (
 		},
 	)
 
+	// RPCEventStreams tracks open Server-Sent Event streams
+	RPCEventStreams = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "rpc_event_streams",
+			Help: "Number of open Server-Sent Event streams",
+		},
+	)
+
 	// RPCBatchRequestsTotal tracks the total number of batch requests
 	RPCBatchRequestsTotal = promauto.NewCounter(
 		prometheus.CounterOpts{
@@ -74,7 +237,7 @@ var (
 			Name: "rpc_subscriptions_active",
 			Help: "Number of active RPC subscriptions",
 		},
-		[]string{"type"}, // type: newHeads, logs, newPendingTransactions
+		[]string{"type"}, // type: newHeads, logs, newPendingTransactions, syncing
 	)
 
 	// RPCSubscriptionNotifications tracks the number of subscription notifications sent
@@ -83,19 +246,351 @@ var (
 			Name: "rpc_subscription_notifications_total",
 			Help: "Total number of subscription notifications sent",
 		},
-		[]string{"type"}, // type: newHeads, logs, newPendingTransactions
+		[]string{"type"}, // type: newHeads, logs, newPendingTransactions, syncing
+	)
+
+	// RPCSubscriptionsOrphaned counts subscriptions found still registered
+	// after their connection went away, and removed by the sweep
+	RPCSubscriptionsOrphaned = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rpc_subscriptions_orphaned_total",
+			Help: "Total number of subscriptions removed after their connection closed",
+		},
+		[]string{"type"}, // type: newHeads, logs, newPendingTransactions, syncing
+	)
+
+	// RPCSubscriptionDeliveryLag tracks how long after its block timestamp a
+	// notification is written to the client
+	RPCSubscriptionDeliveryLag = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "rpc_subscription_delivery_lag_seconds",
+			Help:    "Delay between block timestamp and notification send time",
+			Buckets: []float64{0.25, 0.5, 1, 2, 3, 5, 8, 13, 21, 34, 60, 120},
+		},
+		[]string{"type"}, // type: newHeads, logs
+	)
+
+	// RPCSubscriptionPubSubDelivery tracks how long after its blocks:new
+	// message was received from Pika a notification is written to the client
+	RPCSubscriptionPubSubDelivery = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "rpc_subscription_pubsub_delivery_seconds",
+			Help:    "Delay between receiving blocks:new from Pika and writing the notification",
+			Buckets: []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+		[]string{"type"}, // type: newHeads, logs
+	)
+
+	// WSSendQueueDepth tracks how many messages a WebSocket connection has
+	// queued when another one is added
+	WSSendQueueDepth = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "rpc_ws_send_queue_depth",
+			Help:    "Messages queued on a WebSocket connection at enqueue time",
+			Buckets: []float64{0, 1, 2, 4, 8, 16, 32, 64, 128, 256},
+		},
+	)
+
+	// WSMissedPongs tracks keepalive pings a WebSocket client did not answer
+	// in time
+	WSMissedPongs = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rpc_ws_missed_pongs_total",
+			Help: "Total number of WebSocket keepalive pings not answered within the pong timeout",
+		},
+	)
+
+	// WSKeepaliveCloses tracks WebSocket connections closed for missing
+	// consecutive pings
+	WSKeepaliveCloses = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rpc_ws_keepalive_closes_total",
+			Help: "Total number of half-open WebSocket connections closed after missed pings",
+		},
+	)
+
+	// WSDroppedMessages tracks messages dropped because a WebSocket
+	// connection's send queue was full
+	WSDroppedMessages = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rpc_ws_dropped_messages_total",
+			Help: "Total number of WebSocket messages dropped on a full send queue",
+		},
+		[]string{"kind"}, // kind: response, notification
+	)
+
+	// PikaPubSubReconnects tracks resubscriptions after a lost Pika pub/sub connection
+	PikaPubSubReconnects = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pika_pubsub_reconnects_total",
+			Help: "Total number of Pika pub/sub resubscriptions",
+		},
+		[]string{"channel"},
+	)
+
+	// RPCResponseCacheRequests tracks shared response cache lookups
+	RPCResponseCacheRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rpc_response_cache_requests_total",
+			Help: "Total number of shared response cache lookups",
+		},
+		[]string{"method", "result"}, // result: hit, miss or bypass
+	)
+
+	// PikaReplicaHealthy tracks whether read replicas are in rotation
+	PikaReplicaHealthy = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pika_replica_healthy",
+			Help: "Whether a Pika read replica is in rotation (1) or ejected (0)",
+		},
+		[]string{"addr"},
+	)
+
+	// PikaBreakerState tracks the state of the storage circuit breaker
+	PikaBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pika_circuit_breaker_state",
+			Help: "State of the Pika circuit breaker (0 closed, 1 half-open, 2 open)",
+		},
+		[]string{"target"},
+	)
+
+	// PikaBreakerRejections tracks operations failed fast by the breaker
+	PikaBreakerRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pika_circuit_breaker_rejections_total",
+			Help: "Total number of Pika operations rejected by the open circuit breaker",
+		},
+		[]string{"target"},
+	)
+
+	// PikaDegraded tracks whether Pika is considered unreachable and cached
+	// data is served read-only
+	PikaDegraded = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pika_degraded",
+			Help: "Whether Pika is unreachable and cached data is served read-only (1) or not (0)",
+		},
+		[]string{"target"},
+	)
+
+	// PikaRetries tracks retried storage reads
+	PikaRetries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pika_retries_total",
+			Help: "Total number of retried Pika reads",
+		},
+		[]string{"command"},
+	)
+
+	// IngestHeadBlock tracks the latest block written by the ingester
+	IngestHeadBlock = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ingest_head_block",
+			Help: "Latest block number written by the ingester",
+		},
+	)
+
+	// IngestReorgs tracks chain reorganizations handled by the ingester
+	IngestReorgs = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "ingest_reorg_depth",
+			Help:    "Depth of chain reorganizations handled by the ingester",
+			Buckets: []float64{1, 2, 3, 5, 10, 20, 50, 128},
+		},
+	)
+
+	// TxPoolEvictions tracks transactions dropped from the pool
+	TxPoolEvictions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "txpool_evictions_total",
+			Help: "Total number of transactions evicted from the pool",
+		},
+		[]string{"reason"},
+	)
+
+	// TxPoolRejections tracks submitted transactions that were not pooled
+	TxPoolRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "txpool_rejections_total",
+			Help: "Total number of submitted transactions rejected",
+		},
+		[]string{"reason"},
+	)
+
+	// TxPoolIdempotentReplays tracks submissions answered from their
+	// idempotency key without being validated again
+	TxPoolIdempotentReplays = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "txpool_idempotent_replays_total",
+			Help: "Total number of retried submissions answered from their idempotency key",
+		},
+	)
+
+	// TxPoolReinjected tracks transactions of reorged blocks returned to the pool
+	TxPoolReinjected = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "txpool_reorg_reinjected_total",
+			Help: "Total number of transactions of reorged blocks returned to the pool",
+		},
+	)
+
+	// TxPoolPending tracks the number of pending transactions
+	TxPoolPending = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "txpool_pending",
+			Help: "Number of transactions in the pool after the last eviction pass",
+		},
+	)
+
+	// StatePrunedBlock tracks the highest block whose historical state was pruned
+	StatePrunedBlock = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "state_pruned_block",
+			Help: "Highest block whose historical state was pruned",
+		},
+	)
+
+	// StatePrunedKeys tracks historical state keys deleted by the pruner
+	StatePrunedKeys = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "state_pruned_keys_total",
+			Help: "Total number of historical state keys deleted by the pruner",
+		},
+	)
+
+	// LogBloomSkips tracks blocks a log query skipped by their bloom
+	LogBloomSkips = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "log_bloom_skipped_blocks_total",
+			Help: "Total number of blocks whose logs were not read because their bloom ruled out the query",
+		},
+	)
+
+	// BridgeMessages tracks events mirrored into the message broker
+	BridgeMessages = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bridge_messages_total",
+			Help: "Total number of events published to the message broker",
+		},
+		[]string{"topic"},
+	)
+
+	// BridgeErrors tracks events the message broker did not accept
+	BridgeErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bridge_errors_total",
+			Help: "Total number of events that could not be published to the message broker",
+		},
+		[]string{"topic"},
+	)
+
+	// Webhooks tracks the registered webhooks
+	Webhooks = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "webhooks_registered",
+			Help: "Number of registered webhooks",
+		},
+	)
+
+	// WebhookDeliveries tracks webhook deliveries by outcome: delivered,
+	// failed after retries, or dropped from a full queue
+	WebhookDeliveries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "webhook_deliveries_total",
+			Help: "Total number of webhook deliveries by outcome",
+		},
+		[]string{"outcome"},
+	)
+
+	// WebhookDeliveryDuration tracks the time to deliver a webhook payload,
+	// retries included
+	WebhookDeliveryDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "webhook_delivery_duration_seconds",
+			Help:    "Time to deliver a webhook payload, retries included",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+		},
+		[]string{"outcome"},
+	)
+
+	// WebhookRetries tracks retried webhook delivery attempts
+	WebhookRetries = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "webhook_retries_total",
+			Help: "Total number of retried webhook delivery attempts",
+		},
+	)
+
+	// RecordedCalls tracks calls sampled by the recorder by outcome:
+	// recorded, dropped from a full queue, or failed to be written
+	RecordedCalls = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rpc_recorded_calls_total",
+			Help: "Total number of calls sampled by the recorder by outcome",
+		},
+		[]string{"outcome"},
 	)
 )
 
+// RecordBuildInfo records the build of the running service
+func RecordBuildInfo(version, commit, goVersion string) {
+	BuildInfo.WithLabelValues(version, commit, goVersion).Set(1)
+}
+
 // RecordRequest records an RPC request with status
 func RecordRequest(method, status string, duration float64) {
 	RPCRequestsTotal.WithLabelValues(method, status).Inc()
 	RPCRequestDuration.WithLabelValues(method).Observe(duration)
 }
 
+// RecordRPCError records an RPC call answered with an error
+func RecordRPCError(method string, code int, class string) {
+	RPCErrorsTotal.WithLabelValues(method, strconv.Itoa(code), class).Inc()
+}
+
+// RecordParseError records a request that failed to parse
+func RecordParseError() {
+	RPCParseErrors.Inc()
+}
+
+// RecordInvalidRequest records a request that is not valid JSON-RPC
+func RecordInvalidRequest() {
+	RPCInvalidRequests.Inc()
+}
+
+// RecordAbortedRequest records a request cut short
+func RecordAbortedRequest(reason string) {
+	RPCAbortedRequests.WithLabelValues(reason).Inc()
+}
+
+// RecordPanic records a method call that panicked
+func RecordPanic(method string) {
+	RPCPanics.WithLabelValues(method).Inc()
+}
+
+// RecordResponseSize records the serialized size of a response
+func RecordResponseSize(method string, size int) {
+	RPCResponseSize.WithLabelValues(method).Observe(float64(size))
+}
+
+// RecordEgress records bytes written to clients over a transport
+func RecordEgress(transport string, n int) {
+	RPCEgressBytes.WithLabelValues(transport).Add(float64(n))
+}
+
 // RecordInFlight records an in-flight RPC request
 func RecordInFlight(method string, delta float64) {
 	RPCRequestsInFlight.WithLabelValues(method).Add(delta)
+	inFlight.Add(int64(delta))
+}
+
+// inFlight counts the requests in flight over all methods
+var inFlight atomic.Int64
+
+// InFlight returns the number of requests in flight over all methods
+func InFlight() int64 {
+	return inFlight.Load()
 }
 
 // RecordRateLimit records a rate limit rejection
@@ -103,11 +598,64 @@ func RecordRateLimit(limitType string) {
 	RPCRateLimitRejections.WithLabelValues(limitType).Inc()
 }
 
+// RecordRateLimitFactor records the fraction of the rate limits in force
+// and the Pika latency it was derived from
+func RecordRateLimitFactor(factor float64, latencyP99 time.Duration) {
+	RPCRateLimitFactor.Set(factor)
+	PikaLatencyP99.Set(latencyP99.Seconds())
+}
+
+var (
+	originLabels clientLabels
+	vhostLabels  clientLabels
+)
+
+// RecordOriginRejection records a request from a disallowed origin
+func RecordOriginRejection(transport, origin string) {
+	RPCOriginRejections.WithLabelValues(transport, originLabels.label(origin)).Inc()
+}
+
+// RecordVHostRejection records an HTTP request refused for its host
+func RecordVHostRejection(host string) {
+	RPCVHostRejections.WithLabelValues(vhostLabels.label(host)).Inc()
+}
+
+// RecordDeniedRequest records a request refused for a ban of its client
+func RecordDeniedRequest(kind string) {
+	RPCDeniedRequests.WithLabelValues(kind).Inc()
+}
+
+// RecordAutoBan records a client banned for rate limit violations
+func RecordAutoBan() {
+	RPCAutoBans.Inc()
+}
+
+// RecordQoSQueued records a change of the calls of a priority class
+// waiting for an execution slot
+func RecordQoSQueued(class string, delta float64) {
+	RPCQoSQueued.WithLabelValues(class).Add(delta)
+}
+
+// RecordQoSShed records a call of a priority class shed under load
+func RecordQoSShed(class string) {
+	RPCQoSShed.WithLabelValues(class).Inc()
+}
+
+// RecordFallback records a call proxied to the upstream node
+func RecordFallback(reason, outcome string) {
+	RPCFallbackRequests.WithLabelValues(reason, outcome).Inc()
+}
+
 // RecordWebSocketConnection records a WebSocket connection change
 func RecordWebSocketConnection(delta float64) {
 	RPCWebSocketConnections.Add(delta)
 }
 
+// RecordEventStream records an event stream change
+func RecordEventStream(delta float64) {
+	RPCEventStreams.Add(delta)
+}
+
 // RecordBatchRequest records a batch request
 func RecordBatchRequest(size int) {
 	RPCBatchRequestsTotal.Inc()
@@ -123,3 +671,177 @@ func RecordSubscription(subType string, delta float64) {
 func RecordNotification(subType string) {
 	RPCSubscriptionNotifications.WithLabelValues(subType).Inc()
 }
+
+// RecordOrphanedSubscription records a subscription outliving its
+// connection
+func RecordOrphanedSubscription(subType string) {
+	RPCSubscriptionsOrphaned.WithLabelValues(subType).Inc()
+}
+
+// RecordDeliveryLag records how late a block notification was sent
+func RecordDeliveryLag(subType string, lag time.Duration) {
+	RPCSubscriptionDeliveryLag.WithLabelValues(subType).Observe(lag.Seconds())
+}
+
+// RecordPubSubDelivery records how long after its blocks:new message a
+// notification was written
+func RecordPubSubDelivery(subType string, delay time.Duration) {
+	RPCSubscriptionPubSubDelivery.WithLabelValues(subType).Observe(delay.Seconds())
+}
+
+// RecordSendQueueDepth records the send queue length of a WebSocket connection
+func RecordSendQueueDepth(depth int) {
+	WSSendQueueDepth.Observe(float64(depth))
+}
+
+// RecordMissedPong records a keepalive ping not answered in time
+func RecordMissedPong() {
+	WSMissedPongs.Inc()
+}
+
+// RecordKeepaliveClose records a connection closed after missed pings
+func RecordKeepaliveClose() {
+	WSKeepaliveCloses.Inc()
+}
+
+// RecordDroppedMessage records a message dropped on a full send queue
+func RecordDroppedMessage(kind string) {
+	WSDroppedMessages.WithLabelValues(kind).Inc()
+}
+
+// RecordPubSubReconnect records a Pika pub/sub resubscription
+func RecordPubSubReconnect(channel string) {
+	PikaPubSubReconnects.WithLabelValues(channel).Inc()
+}
+
+// RecordResponseCache records a shared response cache lookup
+func RecordResponseCache(method string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	RPCResponseCacheRequests.WithLabelValues(method, result).Inc()
+}
+
+// RecordResponseCacheBypass records a call of a cacheable method that
+// skipped the shared response cache, as it addresses a moving block
+func RecordResponseCacheBypass(method string) {
+	RPCResponseCacheRequests.WithLabelValues(method, "bypass").Inc()
+}
+
+// RecordReplicaHealth records whether a read replica is in rotation
+func RecordReplicaHealth(addr string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	PikaReplicaHealthy.WithLabelValues(addr).Set(value)
+}
+
+// RecordBreakerState records a circuit breaker state change
+func RecordBreakerState(target string, state int) {
+	PikaBreakerState.WithLabelValues(target).Set(float64(state))
+}
+
+// RecordStorageDegraded records entering or leaving degraded mode
+func RecordStorageDegraded(target string, degraded bool) {
+	value := 0.0
+	if degraded {
+		value = 1
+	}
+	PikaDegraded.WithLabelValues(target).Set(value)
+}
+
+// RecordBreakerRejection records an operation rejected by the breaker
+func RecordBreakerRejection(target string) {
+	PikaBreakerRejections.WithLabelValues(target).Inc()
+}
+
+// RecordRetry records a retried storage read
+func RecordRetry(command string) {
+	PikaRetries.WithLabelValues(command).Inc()
+}
+
+// RecordIngestedBlock records a block written by the ingester
+func RecordIngestedBlock(number uint64) {
+	IngestHeadBlock.Set(float64(number))
+}
+
+// RecordIngestReorg records a chain reorganization handled by the ingester
+func RecordIngestReorg(depth uint64) {
+	IngestReorgs.Observe(float64(depth))
+}
+
+// RecordPrunedBlock records the new pruning horizon
+func RecordPrunedBlock(number uint64) {
+	StatePrunedBlock.Set(float64(number))
+}
+
+// RecordPrunedKeys records historical state keys deleted by the pruner
+func RecordPrunedKeys(n int) {
+	StatePrunedKeys.Add(float64(n))
+}
+
+// RecordBloomSkips records blocks a log query skipped by their bloom
+func RecordBloomSkips(n int) {
+	LogBloomSkips.Add(float64(n))
+}
+
+// RecordPoolEviction records a transaction evicted from the pool
+func RecordPoolEviction(reason string) {
+	TxPoolEvictions.WithLabelValues(reason).Inc()
+}
+
+// RecordTxRejection records a submitted transaction that was rejected
+func RecordTxRejection(reason string) {
+	TxPoolRejections.WithLabelValues(reason).Inc()
+}
+
+// RecordIdempotentReplay records a retried submission answered from its
+// idempotency key
+func RecordIdempotentReplay() {
+	TxPoolIdempotentReplays.Inc()
+}
+
+// RecordReorgReinjected records transactions returned to the pool after a reorg
+func RecordReorgReinjected(n int) {
+	TxPoolReinjected.Add(float64(n))
+}
+
+// RecordPoolSize records the number of pending transactions
+func RecordPoolSize(n int) {
+	TxPoolPending.Set(float64(n))
+}
+
+// RecordBridgeMessage records an event published to the message broker
+func RecordBridgeMessage(topic string, err error) {
+	if err != nil {
+		BridgeErrors.WithLabelValues(topic).Inc()
+		return
+	}
+	BridgeMessages.WithLabelValues(topic).Inc()
+}
+
+// RecordWebhooks records the number of registered webhooks
+func RecordWebhooks(n int) {
+	Webhooks.Set(float64(n))
+}
+
+// RecordWebhookDelivery records the outcome of a webhook delivery. Dropped
+// deliveries were never attempted, so their duration is not observed.
+func RecordWebhookDelivery(outcome string, duration time.Duration) {
+	WebhookDeliveries.WithLabelValues(outcome).Inc()
+	if outcome != "dropped" {
+		WebhookDeliveryDuration.WithLabelValues(outcome).Observe(duration.Seconds())
+	}
+}
+
+// RecordWebhookRetry records a retried webhook delivery attempt
+func RecordWebhookRetry() {
+	WebhookRetries.Inc()
+}
+
+// RecordRecordedCall records the outcome of a call sampled by the recorder
+func RecordRecordedCall(outcome string) {
+	RecordedCalls.WithLabelValues(outcome).Inc()
+}
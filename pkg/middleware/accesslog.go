@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// AccessLog writes a JSON line per RPC call to a sink of its own. Calls are
+// sampled per method to keep the volume manageable.
+type AccessLog struct {
+	*MethodSampler
+	log   *zap.Logger
+	close func()
+}
+
+// AccessLogEntry describes a finished RPC call
+type AccessLogEntry struct {
+	Method     string
+	Params     []byte
+	ClientIP   string
+	Duration   time.Duration
+	ResultSize int
+	ErrorCode  int // 0 on success
+}
+
+// NewAccessLog opens the access log sink
+func NewAccessLog(cfg config.AccessLogConfig) (*AccessLog, error) {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "time"
+	encoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	encoderConfig.LevelKey = zapcore.OmitKey
+	encoderConfig.CallerKey = zapcore.OmitKey
+	encoderConfig.MessageKey = zapcore.OmitKey
+
+	sink, closeSink, err := zap.Open(cfg.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccessLog{
+		MethodSampler: NewMethodSampler(cfg.SampleRate, cfg.Methods),
+		log:           zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), sink, zapcore.InfoLevel)),
+		close:         closeSink,
+	}, nil
+}
+
+// MethodSampler samples calls at a rate set per method
+type MethodSampler struct {
+	sampleRate float64
+	methods    map[string]float64 // by lower-cased method name
+}
+
+// NewMethodSampler creates a sampler of calls at sampleRate, or at the rate
+// methods sets for their method
+func NewMethodSampler(sampleRate float64, methods map[string]float64) *MethodSampler {
+	// Viper lower-cases map keys, so methods are matched case-insensitively
+	rates := make(map[string]float64, len(methods))
+	for method, rate := range methods {
+		rates[strings.ToLower(method)] = rate
+	}
+	return &MethodSampler{sampleRate: sampleRate, methods: rates}
+}
+
+// Sampled decides whether a call of method is sampled
+func (s *MethodSampler) Sampled(method string) bool {
+	rate, ok := s.methods[strings.ToLower(method)]
+	if !ok {
+		rate = s.sampleRate
+	}
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// Record writes the line of a call
+func (a *AccessLog) Record(ctx context.Context, entry AccessLogEntry) {
+	fields := []zap.Field{
+		zap.String("method", entry.Method),
+		zap.String("params_hash", paramsHash(entry.Params)),
+		zap.String("client_ip", entry.ClientIP),
+		zap.Float64("duration_ms", float64(entry.Duration)/float64(time.Millisecond)),
+		zap.Int("result_size", entry.ResultSize),
+	}
+	if id := RequestIDFromContext(ctx); id != "" {
+		fields = append(fields, zap.String("request_id", id))
+	}
+	if entry.ErrorCode != 0 {
+		fields = append(fields, zap.Int("error_code", entry.ErrorCode))
+	}
+	a.log.Info("", fields...)
+}
+
+// Close flushes and closes the sink. Syncing fails harmlessly for stdout.
+func (a *AccessLog) Close() {
+	a.log.Sync()
+	a.close()
+}
+
+// paramsHash identifies the params of a call without logging them, so
+// that repeated calls can be grouped
+func paramsHash(params []byte) string {
+	if len(params) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(params)
+	return hex.EncodeToString(sum[:8])
+}
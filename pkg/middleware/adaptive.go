@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+const (
+	// adaptiveStep is the fraction of the configured limits restored at
+	// every interval without overload
+	adaptiveStep = 0.1
+
+	// minLatencySamples is the number of Pika operations below which the
+	// measured latency is too noisy to act on
+	minLatencySamples = 20
+)
+
+// AdaptiveLimiter sheds load by tightening the limits of a rate limiter
+// while Pika is slow or too many calls are in flight. At every interval
+// with either threshold crossed the limits are halved, down to the minimum
+// factor; at every other interval a tenth of the configured limits is
+// restored.
+type AdaptiveLimiter struct {
+	limiter *RateLimiter
+	cfg     config.AdaptiveLimitConfig
+	factor  float64 // only used by the adjusting goroutine
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewAdaptiveLimiter creates an adaptive limiter adjusting limiter
+func NewAdaptiveLimiter(limiter *RateLimiter, cfg config.AdaptiveLimitConfig) *AdaptiveLimiter {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &AdaptiveLimiter{
+		limiter: limiter,
+		cfg:     cfg,
+		factor:  1,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start starts adjusting the limits in the background
+func (a *AdaptiveLimiter) Start(ctx context.Context) error {
+	metrics.RecordRateLimitFactor(a.factor, 0)
+
+	a.wg.Add(1)
+	go a.run()
+	return nil
+}
+
+// Stop stops adjusting the limits and restores them
+func (a *AdaptiveLimiter) Stop(ctx context.Context) error {
+	a.cancel()
+	a.wg.Wait()
+	a.limiter.SetFactor(1)
+	return nil
+}
+
+// run adjusts the limits at every interval
+func (a *AdaptiveLimiter) run() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			a.adjust()
+		}
+	}
+}
+
+// adjust tightens or relaxes the limits according to the current load
+func (a *AdaptiveLimiter) adjust() {
+	latency, samples := storage.Latency(0.99, a.cfg.Window)
+	inFlight := metrics.InFlight()
+
+	slow := a.cfg.LatencyP99 > 0 && samples >= minLatencySamples && latency > a.cfg.LatencyP99
+	busy := a.cfg.MaxInFlight > 0 && inFlight > int64(a.cfg.MaxInFlight)
+
+	factor := a.factor
+	if slow || busy {
+		factor = max(a.cfg.MinFactor, factor/2)
+	} else {
+		factor = min(1, factor+adaptiveStep)
+	}
+	metrics.RecordRateLimitFactor(factor, latency)
+	if factor == a.factor {
+		return
+	}
+
+	if factor < a.factor {
+		logger.Warnf("Tightening rate limits to %.0f%%: pika p99=%v, in flight=%d", factor*100, latency, inFlight)
+	} else {
+		logger.Infof("Relaxing rate limits to %.0f%%: pika p99=%v, in flight=%d", factor*100, latency, inFlight)
+	}
+	a.factor = factor
+	a.limiter.SetFactor(factor)
+}
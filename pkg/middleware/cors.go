@@ -2,12 +2,57 @@ package middleware
 
 import (
 	"net/http"
+	"sync/atomic"
 
 	"github.com/rs/cors"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
 )
 
+// BlockHeightHeader pins the latest block of the calls of a request to a
+// height
+const BlockHeightHeader = "X-Block-Height"
+
+// CORS applies the allowed origins to HTTP requests. The origins can be
+// replaced at runtime.
+type CORS struct {
+	cors    atomic.Pointer[cors.Cors]
+	origins atomic.Pointer[[]string]
+}
+
 // NewCORS creates a new CORS middleware
-func NewCORS(allowedOrigins []string) *cors.Cors {
+func NewCORS(allowedOrigins []string) *CORS {
+	c := &CORS{}
+	c.SetOrigins(allowedOrigins)
+	return c
+}
+
+// SetOrigins replaces the allowed origins
+func (c *CORS) SetOrigins(allowedOrigins []string) {
+	origins := append([]string(nil), allowedOrigins...)
+	c.origins.Store(&origins)
+	c.cors.Store(newCORS(origins))
+}
+
+// Origins returns the allowed origins as configured
+func (c *CORS) Origins() []string {
+	return *c.origins.Load()
+}
+
+// Handler wraps h with the current CORS policy. Requests from disallowed
+// origins are still served, without CORS headers, so that browsers hide the
+// response; they are counted per origin.
+func (c *CORS) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := c.cors.Load()
+		if origin := r.Header.Get("Origin"); origin != "" && !policy.OriginAllowed(r) {
+			metrics.RecordOriginRejection("http", origin)
+		}
+		policy.ServeHTTP(w, r, h.ServeHTTP)
+	})
+}
+
+// newCORS creates the CORS policy for a set of origins
+func newCORS(allowedOrigins []string) *cors.Cors {
 	if len(allowedOrigins) == 0 {
 		allowedOrigins = []string{"*"}
 	}
@@ -25,9 +70,14 @@ func NewCORS(allowedOrigins []string) *cors.Cors {
 			"Content-Length",
 			"Accept-Encoding",
 			"Authorization",
+			RequestIDHeader,
+			APIKeyHeader,
+			BlockHeightHeader,
+			IdempotencyKeyHeader,
 		},
 		ExposedHeaders: []string{
 			"Content-Length",
+			RequestIDHeader,
 		},
 		AllowCredentials: true,
 		MaxAge:           86400, // 24 hours
@@ -0,0 +1,401 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// APIKeyHeader carries the API key identifying a client, if it has one
+const APIKeyHeader = "X-API-Key"
+
+// ErrInvalidBan is returned for bans of malformed clients
+var ErrInvalidBan = errors.New("invalid ban")
+
+// apiKeyKey is the context key of the API key
+type apiKeyKey struct{}
+
+// APIKey returns the API key sent with a request, empty if there is none
+func APIKey(r *http.Request) string {
+	return r.Header.Get(APIKeyHeader)
+}
+
+// WithAPIKey returns ctx carrying the API key of a client
+func WithAPIKey(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, apiKeyKey{}, key)
+}
+
+// APIKeyFromContext returns the API key of ctx, empty if there is none
+func APIKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(apiKeyKey{}).(string)
+	return key
+}
+
+// clientIPKey is the context key of the client IP
+type clientIPKey struct{}
+
+// WithClientIP returns ctx carrying the IP address of a client
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	if ip == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the client IP of ctx, empty if there is none
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// ClientIdentity identifies the client of ctx by its API key, or by its IP
+// address if it has none
+func ClientIdentity(ctx context.Context) string {
+	if key := APIKeyFromContext(ctx); key != "" {
+		return "key:" + key
+	}
+	return "ip:" + ClientIPFromContext(ctx)
+}
+
+// Denylist refuses requests of banned clients, identified by IP address,
+// CIDR range or API key. Bans live in Pika; every replica serves from a
+// copy reloaded when a ban changes and at a fixed interval, so lookups
+// never wait for storage.
+type Denylist struct {
+	client *storage.PikaClient
+	store  *storage.DenylistStore
+	cfg    config.DenylistConfig
+	bans   atomic.Pointer[banSet]
+
+	// reloadMu serializes reloads, so that an older copy never replaces a
+	// newer one
+	reloadMu sync.Mutex
+
+	// mu guards violations, the recent rate limit rejections per IP
+	mu         sync.Mutex
+	violations map[string][]time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// banSet is a copy of the denylist indexed for lookups
+type banSet struct {
+	ips   map[string]*storage.Ban
+	nets  []netBan
+	keys  map[string]*storage.Ban
+	count int
+}
+
+// netBan is the ban of a CIDR range
+type netBan struct {
+	network *net.IPNet
+	ban     *storage.Ban
+}
+
+// NewDenylist creates a denylist backed by client
+func NewDenylist(cfg config.DenylistConfig, client *storage.PikaClient) *Denylist {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Denylist{
+		client:     client,
+		store:      storage.NewDenylistStore(client),
+		cfg:        cfg,
+		violations: make(map[string][]time.Time),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	d.bans.Store(newBanSet(nil))
+	return d
+}
+
+// Start loads the bans, then keeps them up to date in the background. The
+// service starts without bans if Pika is unreachable.
+func (d *Denylist) Start(ctx context.Context) error {
+	if err := d.reload(ctx); err != nil {
+		logger.Warnf("Failed to load denylist: %v", err)
+	}
+
+	d.wg.Add(2)
+	go func() {
+		defer d.wg.Done()
+		reload := func() {
+			if err := d.reload(d.ctx); err != nil {
+				logger.Warnf("Failed to reload denylist: %v", err)
+			}
+		}
+		d.client.Listen(d.ctx, storage.DenylistChannel, reload, func(string) { reload() })
+	}()
+	go d.refresh()
+	return nil
+}
+
+// Stop stops updating the bans
+func (d *Denylist) Stop(ctx context.Context) error {
+	d.cancel()
+	d.wg.Wait()
+	return nil
+}
+
+// refresh reloads the bans at the refresh interval, which picks up changes
+// whose notification was missed and drops expired bans
+func (d *Denylist) refresh() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.reload(d.ctx); err != nil {
+				logger.Warnf("Failed to reload denylist: %v", err)
+			}
+			d.pruneViolations()
+		}
+	}
+}
+
+// reload replaces the copy of the bans with the ones stored in Pika
+func (d *Denylist) reload(ctx context.Context) error {
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+
+	bans, err := d.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	d.bans.Store(newBanSet(bans))
+	return nil
+}
+
+// newBanSet indexes bans for lookups
+func newBanSet(bans []*storage.Ban) *banSet {
+	set := &banSet{
+		ips:   make(map[string]*storage.Ban),
+		keys:  make(map[string]*storage.Ban),
+		count: len(bans),
+	}
+	for _, ban := range bans {
+		switch ban.Kind {
+		case storage.BanKindKey:
+			set.keys[ban.Value] = ban
+		case storage.BanKindIP:
+			if _, network, err := net.ParseCIDR(ban.Value); err == nil {
+				set.nets = append(set.nets, netBan{network: network, ban: ban})
+			} else {
+				set.ips[ban.Value] = ban
+			}
+		}
+	}
+	return set
+}
+
+// Banned returns the ban of a client, nil if it is not banned. ip is the
+// address a request came from, with or without a port, or a forwarded-for
+// list whose first entry is the client. Refused requests are counted.
+func (d *Denylist) Banned(ip, key string) *storage.Ban {
+	set := d.bans.Load()
+	if set.count == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if key != "" {
+		if ban := set.keys[key]; ban != nil && !ban.Expired(now) {
+			metrics.RecordDeniedRequest(storage.BanKindKey)
+			return ban
+		}
+	}
+
+	addr := clientAddr(ip)
+	if addr == nil {
+		return nil
+	}
+	if ban := set.ips[addr.String()]; ban != nil && !ban.Expired(now) {
+		metrics.RecordDeniedRequest(storage.BanKindIP)
+		return ban
+	}
+	for _, n := range set.nets {
+		if n.network.Contains(addr) && !n.ban.Expired(now) {
+			metrics.RecordDeniedRequest(storage.BanKindIP)
+			return n.ban
+		}
+	}
+	return nil
+}
+
+// clientAddr parses the client address of ip, nil if it is not an address
+func clientAddr(ip string) net.IP {
+	ip, _, _ = strings.Cut(ip, ",")
+	ip = strings.TrimSpace(ip)
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return net.ParseIP(ip)
+}
+
+// Ban bans a client for duration, or permanently if duration is 0
+func (d *Denylist) Ban(ctx context.Context, kind, value, reason string, duration time.Duration) (*storage.Ban, error) {
+	value, err := banValue(kind, value)
+	if err != nil {
+		return nil, err
+	}
+	return d.add(ctx, &storage.Ban{
+		Kind:   kind,
+		Value:  value,
+		Reason: reason,
+	}, duration)
+}
+
+// add stores a ban and applies it locally right away
+func (d *Denylist) add(ctx context.Context, ban *storage.Ban, duration time.Duration) (*storage.Ban, error) {
+	now := time.Now()
+	ban.CreatedAt = now.Unix()
+	if duration > 0 {
+		ban.ExpiresAt = now.Add(duration).Unix()
+	}
+	if err := d.store.Add(ctx, ban); err != nil {
+		return nil, err
+	}
+	if err := d.reload(ctx); err != nil {
+		logger.Warnf("Failed to reload denylist: %v", err)
+	}
+	return ban, nil
+}
+
+// Unban lifts the ban of a client and reports whether there was one
+func (d *Denylist) Unban(ctx context.Context, kind, value string) (bool, error) {
+	value, err := banValue(kind, value)
+	if err != nil {
+		return false, err
+	}
+	removed, err := d.store.Remove(ctx, kind, value)
+	if err != nil || !removed {
+		return false, err
+	}
+	if err := d.reload(ctx); err != nil {
+		logger.Warnf("Failed to reload denylist: %v", err)
+	}
+	return true, nil
+}
+
+// Bans returns the bans in force
+func (d *Denylist) Bans(ctx context.Context) ([]*storage.Ban, error) {
+	return d.store.List(ctx)
+}
+
+// banValue returns the canonical form of the banned value, so that a ban is
+// found however the address was written
+func banValue(kind, value string) (string, error) {
+	switch kind {
+	case storage.BanKindKey:
+		if value == "" {
+			return "", fmt.Errorf("%w: empty API key", ErrInvalidBan)
+		}
+		return value, nil
+	case storage.BanKindIP:
+		if ip := net.ParseIP(value); ip != nil {
+			return ip.String(), nil
+		}
+		if _, network, err := net.ParseCIDR(value); err == nil {
+			return network.String(), nil
+		}
+		return "", fmt.Errorf("%w: not an IP address or CIDR range: %q", ErrInvalidBan, value)
+	default:
+		return "", fmt.Errorf("%w: unknown kind %q", ErrInvalidBan, kind)
+	}
+}
+
+// RecordViolation counts a request of ip rejected by the per-IP rate limit
+// and bans ip temporarily once it exceeds the auto-ban threshold
+func (d *Denylist) RecordViolation(ip string) {
+	if !d.cfg.AutoBan.Enabled {
+		return
+	}
+	addr := clientAddr(ip)
+	if addr == nil {
+		return
+	}
+	key := addr.String()
+
+	now := time.Now()
+	d.mu.Lock()
+	recent := trimViolations(d.violations[key], now.Add(-d.cfg.AutoBan.Window))
+	recent = append(recent, now)
+	if len(recent) < d.cfg.AutoBan.Violations {
+		d.violations[key] = recent
+		d.mu.Unlock()
+		return
+	}
+	delete(d.violations, key)
+	d.mu.Unlock()
+
+	// Storing the ban must not hold up the rejected request
+	go func() {
+		ctx, cancel := context.WithTimeout(d.ctx, 5*time.Second)
+		defer cancel()
+
+		reason := fmt.Sprintf("%d rate limit violations within %v", d.cfg.AutoBan.Violations, d.cfg.AutoBan.Window)
+		ban := &storage.Ban{Kind: storage.BanKindIP, Value: key, Reason: reason, Automatic: true}
+		if _, err := d.add(ctx, ban, d.cfg.AutoBan.Duration); err != nil {
+			logger.Errorf("Failed to ban %s: %v", key, err)
+			return
+		}
+		metrics.RecordAutoBan()
+		logger.Warnf("Banned %s for %v after %s", key, d.cfg.AutoBan.Duration, reason)
+	}()
+}
+
+// trimViolations drops the violations before since
+func trimViolations(violations []time.Time, since time.Time) []time.Time {
+	i := 0
+	for i < len(violations) && violations[i].Before(since) {
+		i++
+	}
+	return violations[i:]
+}
+
+// pruneViolations forgets clients without recent violations
+func (d *Denylist) pruneViolations() {
+	since := time.Now().Add(-d.cfg.AutoBan.Window)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for ip, violations := range d.violations {
+		if recent := trimViolations(violations, since); len(recent) == 0 {
+			delete(d.violations, ip)
+		} else {
+			d.violations[ip] = recent
+		}
+	}
+}
+
+// Middleware refuses requests of banned clients with 403
+func (d *Denylist) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if d.Banned(extractIP(r), APIKey(r)) != nil {
+				http.Error(w, "client is banned", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// IdempotencyKeyHeader carries the idempotency key of the transaction
+// submitted by a request
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+type idempotencyKeyKey struct{}
+
+// IdempotencyKey returns the idempotency key sent with a request, empty if
+// there is none
+func IdempotencyKey(r *http.Request) string {
+	return r.Header.Get(IdempotencyKeyHeader)
+}
+
+// WithIdempotencyKey returns a context carrying the idempotency key of a
+// request
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, idempotencyKeyKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns the idempotency key of the request, empty
+// if there is none
+func IdempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyKey{}).(string)
+	return key
+}
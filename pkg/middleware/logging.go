@@ -6,6 +6,7 @@ import (
 
 	"github.com/sunvim/evm_rpc/pkg/logger"
 	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"go.uber.org/zap"
 )
 
 // LoggingMiddleware logs HTTP requests
@@ -34,6 +35,12 @@ func newResponseWriter(w http.ResponseWriter) *responseWriter {
 	}
 }
 
+// Unwrap returns the wrapped writer, so that streaming responses can be
+// flushed through http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (rw *responseWriter) WriteHeader(code int) {
 	if !rw.written {
 		rw.statusCode = code
@@ -49,18 +56,19 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return rw.ResponseWriter.Write(b)
 }
 
-// Middleware creates an HTTP middleware for logging
+// Middleware creates an HTTP middleware writing an access log line per
+// request, with the fields of the request's logger
 func (lm *LoggingMiddleware) Middleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
+			log := logger.FromContext(r.Context())
 
 			// Wrap response writer to capture status code
 			wrapped := newResponseWriter(w)
 
 			// Log incoming request
-			logger.Debugf("Incoming request: method=%s, path=%s, remote=%s",
-				r.Method, r.URL.Path, r.RemoteAddr)
+			log.Debugw("Incoming request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
 
 			// Process request
 			next.ServeHTTP(wrapped, r)
@@ -69,36 +77,40 @@ func (lm *LoggingMiddleware) Middleware() func(http.Handler) http.Handler {
 			duration := time.Since(start)
 
 			// Log response
-			logger.Infof("Request completed: method=%s, path=%s, status=%d, duration=%v",
-				r.Method, r.URL.Path, wrapped.statusCode, duration)
+			log.Infow("Request completed",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"remote", r.RemoteAddr,
+				"status", wrapped.statusCode,
+				"duration", duration,
+			)
 
 			// Log slow queries
 			if duration > lm.slowQueryThreshold {
-				logger.Warnf("Slow query detected: method=%s, path=%s, duration=%v",
-					r.Method, r.URL.Path, duration)
+				log.Warnw("Slow query detected", "method", r.Method, "path", r.URL.Path, "duration", duration)
 			}
 		})
 	}
 }
 
 // LogRPCRequest logs an RPC request with method and params
-func LogRPCRequest(method string, params interface{}) {
-	logger.Debugf("RPC request: method=%s, params=%v", method, params)
+func LogRPCRequest(log *zap.SugaredLogger, method string, params interface{}) {
+	log.Debugf("RPC request: method=%s, params=%s", method, params)
 }
 
 // LogRPCResponse logs an RPC response with duration
-func LogRPCResponse(method string, duration time.Duration, err error) {
+func LogRPCResponse(log *zap.SugaredLogger, method string, duration time.Duration, err error) {
 	if err != nil {
-		logger.Warnf("RPC response: method=%s, duration=%v, error=%v", method, duration, err)
+		log.Warnf("RPC response: method=%s, duration=%v, error=%v", method, duration, err)
 	} else {
-		logger.Debugf("RPC response: method=%s, duration=%v", method, duration)
+		log.Debugf("RPC response: method=%s, duration=%v", method, duration)
 	}
 }
 
 // LogSlowRPCRequest logs a slow RPC request
-func LogSlowRPCRequest(method string, duration time.Duration, threshold time.Duration) {
+func LogSlowRPCRequest(log *zap.SugaredLogger, method string, duration time.Duration, threshold time.Duration) {
 	if duration > threshold {
-		logger.Warnf("Slow RPC request: method=%s, duration=%v, threshold=%v",
+		log.Warnf("Slow RPC request: method=%s, duration=%v, threshold=%v",
 			method, duration, threshold)
 	}
 }
@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+)
+
+// Priority is the class of a call under load, lower values more urgent
+type Priority int
+
+const (
+	// PriorityCritical calls, such as subscriptions and health probes, are
+	// never held back
+	PriorityCritical Priority = iota
+
+	// PriorityNormal calls wait for a slot ahead of best-effort ones
+	PriorityNormal
+
+	// PriorityBestEffort calls, such as traces, are shed first
+	PriorityBestEffort
+
+	numPriorities
+)
+
+var priorityNames = [numPriorities]string{"critical", "normal", "best_effort"}
+
+// String returns the name of the class as configured
+func (p Priority) String() string {
+	return priorityNames[p]
+}
+
+// ErrShed is returned for calls shed while the server is saturated
+var ErrShed = errors.New("server busy")
+
+// QoS bounds the calls executing at once. Once saturated, calls queue by
+// priority and are shed when no slot frees up within the queue timeout. A
+// full queue makes room for a call by evicting a less urgent one.
+type QoS struct {
+	methods       map[string]Priority // by lowercased method or namespace
+	keys          map[string]Priority
+	maxConcurrent int
+	maxQueued     int
+	queueTimeout  time.Duration
+
+	mu      sync.Mutex
+	running int
+	queued  int
+	waiters [numPriorities]list.List // of *qosWaiter; critical calls never wait
+}
+
+// qosWaiter is a call waiting for a slot
+type qosWaiter struct {
+	priority Priority
+	ready    chan bool // receives whether the call got a slot or was evicted
+	dequeued bool      // guarded by QoS.mu
+}
+
+// NewQoS creates a scheduler from the configured classes
+func NewQoS(cfg config.QoSConfig) *QoS {
+	q := &QoS{
+		methods:       make(map[string]Priority),
+		keys:          make(map[string]Priority),
+		maxConcurrent: cfg.MaxConcurrent,
+		maxQueued:     cfg.MaxQueued,
+		queueTimeout:  cfg.QueueTimeout,
+	}
+	for p, name := range priorityNames {
+		for _, method := range cfg.Methods[name] {
+			q.methods[strings.ToLower(method)] = Priority(p)
+		}
+		for _, key := range cfg.Keys[name] {
+			q.keys[key] = Priority(p)
+		}
+	}
+	return q
+}
+
+// Classify returns the priority of a call. The class of the API key takes
+// precedence over the class of the method, then of its namespace; other
+// calls are normal.
+func (q *QoS) Classify(method, apiKey string) Priority {
+	if p, ok := q.keys[apiKey]; ok && apiKey != "" {
+		return p
+	}
+	method = strings.ToLower(method)
+	if p, ok := q.methods[method]; ok {
+		return p
+	}
+	if namespace, _, ok := strings.Cut(method, "_"); ok {
+		if p, ok := q.methods[namespace]; ok {
+			return p
+		}
+	}
+	return PriorityNormal
+}
+
+// Acquire waits for a slot to execute a call of priority and returns the
+// function releasing it. It fails with ErrShed if the call is shed, or with
+// the error of ctx if that is done first.
+func (q *QoS) Acquire(ctx context.Context, priority Priority) (func(), error) {
+	q.mu.Lock()
+	// Slots are handed to waiters as they free up, so there are none
+	// waiting while a slot is free
+	if priority == PriorityCritical || q.running < q.maxConcurrent {
+		q.running++
+		q.mu.Unlock()
+		return q.release, nil
+	}
+	if q.queued >= q.maxQueued && !q.evict(priority) {
+		q.mu.Unlock()
+		metrics.RecordQoSShed(priority.String())
+		return nil, ErrShed
+	}
+	w := &qosWaiter{priority: priority, ready: make(chan bool, 1)}
+	elem := q.waiters[priority].PushBack(w)
+	q.queued++
+	q.mu.Unlock()
+	metrics.RecordQoSQueued(priority.String(), 1)
+
+	timer := time.NewTimer(q.queueTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case granted := <-w.ready:
+		return q.admitted(w, granted)
+	case <-timer.C:
+		err = ErrShed
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	if w.dequeued {
+		// Given a slot or evicted while timing out
+		q.mu.Unlock()
+		return q.admitted(w, <-w.ready)
+	}
+	q.remove(w, elem)
+	q.mu.Unlock()
+	if err == ErrShed {
+		metrics.RecordQoSShed(priority.String())
+	}
+	return nil, err
+}
+
+// admitted returns the outcome of a call taken off the queue
+func (q *QoS) admitted(w *qosWaiter, granted bool) (func(), error) {
+	if !granted {
+		metrics.RecordQoSShed(w.priority.String())
+		return nil, ErrShed
+	}
+	return q.release, nil
+}
+
+// evict makes room in the full queue for a call of priority by shedding
+// the latest call of the least urgent class below it. It must be called
+// with mu held.
+func (q *QoS) evict(priority Priority) bool {
+	for p := numPriorities - 1; p > priority; p-- {
+		if elem := q.waiters[p].Back(); elem != nil {
+			w := elem.Value.(*qosWaiter)
+			q.remove(w, elem)
+			w.ready <- false
+			return true
+		}
+	}
+	return false
+}
+
+// release frees a slot, handing it to the most urgent waiting call
+func (q *QoS) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.running--
+	if q.running >= q.maxConcurrent {
+		return
+	}
+	for p := range q.waiters {
+		if elem := q.waiters[p].Front(); elem != nil {
+			w := elem.Value.(*qosWaiter)
+			q.remove(w, elem)
+			q.running++
+			w.ready <- true
+			return
+		}
+	}
+}
+
+// remove takes a call off the queue. It must be called with mu held.
+func (q *QoS) remove(w *qosWaiter, elem *list.Element) {
+	q.waiters[w.priority].Remove(elem)
+	w.dequeued = true
+	q.queued--
+	metrics.RecordQoSQueued(w.priority.String(), -1)
+}
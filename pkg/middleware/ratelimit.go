@@ -1,8 +1,13 @@
 package middleware
 
 import (
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -10,11 +15,27 @@ import (
 	"github.com/sunvim/evm_rpc/pkg/metrics"
 )
 
-// RateLimiter manages rate limiting for RPC requests
+// RateLimiter manages rate limiting for RPC requests. Its limits can be
+// replaced at runtime without blocking requests in flight.
 type RateLimiter struct {
+	limits atomic.Pointer[rateLimits]
+
+	// factor scales every limit, the bits of a float64 below 1 while
+	// adaptive rate limiting sheds load
+	factor atomic.Uint64
+
+	// onViolation is called with the IP of requests rejected by the
+	// per-IP limit
+	onViolation func(ip string)
+}
+
+// rateLimits is one generation of limits with its own token buckets
+type rateLimits struct {
 	global       *rate.Limiter
-	ipLimiters   sync.Map // map[string]*rate.Limiter
-	methodLimits map[string]int
+	ipLimiters   sync.Map       // map[string]*rate.Limiter
+	methodLimits map[string]int // by lowercased method, as config keys are
+	globalRate   int
+	globalBurst  int
 	ipRate       int
 	ipBurst      int
 	enabled      bool
@@ -22,69 +43,166 @@ type RateLimiter struct {
 
 // NewRateLimiter creates a new rate limiter
 func NewRateLimiter(enabled bool, globalRate, globalBurst, ipRate, ipBurst int, methodLimits map[string]int) *RateLimiter {
+	rl := &RateLimiter{}
+	rl.factor.Store(math.Float64bits(1))
+	rl.Update(enabled, globalRate, globalBurst, ipRate, ipBurst, methodLimits)
+	return rl
+}
+
+// Update replaces the limits. Clients start over with full buckets.
+func (rl *RateLimiter) Update(enabled bool, globalRate, globalBurst, ipRate, ipBurst int, methodLimits map[string]int) {
+	factor := rl.loadFactor()
 	var global *rate.Limiter
 	if globalRate > 0 {
-		global = rate.NewLimiter(rate.Limit(globalRate), globalBurst)
+		global = newLimiter(globalRate, globalBurst, factor)
+	}
+
+	// Config keys are lowercased, so methods are looked up the same way
+	lowered := make(map[string]int, len(methodLimits))
+	for method, limit := range methodLimits {
+		lowered[strings.ToLower(method)] = limit
 	}
 
-	return &RateLimiter{
+	rl.limits.Store(&rateLimits{
 		global:       global,
-		ipLimiters:   sync.Map{},
-		methodLimits: methodLimits,
+		methodLimits: lowered,
+		globalRate:   globalRate,
+		globalBurst:  globalBurst,
 		ipRate:       ipRate,
 		ipBurst:      ipBurst,
 		enabled:      enabled,
+	})
+}
+
+// loadFactor returns the factor scaling the limits
+func (rl *RateLimiter) loadFactor() float64 {
+	return math.Float64frombits(rl.factor.Load())
+}
+
+// SetFactor scales every limit to factor times the configured one, 1
+// restoring them. Clients keep the tokens they have.
+func (rl *RateLimiter) SetFactor(factor float64) {
+	rl.factor.Store(math.Float64bits(factor))
+
+	l := rl.limits.Load()
+	if l.global != nil {
+		scaleLimiter(l.global, l.globalRate, l.globalBurst, factor)
+	}
+	l.ipLimiters.Range(func(key, limiter any) bool {
+		limit, burst := l.ipRate, l.ipBurst
+		if method, ok := strings.CutPrefix(key.(string), "method:"); ok {
+			limit, burst = l.methodLimits[method], l.methodLimits[method]
+		}
+		scaleLimiter(limiter.(*rate.Limiter), limit, burst, factor)
+		return true
+	})
+}
+
+// newLimiter creates a token bucket for factor times limit requests per
+// second and burst
+func newLimiter(limit, burst int, factor float64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(float64(limit)*factor), scaledBurst(burst, factor))
+}
+
+// scaleLimiter sets a token bucket to factor times limit and burst
+func scaleLimiter(limiter *rate.Limiter, limit, burst int, factor float64) {
+	limiter.SetLimit(rate.Limit(float64(limit) * factor))
+	limiter.SetBurst(scaledBurst(burst, factor))
+}
+
+// scaledBurst returns factor times burst, at least one request
+func scaledBurst(burst int, factor float64) int {
+	return max(1, int(float64(burst)*factor))
+}
+
+// retryAfter returns how long until limiter admits a request
+func retryAfter(limiter *rate.Limiter) time.Duration {
+	now := time.Now()
+	reservation := limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return time.Second
+	}
+	delay := reservation.DelayFrom(now)
+	reservation.CancelAt(now)
+	return delay
+}
+
+// RetryAfterSeconds rounds a retry delay up to the whole seconds of a
+// Retry-After header, at least one
+func RetryAfterSeconds(delay time.Duration) int {
+	return max(1, int(math.Ceil(delay.Seconds())))
+}
+
+// OnViolation registers fn to be called with the IP of every request
+// rejected by the per-IP limit. Global and method limits are shared by all
+// clients, so their rejections are not held against one. It must be called
+// before serving.
+func (rl *RateLimiter) OnViolation(fn func(ip string)) {
+	rl.onViolation = fn
+}
+
+// violation reports a request of ip rejected by the per-IP limit
+func (rl *RateLimiter) violation(ip string) {
+	if rl.onViolation != nil {
+		rl.onViolation(ip)
 	}
 }
 
 // getIPLimiter returns or creates a rate limiter for an IP address
-func (rl *RateLimiter) getIPLimiter(ip string) *rate.Limiter {
-	if rl.ipRate <= 0 {
+func (l *rateLimits) getIPLimiter(ip string, factor float64) *rate.Limiter {
+	if l.ipRate <= 0 {
 		return nil
 	}
 
-	limiter, ok := rl.ipLimiters.Load(ip)
+	limiter, ok := l.ipLimiters.Load(ip)
 	if !ok {
-		limiter = rate.NewLimiter(rate.Limit(rl.ipRate), rl.ipBurst)
-		rl.ipLimiters.Store(ip, limiter)
+		limiter, _ = l.ipLimiters.LoadOrStore(ip, newLimiter(l.ipRate, l.ipBurst, factor))
 	}
 	return limiter.(*rate.Limiter)
 }
 
-// Allow checks if a request should be allowed based on rate limits
-func (rl *RateLimiter) Allow(ip, method string) (bool, string) {
-	if !rl.enabled {
-		return true, ""
+// Allow checks if a request should be allowed based on rate limits. A
+// refused request gets the limit it exceeded and how long until it would
+// be admitted.
+func (rl *RateLimiter) Allow(ip, method string) (bool, string, time.Duration) {
+	l := rl.limits.Load()
+	if !l.enabled {
+		return true, "", 0
 	}
+	factor := rl.loadFactor()
 
 	// Check global rate limit
-	if rl.global != nil && !rl.global.Allow() {
+	if l.global != nil && !l.global.Allow() {
 		metrics.RecordRateLimit("global")
 		logger.Warnf("Global rate limit exceeded for IP %s, method %s", ip, method)
-		return false, "global"
+		return false, "global", retryAfter(l.global)
 	}
 
 	// Check IP-based rate limit
-	if ipLimiter := rl.getIPLimiter(ip); ipLimiter != nil && !ipLimiter.Allow() {
+	if ipLimiter := l.getIPLimiter(ip, factor); ipLimiter != nil && !ipLimiter.Allow() {
 		metrics.RecordRateLimit("ip")
 		logger.Warnf("IP rate limit exceeded for IP %s, method %s", ip, method)
-		return false, "ip"
+		rl.violation(ip)
+		return false, "ip", retryAfter(ipLimiter)
 	}
 
 	// Check method-based rate limit
-	if methodRate, ok := rl.methodLimits[method]; ok && methodRate > 0 {
+	if methodRate, ok := l.methodLimits[strings.ToLower(method)]; ok && methodRate > 0 {
 		// For method-based limits, we use a per-method limiter
 		// This is a simplified approach; in production, you might want per-IP-per-method limiters
-		key := "method:" + method
-		limiter, _ := rl.ipLimiters.LoadOrStore(key, rate.NewLimiter(rate.Limit(methodRate), methodRate))
+		key := "method:" + strings.ToLower(method)
+		limiter, ok := l.ipLimiters.Load(key)
+		if !ok {
+			limiter, _ = l.ipLimiters.LoadOrStore(key, newLimiter(methodRate, methodRate, factor))
+		}
 		if !limiter.(*rate.Limiter).Allow() {
 			metrics.RecordRateLimit("method")
 			logger.Warnf("Method rate limit exceeded for IP %s, method %s", ip, method)
-			return false, "method"
+			return false, "method", retryAfter(limiter.(*rate.Limiter))
 		}
 	}
 
-	return true, ""
+	return true, "", 0
 }
 
 // Cleanup removes old IP limiters (should be called periodically)
@@ -97,7 +215,8 @@ func (rl *RateLimiter) Cleanup(maxAge time.Duration) {
 func (rl *RateLimiter) Middleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !rl.enabled {
+			l := rl.limits.Load()
+			if !l.enabled {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -107,15 +226,16 @@ func (rl *RateLimiter) Middleware() func(http.Handler) http.Handler {
 
 			// For middleware, we check global and IP limits only
 			// Method-specific limits are checked in the handler
-			if rl.global != nil && !rl.global.Allow() {
+			if l.global != nil && !l.global.Allow() {
 				metrics.RecordRateLimit("global")
-				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				tooManyRequests(w, retryAfter(l.global))
 				return
 			}
 
-			if ipLimiter := rl.getIPLimiter(ip); ipLimiter != nil && !ipLimiter.Allow() {
+			if ipLimiter := l.getIPLimiter(ip, rl.loadFactor()); ipLimiter != nil && !ipLimiter.Allow() {
 				metrics.RecordRateLimit("ip")
-				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				rl.violation(ip)
+				tooManyRequests(w, retryAfter(ipLimiter))
 				return
 			}
 
@@ -124,6 +244,13 @@ func (rl *RateLimiter) Middleware() func(http.Handler) http.Handler {
 	}
 }
 
+// tooManyRequests refuses a request with 429, telling the client when to
+// retry
+func tooManyRequests(w http.ResponseWriter, delay time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(RetryAfterSeconds(delay)))
+	http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+}
+
 // extractIP extracts the client IP address from the request
 func extractIP(r *http.Request) string {
 	// Try X-Forwarded-For header first
@@ -138,6 +265,10 @@ func extractIP(r *http.Request) string {
 		return ip
 	}
 
-	// Fall back to RemoteAddr
+	// Fall back to RemoteAddr, without the port so that all connections of
+	// a client share its limits
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
 	return r.RemoteAddr
 }
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+)
+
+// VirtualHosts refuses HTTP requests whose Host header is not in vhosts
+// with 403, as geth's --http.vhosts does. This stops DNS rebinding attacks,
+// which CORS alone does not. "*" allows every host. Requests without a
+// host or addressed by IP are always allowed, so an empty list only
+// accepts those.
+func VirtualHosts(vhosts []string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(vhosts))
+	for _, vhost := range vhosts {
+		allowed[strings.ToLower(vhost)] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		if allowed["*"] {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Host == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			host, _, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				// Without a port
+				host = strings.Trim(r.Host, "[]")
+			}
+			if net.ParseIP(host) != nil || allowed[strings.ToLower(host)] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			metrics.RecordVHostRejection(host)
+			http.Error(w, "invalid host specified", http.StatusForbidden)
+		})
+	}
+}
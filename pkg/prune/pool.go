@@ -0,0 +1,179 @@
+package prune
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// defaultEvictInterval is how often the pool is checked for evictions
+const defaultEvictInterval = time.Minute
+
+// PoolEvictor keeps the transaction pool in Pika bounded, dropping expired
+// transactions, transactions whose nonce was already used, and the
+// cheapest transactions of full accounts or a full pool
+type PoolEvictor struct {
+	cfg         config.TxPoolConfig
+	txPool      *storage.TxPoolStorage
+	stateReader *storage.StateReader
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPoolEvictor creates a pool evictor
+func NewPoolEvictor(cfg config.TxPoolConfig, txPool *storage.TxPoolStorage, stateReader *storage.StateReader) *PoolEvictor {
+	if cfg.EvictInterval <= 0 {
+		cfg.EvictInterval = defaultEvictInterval
+	}
+	return &PoolEvictor{
+		cfg:         cfg,
+		txPool:      txPool,
+		stateReader: stateReader,
+	}
+}
+
+// Start starts evicting in the background
+func (e *PoolEvictor) Start(ctx context.Context) error {
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	e.wg.Add(1)
+	go e.run()
+	return nil
+}
+
+// Stop stops evicting and waits for the current pass to finish
+func (e *PoolEvictor) Stop(ctx context.Context) error {
+	if e.cancel == nil {
+		return nil
+	}
+	e.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *PoolEvictor) run() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.cfg.EvictInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.evict(); err != nil && e.ctx.Err() == nil {
+				logger.Warnf("Transaction pool eviction failed: %v", err)
+			}
+		}
+	}
+}
+
+// evict runs one eviction pass
+func (e *PoolEvictor) evict() error {
+	if e.cfg.Lifetime > 0 {
+		expired, err := e.txPool.ExpiredTxs(e.ctx, time.Now().Add(-e.cfg.Lifetime))
+		if err != nil {
+			return err
+		}
+		if err := e.drop(expired, storage.DropExpired); err != nil {
+			return err
+		}
+	}
+
+	txs, err := e.txPool.GetPendingTransactions(e.ctx)
+	if err != nil {
+		return err
+	}
+
+	// Group by sender, dropping transactions whose nonce is already used
+	bySender := make(map[common.Address]types.Transactions)
+	var stale []common.Hash
+	nonces := make(map[common.Address]uint64)
+	for _, tx := range txs {
+		from, err := e.txPool.Sender(tx)
+		if err != nil {
+			continue
+		}
+		nonce, ok := nonces[from]
+		if !ok {
+			if nonce, err = e.stateReader.GetNonce(e.ctx, from, "latest"); err != nil {
+				return err
+			}
+			nonces[from] = nonce
+		}
+		if tx.Nonce() < nonce {
+			stale = append(stale, tx.Hash())
+			continue
+		}
+		bySender[from] = append(bySender[from], tx)
+	}
+	if err := e.drop(stale, storage.DropStale); err != nil {
+		return err
+	}
+
+	// Trim accounts over the limit, keeping their lowest nonces
+	maxTxs, maxPerAccount := e.txPool.Limits()
+	pending := 0
+	for _, senderTxs := range bySender {
+		if maxPerAccount > 0 && len(senderTxs) > maxPerAccount {
+			sort.Sort(types.TxByNonce(senderTxs))
+			var excess []common.Hash
+			for _, tx := range senderTxs[maxPerAccount:] {
+				excess = append(excess, tx.Hash())
+			}
+			if err := e.drop(excess, storage.DropAccountLimit); err != nil {
+				return err
+			}
+			senderTxs = senderTxs[:maxPerAccount]
+		}
+		pending += len(senderTxs)
+	}
+
+	// Trim the pool to its cap, cheapest first
+	if maxTxs > 0 && pending > maxTxs {
+		cheapest, err := e.txPool.CheapestTxs(e.ctx, pending-maxTxs)
+		if err != nil {
+			return err
+		}
+		if err := e.drop(cheapest, storage.DropUnderpriced); err != nil {
+			return err
+		}
+		pending = maxTxs
+	}
+
+	metrics.RecordPoolSize(pending)
+	return nil
+}
+
+// drop evicts transactions for a reason
+func (e *PoolEvictor) drop(hashes []common.Hash, reason string) error {
+	for _, hash := range hashes {
+		if err := e.txPool.DropTx(e.ctx, hash, reason); err != nil {
+			return err
+		}
+	}
+	if len(hashes) > 0 {
+		logger.Infof("Evicted %d transactions from the pool (%s)", len(hashes), reason)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package prune
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// defaultRetention matches the historical state window kept by writers
+	defaultRetention = 1024
+
+	// defaultInterval is how often the pruner checks for prunable blocks
+	defaultInterval = time.Minute
+
+	// defaultBatchSize is the number of keys deleted per round trip
+	defaultBatchSize = 1000
+
+	// blocksPerStep bounds how far the pruning horizon moves ahead of
+	// deletions, limiting what is left behind if the pruner stops midway
+	blocksPerStep = 100
+)
+
+// Pruner deletes historical state older than the retention window. The
+// pruning horizon is advanced before keys are deleted, so readers reject
+// pruned blocks instead of seeing partially deleted state.
+type Pruner struct {
+	cfg         config.PruningConfig
+	blockReader *storage.BlockReader
+	stateReader *storage.StateReader
+	stateWriter *storage.StateWriter
+	limiter     *rate.Limiter
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPruner creates a state pruner. pikaClient must be the primary, since
+// the pruner reads back the horizon it writes.
+func NewPruner(cfg config.PruningConfig, pikaClient *storage.PikaClient, blockReader *storage.BlockReader) *Pruner {
+	if cfg.Retention == 0 {
+		cfg.Retention = defaultRetention
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, cfg.BatchSize)
+	if cfg.KeysPerSecond > 0 {
+		limiter = rate.NewLimiter(rate.Limit(cfg.KeysPerSecond), max(cfg.KeysPerSecond, cfg.BatchSize))
+	}
+
+	return &Pruner{
+		cfg:         cfg,
+		blockReader: blockReader,
+		stateReader: storage.NewStateReader(pikaClient),
+		stateWriter: storage.NewStateWriter(pikaClient),
+		limiter:     limiter,
+	}
+}
+
+// Start starts pruning in the background
+func (p *Pruner) Start(ctx context.Context) error {
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.wg.Add(1)
+	go p.run()
+
+	logger.Infof("State pruner started, keeping %d blocks of historical state", p.cfg.Retention)
+	return nil
+}
+
+// Stop stops pruning and waits for the current batch to finish
+func (p *Pruner) Stop(ctx context.Context) error {
+	if p.cancel == nil {
+		return nil
+	}
+	p.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run prunes on every tick, sweeping the keyspace on the first run and
+// every sweep interval after that
+func (p *Pruner) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	var lastSweep time.Time
+	for {
+		sweep := lastSweep.IsZero() || (p.cfg.SweepInterval > 0 && time.Since(lastSweep) >= p.cfg.SweepInterval)
+		if err := p.prune(sweep); err != nil {
+			if p.ctx.Err() != nil {
+				return
+			}
+			logger.Warnf("State pruning failed: %v", err)
+		} else if sweep {
+			lastSweep = time.Now()
+		}
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prune deletes historical state of blocks that fell out of the retention
+// window. A sweep also removes state that was written without an index.
+func (p *Pruner) prune(sweep bool) error {
+	latest, err := p.blockReader.GetLatestBlockNumber(p.ctx)
+	if err == storage.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if latest <= p.cfg.Retention {
+		return nil
+	}
+	target := latest - p.cfg.Retention
+
+	pruned, err := p.stateReader.GetPrunedBlock(p.ctx)
+	switch {
+	case err == storage.ErrNotFound:
+		// Nothing is known about older state, so only a sweep can find it
+		if err := p.stateWriter.SetPrunedBlock(p.ctx, target); err != nil {
+			return err
+		}
+		metrics.RecordPrunedBlock(target)
+		return p.sweep(target)
+	case err != nil:
+		return err
+	}
+
+	for next := pruned + 1; next <= target; {
+		end := min(next+blocksPerStep-1, target)
+		if err := p.stateWriter.SetPrunedBlock(p.ctx, end); err != nil {
+			return err
+		}
+		metrics.RecordPrunedBlock(end)
+
+		for number := next; number <= end; number++ {
+			keys, err := p.stateWriter.HistoricalStateKeys(p.ctx, number)
+			if err != nil {
+				return err
+			}
+			if err := p.delete(keys); err != nil {
+				return err
+			}
+		}
+		next = end + 1
+	}
+
+	if sweep {
+		return p.sweep(target)
+	}
+	return nil
+}
+
+// sweep scans the keyspace for historical state up to target
+func (p *Pruner) sweep(target uint64) error {
+	logger.Infof("Sweeping historical state up to block %d", target)
+	return p.stateWriter.SweepHistoricalState(p.ctx, target, int64(p.cfg.BatchSize), p.delete)
+}
+
+// delete removes keys in rate limited batches
+func (p *Pruner) delete(keys []string) error {
+	for start := 0; start < len(keys); start += p.cfg.BatchSize {
+		batch := keys[start:min(start+p.cfg.BatchSize, len(keys))]
+		if err := p.limiter.WaitN(p.ctx, len(batch)); err != nil {
+			return err
+		}
+		if err := p.stateWriter.DeleteStateKeys(p.ctx, batch); err != nil {
+			return err
+		}
+		metrics.RecordPrunedKeys(len(batch))
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/middleware"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// Call is a served call to record
+type Call struct {
+	Method string
+	Params json.RawMessage
+	Result json.RawMessage // encoded result, nil on error
+	Error  *api.RPCError
+	Height *uint64 // latest block the call was served at, if known
+}
+
+// pendingCall is a call waiting in the queue of the recorder
+type pendingCall struct {
+	Call
+	time      time.Time
+	requestID string
+}
+
+// Recorder writes sampled calls with their responses to a file or to Pika.
+// Calls are queued and written in the background, so that serving never
+// waits on the recorder; calls arriving while the queue is full are
+// dropped.
+type Recorder struct {
+	*middleware.MethodSampler
+	maxResultSize int
+	write         func(ctx context.Context, rec *Recording, data []byte) error
+	close         func() error
+	queue         chan pendingCall
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRecorder creates a recorder writing to the file cfg.Output, or to
+// Pika through client if cfg.Output is pika
+func NewRecorder(cfg config.RecorderConfig, client *storage.PikaClient) (*Recorder, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Recorder{
+		MethodSampler: middleware.NewMethodSampler(cfg.SampleRate, cfg.Methods),
+		maxResultSize: cfg.MaxResultSize,
+		close:         func() error { return nil },
+		queue:         make(chan pendingCall, cfg.QueueSize),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+
+	if cfg.Output == config.RecorderOutputPika {
+		store := storage.NewRecordingStore(client)
+		r.write = func(ctx context.Context, rec *Recording, data []byte) error {
+			return store.Add(ctx, rec.Time, data, cfg.TTL)
+		}
+		return r, nil
+	}
+
+	// Recordings may reveal what clients query, so the file is private
+	file, err := os.OpenFile(cfg.Output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	r.write = func(ctx context.Context, rec *Recording, data []byte) error {
+		_, err := file.Write(append(data, '\n'))
+		return err
+	}
+	r.close = file.Close
+	return r, nil
+}
+
+// Start writes queued calls in the background
+func (r *Recorder) Start(ctx context.Context) error {
+	r.wg.Add(1)
+	go r.run()
+	return nil
+}
+
+// Stop writes the calls still queued and closes the output
+func (r *Recorder) Stop(ctx context.Context) error {
+	r.cancel()
+	r.wg.Wait()
+	return r.close()
+}
+
+// Record queues a call for writing, dropping it if the queue is full
+func (r *Recorder) Record(ctx context.Context, call Call) {
+	pending := pendingCall{Call: call, time: time.Now(), requestID: middleware.RequestIDFromContext(ctx)}
+	select {
+	case r.queue <- pending:
+	default:
+		metrics.RecordRecordedCall("dropped")
+	}
+}
+
+func (r *Recorder) run() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case call := <-r.queue:
+			r.writeCall(call)
+		case <-r.ctx.Done():
+			// Write what is queued, so that a file holds the last calls
+			// before a shutdown
+			for {
+				select {
+				case call := <-r.queue:
+					r.writeCall(call)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeCall writes the recording of a call
+func (r *Recorder) writeCall(call pendingCall) {
+	rec, err := r.recording(call)
+	if err == nil {
+		var data []byte
+		if data, err = json.Marshal(rec); err == nil {
+			// Writes still in flight at shutdown may complete
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err = r.write(ctx, rec, data)
+			cancel()
+		}
+	}
+	if err != nil {
+		logger.Warnf("Failed to record %s call: %v", call.Method, err)
+		metrics.RecordRecordedCall("failed")
+		return
+	}
+	metrics.RecordRecordedCall("recorded")
+}
+
+// recording sanitizes a call into its recording
+func (r *Recorder) recording(call pendingCall) (*Recording, error) {
+	rec := &Recording{
+		Time:      call.time.UTC(),
+		RequestID: call.requestID,
+		Height:    call.Height,
+		Method:    call.Method,
+		Error:     call.Error,
+	}
+	rec.Params, rec.Redacted = sanitize(call.Method, call.Params)
+	if call.Error != nil {
+		return rec, nil
+	}
+
+	hash, err := resultHash(call.Result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid result: %w", err)
+	}
+	rec.ResultHash = hash
+	if len(call.Result) <= r.maxResultSize {
+		rec.Result = call.Result
+	}
+	return rec, nil
+}
@@ -0,0 +1,93 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+func recordCalls(t *testing.T, cfg config.RecorderConfig, client *storage.PikaClient, calls ...Call) {
+	t.Helper()
+	recorder, err := NewRecorder(cfg, client)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	if err := recorder.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	for _, call := range calls {
+		recorder.Record(context.Background(), call)
+	}
+	if err := recorder.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+}
+
+func TestRecorderFile(t *testing.T) {
+	height := uint64(16)
+	path := filepath.Join(t.TempDir(), "calls.jsonl")
+	recordCalls(t, config.RecorderConfig{Output: path, SampleRate: 1, MaxResultSize: 16, QueueSize: 10}, nil,
+		Call{Method: "personal_sign", Params: json.RawMessage(`["0x01","0x02","hunter2"]`), Result: json.RawMessage(`"0xsig"`)},
+		Call{Method: "eth_getBalance", Params: json.RawMessage(`["0x02","latest"]`), Result: json.RawMessage(`"0x1bc16d674ec80000"`), Height: &height},
+		Call{Method: "eth_call", Error: &api.RPCError{Code: 3, Message: "execution reverted"}},
+	)
+
+	recordings, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if len(recordings) != 3 {
+		t.Fatalf("got %d recordings, want 3", len(recordings))
+	}
+
+	signed := recordings[0]
+	if !signed.Redacted || signed.Replayable() || string(signed.Params) != `["0x01","0x02","[redacted]"]` {
+		t.Fatalf("personal_sign recorded as %+v", signed)
+	}
+
+	// The balance is larger than max_result_size, so only its hash is kept
+	balance := recordings[1]
+	want, _ := resultHash(json.RawMessage(`"0x1bc16d674ec80000"`))
+	if balance.Result != nil || balance.ResultHash != want || balance.Height == nil || *balance.Height != height {
+		t.Fatalf("eth_getBalance recorded as %+v", balance)
+	}
+	if !balance.Replayable() {
+		t.Fatal("eth_getBalance is not replayable")
+	}
+
+	reverted := recordings[2]
+	if reverted.Error == nil || reverted.Error.Code != 3 || reverted.ResultHash != "" {
+		t.Fatalf("eth_call recorded as %+v", reverted)
+	}
+}
+
+func TestRecorderPika(t *testing.T) {
+	client, err := storage.NewPikaClient(config.PikaConfig{Mode: config.PikaModeMemory})
+	if err != nil {
+		t.Fatalf("NewPikaClient: %v", err)
+	}
+	defer client.Close()
+
+	cfg := config.RecorderConfig{Output: config.RecorderOutputPika, SampleRate: 1, TTL: time.Hour, MaxResultSize: 1024, QueueSize: 10}
+	recordCalls(t, cfg, client,
+		Call{Method: "eth_blockNumber", Result: json.RawMessage(`"0x10"`)},
+		Call{Method: "eth_chainId", Result: json.RawMessage(`"0x1"`)},
+	)
+
+	recordings, err := ReadStore(context.Background(), storage.NewRecordingStore(client))
+	if err != nil {
+		t.Fatalf("ReadStore: %v", err)
+	}
+	if len(recordings) != 2 || recordings[0].Method != "eth_blockNumber" || recordings[1].Method != "eth_chainId" {
+		t.Fatalf("recordings = %+v", recordings)
+	}
+	if string(recordings[1].Result) != `"0x1"` {
+		t.Fatalf("eth_chainId result = %s", recordings[1].Result)
+	}
+}
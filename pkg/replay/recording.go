@@ -0,0 +1,162 @@
+// Package replay records served calls with their responses and
+// re-executes them against a running service, to diagnose discrepancies
+// reported by clients and to catch regressions between builds
+package replay
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// Recording is a call with the response it got. Clients are not recorded,
+// and params holding secrets are redacted.
+type Recording struct {
+	Time       time.Time       `json:"time"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Height     *uint64         `json:"height,omitempty"` // latest block when the call was served
+	Method     string          `json:"method"`
+	Params     json.RawMessage `json:"params,omitempty"`
+	Redacted   bool            `json:"redacted,omitempty"`    // params were redacted, so the call cannot be replayed
+	Result     json.RawMessage `json:"result,omitempty"`      // left out if larger than recorder.max_result_size
+	ResultHash string          `json:"result_hash,omitempty"` // of the result in canonical form
+	Error      *api.RPCError   `json:"error,omitempty"`
+}
+
+// redacted replaces secret params
+var redacted = json.RawMessage(`"[redacted]"`)
+
+// secretParams are the positions of the params holding secrets, by method
+var secretParams = map[string][]int{
+	"personal_sendTransaction": {1},
+	"personal_sign":            {2},
+}
+
+// statefulMethods are the prefixes of methods whose calls change state or
+// depend on the session that made them, so that replaying them is unsafe
+// or meaningless
+var statefulMethods = []string{
+	"eth_send",
+	"personal_send",
+	"eth_new",
+	"eth_getFilter",
+	"eth_uninstallFilter",
+	"eth_subscribe",
+	"eth_unsubscribe",
+	"txpool_",
+	"admin_",
+}
+
+// Replayable reports whether a recorded call may be re-executed
+func (r *Recording) Replayable() bool {
+	if r.Redacted {
+		return false
+	}
+	for _, prefix := range statefulMethods {
+		if strings.HasPrefix(r.Method, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// sanitize returns the params of a call of method with secrets redacted,
+// and whether any were
+func sanitize(method string, params json.RawMessage) (json.RawMessage, bool) {
+	positions, ok := secretParams[method]
+	if !ok || len(params) == 0 {
+		return params, false
+	}
+	var values []json.RawMessage
+	if err := json.Unmarshal(params, &values); err != nil {
+		// Params that are not positional are dropped altogether
+		return nil, true
+	}
+	for _, i := range positions {
+		if i < len(values) {
+			values[i] = redacted
+		}
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, true
+	}
+	return data, true
+}
+
+// canonicalJSON re-encodes a JSON value with sorted object keys and without
+// insignificant whitespace, so that equal values encode alike. A missing
+// value is null.
+func canonicalJSON(data json.RawMessage) ([]byte, error) {
+	if len(data) == 0 {
+		return []byte("null"), nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// resultHash hashes a result in canonical form
+func resultHash(result json.RawMessage) (string, error) {
+	canonical, err := canonicalJSON(result)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ReadFile reads the recordings of a file written by the recorder
+func ReadFile(path string) ([]*Recording, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var recordings []*Recording
+	dec := json.NewDecoder(file)
+	for {
+		var rec Recording
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			return recordings, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode recording %d: %w", len(recordings)+1, err)
+		}
+		recordings = append(recordings, &rec)
+	}
+}
+
+// ReadStore reads the recordings kept in Pika
+func ReadStore(ctx context.Context, store *storage.RecordingStore) ([]*Recording, error) {
+	values, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	recordings := make([]*Recording, len(values))
+	for i, data := range values {
+		var rec Recording
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("failed to decode recording: %w", err)
+		}
+		recordings[i] = &rec
+	}
+	return recordings, nil
+}
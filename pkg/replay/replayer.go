@@ -0,0 +1,174 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/middleware"
+)
+
+// maxResponseSize bounds the responses read while replaying
+const maxResponseSize = 64 << 20
+
+// Outcome is the result of replaying a recording
+type Outcome string
+
+// Outcomes of a replay
+const (
+	OutcomeMatch    Outcome = "match"    // the response equals the recorded one
+	OutcomeMismatch Outcome = "mismatch" // the response differs from the recorded one
+	OutcomeSkipped  Outcome = "skipped"  // the call is not replayable
+	OutcomeFailed   Outcome = "failed"   // the call could not be made
+)
+
+// Result is the outcome of replaying a recording
+type Result struct {
+	Recording *Recording
+	Outcome   Outcome
+	Detail    string          // how the response differs, or why the call failed
+	Response  json.RawMessage // result of the replayed call
+	Error     *api.RPCError   // error of the replayed call
+}
+
+// Report counts the outcomes of a replay
+type Report struct {
+	Matched    int
+	Mismatched int
+	Skipped    int
+	Failed     int
+}
+
+// Replayer re-executes recorded calls against an endpoint and compares the
+// responses with the recorded ones
+type Replayer struct {
+	url    string
+	pin    bool
+	client *http.Client
+}
+
+// NewReplayer creates a replayer calling the JSON-RPC endpoint at url.
+// With pin set, every call is pinned with the X-Block-Height header to the
+// height it was recorded at, so that latest reads the same blocks.
+func NewReplayer(url string, pin bool, timeout time.Duration) *Replayer {
+	return &Replayer{url: url, pin: pin, client: &http.Client{Timeout: timeout}}
+}
+
+// Replay replays recordings in order, calling fn with the result of each,
+// and reports the outcomes. It stops early if ctx is done.
+func (p *Replayer) Replay(ctx context.Context, recordings []*Recording, fn func(*Result)) (Report, error) {
+	var report Report
+	for _, rec := range recordings {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		result := p.replay(ctx, rec)
+		switch result.Outcome {
+		case OutcomeMatch:
+			report.Matched++
+		case OutcomeMismatch:
+			report.Mismatched++
+		case OutcomeSkipped:
+			report.Skipped++
+		case OutcomeFailed:
+			report.Failed++
+		}
+		if fn != nil {
+			fn(result)
+		}
+	}
+	return report, nil
+}
+
+// replay replays a single recording
+func (p *Replayer) replay(ctx context.Context, rec *Recording) *Result {
+	result := &Result{Recording: rec}
+	if !rec.Replayable() {
+		result.Outcome = OutcomeSkipped
+		return result
+	}
+
+	var err error
+	result.Response, result.Error, err = p.call(ctx, rec)
+	if err != nil {
+		result.Outcome, result.Detail = OutcomeFailed, err.Error()
+		return result
+	}
+	result.Outcome, result.Detail = compare(rec, result.Response, result.Error)
+	return result
+}
+
+// call makes a recorded call and returns its result or error
+func (p *Replayer) call(ctx context.Context, rec *Recording) (json.RawMessage, *api.RPCError, error) {
+	params := rec.Params
+	if len(params) == 0 {
+		params = json.RawMessage("[]")
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  rec.Method,
+		"params":  params,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.pin && rec.Height != nil {
+		req.Header.Set(middleware.BlockHeightHeader, strconv.FormatUint(*rec.Height, 10))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *api.RPCError   `json:"error"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, nil, fmt.Errorf("invalid response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	return response.Result, response.Error, nil
+}
+
+// compare compares a response with the recorded one
+func compare(rec *Recording, result json.RawMessage, rpcErr *api.RPCError) (Outcome, string) {
+	switch {
+	case rec.Error != nil && rpcErr != nil:
+		if rec.Error.Code != rpcErr.Code || rec.Error.Message != rpcErr.Message {
+			return OutcomeMismatch, fmt.Sprintf("error %d %q, recorded error %d %q", rpcErr.Code, rpcErr.Message, rec.Error.Code, rec.Error.Message)
+		}
+		return OutcomeMatch, ""
+	case rec.Error != nil:
+		return OutcomeMismatch, fmt.Sprintf("result, recorded error %d %q", rec.Error.Code, rec.Error.Message)
+	case rpcErr != nil:
+		return OutcomeMismatch, fmt.Sprintf("error %d %q, recorded a result", rpcErr.Code, rpcErr.Message)
+	}
+
+	hash, err := resultHash(result)
+	if err != nil {
+		return OutcomeMismatch, fmt.Sprintf("invalid result: %v", err)
+	}
+	if hash != rec.ResultHash {
+		return OutcomeMismatch, "result differs from the recorded one"
+	}
+	return OutcomeMatch, ""
+}
@@ -0,0 +1,85 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/middleware"
+)
+
+// recorded makes a recording of a call that returned result
+func recorded(t *testing.T, method string, height *uint64, result string) *Recording {
+	t.Helper()
+	hash, err := resultHash(json.RawMessage(result))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Recording{Method: method, Params: json.RawMessage(`[]`), Height: height, ResultHash: hash}
+}
+
+func TestReplay(t *testing.T) {
+	var pinned []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		pinned = append(pinned, r.Header.Get(middleware.BlockHeightHeader))
+		switch req.Method {
+		case "eth_getBlockByNumber":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"number":"0x10", "hash":"0xab"}}`))
+		case "eth_blockNumber":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x11"}`))
+		case "eth_call":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":3,"message":"execution reverted"}}`))
+		default:
+			w.Write([]byte(`not json`))
+		}
+	}))
+	defer server.Close()
+
+	height := uint64(16)
+	reverted := &Recording{Method: "eth_call", Params: json.RawMessage(`[]`), Error: &api.RPCError{Code: 3, Message: "execution reverted"}}
+	recordings := []*Recording{
+		// Equal results match whatever their key order and whitespace
+		recorded(t, "eth_getBlockByNumber", &height, `{"hash":"0xab","number":"0x10"}`),
+		recorded(t, "eth_blockNumber", nil, `"0x10"`),
+		reverted,
+		recorded(t, "eth_sendRawTransaction", nil, `"0x01"`),
+		recorded(t, "eth_chainId", nil, `"0x1"`),
+	}
+
+	var outcomes []Outcome
+	report, err := NewReplayer(server.URL, true, time.Second).Replay(context.Background(), recordings, func(result *Result) {
+		outcomes = append(outcomes, result.Outcome)
+	})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+
+	want := []Outcome{OutcomeMatch, OutcomeMismatch, OutcomeMatch, OutcomeSkipped, OutcomeFailed}
+	if len(outcomes) != len(want) {
+		t.Fatalf("outcomes = %v, want %v", outcomes, want)
+	}
+	for i := range want {
+		if outcomes[i] != want[i] {
+			t.Fatalf("outcomes = %v, want %v", outcomes, want)
+		}
+	}
+	if report != (Report{Matched: 2, Mismatched: 1, Skipped: 1, Failed: 1}) {
+		t.Fatalf("report = %+v", report)
+	}
+
+	// Only the call recorded at a known height is pinned; skipped calls are
+	// not made
+	if len(pinned) != 4 || pinned[0] != "16" || pinned[1] != "" {
+		t.Fatalf("pinned heights = %q", pinned)
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"github.com/sunvim/evm_rpc/pkg/api/net"
 	"github.com/sunvim/evm_rpc/pkg/api/txpool"
 	"github.com/sunvim/evm_rpc/pkg/api/web3"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/evm"
+	"github.com/sunvim/evm_rpc/pkg/forks"
 	"github.com/sunvim/evm_rpc/pkg/storage"
+	"github.com/sunvim/evm_rpc/pkg/txvalidate"
 )
 
 // APIBackend holds all API namespaces
@@ -14,8 +18,11 @@ type APIBackend struct {
 	BlockAPI       *eth.BlockAPI
 	TransactionAPI *eth.TransactionAPI
 	StateAPI       *eth.StateAPI
+	CallAPI        *eth.CallAPI
 	TxPoolAPI      *eth.TxPoolAPI
 	GasAPI         *eth.GasAPI
+	SyncAPI        *eth.SyncAPI
+	FilterAPI      *eth.FilterAPI
 
 	// Net namespace
 	NetAPI *net.NetAPI
@@ -33,26 +40,39 @@ func NewAPIBackend(
 	chainID uint64,
 	networkID uint64,
 	version string,
+	commit string,
 ) *APIBackend {
 	// Create storage readers
 	blockReader := storage.NewBlockReader(pikaClient)
 	txReader := storage.NewTransactionReader(pikaClient)
 	stateReader := storage.NewStateReader(pikaClient)
-	txPool := storage.NewTxPoolStorage(pikaClient)
+	txPool := storage.NewTxPoolStorage(pikaClient, config.TxPoolConfig{}, chainID)
+	filters := storage.NewFilterStore(pikaClient, storage.DefaultFilterTimeout)
+	chainConfig, _ := forks.ChainConfig(chainID, config.ForksConfig{}) // the defaults are valid
+	validator, _ := txvalidate.NewValidator(config.EVMConfig{}, chainConfig)
+	callAPI := eth.NewCallAPI(blockReader, stateReader, evm.NewExecutor(blockReader, stateReader, chainConfig, 0, 0), chainID)
+	txPoolAPI := eth.NewTxPoolAPI(blockReader, txReader, stateReader, txPool, validator, chainID)
+	txPoolAPI.SetCallAPI(callAPI)
+	gasAPI := eth.NewGasAPI(blockReader, chainConfig, chainID)
+	gasAPI.SetCallAPI(callAPI)
+	gasAPI.SetTxPool(txPool)
 
 	return &APIBackend{
 		// Eth namespace
-		BlockAPI:       eth.NewBlockAPI(blockReader, chainID),
+		BlockAPI:       eth.NewBlockAPI(blockReader, chainConfig),
 		TransactionAPI: eth.NewTransactionAPI(blockReader, txReader, chainID),
 		StateAPI:       eth.NewStateAPI(blockReader, stateReader, chainID),
-		TxPoolAPI:      eth.NewTxPoolAPI(blockReader, stateReader, txPool, chainID),
-		GasAPI:         eth.NewGasAPI(blockReader, chainID),
+		CallAPI:        callAPI,
+		TxPoolAPI:      txPoolAPI,
+		GasAPI:         gasAPI,
+		SyncAPI:        eth.NewSyncAPI(blockReader, chainID),
+		FilterAPI:      eth.NewFilterAPI(blockReader, filters),
 
 		// Net namespace
-		NetAPI: net.NewNetAPI(networkID),
+		NetAPI: net.NewNetAPI(networkID, nil),
 
 		// Web3 namespace
-		Web3API: web3.NewWeb3API(version),
+		Web3API: web3.NewWeb3API(version, commit),
 
 		// Txpool namespace
 		TxPoolInspectAPI: txpool.NewTxPoolAPI(txPool),
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+)
+
+// AdminServer serves operator endpoints on a listener of their own, away
+// from the public RPC ports
+type AdminServer struct {
+	server *http.Server
+	addr   string
+	errCh  chan error
+}
+
+// NewAdminServer creates an admin server
+func NewAdminServer(cfg config.AdminConfig) *AdminServer {
+	router := mux.NewRouter()
+	router.HandleFunc("/loglevel", handleGetLogLevel).Methods("GET")
+	router.HandleFunc("/loglevel", handleSetLogLevel).Methods("PUT", "POST")
+
+	return &AdminServer{
+		server: &http.Server{
+			Addr:         cfg.ListenAddr,
+			Handler:      router,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		},
+		addr:  cfg.ListenAddr,
+		errCh: make(chan error, 1),
+	}
+}
+
+// logLevel is the body of /loglevel
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+// handleGetLogLevel reports the current log level
+func handleGetLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, logLevel{Level: logger.Level()})
+}
+
+// handleSetLogLevel changes the log level until the next change or config
+// reload
+func handleSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var body logLevel
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body: " + err.Error()})
+		return
+	}
+	previous := logger.Level()
+	if err := logger.SetLevel(body.Level); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	logger.Infof("Log level changed from %s to %s", previous, body.Level)
+	writeJSON(w, http.StatusOK, logLevel{Level: logger.Level()})
+}
+
+// Start binds the listener and serves admin requests in the background
+func (s *AdminServer) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("admin server failed: %w", err)
+	}
+
+	logger.Infof("Starting admin server on %s", s.addr)
+	go func() {
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.errCh <- fmt.Errorf("admin server failed: %w", err)
+		}
+	}()
+	return nil
+}
+
+// Err returns a channel receiving serve failures after Start
+func (s *AdminServer) Err() <-chan error {
+	return s.errCh
+}
+
+// Stop gracefully shuts down the admin server
+func (s *AdminServer) Stop(ctx context.Context) error {
+	logger.Info("Stopping admin server...")
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+)
+
+// queuedLog is a live log notification held back during backfill
+type queuedLog struct {
+	log     *types.Log
+	removed bool
+	timing  blockTiming
+}
+
+// prepareBackfill validates the fromBlock of a logs subscription and records
+// the historical range to replay. Live logs are queued until it completes.
+// It reads the head, so it is called without sm.mu held.
+func (sm *SubscriptionManager) prepareBackfill(sub *Subscription) error {
+	bn, err := api.ParseBlockNumber(sub.Filter.FromBlock)
+	if err != nil {
+		return api.NewRPCError(api.ErrCodeInvalidParams, fmt.Sprintf("invalid fromBlock: %v", err))
+	}
+
+	// Nothing was missed when following the head
+	if bn == api.LatestBlockNumber || bn == api.PendingBlockNumber {
+		return nil
+	}
+
+	if sm.maxBackfill == 0 {
+		return api.NewRPCError(api.ErrCodeInvalidParams, "log backfill is disabled")
+	}
+
+	latest, err := sm.blockReader.GetLatestBlockNumber(sm.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	from := uint64(bn)
+	if from > latest {
+		return nil
+	}
+	if latest-from+1 > sm.maxBackfill {
+		return &api.RPCError{
+			Code:    api.ErrCodeLimitExceeded,
+			Message: fmt.Sprintf("backfill range too large: %d blocks, max %d", latest-from+1, sm.maxBackfill),
+			Data:    map[string]interface{}{"limit": "max_backfill_blocks", "max": sm.maxBackfill, "requested": latest - from + 1},
+		}
+	}
+
+	sub.backfilling = true
+	sub.backfillFrom = from
+	sub.backfillTo = latest
+	return nil
+}
+
+// StartBackfill replays historical logs for a subscription created with a
+// fromBlock. It must be called after the subscription ID has been sent.
+func (sm *SubscriptionManager) StartBackfill(subID string) {
+	sm.mu.RLock()
+	sub, exists := sm.subscriptions[subID]
+	sm.mu.RUnlock()
+	if !exists {
+		return
+	}
+
+	sub.backfillMu.Lock()
+	backfilling := sub.backfilling
+	sub.backfillMu.Unlock()
+	if !backfilling {
+		return
+	}
+
+	sm.wg.Add(1)
+	go sm.runBackfill(sub)
+}
+
+// runBackfill sends matching logs from the backfill range, then flushes the
+// live logs queued in the meantime
+func (sm *SubscriptionManager) runBackfill(sub *Subscription) {
+	defer sm.wg.Done()
+	defer sm.finishBackfill(sub)
+
+	// The range was resolved before the subscription was stored, so blocks
+	// published in between were neither queued nor in range
+	latest, err := sm.blockReader.GetLatestBlockNumber(sub.ctx)
+	if err != nil {
+		if sub.ctx.Err() == nil {
+			logger.Errorf("Failed to get latest block for backfill: %v", err)
+		}
+	} else if latest > sub.backfillTo {
+		sub.backfillMu.Lock()
+		sub.backfillTo = latest
+		sub.backfillMu.Unlock()
+	}
+
+	logger.Infof("Backfilling logs: id=%s, from=%d, to=%d", sub.ID, sub.backfillFrom, sub.backfillTo)
+
+	for number := sub.backfillFrom; number <= sub.backfillTo; number++ {
+		if sub.ctx.Err() != nil {
+			return
+		}
+
+		logs, err := sm.blockReader.GetBlockLogs(sub.ctx, number)
+		if err != nil {
+			if sub.ctx.Err() == nil {
+				logger.Errorf("Failed to backfill logs for block %d: %v", number, err)
+			}
+			continue
+		}
+
+		for _, log := range logs {
+			if matchLogFilter(log, sub.Filter) {
+				sm.sendLog(sub, log, false, blockTiming{})
+			}
+		}
+	}
+}
+
+// finishBackfill flushes queued live logs not already covered by the backfill
+func (sm *SubscriptionManager) finishBackfill(sub *Subscription) {
+	sub.backfillMu.Lock()
+	defer sub.backfillMu.Unlock()
+
+	if sub.ctx.Err() == nil {
+		for _, q := range sub.queuedLogs {
+			if q.removed || q.log.BlockNumber > sub.backfillTo {
+				sm.sendLog(sub, q.log, q.removed, q.timing)
+			}
+		}
+	}
+
+	sub.queuedLogs = nil
+	sub.backfilling = false
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"math/rand"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sunvim/evm_rpc/pkg/api/eth"
+	"github.com/sunvim/evm_rpc/pkg/bench"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/evm"
+	"github.com/sunvim/evm_rpc/pkg/forks"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+const testChainID = 1337
+
+// writeBenchChain writes blocks of a transfer and a contract call each, the
+// call emitting a log
+func writeBenchChain(t *testing.T, client *storage.PikaClient, blocks int) {
+	t.Helper()
+	ctx := context.Background()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := types.LatestSignerForChainID(big.NewInt(testChainID))
+	to := common.HexToAddress("0x000000000000000000000000000000000000dead")
+	contract := common.HexToAddress("0x00000000000000000000000000000000000c0de0")
+	writer := storage.NewBlockWriter(client)
+
+	var nonce uint64
+	for number := 0; number < blocks; number++ {
+		var txs types.Transactions
+		for _, tx := range []*types.DynamicFeeTx{
+			{To: &to, Gas: 21000, Value: big.NewInt(1)},
+			{To: &contract, Gas: 50000, Data: []byte{0x70, 0xa0, 0x82, 0x31}},
+		} {
+			tx.ChainID, tx.Nonce = big.NewInt(testChainID), nonce
+			tx.GasTipCap, tx.GasFeeCap = big.NewInt(1e9), big.NewInt(2e9)
+			signed, err := types.SignNewTx(key, signer, tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			txs = append(txs, signed)
+			nonce++
+		}
+		receipts := types.Receipts{
+			{Type: types.DynamicFeeTxType, Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000},
+			{Type: types.DynamicFeeTxType, Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 50000, Logs: []*types.Log{
+				{Address: contract, Topics: []common.Hash{{0x01}}},
+			}},
+		}
+		header := &types.Header{
+			UncleHash:  types.EmptyUncleHash,
+			Root:       types.EmptyRootHash,
+			Number:     big.NewInt(int64(number)),
+			GasLimit:   30_000_000,
+			GasUsed:    50000,
+			Difficulty: new(big.Int),
+			Time:       uint64(number) * 12,
+			BaseFee:    big.NewInt(1e9),
+		}
+		block := types.NewBlockWithHeader(header).WithBody(txs, nil)
+		if err := writer.WriteBlock(ctx, block, receipts, nil); err != nil {
+			t.Fatalf("WriteBlock: %v", err)
+		}
+		if err := writer.SetHead(ctx, block.NumberU64(), block.Hash()); err != nil {
+			t.Fatalf("SetHead: %v", err)
+		}
+	}
+}
+
+// TestBenchGenerators makes the calls of every method rpc bench can
+// benchmark, so that the params it generates stay valid
+func TestBenchGenerators(t *testing.T) {
+	ctx := context.Background()
+	client, err := storage.NewPikaClient(config.PikaConfig{Mode: config.PikaModeMemory})
+	if err != nil {
+		t.Fatalf("NewPikaClient: %v", err)
+	}
+	defer client.Close()
+	writeBenchChain(t, client, 4)
+
+	chainConfig, err := forks.ChainConfig(testChainID, config.ForksConfig{})
+	if err != nil {
+		t.Fatalf("ChainConfig: %v", err)
+	}
+	blockReader := storage.NewBlockReader(client)
+	stateReader := storage.NewStateReader(client)
+	callAPI := eth.NewCallAPI(blockReader, stateReader, evm.NewExecutor(blockReader, stateReader, chainConfig, 50_000_000, 5*time.Second), testChainID)
+	gasAPI := eth.NewGasAPI(blockReader, chainConfig, testChainID)
+	gasAPI.SetCallAPI(callAPI)
+
+	handler := NewJSONRPCHandler(nil, time.Minute)
+	for _, service := range []interface{}{
+		eth.NewBlockAPI(blockReader, chainConfig),
+		gasAPI,
+		eth.NewStateAPI(blockReader, stateReader, testChainID),
+		callAPI,
+		eth.NewTransactionAPI(blockReader, storage.NewTransactionReader(client), testChainID),
+		eth.NewSyncAPI(blockReader, testChainID),
+		eth.NewFilterAPI(blockReader, storage.NewFilterStore(client, time.Minute)),
+	} {
+		if err := handler.RegisterService("eth", service); err != nil {
+			t.Fatalf("RegisterService: %v", err)
+		}
+	}
+	server := httptest.NewServer(NewHTTPServer(config.HTTPConfig{}, handler, nil, nil, nil, nil, nil).server.Handler)
+	defer server.Close()
+
+	rpcClient, err := bench.Dial(ctx, server.URL, 1)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer rpcClient.Close()
+
+	fixture, err := bench.SampleFixture(ctx, rpcClient, 8)
+	if err != nil {
+		t.Fatalf("SampleFixture: %v", err)
+	}
+	if fixture.Head != 3 || len(fixture.Blocks) != 4 || len(fixture.Txs) != 8 || len(fixture.Addresses) != 3 || len(fixture.Calls) != 4 {
+		t.Fatalf("fixture = %+v", fixture)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for _, method := range bench.Methods() {
+		t.Run(method, func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				params := bench.Generators[method](r, fixture)
+				var result interface{}
+				if err := rpcClient.CallContext(ctx, &result, method, params...); err != nil {
+					t.Fatalf("%s%v: %v", method, params, err)
+				}
+			}
+		})
+	}
+}
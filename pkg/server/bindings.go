@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"strings"
+)
+
+// Listeners a namespace can be bound to
+const (
+	ListenerHTTP    = "http"
+	ListenerWS      = "ws"
+	ListenerPrivate = "private"
+)
+
+// listenerKey is the context key of the listener a call was received on
+type listenerKey struct{}
+
+// withListener returns a context recording the listener a call was
+// received on
+func withListener(ctx context.Context, listener string) context.Context {
+	return context.WithValue(ctx, listenerKey{}, listener)
+}
+
+// listenerFromContext returns the listener a call was received on, or ""
+func listenerFromContext(ctx context.Context) string {
+	listener, _ := ctx.Value(listenerKey{}).(string)
+	return listener
+}
+
+// SetBindings restricts namespaces to listeners: a namespace bound to
+// listeners is only served on them, others are served on every listener.
+// It must be called before serving.
+func (h *JSONRPCHandler) SetBindings(bindings map[string][]string) {
+	h.bindings = make(map[string]map[string]bool, len(bindings))
+	for namespace, listeners := range bindings {
+		allowed := make(map[string]bool, len(listeners))
+		for _, listener := range listeners {
+			allowed[listener] = true
+		}
+		h.bindings[namespace] = allowed
+	}
+}
+
+// methodBound reports whether a method may be served on the listener of a
+// call. Calls not received on a listener, such as internal ones, are not
+// restricted.
+func (h *JSONRPCHandler) methodBound(ctx context.Context, method string) bool {
+	namespace, _, _ := strings.Cut(method, "_")
+	allowed, ok := h.bindings[namespace]
+	if !ok {
+		return true
+	}
+	listener := listenerFromContext(ctx)
+	return listener == "" || allowed[listener]
+}
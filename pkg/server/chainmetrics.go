@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// chainMetricsTimeout bounds reading the head at scrape time
+const chainMetricsTimeout = 2 * time.Second
+
+// chainCollector exports the head of a chain, read from storage at scrape
+// time, so that stalled ingestion can be alerted on
+type chainCollector struct {
+	chainID uint64
+	health  *HealthChecker
+
+	// Descriptors carry the chain name, so that the collectors of several
+	// chains can be registered together
+	chainIDDesc         *prometheus.Desc
+	latestBlockDesc     *prometheus.Desc
+	latestBlockTimeDesc *prometheus.Desc
+	headLagDesc         *prometheus.Desc
+}
+
+// NewChainCollector creates a collector of the head of a chain
+func NewChainCollector(name string, chainID uint64, health *HealthChecker) prometheus.Collector {
+	labels := prometheus.Labels{"chain": name}
+	return &chainCollector{
+		chainID: chainID,
+		health:  health,
+		chainIDDesc: prometheus.NewDesc(
+			"evm_rpc_chain_id",
+			"Chain ID of a served chain",
+			nil, labels,
+		),
+		latestBlockDesc: prometheus.NewDesc(
+			"evm_rpc_latest_block_number",
+			"Number of the latest ingested block",
+			nil, labels,
+		),
+		latestBlockTimeDesc: prometheus.NewDesc(
+			"evm_rpc_latest_block_timestamp_seconds",
+			"Timestamp of the latest ingested block",
+			nil, labels,
+		),
+		headLagDesc: prometheus.NewDesc(
+			"evm_rpc_head_lag_seconds",
+			"Age of the latest ingested block",
+			nil, labels,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *chainCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.chainIDDesc
+	ch <- c.latestBlockDesc
+	ch <- c.latestBlockTimeDesc
+	ch <- c.headLagDesc
+}
+
+// Collect implements prometheus.Collector. The head gauges are left out
+// while storage cannot be read.
+func (c *chainCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.chainIDDesc, prometheus.GaugeValue, float64(c.chainID))
+
+	ctx, cancel := context.WithTimeout(context.Background(), chainMetricsTimeout)
+	defer cancel()
+	latest, headTime, err := c.health.Head(ctx)
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.latestBlockDesc, prometheus.GaugeValue, float64(latest))
+	ch <- prometheus.MustNewConstMetric(c.latestBlockTimeDesc, prometheus.GaugeValue, float64(headTime.Unix()))
+	ch <- prometheus.MustNewConstMetric(c.headLagDesc, prometheus.GaugeValue, headLag(headTime).Seconds())
+}
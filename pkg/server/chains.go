@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// chainPathPrefix is the URL path prefix addressing a chain by name
+const chainPathPrefix = "/chain/"
+
+// Chain is a further chain served by the HTTP and WebSocket servers next to
+// the default one. Requests reach it under /chain/{name} or through one of
+// its hosts.
+type Chain struct {
+	Name          string
+	Hosts         []string
+	Handler       *JSONRPCHandler
+	Health        *HealthChecker
+	Subscriptions *SubscriptionManager // nil without WebSocket or events
+}
+
+// chainRouter resolves the chain a request is for
+type chainRouter struct {
+	byName map[string]*Chain
+	byHost map[string]*Chain
+}
+
+func newChainRouter() *chainRouter {
+	return &chainRouter{
+		byName: make(map[string]*Chain),
+		byHost: make(map[string]*Chain),
+	}
+}
+
+// add registers a chain. It must be called before serving.
+func (c *chainRouter) add(chain *Chain) {
+	c.byName[chain.Name] = chain
+	for _, host := range chain.Hosts {
+		c.byHost[strings.ToLower(host)] = chain
+	}
+}
+
+// route returns the chain a request is for, nil for the default chain. ok is
+// false if the path names an unknown chain.
+func (c *chainRouter) route(r *http.Request) (chain *Chain, ok bool) {
+	if name, found := strings.CutPrefix(r.URL.Path, chainPathPrefix); found {
+		name, _, _ = strings.Cut(name, "/")
+		chain, ok = c.byName[name]
+		return chain, ok
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return c.byHost[strings.ToLower(host)], true
+}
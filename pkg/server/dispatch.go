@@ -0,0 +1,304 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/sunvim/evm_rpc/pkg/api"
+)
+
+// invoker calls a registered method with the raw params of a request
+type invoker func(ctx context.Context, params json.RawMessage) (interface{}, error)
+
+// compileMethod builds the invoker of a method once, at registration. The
+// signatures of the busiest methods are called directly and decode their
+// params without reflection; all others are called through reflection with
+// decoders prepared for their argument types.
+func compileMethod(receiver reflect.Value, method reflect.Method) invoker {
+	switch fn := receiver.Method(method.Index).Interface().(type) {
+	case func(context.Context) (hexutil.Uint64, error):
+		return call0(fn)
+	case func(context.Context) (*hexutil.Big, error):
+		return call0(fn)
+	case func(context.Context) (string, error):
+		return call0(fn)
+	case func(context.Context) (bool, error):
+		return call0(fn)
+	case func(context.Context) (interface{}, error):
+		return call0(fn)
+	case func(context.Context, common.Hash) (*api.RPCTransaction, error):
+		return call1(fn)
+	case func(context.Context, common.Hash) (*api.RPCReceipt, error):
+		return call1(fn)
+	case func(context.Context, hexutil.Bytes) (common.Hash, error):
+		return call1(fn)
+	case func(context.Context, string, bool) (*api.RPCBlock, error):
+		return call2(fn)
+	case func(context.Context, common.Hash, bool) (*api.RPCBlock, error):
+		return call2(fn)
+	case func(context.Context, common.Address, string) (hexutil.Uint64, error):
+		return call2(fn)
+	case func(context.Context, common.Address, api.BlockNumberOrHash) (*hexutil.Big, error):
+		return call2(fn)
+	case func(context.Context, common.Address, api.BlockNumberOrHash) (hexutil.Uint64, error):
+		return call2(fn)
+	case func(context.Context, common.Address, api.BlockNumberOrHash) (hexutil.Bytes, error):
+		return call2(fn)
+	case func(context.Context, common.Address, common.Hash, api.BlockNumberOrHash) (hexutil.Bytes, error):
+		return call3(fn)
+	}
+	return reflectInvoker(receiver, method)
+}
+
+func call0[R any](fn func(context.Context) (R, error)) invoker {
+	spec := newParamSpec()
+	nillable := isNillable(reflect.TypeFor[R]())
+	return func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		if _, err := spec.split(params); err != nil {
+			return nil, err
+		}
+		r, err := fn(ctx)
+		return resultValue(r, nillable), err
+	}
+}
+
+func call1[A, R any](fn func(context.Context, A) (R, error)) invoker {
+	spec := newParamSpec(reflect.TypeFor[A]())
+	nillable := isNillable(reflect.TypeFor[R]())
+	return func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		list, err := spec.split(params)
+		if err != nil {
+			return nil, err
+		}
+		a, err := decodeParam[A](list, 0)
+		if err != nil {
+			return nil, err
+		}
+		r, err := fn(ctx, a)
+		return resultValue(r, nillable), err
+	}
+}
+
+func call2[A, B, R any](fn func(context.Context, A, B) (R, error)) invoker {
+	spec := newParamSpec(reflect.TypeFor[A](), reflect.TypeFor[B]())
+	nillable := isNillable(reflect.TypeFor[R]())
+	return func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		list, err := spec.split(params)
+		if err != nil {
+			return nil, err
+		}
+		a, err := decodeParam[A](list, 0)
+		if err != nil {
+			return nil, err
+		}
+		b, err := decodeParam[B](list, 1)
+		if err != nil {
+			return nil, err
+		}
+		r, err := fn(ctx, a, b)
+		return resultValue(r, nillable), err
+	}
+}
+
+func call3[A, B, C, R any](fn func(context.Context, A, B, C) (R, error)) invoker {
+	spec := newParamSpec(reflect.TypeFor[A](), reflect.TypeFor[B](), reflect.TypeFor[C]())
+	nillable := isNillable(reflect.TypeFor[R]())
+	return func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		list, err := spec.split(params)
+		if err != nil {
+			return nil, err
+		}
+		a, err := decodeParam[A](list, 0)
+		if err != nil {
+			return nil, err
+		}
+		b, err := decodeParam[B](list, 1)
+		if err != nil {
+			return nil, err
+		}
+		c, err := decodeParam[C](list, 2)
+		if err != nil {
+			return nil, err
+		}
+		r, err := fn(ctx, a, b, c)
+		return resultValue(r, nillable), err
+	}
+}
+
+// paramSpec describes the params a method accepts. Trailing pointer params
+// are optional, as in geth; all others must be given and must not be null
+// unless their type can hold nil.
+type paramSpec struct {
+	count    int
+	required int
+	nullable []bool
+}
+
+// newParamSpec derives the spec of a method from its argument types,
+// excluding the context
+func newParamSpec(types ...reflect.Type) paramSpec {
+	spec := paramSpec{count: len(types), nullable: make([]bool, len(types))}
+	for i, t := range types {
+		spec.nullable[i] = isNillable(t)
+		if t.Kind() != reflect.Ptr {
+			spec.required = i + 1
+		}
+	}
+	return spec
+}
+
+// split splits the params of a request and checks them against the spec
+func (s paramSpec) split(params json.RawMessage) ([]json.RawMessage, error) {
+	list := splitParams(params)
+	if len(list) > s.count {
+		return nil, api.NewRPCError(api.ErrCodeInvalidParams, fmt.Sprintf("too many params, want at most %d", s.count))
+	}
+	for i := 0; i < s.required; i++ {
+		if i >= len(list) || (!s.nullable[i] && string(list[i]) == "null") {
+			return nil, api.NewRPCError(api.ErrCodeInvalidParams, fmt.Sprintf("missing value for required param %d", i+1))
+		}
+	}
+	return list, nil
+}
+
+// decodeParam decodes the i-th param, leaving the zero value when it is
+// missing
+func decodeParam[T any](list []json.RawMessage, i int) (T, error) {
+	var v T
+	if i >= len(list) {
+		return v, nil
+	}
+	if err := unmarshalParam(list[i], &v); err != nil {
+		return v, api.NewRPCError(api.ErrCodeInvalidParams, fmt.Sprintf("invalid param %d: %v", i+1, err))
+	}
+	return v, nil
+}
+
+// unmarshalParam decodes a param, calling the type's own decoder directly
+// where it has one. Params are split from a parsed request, so they are
+// known to be valid JSON.
+func unmarshalParam(raw json.RawMessage, v interface{}) error {
+	if u, ok := v.(json.Unmarshaler); ok {
+		return u.UnmarshalJSON(raw)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// splitParams returns the positional params of a request. A params value
+// that is not an array is taken as the only param; absent params and null
+// are none.
+func splitParams(params json.RawMessage) []json.RawMessage {
+	p := bytes.TrimSpace(params)
+	if len(p) == 0 || string(p) == "null" {
+		return nil
+	}
+	if p[0] != '[' {
+		return []json.RawMessage{params}
+	}
+
+	// Params were validated when the request was parsed, so it is enough
+	// to find the commas between elements outside strings and nesting
+	list := []json.RawMessage{}
+	depth, start, inString := 0, 1, false
+	for i := 1; i < len(p); i++ {
+		c := p[i]
+		if inString {
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '[', '{':
+			depth++
+		case ']', '}':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if elem := bytes.TrimSpace(p[start:i]); len(elem) > 0 {
+				list = append(list, elem)
+			}
+			return list
+		case ',':
+			if depth == 0 {
+				list = append(list, bytes.TrimSpace(p[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return []json.RawMessage{params}
+}
+
+// resultValue returns the result of a call, with nil pointers, slices,
+// maps and interfaces reported as no result
+func resultValue[R any](r R, nillable bool) interface{} {
+	// r is reflected through a pointer, as a nil interface reflects to the
+	// zero Value, which IsNil panics on
+	if nillable && reflect.ValueOf(&r).Elem().IsNil() {
+		return nil
+	}
+	return r
+}
+
+// isNillable reports whether values of t can be nil
+func isNillable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Chan, reflect.Func:
+		return true
+	}
+	return false
+}
+
+// reflectInvoker calls methods without a direct signature through
+// reflection
+func reflectInvoker(receiver reflect.Value, method reflect.Method) invoker {
+	fn := receiver.Method(method.Index)
+	fnType := fn.Type()
+	argTypes := make([]reflect.Type, fnType.NumIn()-1) // skip context
+	for i := range argTypes {
+		argTypes[i] = fnType.In(i + 1)
+	}
+	spec := newParamSpec(argTypes...)
+	nillable := isNillable(fnType.Out(0))
+
+	return func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		list, err := spec.split(params)
+		if err != nil {
+			return nil, err
+		}
+
+		args := make([]reflect.Value, 1+len(argTypes))
+		args[0] = reflect.ValueOf(ctx)
+		for i, argType := range argTypes {
+			arg := reflect.New(argType)
+			if i < len(list) {
+				if err := unmarshalParam(list[i], arg.Interface()); err != nil {
+					return nil, api.NewRPCError(api.ErrCodeInvalidParams, fmt.Sprintf("invalid param %d: %v", i+1, err))
+				}
+			}
+			args[i+1] = arg.Elem()
+		}
+
+		results := fn.Call(args)
+
+		var result interface{}
+		if !nillable || !results[0].IsNil() {
+			result = results[0].Interface()
+		}
+		if !results[1].IsNil() {
+			err = results[1].Interface().(error)
+		}
+		return result, err
+	}
+}
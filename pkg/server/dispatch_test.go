@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/sunvim/evm_rpc/pkg/api"
+)
+
+// dispatchService has methods of the compiled signatures returning nil
+type dispatchService struct{}
+
+// Syncing fails like SyncAPI.Syncing does when storage fails
+func (dispatchService) Syncing(ctx context.Context) (interface{}, error) {
+	return nil, api.NewRPCError(api.ErrCodeResourceUnavail, "storage unavailable")
+}
+
+func (dispatchService) Status(ctx context.Context) (interface{}, error) {
+	return nil, nil
+}
+
+func (dispatchService) Balance(ctx context.Context) (*hexutil.Big, error) {
+	return nil, nil
+}
+
+func TestDispatchNilResults(t *testing.T) {
+	h := NewJSONRPCHandler(nil, time.Minute)
+	if err := h.RegisterService("test", dispatchService{}); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		code   int // of the error, 0 for none
+	}{
+		{"test_syncing", api.ErrCodeResourceUnavail},
+		{"test_status", 0},
+		{"test_balance", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			resp := h.HandleRequest(context.Background(), &JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: tt.method}, "127.0.0.1")
+			if resp.Result != nil {
+				t.Fatalf("result = %v, want none", resp.Result)
+			}
+			switch {
+			case tt.code == 0 && resp.Error != nil:
+				t.Fatalf("error = %v", resp.Error)
+			case tt.code != 0 && (resp.Error == nil || resp.Error.Code != tt.code):
+				t.Fatalf("error = %v, want code %d", resp.Error, tt.code)
+			}
+		})
+	}
+}
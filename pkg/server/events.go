@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/middleware"
+)
+
+// eventsKeepaliveInterval is how often an idle event stream gets a comment,
+// so that proxies do not close it
+const eventsKeepaliveInterval = 15 * time.Second
+
+// eventsWriteTimeout bounds a write to an event stream; the server's write
+// timeout would cut the stream otherwise
+const eventsWriteTimeout = 10 * time.Second
+
+// EnableEvents serves newHeads and logs subscriptions of the default chain
+// as Server-Sent Events under /events, for clients that cannot use
+// WebSockets; further chains use their own subscriptions under
+// /chain/{name}/events. maxStreams bounds the open streams, 0 is unlimited.
+// It must be called before Start.
+func (s *HTTPServer) EnableEvents(subscriptions *SubscriptionManager, maxStreams int) {
+	s.events = subscriptions
+	s.maxStreams = maxStreams
+}
+
+// handleEvents streams the notifications of a subscription as Server-Sent
+// Events until the client goes away or the server stops. The type query
+// parameter selects newHeads or logs, and filter the log filter as JSON.
+func (s *HTTPServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	chain, ok := s.chains.route(r)
+	if !ok {
+		http.Error(w, "unknown chain", http.StatusNotFound)
+		return
+	}
+	handler, subscriptions, chainName := s.handler, s.events, ""
+	if chain != nil {
+		handler, subscriptions, chainName = chain.Handler, chain.Subscriptions, chain.Name
+	}
+	ctx := withListener(middleware.WithAPIKey(r.Context(), middleware.APIKey(r)), s.listener)
+	if s.events == nil || subscriptions == nil || !handler.methodBound(ctx, "eth_subscribe") {
+		http.Error(w, "events are not enabled", http.StatusNotFound)
+		return
+	}
+
+	subType := SubscriptionType(r.URL.Query().Get("type"))
+	if subType != SubscriptionNewHeads && subType != SubscriptionLogs {
+		http.Error(w, fmt.Sprintf("unsupported event type %q, expected newHeads or logs", subType), http.StatusBadRequest)
+		return
+	}
+	var filter *FilterCriteria
+	if raw := r.URL.Query().Get("filter"); raw != "" {
+		if subType != SubscriptionLogs {
+			http.Error(w, "filter only applies to logs", http.StatusBadRequest)
+			return
+		}
+		filter = &FilterCriteria{}
+		if err := json.Unmarshal([]byte(raw), filter); err != nil {
+			http.Error(w, "invalid filter criteria", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if n := s.streams.Add(1); s.maxStreams > 0 && n > int64(s.maxStreams) {
+		s.streams.Add(-1)
+		http.Error(w, "max event streams reached", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.streams.Add(-1)
+
+	// The stream stands in for a connection: the subscription manager
+	// queues notifications for it, which are written here
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream := &WebSocketConnection{
+		sendChan:  make(chan interface{}, 256),
+		closeChan: make(chan struct{}),
+		clientIP:  extractIP(r),
+		requestID: middleware.RequestID(r),
+		ctx:       streamCtx,
+		cancel:    cancel,
+
+		connectedAt: time.Now(),
+
+		chain:         chainName,
+		handler:       handler,
+		subscriptions: subscriptions,
+	}
+	subID, err := subscriptions.Subscribe(stream, subType, filter)
+	if err != nil {
+		cancel()
+		if rpcErr, ok := err.(*api.RPCError); ok {
+			http.Error(w, rpcErr.Message, http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	defer func() {
+		subscriptions.UnsubscribeAll(stream)
+		stream.Close()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would buffer the stream
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	write := func(data []byte) bool {
+		rc.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+		if _, err := w.Write(data); err != nil {
+			return false
+		}
+		metrics.RecordEgress("sse", len(data))
+		return rc.Flush() == nil
+	}
+	if !write([]byte(fmt.Sprintf(": subscription %s\n\n", subID))) {
+		return
+	}
+	metrics.RecordEventStream(1)
+	defer metrics.RecordEventStream(-1)
+	logger.With("request_id", stream.requestID).Infof("Event stream opened: %s, type=%s", stream.clientIP, subType)
+
+	// Replay missed logs now that the stream is open
+	subscriptions.StartBackfill(subID)
+
+	keepalive := time.NewTicker(eventsKeepaliveInterval)
+	defer keepalive.Stop()
+	for {
+		select {
+		case message := <-stream.sendChan:
+			block, isBlock := message.(blockNotification)
+			if isBlock {
+				message = block.msg
+			}
+			data, err := eventMessage(subType, message)
+			if err != nil {
+				logger.Errorf("Failed to encode event: %v", err)
+				continue
+			}
+			if !write(data) {
+				return
+			}
+			if isBlock {
+				block.recordDelivery()
+			}
+		case <-keepalive.C:
+			if !write([]byte(": keepalive\n\n")) {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-s.eventsDone:
+			return
+		}
+	}
+}
+
+// eventMessage encodes the result of a notification as a Server-Sent Event
+// named after the subscription type
+func eventMessage(subType SubscriptionType, message interface{}) ([]byte, error) {
+	msg, ok := message.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected message %T", message)
+	}
+	params, ok := msg["params"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("notification without params")
+	}
+	data, err := json.Marshal(params["result"])
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", subType, data)), nil
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/cache"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// Reasons a call is proxied to the upstream node
+const (
+	fallbackUnsupported = "unsupported" // the method is not implemented here
+	fallbackMissing     = "missing"     // the data is not indexed yet
+)
+
+// fallbackBackoff is the delay before the first retry, doubled for each
+// further one
+const fallbackBackoff = 100 * time.Millisecond
+
+// Fallback proxies the calls this service cannot answer to an upstream
+// node: methods it does not implement, and reads of data it has not
+// indexed yet, such as a block just produced. It lets the service be rolled
+// out in front of existing nodes before it covers every method.
+type Fallback struct {
+	client   *rpc.Client
+	timeout  time.Duration
+	retries  int
+	methods  map[string]bool // unregistered methods proxied; if empty, those of served namespaces
+	missing  map[string]bool
+	cache    *cache.Cache[string, json.RawMessage] // nil if caching is disabled
+	cacheTTL time.Duration
+}
+
+// NewFallback connects to the upstream node
+func NewFallback(cfg config.FallbackConfig) (*Fallback, error) {
+	client, err := rpc.Dial(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to upstream: %w", err)
+	}
+
+	f := &Fallback{
+		client:   client,
+		timeout:  cfg.Timeout,
+		retries:  cfg.Retries,
+		methods:  make(map[string]bool, len(cfg.Methods)),
+		missing:  make(map[string]bool, len(cfg.MissingMethods)),
+		cacheTTL: cfg.CacheTTL,
+	}
+	for _, method := range cfg.Methods {
+		f.methods[method] = true
+	}
+	for _, method := range cfg.MissingMethods {
+		f.missing[method] = true
+	}
+	if cfg.CacheSize > 0 {
+		if f.cache, err = cache.NewCache[string, json.RawMessage](cfg.CacheSize); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Start is a no-op; the connection is established by NewFallback
+func (f *Fallback) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop disconnects from the upstream node
+func (f *Fallback) Stop(ctx context.Context) error {
+	f.client.Close()
+	return nil
+}
+
+// SetFallback proxies the calls the handler cannot answer to an upstream
+// node. It must be called before serving.
+func (h *JSONRPCHandler) SetFallback(fallback *Fallback) {
+	h.fallback = fallback
+}
+
+// proxied reports whether an unregistered method is proxied to the
+// upstream node: a method of the fallback's allowlist if it has one, else
+// any method of a namespace this service serves, so that the upstream's
+// debug or admin methods are not exposed
+func (h *JSONRPCHandler) proxied(method string) bool {
+	if h.fallback == nil {
+		return false
+	}
+	if len(h.fallback.methods) > 0 {
+		return h.fallback.methods[method]
+	}
+	namespace, _, _ := strings.Cut(method, "_")
+	return h.namespaces[namespace]
+}
+
+// execute runs a call, proxying it to the upstream node if its method is
+// not registered, or if the result is missing for a method proxied then
+func (h *JSONRPCHandler) execute(ctx context.Context, handler *methodHandler, req *JSONRPCRequest) (interface{}, error) {
+	if handler == nil {
+		return h.fallback.call(ctx, req, fallbackUnsupported)
+	}
+
+	result, err := h.callMethod(ctx, handler, req)
+	if h.fallback != nil && h.fallback.missing[req.Method] && result == nil && (err == nil || errors.Is(err, storage.ErrNotFound)) {
+		return h.fallback.call(ctx, req, fallbackMissing)
+	}
+	return result, err
+}
+
+// immutable reports whether a call reads data that cannot change: a
+// method of the shared response cache at a fixed block. Calls of the
+// latest block, including those pinned with X-Block-Height, which the
+// upstream node does not see, and writes are not.
+func immutable(ctx context.Context, req *JSONRPCRequest) bool {
+	rule, ok := cacheableMethods[req.Method]
+	if !ok {
+		return false
+	}
+	if _, ok := storage.PinnedHeight(ctx); ok {
+		return false
+	}
+	var params []json.RawMessage
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return false
+		}
+	}
+	return rule.pinned(params)
+}
+
+// call proxies a call. Immutable reads are served from the cached result
+// of an identical call and retried after transport failures; other calls
+// are made once. Errors of the upstream node are passed on as they are.
+func (f *Fallback) call(ctx context.Context, req *JSONRPCRequest, reason string) (interface{}, error) {
+	key := req.Method + string(bytes.TrimSpace(req.Params))
+	retries, cached := 0, false
+	if immutable(ctx, req) {
+		retries, cached = f.retries, f.cache != nil
+	}
+	if cached {
+		if result, ok := f.cache.Get(key); ok {
+			metrics.RecordFallback(reason, "cached")
+			return result, nil
+		}
+	}
+
+	params := splitParams(req.Params)
+	args := make([]interface{}, len(params))
+	for i, param := range params {
+		args[i] = param
+	}
+
+	var result json.RawMessage
+	var err error
+	for attempt := 0; ; attempt++ {
+		callCtx, cancel := context.WithTimeout(ctx, f.timeout)
+		err = f.client.CallContext(callCtx, &result, req.Method, args...)
+		cancel()
+
+		var rpcErr rpc.Error
+		if err == nil || errors.As(err, &rpcErr) || attempt >= retries || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-time.After(fallbackBackoff << attempt):
+		case <-ctx.Done():
+		}
+	}
+
+	if err != nil {
+		var rpcErr rpc.Error
+		if errors.As(err, &rpcErr) {
+			metrics.RecordFallback(reason, "error")
+			upstreamErr := &api.RPCError{Code: rpcErr.ErrorCode(), Message: rpcErr.Error()}
+			var dataErr rpc.DataError
+			if errors.As(err, &dataErr) {
+				upstreamErr.Data = dataErr.ErrorData()
+			}
+			return nil, upstreamErr
+		}
+		metrics.RecordFallback(reason, "unavailable")
+		logger.FromContext(ctx).Warnf("Upstream fallback failed for %s: %v", req.Method, err)
+		return nil, api.NewRPCError(api.ErrCodeResourceUnavail, "upstream unavailable")
+	}
+
+	metrics.RecordFallback(reason, "ok")
+	if len(result) == 0 || string(result) == "null" {
+		return nil, nil
+	}
+	if cached {
+		f.cache.Set(key, result, f.cacheTTL)
+	}
+	return result, nil
+}
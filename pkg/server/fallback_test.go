@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/api/eth"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// upstreamNode answers every call with 0x1, or with HTTP 500 for the
+// failing methods, counting the calls of each method
+type upstreamNode struct {
+	mu      sync.Mutex
+	calls   map[string]int
+	failing map[string]bool
+}
+
+func (u *upstreamNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req JSONRPCRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	u.mu.Lock()
+	u.calls[req.Method]++
+	failing := u.failing[req.Method]
+	u.mu.Unlock()
+	if failing {
+		http.Error(w, "upstream down", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(&JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: "0x1"})
+}
+
+func (u *upstreamNode) count(method string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.calls[method]
+}
+
+func TestFallback(t *testing.T) {
+	upstream := &upstreamNode{
+		calls:   make(map[string]int),
+		failing: map[string]bool{"eth_sendRawTransaction": true, "eth_getBlockReceipts": true, "eth_getBlockByHash": true},
+	}
+	srv := httptest.NewServer(upstream)
+	defer srv.Close()
+
+	newHandler := func(methods ...string) *JSONRPCHandler {
+		fallback, err := NewFallback(config.FallbackConfig{
+			URL:       srv.URL,
+			Timeout:   time.Second,
+			Retries:   2,
+			Methods:   methods,
+			CacheSize: 100,
+			CacheTTL:  time.Minute,
+		})
+		if err != nil {
+			t.Fatalf("NewFallback: %v", err)
+		}
+		t.Cleanup(func() { fallback.Stop(context.Background()) })
+		h := NewJSONRPCHandler(nil, time.Minute)
+		if err := h.RegisterService("eth", eth.NewSyncAPI(nil, testChainID)); err != nil {
+			t.Fatalf("RegisterService: %v", err)
+		}
+		h.SetFallback(fallback)
+		return h
+	}
+	call := func(ctx context.Context, h *JSONRPCHandler, method, params string) *JSONRPCResponse {
+		return h.HandleRequest(ctx, &JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: method, Params: json.RawMessage(params)}, "127.0.0.1")
+	}
+
+	t.Run("namespaces", func(t *testing.T) {
+		h := newHandler()
+		if resp := call(context.Background(), h, "debug_traceTransaction", `["0x01"]`); resp.Error == nil || resp.Error.Code != api.ErrCodeMethodNotFound {
+			t.Fatalf("method of a namespace not served: error = %v, want method not found", resp.Error)
+		}
+		if resp := call(context.Background(), h, "eth_getProof", `["0x01",[],"0x1"]`); resp.Error != nil {
+			t.Fatalf("eth_getProof: %v", resp.Error)
+		}
+	})
+
+	t.Run("allowlist", func(t *testing.T) {
+		h := newHandler("debug_traceTransaction")
+		if resp := call(context.Background(), h, "debug_traceTransaction", `["0x01"]`); resp.Error != nil {
+			t.Fatalf("allowed method: %v", resp.Error)
+		}
+		if resp := call(context.Background(), h, "eth_getProof", `["0x01",[],"0x1"]`); resp.Error == nil || resp.Error.Code != api.ErrCodeMethodNotFound {
+			t.Fatalf("method not allowed: error = %v, want method not found", resp.Error)
+		}
+	})
+
+	t.Run("caching", func(t *testing.T) {
+		h := newHandler()
+		pinned := storage.WithPinnedHeight(context.Background(), 1)
+		tests := []struct {
+			ctx    context.Context
+			method string
+			params string
+			calls  int // upstream calls for two identical calls
+		}{
+			{context.Background(), "eth_getBlockByNumber", `["0x1",false]`, 1},
+			{context.Background(), "eth_getBalance", `["0x01","latest"]`, 2},
+			{context.Background(), "eth_getCode", `["0x01"]`, 2},
+			{context.Background(), "eth_getTransactionCount", `["0x01","0x1"]`, 1},
+			{pinned, "eth_getStorageAt", `["0x01","0x0","0x1"]`, 2},
+		}
+		for _, tt := range tests {
+			for i := 0; i < 2; i++ {
+				if resp := call(tt.ctx, h, tt.method, tt.params); resp.Error != nil {
+					t.Fatalf("%s: %v", tt.method, resp.Error)
+				}
+			}
+			if got := upstream.count(tt.method); got != tt.calls {
+				t.Errorf("%s %s: upstream calls = %d, want %d", tt.method, tt.params, got, tt.calls)
+			}
+		}
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		h := newHandler()
+		tests := []struct {
+			method string
+			params string
+			calls  int
+		}{
+			{"eth_sendRawTransaction", `["0x01"]`, 1},
+			{"eth_getBlockReceipts", `["0x1"]`, 1},
+			{"eth_getBlockByHash", `["0x01",false]`, 3},
+		}
+		for _, tt := range tests {
+			resp := call(context.Background(), h, tt.method, tt.params)
+			if resp.Error == nil || resp.Error.Code != api.ErrCodeResourceUnavail {
+				t.Fatalf("%s: error = %v, want upstream unavailable", tt.method, resp.Error)
+			}
+			if got := upstream.count(tt.method); got != tt.calls {
+				t.Errorf("%s: upstream calls = %d, want %d", tt.method, got, tt.calls)
+			}
+		}
+	})
+}
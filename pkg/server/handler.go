@@ -1,16 +1,29 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/jsonx"
 	"github.com/sunvim/evm_rpc/pkg/logger"
 	"github.com/sunvim/evm_rpc/pkg/metrics"
 	"github.com/sunvim/evm_rpc/pkg/middleware"
+	"github.com/sunvim/evm_rpc/pkg/replay"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+	"github.com/sunvim/evm_rpc/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // JSONRPCRequest represents a JSON-RPC 2.0 request
@@ -19,6 +32,34 @@ type JSONRPCRequest struct {
 	ID      interface{}     `json:"id"`
 	Method  string          `json:"method"`
 	Params  json.RawMessage `json:"params,omitempty"`
+
+	hasID   bool // the request has an id member, possibly null
+	invalid bool // a batch entry that is not a request object
+}
+
+// UnmarshalJSON decodes a request, noting whether it has an id so that
+// notifications can be told apart from requests with a null id
+func (r *JSONRPCRequest) UnmarshalJSON(data []byte) error {
+	type request JSONRPCRequest
+	aux := struct {
+		*request
+		ID json.RawMessage `json:"id"`
+	}{request: (*request)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	r.ID, r.hasID = nil, aux.ID != nil
+	if r.hasID {
+		return json.Unmarshal(aux.ID, &r.ID)
+	}
+	return nil
+}
+
+// IsNotification reports whether the request is a notification, which is
+// executed but never answered
+func (r *JSONRPCRequest) IsNotification() bool {
+	return !r.hasID && !r.invalid && r.JSONRPC == "2.0" && r.Method != ""
 }
 
 // JSONRPCResponse represents a JSON-RPC 2.0 response
@@ -29,27 +70,217 @@ type JSONRPCResponse struct {
 	Error   *api.RPCError `json:"error,omitempty"`
 }
 
+// MarshalJSON implements json.Marshaler. A successful response carries a
+// result, null if there is none, as JSON-RPC 2.0 requires and clients such
+// as geth's expect.
+func (r *JSONRPCResponse) MarshalJSON() ([]byte, error) {
+	if r.Error != nil {
+		type envelope JSONRPCResponse
+		return json.Marshal((*envelope)(r))
+	}
+	return json.Marshal(struct {
+		JSONRPC string      `json:"jsonrpc"`
+		ID      interface{} `json:"id"`
+		Result  interface{} `json:"result"`
+	}{r.JSONRPC, r.ID, r.Result})
+}
+
+// AppendJSON implements jsonx.Appender, writing the envelope as
+// MarshalJSON does
+func (r *JSONRPCResponse) AppendJSON(dst []byte) ([]byte, error) {
+	var err error
+	dst = append(dst, `{"jsonrpc":`...)
+	if dst, err = jsonx.AppendString(dst, r.JSONRPC); err != nil {
+		return dst, err
+	}
+	dst = append(dst, `,"id":`...)
+	if dst, err = jsonx.AppendValue(dst, r.ID); err != nil {
+		return dst, err
+	}
+	if r.Error == nil {
+		dst = append(dst, `,"result":`...)
+		if dst, err = jsonx.AppendValue(dst, r.Result); err != nil {
+			return dst, err
+		}
+	}
+	if r.Error != nil {
+		data, err := json.Marshal(r.Error)
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, `,"error":`...)
+		dst = append(dst, data...)
+	}
+	return append(dst, '}'), nil
+}
+
 // JSONRPCHandler handles JSON-RPC 2.0 requests
 type JSONRPCHandler struct {
 	methods           map[string]*methodHandler
+	namespaces        map[string]bool // namespaces with registered methods
 	rateLimiter       *middleware.RateLimiter
 	slowQueryThreshold time.Duration
+	responseCache     *responseCachePolicy
+	disabled          atomic.Pointer[map[string]bool]
+	accessLog         *middleware.AccessLog
+	recorder          *replay.Recorder
+	codec             jsonx.Codec
+	bindings          map[string]map[string]bool // namespace to the listeners serving it
+	denylist          *middleware.Denylist
+	qos               *middleware.QoS
+	fallback          *Fallback
+	heightPins        *storage.BlockReader // nil unless heights may be pinned
 }
 
-// methodHandler holds information about a registered method
+// methodHandler holds a registered method
 type methodHandler struct {
-	receiver reflect.Value
-	method   reflect.Method
-	argTypes []reflect.Type
+	invoke invoker
 }
 
 // NewJSONRPCHandler creates a new JSON-RPC handler
 func NewJSONRPCHandler(rateLimiter *middleware.RateLimiter, slowQueryThreshold time.Duration) *JSONRPCHandler {
 	return &JSONRPCHandler{
 		methods:           make(map[string]*methodHandler),
+		namespaces:        make(map[string]bool),
 		rateLimiter:       rateLimiter,
 		slowQueryThreshold: slowQueryThreshold,
+		codec:             jsonx.Default,
+	}
+}
+
+// SetDisabledMethods replaces the methods that are registered but refused.
+// It may be called while requests are served.
+func (h *JSONRPCHandler) SetDisabledMethods(methods []string) {
+	disabled := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		disabled[method] = true
+	}
+	h.disabled.Store(&disabled)
+}
+
+// SetAccessLog makes the handler log its calls to accessLog. It must be
+// called before serving.
+func (h *JSONRPCHandler) SetAccessLog(accessLog *middleware.AccessLog) {
+	h.accessLog = accessLog
+}
+
+// SetRecorder makes the handler record sampled calls with their responses
+// for `rpc replay`. It must be called before serving.
+func (h *JSONRPCHandler) SetRecorder(recorder *replay.Recorder) {
+	h.recorder = recorder
+}
+
+// SetDenylist makes the handler refuse calls of banned clients, including
+// those of WebSocket connections opened before the ban. It must be called
+// before serving.
+func (h *JSONRPCHandler) SetDenylist(denylist *middleware.Denylist) {
+	h.denylist = denylist
+}
+
+// SetQoS makes the handler queue and shed calls by priority while the
+// server is saturated. It must be called before serving.
+func (h *JSONRPCHandler) SetQoS(qos *middleware.QoS) {
+	h.qos = qos
+}
+
+// SetCodec replaces the serializer of responses. It must be called before
+// serving.
+func (h *JSONRPCHandler) SetCodec(codec jsonx.Codec) {
+	h.codec = codec
+}
+
+// metricMethod returns the method label of a call. Unregistered methods are
+// counted together, so that clients cannot create metric series at will.
+func (h *JSONRPCHandler) metricMethod(method string) string {
+	if _, ok := h.methods[method]; !ok {
+		return "unknown"
+	}
+	return method
+}
+
+// recordError counts an error response by code
+func (h *JSONRPCHandler) recordError(req *JSONRPCRequest, rpcErr *api.RPCError) {
+	metrics.RecordRPCError(h.metricMethod(req.Method), rpcErr.Code, api.ErrorClass(rpcErr.Code))
+}
+
+// encodeResponse serializes the response to a request, recording its size
+func (h *JSONRPCHandler) encodeResponse(req *JSONRPCRequest, resp *JSONRPCResponse) (json.RawMessage, error) {
+	data, err := h.codec.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	metrics.RecordResponseSize(h.metricMethod(req.Method), len(data))
+	return data, nil
+}
+
+// encodeBatch serializes the responses to a batch, recording the size of
+// each. Notifications are left out; a batch of only notifications has no
+// response and encodes to nil.
+func (h *JSONRPCHandler) encodeBatch(reqs []*JSONRPCRequest, resps []*JSONRPCResponse) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	for i, resp := range resps {
+		if reqs[i].IsNotification() {
+			continue
+		}
+		if buf.Len() == 0 {
+			buf.WriteByte('[')
+		} else {
+			buf.WriteByte(',')
+		}
+		data, err := h.encodeResponse(reqs[i], resp)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
 	}
+	if buf.Len() == 0 {
+		return nil, nil
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// recordAccess writes the access log line of a call
+func (h *JSONRPCHandler) recordAccess(ctx context.Context, req *JSONRPCRequest, clientIP string, duration time.Duration, resp *JSONRPCResponse) {
+	entry := middleware.AccessLogEntry{
+		Method:   req.Method,
+		Params:   req.Params,
+		ClientIP: clientIP,
+		Duration: duration,
+	}
+	if resp.Error != nil {
+		entry.ErrorCode = resp.Error.Code
+	} else if data, err := h.codec.Marshal(resp.Result); err == nil {
+		entry.ResultSize = len(data)
+	}
+	h.accessLog.Record(ctx, entry)
+}
+
+// recordCall hands a call with its response to the recorder, along with
+// the latest block it was served at
+func (h *JSONRPCHandler) recordCall(ctx context.Context, req *JSONRPCRequest, resp *JSONRPCResponse) {
+	call := replay.Call{Method: req.Method, Params: req.Params, Error: resp.Error}
+	if height, ok := storage.PinnedHeight(ctx); ok {
+		call.Height = &height
+	} else if h.heightPins != nil {
+		if head, ok := h.heightPins.LastHead(); ok {
+			call.Height = &head
+		}
+	}
+	if resp.Error == nil {
+		data, err := h.codec.Marshal(resp.Result)
+		if err != nil {
+			return
+		}
+		call.Result = data
+	}
+	h.recorder.Record(ctx, call)
+}
+
+// methodDisabled reports whether a method is turned off in the config
+func (h *JSONRPCHandler) methodDisabled(method string) bool {
+	disabled := h.disabled.Load()
+	return disabled != nil && (*disabled)[method]
 }
 
 // RegisterService registers all methods of a service
@@ -59,25 +290,19 @@ func (h *JSONRPCHandler) RegisterService(namespace string, service interface{})
 
 	for i := 0; i < serviceType.NumMethod(); i++ {
 		method := serviceType.Method(i)
-		methodName := fmt.Sprintf("%s_%s", namespace, method.Name)
+		methodName := rpcMethodName(namespace, method.Name)
 
-		// Validate method signature
+		// Methods without an RPC signature, such as setters used while
+		// wiring services, are not served
 		if !isValidMethod(method) {
-			logger.Warnf("Skipping invalid method: %s", methodName)
+			logger.Debugf("Skipping non-RPC method: %s", methodName)
 			continue
 		}
 
-		// Extract argument types
-		argTypes := make([]reflect.Type, method.Type.NumIn()-1) // -1 to skip receiver
-		for j := 1; j < method.Type.NumIn(); j++ {
-			argTypes[j-1] = method.Type.In(j)
-		}
-
 		h.methods[methodName] = &methodHandler{
-			receiver: serviceValue,
-			method:   method,
-			argTypes: argTypes,
+			invoke: compileMethod(serviceValue, method),
 		}
+		h.namespaces[namespace] = true
 
 		logger.Debugf("Registered RPC method: %s", methodName)
 	}
@@ -85,6 +310,59 @@ func (h *JSONRPCHandler) RegisterService(namespace string, service interface{})
 	return nil
 }
 
+// methodAliases maps further names a method is called by to its registered
+// name
+var methodAliases = map[string]string{
+	"eth_chainID":          "eth_chainId",
+	"eth_signTypedData_v4": "eth_signTypedDataV4",
+}
+
+// rpcMethodName returns the name a Go method is served under: the namespace
+// and the method name with its first letter lowered, e.g. eth_getBalance for
+// GetBalance
+func rpcMethodName(namespace, name string) string {
+	return namespace + "_" + lowerFirst(name)
+}
+
+// lowerFirst lowers the first letter of s
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError || unicode.IsLower(r) {
+		return s
+	}
+	return string(unicode.ToLower(r)) + s[size:]
+}
+
+// canonicalMethod returns the registered name of a requested method,
+// resolving aliases and the Go casing of its first letter, e.g.
+// eth_GetBalance. Unknown methods are returned unchanged.
+func (h *JSONRPCHandler) canonicalMethod(method string) string {
+	if _, ok := h.methods[method]; ok {
+		return method
+	}
+	name := method
+	if namespace, rest, ok := strings.Cut(method, "_"); ok {
+		name = namespace + "_" + lowerFirst(rest)
+	}
+	if alias, ok := methodAliases[name]; ok {
+		name = alias
+	}
+	if _, ok := h.methods[name]; ok {
+		return name
+	}
+	return method
+}
+
+// Methods returns the sorted names of the registered methods
+func (h *JSONRPCHandler) Methods() []string {
+	names := make([]string, 0, len(h.methods))
+	for name := range h.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // isValidMethod checks if a method has a valid signature for RPC
 // Valid signature: func(ctx context.Context, args...) (result, error)
 func isValidMethod(method reflect.Method) bool {
@@ -114,9 +392,50 @@ func isValidMethod(method reflect.Method) bool {
 }
 
 // HandleRequest handles a single JSON-RPC request
-func (h *JSONRPCHandler) HandleRequest(ctx context.Context, req *JSONRPCRequest, clientIP string) *JSONRPCResponse {
-	// Validate JSON-RPC version
+func (h *JSONRPCHandler) HandleRequest(ctx context.Context, req *JSONRPCRequest, clientIP string) (resp *JSONRPCResponse) {
+	received := time.Now()
+	req.Method = h.canonicalMethod(req.Method)
+	ctx, span := tracing.StartSpan(ctx, req.Method, trace.SpanKindServer,
+		attribute.String("rpc.system", "jsonrpc"),
+		attribute.String("rpc.method", req.Method),
+		attribute.String("rpc.jsonrpc.request_id", fmt.Sprint(req.ID)),
+	)
+	defer func() {
+		var err error
+		if resp.Error != nil {
+			span.SetAttributes(attribute.Int("rpc.jsonrpc.error_code", resp.Error.Code))
+			err = resp.Error
+			h.recordError(req, resp.Error)
+		}
+		tracing.EndSpan(span, err)
+
+		if h.accessLog != nil && h.accessLog.Sampled(req.Method) {
+			h.recordAccess(ctx, req, clientIP, time.Since(received), resp)
+		}
+		if h.recorder != nil && !req.invalid && req.Method != "" && h.recorder.Sampled(req.Method) {
+			h.recordCall(ctx, req, resp)
+		}
+	}()
+
+	// Every line logged while handling the call carries its request ID and
+	// JSON-RPC id
+	log := logger.FromContext(ctx).With("rpc_id", req.ID)
+	ctx = logger.NewContext(middleware.WithClientIP(ctx, clientIP), log)
+	if id := middleware.RequestIDFromContext(ctx); id != "" {
+		span.SetAttributes(attribute.String("request_id", id))
+	}
+
+	// Validate the request object
+	if req.invalid || req.Method == "" {
+		metrics.RecordInvalidRequest()
+		return &JSONRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error:   api.NewRPCError(api.ErrCodeInvalidRequest, "invalid request"),
+		}
+	}
 	if req.JSONRPC != "2.0" {
+		metrics.RecordInvalidRequest()
 		return &JSONRPCResponse{
 			JSONRPC: "2.0",
 			ID:      req.ID,
@@ -124,21 +443,43 @@ func (h *JSONRPCHandler) HandleRequest(ctx context.Context, req *JSONRPCRequest,
 		}
 	}
 
+	// Banned clients are refused before they count against rate limits.
+	// The private listener is exempt, so that operators can lift bans.
+	if h.denylist != nil && listenerFromContext(ctx) != ListenerPrivate {
+		if ban := h.denylist.Banned(clientIP, middleware.APIKeyFromContext(ctx)); ban != nil {
+			return &JSONRPCResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error:   banError(ban),
+			}
+		}
+	}
+
 	// Check rate limit
 	if h.rateLimiter != nil {
-		allowed, limitType := h.rateLimiter.Allow(clientIP, req.Method)
+		allowed, limitType, delay := h.rateLimiter.Allow(clientIP, req.Method)
 		if !allowed {
 			return &JSONRPCResponse{
 				JSONRPC: "2.0",
 				ID:      req.ID,
-				Error:   api.NewRPCError(api.ErrCodeLimitExceeded, fmt.Sprintf("rate limit exceeded: %s", limitType)),
+				Error: &api.RPCError{
+					Code:    api.ErrCodeLimitExceeded,
+					Message: fmt.Sprintf("rate limit exceeded: %s", limitType),
+					Data: map[string]interface{}{
+						"reason":     "rate_limited",
+						"limit":      limitType,
+						"retryAfter": middleware.RetryAfterSeconds(delay),
+					},
+				},
 			}
 		}
 	}
 
 	// Find method handler
-	handler, exists := h.methods[req.Method]
-	if !exists {
+	// Unregistered methods are proxied to the upstream fallback if it
+	// takes them; disabled and unbound ones are refused all the same
+	handler := h.methods[req.Method]
+	if (handler == nil && !h.proxied(req.Method)) || h.methodDisabled(req.Method) || !h.methodBound(ctx, req.Method) {
 		return &JSONRPCResponse{
 			JSONRPC: "2.0",
 			ID:      req.ID,
@@ -146,30 +487,57 @@ func (h *JSONRPCHandler) HandleRequest(ctx context.Context, req *JSONRPCRequest,
 		}
 	}
 
+	// While saturated, calls wait for a slot by priority and the least
+	// urgent are shed. The private listener is always served.
+	if h.qos != nil && listenerFromContext(ctx) != ListenerPrivate {
+		priority := h.qos.Classify(req.Method, middleware.APIKeyFromContext(ctx))
+		release, err := h.qos.Acquire(ctx, priority)
+		if err != nil {
+			resp = &JSONRPCResponse{JSONRPC: "2.0", ID: req.ID}
+			if err == middleware.ErrShed {
+				resp.Error = &api.RPCError{
+					Code:    api.ErrCodeLimitExceeded,
+					Message: "server busy",
+					Data:    map[string]string{"reason": "server_busy", "class": priority.String()},
+				}
+			} else {
+				resp.Error = api.NewRPCError(api.ErrCodeResourceUnavail, "request timed out")
+			}
+			return resp
+		}
+		defer release()
+	}
+
 	// Track in-flight requests
-	metrics.RecordInFlight(req.Method, 1)
-	defer metrics.RecordInFlight(req.Method, -1)
+	metrics.RecordInFlight(h.metricMethod(req.Method), 1)
+	defer metrics.RecordInFlight(h.metricMethod(req.Method), -1)
 
 	// Execute method
+	ctx = storage.TrackUnavailable(ctx)
 	start := time.Now()
-	result, err := h.executeMethod(ctx, handler, req.Params)
+	result, err := h.execute(ctx, handler, req)
 	duration := time.Since(start)
 
 	// Log request
-	middleware.LogRPCRequest(req.Method, req.Params)
-	middleware.LogRPCResponse(req.Method, duration, err)
-	middleware.LogSlowRPCRequest(req.Method, duration, h.slowQueryThreshold)
-	middleware.RecordRPCMetrics(req.Method, duration, err)
+	middleware.LogRPCRequest(log, req.Method, req.Params)
+	middleware.LogRPCResponse(log, req.Method, duration, err)
+	middleware.LogSlowRPCRequest(log, req.Method, duration, h.slowQueryThreshold)
+	middleware.RecordRPCMetrics(h.metricMethod(req.Method), duration, err)
 
 	// Build response
-	resp := &JSONRPCResponse{
+	resp = &JSONRPCResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
 	}
 
 	if err != nil {
-		// Check if error is already an RPCError
-		if rpcErr, ok := err.(*api.RPCError); ok {
+		// Storage failing fast takes precedence over the error the method
+		// derived from it
+		if storage.WasUnavailable(ctx) {
+			resp.Error = api.NewRPCError(api.ErrCodeResourceUnavail, "storage temporarily unavailable")
+		} else if ctx.Err() == context.DeadlineExceeded {
+			resp.Error = api.NewRPCError(api.ErrCodeResourceUnavail, "request timed out")
+		} else if rpcErr, ok := err.(*api.RPCError); ok {
 			resp.Error = rpcErr
 		} else {
 			resp.Error = &api.RPCError{
@@ -184,73 +552,46 @@ func (h *JSONRPCHandler) HandleRequest(ctx context.Context, req *JSONRPCRequest,
 	return resp
 }
 
-// executeMethod executes a method with the given parameters
-func (h *JSONRPCHandler) executeMethod(ctx context.Context, handler *methodHandler, params json.RawMessage) (interface{}, error) {
-	// Parse parameters
-	args := make([]reflect.Value, len(handler.argTypes))
-	
-	// First argument is always context
-	args[0] = reflect.ValueOf(ctx)
-
-	// Parse remaining arguments
-	if len(handler.argTypes) > 1 {
-		// Unmarshal params into slice or struct
-		var paramList []json.RawMessage
-		
-		// Try to unmarshal as array first
-		if err := json.Unmarshal(params, &paramList); err != nil {
-			// If that fails, wrap it in an array
-			paramList = []json.RawMessage{params}
-		}
-
-		// Create arguments from param list
-		for i := 1; i < len(handler.argTypes); i++ {
-			argType := handler.argTypes[i]
-			arg := reflect.New(argType)
-
-			if i-1 < len(paramList) {
-				if err := json.Unmarshal(paramList[i-1], arg.Interface()); err != nil {
-					return nil, api.NewRPCError(api.ErrCodeInvalidParams, fmt.Sprintf("invalid param %d: %v", i, err))
-				}
-			}
-
-			args[i] = arg.Elem()
-		}
+// callMethod executes a method, serving immutable results from the shared
+// response cache when one is enabled
+func (h *JSONRPCHandler) callMethod(ctx context.Context, handler *methodHandler, req *JSONRPCRequest) (interface{}, error) {
+	if h.responseCache == nil {
+		return invokeRecovered(ctx, handler, req)
 	}
-
-	// Call method
-	results := handler.method.Func.Call(append([]reflect.Value{handler.receiver}, args...))
-
-	// Extract results
-	var result interface{}
-	var err error
-
-	// Check first result (can be any type)
-	if results[0].IsValid() {
-		// Only check IsNil for types that can be nil (pointers, interfaces, slices, maps, channels, funcs)
-		kind := results[0].Kind()
-		if kind == reflect.Ptr || kind == reflect.Interface || kind == reflect.Slice || 
-		   kind == reflect.Map || kind == reflect.Chan || kind == reflect.Func {
-			if results[0].CanInterface() && !results[0].IsNil() {
-				result = results[0].Interface()
-			}
-		} else if results[0].CanInterface() {
-			// For non-nillable types, just get the value
-			result = results[0].Interface()
-		}
+	call := h.responseCache.prepare(req)
+	if call == nil {
+		return invokeRecovered(ctx, handler, req)
 	}
 
-	// Check second result (error interface, can always be nil)
-	if results[1].IsValid() && results[1].CanInterface() && !results[1].IsNil() {
-		err = results[1].Interface().(error)
+	if cached, ok := h.responseCache.lookup(ctx, req.Method, call); ok {
+		return cached, nil
 	}
 
+	result, err := invokeRecovered(ctx, handler, req)
+	if err == nil {
+		h.responseCache.store(ctx, req.Method, call, result)
+	}
 	return result, err
 }
 
+// invokeRecovered invokes a method, turning a panic into an internal error
+// so that it fails the call but not the connection serving it
+func invokeRecovered(ctx context.Context, handler *methodHandler, req *JSONRPCRequest) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			metrics.RecordPanic(req.Method)
+			logger.FromContext(ctx).Errorf("Panic in %s: %v\n%s", req.Method, r, debug.Stack())
+			result, err = nil, api.NewRPCError(api.ErrCodeInternal, "internal error")
+		}
+	}()
+	return handler.invoke(ctx, req.Params)
+}
+
 // HandleBatch handles a batch of JSON-RPC requests
 func (h *JSONRPCHandler) HandleBatch(ctx context.Context, requests []*JSONRPCRequest, clientIP string) []*JSONRPCResponse {
 	metrics.RecordBatchRequest(len(requests))
+	ctx, span := tracing.StartSpan(ctx, "batch", trace.SpanKindServer, attribute.Int("rpc.batch.size", len(requests)))
+	defer span.End()
 
 	responses := make([]*JSONRPCResponse, len(requests))
 	for i, req := range requests {
@@ -260,23 +601,62 @@ func (h *JSONRPCHandler) HandleBatch(ctx context.Context, requests []*JSONRPCReq
 	return responses
 }
 
-// ParseRequest parses a JSON-RPC request from raw bytes
+// banError answers the calls of a banned client, telling how long until a
+// temporary ban ends
+func banError(ban *storage.Ban) *api.RPCError {
+	data := map[string]interface{}{"reason": "banned"}
+	if ban.ExpiresAt != 0 {
+		data["retryAfter"] = middleware.RetryAfterSeconds(time.Until(time.Unix(ban.ExpiresAt, 0)))
+	}
+	return &api.RPCError{Code: api.ErrCodeLimitExceeded, Message: "client is banned", Data: data}
+}
+
+// requestError returns the error answering a request that could not be
+// parsed, counting it as a parse error or an invalid request
+func requestError(err error) *api.RPCError {
+	rpcErr, ok := err.(*api.RPCError)
+	if !ok {
+		rpcErr = api.NewRPCError(api.ErrCodeParse, err.Error())
+	}
+	if rpcErr.Code == api.ErrCodeParse {
+		metrics.RecordParseError()
+	} else {
+		metrics.RecordInvalidRequest()
+	}
+	return rpcErr
+}
+
+// ParseRequest parses a JSON-RPC request or batch from raw bytes. Entries
+// of a batch that are not request objects are kept, marked invalid, so that
+// they are answered with an error in place while the others still run.
 func ParseRequest(data []byte) (interface{}, error) {
-	// Try to parse as single request first
-	var single JSONRPCRequest
-	if err := json.Unmarshal(data, &single); err == nil && single.JSONRPC != "" {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '[' {
+		var single JSONRPCRequest
+		if err := json.Unmarshal(data, &single); err != nil {
+			if !json.Valid(data) {
+				return nil, api.NewRPCError(api.ErrCodeParse, "failed to parse request")
+			}
+			return nil, api.NewRPCError(api.ErrCodeInvalidRequest, "invalid request")
+		}
 		return &single, nil
 	}
 
-	// Try to parse as batch request
-	var batch []*JSONRPCRequest
-	if err := json.Unmarshal(data, &batch); err != nil {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
 		return nil, api.NewRPCError(api.ErrCodeParse, "failed to parse request")
 	}
-
-	if len(batch) == 0 {
+	if len(entries) == 0 {
 		return nil, api.NewRPCError(api.ErrCodeInvalidRequest, "empty batch request")
 	}
 
+	batch := make([]*JSONRPCRequest, len(entries))
+	for i, entry := range entries {
+		req := new(JSONRPCRequest)
+		if err := json.Unmarshal(entry, req); err != nil {
+			req = &JSONRPCRequest{invalid: true}
+		}
+		batch[i] = req
+	}
 	return batch, nil
 }
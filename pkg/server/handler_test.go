@@ -0,0 +1,60 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/accounts"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/api/eth"
+	"github.com/sunvim/evm_rpc/pkg/jsonx"
+)
+
+func TestResponseEncoding(t *testing.T) {
+	std, ok := jsonx.Lookup(jsonx.CodecStd)
+	if !ok {
+		t.Fatal("std codec is not registered")
+	}
+
+	tests := []struct {
+		name string
+		resp *JSONRPCResponse
+		want string
+	}{
+		{"result", &JSONRPCResponse{JSONRPC: "2.0", ID: float64(1), Result: "0x1"}, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`},
+		{"null result", &JSONRPCResponse{JSONRPC: "2.0", ID: float64(1)}, `{"jsonrpc":"2.0","id":1,"result":null}`},
+		{"error", &JSONRPCResponse{JSONRPC: "2.0", ID: nil, Error: api.NewRPCError(api.ErrCodeInvalidParams, "invalid params")},
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32602,"message":"invalid params"}}`},
+	}
+	for _, tt := range tests {
+		for name, codec := range map[string]jsonx.Codec{jsonx.CodecFast: jsonx.Default, jsonx.CodecStd: std} {
+			data, err := codec.Marshal(tt.resp)
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, tt.name, err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("%s %s = %s, want %s", name, tt.name, data, tt.want)
+			}
+		}
+	}
+}
+
+func TestMethodAliases(t *testing.T) {
+	handler := NewJSONRPCHandler(nil, time.Minute)
+	accountAPI := eth.NewAccountAPI(accounts.NewStaticKeys(nil), eth.NewTxPoolAPI(nil, nil, nil, nil, nil, testChainID))
+	for _, service := range []interface{}{eth.NewSyncAPI(nil, testChainID), accountAPI} {
+		if err := handler.RegisterService("eth", service); err != nil {
+			t.Fatalf("RegisterService: %v", err)
+		}
+	}
+
+	for alias, target := range methodAliases {
+		if _, ok := handler.methods[target]; !ok {
+			t.Errorf("alias %s targets %s, which is not registered", alias, target)
+			continue
+		}
+		if got := handler.canonicalMethod(alias); got != target {
+			t.Errorf("canonicalMethod(%s) = %s, want %s", alias, got, target)
+		}
+	}
+}
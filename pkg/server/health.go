@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// Health statuses reported by /health
+const (
+	HealthOK          = "ok"
+	HealthDegraded    = "degraded"
+	HealthUnavailable = "unavailable"
+)
+
+// HealthChecker reports whether a chain is served with fresh data. It tracks
+// the timestamp of the last ingested block and compares its age against the
+// maximum lag.
+type HealthChecker struct {
+	blockReader *storage.BlockReader
+	pika        *storage.PikaClient
+	maxLag      time.Duration
+
+	mu       sync.Mutex
+	head     uint64
+	headTime time.Time
+}
+
+// NewHealthChecker creates a health checker. A zero maxLag never reports the
+// chain as lagging.
+func NewHealthChecker(blockReader *storage.BlockReader, pika *storage.PikaClient, maxLag time.Duration) *HealthChecker {
+	return &HealthChecker{
+		blockReader: blockReader,
+		pika:        pika,
+		maxLag:      maxLag,
+	}
+}
+
+// HealthReport is the body of /health
+type HealthReport struct {
+	Status      string `json:"status"`
+	LatestBlock uint64 `json:"latestBlock,omitempty"`
+	BlockTime   int64  `json:"blockTime,omitempty"`
+	Lag         string `json:"lag,omitempty"`
+	MaxLag      string `json:"maxLag,omitempty"`
+	Storage     string `json:"storage,omitempty"` // degraded while Pika is unreachable
+	Error       string `json:"error,omitempty"`
+}
+
+// Check reports the status of the chain and how far its latest block is
+// behind the wall clock. While Pika is unreachable and cached data is
+// served, the chain is degraded at best.
+func (h *HealthChecker) Check(ctx context.Context) HealthReport {
+	availability := h.pika.Availability()
+	latest, headTime, err := h.Head(ctx)
+	if err != nil {
+		return HealthReport{Status: HealthUnavailable, LatestBlock: latest, Storage: availability.State(), Error: err.Error()}
+	}
+
+	lag := headLag(headTime)
+	report := HealthReport{
+		Status:      HealthOK,
+		LatestBlock: latest,
+		BlockTime:   headTime.Unix(),
+		Lag:         lag.Round(time.Second).String(),
+	}
+	if h.maxLag > 0 {
+		report.MaxLag = h.maxLag.String()
+		if lag > h.maxLag {
+			report.Status = HealthDegraded
+		}
+	}
+	if availability.Degraded() {
+		report.Status = HealthDegraded
+		report.Storage = availability.State()
+		report.Error = "storage unreachable since " + availability.Since().UTC().Format(time.RFC3339) + ", serving cached data"
+	}
+	return report
+}
+
+// Head returns the number and timestamp of the latest ingested block
+func (h *HealthChecker) Head(ctx context.Context) (uint64, time.Time, error) {
+	latest, err := h.blockReader.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	headTime, err := h.headTimestamp(ctx, latest)
+	return latest, headTime, err
+}
+
+// headLag returns how far a head timestamp is behind the wall clock. Clocks
+// of block producers may run slightly ahead.
+func headLag(headTime time.Time) time.Duration {
+	return max(time.Since(headTime), 0)
+}
+
+// headTimestamp returns the timestamp of block number, read from storage
+// only when the head has moved
+func (h *HealthChecker) headTimestamp(ctx context.Context, number uint64) (time.Time, error) {
+	h.mu.Lock()
+	if number == h.head && !h.headTime.IsZero() {
+		defer h.mu.Unlock()
+		return h.headTime, nil
+	}
+	h.mu.Unlock()
+
+	header, err := h.blockReader.GetHeader(ctx, number)
+	if err != nil {
+		return time.Time{}, err
+	}
+	headTime := time.Unix(int64(header.Time), 0)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if number >= h.head {
+		h.head, h.headTime = number, headTime
+	}
+	return headTime, nil
+}
+
+// Ready returns an error unless Pika can be reached
+func (h *HealthChecker) Ready(ctx context.Context) error {
+	return h.pika.Ping(ctx)
+}
+
+// BuildInfo identifies the running build
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"goVersion"`
+}
+
+// healthRoutes serves the health endpoints of the default chain and of
+// further chains under /chain/{name} or their hosts
+type healthRoutes struct {
+	health *HealthChecker
+	chains *chainRouter
+}
+
+// register adds the health endpoints to router
+func (h *healthRoutes) register(router *mux.Router) {
+	router.HandleFunc("/health", h.handleHealth).Methods("GET")
+	router.HandleFunc("/healthz", h.handleLiveness).Methods("GET")
+	router.HandleFunc("/readyz", h.handleReadiness).Methods("GET")
+	router.HandleFunc(chainPathPrefix+"{chain}/health", h.handleHealth).Methods("GET")
+	router.HandleFunc(chainPathPrefix+"{chain}/readyz", h.handleReadiness).Methods("GET")
+}
+
+// checker returns the health checker of the chain a request is for,
+// writing a 404 response for unknown chains
+func (h *healthRoutes) checker(w http.ResponseWriter, r *http.Request) (*HealthChecker, bool) {
+	chain, ok := h.chains.route(r)
+	if !ok {
+		http.Error(w, "unknown chain", http.StatusNotFound)
+		return nil, false
+	}
+	if chain == nil {
+		return h.health, true
+	}
+	return chain.Health, true
+}
+
+// handleHealth reports the sync status of a chain, with 503 when it is
+// lagging or its storage fails
+func (h *healthRoutes) handleHealth(w http.ResponseWriter, r *http.Request) {
+	checker, ok := h.checker(w, r)
+	if !ok {
+		return
+	}
+
+	report := checker.Check(r.Context())
+	status := http.StatusOK
+	if report.Status != HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// handleLiveness answers as long as the process serves requests
+func (h *healthRoutes) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": HealthOK})
+}
+
+// handleReadiness reports whether the chain's storage can be reached, so
+// that traffic is only routed to instances able to answer it
+func (h *healthRoutes) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	checker, ok := h.checker(w, r)
+	if !ok {
+		return
+	}
+
+	if err := checker.Ready(r.Context()); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": HealthUnavailable, "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": HealthOK})
+}
+
+// HealthServer serves the health endpoints and build info on a listener of
+// their own, so that probes bypass rate limiting and CORS
+type HealthServer struct {
+	server *http.Server
+	routes *healthRoutes
+	addr   string
+	errCh  chan error
+}
+
+// NewHealthServer creates a health server for the default chain
+func NewHealthServer(cfg config.HealthConfig, health *HealthChecker, build BuildInfo) *HealthServer {
+	s := &HealthServer{
+		routes: &healthRoutes{health: health, chains: newChainRouter()},
+		addr:   cfg.ListenAddr,
+		errCh:  make(chan error, 1),
+	}
+
+	router := mux.NewRouter()
+	s.routes.register(router)
+	router.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, build)
+	}).Methods("GET")
+
+	s.server = &http.Server{
+		Addr:         cfg.ListenAddr,
+		Handler:      router,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+	return s
+}
+
+// AddChain serves the health of a further chain. It must be called before
+// Start.
+func (s *HealthServer) AddChain(chain *Chain) {
+	s.routes.chains.add(chain)
+}
+
+// Start binds the listener and serves health checks in the background
+func (s *HealthServer) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("health server failed: %w", err)
+	}
+
+	logger.Infof("Starting health server on %s", s.addr)
+	go func() {
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.errCh <- fmt.Errorf("health server failed: %w", err)
+		}
+	}()
+	return nil
+}
+
+// Err returns a channel receiving serve failures after Start
+func (s *HealthServer) Err() <-chan error {
+	return s.errCh
+}
+
+// Stop gracefully shuts down the health server
+func (s *HealthServer) Stop(ctx context.Context) error {
+	logger.Info("Stopping health server...")
+	return s.server.Shutdown(ctx)
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -5,48 +5,80 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/rs/cors"
 	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/api/admin"
 	"github.com/sunvim/evm_rpc/pkg/config"
 	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
 	"github.com/sunvim/evm_rpc/pkg/middleware"
-	"github.com/sunvim/evm_rpc/pkg/storage"
+	"github.com/sunvim/evm_rpc/pkg/tracing"
 )
 
 // HTTPServer represents an HTTP JSON-RPC server
 type HTTPServer struct {
-	server      *http.Server
-	handler     *JSONRPCHandler
-	blockReader *storage.BlockReader
-	config      config.HTTPConfig
+	server         *http.Server
+	handler        *JSONRPCHandler
+	config         config.HTTPConfig
+	chains         *chainRouter
+	errCh          chan error
+	requestTimeout time.Duration // deadline of a request's calls, 0 if none
+	listener       string        // listener name namespaces are bound to
+
+	inFlight  atomic.Int64 // requests being handled, reported on shutdown
+	listening atomic.Bool
+
+	// connsMu guards conns, the state of every open connection
+	connsMu sync.Mutex
+	conns   map[net.Conn]http.ConnState
+
+	// Server-Sent Event streams, see EnableEvents; eventsDone is closed
+	// on Stop to end them
+	events     *SubscriptionManager
+	maxStreams int
+	streams    atomic.Int64
+	eventsDone chan struct{}
 }
 
 // NewHTTPServer creates a new HTTP server
 func NewHTTPServer(
 	cfg config.HTTPConfig,
 	handler *JSONRPCHandler,
-	blockReader *storage.BlockReader,
+	health *HealthChecker,
 	rateLimiter *middleware.RateLimiter,
+	denylist *middleware.Denylist,
 	loggingMiddleware *middleware.LoggingMiddleware,
-	corsMiddleware *cors.Cors,
+	corsMiddleware *middleware.CORS,
 ) *HTTPServer {
 	router := mux.NewRouter()
 
 	httpServer := &HTTPServer{
-		handler:     handler,
-		blockReader: blockReader,
-		config:      cfg,
+		handler:        handler,
+		config:         cfg,
+		chains:         newChainRouter(),
+		errCh:          make(chan error, 1),
+		requestTimeout: requestTimeout(cfg),
+		listener:       ListenerHTTP,
+		conns:          make(map[net.Conn]http.ConnState),
+		eventsDone:     make(chan struct{}),
 	}
 
-	// Health check endpoint
-	router.HandleFunc("/health", httpServer.handleHealth).Methods("GET")
+	// Health check endpoints
+	(&healthRoutes{health: health, chains: httpServer.chains}).register(router)
 
 	// JSON-RPC endpoint
 	router.HandleFunc("/", httpServer.handleRPC).Methods("POST")
+	router.HandleFunc(chainPathPrefix+"{chain}", httpServer.handleRPC).Methods("POST")
+
+	// Server-Sent Events, if enabled
+	router.HandleFunc("/events", httpServer.handleEvents).Methods("GET")
+	router.HandleFunc(chainPathPrefix+"{chain}/events", httpServer.handleEvents).Methods("GET")
 
 	// Apply middleware
 	var h http.Handler = router
@@ -56,16 +88,27 @@ func NewHTTPServer(
 		h = corsMiddleware.Handler(h)
 	}
 
+	// Requests for other hosts are refused before CORS applies
+	h = middleware.VirtualHosts(cfg.VHosts)(h)
+
 	// Rate limiting middleware
 	if rateLimiter != nil {
 		h = rateLimiter.Middleware()(h)
 	}
 
+	// Banned clients are refused before rate limiting
+	if denylist != nil {
+		h = denylist.Middleware()(h)
+	}
+
 	// Logging middleware (innermost)
 	if loggingMiddleware != nil {
 		h = loggingMiddleware.Middleware()(h)
 	}
 
+	// Request IDs are assigned first, so that every log line carries them
+	h = middleware.RequestIDMiddleware(h)
+
 	httpServer.server = &http.Server{
 		Addr:           cfg.ListenAddr,
 		Handler:        h,
@@ -73,69 +116,138 @@ func NewHTTPServer(
 		WriteTimeout:   cfg.WriteTimeout,
 		IdleTimeout:    cfg.IdleTimeout,
 		MaxHeaderBytes: cfg.MaxHeaderBytes,
+		ConnState:      httpServer.trackConn,
 	}
 
 	return httpServer
 }
 
-// Start starts the HTTP server
-func (s *HTTPServer) Start() error {
-	logger.Infof("Starting HTTP server on %s", s.config.ListenAddr)
-	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+// requestTimeout returns the deadline of the calls of a request: the
+// configured one, or else a tenth short of the write timeout, so that the
+// error still reaches the client before the connection is cut
+func requestTimeout(cfg config.HTTPConfig) time.Duration {
+	if cfg.RequestTimeout > 0 {
+		return cfg.RequestTimeout
+	}
+	return cfg.WriteTimeout - cfg.WriteTimeout/10
+}
+
+// SetListener names the listener the server is for namespace bindings,
+// http by default. It must be called before Start.
+func (s *HTTPServer) SetListener(listener string) {
+	s.listener = listener
+}
+
+// AddChain serves a further chain. It must be called before Start.
+func (s *HTTPServer) AddChain(chain *Chain) {
+	s.chains.add(chain)
+}
+
+// route returns the handler of the chain a request is for, writing a 404
+// response for unknown chains
+func (s *HTTPServer) route(w http.ResponseWriter, r *http.Request) (*JSONRPCHandler, bool) {
+	chain, ok := s.chains.route(r)
+	if !ok {
+		http.Error(w, "unknown chain", http.StatusNotFound)
+		return nil, false
+	}
+	if chain == nil {
+		return s.handler, true
+	}
+	return chain.Handler, true
+}
+
+// Start binds the listener and serves HTTP requests in the background
+func (s *HTTPServer) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.config.ListenAddr)
+	if err != nil {
 		return fmt.Errorf("HTTP server failed: %w", err)
 	}
+
+	logger.Infof("Starting HTTP server on %s", s.config.ListenAddr)
+	s.listening.Store(true)
+	go func() {
+		err := s.server.Serve(ln)
+		s.listening.Store(false)
+		if err != nil && err != http.ErrServerClosed {
+			s.errCh <- fmt.Errorf("HTTP server failed: %w", err)
+		}
+	}()
 	return nil
 }
 
-// Stop gracefully shuts down the HTTP server
+// Err returns a channel receiving serve failures after Start
+func (s *HTTPServer) Err() <-chan error {
+	return s.errCh
+}
+
+// Listening reports whether the server accepts connections
+func (s *HTTPServer) Listening() bool {
+	return s.listening.Load()
+}
+
+// Stop drains the HTTP server: it stops accepting connections, waits for
+// requests in flight until ctx is done and then cuts those left
 func (s *HTTPServer) Stop(ctx context.Context) error {
-	logger.Info("Stopping HTTP server...")
-	return s.server.Shutdown(ctx)
+	s.listening.Store(false)
+	inFlight := s.inFlight.Load()
+	logger.Infof("Stopping HTTP server with %d requests in flight...", inFlight)
+	// Event streams never finish on their own
+	close(s.eventsDone)
+	if err := s.server.Shutdown(ctx); err != nil {
+		left := s.inFlight.Load()
+		logger.Warnf("HTTP drain timed out, cutting %d requests in flight", left)
+		s.server.Close()
+		return err
+	}
+	logger.Infof("HTTP server drained: %d requests in flight finished", inFlight)
+	return nil
 }
 
-// handleHealth handles health check requests
-func (s *HTTPServer) handleHealth(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+// trackConn records the state of a connection
+func (s *HTTPServer) trackConn(conn net.Conn, state http.ConnState) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		delete(s.conns, conn)
+	default:
+		s.conns[conn] = state
+	}
+}
 
-	// Get latest block number to check if we're synced
-	latestBlock, err := s.blockReader.GetLatestBlockNumber(ctx)
-	
-	health := map[string]interface{}{
-		"status": "ok",
-		"syncing": false,
+// ConnectionStats counts the open connections by state and client
+func (s *HTTPServer) ConnectionStats() admin.HTTPConnections {
+	stats := admin.HTTPConnections{
+		Listener: s.listener,
+		Addr:     s.config.ListenAddr,
+		Clients:  make(map[string]int),
 	}
 
-	if err != nil {
-		health["status"] = "degraded"
-		health["error"] = err.Error()
-	} else {
-		health["latestBlock"] = latestBlock
-		
-		// Get the latest block to check its timestamp
-		block, blockErr := s.blockReader.GetBlock(ctx, latestBlock)
-		if blockErr == nil && block.Time() > 0 {
-			// Validate timestamp is reasonable (not in far future)
-			blockTimestamp := block.Time()
-			if blockTimestamp < uint64(time.Now().Add(time.Hour).Unix()) {
-				blockTime := time.Unix(int64(blockTimestamp), 0)
-				timeSinceBlock := time.Since(blockTime)
-				
-				// If the latest block is older than 5 minutes, consider it as syncing
-				if timeSinceBlock > 5*time.Minute {
-					health["syncing"] = true
-					health["timeSinceBlock"] = timeSinceBlock.String()
-				}
-			}
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	for conn, state := range s.conns {
+		stats.Open++
+		if state == http.StateActive {
+			stats.Active++
+		} else {
+			stats.Idle++
 		}
+		stats.Clients[stripPort(conn.RemoteAddr().String())]++
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(health)
+	return stats
 }
 
 // handleRPC handles JSON-RPC requests
 func (s *HTTPServer) handleRPC(w http.ResponseWriter, r *http.Request) {
+	s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+
+	handler, ok := s.route(w, r)
+	if !ok {
+		return
+	}
+
 	// Read request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -147,35 +259,95 @@ func (s *HTTPServer) handleRPC(w http.ResponseWriter, r *http.Request) {
 	// Parse request
 	req, err := ParseRequest(body)
 	if err != nil {
-		sendJSONRPCError(w, nil, -32700, err.Error())
+		rpcErr := requestError(err)
+		sendJSONRPCError(w, nil, rpcErr.Code, rpcErr.Message)
 		return
 	}
 
 	// Extract client IP
 	clientIP := extractIP(r)
 
-	// Handle request based on type
-	var response interface{}
-	ctx := r.Context()
+	// Handle request based on type. The request's context is canceled when
+	// the client goes away, which aborts the storage reads of its calls;
+	// the deadline bounds them when it stays.
+	var response json.RawMessage
+	ctx := withListener(tracing.Extract(r.Context(), r.Header), s.listener)
+	ctx = middleware.WithAPIKey(ctx, middleware.APIKey(r))
+	ctx = middleware.WithIdempotencyKey(ctx, middleware.IdempotencyKey(r))
+	if s.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.requestTimeout)
+		defer cancel()
+	}
+
+	// Every call of the request reads latest at the pinned height, if any
+	if height := r.Header.Get(middleware.BlockHeightHeader); height != "" {
+		var rpcErr *api.RPCError
+		if ctx, rpcErr = handler.pinHeight(ctx, height); rpcErr != nil {
+			sendJSONRPCError(w, nil, rpcErr.Code, rpcErr.Message)
+			return
+		}
+	}
 
 	switch v := req.(type) {
 	case *JSONRPCRequest:
-		// Single request
-		response = s.handler.HandleRequest(ctx, v, clientIP)
+		// Single request; notifications run but get no response
+		resp := handler.HandleRequest(ctx, v, clientIP)
+		if aborted(ctx, r) {
+			return
+		}
+		if v.IsNotification() {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		response, err = handler.encodeResponse(v, resp)
 	case []*JSONRPCRequest:
 		// Batch request
-		response = s.handler.HandleBatch(ctx, v, clientIP)
+		responses := handler.HandleBatch(ctx, v, clientIP)
+		if aborted(ctx, r) {
+			return
+		}
+		response, err = handler.encodeBatch(v, responses)
 	default:
+		metrics.RecordInvalidRequest()
 		sendJSONRPCError(w, nil, -32600, "invalid request")
 		return
 	}
+	if err != nil {
+		logger.Errorf("Failed to encode response: %v", err)
+		sendJSONRPCError(w, nil, api.ErrCodeInternal, "failed to encode response")
+		return
+	}
+	if response == nil {
+		// A batch of only notifications
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 
 	// Send response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		logger.Errorf("Failed to encode response: %v", err)
+	writeRPCResponse(w, response)
+}
+
+// aborted records a request whose calls were cut short, and reports whether
+// its client went away, in which case no response is written. Calls cut by
+// the deadline are answered with their error.
+func aborted(ctx context.Context, r *http.Request) bool {
+	switch {
+	case r.Context().Err() != nil:
+		metrics.RecordAbortedRequest("client_gone")
+		return true
+	case ctx.Err() == context.DeadlineExceeded:
+		metrics.RecordAbortedRequest("timeout")
 	}
+	return false
+}
+
+// writeRPCResponse writes a serialized JSON-RPC response, counting its bytes
+func writeRPCResponse(w http.ResponseWriter, response []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // JSON-RPC always returns 200
+	n, _ := w.Write(append(response, '\n'))
+	metrics.RecordEgress("http", n)
 }
 
 // sendJSONRPCError sends a JSON-RPC error response
@@ -189,9 +361,8 @@ func sendJSONRPCError(w http.ResponseWriter, id interface{}, code int, message s
 		},
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK) // JSON-RPC always returns 200
-	json.NewEncoder(w).Encode(response)
+	data, _ := json.Marshal(response)
+	writeRPCResponse(w, data)
 }
 
 // extractIP extracts the client IP address from the request
@@ -208,6 +379,16 @@ func extractIP(r *http.Request) string {
 		return ip
 	}
 
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
+	// Fall back to RemoteAddr, without the port so that all connections of
+	// a client share its limits
+	return stripPort(r.RemoteAddr)
+}
+
+// stripPort returns the host of an address, or the address if it has no
+// port
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
 }
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// EnableHeightPinning lets HTTP requests pin the latest block of their
+// calls with the X-Block-Height header, so that indexers replaying history
+// through the standard API read the chain as it was at that height. It must
+// be called before serving.
+func (h *JSONRPCHandler) EnableHeightPinning(blockReader *storage.BlockReader) {
+	h.heightPins = blockReader
+}
+
+// pinHeight returns ctx pinning latest to the height of a header value,
+// given in decimal or hex. Heights past the head are refused, as they
+// would read state that does not exist yet.
+func (h *JSONRPCHandler) pinHeight(ctx context.Context, value string) (context.Context, *api.RPCError) {
+	if h.heightPins == nil {
+		return ctx, api.NewRPCError(api.ErrCodeMethodNotSupported, "block height pinning is not enabled")
+	}
+	height, ok := math.ParseUint64(strings.TrimSpace(value))
+	if !ok {
+		return ctx, api.NewRPCError(api.ErrCodeInvalidParams, fmt.Sprintf("invalid block height %q", value))
+	}
+
+	head, err := h.heightPins.GetHeadNumber(ctx)
+	if err != nil {
+		return ctx, api.NewRPCError(api.ErrCodeInternal, fmt.Sprintf("failed to get head block: %v", err))
+	}
+	if height > head {
+		return ctx, api.NewRPCError(api.ErrCodeUnknownBlock, fmt.Sprintf("block height %d is past the head %d", height, head))
+	}
+	return storage.WithPinnedHeight(ctx, height), nil
+}
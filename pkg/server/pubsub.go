@@ -0,0 +1,51 @@
+package server
+
+import (
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// maxGapReplayBlocks bounds the blocks replayed after a reconnect
+const maxGapReplayBlocks = storage.DefaultCanonicalDepth
+
+// replayMissedBlocks announces blocks indexed while the block subscription
+// was down. Blocks already announced are ignored by the canonical tracker.
+func (sm *SubscriptionManager) replayMissedBlocks() {
+	last, ok := sm.tracker.Head()
+	if !ok {
+		return
+	}
+
+	latest, err := sm.blockReader.GetLatestBlockNumber(sm.ctx)
+	if err != nil {
+		logger.Errorf("Failed to get latest block for gap recovery: %v", err)
+		return
+	}
+	if latest <= last {
+		return
+	}
+
+	from := last + 1
+	if latest-from+1 > maxGapReplayBlocks {
+		logger.Warnf("Block gap too large to replay: missed=%d, replaying last %d", latest-from+1, maxGapReplayBlocks)
+		from = latest - maxGapReplayBlocks + 1
+	}
+
+	logger.Infof("Replaying missed blocks: from=%d, to=%d", from, latest)
+
+	blocks, err := sm.blockReader.GetBlocksRange(sm.ctx, from, latest)
+	if err != nil {
+		logger.Errorf("Failed to get missed blocks: %v", err)
+		return
+	}
+	for i, block := range blocks {
+		if block == nil {
+			logger.Errorf("Missed block %d not found", from+uint64(i))
+			continue
+		}
+		sm.handleNewBlock(block, time.Time{})
+	}
+	sm.checkSyncStatus()
+}
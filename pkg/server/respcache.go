@@ -0,0 +1,249 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/cache"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// cacheCheck decides whether a successful call may be stored in the shared
+// response cache, i.e. whether its result can never change
+type cacheCheck func(ctx context.Context, p *responseCachePolicy, params []json.RawMessage, result interface{}) bool
+
+// cacheRule decides which calls of a method are cached
+type cacheRule struct {
+	block int        // position of the block parameter, -1 if there is none
+	store cacheCheck // whether a result may be stored
+}
+
+// cacheableMethods lists the methods whose results may become immutable
+var cacheableMethods = map[string]cacheRule{
+	"eth_getBlockByHash":                      {0, always},
+	"eth_getBlockTransactionCountByHash":      {0, always},
+	"eth_getTransactionByBlockHashAndIndex":   {0, always},
+	"eth_getBlockByNumber":                    {0, confirmedBlockAt(0)},
+	"eth_getBlockTransactionCountByNumber":    {0, confirmedBlockAt(0)},
+	"eth_getTransactionByBlockNumberAndIndex": {0, confirmedBlockAt(0)},
+	"eth_getTransactionByHash":                {-1, confirmedResult},
+	"eth_getTransactionReceipt":               {-1, confirmedResult},
+	"eth_getLogs":                             {0, confirmedLogRange},
+	"eth_getBalance":                          {1, confirmedBlockAt(1)},
+	"eth_getCode":                             {1, confirmedBlockAt(1)},
+	"eth_getTransactionCount":                 {1, confirmedBlockAt(1)},
+	"eth_getStorageAt":                        {2, confirmedBlockAt(2)},
+	"eth_call":                                {1, confirmedBlockAt(1)},
+}
+
+// responseCachePolicy serves immutable results from the shared cache
+type responseCachePolicy struct {
+	cache         *cache.ResponseCache
+	blockReader   *storage.BlockReader
+	confirmations uint64
+}
+
+// cachedCall is a call that may be served from the shared cache
+type cachedCall struct {
+	rule   cacheRule
+	params []json.RawMessage
+	key    json.RawMessage // the params in canonical form
+}
+
+// EnableResponseCache serves immutable method results from the shared L2
+// cache. Results addressed by block number are only stored once they are
+// the given number of blocks deep.
+func (h *JSONRPCHandler) EnableResponseCache(rc *cache.ResponseCache, blockReader *storage.BlockReader, confirmations uint64) {
+	h.responseCache = &responseCachePolicy{
+		cache:         rc,
+		blockReader:   blockReader,
+		confirmations: confirmations,
+	}
+}
+
+// prepare returns the call if it may be served from the cache, nil if it
+// bypasses it. Calls addressing a moving block, such as latest or pending,
+// bypass the cache without a lookup.
+func (p *responseCachePolicy) prepare(req *JSONRPCRequest) *cachedCall {
+	rule, ok := cacheableMethods[req.Method]
+	if !ok {
+		return nil
+	}
+
+	var params []json.RawMessage
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+	}
+	if !rule.pinned(params) {
+		metrics.RecordResponseCacheBypass(req.Method)
+		return nil
+	}
+
+	key, err := rule.canonical(params)
+	if err != nil {
+		return nil
+	}
+	return &cachedCall{rule: rule, params: params, key: key}
+}
+
+// lookup returns the cached result of a call
+func (p *responseCachePolicy) lookup(ctx context.Context, method string, call *cachedCall) (json.RawMessage, bool) {
+	return p.cache.Get(ctx, method, call.key)
+}
+
+// store caches the result of a successful call if it is immutable
+func (p *responseCachePolicy) store(ctx context.Context, method string, call *cachedCall, result interface{}) {
+	if result != nil && call.rule.store(ctx, p, call.params, result) {
+		p.cache.Set(ctx, method, call.key, result)
+	}
+}
+
+// pinned reports whether the params address a fixed block. Calls at a tag
+// such as latest, or without a block where it defaults to latest, do not.
+func (r cacheRule) pinned(params []json.RawMessage) bool {
+	if r.block < 0 {
+		return true
+	}
+	if len(params) <= r.block {
+		return false
+	}
+
+	var ref api.BlockNumberOrHash
+	if err := json.Unmarshal(params[r.block], &ref); err == nil {
+		return ref.BlockHash != nil || *ref.BlockNumber >= 0
+	}
+
+	// A log filter is pinned by a block hash or a numeric end
+	var query struct {
+		BlockHash *string `json:"blockHash"`
+		ToBlock   string  `json:"toBlock"`
+	}
+	if err := json.Unmarshal(params[r.block], &query); err != nil {
+		return false
+	}
+	if query.BlockHash != nil {
+		return true
+	}
+	bn, err := api.ParseBlockNumber(query.ToBlock)
+	return err == nil && bn >= 0
+}
+
+// canonical encodes params so that equivalent calls share an entry: hex
+// strings are lowercased, a block number loses its leading zeros, object
+// keys are sorted and formatting is dropped
+func (r cacheRule) canonical(params []json.RawMessage) (json.RawMessage, error) {
+	values := make([]interface{}, len(params))
+	for i, param := range params {
+		dec := json.NewDecoder(bytes.NewReader(param))
+		dec.UseNumber()
+		if err := dec.Decode(&values[i]); err != nil {
+			return nil, err
+		}
+		values[i] = canonicalValue(values[i])
+	}
+
+	if r.block >= 0 && r.block < len(values) {
+		if tag, ok := values[r.block].(string); ok {
+			if bn, err := api.ParseBlockNumber(tag); err == nil && bn >= 0 {
+				values[r.block] = hexutil.EncodeUint64(uint64(bn))
+			}
+		}
+	}
+	return json.Marshal(values)
+}
+
+// canonicalValue lowercases the hex strings in a decoded JSON value
+func canonicalValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if len(v) >= 2 && v[0] == '0' && (v[1] == 'x' || v[1] == 'X') {
+			return strings.ToLower(v)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = canonicalValue(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = canonicalValue(v[key])
+		}
+	}
+	return v
+}
+
+// confirmed reports whether a block is deep enough to be considered final
+func (p *responseCachePolicy) confirmed(ctx context.Context, number uint64) bool {
+	latest, err := p.blockReader.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return false
+	}
+	return number+p.confirmations <= latest
+}
+
+// always caches every non-null result
+func always(ctx context.Context, p *responseCachePolicy, params []json.RawMessage, result interface{}) bool {
+	return true
+}
+
+// confirmedBlockAt caches calls whose block parameter at position i is a
+// block hash or a confirmed block number
+func confirmedBlockAt(i int) cacheCheck {
+	return func(ctx context.Context, p *responseCachePolicy, params []json.RawMessage, result interface{}) bool {
+		if len(params) <= i {
+			return false
+		}
+		var ref api.BlockNumberOrHash
+		if err := json.Unmarshal(params[i], &ref); err != nil {
+			return false
+		}
+		if ref.BlockHash != nil {
+			return true
+		}
+		return *ref.BlockNumber >= 0 && p.confirmed(ctx, uint64(*ref.BlockNumber))
+	}
+}
+
+// confirmedResult caches transactions and receipts mined in a confirmed block
+func confirmedResult(ctx context.Context, p *responseCachePolicy, params []json.RawMessage, result interface{}) bool {
+	var number *hexutil.Big
+	switch r := result.(type) {
+	case *api.RPCTransaction:
+		number = r.BlockNumber
+	case *api.RPCReceipt:
+		number = r.BlockNumber
+	}
+	if number == nil {
+		return false
+	}
+	return p.confirmed(ctx, number.ToInt().Uint64())
+}
+
+// confirmedLogRange caches log queries pinned to a block hash or ending at
+// a confirmed block
+func confirmedLogRange(ctx context.Context, p *responseCachePolicy, params []json.RawMessage, result interface{}) bool {
+	if len(params) == 0 {
+		return false
+	}
+	var query api.FilterQuery
+	if err := json.Unmarshal(params[0], &query); err != nil {
+		return false
+	}
+	if query.BlockHash != nil {
+		return true
+	}
+	if query.ToBlock == "" {
+		return false
+	}
+	bn, err := api.ParseBlockNumber(query.ToBlock)
+	if err != nil || bn < 0 {
+		return false
+	}
+	return p.confirmed(ctx, uint64(bn))
+}
@@ -3,11 +3,18 @@ package server
 import (
 	"context"
 	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/api/admin"
+	"github.com/sunvim/evm_rpc/pkg/config"
 	"github.com/sunvim/evm_rpc/pkg/logger"
 	"github.com/sunvim/evm_rpc/pkg/metrics"
 	"github.com/sunvim/evm_rpc/pkg/storage"
@@ -20,21 +27,67 @@ const (
 	SubscriptionNewHeads              SubscriptionType = "newHeads"
 	SubscriptionLogs                  SubscriptionType = "logs"
 	SubscriptionNewPendingTransactions SubscriptionType = "newPendingTransactions"
+	SubscriptionSyncing               SubscriptionType = "syncing"
+	SubscriptionTransactionStatus     SubscriptionType = "transactionStatus"
 )
 
+const (
+	// subscriptionIDLength is the number of random bytes in a subscription ID
+	subscriptionIDLength = 16
+
+	// maxSubscriptionIDAttempts bounds retries when a generated ID collides
+	maxSubscriptionIDAttempts = 8
+)
+
+// syncCheckInterval is how often the sync status is re-evaluated
+const syncCheckInterval = 10 * time.Second
+
+// orphanSweepInterval is how often subscriptions are checked for having
+// outlived their connection. A subscription is removed by the sweep after
+// the one that found it orphaned, leaving teardown in progress time to run.
+const orphanSweepInterval = time.Minute
+
+// isValidSubscriptionType reports whether the subscription type is supported
+func isValidSubscriptionType(subType SubscriptionType) bool {
+	switch subType {
+	case SubscriptionNewHeads, SubscriptionLogs, SubscriptionNewPendingTransactions, SubscriptionSyncing, SubscriptionTransactionStatus:
+		return true
+	}
+	return false
+}
+
 // Subscription represents a client subscription
 type Subscription struct {
 	ID       string
 	Type     SubscriptionType
 	Filter   *FilterCriteria
 	conn     *WebSocketConnection
+	ctx      context.Context
 	cancelFn context.CancelFunc
+
+	// orphanedAt is when a sweep found the connection gone, guarded by the
+	// manager's mu
+	orphanedAt time.Time
+
+	// transaction followed by a transactionStatus subscription, and the
+	// status last sent
+	txHash     common.Hash
+	txStatusMu sync.Mutex
+	txStatus   *txStatusResult
+
+	// historical log backfill state; live logs are queued while it runs
+	backfillMu   sync.Mutex
+	backfilling  bool
+	backfillFrom uint64
+	backfillTo   uint64
+	queuedLogs   []queuedLog
 }
 
 // FilterCriteria represents log filter criteria
 type FilterCriteria struct {
 	Addresses []common.Address `json:"address,omitempty"`
 	Topics    [][]common.Hash  `json:"topics,omitempty"`
+	FromBlock string           `json:"fromBlock,omitempty"`
 }
 
 // SubscriptionManager manages client subscriptions
@@ -44,13 +97,29 @@ type SubscriptionManager struct {
 	connections   map[*WebSocketConnection]map[string]*Subscription // conn -> subscription IDs
 	pikaClient    *storage.PikaClient
 	blockReader   *storage.BlockReader
+	tracker       *storage.CanonicalTracker
+	txReader      *storage.TransactionReader
+	txPool        *storage.TxPoolStorage // nil disables transactionStatus
+	maxBackfill   uint64
+	generateID    func() (string, error) // source of subscription IDs
 	ctx           context.Context
 	cancel        context.CancelFunc
 	wg            sync.WaitGroup
+	reaped        atomic.Uint64 // orphaned subscriptions removed by sweeps
+
+	// logs announced per block, kept so they can be retracted on reorg
+	logsMu       sync.Mutex
+	sentLogs     map[common.Hash][]*types.Log
+	sentLogsFIFO []common.Hash
+
+	// last published sync state, used to detect transitions
+	syncMu      sync.Mutex
+	syncKnown   bool
+	syncSyncing bool
 }
 
 // NewSubscriptionManager creates a new subscription manager
-func NewSubscriptionManager(pikaClient *storage.PikaClient, blockReader *storage.BlockReader) *SubscriptionManager {
+func NewSubscriptionManager(pikaClient *storage.PikaClient, blockReader *storage.BlockReader, cfg config.WSConfig) *SubscriptionManager {
 	ctx, cancel := context.WithCancel(context.Background())
 	
 	sm := &SubscriptionManager{
@@ -58,36 +127,73 @@ func NewSubscriptionManager(pikaClient *storage.PikaClient, blockReader *storage
 		connections:   make(map[*WebSocketConnection]map[string]*Subscription),
 		pikaClient:    pikaClient,
 		blockReader:   blockReader,
+		tracker:       storage.NewCanonicalTracker(blockReader, storage.DefaultCanonicalDepth),
+		txReader:      storage.NewTransactionReader(pikaClient),
+		sentLogs:      make(map[common.Hash][]*types.Log),
+		maxBackfill:   cfg.MaxBackfillBlocks,
+		generateID:    generateSubscriptionID,
 		ctx:           ctx,
 		cancel:        cancel,
 	}
 
-	// Start subscription workers
-	sm.wg.Add(2)
+	return sm
+}
+
+// Start starts the subscription workers
+func (sm *SubscriptionManager) Start(ctx context.Context) error {
+	sm.wg.Add(4)
 	go sm.listenNewBlocks()
 	go sm.listenNewPendingTransactions()
-
-	return sm
+	go sm.watchSyncStatus()
+	go sm.sweepOrphans()
+	if sm.txPool != nil {
+		sm.wg.Add(2)
+		go sm.listenPoolExits("pool:dropped")
+		go sm.listenPoolExits("pool:replaced")
+	}
+	return nil
 }
 
 // Subscribe creates a new subscription
 func (sm *SubscriptionManager) Subscribe(conn *WebSocketConnection, subType SubscriptionType, filter *FilterCriteria) (string, error) {
+	if !isValidSubscriptionType(subType) {
+		return "", fmt.Errorf("unsupported subscription type: %s", subType)
+	}
+	if subType == SubscriptionTransactionStatus {
+		return "", api.NewRPCError(api.ErrCodeInvalidParams, "missing transaction hash")
+	}
+	return sm.subscribe(conn, &Subscription{Type: subType, Filter: filter})
+}
+
+// subscribe registers a subscription, assigning its ID and context
+func (sm *SubscriptionManager) subscribe(conn *WebSocketConnection, sub *Subscription) (string, error) {
+	subType, filter := sub.Type, sub.Filter
+
+	// Resolve the historical range before taking the lock, as it reads the
+	// head from storage. The subscription is not visible to the live
+	// fan-out yet, so its logs are queued from the moment it is stored.
+	if subType == SubscriptionLogs && filter != nil && filter.FromBlock != "" {
+		if err := sm.prepareBackfill(sub); err != nil {
+			return "", err
+		}
+	}
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	// Generate subscription ID
-	subID := generateSubscriptionID()
+	// Generate subscription ID, retrying on the (unlikely) collision
+	subID, err := sm.newSubscriptionID()
+	if err != nil {
+		return "", err
+	}
 
 	// Create subscription context
-	_, cancel := context.WithCancel(sm.ctx)
+	ctx, cancel := context.WithCancel(sm.ctx)
 
-	sub := &Subscription{
-		ID:       subID,
-		Type:     subType,
-		Filter:   filter,
-		conn:     conn,
-		cancelFn: cancel,
-	}
+	sub.ID = subID
+	sub.conn = conn
+	sub.ctx = ctx
+	sub.cancelFn = cancel
 
 	// Store subscription
 	sm.subscriptions[subID] = sub
@@ -106,27 +212,67 @@ func (sm *SubscriptionManager) Subscribe(conn *WebSocketConnection, subType Subs
 	return subID, nil
 }
 
-// Unsubscribe removes a subscription
-func (sm *SubscriptionManager) Unsubscribe(subID string) error {
+// newSubscriptionID returns an ID not currently in use.
+// Caller must hold sm.mu.
+func (sm *SubscriptionManager) newSubscriptionID() (string, error) {
+	for i := 0; i < maxSubscriptionIDAttempts; i++ {
+		id, err := sm.generateID()
+		if err != nil {
+			return "", err
+		}
+		if _, exists := sm.subscriptions[id]; !exists {
+			return id, nil
+		}
+		logger.Warnf("Subscription ID collision: %s", id)
+	}
+	return "", fmt.Errorf("failed to allocate a unique subscription ID")
+}
+
+// Unsubscribe removes a subscription of a connection. Subscriptions of
+// other connections are not found.
+func (sm *SubscriptionManager) Unsubscribe(conn *WebSocketConnection, subID string) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	sub, exists := sm.subscriptions[subID]
+	sub, exists := sm.connections[conn][subID]
 	if !exists {
 		return fmt.Errorf("subscription not found: %s", subID)
 	}
+	sm.remove(sub)
 
-	// Cancel subscription context
+	logger.Infof("Removed subscription: id=%s, type=%s", subID, sub.Type)
+
+	return nil
+}
+
+// UnsubscribeAll removes all subscriptions for a connection and returns
+// how many there were
+func (sm *SubscriptionManager) UnsubscribeAll(conn *WebSocketConnection) int {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	connSubs := sm.connections[conn]
+	removed := len(connSubs)
+	for _, sub := range connSubs {
+		sm.remove(sub)
+	}
+
+	if removed > 0 {
+		logger.Infof("Removed all %d subscriptions for connection", removed)
+	}
+	return removed
+}
+
+// remove cancels a subscription and drops it from the indexes.
+// Caller must hold sm.mu.
+func (sm *SubscriptionManager) remove(sub *Subscription) {
 	if sub.cancelFn != nil {
 		sub.cancelFn()
 	}
 
-	// Remove from subscriptions
-	delete(sm.subscriptions, subID)
-
-	// Remove from connection mapping
+	delete(sm.subscriptions, sub.ID)
 	if connSubs, ok := sm.connections[sub.conn]; ok {
-		delete(connSubs, subID)
+		delete(connSubs, sub.ID)
 		if len(connSubs) == 0 {
 			delete(sm.connections, sub.conn)
 		}
@@ -134,112 +280,133 @@ func (sm *SubscriptionManager) Unsubscribe(subID string) error {
 
 	// Update metrics
 	metrics.RecordSubscription(string(sub.Type), -1)
+}
 
-	logger.Infof("Removed subscription: id=%s, type=%s", subID, sub.Type)
+// sweepOrphans periodically removes subscriptions whose connection went
+// away without them being torn down, which would otherwise be notified
+// forever
+func (sm *SubscriptionManager) sweepOrphans() {
+	defer sm.wg.Done()
 
-	return nil
+	ticker := time.NewTicker(orphanSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sm.ctx.Done():
+			return
+		case <-ticker.C:
+			sm.sweepOrphansOnce()
+		}
+	}
 }
 
-// UnsubscribeAll removes all subscriptions for a connection
-func (sm *SubscriptionManager) UnsubscribeAll(conn *WebSocketConnection) {
+// sweepOrphansOnce marks the subscriptions of closed connections and
+// removes those a previous sweep marked already
+func (sm *SubscriptionManager) sweepOrphansOnce() {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	connSubs, exists := sm.connections[conn]
-	if !exists {
-		return
+	now := time.Now()
+	for _, sub := range sm.subscriptions {
+		if sub.conn.ctx.Err() == nil {
+			continue
+		}
+		if sub.orphanedAt.IsZero() {
+			sub.orphanedAt = now
+			continue
+		}
+
+		logger.Warnf("Removing orphaned subscription: id=%s, type=%s, client=%s, orphaned for %v",
+			sub.ID, sub.Type, sub.conn.clientIP, now.Sub(sub.orphanedAt).Round(time.Second))
+		sm.remove(sub)
+		sm.reaped.Add(1)
+		metrics.RecordOrphanedSubscription(string(sub.Type))
 	}
+}
 
-	// Cancel and remove all subscriptions for this connection
-	for subID, sub := range connSubs {
-		if sub.cancelFn != nil {
-			sub.cancelFn()
+// orphans describes the subscriptions whose connection is closed, and
+// counts those removed by sweeps
+func (sm *SubscriptionManager) orphans(chain string) ([]admin.OrphanedSubscription, uint64) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var orphans []admin.OrphanedSubscription
+	for _, sub := range sm.subscriptions {
+		if sub.conn.ctx.Err() == nil {
+			continue
+		}
+		orphan := admin.OrphanedSubscription{
+			ID:        sub.ID,
+			Type:      string(sub.Type),
+			Chain:     chain,
+			ClientIP:  stripPort(sub.conn.clientIP),
+			RequestID: sub.conn.requestID,
 		}
-		delete(sm.subscriptions, subID)
-		metrics.RecordSubscription(string(sub.Type), -1)
+		if !sub.orphanedAt.IsZero() {
+			orphanedAt := sub.orphanedAt
+			orphan.OrphanedAt = &orphanedAt
+		}
+		orphans = append(orphans, orphan)
 	}
+	return orphans, sm.reaped.Load()
+}
 
-	delete(sm.connections, conn)
+// subscriptionCounts returns the subscriptions of a connection by type
+func (sm *SubscriptionManager) subscriptionCounts(conn *WebSocketConnection) map[string]int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
 
-	logger.Infof("Removed all subscriptions for connection")
+	counts := make(map[string]int)
+	for _, sub := range sm.connections[conn] {
+		counts[string(sub.Type)]++
+	}
+	return counts
 }
 
-// listenNewBlocks listens for new blocks from Pika pub/sub
+// listenNewBlocks listens for new blocks from Pika pub/sub, replaying
+// blocks missed while the subscription was down
 func (sm *SubscriptionManager) listenNewBlocks() {
 	defer sm.wg.Done()
 
-	// Subscribe to Pika channel
-	pubsub := sm.pikaClient.Subscribe(sm.ctx, "blocks:new")
-	defer pubsub.Close()
-
 	logger.Info("Listening for new blocks...")
 
-	for {
-		select {
-		case <-sm.ctx.Done():
-			return
-		default:
-			msg, err := pubsub.ReceiveMessage(sm.ctx)
-			if err != nil {
-				if sm.ctx.Err() != nil {
-					return
-				}
-				logger.Errorf("Failed to receive block message: %v", err)
-				continue
-			}
+	sm.pikaClient.Listen(sm.ctx, "blocks:new", sm.replayMissedBlocks, func(payload string) {
+		receivedAt := time.Now()
 
-			// Parse block hash
-			blockHash := common.HexToHash(msg.Payload)
-			
-			// Get full block
-			block, err := sm.blockReader.GetBlockByHash(sm.ctx, blockHash)
-			if err != nil {
-				logger.Errorf("Failed to get block: %v", err)
-				continue
-			}
+		// Parse block hash
+		blockHash := common.HexToHash(payload)
 
-			// Notify subscribers
-			sm.notifyNewHeads(block)
-			sm.notifyLogs(block)
+		// Get full block
+		block, err := sm.blockReader.GetBlockByHash(sm.ctx, blockHash)
+		if err != nil {
+			logger.Errorf("Failed to get block: %v", err)
+			return
 		}
-	}
+
+		sm.handleNewBlock(block, receivedAt)
+		sm.checkSyncStatus()
+	})
 }
 
 // listenNewPendingTransactions listens for new pending transactions from Pika pub/sub
 func (sm *SubscriptionManager) listenNewPendingTransactions() {
 	defer sm.wg.Done()
 
-	// Subscribe to Pika channel
-	pubsub := sm.pikaClient.Subscribe(sm.ctx, "pool:new")
-	defer pubsub.Close()
-
 	logger.Info("Listening for new pending transactions...")
 
-	for {
-		select {
-		case <-sm.ctx.Done():
-			return
-		default:
-			msg, err := pubsub.ReceiveMessage(sm.ctx)
-			if err != nil {
-				if sm.ctx.Err() != nil {
-					return
-				}
-				logger.Errorf("Failed to receive tx message: %v", err)
-				continue
-			}
+	sm.pikaClient.Listen(sm.ctx, "pool:new", nil, func(payload string) {
+		// Parse transaction hash
+		txHash := common.HexToHash(payload)
 
-			// Parse transaction hash
-			txHash := common.HexToHash(msg.Payload)
-			
-			// Notify subscribers
-			sm.notifyNewPendingTransaction(txHash)
-		}
-	}
+		// Notify subscribers
+		sm.notifyNewPendingTransaction(txHash)
+		sm.notifyTxStatus(txHash, &txStatusResult{TransactionHash: txHash, Status: txStatusPending})
+	})
 }
 
 // notifyNewHeads notifies newHeads subscribers
-func (sm *SubscriptionManager) notifyNewHeads(block *types.Block) {
+func (sm *SubscriptionManager) notifyNewHeads(block *types.Block, timing blockTiming) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
@@ -264,7 +431,7 @@ func (sm *SubscriptionManager) notifyNewHeads(block *types.Block) {
 		}
 
 		// Send notification
-		if err := sub.conn.SendNotification(notification); err != nil {
+		if err := sub.conn.SendBlockNotification(string(SubscriptionNewHeads), timing, notification); err != nil {
 			logger.Errorf("Failed to send newHeads notification: %v", err)
 		} else {
 			metrics.RecordNotification(string(SubscriptionNewHeads))
@@ -272,28 +439,90 @@ func (sm *SubscriptionManager) notifyNewHeads(block *types.Block) {
 	}
 }
 
-// notifyLogs notifies logs subscribers
-func (sm *SubscriptionManager) notifyLogs(block *types.Block) {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+// handleNewBlock applies a new head to the canonical tracker and notifies
+// subscribers, retracting logs of blocks that were reorged out. receivedAt
+// is when the blocks:new message of a live block was received, zero for
+// replayed blocks.
+func (sm *SubscriptionManager) handleNewBlock(block *types.Block, receivedAt time.Time) {
+	update, err := sm.tracker.Apply(sm.ctx, block)
+	if err != nil {
+		// Fall back to announcing the block on its own
+		logger.Errorf("Failed to track canonical chain: %v", err)
+		update = &storage.ChainUpdate{Added: []*types.Block{block}}
+	}
 
-	// Get receipts for block
-	receipts, err := sm.blockReader.GetReceipts(sm.ctx, block.NumberU64())
+	if update.IsReorg() {
+		logger.Warnf("Chain reorg detected: removed=%d, added=%d, newHead=%d",
+			len(update.Removed), len(update.Added), block.NumberU64())
+	}
+
+	// Removed logs are sent in reverse order, as geth does
+	for _, removed := range update.Removed {
+		logs := sm.takeSentLogs(removed.Hash)
+		for i := len(logs) - 1; i >= 0; i-- {
+			sm.notifyLog(logs[i], true, blockTiming{})
+		}
+	}
+
+	for _, added := range update.Added {
+		timing := blockTiming{blockTime: added.Time(), receivedAt: receivedAt}
+		sm.notifyNewHeads(added, timing)
+		sm.notifyLogs(added, timing)
+		sm.notifyMinedTxs(added)
+	}
+	if update.IsReorg() {
+		sm.recheckReorgedTxs(update.Removed)
+	}
+}
+
+// notifyLogs notifies logs subscribers
+func (sm *SubscriptionManager) notifyLogs(block *types.Block, timing blockTiming) {
+	// Get logs for block
+	logs, err := sm.blockReader.GetBlockLogs(sm.ctx, block.NumberU64())
 	if err != nil {
-		logger.Errorf("Failed to get receipts: %v", err)
+		logger.Errorf("Failed to get logs: %v", err)
 		return
 	}
 
-	// Extract logs
-	for _, receipt := range receipts {
-		for _, log := range receipt.Logs {
-			sm.notifyLog(log)
-		}
+	sm.rememberSentLogs(block.Hash(), logs)
+
+	for _, log := range logs {
+		sm.notifyLog(log, false, timing)
+	}
+}
+
+// rememberSentLogs keeps the logs announced for a block within the reorg window
+func (sm *SubscriptionManager) rememberSentLogs(blockHash common.Hash, logs []*types.Log) {
+	sm.logsMu.Lock()
+	defer sm.logsMu.Unlock()
+
+	if _, exists := sm.sentLogs[blockHash]; !exists {
+		sm.sentLogsFIFO = append(sm.sentLogsFIFO, blockHash)
+	}
+	sm.sentLogs[blockHash] = logs
+
+	for len(sm.sentLogsFIFO) > storage.DefaultCanonicalDepth {
+		delete(sm.sentLogs, sm.sentLogsFIFO[0])
+		sm.sentLogsFIFO = sm.sentLogsFIFO[1:]
 	}
 }
 
-// notifyLog notifies subscribers about a specific log
-func (sm *SubscriptionManager) notifyLog(log *types.Log) {
+// takeSentLogs returns and forgets the logs announced for a block
+func (sm *SubscriptionManager) takeSentLogs(blockHash common.Hash) []*types.Log {
+	sm.logsMu.Lock()
+	defer sm.logsMu.Unlock()
+
+	logs := sm.sentLogs[blockHash]
+	delete(sm.sentLogs, blockHash)
+	return logs
+}
+
+// notifyLog notifies subscribers about a specific log. timing dates a newly
+// added block, and is zero for retracted logs.
+func (sm *SubscriptionManager) notifyLog(log *types.Log, removed bool, timing blockTiming) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
 	for _, sub := range sm.subscriptions {
 		if sub.Type != SubscriptionLogs {
 			continue
@@ -306,51 +535,160 @@ func (sm *SubscriptionManager) notifyLog(log *types.Log) {
 			}
 		}
 
+		sm.deliverLog(sub, log, removed, timing)
+	}
+}
+
+// deliverLog sends a log notification, or queues it while the
+// subscription's backfill is still running
+func (sm *SubscriptionManager) deliverLog(sub *Subscription, log *types.Log, removed bool, timing blockTiming) {
+	sub.backfillMu.Lock()
+	if sub.backfilling {
+		sub.queuedLogs = append(sub.queuedLogs, queuedLog{log: log, removed: removed, timing: timing})
+		sub.backfillMu.Unlock()
+		return
+	}
+	sub.backfillMu.Unlock()
+
+	sm.sendLog(sub, log, removed, timing)
+}
+
+// sendLog sends a log notification to a subscription. The delivery lag is
+// recorded for logs of live blocks, which have a non-zero timing.
+func (sm *SubscriptionManager) sendLog(sub *Subscription, log *types.Log, removed bool, timing blockTiming) {
+	// Create notification
+	notification := map[string]interface{}{
+		"subscription": sub.ID,
+		"result": map[string]interface{}{
+			"address":          log.Address.Hex(),
+			"topics":           log.Topics,
+			"data":             fmt.Sprintf("0x%x", log.Data),
+			"blockNumber":      fmt.Sprintf("0x%x", log.BlockNumber),
+			"transactionHash":  log.TxHash.Hex(),
+			"transactionIndex": fmt.Sprintf("0x%x", log.TxIndex),
+			"blockHash":        log.BlockHash.Hex(),
+			"logIndex":         fmt.Sprintf("0x%x", log.Index),
+			"removed":          removed,
+		},
+	}
+
+	// Send notification
+	var err error
+	if timing.blockTime != 0 {
+		err = sub.conn.SendBlockNotification(string(SubscriptionLogs), timing, notification)
+	} else {
+		err = sub.conn.SendNotification(notification)
+	}
+	if err != nil {
+		logger.Errorf("Failed to send logs notification: %v", err)
+	} else {
+		metrics.RecordNotification(string(SubscriptionLogs))
+	}
+}
+
+// notifyNewPendingTransaction notifies newPendingTransactions subscribers
+func (sm *SubscriptionManager) notifyNewPendingTransaction(txHash common.Hash) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	for _, sub := range sm.subscriptions {
+		if sub.Type != SubscriptionNewPendingTransactions {
+			continue
+		}
+
 		// Create notification
 		notification := map[string]interface{}{
 			"subscription": sub.ID,
-			"result": map[string]interface{}{
-				"address":          log.Address.Hex(),
-				"topics":           log.Topics,
-				"data":             fmt.Sprintf("0x%x", log.Data),
-				"blockNumber":      fmt.Sprintf("0x%x", log.BlockNumber),
-				"transactionHash":  log.TxHash.Hex(),
-				"transactionIndex": fmt.Sprintf("0x%x", log.TxIndex),
-				"blockHash":        log.BlockHash.Hex(),
-				"logIndex":         fmt.Sprintf("0x%x", log.Index),
-			},
+			"result":       txHash.Hex(),
 		}
 
 		// Send notification
 		if err := sub.conn.SendNotification(notification); err != nil {
-			logger.Errorf("Failed to send logs notification: %v", err)
+			logger.Errorf("Failed to send newPendingTransactions notification: %v", err)
 		} else {
-			metrics.RecordNotification(string(SubscriptionLogs))
+			metrics.RecordNotification(string(SubscriptionNewPendingTransactions))
 		}
 	}
 }
 
-// notifyNewPendingTransaction notifies newPendingTransactions subscribers
-func (sm *SubscriptionManager) notifyNewPendingTransaction(txHash common.Hash) {
+// watchSyncStatus periodically re-evaluates the sync status so that a stalled
+// indexer is reported even when no new blocks arrive
+func (sm *SubscriptionManager) watchSyncStatus() {
+	defer sm.wg.Done()
+
+	ticker := time.NewTicker(syncCheckInterval)
+	defer ticker.Stop()
+
+	sm.checkSyncStatus()
+
+	for {
+		select {
+		case <-sm.ctx.Done():
+			return
+		case <-ticker.C:
+			sm.checkSyncStatus()
+		}
+	}
+}
+
+// checkSyncStatus notifies syncing subscribers when the sync state changes
+func (sm *SubscriptionManager) checkSyncStatus() {
+	status, err := sm.blockReader.GetSyncStatus(sm.ctx, storage.DefaultSyncLagThreshold)
+	if err != nil {
+		if sm.ctx.Err() == nil {
+			logger.Debugf("Failed to get sync status: %v", err)
+		}
+		return
+	}
+
+	sm.syncMu.Lock()
+	changed := !sm.syncKnown || sm.syncSyncing != status.Syncing
+	first := !sm.syncKnown
+	sm.syncKnown = true
+	sm.syncSyncing = status.Syncing
+	sm.syncMu.Unlock()
+
+	// The initial evaluation only establishes the baseline
+	if !changed || first {
+		return
+	}
+
+	logger.Infof("Sync status changed: syncing=%v, current=%d, highest=%d, lag=%v",
+		status.Syncing, status.CurrentBlock, status.HighestBlock, status.Lag)
+
+	sm.notifySyncing(status)
+}
+
+// notifySyncing notifies syncing subscribers
+func (sm *SubscriptionManager) notifySyncing(status *storage.SyncStatus) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
+	// Same shape as geth: progress object while syncing, false once done
+	var result interface{} = false
+	if status.Syncing {
+		result = map[string]interface{}{
+			"syncing": true,
+			"status":  api.NewRPCSyncStatus(status.StartingBlock, status.CurrentBlock, status.HighestBlock),
+		}
+	}
+
 	for _, sub := range sm.subscriptions {
-		if sub.Type != SubscriptionNewPendingTransactions {
+		if sub.Type != SubscriptionSyncing {
 			continue
 		}
 
 		// Create notification
 		notification := map[string]interface{}{
 			"subscription": sub.ID,
-			"result":       txHash.Hex(),
+			"result":       result,
 		}
 
 		// Send notification
 		if err := sub.conn.SendNotification(notification); err != nil {
-			logger.Errorf("Failed to send newPendingTransactions notification: %v", err)
+			logger.Errorf("Failed to send syncing notification: %v", err)
 		} else {
-			metrics.RecordNotification(string(SubscriptionNewPendingTransactions))
+			metrics.RecordNotification(string(SubscriptionSyncing))
 		}
 	}
 }
@@ -394,18 +732,38 @@ func matchLogFilter(log *types.Log, filter *FilterCriteria) bool {
 	return true
 }
 
-// Stop stops the subscription manager
-func (sm *SubscriptionManager) Stop() {
+// Stop stops the subscription workers and waits for them to exit
+func (sm *SubscriptionManager) Stop(ctx context.Context) error {
 	logger.Info("Stopping subscription manager...")
 	sm.cancel()
-	sm.wg.Wait()
-	logger.Info("Subscription manager stopped")
+
+	done := make(chan struct{})
+	go func() {
+		sm.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Info("Subscription manager stopped")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("subscription manager did not stop: %w", ctx.Err())
+	}
 }
 
-// generateSubscriptionID generates a unique subscription ID
-func generateSubscriptionID() string {
+// generateSubscriptionID generates a random subscription ID.
+// IDs are encoded like geth's rpc.ID: a hex quantity without leading zeros.
+func generateSubscriptionID() (string, error) {
 	// Generate a random 16-byte array
-	b := make([]byte, 16)
-	rand.Read(b)
-	return fmt.Sprintf("0x%x", b)
+	b := make([]byte, subscriptionIDLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate subscription ID: %w", err)
+	}
+
+	id := strings.TrimLeft(hex.EncodeToString(b), "0")
+	if id == "" {
+		id = "0"
+	}
+	return "0x" + id, nil
 }
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// subscriptionIDPattern matches geth's rpc.ID encoding: a hex quantity
+// without leading zeros
+var subscriptionIDPattern = regexp.MustCompile(`^0x(0|[1-9a-f][0-9a-f]*)$`)
+
+func TestGenerateSubscriptionIDFormat(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		id, err := generateSubscriptionID()
+		if err != nil {
+			t.Fatalf("generateSubscriptionID: %v", err)
+		}
+		if !subscriptionIDPattern.MatchString(id) {
+			t.Fatalf("id %q is not a hex quantity", id)
+		}
+		if len(id) > 2+2*subscriptionIDLength {
+			t.Fatalf("id %q is longer than %d bytes", id, subscriptionIDLength)
+		}
+		if _, err := hexutil.DecodeBig(id); err != nil {
+			t.Fatalf("id %q does not decode as a quantity: %v", id, err)
+		}
+	}
+}
+
+func TestGenerateSubscriptionIDUnique(t *testing.T) {
+	const n = 10000
+	seen := make(map[string]struct{}, n)
+	for i := 0; i < n; i++ {
+		id, err := generateSubscriptionID()
+		if err != nil {
+			t.Fatalf("generateSubscriptionID: %v", err)
+		}
+		if _, dup := seen[id]; dup {
+			t.Fatalf("duplicate id %q after %d ids", id, i)
+		}
+		seen[id] = struct{}{}
+	}
+}
+
+func TestNewSubscriptionIDSkipsIDsInUse(t *testing.T) {
+	// The generator returns an ID in use before a free one
+	ids := []string{"0x1", "0x1", "0x2"}
+	sm := &SubscriptionManager{
+		subscriptions: map[string]*Subscription{"0x1": {ID: "0x1"}},
+		generateID: func() (string, error) {
+			id := ids[0]
+			ids = ids[1:]
+			return id, nil
+		},
+	}
+
+	sm.mu.Lock()
+	id, err := sm.newSubscriptionID()
+	sm.mu.Unlock()
+	if err != nil {
+		t.Fatalf("newSubscriptionID: %v", err)
+	}
+	if id != "0x2" {
+		t.Fatalf("id = %q, want 0x2", id)
+	}
+}
+
+func TestNewSubscriptionIDGivesUpOnCollisions(t *testing.T) {
+	sm := &SubscriptionManager{
+		subscriptions: map[string]*Subscription{"0x1": {ID: "0x1"}},
+		generateID:    func() (string, error) { return "0x1", nil },
+	}
+
+	sm.mu.Lock()
+	_, err := sm.newSubscriptionID()
+	sm.mu.Unlock()
+	if err == nil {
+		t.Fatal("newSubscriptionID returned an ID in use")
+	}
+}
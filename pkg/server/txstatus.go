@@ -0,0 +1,267 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// Transaction states reported by transactionStatus subscriptions, besides
+// the dropped and replaced states of the pool
+const (
+	txStatusUnknown = "unknown"
+	txStatusPending = "pending"
+	txStatusMined   = "mined"
+)
+
+// txStatusResult is the result of a transactionStatus notification
+type txStatusResult struct {
+	TransactionHash  common.Hash     `json:"transactionHash"`
+	Status           string          `json:"status"`
+	BlockNumber      *hexutil.Uint64 `json:"blockNumber,omitempty"`
+	BlockHash        *common.Hash    `json:"blockHash,omitempty"`
+	TransactionIndex *hexutil.Uint64 `json:"transactionIndex,omitempty"`
+	Reason           string          `json:"reason,omitempty"`
+	ReplacedBy       *common.Hash    `json:"replacedBy,omitempty"`
+}
+
+// same reports whether two results describe the same state
+func (r *txStatusResult) same(other *txStatusResult) bool {
+	if r == nil || other == nil || r.Status != other.Status {
+		return false
+	}
+	return r.BlockHash == nil && other.BlockHash == nil ||
+		r.BlockHash != nil && other.BlockHash != nil && *r.BlockHash == *other.BlockHash
+}
+
+// SetTxPool enables transactionStatus subscriptions, which follow
+// transactions through txPool. It must be called before Start.
+func (sm *SubscriptionManager) SetTxPool(txPool *storage.TxPoolStorage) {
+	sm.txPool = txPool
+}
+
+// SubscribeTxStatus creates a transactionStatus subscription, notified
+// whenever the transaction enters the pool, is mined, reorged out, dropped
+// or replaced
+func (sm *SubscriptionManager) SubscribeTxStatus(conn *WebSocketConnection, txHash common.Hash) (string, error) {
+	if sm.txPool == nil {
+		return "", api.NewRPCError(api.ErrCodeMethodNotSupported, "transaction status subscriptions are unavailable")
+	}
+	return sm.subscribe(conn, &Subscription{Type: SubscriptionTransactionStatus, txHash: txHash})
+}
+
+// SendTxStatus sends the current status of the transaction of a
+// transactionStatus subscription. It must be called after the subscription
+// ID has been sent.
+func (sm *SubscriptionManager) SendTxStatus(subID string) {
+	sm.mu.RLock()
+	sub, exists := sm.subscriptions[subID]
+	sm.mu.RUnlock()
+	if !exists || sub.Type != SubscriptionTransactionStatus {
+		return
+	}
+
+	status, err := sm.resolveTxStatus(sub.txHash)
+	if err != nil {
+		logger.Errorf("Failed to get status of tx %s: %v", sub.txHash.Hex(), err)
+		return
+	}
+	sm.sendTxStatus(sub, status)
+}
+
+// resolveTxStatus reads the status of a transaction from the chain index
+// and the pool
+func (sm *SubscriptionManager) resolveTxStatus(txHash common.Hash) (*txStatusResult, error) {
+	lookup, err := sm.txReader.GetTransactionLookup(sm.ctx, txHash)
+	if err == nil && lookup.BlockHash != "" {
+		number := hexutil.Uint64(lookup.BlockNumber)
+		index := hexutil.Uint64(lookup.Index)
+		blockHash := common.HexToHash(lookup.BlockHash)
+		return &txStatusResult{
+			TransactionHash:  txHash,
+			Status:           txStatusMined,
+			BlockNumber:      &number,
+			BlockHash:        &blockHash,
+			TransactionIndex: &index,
+		}, nil
+	}
+	if err != nil && err != storage.ErrNotFound {
+		return nil, fmt.Errorf("failed to get transaction lookup: %w", err)
+	}
+
+	if _, err := sm.txPool.GetPendingTx(sm.ctx, txHash); err == nil {
+		return &txStatusResult{TransactionHash: txHash, Status: txStatusPending}, nil
+	} else if err != storage.ErrNotFound {
+		return nil, fmt.Errorf("failed to get pending transaction: %w", err)
+	}
+
+	poolStatus, err := sm.txPool.GetTxStatus(sm.ctx, txHash)
+	if err == storage.ErrNotFound {
+		return &txStatusResult{TransactionHash: txHash, Status: txStatusUnknown}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction status: %w", err)
+	}
+	return &txStatusResult{
+		TransactionHash: txHash,
+		Status:          poolStatus.Status,
+		Reason:          poolStatus.Reason,
+		ReplacedBy:      poolStatus.ReplacedBy,
+	}, nil
+}
+
+// sendTxStatus notifies a subscription of a status unless it was the last
+// one sent
+func (sm *SubscriptionManager) sendTxStatus(sub *Subscription, status *txStatusResult) {
+	sub.txStatusMu.Lock()
+	defer sub.txStatusMu.Unlock()
+
+	if status.same(sub.txStatus) {
+		return
+	}
+	sub.txStatus = status
+
+	notification := map[string]interface{}{
+		"subscription": sub.ID,
+		"result":       status,
+	}
+	if err := sub.conn.SendNotification(notification); err != nil {
+		logger.Errorf("Failed to send transactionStatus notification: %v", err)
+	} else {
+		metrics.RecordNotification(string(SubscriptionTransactionStatus))
+	}
+}
+
+// notifyTxStatus notifies the subscriptions following a transaction of its
+// new status
+func (sm *SubscriptionManager) notifyTxStatus(txHash common.Hash, status *txStatusResult) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	for _, sub := range sm.subscriptions {
+		if sub.Type == SubscriptionTransactionStatus && sub.txHash == txHash {
+			sm.sendTxStatus(sub, status)
+		}
+	}
+}
+
+// notifyMinedTxs notifies the subscriptions following transactions of a
+// new canonical block
+func (sm *SubscriptionManager) notifyMinedTxs(block *types.Block) {
+	sm.mu.RLock()
+	watched := make(map[common.Hash]bool)
+	for _, sub := range sm.subscriptions {
+		if sub.Type == SubscriptionTransactionStatus {
+			watched[sub.txHash] = true
+		}
+	}
+	sm.mu.RUnlock()
+	if len(watched) == 0 {
+		return
+	}
+
+	number := hexutil.Uint64(block.NumberU64())
+	blockHash := block.Hash()
+	for i, tx := range block.Transactions() {
+		if !watched[tx.Hash()] {
+			continue
+		}
+		index := hexutil.Uint64(i)
+		sm.notifyTxStatus(tx.Hash(), &txStatusResult{
+			TransactionHash:  tx.Hash(),
+			Status:           txStatusMined,
+			BlockNumber:      &number,
+			BlockHash:        &blockHash,
+			TransactionIndex: &index,
+		})
+	}
+}
+
+// recheckReorgedTxs resolves again the status of transactions last reported
+// mined in blocks that were reorged out
+func (sm *SubscriptionManager) recheckReorgedTxs(removed []storage.TrackedBlock) {
+	reorged := make(map[common.Hash]bool, len(removed))
+	for _, block := range removed {
+		reorged[block.Hash] = true
+	}
+
+	sm.mu.RLock()
+	var subs []*Subscription
+	for _, sub := range sm.subscriptions {
+		if sub.Type != SubscriptionTransactionStatus {
+			continue
+		}
+		sub.txStatusMu.Lock()
+		last := sub.txStatus
+		sub.txStatusMu.Unlock()
+		if last != nil && last.BlockHash != nil && reorged[*last.BlockHash] {
+			subs = append(subs, sub)
+		}
+	}
+	sm.mu.RUnlock()
+
+	for _, sub := range subs {
+		status, err := sm.resolveTxStatus(sub.txHash)
+		if err != nil {
+			logger.Errorf("Failed to get status of reorged tx %s: %v", sub.txHash.Hex(), err)
+			continue
+		}
+		// The lookup may still name the reorged block until it is reindexed
+		if status.BlockHash != nil && reorged[*status.BlockHash] {
+			status = &txStatusResult{TransactionHash: sub.txHash, Status: txStatusUnknown}
+			if _, err := sm.txPool.GetPendingTx(sm.ctx, sub.txHash); err == nil {
+				status.Status = txStatusPending
+			}
+		}
+		sm.sendTxStatus(sub, status)
+	}
+}
+
+// listenPoolExits listens for transactions dropped from or replaced in the
+// pool on channel, for transactionStatus subscriptions
+func (sm *SubscriptionManager) listenPoolExits(channel string) {
+	defer sm.wg.Done()
+
+	logger.Infof("Listening for %s events...", channel)
+
+	sm.pikaClient.Listen(sm.ctx, channel, nil, func(payload string) {
+		sm.handlePoolExit(channel, payload)
+	})
+}
+
+// handlePoolExit notifies the subscriptions following a transaction that
+// left the pool without being mined
+func (sm *SubscriptionManager) handlePoolExit(channel, payload string) {
+	switch channel {
+	case "pool:dropped":
+		var event storage.TxDroppedEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			logger.Errorf("Failed to decode pool:dropped event: %v", err)
+			return
+		}
+		sm.notifyTxStatus(event.Hash, &txStatusResult{
+			TransactionHash: event.Hash,
+			Status:          storage.TxStatusDropped,
+			Reason:          event.Reason,
+		})
+	case "pool:replaced":
+		var event storage.TxReplacedEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			logger.Errorf("Failed to decode pool:replaced event: %v", err)
+			return
+		}
+		replacedBy := event.ReplacedBy
+		sm.notifyTxStatus(event.Hash, &txStatusResult{
+			TransactionHash: event.Hash,
+			Status:          storage.TxStatusReplaced,
+			ReplacedBy:      &replacedBy,
+		})
+	}
+}
@@ -3,16 +3,24 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/gorilla/websocket"
 	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/api/admin"
 	"github.com/sunvim/evm_rpc/pkg/config"
 	"github.com/sunvim/evm_rpc/pkg/logger"
 	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/middleware"
 )
 
 // WebSocketServer represents a WebSocket JSON-RPC server
@@ -25,9 +33,26 @@ type WebSocketServer struct {
 	connections         map[*WebSocketConnection]bool
 	connMutex           sync.RWMutex
 	maxConnections      int
+	chains              *chainRouter
+	errCh               chan error
+
+	// Shutdown stops new connections and calls, then waits for those in
+	// flight before closing connections
+	drainMu  sync.RWMutex
+	draining bool
+	calls    sync.WaitGroup
+	inFlight atomic.Int64
+	conns    sync.WaitGroup
+
+	listening atomic.Bool
 }
 
-// WebSocketConnection represents a WebSocket connection
+// readQueueSize bounds the messages read from a connection ahead of the
+// call being served
+const readQueueSize = 16
+
+// WebSocketConnection represents a WebSocket connection, or a Server-Sent
+// Event stream, which has no conn and writes the send queue itself
 type WebSocketConnection struct {
 	conn      *websocket.Conn
 	writeMux  sync.Mutex
@@ -35,6 +60,26 @@ type WebSocketConnection struct {
 	closeChan chan struct{}
 	closed    bool
 	clientIP  string
+	requestID string
+
+	// connectedAt is when the connection was established, and readQueue
+	// holds messages read ahead of the call being served
+	connectedAt time.Time
+	readQueue   chan []byte
+
+	// lastSeen is when a message or pong was last received, in Unix
+	// nanoseconds, telling keepalive whether the client is still there
+	lastSeen atomic.Int64
+
+	// ctx is cancelled once the client disconnects or the connection is
+	// closed, aborting the calls made over it
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// The chain the connection was opened for
+	chain         string // empty for the default chain
+	handler       *JSONRPCHandler
+	subscriptions *SubscriptionManager
 }
 
 // NewWebSocketServer creates a new WebSocket server
@@ -42,7 +87,7 @@ func NewWebSocketServer(
 	cfg config.WSConfig,
 	handler *JSONRPCHandler,
 	subscriptionManager *SubscriptionManager,
-	allowedOrigins []string,
+	corsMiddleware *middleware.CORS,
 ) *WebSocketServer {
 	ws := &WebSocketServer{
 		handler:             handler,
@@ -50,22 +95,37 @@ func NewWebSocketServer(
 		config:              cfg,
 		connections:         make(map[*WebSocketConnection]bool),
 		maxConnections:      cfg.MaxConnections,
+		chains:              newChainRouter(),
+		errCh:               make(chan error, 1),
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  cfg.ReadBufferSize,
 			WriteBufferSize: cfg.WriteBufferSize,
 			CheckOrigin: func(r *http.Request) bool {
+				var allowedOrigins []string
+				if corsMiddleware != nil {
+					allowedOrigins = corsMiddleware.Origins()
+				}
+
+				// Clients other than browsers send no origin and are
+				// allowed, as geth allows them
+				origin := r.Header.Get("Origin")
+				if origin == "" {
+					return true
+				}
+
 				// If no allowed origins specified, reject all (secure default)
 				if len(allowedOrigins) == 0 {
+					metrics.RecordOriginRejection("ws", origin)
 					return false
 				}
 				
 				// Check if origin is allowed
-				origin := r.Header.Get("Origin")
 				for _, allowed := range allowedOrigins {
 					if allowed == "*" || allowed == origin {
 						return true
 					}
 				}
+				metrics.RecordOriginRejection("ws", origin)
 				return false
 			},
 		},
@@ -82,31 +142,144 @@ func NewWebSocketServer(
 	return ws
 }
 
-// Start starts the WebSocket server
-func (s *WebSocketServer) Start() error {
-	logger.Infof("Starting WebSocket server on %s", s.config.ListenAddr)
-	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+// AddChain serves a further chain. It must be called before Start.
+func (s *WebSocketServer) AddChain(chain *Chain) {
+	s.chains.add(chain)
+}
+
+// Start binds the listener and serves WebSocket connections in the background
+func (s *WebSocketServer) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.config.ListenAddr)
+	if err != nil {
 		return fmt.Errorf("WebSocket server failed: %w", err)
 	}
+
+	logger.Infof("Starting WebSocket server on %s", s.config.ListenAddr)
+	s.listening.Store(true)
+	go func() {
+		err := s.server.Serve(ln)
+		s.listening.Store(false)
+		if err != nil && err != http.ErrServerClosed {
+			s.errCh <- fmt.Errorf("WebSocket server failed: %w", err)
+		}
+	}()
 	return nil
 }
 
-// Stop gracefully shuts down the WebSocket server
+// Err returns a channel receiving serve failures after Start
+func (s *WebSocketServer) Err() <-chan error {
+	return s.errCh
+}
+
+// Listening reports whether the server accepts connections
+func (s *WebSocketServer) Listening() bool {
+	return s.listening.Load()
+}
+
+// Stop drains the WebSocket server: it stops accepting connections and
+// calls, waits for calls in flight until ctx is done, then closes every
+// connection with a going-away close frame
 func (s *WebSocketServer) Stop(ctx context.Context) error {
 	logger.Info("Stopping WebSocket server...")
-	
-	// Close all connections
-	s.connMutex.Lock()
+
+	s.listening.Store(false)
+	s.drainMu.Lock()
+	s.draining = true
+	s.drainMu.Unlock()
+
+	// Upgraded connections are hijacked, so this only closes the listener
+	err := s.server.Shutdown(ctx)
+
+	inFlight := s.inFlight.Load()
+	if !waitGroup(ctx, &s.calls) {
+		logger.Warnf("WebSocket drain timed out with %d calls in flight", s.inFlight.Load())
+	}
+	finished := inFlight - s.inFlight.Load()
+
+	// Queue a close frame behind the responses still to be written; the
+	// connections end once clients answer it, or are cut when ctx is done
+	s.connMutex.RLock()
+	conns := make([]*WebSocketConnection, 0, len(s.connections))
 	for conn := range s.connections {
-		conn.Close()
+		conns = append(conns, conn)
 	}
-	s.connMutex.Unlock()
+	s.connMutex.RUnlock()
+	for _, conn := range conns {
+		conn.enqueue(goingAway{}, "close")
+	}
+
+	forced := 0
+	if !waitGroup(ctx, &s.conns) {
+		s.connMutex.RLock()
+		for conn := range s.connections {
+			conn.conn.Close()
+			forced++
+		}
+		s.connMutex.RUnlock()
+	}
+
+	logger.Infof("WebSocket server drained: %d of %d calls in flight finished, %d connections closed (%d cut)",
+		finished, inFlight, len(conns), forced)
+	return err
+}
+
+// waitGroup waits for wg until ctx is done, reporting whether it finished
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
 
-	return s.server.Shutdown(ctx)
+// beginCall counts a call in flight, refusing it once the server drains
+func (s *WebSocketServer) beginCall() bool {
+	s.drainMu.RLock()
+	defer s.drainMu.RUnlock()
+	if s.draining {
+		return false
+	}
+	s.calls.Add(1)
+	s.inFlight.Add(1)
+	return true
+}
+
+// endCall marks a call started with beginCall as finished
+func (s *WebSocketServer) endCall() {
+	s.inFlight.Add(-1)
+	s.calls.Done()
 }
 
 // handleWebSocket handles WebSocket upgrade and communication
 func (s *WebSocketServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	chain, ok := s.chains.route(r)
+	if !ok {
+		http.Error(w, "unknown chain", http.StatusNotFound)
+		return
+	}
+	handler, subscriptions, chainName := s.handler, s.subscriptionManager, ""
+	if chain != nil {
+		if chain.Subscriptions == nil {
+			http.Error(w, "WebSocket is not enabled for this chain", http.StatusNotFound)
+			return
+		}
+		handler, subscriptions, chainName = chain.Handler, chain.Subscriptions, chain.Name
+	}
+
+	// Banned clients are refused before upgrading; their calls are refused
+	// if they are banned later on
+	apiKey := middleware.APIKey(r)
+	if handler.denylist != nil && handler.denylist.Banned(extractIP(r), apiKey) != nil {
+		http.Error(w, "client is banned", http.StatusForbidden)
+		return
+	}
+
 	// Check connection limit
 	s.connMutex.RLock()
 	connCount := len(s.connections)
@@ -117,33 +290,59 @@ func (s *WebSocketServer) handleWebSocket(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Upgrade connection
-	conn, err := s.upgrader.Upgrade(w, r, nil)
+	// Upgrade connection. Calls made over it are logged with the ID of the
+	// upgrade request.
+	requestID := middleware.RequestID(r)
+	conn, err := s.upgrader.Upgrade(w, r, http.Header{middleware.RequestIDHeader: {requestID}})
 	if err != nil {
 		logger.Errorf("Failed to upgrade WebSocket connection: %v", err)
 		return
 	}
 
-	// Create WebSocket connection
+	// Create WebSocket connection. The upgrade request's context ends with
+	// this handler, so the connection gets its own.
+	ctx := middleware.WithAPIKey(middleware.WithRequestID(context.Background(), requestID), apiKey)
+	ctx, cancel := context.WithCancel(withListener(ctx, ListenerWS))
 	wsConn := &WebSocketConnection{
 		conn:      conn,
 		sendChan:  make(chan interface{}, 256),
 		closeChan: make(chan struct{}),
 		clientIP:  extractIP(r),
+		requestID: requestID,
+		ctx:       ctx,
+		cancel:    cancel,
+
+		connectedAt: time.Now(),
+		readQueue:   make(chan []byte, readQueueSize),
+
+		chain:         chainName,
+		handler:       handler,
+		subscriptions: subscriptions,
 	}
 
-	// Register connection
+	// Register connection, unless the server started draining meanwhile
+	s.drainMu.RLock()
+	if s.draining {
+		s.drainMu.RUnlock()
+		cancel()
+		conn.WriteControl(websocket.CloseMessage, goingAwayMessage, time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
+	s.conns.Add(1)
 	s.connMutex.Lock()
 	s.connections[wsConn] = true
 	s.connMutex.Unlock()
+	s.drainMu.RUnlock()
 
 	// Update metrics
 	metrics.RecordWebSocketConnection(1)
 
-	logger.Infof("WebSocket connection established: %s", wsConn.clientIP)
+	logger.With("request_id", requestID).Infof("WebSocket connection established: %s", wsConn.clientIP)
 
 	// Start goroutines for reading and writing
-	go wsConn.writePump()
+	wsConn.seen()
+	go wsConn.writePump(s.config)
 	go s.handleConnection(wsConn)
 }
 
@@ -154,61 +353,134 @@ func (s *WebSocketServer) handleConnection(wsConn *WebSocketConnection) {
 		s.connMutex.Lock()
 		delete(s.connections, wsConn)
 		s.connMutex.Unlock()
+		defer s.conns.Done()
 
 		// Unsubscribe all subscriptions
-		s.subscriptionManager.UnsubscribeAll(wsConn)
+		wsConn.subscriptions.UnsubscribeAll(wsConn)
 
 		// Update metrics
 		metrics.RecordWebSocketConnection(-1)
 
 		wsConn.Close()
-		logger.Infof("WebSocket connection closed: %s", wsConn.clientIP)
+		logger.With("request_id", wsConn.requestID).Infof("WebSocket connection closed: %s", wsConn.clientIP)
 	}()
 
-	// Set read deadline
-	wsConn.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	// Pongs and messages show the client is alive; writePump closes the
+	// connection once it misses pings
 	wsConn.conn.SetPongHandler(func(string) error {
-		wsConn.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		wsConn.seen()
 		return nil
 	})
 
-	for {
-		// Read message
-		_, message, err := wsConn.conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				logger.Errorf("WebSocket read error: %v", err)
+	// Messages are read on their own goroutine so that a disconnect is
+	// noticed while a call is served, cancelling it and its storage reads
+	messages := wsConn.readQueue
+	go func() {
+		defer close(messages)
+		defer wsConn.cancel()
+		for {
+			_, message, err := wsConn.conn.ReadMessage()
+			if err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+					logger.Errorf("WebSocket read error: %v", err)
+				}
+				return
 			}
+			wsConn.seen()
+			select {
+			case messages <- message:
+			case <-wsConn.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for message := range messages {
+		if wsConn.ctx.Err() != nil {
 			return
 		}
 
 		// Parse request
 		req, err := ParseRequest(message)
 		if err != nil {
-			wsConn.SendError(nil, api.ErrCodeParse, err.Error())
+			rpcErr := requestError(err)
+			wsConn.SendError(nil, rpcErr.Code, rpcErr.Message)
 			continue
 		}
 
-		// Handle request based on type
-		ctx := context.Background()
-
-		switch v := req.(type) {
-		case *JSONRPCRequest:
-			// Check for subscription methods
-			if v.Method == "eth_subscribe" {
-				s.handleSubscribe(wsConn, v)
-			} else if v.Method == "eth_unsubscribe" {
-				s.handleUnsubscribe(wsConn, v)
-			} else {
-				// Regular JSON-RPC request
-				response := s.handler.HandleRequest(ctx, v, wsConn.clientIP)
-				wsConn.Send(response)
+		if !s.beginCall() {
+			var id interface{}
+			if single, ok := req.(*JSONRPCRequest); ok {
+				id = single.ID
+			}
+			wsConn.SendError(id, api.ErrCodeResourceUnavail, "server is shutting down")
+			continue
+		}
+		s.serveRequest(wsConn, req)
+		s.endCall()
+	}
+}
+
+// ConnectionStats describes the open connections, oldest first
+func (s *WebSocketServer) ConnectionStats() []admin.WebSocketConnection {
+	s.connMutex.RLock()
+	conns := make([]*WebSocketConnection, 0, len(s.connections))
+	for conn := range s.connections {
+		conns = append(conns, conn)
+	}
+	s.connMutex.RUnlock()
+	sort.Slice(conns, func(i, j int) bool { return conns[i].connectedAt.Before(conns[j].connectedAt) })
+
+	now := time.Now()
+	stats := make([]admin.WebSocketConnection, len(conns))
+	for i, conn := range conns {
+		stats[i] = admin.WebSocketConnection{
+			ClientIP:      stripPort(conn.clientIP),
+			RequestID:     conn.requestID,
+			Chain:         conn.chain,
+			Subscriptions: conn.subscriptions.subscriptionCounts(conn),
+			Queued:        len(conn.sendChan),
+			Pending:       len(conn.readQueue),
+			ConnectedAt:   conn.connectedAt,
+			Uptime:        now.Sub(conn.connectedAt).Round(time.Second).String(),
+		}
+	}
+	return stats
+}
+
+// serveRequest answers a parsed request or batch
+func (s *WebSocketServer) serveRequest(wsConn *WebSocketConnection, req interface{}) {
+	ctx, cancel := context.WithCancel(wsConn.ctx)
+	defer cancel()
+
+	switch v := req.(type) {
+	case *JSONRPCRequest:
+		// Check for subscription methods, which the handler does not see
+		isSubscription := v.Method == "eth_subscribe" || v.Method == "eth_unsubscribe" || v.Method == "eth_unsubscribeAll"
+		if isSubscription && !wsConn.handler.methodBound(ctx, v.Method) {
+			wsConn.SendError(v.ID, api.ErrCodeMethodNotFound, fmt.Sprintf("method not found: %s", v.Method))
+		} else if v.Method == "eth_subscribe" {
+			s.handleSubscribe(wsConn, v)
+		} else if v.Method == "eth_unsubscribe" {
+			s.handleUnsubscribe(wsConn, v)
+		} else if v.Method == "eth_unsubscribeAll" {
+			s.handleUnsubscribeAll(wsConn, v)
+		} else {
+			// Regular JSON-RPC request; notifications get no response
+			resp := wsConn.handler.HandleRequest(ctx, v, wsConn.clientIP)
+			if v.IsNotification() {
+				return
 			}
-		case []*JSONRPCRequest:
-			// Batch request
-			responses := s.handler.HandleBatch(ctx, v, wsConn.clientIP)
-			wsConn.Send(responses)
+			response, err := wsConn.handler.encodeResponse(v, resp)
+			wsConn.sendEncoded(v.ID, response, err)
 		}
+	case []*JSONRPCRequest:
+		// Batch request
+		responses, err := wsConn.handler.encodeBatch(v, wsConn.handler.HandleBatch(ctx, v, wsConn.clientIP))
+		if err == nil && responses == nil {
+			return
+		}
+		wsConn.sendEncoded(nil, responses, err)
 	}
 }
 
@@ -233,6 +505,11 @@ func (s *WebSocketServer) handleSubscribe(wsConn *WebSocketConnection, req *JSON
 		return
 	}
 
+	if !isValidSubscriptionType(SubscriptionType(subType)) {
+		wsConn.SendError(req.ID, api.ErrCodeInvalidParams, fmt.Sprintf("unsupported subscription type: %s", subType))
+		return
+	}
+
 	// Parse filter criteria for logs subscription
 	var filter *FilterCriteria
 	if subType == "logs" && len(params) > 1 {
@@ -243,10 +520,25 @@ func (s *WebSocketServer) handleSubscribe(wsConn *WebSocketConnection, req *JSON
 		}
 	}
 
-	// Create subscription
-	subID, err := s.subscriptionManager.Subscribe(wsConn, SubscriptionType(subType), filter)
+	// Create subscription; transactionStatus follows the hash given
+	var subID string
+	var err error
+	if SubscriptionType(subType) == SubscriptionTransactionStatus {
+		var txHash common.Hash
+		if len(params) < 2 || json.Unmarshal(params[1], &txHash) != nil {
+			wsConn.SendError(req.ID, api.ErrCodeInvalidParams, "invalid transaction hash")
+			return
+		}
+		subID, err = wsConn.subscriptions.SubscribeTxStatus(wsConn, txHash)
+	} else {
+		subID, err = wsConn.subscriptions.Subscribe(wsConn, SubscriptionType(subType), filter)
+	}
 	if err != nil {
-		wsConn.SendError(req.ID, api.ErrCodeInternal, err.Error())
+		if rpcErr, ok := err.(*api.RPCError); ok {
+			wsConn.SendError(req.ID, rpcErr.Code, rpcErr.Message)
+		} else {
+			wsConn.SendError(req.ID, api.ErrCodeInternal, err.Error())
+		}
 		return
 	}
 
@@ -257,6 +549,11 @@ func (s *WebSocketServer) handleSubscribe(wsConn *WebSocketConnection, req *JSON
 		Result:  subID,
 	}
 	wsConn.Send(response)
+
+	// Replay missed logs, or send the current transaction status, once the
+	// client knows the subscription ID
+	wsConn.subscriptions.StartBackfill(subID)
+	wsConn.subscriptions.SendTxStatus(subID)
 }
 
 // handleUnsubscribe handles eth_unsubscribe requests
@@ -276,7 +573,7 @@ func (s *WebSocketServer) handleUnsubscribe(wsConn *WebSocketConnection, req *JS
 	subID := params[0]
 
 	// Unsubscribe
-	if err := s.subscriptionManager.Unsubscribe(subID); err != nil {
+	if err := wsConn.subscriptions.Unsubscribe(wsConn, subID); err != nil {
 		wsConn.SendError(req.ID, api.ErrCodeInternal, err.Error())
 		return
 	}
@@ -290,27 +587,152 @@ func (s *WebSocketServer) handleUnsubscribe(wsConn *WebSocketConnection, req *JS
 	wsConn.Send(response)
 }
 
+// handleUnsubscribeAll handles eth_unsubscribeAll requests, a non-standard
+// extension removing all subscriptions of the connection at once. The
+// result is the number removed.
+func (s *WebSocketServer) handleUnsubscribeAll(wsConn *WebSocketConnection, req *JSONRPCRequest) {
+	var params []json.RawMessage
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			wsConn.SendError(req.ID, api.ErrCodeInvalidParams, "invalid params")
+			return
+		}
+	}
+	if len(params) > 0 {
+		wsConn.SendError(req.ID, api.ErrCodeInvalidParams, "too many arguments, want at most 0")
+		return
+	}
+
+	removed := wsConn.subscriptions.UnsubscribeAll(wsConn)
+
+	// Send response
+	response := &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result:  hexutil.Uint64(removed),
+	}
+	wsConn.Send(response)
+}
+
+// OrphanedSubscriptions describes the subscriptions of every chain whose
+// connection is closed, and counts those the sweeps removed
+func (s *WebSocketServer) OrphanedSubscriptions() *admin.OrphanedSubscriptions {
+	result := &admin.OrphanedSubscriptions{
+		Subscriptions: []admin.OrphanedSubscription{},
+	}
+	managers := map[string]*SubscriptionManager{"": s.subscriptionManager}
+	for _, chain := range s.chains.byName {
+		if chain.Subscriptions != nil {
+			managers[chain.Name] = chain.Subscriptions
+		}
+	}
+	for name, manager := range managers {
+		orphans, removed := manager.orphans(name)
+		result.Subscriptions = append(result.Subscriptions, orphans...)
+		result.Removed += removed
+	}
+	return result
+}
+
+// errSendQueueFull is returned for notifications dropped because the client
+// does not keep up with reading them
+var errSendQueueFull = errors.New("send queue full")
+
+// blockTiming dates a notification about a block: the block's timestamp,
+// to measure how far delivery is behind the chain, and when its blocks:new
+// message was received, zero for blocks replayed after a reconnect
+type blockTiming struct {
+	blockTime  uint64
+	receivedAt time.Time
+}
+
+// blockNotification is a notification about a block, written with its
+// timing
+type blockNotification struct {
+	msg     interface{}
+	subType string
+	blockTiming
+}
+
+// recordDelivery records how late the notification was written, behind the
+// chain and behind its blocks:new message
+func (n blockNotification) recordDelivery() {
+	metrics.RecordDeliveryLag(n.subType, headLag(time.Unix(int64(n.blockTime), 0)))
+	if !n.receivedAt.IsZero() {
+		metrics.RecordPubSubDelivery(n.subType, time.Since(n.receivedAt))
+	}
+}
+
+// goingAway asks the write pump to close the connection with a going-away
+// close frame once the messages queued before it are written
+type goingAway struct{}
+
+// goingAwayMessage is the close frame sent when the server shuts down
+var goingAwayMessage = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+
 // Send sends a message to the WebSocket connection
 func (c *WebSocketConnection) Send(msg interface{}) {
+	c.enqueue(msg, "response")
+}
+
+// enqueue queues a message for the write pump, dropping it when the queue
+// is full. It reports whether the message was queued.
+func (c *WebSocketConnection) enqueue(msg interface{}, kind string) bool {
 	if c.closed {
-		return
+		return false
 	}
+	metrics.RecordSendQueueDepth(len(c.sendChan))
 	select {
 	case c.sendChan <- msg:
+		return true
 	default:
 		logger.Warn("WebSocket send channel full, dropping message")
+		metrics.RecordDroppedMessage(kind)
+		return false
+	}
+}
+
+// sendEncoded sends a serialized response, or an internal error if it
+// failed to serialize
+func (c *WebSocketConnection) sendEncoded(id interface{}, response json.RawMessage, err error) {
+	if err != nil {
+		logger.Errorf("Failed to encode response: %v", err)
+		c.SendError(id, api.ErrCodeInternal, "failed to encode response")
+		return
 	}
+	c.Send(response)
 }
 
 // SendNotification sends a subscription notification
 func (c *WebSocketConnection) SendNotification(notification interface{}) error {
-	msg := map[string]interface{}{
+	return c.sendNotification(notificationMessage(notification))
+}
+
+// SendBlockNotification sends a subscription notification about a block,
+// recording its delivery lag against timing once written
+func (c *WebSocketConnection) SendBlockNotification(subType string, timing blockTiming, notification interface{}) error {
+	return c.sendNotification(blockNotification{
+		msg:         notificationMessage(notification),
+		subType:     subType,
+		blockTiming: timing,
+	})
+}
+
+// sendNotification queues a notification message
+func (c *WebSocketConnection) sendNotification(msg interface{}) error {
+	if !c.enqueue(msg, "notification") {
+		return errSendQueueFull
+	}
+	return nil
+}
+
+// notificationMessage wraps a notification in an eth_subscription message
+func notificationMessage(notification interface{}) map[string]interface{} {
+	return map[string]interface{}{
 		"jsonrpc": "2.0",
 		"method":  "eth_subscription",
 		"params":  notification,
 	}
-	c.Send(msg)
-	return nil
 }
 
 // SendError sends an error response
@@ -326,10 +748,27 @@ func (c *WebSocketConnection) SendError(id interface{}, code int, message string
 	c.Send(response)
 }
 
-// writePump pumps messages from the send channel to the WebSocket connection
-func (c *WebSocketConnection) writePump() {
-	ticker := time.NewTicker(54 * time.Second)
-	defer ticker.Stop()
+// seen records that the client was heard from
+func (c *WebSocketConnection) seen() {
+	c.lastSeen.Store(time.Now().UnixNano())
+}
+
+// writePump pumps messages from the send channel to the WebSocket
+// connection and pings the client every cfg.PingInterval. A ping is missed
+// when nothing is received within cfg.PongTimeout; after cfg.MaxMissedPongs
+// missed in a row the connection is half-open and is closed.
+func (c *WebSocketConnection) writePump(cfg config.WSConfig) {
+	var pings <-chan time.Time
+	if cfg.PingInterval > 0 {
+		ticker := time.NewTicker(cfg.PingInterval)
+		defer ticker.Stop()
+		pings = ticker.C
+	}
+	var (
+		pongDeadline <-chan time.Time
+		pingSent     int64
+		missed       int
+	)
 
 	for {
 		select {
@@ -339,16 +778,45 @@ func (c *WebSocketConnection) writePump() {
 				return
 			}
 
+			if _, ok := message.(goingAway); ok {
+				c.writeMux.Lock()
+				c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				c.conn.WriteMessage(websocket.CloseMessage, goingAwayMessage)
+				c.writeMux.Unlock()
+				return
+			}
+
+			block, isBlock := message.(blockNotification)
+			if isBlock {
+				message = block.msg
+			}
+
+			// Responses arrive serialized, notifications are encoded here
+			data, ok := message.(json.RawMessage)
+			if !ok {
+				var err error
+				if data, err = json.Marshal(message); err != nil {
+					logger.Errorf("Failed to encode WebSocket message: %v", err)
+					continue
+				}
+			}
+
 			c.writeMux.Lock()
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := c.conn.WriteJSON(message); err != nil {
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
 				c.writeMux.Unlock()
 				logger.Errorf("WebSocket write error: %v", err)
 				return
 			}
 			c.writeMux.Unlock()
+			metrics.RecordEgress("ws", len(data))
+			if isBlock {
+				block.recordDelivery()
+			}
 
-		case <-ticker.C:
+		case <-pings:
+			// Taken before writing, so that a fast pong counts
+			pingSent = time.Now().UnixNano()
 			c.writeMux.Lock()
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -356,6 +824,22 @@ func (c *WebSocketConnection) writePump() {
 				return
 			}
 			c.writeMux.Unlock()
+			pongDeadline = time.After(cfg.PongTimeout)
+
+		case <-pongDeadline:
+			pongDeadline = nil
+			if c.lastSeen.Load() >= pingSent {
+				missed = 0
+				continue
+			}
+			metrics.RecordMissedPong()
+			if missed++; missed >= cfg.MaxMissedPongs {
+				metrics.RecordKeepaliveClose()
+				logger.With("request_id", c.requestID).Infof("Closing WebSocket connection after %d missed pings: %s", missed, c.clientIP)
+				// Closing the socket ends the read loop, which cleans up
+				c.conn.Close()
+				return
+			}
 
 		case <-c.closeChan:
 			return
@@ -369,7 +853,10 @@ func (c *WebSocketConnection) Close() {
 		return
 	}
 	c.closed = true
+	c.cancel()
 	close(c.closeChan)
 	close(c.sendChan)
-	c.conn.Close()
+	if c.conn != nil {
+		c.conn.Close()
+	}
 }
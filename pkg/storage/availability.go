@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+)
+
+// Storage availability states
+const (
+	AvailabilityAvailable = "available"
+	AvailabilityDegraded  = "degraded"
+)
+
+// Availability is the availability state of a Pika deployment. While it is
+// degraded, readers serve what they hold in memory, such as the last known
+// head and cached blocks and receipts, instead of failing every call.
+type Availability struct {
+	degraded atomic.Bool
+	since    atomic.Int64 // unix time of the last transition
+}
+
+// Degraded reports whether Pika is considered unreachable
+func (a *Availability) Degraded() bool {
+	return a != nil && a.degraded.Load()
+}
+
+// State returns the availability state
+func (a *Availability) State() string {
+	if a.Degraded() {
+		return AvailabilityDegraded
+	}
+	return AvailabilityAvailable
+}
+
+// Since returns when the current state was entered, zero if it never
+// changed
+func (a *Availability) Since() time.Time {
+	if a == nil || a.since.Load() == 0 {
+		return time.Time{}
+	}
+	return time.Unix(a.since.Load(), 0)
+}
+
+// set changes the state and reports whether it changed
+func (a *Availability) set(degraded bool) bool {
+	if a.degraded.Swap(degraded) == degraded {
+		return false
+	}
+	a.since.Store(time.Now().Unix())
+	return true
+}
+
+// AvailabilityMonitor probes Pika and drives its availability state
+// machine: available turns degraded after failureThreshold consecutive
+// failed probes, and degraded turns available again after
+// recoveryThreshold consecutive successful ones, so that a flapping
+// connection does not flip the state on every probe
+type AvailabilityMonitor struct {
+	client            *PikaClient
+	interval          time.Duration
+	failureThreshold  int
+	recoveryThreshold int
+
+	// Consecutive probe outcomes, owned by the probe loop
+	failures  int
+	successes int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewAvailabilityMonitor creates a monitor of client's availability
+func NewAvailabilityMonitor(client *PikaClient, cfg config.DegradedConfig) *AvailabilityMonitor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &AvailabilityMonitor{
+		client:            client,
+		interval:          cfg.ProbeInterval,
+		failureThreshold:  cfg.FailureThreshold,
+		recoveryThreshold: cfg.RecoveryThreshold,
+		ctx:               ctx,
+		cancel:            cancel,
+	}
+}
+
+// Start probes Pika in the background
+func (m *AvailabilityMonitor) Start(ctx context.Context) error {
+	metrics.RecordStorageDegraded(m.client.node, false)
+
+	m.wg.Add(1)
+	go m.run()
+	return nil
+}
+
+// Stop stops probing
+func (m *AvailabilityMonitor) Stop(ctx context.Context) error {
+	m.cancel()
+	m.wg.Wait()
+	return nil
+}
+
+// run probes Pika at the probe interval until the monitor is stopped
+func (m *AvailabilityMonitor) run() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.probe()
+		}
+	}
+}
+
+// probe pings the primary and moves the state on once enough probes agree.
+// Pings rejected by an open circuit breaker count as failed.
+func (m *AvailabilityMonitor) probe() {
+	ctx, cancel := context.WithTimeout(m.ctx, m.interval)
+	defer cancel()
+
+	err := m.client.Ping(ctx)
+	if m.ctx.Err() != nil {
+		return
+	}
+
+	availability := m.client.availability
+	if err != nil {
+		m.failures++
+		m.successes = 0
+		if m.failures >= m.failureThreshold && availability.set(true) {
+			logger.Warnf("Pika unreachable after %d probes, serving cached data read-only: node=%s, error=%v", m.failures, m.client.node, err)
+			metrics.RecordStorageDegraded(m.client.node, true)
+		}
+		return
+	}
+
+	m.successes++
+	m.failures = 0
+	if m.successes >= m.recoveryThreshold && availability.set(false) {
+		logger.Infof("Pika reachable again, leaving degraded mode: node=%s", m.client.node)
+		metrics.RecordStorageDegraded(m.client.node, false)
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/sunvim/evm_rpc/pkg/txsender"
 )
 
 var (
@@ -16,9 +18,24 @@ var (
 	ErrInvalidData  = errors.New("invalid data")
 )
 
+// BlockCache is an in-memory cache of blocks and receipts by number,
+// consulted by BlockReader before Pika
+type BlockCache interface {
+	GetBlock(number uint64) (*types.Block, bool)
+	SetBlock(number uint64, block *types.Block)
+	GetReceipts(number uint64) (types.Receipts, bool)
+	SetReceipts(number uint64, receipts types.Receipts)
+}
+
 // BlockReader reads block data from Pika
 type BlockReader struct {
 	client *PikaClient
+	cache  BlockCache
+	cold   *ColdStore
+
+	// lastHead is the last head read from Pika plus one, zero until the
+	// first read; served while Pika is unreachable
+	lastHead atomic.Uint64
 }
 
 // NewBlockReader creates a new block reader
@@ -26,13 +43,61 @@ func NewBlockReader(client *PikaClient) *BlockReader {
 	return &BlockReader{client: client}
 }
 
-// GetLatestBlockNumber returns the latest block number
+// SetCache makes the reader serve blocks and receipts from cache.
+// It must be called before the reader is used.
+func (r *BlockReader) SetCache(cache BlockCache) {
+	r.cache = cache
+}
+
+// SetColdStore makes the reader serve blocks below the cold store's height
+// from object storage. It must be called before the reader is used.
+func (r *BlockReader) SetColdStore(cold *ColdStore) {
+	r.cold = cold
+}
+
+// coldBlock returns a block from cold storage if it is served from there
+func (r *BlockReader) coldBlock(ctx context.Context, number uint64) (*ColdBlock, bool, error) {
+	if r.cold == nil || !r.cold.Covers(number) {
+		return nil, false, nil
+	}
+	block, err := r.cold.Get(ctx, number)
+	return block, true, err
+}
+
+// GetLatestBlockNumber returns the latest block number, or the height ctx
+// is pinned to
 func (r *BlockReader) GetLatestBlockNumber(ctx context.Context) (uint64, error) {
+	if height, ok := PinnedHeight(ctx); ok {
+		return height, nil
+	}
+	return r.GetHeadNumber(ctx)
+}
+
+// GetHeadNumber returns the number of the head block, ignoring pins
+func (r *BlockReader) GetHeadNumber(ctx context.Context) (uint64, error) {
 	data, err := r.client.Get(ctx, "idx:latest")
 	if err != nil {
+		if head, ok := r.LastHead(); ok && r.client.Availability().Degraded() {
+			return head, nil
+		}
 		return 0, err
 	}
-	return strconv.ParseUint(string(data), 10, 64)
+	head, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	r.lastHead.Store(head + 1)
+	return head, nil
+}
+
+// LastHead returns the last head read from Pika, which is served while Pika
+// is unreachable
+func (r *BlockReader) LastHead() (uint64, bool) {
+	head := r.lastHead.Load()
+	if head == 0 {
+		return 0, false
+	}
+	return head - 1, true
 }
 
 // GetBlockNumberByHash returns block number by hash
@@ -40,56 +105,131 @@ func (r *BlockReader) GetBlockNumberByHash(ctx context.Context, hash common.Hash
 	key := fmt.Sprintf("idx:blk:hash:%s", hash.Hex())
 	data, err := r.client.Get(ctx, key)
 	if err != nil {
+		if number, ok := r.cachedNumberByHash(hash); ok && r.client.Availability().Degraded() {
+			return number, nil
+		}
 		return 0, err
 	}
 	return strconv.ParseUint(string(data), 10, 64)
 }
 
+// cachedNumberByHash looks hash up among the cached blocks of the reorg
+// window below the last head, standing in for the hash index while Pika is
+// unreachable
+func (r *BlockReader) cachedNumberByHash(hash common.Hash) (uint64, bool) {
+	head, ok := r.LastHead()
+	if r.cache == nil || !ok {
+		return 0, false
+	}
+	for i := uint64(0); i < DefaultCanonicalDepth && i <= head; i++ {
+		if block, ok := r.cache.GetBlock(head - i); ok && block.Hash() == hash {
+			return head - i, true
+		}
+	}
+	return 0, false
+}
+
 // GetHeader returns block header by number
 func (r *BlockReader) GetHeader(ctx context.Context, number uint64) (*types.Header, error) {
-	key := fmt.Sprintf("blk:hdr:%d", number)
-	data, err := r.client.Get(ctx, key)
-	if err != nil {
-		return nil, err
+	if r.cache != nil {
+		if block, ok := r.cache.GetBlock(number); ok {
+			return block.Header(), nil
+		}
 	}
 
-	var header types.Header
-	if err := rlp.DecodeBytes(data, &header); err != nil {
-		return nil, fmt.Errorf("failed to decode header: %w", err)
+	if cold, ok, err := r.coldBlock(ctx, number); ok {
+		if err != nil {
+			return nil, err
+		}
+		return decodeHeader(cold.Header)
 	}
 
-	return &header, nil
+	data, err := r.client.Get(ctx, headerKey(number))
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeHeader(data)
 }
 
 // GetBlockBody returns block body by number
 func (r *BlockReader) GetBlockBody(ctx context.Context, number uint64) (*types.Body, error) {
-	key := fmt.Sprintf("blk:body:%d", number)
-	data, err := r.client.Get(ctx, key)
-	if err != nil {
-		return nil, err
+	if cold, ok, err := r.coldBlock(ctx, number); ok {
+		if err != nil {
+			return nil, err
+		}
+		return decodeBody(cold.Body)
 	}
 
-	var body types.Body
-	if err := rlp.DecodeBytes(data, &body); err != nil {
-		return nil, fmt.Errorf("failed to decode body: %w", err)
+	data, err := r.client.Get(ctx, bodyKey(number))
+	if err != nil {
+		return nil, err
 	}
 
-	return &body, nil
+	return decodeBody(data)
 }
 
-// GetBlock returns full block by number
+// GetBlock returns full block by number.
+// Header and body are fetched in a single round trip.
 func (r *BlockReader) GetBlock(ctx context.Context, number uint64) (*types.Block, error) {
-	header, err := r.GetHeader(ctx, number)
+	if r.cache != nil {
+		if block, ok := r.cache.GetBlock(number); ok {
+			return block, nil
+		}
+	}
+	return r.readBlock(ctx, number)
+}
+
+// readBlock reads a block by number from storage, bypassing the cache
+func (r *BlockReader) readBlock(ctx context.Context, number uint64) (*types.Block, error) {
+	if cold, ok, err := r.coldBlock(ctx, number); ok {
+		if err != nil {
+			return nil, err
+		}
+		return r.decodeBlock(number, cold.Header, cold.Body)
+	}
+
+	values, err := r.client.MGet(ctx, headerKey(number), bodyKey(number))
 	if err != nil {
 		return nil, err
 	}
 
-	body, err := r.GetBlockBody(ctx, number)
+	return r.decodeBlockValues(number, values[0], values[1])
+}
+
+// decodeBlockValues assembles a block from MGet replies of its header and body
+func (r *BlockReader) decodeBlockValues(number uint64, headerValue, bodyValue interface{}) (*types.Block, error) {
+	headerData, ok := mgetBytes(headerValue)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	bodyData, ok := mgetBytes(bodyValue)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r.decodeBlock(number, headerData, bodyData)
+}
+
+// decodeBlock assembles a block from its stored header and body
+func (r *BlockReader) decodeBlock(number uint64, headerData, bodyData []byte) (*types.Block, error) {
+	header, err := decodeHeader(headerData)
+	if err != nil {
+		return nil, err
+	}
+	body, err := decodeBody(bodyData)
 	if err != nil {
 		return nil, err
 	}
 
-	return types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles), nil
+	// Recover senders in the background ahead of rendering
+	txsender.Prefetch(body.Transactions)
+
+	block := types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles)
+	if r.cache != nil {
+		r.cache.SetBlock(number, block)
+	}
+
+	return block, nil
 }
 
 // GetBlockByHash returns full block by hash
@@ -98,20 +238,46 @@ func (r *BlockReader) GetBlockByHash(ctx context.Context, hash common.Hash) (*ty
 	if err != nil {
 		return nil, err
 	}
-	return r.GetBlock(ctx, number)
+	if r.cache != nil {
+		// The block cached at its height may have been reorged out since
+		if block, ok := r.cache.GetBlock(number); ok && block.Hash() == hash {
+			return block, nil
+		}
+	}
+	return r.readBlock(ctx, number)
 }
 
-// GetReceipts returns receipts for a block
+// GetReceipts returns receipts for a block with their derived fields filled
+// in
 func (r *BlockReader) GetReceipts(ctx context.Context, number uint64) (types.Receipts, error) {
-	key := fmt.Sprintf("blk:rcpt:%d", number)
-	data, err := r.client.Get(ctx, key)
+	if r.cache != nil {
+		if receipts, ok := r.cache.GetReceipts(number); ok {
+			return receipts, nil
+		}
+	}
+
+	var data []byte
+	if cold, ok, err := r.coldBlock(ctx, number); ok {
+		if err != nil {
+			return nil, err
+		}
+		data = cold.Receipts
+	} else if data, err = r.client.Get(ctx, receiptsKey(number)); err != nil {
+		return nil, err
+	}
+
+	receipts, err := decodeReceipts(data)
+	if err != nil {
+		return nil, err
+	}
+	block, err := r.GetBlock(ctx, number)
 	if err != nil {
 		return nil, err
 	}
+	deriveReceipts(receipts, block)
 
-	var receipts types.Receipts
-	if err := rlp.DecodeBytes(data, &receipts); err != nil {
-		return nil, fmt.Errorf("failed to decode receipts: %w", err)
+	if r.cache != nil {
+		r.cache.SetReceipts(number, receipts)
 	}
 
 	return receipts, nil
@@ -146,3 +312,86 @@ func (r *BlockReader) GetUncleCountByHash(ctx context.Context, hash common.Hash)
 	// BSC doesn't have uncles
 	return 0, nil
 }
+
+// GetBlockLogs returns all logs emitted in a block with their block and
+// transaction context filled in
+func (r *BlockReader) GetBlockLogs(ctx context.Context, number uint64) ([]*types.Log, error) {
+	block, err := r.GetBlock(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+
+	receipts, err := r.GetReceipts(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+
+	return blockLogs(block, receipts), nil
+}
+
+// blockLogs returns the logs of a block with their block and transaction
+// context filled in
+func blockLogs(block *types.Block, receipts types.Receipts) []*types.Log {
+	txs := block.Transactions()
+	var logs []*types.Log
+	var logIndex uint
+	for i, receipt := range receipts {
+		for _, l := range receipt.Logs {
+			// Copy so that cached receipts are never mutated
+			log := new(types.Log)
+			*log = *l
+			log.BlockNumber = block.NumberU64()
+			log.BlockHash = block.Hash()
+			log.TxIndex = uint(i)
+			if i < len(txs) {
+				log.TxHash = txs[i].Hash()
+			}
+			log.Index = logIndex
+			logIndex++
+			logs = append(logs, log)
+		}
+	}
+
+	return logs
+}
+
+// Storage keys of block data
+func headerKey(number uint64) string   { return fmt.Sprintf("blk:hdr:%d", number) }
+func bodyKey(number uint64) string     { return fmt.Sprintf("blk:body:%d", number) }
+func receiptsKey(number uint64) string { return fmt.Sprintf("blk:rcpt:%d", number) }
+
+// decodeHeader decodes an RLP block header
+func decodeHeader(data []byte) (*types.Header, error) {
+	var header types.Header
+	if err := rlp.DecodeBytes(data, &header); err != nil {
+		return nil, fmt.Errorf("failed to decode header: %w", err)
+	}
+	return &header, nil
+}
+
+// decodeBody decodes an RLP block body
+func decodeBody(data []byte) (*types.Body, error) {
+	var body types.Body
+	if err := rlp.DecodeBytes(data, &body); err != nil {
+		return nil, fmt.Errorf("failed to decode body: %w", err)
+	}
+	return &body, nil
+}
+
+// decodeReceipts decodes RLP block receipts
+func decodeReceipts(data []byte) (types.Receipts, error) {
+	var receipts types.Receipts
+	if err := rlp.DecodeBytes(data, &receipts); err != nil {
+		return nil, fmt.Errorf("failed to decode receipts: %w", err)
+	}
+	return receipts, nil
+}
+
+// mgetBytes converts an MGet reply entry, reporting whether the key existed
+func mgetBytes(value interface{}) ([]byte, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, false
+	}
+	return []byte(s), true
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// rangeBatchSize bounds the blocks fetched per round trip by range queries
+const rangeBatchSize = 100
+
+// GetBlocksRange returns the blocks in [from, to], indexed from from.
+// Blocks missing from storage are returned as nil entries.
+func (r *BlockReader) GetBlocksRange(ctx context.Context, from, to uint64) ([]*types.Block, error) {
+	if to < from {
+		return nil, nil
+	}
+	return r.getBlocks(ctx, numberRange(from, to))
+}
+
+// getBlocks returns the blocks with the given numbers, indexed like
+// numbers. Blocks missing from storage are returned as nil entries.
+func (r *BlockReader) getBlocks(ctx context.Context, numbers []uint64) ([]*types.Block, error) {
+	blocks := make([]*types.Block, len(numbers))
+	var missing []int
+	for i, number := range numbers {
+		if r.cache != nil {
+			if block, ok := r.cache.GetBlock(number); ok {
+				blocks[i] = block
+				continue
+			}
+		}
+		if r.cold != nil && r.cold.Covers(number) {
+			block, err := r.GetBlock(ctx, number)
+			if err != nil && err != ErrNotFound {
+				return nil, err
+			}
+			blocks[i] = block
+			continue
+		}
+		missing = append(missing, i)
+	}
+
+	for start := 0; start < len(missing); start += rangeBatchSize {
+		batch := missing[start:min(start+rangeBatchSize, len(missing))]
+
+		keys := make([]string, 0, 2*len(batch))
+		for _, i := range batch {
+			keys = append(keys, headerKey(numbers[i]), bodyKey(numbers[i]))
+		}
+		values, err := r.client.MGet(ctx, keys...)
+		if err != nil {
+			return nil, err
+		}
+
+		for j, i := range batch {
+			block, err := r.decodeBlockValues(numbers[i], values[2*j], values[2*j+1])
+			if err == ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			blocks[i] = block
+		}
+	}
+
+	return blocks, nil
+}
+
+// GetReceiptsRange returns the receipts of the blocks in [from, to], indexed
+// from from. Blocks missing from storage are returned as nil entries.
+func (r *BlockReader) GetReceiptsRange(ctx context.Context, from, to uint64) ([]types.Receipts, error) {
+	if to < from {
+		return nil, nil
+	}
+	numbers := numberRange(from, to)
+	blocks, err := r.getBlocks(ctx, numbers)
+	if err != nil {
+		return nil, err
+	}
+	return r.getReceipts(ctx, numbers, blocks)
+}
+
+// getReceipts returns the receipts of the blocks with the given numbers,
+// indexed like numbers, deriving their fields from blocks. Blocks missing
+// from storage are returned as nil entries.
+func (r *BlockReader) getReceipts(ctx context.Context, numbers []uint64, blocks []*types.Block) ([]types.Receipts, error) {
+	receipts := make([]types.Receipts, len(numbers))
+	var missing []int
+	for i, number := range numbers {
+		if r.cache != nil {
+			if cached, ok := r.cache.GetReceipts(number); ok {
+				receipts[i] = cached
+				continue
+			}
+		}
+		if r.cold != nil && r.cold.Covers(number) {
+			cold, err := r.GetReceipts(ctx, number)
+			if err != nil && err != ErrNotFound {
+				return nil, err
+			}
+			receipts[i] = cold
+			continue
+		}
+		if blocks[i] != nil {
+			missing = append(missing, i)
+		}
+	}
+
+	for start := 0; start < len(missing); start += rangeBatchSize {
+		batch := missing[start:min(start+rangeBatchSize, len(missing))]
+
+		keys := make([]string, len(batch))
+		for j, i := range batch {
+			keys[j] = receiptsKey(numbers[i])
+		}
+		values, err := r.client.MGet(ctx, keys...)
+		if err != nil {
+			return nil, err
+		}
+
+		for j, i := range batch {
+			data, ok := mgetBytes(values[j])
+			if !ok {
+				continue
+			}
+			decoded, err := decodeReceipts(data)
+			if err != nil {
+				return nil, err
+			}
+			deriveReceipts(decoded, blocks[i])
+			if r.cache != nil {
+				r.cache.SetReceipts(numbers[i], decoded)
+			}
+			receipts[i] = decoded
+		}
+	}
+
+	return receipts, nil
+}
+
+// GetLogsRange returns all logs emitted in [from, to] in chain order.
+// Blocks missing from storage are skipped. Blocks are loaded one batch at a
+// time to bound memory on wide ranges.
+func (r *BlockReader) GetLogsRange(ctx context.Context, from, to uint64) ([]*types.Log, error) {
+	if to < from {
+		return nil, nil
+	}
+	return r.GetLogsBlocks(ctx, numberRange(from, to))
+}
+
+// GetLogsBlocks returns all logs emitted in the blocks with the given
+// numbers, in the order of numbers. Blocks missing from storage are skipped.
+func (r *BlockReader) GetLogsBlocks(ctx context.Context, numbers []uint64) ([]*types.Log, error) {
+	var logs []*types.Log
+	for start := 0; start < len(numbers); start += rangeBatchSize {
+		batch := numbers[start:min(start+rangeBatchSize, len(numbers))]
+
+		blocks, err := r.getBlocks(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		receipts, err := r.getReceipts(ctx, batch, blocks)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, block := range blocks {
+			if block == nil || receipts[i] == nil {
+				continue
+			}
+			logs = append(logs, blockLogs(block, receipts[i])...)
+		}
+	}
+
+	return logs, nil
+}
+
+// numberRange returns the block numbers in [from, to]
+func numberRange(from, to uint64) []uint64 {
+	numbers := make([]uint64, 0, to-from+1)
+	for number := from; number <= to; number++ {
+		numbers = append(numbers, number)
+	}
+	return numbers
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// bloomSectionSize is the number of blocks whose blooms are ORed into a
+// section bloom, so that a log query can rule out a whole section with a
+// single read
+const bloomSectionSize = 256
+
+// Storage keys of the bloom index. The keys of a section share a hash tag so
+// that they can be combined with BITOP in cluster mode.
+func blockBloomKey(number uint64) string {
+	return fmt.Sprintf("bloom:{%d}:blk:%d", number/bloomSectionSize, number)
+}
+func sectionBloomKey(section uint64) string { return fmt.Sprintf("bloom:{%d}:sec", section) }
+
+// LogFilter is the part of a log query that can be checked against blooms:
+// any of the addresses, and at each topic position any of its topics.
+// Empty lists match anything.
+type LogFilter struct {
+	Addresses []common.Address
+	Topics    [][]common.Hash
+}
+
+// wildcard reports whether the filter matches every bloom
+func (f LogFilter) wildcard() bool {
+	if len(f.Addresses) > 0 {
+		return false
+	}
+	for _, topics := range f.Topics {
+		if len(topics) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether a bloom may contain logs matching the filter
+func (f LogFilter) matches(bloom types.Bloom) bool {
+	if len(f.Addresses) > 0 {
+		found := false
+		for _, address := range f.Addresses {
+			if bloom.Test(address.Bytes()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, topics := range f.Topics {
+		if len(topics) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range topics {
+			if bloom.Test(topic.Bytes()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// indexBloom queues the writes adding a block's bloom to the index: the
+// block bloom, overwriting that of a reorged block at the same height, and
+// the section bloom, which only accumulates bits and so stays a superset of
+// the blooms of its canonical blocks
+func indexBloom(ctx context.Context, pipe redis.Pipeliner, number uint64, bloom types.Bloom) {
+	key := blockBloomKey(number)
+	pipe.Set(ctx, key, bloom.Bytes(), 0)
+	pipe.BitOpOr(ctx, sectionBloomKey(number/bloomSectionSize), sectionBloomKey(number/bloomSectionSize), key)
+}
+
+// MatchingBlocks returns the blocks in [from, to] that may contain logs
+// matching the filter, in order. Sections whose bloom rules the filter out
+// are skipped without reading their block blooms. Blocks that were stored
+// before the index existed have no bloom and are always returned.
+func (r *BlockReader) MatchingBlocks(ctx context.Context, from, to uint64, filter LogFilter) ([]uint64, error) {
+	if to < from {
+		return nil, nil
+	}
+	if filter.wildcard() {
+		return numberRange(from, to), nil
+	}
+
+	var numbers []uint64
+	first, last := from/bloomSectionSize, to/bloomSectionSize
+	for start := first; start <= last; start += rangeBatchSize {
+		end := min(start+rangeBatchSize-1, last)
+
+		keys := make([]string, 0, end-start+1)
+		for section := start; section <= end; section++ {
+			keys = append(keys, sectionBloomKey(section))
+		}
+		values, err := r.client.MGet(ctx, keys...)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, value := range values {
+			if data, ok := mgetBytes(value); ok && !filter.matches(types.BytesToBloom(data)) {
+				continue
+			}
+			section := start + uint64(i)
+			lo := max(section*bloomSectionSize, from)
+			hi := min(section*bloomSectionSize+bloomSectionSize-1, to)
+			matching, err := r.matchingSectionBlocks(ctx, lo, hi, filter)
+			if err != nil {
+				return nil, err
+			}
+			numbers = append(numbers, matching...)
+		}
+
+		if end == last {
+			break
+		}
+	}
+	return numbers, nil
+}
+
+// matchingSectionBlocks checks the block blooms of [from, to], which lie in
+// one section
+func (r *BlockReader) matchingSectionBlocks(ctx context.Context, from, to uint64, filter LogFilter) ([]uint64, error) {
+	keys := make([]string, 0, to-from+1)
+	for number := from; number <= to; number++ {
+		keys = append(keys, blockBloomKey(number))
+	}
+	values, err := r.client.MGet(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	var numbers []uint64
+	for i, value := range values {
+		if data, ok := mgetBytes(value); ok && !filter.matches(types.BytesToBloom(data)) {
+			continue
+		}
+		numbers = append(numbers, from+uint64(i))
+	}
+	return numbers, nil
+}
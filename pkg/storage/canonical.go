@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// DefaultCanonicalDepth is the number of recent heights tracked for reorgs
+const DefaultCanonicalDepth = 128
+
+// TrackedBlock identifies a block that was announced as canonical
+type TrackedBlock struct {
+	Number uint64
+	Hash   common.Hash
+}
+
+// ChainUpdate describes how the canonical chain changed after a new head
+type ChainUpdate struct {
+	// Removed lists previously canonical blocks replaced by the new head,
+	// highest first
+	Removed []TrackedBlock
+	// Added lists the new canonical blocks, lowest first, ending with the head
+	Added []*types.Block
+}
+
+// IsReorg reports whether the update replaced previously canonical blocks
+func (u *ChainUpdate) IsReorg() bool {
+	return len(u.Removed) > 0
+}
+
+// CanonicalTracker tracks the canonical hash per height for the most recent
+// blocks, detecting when a competing block replaces one already announced
+type CanonicalTracker struct {
+	mu      sync.Mutex
+	reader  *BlockReader
+	depth   uint64
+	hashes  map[uint64]common.Hash // height -> announced canonical hash
+	head    uint64
+	hasHead bool
+}
+
+// NewCanonicalTracker creates a new canonical chain tracker
+func NewCanonicalTracker(reader *BlockReader, depth uint64) *CanonicalTracker {
+	if depth == 0 {
+		depth = DefaultCanonicalDepth
+	}
+	return &CanonicalTracker{
+		reader: reader,
+		depth:  depth,
+		hashes: make(map[uint64]common.Hash),
+	}
+}
+
+// Head returns the latest tracked head number
+func (t *CanonicalTracker) Head() (uint64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.head, t.hasHead
+}
+
+// CanonicalHash returns the tracked canonical hash at a height
+func (t *CanonicalTracker) CanonicalHash(number uint64) (common.Hash, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hash, ok := t.hashes[number]
+	return hash, ok
+}
+
+// Apply records a new head block and returns the resulting chain update.
+// Blocks on the new branch that were never announced are loaded from storage
+// by walking parent hashes back to the common ancestor.
+func (t *CanonicalTracker) Apply(ctx context.Context, block *types.Block) (*ChainUpdate, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	number := block.NumberU64()
+	if hash, ok := t.hashes[number]; ok && hash == block.Hash() {
+		// Already announced
+		return &ChainUpdate{}, nil
+	}
+
+	// Walk back along the new branch until it joins the tracked chain
+	added := []*types.Block{block}
+	cur := block
+	for cur.NumberU64() > 0 {
+		parentNumber := cur.NumberU64() - 1
+		tracked, ok := t.hashes[parentNumber]
+		if !ok || tracked == cur.ParentHash() {
+			break
+		}
+		if number-parentNumber >= t.depth {
+			return nil, fmt.Errorf("reorg deeper than %d blocks at height %d", t.depth, number)
+		}
+
+		parent, err := t.reader.GetBlockByHash(ctx, cur.ParentHash())
+		if err != nil {
+			return nil, fmt.Errorf("failed to load parent %s of block %d: %w", cur.ParentHash().Hex(), cur.NumberU64(), err)
+		}
+		added = append([]*types.Block{parent}, added...)
+		cur = parent
+	}
+	forkPoint := cur.NumberU64()
+
+	// Everything tracked from the fork point up that differs from the new
+	// branch is no longer canonical
+	update := &ChainUpdate{Added: added}
+	for n, hash := range t.hashes {
+		if n < forkPoint {
+			continue
+		}
+		if n <= number && hash == added[n-forkPoint].Hash() {
+			continue
+		}
+		update.Removed = append(update.Removed, TrackedBlock{Number: n, Hash: hash})
+		delete(t.hashes, n)
+	}
+	sort.Slice(update.Removed, func(i, j int) bool {
+		return update.Removed[i].Number > update.Removed[j].Number
+	})
+
+	for _, b := range added {
+		t.hashes[b.NumberU64()] = b.Hash()
+	}
+	t.head = number
+	t.hasHead = true
+
+	// Prune heights that fell out of the window
+	for n := range t.hashes {
+		if n+t.depth <= number {
+			delete(t.hashes, n)
+		}
+	}
+
+	return update, nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Storage keys of the canonical chain index
+func canonicalKey(number uint64) string { return fmt.Sprintf("canonical:%d", number) }
+func tdKey(number uint64) string        { return fmt.Sprintf("td:%d", number) }
+
+// GetCanonicalHash returns the hash of the canonical block at a height
+func (r *BlockReader) GetCanonicalHash(ctx context.Context, number uint64) (common.Hash, error) {
+	data, err := r.client.Get(ctx, canonicalKey(number))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.HexToHash(string(data)), nil
+}
+
+// IsCanonical reports whether the block with the given hash and number is
+// part of the canonical chain. Heights without a canonical index entry fall
+// back to the block stored by number.
+func (r *BlockReader) IsCanonical(ctx context.Context, hash common.Hash, number uint64) (bool, error) {
+	canonical, err := r.GetCanonicalHash(ctx, number)
+	if err == ErrNotFound {
+		header, err := r.GetHeader(ctx, number)
+		if err != nil {
+			return false, err
+		}
+		return header.Hash() == hash, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return canonical == hash, nil
+}
+
+// GetTotalDifficulty returns the total difficulty of the chain up to and
+// including the given block. ErrNotFound is returned if it is unknown or the
+// block is no longer canonical.
+func (r *BlockReader) GetTotalDifficulty(ctx context.Context, number uint64, hash common.Hash) (*big.Int, error) {
+	values, err := r.client.MGet(ctx, tdKey(number), canonicalKey(number))
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := mgetBytes(values[0])
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if canonical, ok := mgetBytes(values[1]); ok && common.HexToHash(string(canonical)) != hash {
+		return nil, ErrNotFound
+	}
+
+	td, ok := new(big.Int).SetString(string(data), 10)
+	if !ok {
+		return nil, fmt.Errorf("%w: total difficulty %q", ErrInvalidData, data)
+	}
+	return td, nil
+}
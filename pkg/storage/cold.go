@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/sunvim/evm_rpc/pkg/config"
+)
+
+// defaultColdCacheSize is the number of cold blocks kept in memory
+const defaultColdCacheSize = 1024
+
+// ColdBlock is the object stored per block in cold storage: the stored RLP
+// of its header, body and receipts, and its total difficulty if known
+type ColdBlock struct {
+	Header   rlp.RawValue
+	Body     rlp.RawValue
+	Receipts rlp.RawValue
+	TD       *big.Int `rlp:"optional"`
+}
+
+// ColdStore serves blocks below a configured height from object storage,
+// keeping recently used ones in memory. Hash, canonical and transaction
+// indexes stay in Pika.
+type ColdStore struct {
+	client *s3Client
+	prefix string
+	below  uint64
+	cache  *lru.Cache[uint64, *ColdBlock]
+}
+
+// NewColdStore creates a cold storage tier
+func NewColdStore(cfg config.ColdStorageConfig) (*ColdStore, error) {
+	client, err := newS3Client(cfg.Endpoint, cfg.Bucket, cfg.Region, cfg.AccessKey, cfg.SecretKey, cfg.PathStyle, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	size := cfg.CacheSize
+	if size <= 0 {
+		size = defaultColdCacheSize
+	}
+	cache, err := lru.New[uint64, *ColdBlock](size)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &ColdStore{
+		client: client,
+		prefix: prefix,
+		below:  cfg.BelowBlock,
+		cache:  cache,
+	}, nil
+}
+
+// Covers reports whether a block is served from cold storage
+func (c *ColdStore) Covers(number uint64) bool {
+	return number < c.below
+}
+
+// objectKey returns the object key of a block
+func (c *ColdStore) objectKey(number uint64) string {
+	return fmt.Sprintf("%sblocks/%d.rlp", c.prefix, number)
+}
+
+// Get returns a block from cold storage, or ErrNotFound
+func (c *ColdStore) Get(ctx context.Context, number uint64) (*ColdBlock, error) {
+	if block, ok := c.cache.Get(number); ok {
+		return block, nil
+	}
+
+	data, err := c.client.Get(ctx, c.objectKey(number))
+	if err != nil {
+		return nil, err
+	}
+
+	var block ColdBlock
+	if err := rlp.DecodeBytes(data, &block); err != nil {
+		return nil, fmt.Errorf("failed to decode cold block %d: %w", number, err)
+	}
+	c.cache.Add(number, &block)
+	return &block, nil
+}
+
+// Archive copies a block from Pika to cold storage. With drop, its header,
+// body and receipts are deleted from Pika once uploaded.
+func (c *ColdStore) Archive(ctx context.Context, pika *PikaClient, number uint64, drop bool) error {
+	values, err := pika.MGet(ctx, headerKey(number), bodyKey(number), receiptsKey(number), tdKey(number))
+	if err != nil {
+		return err
+	}
+
+	var block ColdBlock
+	var ok bool
+	if block.Header, ok = mgetBytes(values[0]); !ok {
+		return ErrNotFound
+	}
+	if block.Body, ok = mgetBytes(values[1]); !ok {
+		return ErrNotFound
+	}
+	if block.Receipts, ok = mgetBytes(values[2]); !ok {
+		return ErrNotFound
+	}
+	if td, ok := mgetBytes(values[3]); ok {
+		block.TD, _ = new(big.Int).SetString(string(td), 10)
+	}
+
+	data, err := rlp.EncodeToBytes(&block)
+	if err != nil {
+		return fmt.Errorf("failed to encode cold block %d: %w", number, err)
+	}
+	if err := c.client.Put(ctx, c.objectKey(number), data); err != nil {
+		return fmt.Errorf("failed to upload block %d: %w", number, err)
+	}
+
+	if drop {
+		return pika.Del(ctx, headerKey(number), bodyKey(number), receiptsKey(number))
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Ban kinds
+const (
+	BanKindIP  = "ip"
+	BanKindKey = "key"
+)
+
+// DenylistChannel announces changes of the denylist, so that replicas
+// reload it without waiting for their next refresh
+const DenylistChannel = "denylist:updated"
+
+// denylistKey is the hash holding every ban, keyed by kind and value
+const denylistKey = "denylist"
+
+// Ban denies a client access to the RPC listeners
+type Ban struct {
+	Kind      string `json:"kind"`
+	Value     string `json:"value"` // IP address, CIDR range or API key
+	Reason    string `json:"reason,omitempty"`
+	Automatic bool   `json:"automatic"` // added after repeated rate limit violations
+	CreatedAt int64  `json:"createdAt"`
+	ExpiresAt int64  `json:"expiresAt,omitempty"` // 0 if the ban is permanent
+}
+
+// Expired reports whether a temporary ban is over at now
+func (b *Ban) Expired(now time.Time) bool {
+	return b.ExpiresAt != 0 && now.Unix() >= b.ExpiresAt
+}
+
+// banField returns the hash field of a ban
+func banField(kind, value string) string {
+	return fmt.Sprintf("%s:%s", kind, value)
+}
+
+// DenylistStore persists bans in Pika, where all replicas share them
+type DenylistStore struct {
+	client *PikaClient
+}
+
+// NewDenylistStore creates a new denylist store
+func NewDenylistStore(client *PikaClient) *DenylistStore {
+	return &DenylistStore{client: client}
+}
+
+// Add stores a ban, replacing an existing one of the same client
+func (s *DenylistStore) Add(ctx context.Context, ban *Ban) error {
+	data, err := json.Marshal(ban)
+	if err != nil {
+		return fmt.Errorf("failed to encode ban: %w", err)
+	}
+	if err := s.client.HSet(ctx, denylistKey, banField(ban.Kind, ban.Value), data); err != nil {
+		return err
+	}
+	return s.client.Publish(ctx, DenylistChannel, banField(ban.Kind, ban.Value))
+}
+
+// Remove deletes a ban and reports whether it existed
+func (s *DenylistStore) Remove(ctx context.Context, kind, value string) (bool, error) {
+	removed, err := s.client.HDel(ctx, denylistKey, banField(kind, value))
+	if err != nil || removed == 0 {
+		return false, err
+	}
+	return true, s.client.Publish(ctx, DenylistChannel, banField(kind, value))
+}
+
+// List returns the bans in force. Expired ones are deleted on the way.
+func (s *DenylistStore) List(ctx context.Context) ([]*Ban, error) {
+	fields, err := s.client.HGetAll(ctx, denylistKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	bans := make([]*Ban, 0, len(fields))
+	var expired []string
+	for field, data := range fields {
+		var ban Ban
+		if err := json.Unmarshal([]byte(data), &ban); err != nil {
+			return nil, fmt.Errorf("failed to decode ban %s: %w", field, err)
+		}
+		if ban.Expired(now) {
+			expired = append(expired, field)
+			continue
+		}
+		bans = append(bans, &ban)
+	}
+
+	if len(expired) > 0 {
+		if _, err := s.client.HDel(ctx, denylistKey, expired...); err != nil {
+			return nil, err
+		}
+	}
+	return bans, nil
+}
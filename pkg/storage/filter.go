@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultFilterTimeout is how long an installed filter lives without polls
+const DefaultFilterTimeout = 5 * time.Minute
+
+// Filter types
+const (
+	FilterTypeLogs   = "logs"
+	FilterTypeBlocks = "blocks"
+)
+
+// StoredFilter is an installed filter persisted in Pika so that filter IDs
+// survive restarts and are shared by all replicas
+type StoredFilter struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Criteria   json.RawMessage `json:"criteria,omitempty"`
+	Cursor     uint64          `json:"cursor"` // last block delivered to the client
+	CreatedAt  int64           `json:"createdAt"`
+	LastPolled int64           `json:"lastPolled"`
+}
+
+// FilterStore persists installed filters.
+// Filters are garbage collected through key TTLs refreshed on every poll.
+type FilterStore struct {
+	client  *PikaClient
+	timeout time.Duration
+}
+
+// NewFilterStore creates a new filter store
+func NewFilterStore(client *PikaClient, timeout time.Duration) *FilterStore {
+	if timeout <= 0 {
+		timeout = DefaultFilterTimeout
+	}
+	return &FilterStore{client: client, timeout: timeout}
+}
+
+// filterKey returns the storage key of a filter
+func filterKey(id string) string {
+	return fmt.Sprintf("filter:%s", id)
+}
+
+// Install stores a new filter and returns its ID
+func (s *FilterStore) Install(ctx context.Context, filterType string, criteria json.RawMessage, cursor uint64) (*StoredFilter, error) {
+	now := time.Now().Unix()
+	filter := &StoredFilter{
+		Type:       filterType,
+		Criteria:   criteria,
+		Cursor:     cursor,
+		CreatedAt:  now,
+		LastPolled: now,
+	}
+
+	for i := 0; i < 8; i++ {
+		id, err := newFilterID()
+		if err != nil {
+			return nil, err
+		}
+		filter.ID = id
+
+		data, err := json.Marshal(filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode filter: %w", err)
+		}
+
+		// SetNX doubles as the collision check across replicas
+		ok, err := s.client.SetNX(ctx, filterKey(id), data, s.timeout)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return filter, nil
+		}
+	}
+
+	return nil, fmt.Errorf("failed to allocate a unique filter ID")
+}
+
+// Get returns an installed filter
+func (s *FilterStore) Get(ctx context.Context, id string) (*StoredFilter, error) {
+	data, err := s.client.Get(ctx, filterKey(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var filter StoredFilter
+	if err := json.Unmarshal(data, &filter); err != nil {
+		return nil, fmt.Errorf("failed to decode filter: %w", err)
+	}
+
+	return &filter, nil
+}
+
+// UpdateCursor records a poll and extends the filter lifetime
+func (s *FilterStore) UpdateCursor(ctx context.Context, filter *StoredFilter, cursor uint64) error {
+	filter.Cursor = cursor
+	filter.LastPolled = time.Now().Unix()
+
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return fmt.Errorf("failed to encode filter: %w", err)
+	}
+
+	return s.client.Set(ctx, filterKey(filter.ID), data, s.timeout)
+}
+
+// Touch extends the filter lifetime without moving its cursor
+func (s *FilterStore) Touch(ctx context.Context, id string) error {
+	return s.client.Expire(ctx, filterKey(id), s.timeout)
+}
+
+// Uninstall removes a filter, reporting whether it existed
+func (s *FilterStore) Uninstall(ctx context.Context, id string) (bool, error) {
+	n, err := s.client.Exists(ctx, filterKey(id))
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+	return true, s.client.Del(ctx, filterKey(id))
+}
+
+// newFilterID generates a random filter ID in the same format as geth
+func newFilterID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate filter ID: %w", err)
+	}
+
+	id := strings.TrimLeft(hex.EncodeToString(b), "0")
+	if id == "" {
+		id = "0"
+	}
+	return "0x" + id, nil
+}
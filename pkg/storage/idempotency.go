@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrIdempotencyKeyReused is returned when an idempotency key already
+// submitted another transaction
+var ErrIdempotencyKeyReused = errors.New("idempotency key already used for another transaction")
+
+// idempotencyKey is the Pika key remembering the submission of key by a
+// client. Clients choose their keys, so each has its own; the client is
+// hashed so that API keys are not stored.
+func idempotencyKey(client, key string) string {
+	return fmt.Sprintf("pool:idem:%x:%s", sha256.Sum256([]byte(client)), key)
+}
+
+// ClaimIdempotencyKey records that key submits the transaction hash for a
+// client, for the idempotency TTL. It returns false if the client's key
+// submitted the same transaction before, which need not be validated
+// again, and ErrIdempotencyKeyReused if it submitted another one.
+func (t *TxPoolStorage) ClaimIdempotencyKey(ctx context.Context, client, key string, hash common.Hash) (bool, error) {
+	claimed, err := t.client.SetNX(ctx, idempotencyKey(client, key), hash.Bytes(), t.idemTTL)
+	if err != nil || claimed {
+		return claimed, err
+	}
+
+	// Read from the primary, which the claim was made on
+	data, err := t.client.Primary().Get(ctx, idempotencyKey(client, key))
+	if err == ErrNotFound {
+		// Released or expired since; the retry claims it anew
+		return t.client.SetNX(ctx, idempotencyKey(client, key), hash.Bytes(), t.idemTTL)
+	}
+	if err != nil {
+		return false, err
+	}
+	if common.BytesToHash(data) != hash {
+		return false, ErrIdempotencyKeyReused
+	}
+	return false, nil
+}
+
+// ReleaseIdempotencyKey forgets the claim of a client's key after its
+// submission failed, so that a retry is validated again
+func (t *TxPoolStorage) ReleaseIdempotencyKey(ctx context.Context, client, key string) error {
+	return t.client.Del(ctx, idempotencyKey(client, key))
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// latencyBuckets is the number of histogram buckets; bucket i counts
+	// operations up to latencyMinBucket << i, the last one all slower ones
+	latencyBuckets = 20
+
+	// latencyMinBucket is the upper bound of the first bucket
+	latencyMinBucket = 50 * time.Microsecond
+
+	// latencySlots is the number of seconds of history, which bounds the
+	// window quantiles can be computed over
+	latencySlots = 60
+)
+
+// opLatency holds the latency of every Pika operation of the process, for
+// load shedding
+var opLatency latencyWindow
+
+// latencyWindow is a histogram of durations per second over the last
+// latencySlots seconds
+type latencyWindow struct {
+	mu    sync.Mutex
+	slots [latencySlots]latencySlot
+}
+
+// latencySlot counts the durations observed in one second
+type latencySlot struct {
+	second int64
+	counts [latencyBuckets]uint64
+}
+
+// observe records a duration
+func (w *latencyWindow) observe(d time.Duration) {
+	bucket := 0
+	for bound := latencyMinBucket; bucket < latencyBuckets-1 && d > bound; bound *= 2 {
+		bucket++
+	}
+
+	now := time.Now().Unix()
+	w.mu.Lock()
+	slot := &w.slots[now%latencySlots]
+	if slot.second != now {
+		*slot = latencySlot{second: now}
+	}
+	slot.counts[bucket]++
+	w.mu.Unlock()
+}
+
+// quantile returns the q-quantile of the durations observed within window,
+// rounded up to a bucket bound, and the number of observations
+func (w *latencyWindow) quantile(q float64, window time.Duration) (time.Duration, uint64) {
+	since := time.Now().Add(-window).Unix()
+
+	var counts [latencyBuckets]uint64
+	var total uint64
+	w.mu.Lock()
+	for i := range w.slots {
+		if w.slots[i].second <= since {
+			continue
+		}
+		for bucket, n := range w.slots[i].counts {
+			counts[bucket] += n
+			total += n
+		}
+	}
+	w.mu.Unlock()
+
+	if total == 0 {
+		return 0, 0
+	}
+	rank := uint64(q*float64(total-1)) + 1
+	var seen uint64
+	bound := latencyMinBucket
+	for bucket := 0; bucket < latencyBuckets-1; bucket++ {
+		seen += counts[bucket]
+		if seen >= rank {
+			return bound, total
+		}
+		bound *= 2
+	}
+	return bound, total
+}
+
+// Latency returns the q-quantile of the latency of Pika operations within
+// window, at most a minute, and how many operations it is based on. Each
+// attempt of a retried operation counts on its own.
+func Latency(q float64, window time.Duration) (time.Duration, uint64) {
+	return opLatency.quantile(q, window)
+}
+
+// latencyHook records the duration of every Pika round trip. It is added
+// last, so that it times single attempts rather than retries and breaker
+// rejections.
+type latencyHook struct{}
+
+// DialHook implements redis.Hook
+func (latencyHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+// ProcessHook implements redis.Hook
+func (latencyHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		opLatency.observe(time.Since(start))
+		return err
+	}
+}
+
+// ProcessPipelineHook implements redis.Hook
+func (latencyHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		opLatency.observe(time.Since(start))
+		return err
+	}
+}
@@ -0,0 +1,911 @@
+package memory
+
+import (
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Value types of the keyspace
+const (
+	typeString = "string"
+	typeHash   = "hash"
+	typeSet    = "set"
+	typeZSet   = "zset"
+)
+
+var (
+	errWrongType = errorReply("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errSyntax    = errorReply("ERR syntax error")
+	errNotInt    = errorReply("ERR value is not an integer or out of range")
+	errNotFloat  = errorReply("ERR min or max is not a float")
+)
+
+// entry is a value of the keyspace. Expired entries are dropped when they
+// are next accessed.
+type entry struct {
+	kind    string
+	str     []byte
+	hash    map[string][]byte
+	set     map[string]struct{}
+	zset    map[string]float64
+	expires time.Time
+}
+
+// zmember is a member of a sorted set with its score
+type zmember struct {
+	member string
+	score  float64
+}
+
+// handler executes a command; args excludes the command name. It runs with
+// the server lock held.
+type handler struct {
+	arity int // minimum number of arguments
+	fn    func(s *Server, c *conn, args [][]byte) []byte
+}
+
+// handlers are the supported commands by name. HELLO is left out, so that
+// clients fall back to RESP2.
+var handlers = map[string]handler{
+	"PING":          {0, cmdPing},
+	"AUTH":          {1, cmdOK},
+	"SELECT":        {1, cmdOK},
+	"CLIENT":        {1, cmdOK},
+	"READONLY":      {0, cmdOK},
+	"GET":           {1, cmdGet},
+	"SET":           {2, cmdSet},
+	"SETNX":         {2, cmdSetNX},
+	"EXPIRE":        {2, cmdExpire},
+	"PEXPIRE":       {2, cmdPExpire},
+	"MGET":          {1, cmdMGet},
+	"DEL":           {1, cmdDel},
+	"EXISTS":        {1, cmdExists},
+	"HGET":          {2, cmdHGet},
+	"HSET":          {3, cmdHSet},
+	"HGETALL":       {1, cmdHGetAll},
+	"HDEL":          {2, cmdHDel},
+	"SADD":          {2, cmdSAdd},
+	"SMEMBERS":      {1, cmdSMembers},
+	"SCARD":         {1, cmdSCard},
+	"ZADD":          {3, cmdZAdd},
+	"ZRANGE":        {3, cmdZRange},
+	"ZREVRANGE":     {3, cmdZRevRange},
+	"ZRANGEBYSCORE": {3, cmdZRangeByScore},
+	"ZCARD":         {1, cmdZCard},
+	"ZREM":          {2, cmdZRem},
+	"SCAN":          {1, cmdScan},
+	"BITOP":         {3, cmdBitOp},
+	"WATCH":         {1, cmdWatch},
+	"UNWATCH":       {0, cmdUnwatch},
+	"MULTI":         {0, cmdMulti},
+	"EXEC":          {0, cmdExec},
+	"DISCARD":       {0, cmdDiscard},
+	"PUBLISH":       {2, cmdPublish},
+	"SUBSCRIBE":     {1, cmdSubscribe},
+	"UNSUBSCRIBE":   {0, cmdUnsubscribe},
+}
+
+// queuedCommand is a command queued by MULTI
+type queuedCommand struct {
+	name    string
+	handler handler
+	args    [][]byte
+}
+
+// writeKeys returns the keys a write command modifies, by command name.
+// Watches on those keys are invalidated when the command runs.
+var writeKeys = map[string]func(args [][]byte) [][]byte{
+	"SET":     firstKey,
+	"SETNX":   firstKey,
+	"EXPIRE":  firstKey,
+	"PEXPIRE": firstKey,
+	"DEL":     allKeys,
+	"HSET":    firstKey,
+	"HDEL":    firstKey,
+	"SADD":    firstKey,
+	"ZADD":    firstKey,
+	"ZREM":    firstKey,
+	"BITOP":   func(args [][]byte) [][]byte { return args[1:2] },
+}
+
+func firstKey(args [][]byte) [][]byte { return args[:1] }
+
+func allKeys(args [][]byte) [][]byte { return args }
+
+// exec executes a command for a connection and returns its reply
+func (s *Server) exec(c *conn, args [][]byte) []byte {
+	name := strings.ToUpper(string(args[0]))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := handlers[name]
+	var reply []byte
+	switch {
+	case !ok:
+		reply = errorReply("ERR unknown command '" + string(args[0]) + "'")
+	case len(args)-1 < h.arity:
+		reply = errorReply("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+	}
+	if c.multi != nil && name != "EXEC" && name != "DISCARD" && name != "MULTI" && name != "WATCH" {
+		// Inside MULTI commands are queued; one that cannot be queued
+		// aborts the transaction at EXEC
+		if reply != nil {
+			c.multiFailed = true
+			return reply
+		}
+		c.multi = append(c.multi, queuedCommand{name, h, args[1:]})
+		return simpleReply("QUEUED")
+	}
+	if reply != nil {
+		return reply
+	}
+
+	// Subscribed connections may only manage subscriptions and ping
+	if len(c.channels) > 0 && name != "SUBSCRIBE" && name != "UNSUBSCRIBE" && name != "PING" {
+		return errorReply("ERR only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT are allowed in this context")
+	}
+	return s.run(c, name, h, args[1:])
+}
+
+// run executes a validated command, invalidating the watches on the keys
+// it writes
+func (s *Server) run(c *conn, name string, h handler, args [][]byte) []byte {
+	if keys, ok := writeKeys[name]; ok {
+		for _, key := range keys(args) {
+			for watcher := range s.watches[string(key)] {
+				watcher.watchBroken = true
+			}
+		}
+	}
+	return h.fn(s, c, args)
+}
+
+// lookup returns a live entry, dropping it if it expired
+func (s *Server) lookup(key string) *entry {
+	e, ok := s.keys[key]
+	if !ok {
+		return nil
+	}
+	if !e.expires.IsZero() && !time.Now().Before(e.expires) {
+		delete(s.keys, key)
+		return nil
+	}
+	return e
+}
+
+// lookupKind returns a live entry of a type; wrong reports another type
+func (s *Server) lookupKind(key, kind string) (e *entry, wrong bool) {
+	e = s.lookup(key)
+	if e != nil && e.kind != kind {
+		return nil, true
+	}
+	return e, false
+}
+
+// create returns the entry of a type under key, creating it if missing
+func (s *Server) create(key, kind string) (e *entry, wrong bool) {
+	e, wrong = s.lookupKind(key, kind)
+	if e != nil || wrong {
+		return e, wrong
+	}
+	e = &entry{kind: kind}
+	switch kind {
+	case typeHash:
+		e.hash = make(map[string][]byte)
+	case typeSet:
+		e.set = make(map[string]struct{})
+	case typeZSet:
+		e.zset = make(map[string]float64)
+	}
+	s.keys[key] = e
+	return e, false
+}
+
+func cmdOK(*Server, *conn, [][]byte) []byte {
+	return simpleReply("OK")
+}
+
+func cmdPing(s *Server, c *conn, args [][]byte) []byte {
+	var payload []byte
+	if len(args) > 0 {
+		payload = args[0]
+	}
+	if len(c.channels) > 0 {
+		// Subscribed connections reply with a pub/sub event
+		buf := []byte("*2\r\n")
+		buf = appendBulk(buf, []byte("pong"))
+		return appendBulk(buf, payload)
+	}
+	if payload != nil {
+		return bulkReply(payload)
+	}
+	return simpleReply("PONG")
+}
+
+// Strings
+
+func cmdGet(s *Server, c *conn, args [][]byte) []byte {
+	e, wrong := s.lookupKind(string(args[0]), typeString)
+	switch {
+	case wrong:
+		return errWrongType
+	case e == nil:
+		return nullReply()
+	}
+	return bulkReply(e.str)
+}
+
+// cmdSet implements SET with the EX, PX, NX and XX options
+func cmdSet(s *Server, c *conn, args [][]byte) []byte {
+	key := string(args[0])
+	var (
+		ttl    time.Duration
+		nx, xx bool
+	)
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || n <= 0 {
+				return errorReply("ERR invalid expire time in 'set' command")
+			}
+			ttl = time.Duration(n) * time.Millisecond
+			if strings.EqualFold(string(args[i]), "EX") {
+				ttl = time.Duration(n) * time.Second
+			}
+			i++
+		default:
+			return errSyntax
+		}
+	}
+
+	exists := s.lookup(key) != nil
+	if (nx && exists) || (xx && !exists) {
+		return nullReply()
+	}
+	s.setString(key, args[1], ttl)
+	return simpleReply("OK")
+}
+
+func cmdSetNX(s *Server, c *conn, args [][]byte) []byte {
+	key := string(args[0])
+	if s.lookup(key) != nil {
+		return intReply(0)
+	}
+	s.setString(key, args[1], 0)
+	return intReply(1)
+}
+
+// setString stores a string value, replacing any value under key
+func (s *Server) setString(key string, value []byte, ttl time.Duration) {
+	e := &entry{kind: typeString, str: append([]byte(nil), value...)}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	s.keys[key] = e
+}
+
+func cmdExpire(s *Server, c *conn, args [][]byte) []byte {
+	return s.expire(args, time.Second)
+}
+
+func cmdPExpire(s *Server, c *conn, args [][]byte) []byte {
+	return s.expire(args, time.Millisecond)
+}
+
+// expire sets the timeout of a key in units; a non-positive timeout
+// deletes the key
+func (s *Server) expire(args [][]byte, unit time.Duration) []byte {
+	key := string(args[0])
+	n, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return errNotInt
+	}
+	e := s.lookup(key)
+	if e == nil {
+		return intReply(0)
+	}
+	if n <= 0 {
+		delete(s.keys, key)
+		return intReply(1)
+	}
+	e.expires = time.Now().Add(time.Duration(n) * unit)
+	return intReply(1)
+}
+
+func cmdMGet(s *Server, c *conn, args [][]byte) []byte {
+	values := make([][]byte, len(args))
+	for i, key := range args {
+		if e, _ := s.lookupKind(string(key), typeString); e != nil {
+			values[i] = e.str
+		}
+	}
+	return arrayReply(values)
+}
+
+func cmdDel(s *Server, c *conn, args [][]byte) []byte {
+	var n int64
+	for _, key := range args {
+		if s.lookup(string(key)) != nil {
+			delete(s.keys, string(key))
+			n++
+		}
+	}
+	return intReply(n)
+}
+
+func cmdExists(s *Server, c *conn, args [][]byte) []byte {
+	var n int64
+	for _, key := range args {
+		if s.lookup(string(key)) != nil {
+			n++
+		}
+	}
+	return intReply(n)
+}
+
+// cmdBitOp implements BITOP OR, the only operation the bloom index uses
+func cmdBitOp(s *Server, c *conn, args [][]byte) []byte {
+	if !strings.EqualFold(string(args[0]), "OR") {
+		return errorReply("ERR only BITOP OR is supported")
+	}
+	var result []byte
+	for _, key := range args[2:] {
+		e, wrong := s.lookupKind(string(key), typeString)
+		if wrong {
+			return errWrongType
+		}
+		if e == nil {
+			continue
+		}
+		if len(e.str) > len(result) {
+			result = append(result, make([]byte, len(e.str)-len(result))...)
+		}
+		for i, b := range e.str {
+			result[i] |= b
+		}
+	}
+
+	dest := string(args[1])
+	if len(result) == 0 {
+		delete(s.keys, dest)
+		return intReply(0)
+	}
+	s.setString(dest, result, 0)
+	return intReply(int64(len(result)))
+}
+
+// Hashes
+
+func cmdHGet(s *Server, c *conn, args [][]byte) []byte {
+	e, wrong := s.lookupKind(string(args[0]), typeHash)
+	if wrong {
+		return errWrongType
+	}
+	if e == nil {
+		return nullReply()
+	}
+	value, ok := e.hash[string(args[1])]
+	if !ok {
+		return nullReply()
+	}
+	return bulkReply(value)
+}
+
+func cmdHSet(s *Server, c *conn, args [][]byte) []byte {
+	if len(args)%2 != 1 {
+		return errorReply("ERR wrong number of arguments for 'hset' command")
+	}
+	e, wrong := s.create(string(args[0]), typeHash)
+	if wrong {
+		return errWrongType
+	}
+	var added int64
+	for i := 1; i < len(args); i += 2 {
+		field := string(args[i])
+		if _, ok := e.hash[field]; !ok {
+			added++
+		}
+		e.hash[field] = append([]byte(nil), args[i+1]...)
+	}
+	return intReply(added)
+}
+
+func cmdHGetAll(s *Server, c *conn, args [][]byte) []byte {
+	e, wrong := s.lookupKind(string(args[0]), typeHash)
+	if wrong {
+		return errWrongType
+	}
+	var items [][]byte
+	if e != nil {
+		for _, field := range sortedKeys(e.hash) {
+			items = append(items, []byte(field), e.hash[field])
+		}
+	}
+	return arrayReply(items)
+}
+
+func cmdHDel(s *Server, c *conn, args [][]byte) []byte {
+	key := string(args[0])
+	e, wrong := s.lookupKind(key, typeHash)
+	if wrong {
+		return errWrongType
+	}
+	if e == nil {
+		return intReply(0)
+	}
+	var n int64
+	for _, field := range args[1:] {
+		if _, ok := e.hash[string(field)]; ok {
+			delete(e.hash, string(field))
+			n++
+		}
+	}
+	if len(e.hash) == 0 {
+		delete(s.keys, key)
+	}
+	return intReply(n)
+}
+
+// Sets
+
+func cmdSAdd(s *Server, c *conn, args [][]byte) []byte {
+	e, wrong := s.create(string(args[0]), typeSet)
+	if wrong {
+		return errWrongType
+	}
+	var added int64
+	for _, member := range args[1:] {
+		if _, ok := e.set[string(member)]; !ok {
+			e.set[string(member)] = struct{}{}
+			added++
+		}
+	}
+	return intReply(added)
+}
+
+func cmdSMembers(s *Server, c *conn, args [][]byte) []byte {
+	e, wrong := s.lookupKind(string(args[0]), typeSet)
+	if wrong {
+		return errWrongType
+	}
+	var items [][]byte
+	if e != nil {
+		for _, member := range sortedKeys(e.set) {
+			items = append(items, []byte(member))
+		}
+	}
+	return arrayReply(items)
+}
+
+func cmdSCard(s *Server, c *conn, args [][]byte) []byte {
+	e, wrong := s.lookupKind(string(args[0]), typeSet)
+	if wrong {
+		return errWrongType
+	}
+	if e == nil {
+		return intReply(0)
+	}
+	return intReply(int64(len(e.set)))
+}
+
+// Sorted sets
+
+func cmdZAdd(s *Server, c *conn, args [][]byte) []byte {
+	if len(args)%2 != 1 {
+		return errSyntax
+	}
+	scores := make([]float64, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(string(args[i]), 64)
+		if err != nil || math.IsNaN(score) {
+			return errorReply("ERR value is not a valid float")
+		}
+		scores = append(scores, score)
+	}
+
+	e, wrong := s.create(string(args[0]), typeZSet)
+	if wrong {
+		return errWrongType
+	}
+	var added int64
+	for i, score := range scores {
+		member := string(args[2+2*i])
+		if _, ok := e.zset[member]; !ok {
+			added++
+		}
+		e.zset[member] = score
+	}
+	return intReply(added)
+}
+
+func cmdZRange(s *Server, c *conn, args [][]byte) []byte {
+	return s.zrange(args, false)
+}
+
+func cmdZRevRange(s *Server, c *conn, args [][]byte) []byte {
+	return s.zrange(args, true)
+}
+
+// zrange returns sorted set members by index, in descending order if
+// reverse is set, with their scores if WITHSCORES is given
+func (s *Server) zrange(args [][]byte, reverse bool) []byte {
+	start, err1 := strconv.ParseInt(string(args[1]), 10, 64)
+	stop, err2 := strconv.ParseInt(string(args[2]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return errNotInt
+	}
+	withScores := false
+	for _, arg := range args[3:] {
+		if !strings.EqualFold(string(arg), "WITHSCORES") {
+			return errSyntax
+		}
+		withScores = true
+	}
+
+	e, wrong := s.lookupKind(string(args[0]), typeZSet)
+	if wrong {
+		return errWrongType
+	}
+	members := sortedMembers(e)
+	if reverse {
+		for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+			members[i], members[j] = members[j], members[i]
+		}
+	}
+
+	n := int64(len(members))
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+	if start > stop {
+		return arrayReply(nil)
+	}
+	return membersReply(members[start:stop+1], withScores)
+}
+
+// cmdZRangeByScore implements ZRANGEBYSCORE with exclusive bounds, infinite
+// bounds, LIMIT and WITHSCORES
+func cmdZRangeByScore(s *Server, c *conn, args [][]byte) []byte {
+	min, minExcl, ok1 := parseScoreBound(string(args[1]))
+	max, maxExcl, ok2 := parseScoreBound(string(args[2]))
+	if !ok1 || !ok2 {
+		return errNotFloat
+	}
+
+	withScores := false
+	offset, count := int64(0), int64(-1)
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return errSyntax
+			}
+			var err1, err2 error
+			offset, err1 = strconv.ParseInt(string(args[i+1]), 10, 64)
+			count, err2 = strconv.ParseInt(string(args[i+2]), 10, 64)
+			if err1 != nil || err2 != nil {
+				return errNotInt
+			}
+			i += 2
+		default:
+			return errSyntax
+		}
+	}
+
+	e, wrong := s.lookupKind(string(args[0]), typeZSet)
+	if wrong {
+		return errWrongType
+	}
+	var matched []zmember
+	for _, m := range sortedMembers(e) {
+		if m.score < min || (minExcl && m.score == min) || m.score > max || (maxExcl && m.score == max) {
+			continue
+		}
+		matched = append(matched, m)
+	}
+	if offset < 0 || offset >= int64(len(matched)) {
+		return arrayReply(nil)
+	}
+	matched = matched[offset:]
+	if count >= 0 && count < int64(len(matched)) {
+		matched = matched[:count]
+	}
+	return membersReply(matched, withScores)
+}
+
+func cmdZCard(s *Server, c *conn, args [][]byte) []byte {
+	e, wrong := s.lookupKind(string(args[0]), typeZSet)
+	if wrong {
+		return errWrongType
+	}
+	if e == nil {
+		return intReply(0)
+	}
+	return intReply(int64(len(e.zset)))
+}
+
+func cmdZRem(s *Server, c *conn, args [][]byte) []byte {
+	key := string(args[0])
+	e, wrong := s.lookupKind(key, typeZSet)
+	if wrong {
+		return errWrongType
+	}
+	if e == nil {
+		return intReply(0)
+	}
+	var n int64
+	for _, member := range args[1:] {
+		if _, ok := e.zset[string(member)]; ok {
+			delete(e.zset, string(member))
+			n++
+		}
+	}
+	if len(e.zset) == 0 {
+		delete(s.keys, key)
+	}
+	return intReply(n)
+}
+
+// parseScoreBound parses a ZRANGEBYSCORE bound: a float, -inf, +inf, or a
+// float prefixed with ( for an exclusive bound
+func parseScoreBound(s string) (score float64, exclusive, ok bool) {
+	if strings.HasPrefix(s, "(") {
+		exclusive = true
+		s = s[1:]
+	}
+	score, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false, false
+	}
+	return score, exclusive, true
+}
+
+// sortedMembers returns the members of a sorted set by score, ties broken
+// by member as Redis does
+func sortedMembers(e *entry) []zmember {
+	if e == nil {
+		return nil
+	}
+	members := make([]zmember, 0, len(e.zset))
+	for member, score := range e.zset {
+		members = append(members, zmember{member, score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].score != members[j].score {
+			return members[i].score < members[j].score
+		}
+		return members[i].member < members[j].member
+	})
+	return members
+}
+
+// membersReply encodes sorted set members, interleaved with their scores
+// if withScores is set
+func membersReply(members []zmember, withScores bool) []byte {
+	items := make([][]byte, 0, len(members)*2)
+	for _, m := range members {
+		items = append(items, []byte(m.member))
+		if withScores {
+			items = append(items, []byte(strconv.FormatFloat(m.score, 'g', 17, 64)))
+		}
+	}
+	return arrayReply(items)
+}
+
+// Keyspace
+
+// cmdScan implements SCAN over the sorted keyspace, the cursor being the
+// offset of the next key. Patterns are matched with path.Match, which
+// agrees with Redis globs for keys without slashes.
+func cmdScan(s *Server, c *conn, args [][]byte) []byte {
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return errorReply("ERR invalid cursor")
+	}
+	match, count := "*", uint64(10)
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return errSyntax
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			match = string(args[i+1])
+		case "COUNT":
+			if count, err = strconv.ParseUint(string(args[i+1]), 10, 64); err != nil || count == 0 {
+				return errSyntax
+			}
+		default:
+			return errSyntax
+		}
+	}
+
+	var live []string
+	for key := range s.keys {
+		if s.lookup(key) != nil {
+			live = append(live, key)
+		}
+	}
+	sort.Strings(live)
+
+	var keys [][]byte
+	next := uint64(0)
+	for i := cursor; i < uint64(len(live)); i++ {
+		if i-cursor >= count {
+			next = i
+			break
+		}
+		if ok, _ := path.Match(match, live[i]); ok {
+			keys = append(keys, []byte(live[i]))
+		}
+	}
+
+	buf := []byte("*2\r\n")
+	buf = appendBulk(buf, []byte(strconv.FormatUint(next, 10)))
+	return append(buf, arrayReply(keys)...)
+}
+
+// Transactions
+
+func cmdWatch(s *Server, c *conn, args [][]byte) []byte {
+	if c.multi != nil {
+		return errorReply("ERR WATCH inside MULTI is not allowed")
+	}
+	for _, arg := range args {
+		key := string(arg)
+		watchers, ok := s.watches[key]
+		if !ok {
+			watchers = make(map[*conn]struct{})
+			s.watches[key] = watchers
+		}
+		watchers[c] = struct{}{}
+		c.watched[key] = struct{}{}
+	}
+	return simpleReply("OK")
+}
+
+func cmdUnwatch(s *Server, c *conn, args [][]byte) []byte {
+	s.unwatch(c)
+	return simpleReply("OK")
+}
+
+func cmdMulti(s *Server, c *conn, args [][]byte) []byte {
+	if c.multi != nil {
+		return errorReply("ERR MULTI calls can not be nested")
+	}
+	c.multi = []queuedCommand{}
+	return simpleReply("OK")
+}
+
+// cmdExec runs the queued commands as one step, unless a watched key was
+// written since WATCH, in which case it replies a null array
+func cmdExec(s *Server, c *conn, args [][]byte) []byte {
+	if c.multi == nil {
+		return errorReply("ERR EXEC without MULTI")
+	}
+	queued, failed, broken := c.multi, c.multiFailed, c.watchBroken
+	c.multi, c.multiFailed = nil, false
+	s.unwatch(c)
+	switch {
+	case failed:
+		return errorReply("EXECABORT Transaction discarded because of previous errors.")
+	case broken:
+		return []byte("*-1\r\n")
+	}
+
+	buf := []byte("*" + strconv.Itoa(len(queued)) + "\r\n")
+	for _, cmd := range queued {
+		buf = append(buf, s.run(c, cmd.name, cmd.handler, cmd.args)...)
+	}
+	return buf
+}
+
+func cmdDiscard(s *Server, c *conn, args [][]byte) []byte {
+	if c.multi == nil {
+		return errorReply("ERR DISCARD without MULTI")
+	}
+	c.multi, c.multiFailed = nil, false
+	s.unwatch(c)
+	return simpleReply("OK")
+}
+
+// unwatch removes all the watches of a connection
+func (s *Server) unwatch(c *conn) {
+	for key := range c.watched {
+		if watchers, ok := s.watches[key]; ok {
+			delete(watchers, c)
+			if len(watchers) == 0 {
+				delete(s.watches, key)
+			}
+		}
+		delete(c.watched, key)
+	}
+	c.watchBroken = false
+}
+
+// Pub/sub
+
+func cmdPublish(s *Server, c *conn, args [][]byte) []byte {
+	channel := string(args[0])
+	message := pushReply("message", channel, 0, append([]byte(nil), args[1]...))
+	for sub := range s.subs[channel] {
+		sub.send(message)
+	}
+	return intReply(int64(len(s.subs[channel])))
+}
+
+func cmdSubscribe(s *Server, c *conn, args [][]byte) []byte {
+	var buf []byte
+	for _, arg := range args {
+		channel := string(arg)
+		subs, ok := s.subs[channel]
+		if !ok {
+			subs = make(map[*conn]struct{})
+			s.subs[channel] = subs
+		}
+		subs[c] = struct{}{}
+		c.channels[channel] = struct{}{}
+		buf = append(buf, pushReply("subscribe", channel, len(c.channels), nil)...)
+	}
+	return buf
+}
+
+// cmdUnsubscribe unsubscribes from the given channels, or from all of them
+func cmdUnsubscribe(s *Server, c *conn, args [][]byte) []byte {
+	channels := make([]string, 0, len(args))
+	for _, arg := range args {
+		channels = append(channels, string(arg))
+	}
+	if len(channels) == 0 {
+		channels = sortedKeys(c.channels)
+	}
+	if len(channels) == 0 {
+		return pushReply("unsubscribe", "", 0, nil)
+	}
+
+	var buf []byte
+	for _, channel := range channels {
+		s.unsubscribe(c, channel)
+		buf = append(buf, pushReply("unsubscribe", channel, len(c.channels), nil)...)
+	}
+	return buf
+}
+
+// unsubscribe removes a connection's subscription to a channel
+func (s *Server) unsubscribe(c *conn, channel string) {
+	delete(c.channels, channel)
+	if subs, ok := s.subs[channel]; ok {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(s.subs, channel)
+		}
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
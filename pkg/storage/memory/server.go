@@ -0,0 +1,286 @@
+// Package memory is an in-memory stand-in for Pika. It speaks the subset of
+// the Redis protocol the storage package uses, so that readers and writers
+// run unchanged on top of it. Data lives as long as the process; it is meant
+// for demos, dev chains and integration tests, not production.
+package memory
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxBulkLen bounds the size of a single argument, as Redis does
+const maxBulkLen = 512 << 20
+
+// Server is an in-memory keyspace served over in-process connections
+type Server struct {
+	mu      sync.Mutex
+	keys    map[string]*entry
+	subs    map[string]map[*conn]struct{} // subscribers by channel
+	watches map[string]map[*conn]struct{} // watchers by key
+	conns   map[*conn]struct{}
+	closed  bool
+}
+
+// NewServer creates an empty server
+func NewServer() *Server {
+	return &Server{
+		keys:    make(map[string]*entry),
+		subs:    make(map[string]map[*conn]struct{}),
+		watches: make(map[string]map[*conn]struct{}),
+		conns:   make(map[*conn]struct{}),
+	}
+}
+
+// Dial opens a connection to the server. Its signature matches the Dialer
+// of go-redis options, which is how clients reach the server.
+func (s *Server) Dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, errors.New("memory: server closed")
+	}
+
+	client, server := net.Pipe()
+	c := &conn{
+		server:   s,
+		nc:       server,
+		channels: make(map[string]struct{}),
+		watched:  make(map[string]struct{}),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	s.conns[c] = struct{}{}
+
+	go c.readLoop()
+	go c.writeLoop()
+	return client, nil
+}
+
+// Close closes every connection and refuses new ones. The data is kept.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.close()
+	}
+	return nil
+}
+
+// conn is the server side of a client connection. Commands are executed as
+// they are read and their replies queued for a separate writer, so that a
+// client pipelining many commands before reading is never blocked.
+type conn struct {
+	server *Server
+	nc     net.Conn
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  [][]byte
+	closed bool
+
+	// The state below is guarded by server.mu
+	channels    map[string]struct{} // subscribed channels
+	watched     map[string]struct{} // keys of WATCH
+	watchBroken bool                // a watched key was written
+	multi       []queuedCommand     // commands queued since MULTI, nil outside
+	multiFailed bool                // a command could not be queued
+}
+
+// readLoop reads and executes commands until the connection is closed
+func (c *conn) readLoop() {
+	defer c.close()
+
+	r := bufio.NewReader(c.nc)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, io.ErrClosedPipe) {
+				c.send(errorReply("ERR Protocol error: " + err.Error()))
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if strings.EqualFold(string(args[0]), "quit") {
+			c.send(simpleReply("OK"))
+			return
+		}
+		c.send(c.server.exec(c, args))
+	}
+}
+
+// writeLoop writes queued replies until the connection is closed
+func (c *conn) writeLoop() {
+	for {
+		c.mu.Lock()
+		for len(c.queue) == 0 && !c.closed {
+			c.cond.Wait()
+		}
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+		queue := c.queue
+		c.queue = nil
+		c.mu.Unlock()
+
+		for _, reply := range queue {
+			if _, err := c.nc.Write(reply); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+// send queues a reply
+func (c *conn) send(reply []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.queue = append(c.queue, reply)
+	c.cond.Signal()
+}
+
+// close drops the connection and its subscriptions
+func (c *conn) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	c.queue = nil
+	c.cond.Signal()
+	c.mu.Unlock()
+
+	c.nc.Close()
+
+	s := c.server
+	s.mu.Lock()
+	for channel := range c.channels {
+		s.unsubscribe(c, channel)
+	}
+	s.unwatch(c)
+	delete(s.conns, c)
+	s.mu.Unlock()
+}
+
+// readCommand reads a command sent as an array of bulk strings, the only
+// form Redis clients send
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return nil, fmt.Errorf("expected '*', got '%c'", line[0])
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 {
+		return nil, errors.New("invalid multibulk length")
+	}
+
+	args := make([][]byte, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errors.New("expected '$'")
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, errors.New("invalid bulk length")
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = buf[:size]
+	}
+	return args, nil
+}
+
+// readLine reads a line without its CRLF terminator
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// Reply encoding
+
+func simpleReply(s string) []byte {
+	return []byte("+" + s + "\r\n")
+}
+
+func errorReply(s string) []byte {
+	return []byte("-" + s + "\r\n")
+}
+
+func intReply(n int64) []byte {
+	return []byte(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func nullReply() []byte {
+	return []byte("$-1\r\n")
+}
+
+func bulkReply(b []byte) []byte {
+	return appendBulk(nil, b)
+}
+
+// arrayReply encodes an array of bulk strings; nil elements are nulls
+func arrayReply(items [][]byte) []byte {
+	buf := []byte("*" + strconv.Itoa(len(items)) + "\r\n")
+	for _, item := range items {
+		if item == nil {
+			buf = append(buf, nullReply()...)
+			continue
+		}
+		buf = appendBulk(buf, item)
+	}
+	return buf
+}
+
+func appendBulk(buf, b []byte) []byte {
+	buf = append(buf, '$')
+	buf = strconv.AppendInt(buf, int64(len(b)), 10)
+	buf = append(buf, '\r', '\n')
+	buf = append(buf, b...)
+	return append(buf, '\r', '\n')
+}
+
+// pushReply encodes a pub/sub event: kind, channel and a count or payload
+func pushReply(kind, channel string, count int, payload []byte) []byte {
+	buf := []byte("*3\r\n")
+	buf = appendBulk(buf, []byte(kind))
+	buf = appendBulk(buf, []byte(channel))
+	if payload != nil {
+		return appendBulk(buf, payload)
+	}
+	return append(buf, intReply(int64(count))...)
+}
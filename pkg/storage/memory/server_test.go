@@ -0,0 +1,202 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestClient(t *testing.T) *redis.Client {
+	t.Helper()
+	s := NewServer()
+	client := redis.NewClient(&redis.Options{
+		Dialer:           s.Dial,
+		Protocol:         2,
+		MaxRetries:       -1,
+		DisableIndentity: true,
+	})
+	t.Cleanup(func() {
+		client.Close()
+		s.Close()
+	})
+	return client
+}
+
+func TestStrings(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	if err := client.Get(ctx, "missing").Err(); err != redis.Nil {
+		t.Fatalf("GET missing: err = %v, want redis.Nil", err)
+	}
+	if err := client.Set(ctx, "a", "1", 0).Err(); err != nil {
+		t.Fatalf("SET: %v", err)
+	}
+	if ok, err := client.SetNX(ctx, "a", "2", 0).Result(); err != nil || ok {
+		t.Fatalf("SETNX existing = %v, %v; want false", ok, err)
+	}
+	if ok, err := client.SetNX(ctx, "b", "2", 0).Result(); err != nil || !ok {
+		t.Fatalf("SETNX new = %v, %v; want true", ok, err)
+	}
+	values, err := client.MGet(ctx, "a", "missing", "b").Result()
+	if err != nil {
+		t.Fatalf("MGET: %v", err)
+	}
+	if values[0] != "1" || values[1] != nil || values[2] != "2" {
+		t.Fatalf("MGET = %v", values)
+	}
+	if n, err := client.Del(ctx, "a", "missing").Result(); err != nil || n != 1 {
+		t.Fatalf("DEL = %d, %v; want 1", n, err)
+	}
+	if n, err := client.Exists(ctx, "a", "b").Result(); err != nil || n != 1 {
+		t.Fatalf("EXISTS = %d, %v; want 1", n, err)
+	}
+
+	if err := client.Set(ctx, "ttl", "x", time.Millisecond).Err(); err != nil {
+		t.Fatalf("SET PX: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := client.Get(ctx, "ttl").Err(); err != redis.Nil {
+		t.Fatalf("GET expired: err = %v, want redis.Nil", err)
+	}
+
+	if err := client.HSet(ctx, "b", "f", "v").Err(); err == nil {
+		t.Fatal("HSET on a string succeeded")
+	}
+}
+
+func TestSortedSets(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	err := client.ZAdd(ctx, "z",
+		redis.Z{Score: 3, Member: "c"},
+		redis.Z{Score: 1, Member: "a"},
+		redis.Z{Score: 2, Member: "b"},
+	).Err()
+	if err != nil {
+		t.Fatalf("ZADD: %v", err)
+	}
+	if members, _ := client.ZRange(ctx, "z", 0, -1).Result(); !equal(members, "a", "b", "c") {
+		t.Fatalf("ZRANGE = %v", members)
+	}
+	if members, _ := client.ZRevRange(ctx, "z", 0, 0).Result(); !equal(members, "c") {
+		t.Fatalf("ZREVRANGE = %v", members)
+	}
+	members, err := client.ZRangeByScore(ctx, "z", &redis.ZRangeBy{Min: "(1", Max: "+inf"}).Result()
+	if err != nil || !equal(members, "b", "c") {
+		t.Fatalf("ZRANGEBYSCORE = %v, %v", members, err)
+	}
+	if n, _ := client.ZRem(ctx, "z", "b", "missing").Result(); n != 1 {
+		t.Fatalf("ZREM = %d, want 1", n)
+	}
+	if n, _ := client.ZCard(ctx, "z").Result(); n != 2 {
+		t.Fatalf("ZCARD = %d, want 2", n)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	increment := func(tx *redis.Tx) error {
+		n, err := tx.Get(ctx, "counter").Int()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, "counter", n+1, 0)
+			return nil
+		})
+		return err
+	}
+	if err := client.Watch(ctx, increment, "counter"); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if n, _ := client.Get(ctx, "counter").Int(); n != 1 {
+		t.Fatalf("counter = %d, want 1", n)
+	}
+
+	// A write by another connection between WATCH and EXEC aborts
+	err := client.Watch(ctx, func(tx *redis.Tx) error {
+		if err := client.Set(ctx, "counter", 10, 0).Err(); err != nil {
+			return err
+		}
+		return increment(tx)
+	}, "counter")
+	if !errors.Is(err, redis.TxFailedErr) {
+		t.Fatalf("Watch after a concurrent write: err = %v, want TxFailedErr", err)
+	}
+	if n, _ := client.Get(ctx, "counter").Int(); n != 10 {
+		t.Fatalf("counter = %d, want 10", n)
+	}
+
+	// Writes to other keys do not
+	err = client.Watch(ctx, func(tx *redis.Tx) error {
+		if err := client.Set(ctx, "other", 1, 0).Err(); err != nil {
+			return err
+		}
+		return increment(tx)
+	}, "counter")
+	if err != nil {
+		t.Fatalf("Watch after an unrelated write: %v", err)
+	}
+	if n, _ := client.Get(ctx, "counter").Int(); n != 11 {
+		t.Fatalf("counter = %d, want 11", n)
+	}
+}
+
+func TestMultiAbortsOnQueueError(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, "a", "1", 0)
+		pipe.Do(ctx, "NOSUCHCOMMAND")
+		return nil
+	})
+	if err == nil {
+		t.Fatal("transaction with an unknown command succeeded")
+	}
+	if err := client.Get(ctx, "a").Err(); err != redis.Nil {
+		t.Fatalf("GET after aborted transaction: err = %v, want redis.Nil", err)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	sub := client.Subscribe(ctx, "events")
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatalf("Receive subscription: %v", err)
+	}
+	if n, err := client.Publish(ctx, "events", "hello").Result(); err != nil || n != 1 {
+		t.Fatalf("PUBLISH = %d, %v; want 1", n, err)
+	}
+
+	select {
+	case msg := <-sub.Channel():
+		if msg.Channel != "events" || msg.Payload != "hello" {
+			t.Fatalf("message = %s %q", msg.Channel, msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+}
+
+func equal(got []string, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
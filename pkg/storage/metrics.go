@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	poolConnectionsDesc = prometheus.NewDesc(
+		"pika_pool_connections",
+		"Number of pooled Pika connections",
+		[]string{"node", "role", "state"}, nil, // role: primary, replica; state: total, idle, stale
+	)
+	poolHitsDesc = prometheus.NewDesc(
+		"pika_pool_hits_total",
+		"Total number of times a free connection was found in the pool",
+		[]string{"node", "role"}, nil,
+	)
+	poolMissesDesc = prometheus.NewDesc(
+		"pika_pool_misses_total",
+		"Total number of times a free connection was not found in the pool",
+		[]string{"node", "role"}, nil,
+	)
+	poolTimeoutsDesc = prometheus.NewDesc(
+		"pika_pool_timeouts_total",
+		"Total number of times waiting for a pooled connection timed out",
+		[]string{"node", "role"}, nil,
+	)
+)
+
+// poolCollector exports connection pool statistics per Pika node, read from
+// the client at scrape time
+type poolCollector struct {
+	client *PikaClient
+}
+
+// NewPoolCollector creates a collector of the connection pools of a client
+func NewPoolCollector(client *PikaClient) prometheus.Collector {
+	return &poolCollector{client: client}
+}
+
+// Describe implements prometheus.Collector
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolConnectionsDesc
+	ch <- poolHitsDesc
+	ch <- poolMissesDesc
+	ch <- poolTimeoutsDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.client.forEachNode(func(node, role string, stats *redis.PoolStats) {
+		ch <- prometheus.MustNewConstMetric(poolConnectionsDesc, prometheus.GaugeValue, float64(stats.TotalConns), node, role, "total")
+		ch <- prometheus.MustNewConstMetric(poolConnectionsDesc, prometheus.GaugeValue, float64(stats.IdleConns), node, role, "idle")
+		ch <- prometheus.MustNewConstMetric(poolConnectionsDesc, prometheus.GaugeValue, float64(stats.StaleConns), node, role, "stale")
+		ch <- prometheus.MustNewConstMetric(poolHitsDesc, prometheus.CounterValue, float64(stats.Hits), node, role)
+		ch <- prometheus.MustNewConstMetric(poolMissesDesc, prometheus.CounterValue, float64(stats.Misses), node, role)
+		ch <- prometheus.MustNewConstMetric(poolTimeoutsDesc, prometheus.CounterValue, float64(stats.Timeouts), node, role)
+	})
+}
+
+// forEachNode calls fn with the pool statistics of every node the client
+// is connected to
+func (p *PikaClient) forEachNode(fn func(node, role string, stats *redis.PoolStats)) {
+	if cluster, ok := p.client.(*redis.ClusterClient); ok {
+		for _, shard := range clusterShards(cluster) {
+			fn(shard.Options().Addr, "primary", shard.PoolStats())
+		}
+	} else {
+		fn(p.node, "primary", p.client.PoolStats())
+	}
+
+	if p.readOnly != nil {
+		for _, shard := range clusterShards(p.readOnly) {
+			fn(shard.Options().Addr, "replica", shard.PoolStats())
+		}
+	}
+	if p.replicas != nil {
+		for _, r := range p.replicas.replicas {
+			fn(r.addr, "replica", r.client.PoolStats())
+		}
+	}
+}
+
+// clusterShards returns the node clients of a cluster client
+func clusterShards(cluster *redis.ClusterClient) []*redis.Client {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Shards are visited concurrently
+	var mu sync.Mutex
+	var nodes []*redis.Client
+	cluster.ForEachShard(ctx, func(ctx context.Context, shard *redis.Client) error {
+		mu.Lock()
+		nodes = append(nodes, shard)
+		mu.Unlock()
+		return nil
+	})
+	return nodes
+}
@@ -2,46 +2,290 @@ package storage
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/storage/memory"
 )
 
-// PikaClient wraps Redis client for Pika storage
+// PikaClient wraps Redis client for Pika storage. Depending on the
+// configured mode it talks to a single node, a cluster, or a master
+// discovered through sentinels.
 type PikaClient struct {
-	client *redis.Client
+	client  redis.UniversalClient
+	cluster bool
+	node    string // label for metrics of the primary
+
+	// Reads are served by healthy replicas when configured
+	replicas *replicaSet
+	readOnly *redis.ClusterClient // cluster client routing reads to shard replicas
+
+	availability *Availability
 }
 
-// NewPikaClient creates a new Pika client
+// NewPikaClient creates a new Pika client and checks that Pika can be
+// reached
 func NewPikaClient(cfg config.PikaConfig) (*PikaClient, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:         cfg.Addr,
+	p, err := newPikaClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := p.client.Ping(ctx).Err(); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to connect to Pika: %w", err)
+	}
+	return p, nil
+}
+
+// ConnectPika creates a Pika client, retrying the connection check with
+// exponential backoff as configured in cfg.Startup, so that the service
+// can start before Pika during a rollout. A zero backoff checks once. When the attempts are exhausted
+// it fails, unless cfg.Startup.StartUnready is set: the client is returned
+// anyway and reconnects on its own once Pika is up, while readiness probes
+// report the service as not ready until then.
+func ConnectPika(ctx context.Context, cfg config.PikaConfig) (*PikaClient, error) {
+	p, err := newPikaClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	backoff := cfg.Startup.Backoff
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err = p.client.Ping(pingCtx).Err()
+		cancel()
+		if err == nil {
+			return p, nil
+		}
+		if ctx.Err() != nil {
+			p.Close()
+			return nil, ctx.Err()
+		}
+		if backoff <= 0 || (cfg.Startup.MaxAttempts > 0 && attempt >= cfg.Startup.MaxAttempts) {
+			break
+		}
+
+		logger.Warnf("Pika not reachable yet, retrying in %v: attempt=%d, error=%v", backoff, attempt, err)
+		select {
+		case <-ctx.Done():
+			p.Close()
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if cfg.Startup.MaxBackoff > 0 {
+			backoff = min(backoff, cfg.Startup.MaxBackoff)
+		}
+	}
+
+	if cfg.Startup.StartUnready {
+		logger.Warnf("Pika still unreachable, starting not ready: error=%v", err)
+		return p, nil
+	}
+	p.Close()
+	return nil, fmt.Errorf("failed to connect to Pika: %w", err)
+}
+
+// newPikaClient creates a Pika client without connecting
+func newPikaClient(cfg config.PikaConfig) (*PikaClient, error) {
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PikaClient{availability: &Availability{}}
+	switch cfg.Mode {
+	case "", config.PikaModeStandalone:
+		p.node = cfg.Addr
+		p.client = redis.NewClient(nodeOptions(cfg, cfg.Addr, tlsConfig))
+
+	case config.PikaModeCluster:
+		if len(cfg.Addrs) == 0 {
+			return nil, fmt.Errorf("pika cluster mode requires addrs")
+		}
+		p.cluster = true
+		p.node = strings.Join(cfg.Addrs, ",")
+		p.client = redis.NewClusterClient(clusterOptions(cfg, tlsConfig))
+		if cfg.Replicas.Enabled {
+			opts := clusterOptions(cfg, tlsConfig)
+			opts.ReadOnly = true
+			opts.RouteByLatency = cfg.Replicas.Balance == config.BalanceLatency
+			opts.RouteRandomly = !opts.RouteByLatency
+			p.readOnly = redis.NewClusterClient(opts)
+			p.readOnly.AddHook(tracingHook{node: p.node})
+			p.readOnly.AddHook(newResilienceHook(cfg, p.node, false))
+			p.readOnly.AddHook(latencyHook{})
+		}
+
+	case config.PikaModeSentinel:
+		if cfg.MasterName == "" || len(cfg.Addrs) == 0 {
+			return nil, fmt.Errorf("pika sentinel mode requires master_name and addrs")
+		}
+		p.node = cfg.MasterName
+		p.client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:            cfg.MasterName,
+			SentinelAddrs:         cfg.Addrs,
+			SentinelPassword:      cfg.SentinelPassword,
+			Password:              cfg.Password,
+			DB:                    cfg.DB,
+			PoolSize:              cfg.MaxConnections,
+			DialTimeout:           cfg.DialTimeout,
+			ReadTimeout:           cfg.ReadTimeout,
+			WriteTimeout:          cfg.WriteTimeout,
+			TLSConfig:             tlsConfig,
+			MaxRetries:            -1, // reads are retried by the resilience hook
+			ContextTimeoutEnabled: true,
+		})
+
+	case config.PikaModeMemory:
+		// Every client gets its own keyspace, served in process
+		p.node = config.PikaModeMemory
+		p.client = redis.NewClient(&redis.Options{
+			Dialer:           memory.NewServer().Dial,
+			Protocol:         2,
+			PoolSize:         cfg.MaxConnections,
+			MaxRetries:       -1,
+			DisableIndentity: true,
+		})
+
+	default:
+		return nil, fmt.Errorf("unknown pika mode: %s", cfg.Mode)
+	}
+
+	// Hooks added first run outermost, so spans cover all retries and
+	// latency is measured per attempt
+	p.client.AddHook(tracingHook{node: p.node})
+	resilience := newResilienceHook(cfg, p.node, true)
+	resilience.availability = p.availability
+	p.client.AddHook(resilience)
+	p.client.AddHook(latencyHook{})
+
+	if cfg.Replicas.Enabled && !p.cluster && len(cfg.Replicas.Addrs) > 0 {
+		p.replicas = newReplicaSet(cfg.Replicas, func(addr string) *redis.Client {
+			// Replica health is tracked by probes rather than the breaker
+			client := redis.NewClient(nodeOptions(cfg, addr, tlsConfig))
+			client.AddHook(tracingHook{node: addr})
+			client.AddHook(newResilienceHook(cfg, addr, false))
+			client.AddHook(latencyHook{})
+			return client
+		})
+	}
+
+	return p, nil
+}
+
+// nodeOptions returns the options of a connection to a single node
+func nodeOptions(cfg config.PikaConfig, addr string, tlsConfig *tls.Config) *redis.Options {
+	return &redis.Options{
+		Addr:         addr,
 		Password:     cfg.Password,
 		DB:           cfg.DB,
 		PoolSize:     cfg.MaxConnections,
 		DialTimeout:  cfg.DialTimeout,
 		ReadTimeout:  cfg.ReadTimeout,
 		WriteTimeout: cfg.WriteTimeout,
-	})
+		TLSConfig:    tlsConfig,
+		MaxRetries:   -1, // reads are retried by the resilience hook
 
-	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+		ContextTimeoutEnabled: true,
+	}
+}
 
-	if err := client.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Pika: %w", err)
+// clusterOptions returns the options of a cluster connection
+func clusterOptions(cfg config.PikaConfig, tlsConfig *tls.Config) *redis.ClusterOptions {
+	return &redis.ClusterOptions{
+		Addrs:        cfg.Addrs,
+		Password:     cfg.Password,
+		PoolSize:     cfg.MaxConnections,
+		DialTimeout:  cfg.DialTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		TLSConfig:    tlsConfig,
+		MaxRetries:   -1, // reads are retried by the resilience hook
+
+		ContextTimeoutEnabled: true,
+	}
+}
+
+// reader returns the client serving reads: a healthy replica if any,
+// otherwise the primary
+func (p *PikaClient) reader() redis.UniversalClient {
+	if p.replicas != nil {
+		if client := p.replicas.pick(); client != nil {
+			return client
+		}
+	}
+	if p.readOnly != nil {
+		return p.readOnly
+	}
+	return p.client
+}
+
+// Primary returns a view of the client that also reads from the primary,
+// for callers that must read their own writes. It shares the connections
+// of p and must not be closed.
+func (p *PikaClient) Primary() *PikaClient {
+	return &PikaClient{client: p.client, cluster: p.cluster, node: p.node, availability: p.availability}
+}
+
+// Availability returns the availability state of Pika, which stays
+// available unless an AvailabilityMonitor runs
+func (p *PikaClient) Availability() *Availability {
+	return p.availability
+}
+
+// newTLSConfig builds the TLS configuration of Pika connections, nil if
+// TLS is disabled
+func newTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
 	}
 
-	return &PikaClient{
-		client: client,
-	}, nil
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if cfg.CAFile != "" {
+		ca, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pika CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in pika CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load pika client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
 }
 
 // Get retrieves a value by key
 func (p *PikaClient) Get(ctx context.Context, key string) ([]byte, error) {
-	result, err := p.client.Get(ctx, key).Bytes()
+	result, err := p.reader().Get(ctx, key).Bytes()
 	if err == redis.Nil {
 		return nil, ErrNotFound
 	}
@@ -53,14 +297,48 @@ func (p *PikaClient) Set(ctx context.Context, key string, value []byte, ttl time
 	return p.client.Set(ctx, key, value, ttl).Err()
 }
 
-// MGet retrieves multiple values by keys
+// SetNX stores a value only if the key does not exist yet
+func (p *PikaClient) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return p.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+// Expire sets a timeout on a key
+func (p *PikaClient) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return p.client.Expire(ctx, key, ttl).Err()
+}
+
+// MGet retrieves multiple values by keys. Missing keys yield nil entries.
+// In cluster mode keys may live in different slots, so they are fetched
+// with a pipeline that is split per node.
 func (p *PikaClient) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
-	return p.client.MGet(ctx, keys...).Result()
+	if !p.cluster {
+		return p.reader().MGet(ctx, keys...).Result()
+	}
+
+	pipe := p.reader().Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	pipe.Exec(ctx) // errors are checked per command
+
+	values := make([]interface{}, len(keys))
+	for i, cmd := range cmds {
+		val, err := cmd.Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[i] = val
+	}
+	return values, nil
 }
 
 // HGet retrieves a field value from hash
 func (p *PikaClient) HGet(ctx context.Context, key, field string) ([]byte, error) {
-	result, err := p.client.HGet(ctx, key, field).Bytes()
+	result, err := p.reader().HGet(ctx, key, field).Bytes()
 	if err == redis.Nil {
 		return nil, ErrNotFound
 	}
@@ -74,7 +352,12 @@ func (p *PikaClient) HSet(ctx context.Context, key string, values ...interface{}
 
 // HGetAll retrieves all fields from hash
 func (p *PikaClient) HGetAll(ctx context.Context, key string) (map[string]string, error) {
-	return p.client.HGetAll(ctx, key).Result()
+	return p.reader().HGetAll(ctx, key).Result()
+}
+
+// HDel removes fields from hash and returns how many existed
+func (p *PikaClient) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	return p.client.HDel(ctx, key, fields...).Result()
 }
 
 // ZAdd adds member to sorted set
@@ -84,17 +367,30 @@ func (p *PikaClient) ZAdd(ctx context.Context, key string, members ...redis.Z) e
 
 // ZRange retrieves members from sorted set by range
 func (p *PikaClient) ZRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
-	return p.client.ZRange(ctx, key, start, stop).Result()
+	return p.reader().ZRange(ctx, key, start, stop).Result()
 }
 
 // ZRevRange retrieves members from sorted set in reverse order
 func (p *PikaClient) ZRevRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
-	return p.client.ZRevRange(ctx, key, start, stop).Result()
+	return p.reader().ZRevRange(ctx, key, start, stop).Result()
+}
+
+// ZRangeWithScores retrieves members with their scores from sorted set by range
+func (p *PikaClient) ZRangeWithScores(ctx context.Context, key string, start, stop int64) ([]redis.Z, error) {
+	return p.reader().ZRangeWithScores(ctx, key, start, stop).Result()
+}
+
+// ZRangeByScore retrieves members from sorted set with scores in [min, max]
+func (p *PikaClient) ZRangeByScore(ctx context.Context, key string, min, max float64) ([]string, error) {
+	return p.reader().ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: strconv.FormatFloat(min, 'f', -1, 64),
+		Max: strconv.FormatFloat(max, 'f', -1, 64),
+	}).Result()
 }
 
 // ZCard returns the cardinality of sorted set
 func (p *PikaClient) ZCard(ctx context.Context, key string) (int64, error) {
-	return p.client.ZCard(ctx, key).Result()
+	return p.reader().ZCard(ctx, key).Result()
 }
 
 // ZRem removes members from sorted set
@@ -109,22 +405,88 @@ func (p *PikaClient) SAdd(ctx context.Context, key string, members ...interface{
 
 // SMembers retrieves all members from set
 func (p *PikaClient) SMembers(ctx context.Context, key string) ([]string, error) {
-	return p.client.SMembers(ctx, key).Result()
+	return p.reader().SMembers(ctx, key).Result()
 }
 
 // SCard returns the cardinality of set
 func (p *PikaClient) SCard(ctx context.Context, key string) (int64, error) {
-	return p.client.SCard(ctx, key).Result()
+	return p.reader().SCard(ctx, key).Result()
 }
 
 // Del deletes keys
 func (p *PikaClient) Del(ctx context.Context, keys ...string) error {
-	return p.client.Del(ctx, keys...).Err()
+	if !p.cluster || len(keys) <= 1 {
+		return p.client.Del(ctx, keys...).Err()
+	}
+
+	// Keys may live in different slots
+	pipe := p.client.Pipeline()
+	for _, key := range keys {
+		pipe.Del(ctx, key)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
 // Exists checks if keys exist
 func (p *PikaClient) Exists(ctx context.Context, keys ...string) (int64, error) {
-	return p.client.Exists(ctx, keys...).Result()
+	if !p.cluster || len(keys) <= 1 {
+		return p.reader().Exists(ctx, keys...).Result()
+	}
+
+	// Keys may live in different slots
+	pipe := p.reader().Pipeline()
+	cmds := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Exists(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for _, cmd := range cmds {
+		n += cmd.Val()
+	}
+	return n, nil
+}
+
+// Scan calls fn with batches of primary keys matching a pattern. In cluster
+// mode every master is scanned; fn is never called concurrently.
+func (p *PikaClient) Scan(ctx context.Context, match string, count int64, fn func(keys []string) error) error {
+	cluster, ok := p.client.(*redis.ClusterClient)
+	if !ok {
+		return scanNode(ctx, p.client, match, count, fn)
+	}
+
+	var mu sync.Mutex
+	return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		return scanNode(ctx, node, match, count, func(keys []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return fn(keys)
+		})
+	})
+}
+
+// scanNode iterates the keys of a single node matching a pattern
+func scanNode(ctx context.Context, client redis.Cmdable, match string, count int64, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, match, count).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
 }
 
 // Subscribe subscribes to channels
@@ -137,17 +499,36 @@ func (p *PikaClient) Publish(ctx context.Context, channel string, message interf
 	return p.client.Publish(ctx, channel, message).Err()
 }
 
+// Ping checks that the primary can be reached
+func (p *PikaClient) Ping(ctx context.Context) error {
+	return p.client.Ping(ctx).Err()
+}
+
 // Pipeline creates a pipeline
 func (p *PikaClient) Pipeline() redis.Pipeliner {
 	return p.client.Pipeline()
 }
 
-// Close closes the client connection
+// Close closes the client connections
 func (p *PikaClient) Close() error {
+	if p.replicas != nil {
+		p.replicas.Close()
+	}
+	if p.readOnly != nil {
+		p.readOnly.Close()
+	}
 	return p.client.Close()
 }
 
-// GetClient returns the underlying Redis client
-func (p *PikaClient) GetClient() *redis.Client {
+// GetClient returns the underlying Redis client of the primary
+func (p *PikaClient) GetClient() redis.UniversalClient {
 	return p.client
 }
+
+// Watch runs fn in an optimistic transaction on the primary. Commands fn
+// queues with tx.TxPipelined are applied only if none of keys changed
+// since they were watched; otherwise redis.TxFailedErr is returned. In
+// cluster mode the transaction is confined to the slot of keys.
+func (p *PikaClient) Watch(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error {
+	return p.client.Watch(ctx, fn, keys...)
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+)
+
+// pinnedHeightKey is the context key of a pinned block height
+type pinnedHeightKey struct{}
+
+// WithPinnedHeight returns ctx pinning the latest block of the reads made
+// with it to a height, so that a client replaying history sees the chain as
+// it was at that block
+func WithPinnedHeight(ctx context.Context, height uint64) context.Context {
+	return context.WithValue(ctx, pinnedHeightKey{}, height)
+}
+
+// PinnedHeight returns the height ctx pins the latest block to, if any
+func PinnedHeight(ctx context.Context) (uint64, bool) {
+	height, ok := ctx.Value(pinnedHeightKey{}).(uint64)
+	return height, ok
+}
+
+// stateBlock returns the block number string state is read at: latest and
+// pending stand for the pinned height, if any
+func stateBlock(ctx context.Context, blockNumber string) string {
+	if blockNumber != "latest" && blockNumber != "pending" {
+		return blockNumber
+	}
+	if height, ok := PinnedHeight(ctx); ok {
+		return strconv.FormatUint(height, 10)
+	}
+	return blockNumber
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// prunedStateKey holds the highest block whose historical state was pruned
+const prunedStateKey = "st:pruned"
+
+// stateIndexKey is the set of historical state keys written for a block
+func stateIndexKey(number uint64) string { return fmt.Sprintf("st:keys:%d", number) }
+
+// GetPrunedBlock returns the highest block whose historical state has been
+// pruned, or ErrNotFound if state was never pruned
+func (r *StateReader) GetPrunedBlock(ctx context.Context) (uint64, error) {
+	data, err := r.client.Get(ctx, prunedStateKey)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(data), 10, 64)
+}
+
+// SetPrunedBlock records that historical state up to and including a block
+// is being pruned, so readers reject it before its keys are gone
+func (w *StateWriter) SetPrunedBlock(ctx context.Context, number uint64) error {
+	return w.client.Set(ctx, prunedStateKey, []byte(strconv.FormatUint(number, 10)), 0)
+}
+
+// HistoricalStateKeys returns the indexed state keys written at a block,
+// including the index itself. Blocks written without an index return only
+// the index key; their state is found by SweepHistoricalState.
+func (w *StateWriter) HistoricalStateKeys(ctx context.Context, number uint64) ([]string, error) {
+	keys, err := w.client.SMembers(ctx, stateIndexKey(number))
+	if err != nil {
+		return nil, err
+	}
+	return append(keys, stateIndexKey(number)), nil
+}
+
+// SweepHistoricalState scans the whole keyspace for historical state and
+// index keys of blocks up to and including through, calling fn with
+// batches of them. It finds state not covered by an index.
+func (w *StateWriter) SweepHistoricalState(ctx context.Context, through uint64, count int64, fn func(keys []string) error) error {
+	return w.client.Scan(ctx, "st:*", count, func(keys []string) error {
+		var batch []string
+		for _, key := range keys {
+			if number, ok := historicalStateBlock(key); ok && number <= through {
+				batch = append(batch, key)
+			}
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		return fn(batch)
+	})
+}
+
+// DeleteStateKeys deletes historical state keys
+func (w *StateWriter) DeleteStateKeys(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return w.client.Del(ctx, keys...)
+}
+
+// historicalStateBlock returns the block of an st:{n}:... or st:keys:{n}
+// key. Latest state, code and the pruning marker are not historical.
+func historicalStateBlock(key string) (uint64, bool) {
+	parts := strings.SplitN(key, ":", 4)
+	if len(parts) < 3 || parts[0] != "st" {
+		return 0, false
+	}
+	field := parts[1]
+	if field == "keys" {
+		field = parts[2]
+	}
+	number, err := strconv.ParseUint(field, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return number, true
+}
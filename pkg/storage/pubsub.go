@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+)
+
+const (
+	// pubsubInitialBackoff is the first delay before resubscribing
+	pubsubInitialBackoff = 500 * time.Millisecond
+
+	// pubsubMaxBackoff caps the delay between resubscription attempts
+	pubsubMaxBackoff = 30 * time.Second
+
+	// pubsubHealthCheckInterval is how long a subscription may stay silent
+	// before it is pinged; a missed pong marks the connection as dead
+	pubsubHealthCheckInterval = 30 * time.Second
+)
+
+// Listen subscribes to a channel and passes every message to handle until
+// ctx is cancelled. When the connection drops it resubscribes with
+// exponential backoff; onResubscribe runs after each successful
+// resubscription, before new messages are read, so missed events can be
+// recovered.
+func (p *PikaClient) Listen(ctx context.Context, channel string, onResubscribe func(), handle func(payload string)) {
+	backoff := pubsubInitialBackoff
+	subscribed := false
+
+	for ctx.Err() == nil {
+		pubsub := p.Subscribe(ctx, channel)
+
+		// Wait for the confirmation so a broken connection is detected here
+		if _, err := pubsub.Receive(ctx); err != nil {
+			pubsub.Close()
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Errorf("Failed to subscribe to %s: %v, retrying in %v", channel, err, backoff)
+			if !sleepContext(ctx, backoff) {
+				return
+			}
+			backoff = min(backoff*2, pubsubMaxBackoff)
+			continue
+		}
+
+		if subscribed {
+			logger.Infof("Resubscribed to %s", channel)
+			metrics.RecordPubSubReconnect(channel)
+			if onResubscribe != nil {
+				onResubscribe()
+			}
+		}
+		subscribed = true
+		backoff = pubsubInitialBackoff
+
+		err := receiveMessages(ctx, pubsub, handle)
+		pubsub.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Errorf("Lost subscription to %s: %v", channel, err)
+	}
+}
+
+// receiveMessages reads messages until the subscription fails
+func receiveMessages(ctx context.Context, pubsub *redis.PubSub, handle func(payload string)) error {
+	pingPending := false
+
+	for {
+		msg, err := pubsub.ReceiveTimeout(ctx, pubsubHealthCheckInterval)
+		if err != nil {
+			if !isTimeout(err) {
+				return err
+			}
+			if pingPending {
+				return fmt.Errorf("no pong within %v", pubsubHealthCheckInterval)
+			}
+			if err := pubsub.Ping(ctx); err != nil {
+				return err
+			}
+			pingPending = true
+			continue
+		}
+		pingPending = false
+
+		if m, ok := msg.(*redis.Message); ok {
+			handle(m.Payload)
+		}
+	}
+}
+
+// sleepContext waits for d, returning false if ctx is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// isTimeout reports whether err is a network read timeout
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sunvim/evm_rpc/pkg/txsender"
+)
+
+// deriveReceipts fills in the fields of receipts that their consensus
+// encoding leaves out, as types.Receipts.DeriveFields does: the block and
+// transaction context of receipts and logs, the gas used by each
+// transaction, the price it paid and the addresses of created contracts.
+// Receipts must be freshly decoded, as they are modified in place.
+func deriveReceipts(receipts types.Receipts, block *types.Block) {
+	txs := block.Transactions()
+	number := block.Number()
+	hash := block.Hash()
+
+	var logIndex uint
+	for i, receipt := range receipts {
+		receipt.BlockHash = hash
+		receipt.BlockNumber = new(big.Int).Set(number)
+		receipt.TransactionIndex = uint(i)
+
+		receipt.GasUsed = receipt.CumulativeGasUsed
+		if i > 0 {
+			receipt.GasUsed -= receipts[i-1].CumulativeGasUsed
+		}
+
+		if i < len(txs) {
+			tx := txs[i]
+			receipt.Type = tx.Type()
+			receipt.TxHash = tx.Hash()
+			if receipt.EffectiveGasPrice == nil {
+				receipt.EffectiveGasPrice = EffectiveGasPrice(tx, block.BaseFee())
+			}
+			if tx.To() == nil {
+				if from, err := txsender.Recover(tx); err == nil {
+					receipt.ContractAddress = crypto.CreateAddress(from, tx.Nonce())
+				}
+			}
+		}
+
+		for _, log := range receipt.Logs {
+			log.BlockNumber = block.NumberU64()
+			log.BlockHash = hash
+			log.TxHash = receipt.TxHash
+			log.TxIndex = uint(i)
+			log.Index = logIndex
+			logIndex++
+		}
+	}
+}
+
+// EffectiveGasPrice returns the price per gas a transaction paid in a block
+// with the given base fee: the base fee plus the tip, capped by the fee cap,
+// i.e. baseFee + min(tip, feeCap-baseFee). Legacy transactions and blocks
+// before London pay the gas price.
+func EffectiveGasPrice(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return new(big.Int).Set(tx.GasPrice())
+	}
+	tip := new(big.Int).Sub(tx.GasFeeCap(), baseFee)
+	if tip.Cmp(tx.GasTipCap()) > 0 {
+		tip.Set(tx.GasTipCap())
+	}
+	return tip.Add(tip, baseFee)
+}
+
+// decodeBlockReceipts decodes the receipts of a block and derives their
+// fields from its stored header and body
+func decodeBlockReceipts(headerData, bodyData, receiptsData []byte) (types.Receipts, error) {
+	header, err := decodeHeader(headerData)
+	if err != nil {
+		return nil, err
+	}
+	body, err := decodeBody(bodyData)
+	if err != nil {
+		return nil, err
+	}
+	receipts, err := decodeReceipts(receiptsData)
+	if err != nil {
+		return nil, err
+	}
+
+	deriveReceipts(receipts, types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles))
+	return receipts, nil
+}
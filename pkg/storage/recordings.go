@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// recordingsPrefix prefixes the keys of recorded calls. Keys sort in the
+// order the calls were recorded.
+const recordingsPrefix = "rec:"
+
+// recordingsBatch is the number of recordings read per MGET
+const recordingsBatch = 500
+
+// RecordingStore keeps the calls recorded for `rpc replay` in Pika
+type RecordingStore struct {
+	client *PikaClient
+	seq    atomic.Uint64 // tells apart recordings of the same instant
+}
+
+// NewRecordingStore creates a new recording store
+func NewRecordingStore(client *PikaClient) *RecordingStore {
+	return &RecordingStore{client: client}
+}
+
+// Add stores a recording made at t, expiring after ttl
+func (s *RecordingStore) Add(ctx context.Context, t time.Time, data []byte, ttl time.Duration) error {
+	key := fmt.Sprintf("%s%019d:%06d", recordingsPrefix, t.UnixNano(), s.seq.Add(1)%1_000_000)
+	return s.client.Set(ctx, key, data, ttl)
+}
+
+// List returns the stored recordings in the order they were made
+func (s *RecordingStore) List(ctx context.Context) ([][]byte, error) {
+	var keys []string
+	err := s.client.Scan(ctx, recordingsPrefix+"*", 1000, func(batch []string) error {
+		keys = append(keys, batch...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	recordings := make([][]byte, 0, len(keys))
+	for start := 0; start < len(keys); start += recordingsBatch {
+		values, err := s.client.MGet(ctx, keys[start:min(start+recordingsBatch, len(keys))]...)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			// Recordings expiring since the scan are skipped
+			if data, ok := mgetBytes(value); ok {
+				recordings = append(recordings, data)
+			}
+		}
+	}
+	return recordings, nil
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+)
+
+const (
+	// defaultReplicaHealthInterval is how often replicas are probed
+	defaultReplicaHealthInterval = 5 * time.Second
+
+	// defaultReplicaFailThreshold is the number of consecutive failed probes
+	// before a replica is ejected
+	defaultReplicaFailThreshold = 3
+
+	// replicaLatencyWeight is the weight of the newest probe in the latency
+	// moving average
+	replicaLatencyWeight = 0.3
+)
+
+// replica is a read replica with its health state
+type replica struct {
+	addr    string
+	client  *redis.Client
+	healthy atomic.Bool
+	latency atomic.Int64 // moving average of probe round trips, in ns
+
+	failures int // consecutive failed probes, owned by the probe loop
+}
+
+// replicaSet balances reads over healthy replicas, ejecting replicas that
+// fail health probes and re-adding them once they answer again
+type replicaSet struct {
+	replicas      []*replica
+	latencyAware  bool
+	interval      time.Duration
+	failThreshold int
+	next          atomic.Uint64
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// newReplicaSet connects to the replicas and starts probing them
+func newReplicaSet(cfg config.ReplicaConfig, newClient func(addr string) *redis.Client) *replicaSet {
+	s := &replicaSet{
+		latencyAware:  cfg.Balance == config.BalanceLatency,
+		interval:      cfg.HealthInterval,
+		failThreshold: cfg.FailThreshold,
+		stopCh:        make(chan struct{}),
+	}
+	if s.interval <= 0 {
+		s.interval = defaultReplicaHealthInterval
+	}
+	if s.failThreshold <= 0 {
+		s.failThreshold = defaultReplicaFailThreshold
+	}
+
+	for _, addr := range cfg.Addrs {
+		s.replicas = append(s.replicas, &replica{addr: addr, client: newClient(addr)})
+	}
+
+	// Replicas enter rotation only after answering a first probe
+	s.probe()
+
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+// pick returns the replica to serve a read, nil if none is healthy
+func (s *replicaSet) pick() *redis.Client {
+	if s.latencyAware {
+		var best *replica
+		for _, r := range s.replicas {
+			if r.healthy.Load() && (best == nil || r.latency.Load() < best.latency.Load()) {
+				best = r
+			}
+		}
+		if best == nil {
+			return nil
+		}
+		return best.client
+	}
+
+	n := uint64(len(s.replicas))
+	start := s.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if r := s.replicas[(start+i)%n]; r.healthy.Load() {
+			return r.client
+		}
+	}
+	return nil
+}
+
+// run probes the replicas until the set is closed
+func (s *replicaSet) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.probe()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// probe pings every replica, updating its latency and health
+func (s *replicaSet) probe() {
+	for _, r := range s.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+		start := time.Now()
+		err := r.client.Ping(ctx).Err()
+		cancel()
+
+		if err != nil {
+			r.failures++
+			if r.failures >= s.failThreshold && r.healthy.Swap(false) {
+				logger.Warnf("Pika replica %s ejected: %v", r.addr, err)
+			}
+		} else {
+			r.failures = 0
+			rtt := time.Since(start).Nanoseconds()
+			if prev := r.latency.Load(); prev > 0 {
+				rtt = int64(replicaLatencyWeight*float64(rtt) + (1-replicaLatencyWeight)*float64(prev))
+			}
+			r.latency.Store(rtt)
+			if !r.healthy.Swap(true) {
+				logger.Infof("Pika replica %s in rotation", r.addr)
+			}
+		}
+
+		metrics.RecordReplicaHealth(r.addr, r.healthy.Load())
+	}
+}
+
+// Close stops probing and disconnects from the replicas
+func (s *replicaSet) Close() error {
+	close(s.stopCh)
+	s.wg.Wait()
+
+	var firstErr error
+	for _, r := range s.replicas {
+		if err := r.client.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,317 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+)
+
+const (
+	// defaultRetryAttempts is the number of attempts of idempotent reads
+	defaultRetryAttempts = 3
+
+	// defaultRetryBackoff is the delay before the first retry
+	defaultRetryBackoff = 50 * time.Millisecond
+
+	// defaultBreakerThreshold is the number of consecutive failures that
+	// open the breaker
+	defaultBreakerThreshold = 10
+
+	// defaultBreakerOpenTimeout is how long the breaker stays open before a
+	// trial request is let through
+	defaultBreakerOpenTimeout = 5 * time.Second
+)
+
+// ErrUnavailable is returned without contacting Pika while the circuit
+// breaker is open
+var ErrUnavailable = errors.New("storage unavailable")
+
+// idempotentCommands are the commands retried on failure
+var idempotentCommands = map[string]bool{
+	"get":           true,
+	"mget":          true,
+	"hget":          true,
+	"hgetall":       true,
+	"exists":        true,
+	"zrange":        true,
+	"zrevrange":     true,
+	"zcard":         true,
+	"zrangebyscore": true,
+	"smembers":      true,
+	"scard":         true,
+	"ping":          true,
+}
+
+// resilienceHook applies per-attempt timeouts, retries of idempotent reads
+// and a circuit breaker to every operation of a Redis client
+type resilienceHook struct {
+	timeout      time.Duration
+	attempts     int
+	backoff      time.Duration
+	breaker      *circuitBreaker // nil if disabled
+	availability *Availability   // fails operations fast while degraded; nil for replicas
+}
+
+// newResilienceHook creates the hook for a client. The breaker is shared
+// by all operations of the client and reported under target.
+func newResilienceHook(cfg config.PikaConfig, target string, withBreaker bool) *resilienceHook {
+	h := &resilienceHook{
+		timeout:  cfg.OpTimeout,
+		attempts: cfg.Retry.MaxAttempts,
+		backoff:  cfg.Retry.Backoff,
+	}
+	if h.attempts <= 0 {
+		h.attempts = defaultRetryAttempts
+	}
+	if h.backoff <= 0 {
+		h.backoff = defaultRetryBackoff
+	}
+	if withBreaker && cfg.Breaker.Enabled {
+		h.breaker = newCircuitBreaker(target, cfg.Breaker)
+	}
+	return h
+}
+
+// DialHook implements redis.Hook
+func (h *resilienceHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+// ProcessHook implements redis.Hook. Pings still reach Pika while degraded,
+// as they probe whether it is back.
+func (h *resilienceHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if h.availability.Degraded() && cmd.Name() != "ping" {
+			markUnavailable(ctx)
+			cmd.SetErr(ErrUnavailable)
+			return ErrUnavailable
+		}
+		if err := h.breaker.allow(ctx); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+
+		attempts := 1
+		if idempotentCommands[cmd.Name()] {
+			attempts = h.attempts
+		}
+
+		var err error
+		backoff := h.backoff
+		for attempt := 1; ; attempt++ {
+			err = h.attempt(ctx, func(ctx context.Context) error { return next(ctx, cmd) })
+			if attempt >= attempts || !isFailure(err) || ctx.Err() != nil {
+				break
+			}
+
+			metrics.RecordRetry(cmd.Name())
+			if !sleepContext(ctx, backoff) {
+				break
+			}
+			backoff *= 2
+		}
+
+		h.breaker.record(ctx, err)
+		return err
+	}
+}
+
+// ProcessPipelineHook implements redis.Hook. Pipelines may contain writes
+// and are never retried.
+func (h *resilienceHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if h.availability.Degraded() {
+			markUnavailable(ctx)
+			for _, cmd := range cmds {
+				cmd.SetErr(ErrUnavailable)
+			}
+			return ErrUnavailable
+		}
+		if err := h.breaker.allow(ctx); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+
+		err := h.attempt(ctx, func(ctx context.Context) error { return next(ctx, cmds) })
+		h.breaker.record(ctx, err)
+		return err
+	}
+}
+
+// attempt runs one attempt of an operation under the per-attempt timeout
+func (h *resilienceHook) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if h.timeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// isFailure reports whether an error means Pika could not be reached or
+// did not answer in time. Replies such as a missing key are not failures.
+func isFailure(err error) bool {
+	if err == nil || errors.Is(err, ErrUnavailable) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var redisErr redis.Error
+	return !errors.As(err, &redisErr)
+}
+
+// Circuit breaker states
+const (
+	breakerClosed = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+// circuitBreaker stops sending operations to Pika after consecutive
+// failures. Once open, a single trial operation is let through after a
+// timeout; its success closes the breaker again.
+type circuitBreaker struct {
+	mu          sync.Mutex
+	target      string
+	threshold   int
+	openTimeout time.Duration
+	state       int
+	failures    int
+	openedAt    time.Time
+	probing     bool // a trial operation is in flight
+}
+
+// newCircuitBreaker creates a closed circuit breaker
+func newCircuitBreaker(target string, cfg config.BreakerConfig) *circuitBreaker {
+	b := &circuitBreaker{
+		target:      target,
+		threshold:   cfg.FailureThreshold,
+		openTimeout: cfg.OpenTimeout,
+	}
+	if b.threshold <= 0 {
+		b.threshold = defaultBreakerThreshold
+	}
+	if b.openTimeout <= 0 {
+		b.openTimeout = defaultBreakerOpenTimeout
+	}
+	metrics.RecordBreakerState(target, breakerClosed)
+	return b
+}
+
+// allow returns ErrUnavailable if an operation must fail fast
+func (b *circuitBreaker) allow(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			break
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			break
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+
+	metrics.RecordBreakerRejection(b.target)
+	markUnavailable(ctx)
+	return ErrUnavailable
+}
+
+// record updates the breaker with the outcome of an allowed operation.
+// Operations whose caller gave up, by its deadline or by going away, tell
+// nothing about Pika and are not counted.
+func (b *circuitBreaker) record(ctx context.Context, err error) {
+	if b == nil {
+		return
+	}
+
+	failed := isFailure(err)
+	abandoned := ctx.Err() != nil
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerHalfOpen:
+		b.probing = false
+		if abandoned {
+			return
+		}
+		if failed {
+			b.open()
+		} else {
+			b.failures = 0
+			b.setState(breakerClosed)
+			logger.Infof("Pika circuit breaker closed: target=%s", b.target)
+		}
+	case breakerClosed:
+		if abandoned {
+			return
+		}
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open()
+			logger.Warnf("Pika circuit breaker opened after %d failures: target=%s, error=%v", b.failures, b.target, err)
+		}
+	}
+}
+
+// open opens the breaker; the caller must hold the lock
+func (b *circuitBreaker) open() {
+	b.openedAt = time.Now()
+	b.setState(breakerOpen)
+}
+
+// setState changes the state; the caller must hold the lock
+func (b *circuitBreaker) setState(state int) {
+	b.state = state
+	metrics.RecordBreakerState(b.target, state)
+}
+
+// unavailableKey is the context key of the flag set when storage operations
+// are rejected by an open breaker
+type unavailableKey struct{}
+
+// TrackUnavailable returns a context that records whether storage
+// operations made with it failed fast because storage is unavailable
+func TrackUnavailable(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unavailableKey{}, new(atomic.Bool))
+}
+
+// WasUnavailable reports whether a storage operation made with a context
+// returned by TrackUnavailable failed fast
+func WasUnavailable(ctx context.Context) bool {
+	flag, ok := ctx.Value(unavailableKey{}).(*atomic.Bool)
+	return ok && flag.Load()
+}
+
+// markUnavailable sets the flag of a tracking context
+func markUnavailable(ctx context.Context) {
+	if flag, ok := ctx.Value(unavailableKey{}).(*atomic.Bool); ok {
+		flag.Store(true)
+	}
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/txsender"
+)
+
+func TestTxPoolSender(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0x000000000000000000000000000000000000dead")
+
+	chainID := big.NewInt(1337)
+	otherChainID := big.NewInt(1)
+	sign := func(signer types.Signer, data types.TxData) *types.Transaction {
+		tx, err := types.SignNewTx(key, signer, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	legacy := func(nonce uint64) *types.LegacyTx {
+		return &types.LegacyTx{Nonce: nonce, GasPrice: big.NewInt(1e9), Gas: 21000, To: &to, Value: big.NewInt(1)}
+	}
+	dynamic := func(chainID *big.Int, nonce uint64) *types.DynamicFeeTx {
+		return &types.DynamicFeeTx{
+			ChainID:   chainID,
+			Nonce:     nonce,
+			GasTipCap: big.NewInt(1e9),
+			GasFeeCap: big.NewInt(2e9),
+			Gas:       21000,
+			To:        &to,
+			Value:     big.NewInt(1),
+		}
+	}
+
+	pool := NewTxPoolStorage(nil, config.TxPoolConfig{}, chainID.Uint64())
+
+	tests := []struct {
+		name    string
+		tx      *types.Transaction
+		cached  bool // recovered by txsender.Recover before the pool sees it
+		wantErr error
+	}{
+		{name: "legacy", tx: sign(types.HomesteadSigner{}, legacy(0))},
+		{name: "eip155", tx: sign(types.NewEIP155Signer(chainID), legacy(1))},
+		{name: "eip1559", tx: sign(types.NewLondonSigner(chainID), dynamic(chainID, 2))},
+		{
+			name:    "eip155 wrong chain",
+			tx:      sign(types.NewEIP155Signer(otherChainID), legacy(3)),
+			wantErr: types.ErrInvalidChainId,
+		},
+		{
+			name:    "eip1559 wrong chain",
+			tx:      sign(types.NewLondonSigner(otherChainID), dynamic(otherChainID, 4)),
+			wantErr: types.ErrInvalidChainId,
+		},
+		{
+			name:    "eip1559 wrong chain cached",
+			tx:      sign(types.NewLondonSigner(otherChainID), dynamic(otherChainID, 5)),
+			cached:  true,
+			wantErr: types.ErrInvalidChainId,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cached {
+				if _, err := txsender.Recover(tt.tx); err != nil {
+					t.Fatalf("Recover: %v", err)
+				}
+			}
+			got, err := pool.Sender(tt.tx)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Sender: %v", err)
+			}
+			if got != from {
+				t.Fatalf("sender = %s, want %s", got, from)
+			}
+		})
+	}
+}
@@ -28,6 +28,7 @@ type AccountState struct {
 
 // GetBalance returns account balance at block number
 func (r *StateReader) GetBalance(ctx context.Context, address common.Address, blockNumber string) (*big.Int, error) {
+	blockNumber = stateBlock(ctx, blockNumber)
 	var key string
 	if blockNumber == "latest" || blockNumber == "pending" {
 		key = fmt.Sprintf("st:latest:acc:%s", address.Hex())
@@ -59,6 +60,7 @@ func (r *StateReader) GetBalance(ctx context.Context, address common.Address, bl
 
 // GetNonce returns account nonce at block number
 func (r *StateReader) GetNonce(ctx context.Context, address common.Address, blockNumber string) (uint64, error) {
+	blockNumber = stateBlock(ctx, blockNumber)
 	var key string
 	if blockNumber == "latest" || blockNumber == "pending" {
 		key = fmt.Sprintf("st:latest:acc:%s", address.Hex())
@@ -85,6 +87,7 @@ func (r *StateReader) GetNonce(ctx context.Context, address common.Address, bloc
 
 // GetCode returns contract code
 func (r *StateReader) GetCode(ctx context.Context, address common.Address, blockNumber string) ([]byte, error) {
+	blockNumber = stateBlock(ctx, blockNumber)
 	// First get code hash from account state
 	var accKey string
 	if blockNumber == "latest" || blockNumber == "pending" {
@@ -127,6 +130,7 @@ func (r *StateReader) GetCode(ctx context.Context, address common.Address, block
 
 // GetStorageAt returns storage value at key
 func (r *StateReader) GetStorageAt(ctx context.Context, address common.Address, key common.Hash, blockNumber string) ([]byte, error) {
+	blockNumber = stateBlock(ctx, blockNumber)
 	var storageKey string
 	if blockNumber == "latest" || blockNumber == "pending" {
 		storageKey = fmt.Sprintf("st:latest:stor:%s:%s", address.Hex(), key.Hex())
@@ -148,6 +152,7 @@ func (r *StateReader) GetStorageAt(ctx context.Context, address common.Address,
 
 // GetAccountState returns full account state
 func (r *StateReader) GetAccountState(ctx context.Context, address common.Address, blockNumber string) (*AccountState, error) {
+	blockNumber = stateBlock(ctx, blockNumber)
 	var key string
 	if blockNumber == "latest" || blockNumber == "pending" {
 		key = fmt.Sprintf("st:latest:acc:%s", address.Hex())
@@ -175,3 +180,111 @@ func (r *StateReader) GetAccountState(ctx context.Context, address common.Addres
 
 	return &state, nil
 }
+
+// StateDiff is the state changed by a block
+type StateDiff struct {
+	// Accounts holds the new state of changed accounts, nil if deleted
+	Accounts map[common.Address]*AccountState
+	// Storage holds changed storage slots, zero if cleared
+	Storage map[common.Address]map[common.Hash]common.Hash
+	// Code holds newly deployed code by code hash
+	Code map[common.Hash][]byte
+}
+
+// NewStateDiff creates an empty state diff
+func NewStateDiff() *StateDiff {
+	return &StateDiff{
+		Accounts: make(map[common.Address]*AccountState),
+		Storage:  make(map[common.Address]map[common.Hash]common.Hash),
+		Code:     make(map[common.Hash][]byte),
+	}
+}
+
+// StateWriter writes state data to Pika
+type StateWriter struct {
+	client *PikaClient
+}
+
+// NewStateWriter creates a new state writer
+func NewStateWriter(client *PikaClient) *StateWriter {
+	return &StateWriter{client: client}
+}
+
+// WriteLatestState applies a state diff to the latest state
+func (w *StateWriter) WriteLatestState(ctx context.Context, diff *StateDiff) error {
+	return w.writeState(ctx, "latest", diff, "")
+}
+
+// WriteHistoricalState records a state diff as the state at a block. The
+// written keys are indexed under st:keys:{n} so the pruner can find them.
+func (w *StateWriter) WriteHistoricalState(ctx context.Context, number uint64, diff *StateDiff) error {
+	return w.writeState(ctx, fmt.Sprintf("%d", number), diff, stateIndexKey(number))
+}
+
+// DeleteHistoricalState drops the state recorded at a block for the
+// accounts and slots of a diff, e.g. after the block was reorged out
+func (w *StateWriter) DeleteHistoricalState(ctx context.Context, number uint64, diff *StateDiff) error {
+	var keys []string
+	for address := range diff.Accounts {
+		keys = append(keys, fmt.Sprintf("st:%d:acc:%s", number, address.Hex()))
+	}
+	for address, slots := range diff.Storage {
+		for slot := range slots {
+			keys = append(keys, fmt.Sprintf("st:%d:stor:%s:%s", number, address.Hex(), slot.Hex()))
+		}
+	}
+	keys = append(keys, stateIndexKey(number))
+	return w.client.Del(ctx, keys...)
+}
+
+// writeState writes a state diff under a block prefix. Deleted accounts and
+// cleared slots are removed from the latest state but recorded as empty in
+// historical state, so that lookups do not fall through to older data.
+// Historical keys are added to the set at index.
+func (w *StateWriter) writeState(ctx context.Context, prefix string, diff *StateDiff, index string) error {
+	latest := index == ""
+	pipe := w.client.Pipeline()
+	var written []interface{}
+
+	for hash, code := range diff.Code {
+		pipe.Set(ctx, fmt.Sprintf("st:code:%s", hash.Hex()), code, 0)
+	}
+
+	for address, state := range diff.Accounts {
+		key := fmt.Sprintf("st:%s:acc:%s", prefix, address.Hex())
+		if state == nil {
+			if latest {
+				pipe.Del(ctx, key)
+				continue
+			}
+			state = &AccountState{Balance: big.NewInt(0)}
+		}
+		data, err := json.Marshal(state)
+		if err != nil {
+			return fmt.Errorf("failed to encode account state: %w", err)
+		}
+		pipe.Set(ctx, key, data, 0)
+		written = append(written, key)
+	}
+
+	for address, slots := range diff.Storage {
+		for slot, value := range slots {
+			key := fmt.Sprintf("st:%s:stor:%s:%s", prefix, address.Hex(), slot.Hex())
+			if value == (common.Hash{}) && latest {
+				pipe.Del(ctx, key)
+				continue
+			}
+			pipe.Set(ctx, key, value.Bytes(), 0)
+			written = append(written, key)
+		}
+	}
+
+	if !latest && len(written) > 0 {
+		pipe.SAdd(ctx, index, written...)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	return nil
+}
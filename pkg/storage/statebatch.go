@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// stateBatchSize bounds the keys fetched per round trip by batched state
+// reads
+const stateBatchSize = 500
+
+// StorageSlot is a storage slot of an account
+type StorageSlot struct {
+	Address common.Address
+	Key     common.Hash
+}
+
+// accountKey returns the key of an account's state at a block number
+// string as StateReader takes it
+func accountKey(address common.Address, blockNumber string) string {
+	if blockNumber == "latest" || blockNumber == "pending" {
+		return fmt.Sprintf("st:latest:acc:%s", address.Hex())
+	}
+	return fmt.Sprintf("st:%s:acc:%s", blockNumber, address.Hex())
+}
+
+// storageKey returns the key of a storage slot at a block number string
+func storageKey(address common.Address, key common.Hash, blockNumber string) string {
+	if blockNumber == "latest" || blockNumber == "pending" {
+		return fmt.Sprintf("st:latest:stor:%s:%s", address.Hex(), key.Hex())
+	}
+	return fmt.Sprintf("st:%s:stor:%s:%s", blockNumber, address.Hex(), key.Hex())
+}
+
+// GetAccountStates returns the states of accounts at a block number,
+// indexed like addresses, fetching them in batches of one round trip.
+// Accounts that do not exist are empty, as in GetAccountState.
+func (r *StateReader) GetAccountStates(ctx context.Context, addresses []common.Address, blockNumber string) ([]*AccountState, error) {
+	blockNumber = stateBlock(ctx, blockNumber)
+	keys := make([]string, len(addresses))
+	for i, address := range addresses {
+		keys[i] = accountKey(address, blockNumber)
+	}
+	values, err := r.mget(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]*AccountState, len(addresses))
+	for i, value := range values {
+		if value == nil {
+			states[i] = &AccountState{Balance: big.NewInt(0)}
+			continue
+		}
+		var state AccountState
+		if err := json.Unmarshal(value, &state); err != nil {
+			return nil, fmt.Errorf("failed to decode account state of %s: %w", addresses[i].Hex(), err)
+		}
+		if state.Balance == nil {
+			state.Balance = big.NewInt(0)
+		}
+		states[i] = &state
+	}
+	return states, nil
+}
+
+// GetStorageSlots returns storage slots at a block number, indexed like
+// slots, fetching them in batches of one round trip. Empty slots are zero.
+func (r *StateReader) GetStorageSlots(ctx context.Context, slots []StorageSlot, blockNumber string) ([]common.Hash, error) {
+	blockNumber = stateBlock(ctx, blockNumber)
+	keys := make([]string, len(slots))
+	for i, slot := range slots {
+		keys[i] = storageKey(slot.Address, slot.Key, blockNumber)
+	}
+	values, err := r.mget(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]common.Hash, len(slots))
+	for i, value := range values {
+		result[i] = common.BytesToHash(value)
+	}
+	return result, nil
+}
+
+// mget fetches keys in batches of stateBatchSize. Missing keys yield nil.
+func (r *StateReader) mget(ctx context.Context, keys []string) ([][]byte, error) {
+	values := make([][]byte, 0, len(keys))
+	for start := 0; start < len(keys); start += stateBatchSize {
+		batch, err := r.client.MGet(ctx, keys[start:min(start+stateBatchSize, len(keys))]...)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range batch {
+			switch v := value.(type) {
+			case string:
+				values = append(values, []byte(v))
+			default:
+				values = append(values, nil)
+			}
+		}
+	}
+	return values, nil
+}
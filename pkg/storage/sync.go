@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// DefaultSyncLagThreshold is the head age after which the indexer is
+// considered to be catching up
+const DefaultSyncLagThreshold = 5 * time.Minute
+
+// SyncStatus describes how far the indexed chain is behind the network head
+type SyncStatus struct {
+	Syncing       bool
+	StartingBlock uint64
+	CurrentBlock  uint64
+	HighestBlock  uint64
+	HeadTime      time.Time
+	Lag           time.Duration
+}
+
+// GetSyncStatus computes the indexer sync status.
+// The indexer may publish the network head it is catching up to under
+// idx:highest; otherwise the age of the latest indexed block is used.
+func (r *BlockReader) GetSyncStatus(ctx context.Context, lagThreshold time.Duration) (*SyncStatus, error) {
+	if lagThreshold <= 0 {
+		lagThreshold = DefaultSyncLagThreshold
+	}
+
+	current, err := r.GetLatestBlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &SyncStatus{
+		StartingBlock: current,
+		CurrentBlock:  current,
+		HighestBlock:  current,
+	}
+
+	// While Pika is unreachable the head is stale, so report syncing until
+	// it is back
+	if r.client.Availability().Degraded() {
+		status.Syncing = true
+		if header, err := r.GetHeader(ctx, current); err == nil {
+			status.HeadTime = time.Unix(int64(header.Time), 0)
+			status.Lag = time.Since(status.HeadTime)
+		}
+		return status, nil
+	}
+
+	if data, err := r.client.Get(ctx, "idx:highest"); err == nil {
+		if highest, err := strconv.ParseUint(string(data), 10, 64); err == nil && highest > current {
+			status.HighestBlock = highest
+			status.Syncing = true
+		}
+	} else if err != ErrNotFound {
+		return nil, err
+	}
+
+	if data, err := r.client.Get(ctx, "idx:starting"); err == nil {
+		if starting, err := strconv.ParseUint(string(data), 10, 64); err == nil && starting <= current {
+			status.StartingBlock = starting
+		}
+	}
+
+	header, err := r.GetHeader(ctx, current)
+	if err != nil {
+		return nil, err
+	}
+
+	status.HeadTime = time.Unix(int64(header.Time), 0)
+	// Ignore timestamps in the future (clock skew between producer and us)
+	if lag := time.Since(status.HeadTime); lag > 0 {
+		status.Lag = lag
+	}
+	if status.Lag > lagThreshold {
+		status.Syncing = true
+	}
+
+	return status, nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sunvim/evm_rpc/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingHook records a span for every Pika operation, including its
+// retries
+type tracingHook struct {
+	node string
+}
+
+// DialHook implements redis.Hook
+func (h tracingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+// ProcessHook implements redis.Hook
+func (h tracingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		attrs := []attribute.KeyValue{
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation", cmd.Name()),
+			attribute.String("server.address", h.node),
+		}
+		if args := cmd.Args(); len(args) > 1 {
+			attrs = append(attrs, attribute.String("db.redis.key", fmt.Sprint(args[1])))
+		}
+		ctx, span := tracing.StartSpan(ctx, "pika."+cmd.Name(), trace.SpanKindClient, attrs...)
+		err := next(ctx, cmd)
+		tracing.EndSpan(span, traceErr(err))
+		return err
+	}
+}
+
+// ProcessPipelineHook implements redis.Hook
+func (h tracingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := tracing.StartSpan(ctx, "pika.pipeline", trace.SpanKindClient,
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation", "pipeline"),
+			attribute.String("server.address", h.node),
+			attribute.Int("db.redis.commands", len(cmds)),
+		)
+		err := next(ctx, cmds)
+		tracing.EndSpan(span, traceErr(err))
+		return err
+	}
+}
+
+// traceErr hides missing keys, which are ordinary replies rather than
+// failed operations
+func traceErr(err error) error {
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
@@ -13,6 +13,7 @@ import (
 // TransactionReader reads transaction data from Pika
 type TransactionReader struct {
 	client *PikaClient
+	cold   *ColdStore
 }
 
 // NewTransactionReader creates a new transaction reader
@@ -20,6 +21,12 @@ func NewTransactionReader(client *PikaClient) *TransactionReader {
 	return &TransactionReader{client: client}
 }
 
+// SetColdStore makes the reader load old block bodies and receipts from
+// object storage. It must be called before the reader is used.
+func (r *TransactionReader) SetColdStore(cold *ColdStore) {
+	r.cold = cold
+}
+
 // TxLookup contains transaction location information
 type TxLookup struct {
 	BlockNumber uint64 `json:"blockNumber"`
@@ -67,31 +74,66 @@ func (r *TransactionReader) GetReceipt(ctx context.Context, hash common.Hash) (*
 		return nil, nil, err
 	}
 
-	// Get all receipts for the block
-	receiptsKey := fmt.Sprintf("blk:rcpt:%d", lookup.BlockNumber)
-	receiptsData, err := r.client.Get(ctx, receiptsKey)
+	receipt, err := r.GetReceiptByLookup(ctx, lookup)
 	if err != nil {
 		return nil, nil, err
 	}
+	return receipt, lookup, nil
+}
 
+// GetReceiptByLookup returns the receipt at the position of a lookup, with
+// its derived fields filled in. ErrNotFound is returned while its block is
+// not fully written.
+func (r *TransactionReader) GetReceiptByLookup(ctx context.Context, lookup *TxLookup) (*types.Receipt, error) {
+	// Get the block with all its receipts
 	var receipts types.Receipts
-	if err := rlp.DecodeBytes(receiptsData, &receipts); err != nil {
-		return nil, nil, fmt.Errorf("failed to decode receipts: %w", err)
+	if r.cold != nil && r.cold.Covers(lookup.BlockNumber) {
+		cold, err := r.cold.Get(ctx, lookup.BlockNumber)
+		if err != nil {
+			return nil, err
+		}
+		if receipts, err = decodeBlockReceipts(cold.Header, cold.Body, cold.Receipts); err != nil {
+			return nil, err
+		}
+	} else {
+		values, err := r.client.MGet(ctx, headerKey(lookup.BlockNumber), bodyKey(lookup.BlockNumber), receiptsKey(lookup.BlockNumber))
+		if err != nil {
+			return nil, err
+		}
+		data := make([][]byte, len(values))
+		for i, value := range values {
+			var ok bool
+			if data[i], ok = mgetBytes(value); !ok {
+				return nil, ErrNotFound
+			}
+		}
+		if receipts, err = decodeBlockReceipts(data[0], data[1], data[2]); err != nil {
+			return nil, err
+		}
 	}
 
 	if lookup.Index >= uint64(len(receipts)) {
-		return nil, nil, ErrNotFound
+		return nil, ErrNotFound
 	}
 
-	return receipts[lookup.Index], lookup, nil
+	return receipts[lookup.Index], nil
 }
 
 // GetTransactionByBlockNumberAndIndex returns transaction by block number and index
 func (r *TransactionReader) GetTransactionByBlockNumberAndIndex(ctx context.Context, blockNumber, index uint64) (*types.Transaction, error) {
-	bodyKey := fmt.Sprintf("blk:body:%d", blockNumber)
-	bodyData, err := r.client.Get(ctx, bodyKey)
-	if err != nil {
-		return nil, err
+	var bodyData []byte
+	if r.cold != nil && r.cold.Covers(blockNumber) {
+		cold, err := r.cold.Get(ctx, blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		bodyData = cold.Body
+	} else {
+		bodyKey := fmt.Sprintf("blk:body:%d", blockNumber)
+		var err error
+		if bodyData, err = r.client.Get(ctx, bodyKey); err != nil {
+			return nil, err
+		}
 	}
 
 	var body types.Body
@@ -2,68 +2,192 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/redis/go-redis/v9"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/txsender"
 )
 
+const (
+	// DefaultPriceBump is the minimum fee increase in percent for a
+	// transaction to replace a pending one with the same nonce
+	DefaultPriceBump = 10
+
+	// DefaultStatusTTL is how long the fate of dropped and replaced
+	// transactions is remembered
+	DefaultStatusTTL = 24 * time.Hour
+
+	// DefaultIdempotencyTTL is how long the idempotency keys of submissions
+	// are remembered
+	DefaultIdempotencyTTL = 24 * time.Hour
+)
+
+var (
+	// ErrAlreadyKnown is returned when a transaction is already pending
+	ErrAlreadyKnown = errors.New("already known")
+
+	// ErrReplaceUnderpriced is returned when a transaction with the nonce of
+	// a pending one does not raise its fees by the price bump
+	ErrReplaceUnderpriced = errors.New("replacement transaction underpriced")
+
+	// ErrUnderpriced is returned when the pool is full and a transaction
+	// pays no more than the cheapest pending one
+	ErrUnderpriced = errors.New("transaction underpriced")
+
+	// ErrAccountLimit is returned when a sender has the maximum number of
+	// pending transactions
+	ErrAccountLimit = errors.New("account limit exceeded")
+)
+
+// Reasons transactions are dropped from the pool
+const (
+	DropExpired      = "expired"
+	DropUnderpriced  = "underpriced"
+	DropAccountLimit = "account_limit"
+	DropStale        = "stale"
+	DropRolledBack   = "rolled_back"
+)
+
+// TxDroppedEvent is published on pool:dropped when a pending transaction is
+// evicted
+type TxDroppedEvent struct {
+	Hash   common.Hash `json:"hash"`
+	Reason string      `json:"reason"`
+}
+
+// TxReplacedEvent is published on pool:replaced when a pending transaction
+// is replaced by one with the same nonce and higher fees
+type TxReplacedEvent struct {
+	Hash       common.Hash `json:"hash"`
+	ReplacedBy common.Hash `json:"replacedBy"`
+}
+
+// Final states of transactions that left the pool without being mined
+const (
+	TxStatusDropped  = "dropped"
+	TxStatusReplaced = "replaced"
+)
+
+// TxPoolStatus records why a transaction left the pool, kept under
+// pool:status:{hash} for the status TTL
+type TxPoolStatus struct {
+	Status     string       `json:"status"`
+	Reason     string       `json:"reason,omitempty"`
+	ReplacedBy *common.Hash `json:"replacedBy,omitempty"`
+}
+
 // TxPoolStorage handles transaction pool operations
 type TxPoolStorage struct {
-	client *PikaClient
+	client        *PikaClient
+	signer        types.Signer
+	priceBump     uint64
+	maxTxs        int
+	maxPerAccount int
+	statusTTL     time.Duration
+	idemTTL       time.Duration
+}
+
+// NewTxPoolStorage creates a new transaction pool storage for a chain
+func NewTxPoolStorage(client *PikaClient, cfg config.TxPoolConfig, chainID uint64) *TxPoolStorage {
+	priceBump := cfg.PriceBump
+	if priceBump == 0 {
+		priceBump = DefaultPriceBump
+	}
+	statusTTL := cfg.StatusTTL
+	if statusTTL <= 0 {
+		statusTTL = DefaultStatusTTL
+	}
+	idemTTL := cfg.IdempotencyTTL
+	if idemTTL <= 0 {
+		idemTTL = DefaultIdempotencyTTL
+	}
+	return &TxPoolStorage{
+		client:        client,
+		signer:        types.LatestSignerForChainID(new(big.Int).SetUint64(chainID)),
+		priceBump:     priceBump,
+		maxTxs:        cfg.MaxTxs,
+		maxPerAccount: cfg.MaxPerAccount,
+		statusTTL:     statusTTL,
+		idemTTL:       idemTTL,
+	}
 }
 
-// NewTxPoolStorage creates a new transaction pool storage
-func NewTxPoolStorage(client *PikaClient) *TxPoolStorage {
-	return &TxPoolStorage{client: client}
+// Sender returns the sender of a pooled transaction as recovered by the
+// signer of the pool's chain
+func (t *TxPoolStorage) Sender(tx *types.Transaction) (common.Address, error) {
+	return txsender.RecoverWith(t.signer, tx)
 }
 
-// AddPendingTx adds a transaction to the pending pool
+// AddPendingTx adds a transaction to the pending pool. A pending
+// transaction from the same sender with the same nonce is replaced if both
+// fee caps are raised by at least the price bump, otherwise
+// ErrReplaceUnderpriced is returned. When the pool is full the cheapest
+// pending transaction makes room for a better paying one.
+//
+// The sender's nonce index is watched while the pending transaction is
+// looked up, and the new transaction takes the old one's place in a single
+// MULTI/EXEC, so concurrent submissions for a nonce cannot both be added.
 func (t *TxPoolStorage) AddPendingTx(ctx context.Context, tx *types.Transaction, source string) error {
 	txHash := tx.Hash()
-	
-	// Encode transaction
+
+	from, err := t.Sender(tx)
+	if err != nil {
+		return fmt.Errorf("failed to get sender: %w", err)
+	}
+
 	data, err := rlp.EncodeToBytes(tx)
 	if err != nil {
 		return fmt.Errorf("failed to encode transaction: %w", err)
 	}
 
-	// Store transaction
-	txKey := fmt.Sprintf("pool:pending:%s", txHash.Hex())
-	if err := t.client.Set(ctx, txKey, data, 0); err != nil {
-		return err
+	var (
+		old   *types.Transaction
+		evict *eviction
+	)
+	for attempt := 0; ; attempt++ {
+		old, evict, err = t.addPendingTx(ctx, tx, from, data)
+		if err != redis.TxFailedErr {
+			break
+		}
+		// Another submission changed the sender's transactions; decide
+		// again against the new state
+		if attempt+1 >= maxAddAttempts {
+			return fmt.Errorf("pending transactions of %s kept changing", from.Hex())
+		}
 	}
-
-	// Get sender
-	signer := types.LatestSignerForChainID(tx.ChainId())
-	from, err := types.Sender(signer, tx)
 	if err != nil {
-		return fmt.Errorf("failed to get sender: %w", err)
-	}
-
-	// Add to address index (sorted by nonce)
-	addrKey := fmt.Sprintf("pool:addr:%s", from.Hex())
-	if err := t.client.ZAdd(ctx, addrKey, redis.Z{
-		Score:  float64(tx.Nonce()),
-		Member: txHash.Hex(),
-	}); err != nil {
 		return err
 	}
 
-	// Add to price index (sorted by gas price)
-	gasPrice := tx.GasPrice()
-	if gasPrice == nil {
-		gasPrice = tx.GasFeeCap()
+	if evict != nil {
+		metrics.RecordPoolEviction(DropUnderpriced)
+		event, err := json.Marshal(&TxDroppedEvent{Hash: evict.hash, Reason: DropUnderpriced})
+		if err != nil {
+			return err
+		}
+		if err := t.client.Publish(ctx, "pool:dropped", event); err != nil {
+			return err
+		}
 	}
-	
-	if err := t.client.ZAdd(ctx, "pool:byprice", redis.Z{
-		Score:  float64(gasPrice.Uint64()),
-		Member: txHash.Hex(),
-	}); err != nil {
-		return err
+
+	if old != nil {
+		event, err := json.Marshal(&TxReplacedEvent{Hash: old.Hash(), ReplacedBy: txHash})
+		if err != nil {
+			return err
+		}
+		if err := t.client.Publish(ctx, "pool:replaced", event); err != nil {
+			return err
+		}
 	}
 
 	// Publish to notification channel
@@ -74,6 +198,230 @@ func (t *TxPoolStorage) AddPendingTx(ctx context.Context, tx *types.Transaction,
 	return nil
 }
 
+// maxAddAttempts bounds how often a submission is retried when the
+// sender's transactions change while it is being added
+const maxAddAttempts = 5
+
+// addPendingTx stores tx, replacing the pending transaction with its nonce
+// or evicting the cheapest one if the pool is full, which are returned.
+// redis.TxFailedErr is returned if the sender's nonce index or, outside
+// cluster mode, the price index changed meanwhile and nothing was written.
+func (t *TxPoolStorage) addPendingTx(ctx context.Context, tx *types.Transaction, from common.Address, data []byte) (*types.Transaction, *eviction, error) {
+	txHash := tx.Hash()
+	addrKey := fmt.Sprintf("pool:addr:%s", from.Hex())
+	txKey := fmt.Sprintf("pool:pending:%s", txHash.Hex())
+
+	// In cluster mode the price index lives in another slot than the nonce
+	// index and cannot be watched with it
+	watched := []string{addrKey}
+	if t.maxTxs > 0 && !t.client.cluster {
+		watched = append(watched, "pool:byprice")
+	}
+
+	var (
+		old   *types.Transaction
+		evict *eviction
+	)
+	err := t.client.Watch(ctx, func(rtx *redis.Tx) error {
+		var err error
+		evict = nil
+		if old, err = t.pendingByNonce(ctx, rtx, from, tx.Nonce()); err != nil {
+			return err
+		}
+		if old != nil {
+			if old.Hash() == txHash {
+				return ErrAlreadyKnown
+			}
+			if !t.replaces(tx, old) {
+				return ErrReplaceUnderpriced
+			}
+		} else if evict, err = t.makeRoom(ctx, rtx, tx, from); err != nil {
+			return err
+		}
+
+		var replaced, dropped []byte
+		if old != nil {
+			if replaced, err = json.Marshal(&TxPoolStatus{Status: TxStatusReplaced, ReplacedBy: &txHash}); err != nil {
+				return err
+			}
+		}
+		if evict != nil {
+			if dropped, err = json.Marshal(&TxPoolStatus{Status: TxStatusDropped, Reason: DropUnderpriced}); err != nil {
+				return err
+			}
+		}
+
+		// Writes to the other pool keys. In cluster mode they live in other
+		// slots than the nonce index and cannot join its transaction.
+		write := func(pipe redis.Pipeliner) {
+			pipe.Set(ctx, txKey, data, 0)
+			pipe.ZAdd(ctx, "pool:byprice", redis.Z{Score: poolPrice(tx), Member: txHash.Hex()})
+			pipe.ZAdd(ctx, "pool:time", redis.Z{Score: float64(time.Now().Unix()), Member: txHash.Hex()})
+			if old != nil {
+				oldHash := old.Hash().Hex()
+				pipe.Del(ctx, fmt.Sprintf("pool:pending:%s", oldHash))
+				pipe.ZRem(ctx, "pool:byprice", oldHash)
+				pipe.ZRem(ctx, "pool:time", oldHash)
+				pipe.Set(ctx, fmt.Sprintf("pool:status:%s", oldHash), replaced, t.statusTTL)
+			}
+			if evict != nil {
+				evictHash := evict.hash.Hex()
+				pipe.Del(ctx, fmt.Sprintf("pool:pending:%s", evictHash))
+				if evict.from != nil {
+					pipe.ZRem(ctx, fmt.Sprintf("pool:addr:%s", evict.from.Hex()), evictHash)
+				}
+				pipe.ZRem(ctx, "pool:byprice", evictHash)
+				pipe.ZRem(ctx, "pool:time", evictHash)
+				pipe.Set(ctx, fmt.Sprintf("pool:status:%s", evictHash), dropped, t.statusTTL)
+			}
+		}
+		if t.client.cluster {
+			// The new transaction is readable before it is indexed
+			if err := t.client.Set(ctx, txKey, data, 0); err != nil {
+				return err
+			}
+		}
+
+		_, err = rtx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZAdd(ctx, addrKey, redis.Z{Score: float64(tx.Nonce()), Member: txHash.Hex()})
+			if old != nil {
+				pipe.ZRem(ctx, addrKey, old.Hash().Hex())
+			}
+			if !t.client.cluster {
+				write(pipe)
+			}
+			return nil
+		})
+		if err != nil || !t.client.cluster {
+			return err
+		}
+		pipe := t.client.Pipeline()
+		write(pipe)
+		_, err = pipe.Exec(ctx)
+		return err
+	}, watched...)
+	return old, evict, err
+}
+
+// txPrice is the price a transaction is ranked by in the pool: the gas
+// price of legacy transactions, the fee cap of others
+func txPrice(tx *types.Transaction) *big.Int {
+	if gasPrice := tx.GasPrice(); gasPrice != nil {
+		return gasPrice
+	}
+	return tx.GasFeeCap()
+}
+
+// poolPrice is the score of a transaction in the price index. Scores are
+// floats, so prices beyond 2^53 wei are rounded; evictions compare the
+// exact prices.
+func poolPrice(tx *types.Transaction) float64 {
+	score, _ := new(big.Float).SetInt(txPrice(tx)).Float64()
+	return score
+}
+
+// eviction is a pending transaction evicted to make room for another
+type eviction struct {
+	hash common.Hash
+	from *common.Address // nil if the transaction body is already gone
+}
+
+// makeRoom enforces the pool limits for a new transaction, returning the
+// cheapest pending transaction to evict if the pool is full and tx pays
+// more. The indexes are read through rtx, which watches them, except the
+// price index in cluster mode.
+func (t *TxPoolStorage) makeRoom(ctx context.Context, rtx *redis.Tx, tx *types.Transaction, from common.Address) (*eviction, error) {
+	if t.maxPerAccount > 0 {
+		count, err := rtx.ZCard(ctx, fmt.Sprintf("pool:addr:%s", from.Hex())).Result()
+		if err != nil {
+			return nil, err
+		}
+		if count >= int64(t.maxPerAccount) {
+			return nil, ErrAccountLimit
+		}
+	}
+
+	if t.maxTxs <= 0 {
+		return nil, nil
+	}
+	var index redis.Cmdable = rtx
+	if t.client.cluster {
+		index = t.client.client
+	}
+	count, err := index.ZCard(ctx, "pool:byprice").Result()
+	if err != nil {
+		return nil, err
+	}
+	if count < int64(t.maxTxs) {
+		return nil, nil
+	}
+
+	cheapest, err := index.ZRange(ctx, "pool:byprice", 0, 0).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(cheapest) == 0 {
+		return nil, nil
+	}
+	hash := common.HexToHash(cheapest[0])
+	victim, err := t.GetPendingTx(ctx, hash)
+	if err == ErrNotFound {
+		// A stale index entry is evicted whatever tx pays
+		return &eviction{hash: hash}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if txPrice(tx).Cmp(txPrice(victim)) <= 0 {
+		return nil, ErrUnderpriced
+	}
+	victimFrom, err := t.Sender(victim)
+	if err != nil {
+		return nil, err
+	}
+	return &eviction{hash: hash, from: &victimFrom}, nil
+}
+
+// pendingByNonce returns the pending transaction of a sender with a nonce,
+// or nil. The nonce index is read through rtx, which watches it; bodies
+// never change and are read from the primary.
+func (t *TxPoolStorage) pendingByNonce(ctx context.Context, rtx *redis.Tx, from common.Address, nonce uint64) (*types.Transaction, error) {
+	addrKey := fmt.Sprintf("pool:addr:%s", from.Hex())
+	hashes, err := rtx.ZRangeByScore(ctx, addrKey, &redis.ZRangeBy{
+		Min: strconv.FormatUint(nonce, 10),
+		Max: strconv.FormatUint(nonce, 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, hashStr := range hashes {
+		data, err := t.client.client.Get(ctx, fmt.Sprintf("pool:pending:%s", hashStr)).Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var tx types.Transaction
+		if err := rlp.DecodeBytes(data, &tx); err != nil {
+			return nil, fmt.Errorf("failed to decode transaction: %w", err)
+		}
+		return &tx, nil
+	}
+	return nil, nil
+}
+
+// replaces reports whether tx raises both the fee cap and the tip cap of
+// old by at least the price bump, as geth requires
+func (t *TxPoolStorage) replaces(tx, old *types.Transaction) bool {
+	bump := func(v *big.Int) *big.Int {
+		threshold := new(big.Int).Mul(v, big.NewInt(int64(100+t.priceBump)))
+		return threshold.Div(threshold, big.NewInt(100))
+	}
+	return tx.GasFeeCapIntCmp(bump(old.GasFeeCap())) >= 0 &&
+		tx.GasTipCapIntCmp(bump(old.GasTipCap())) >= 0
+}
+
 // GetPendingTx retrieves a pending transaction
 func (t *TxPoolStorage) GetPendingTx(ctx context.Context, hash common.Hash) (*types.Transaction, error) {
 	key := fmt.Sprintf("pool:pending:%s", hash.Hex())
@@ -140,12 +488,166 @@ func (t *TxPoolStorage) RemovePendingTx(ctx context.Context, hash common.Hash) e
 		return err
 	}
 
-	signer := types.LatestSignerForChainID(tx.ChainId())
-	from, err := types.Sender(signer, tx)
+	from, err := t.Sender(tx)
+	if err != nil {
+		return err
+	}
+
+	return t.removeTx(ctx, hash, from)
+}
+
+// DropTx evicts a pending transaction and publishes a pool:dropped event.
+// Index entries are cleaned up even if the transaction itself is gone.
+func (t *TxPoolStorage) DropTx(ctx context.Context, hash common.Hash, reason string) error {
+	err := t.RemovePendingTx(ctx, hash)
+	if err == ErrNotFound {
+		err = t.removeIndexes(ctx, hash)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := t.setStatus(ctx, hash, &TxPoolStatus{Status: TxStatusDropped, Reason: reason}); err != nil {
+		return err
+	}
+
+	metrics.RecordPoolEviction(reason)
+	event, err := json.Marshal(&TxDroppedEvent{Hash: hash, Reason: reason})
+	if err != nil {
+		return err
+	}
+	return t.client.Publish(ctx, "pool:dropped", event)
+}
+
+// setStatus records the fate of a transaction that left the pool
+func (t *TxPoolStorage) setStatus(ctx context.Context, hash common.Hash, status *TxPoolStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return t.client.Set(ctx, fmt.Sprintf("pool:status:%s", hash.Hex()), data, t.statusTTL)
+}
+
+// GetTxStatus returns why a transaction left the pool, or ErrNotFound if
+// it was never dropped or replaced or the record expired
+func (t *TxPoolStorage) GetTxStatus(ctx context.Context, hash common.Hash) (*TxPoolStatus, error) {
+	data, err := t.client.Get(ctx, fmt.Sprintf("pool:status:%s", hash.Hex()))
+	if err != nil {
+		return nil, err
+	}
+	var status TxPoolStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("failed to decode tx status: %w", err)
+	}
+	return &status, nil
+}
+
+// IsExecutable reports whether a pending transaction can be included next,
+// i.e. the pool holds all of the sender's transactions between its account
+// nonce and the transaction's nonce. Others are queued behind a nonce gap.
+func (t *TxPoolStorage) IsExecutable(ctx context.Context, tx *types.Transaction, accountNonce uint64) (bool, error) {
+	if tx.Nonce() <= accountNonce {
+		return true, nil
+	}
+	from, err := t.Sender(tx)
+	if err != nil {
+		return false, err
+	}
+	hashes, err := t.client.ZRangeByScore(ctx, fmt.Sprintf("pool:addr:%s", from.Hex()), float64(accountNonce), float64(tx.Nonce()-1))
+	if err != nil {
+		return false, err
+	}
+	return uint64(len(hashes)) >= tx.Nonce()-accountNonce, nil
+}
+
+// PendingNonce returns the next nonce of a sender after its pending
+// transactions that follow the account nonce without a gap
+func (t *TxPoolStorage) PendingNonce(ctx context.Context, from common.Address, accountNonce uint64) (uint64, error) {
+	members, err := t.client.ZRangeWithScores(ctx, fmt.Sprintf("pool:addr:%s", from.Hex()), 0, -1)
 	if err != nil {
+		return 0, err
+	}
+	next := accountNonce
+	for _, member := range members {
+		nonce := uint64(member.Score)
+		if nonce < next {
+			continue
+		}
+		if nonce > next {
+			break
+		}
+		next++
+	}
+	return next, nil
+}
+
+// ExpiredTxs returns the hashes of transactions added before a time
+func (t *TxPoolStorage) ExpiredTxs(ctx context.Context, before time.Time) ([]common.Hash, error) {
+	members, err := t.client.ZRangeByScore(ctx, "pool:time", 0, float64(before.Unix()))
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]common.Hash, len(members))
+	for i, member := range members {
+		hashes[i] = common.HexToHash(member)
+	}
+	return hashes, nil
+}
+
+// CheapestTxs returns the hashes of the n lowest priced transactions
+func (t *TxPoolStorage) CheapestTxs(ctx context.Context, n int) ([]common.Hash, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	members, err := t.client.ZRange(ctx, "pool:byprice", 0, int64(n-1))
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]common.Hash, len(members))
+	for i, member := range members {
+		hashes[i] = common.HexToHash(member)
+	}
+	return hashes, nil
+}
+
+// TopPricedTxs returns the n highest priced pending transactions, highest
+// first
+func (t *TxPoolStorage) TopPricedTxs(ctx context.Context, n int) (types.Transactions, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	hashes, err := t.client.ZRevRange(ctx, "pool:byprice", 0, int64(n-1))
+	if err != nil {
+		return nil, err
+	}
+
+	txs := make(types.Transactions, 0, len(hashes))
+	for _, hashStr := range hashes {
+		tx, err := t.GetPendingTx(ctx, common.HexToHash(hashStr))
+		if err != nil {
+			continue // Skip transactions removed meanwhile
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// Limits returns the configured pool size caps, 0 meaning unlimited
+func (t *TxPoolStorage) Limits() (maxTxs, maxPerAccount int) {
+	return t.maxTxs, t.maxPerAccount
+}
+
+// removeIndexes removes a transaction from the indexes that do not depend
+// on its sender
+func (t *TxPoolStorage) removeIndexes(ctx context.Context, hash common.Hash) error {
+	if err := t.client.ZRem(ctx, "pool:byprice", hash.Hex()); err != nil {
 		return err
 	}
+	return t.client.ZRem(ctx, "pool:time", hash.Hex())
+}
 
+// removeTx removes a transaction from storage and all pool indexes
+func (t *TxPoolStorage) removeTx(ctx context.Context, hash common.Hash, from common.Address) error {
 	// Remove from storage
 	txKey := fmt.Sprintf("pool:pending:%s", hash.Hex())
 	if err := t.client.Del(ctx, txKey); err != nil {
@@ -158,12 +660,8 @@ func (t *TxPoolStorage) RemovePendingTx(ctx context.Context, hash common.Hash) e
 		return err
 	}
 
-	// Remove from price index
-	if err := t.client.ZRem(ctx, "pool:byprice", hash.Hex()); err != nil {
-		return err
-	}
-
-	return nil
+	// Remove from price and arrival indexes
+	return t.removeIndexes(ctx, hash)
 }
 
 // GetPoolStatus returns transaction pool statistics
@@ -189,10 +687,9 @@ func (t *TxPoolStorage) GetPoolContent(ctx context.Context) (map[string]map[stri
 
 	// Group by address and nonce
 	pending := make(map[string]map[string]*types.Transaction)
-	
-	signer := types.LatestSigner(nil)
+
 	for _, tx := range txs {
-		from, err := types.Sender(signer, tx)
+		from, err := t.Sender(tx)
 		if err != nil {
 			continue
 		}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sunvim/evm_rpc/pkg/config"
+)
+
+func TestTxPoolEvictsCheapest(t *testing.T) {
+	ctx := context.Background()
+	client, err := NewPikaClient(config.PikaConfig{Mode: config.PikaModeMemory})
+	if err != nil {
+		t.Fatalf("NewPikaClient: %v", err)
+	}
+	defer client.Close()
+
+	chainID := big.NewInt(1337)
+	pool := NewTxPoolStorage(client, config.TxPoolConfig{MaxTxs: 2}, chainID.Uint64())
+	to := common.HexToAddress("0x000000000000000000000000000000000000dead")
+	transfer := func(gasPrice *big.Int) *types.Transaction {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := types.SignNewTx(key, types.NewEIP155Signer(chainID), &types.LegacyTx{GasPrice: gasPrice, Gas: 21000, To: &to, Value: big.NewInt(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	cheap := transfer(big.NewInt(1e9))
+	if err := pool.AddPendingTx(ctx, cheap, "test"); err != nil {
+		t.Fatalf("AddPendingTx: %v", err)
+	}
+	if err := pool.AddPendingTx(ctx, transfer(big.NewInt(2e9)), "test"); err != nil {
+		t.Fatalf("AddPendingTx: %v", err)
+	}
+
+	if err := pool.AddPendingTx(ctx, transfer(big.NewInt(1e9)), "test"); !errors.Is(err, ErrUnderpriced) {
+		t.Fatalf("err = %v, want %v", err, ErrUnderpriced)
+	}
+
+	// A price beyond 64 bits must not wrap around and compare as cheap
+	huge := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 64), big.NewInt(1))
+	rich := transfer(huge)
+	if err := pool.AddPendingTx(ctx, rich, "test"); err != nil {
+		t.Fatalf("AddPendingTx: %v", err)
+	}
+
+	if _, err := pool.GetPendingTx(ctx, cheap.Hash()); err != ErrNotFound {
+		t.Fatalf("evicted tx: err = %v, want %v", err, ErrNotFound)
+	}
+	status, err := pool.GetTxStatus(ctx, cheap.Hash())
+	if err != nil {
+		t.Fatalf("GetTxStatus: %v", err)
+	}
+	if status.Status != TxStatusDropped || status.Reason != DropUnderpriced {
+		t.Fatalf("status = %+v, want dropped as %s", status, DropUnderpriced)
+	}
+	from, err := pool.Sender(cheap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := client.ZCard(ctx, "pool:addr:"+from.Hex()); err != nil || n != 0 {
+		t.Fatalf("nonce index of evicted sender: %d entries, err %v", n, err)
+	}
+	if n, err := client.ZCard(ctx, "pool:byprice"); err != nil || n != 2 {
+		t.Fatalf("price index: %d entries, err %v, want 2", n, err)
+	}
+}
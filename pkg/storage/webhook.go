@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// WebhooksChannel announces changes of the registered webhooks, so that
+// dispatchers reload them
+const WebhooksChannel = "webhooks:updated"
+
+// webhooksKey is the hash holding every webhook, keyed by ID
+const webhooksKey = "webhooks"
+
+// Webhook is a callback URL notified of the logs and transactions of new
+// blocks matching its criteria
+type Webhook struct {
+	ID        string           `json:"id"`
+	URL       string           `json:"url"`
+	Secret    string           `json:"secret,omitempty"`  // signs deliveries
+	Addresses []common.Address `json:"address,omitempty"` // log emitters
+	Topics    [][]common.Hash  `json:"topics,omitempty"`  // log topics, as in eth_getLogs
+	To        []common.Address `json:"to,omitempty"`      // transaction recipients
+	CreatedAt int64            `json:"createdAt"`
+}
+
+// MatchesLogs reports whether the webhook has log criteria
+func (w *Webhook) MatchesLogs() bool {
+	return len(w.Addresses) > 0 || len(w.Topics) > 0
+}
+
+// WebhookStore persists webhooks in Pika, where all replicas share them
+type WebhookStore struct {
+	client *PikaClient
+}
+
+// NewWebhookStore creates a new webhook store
+func NewWebhookStore(client *PikaClient) *WebhookStore {
+	return &WebhookStore{client: client}
+}
+
+// Add stores a webhook, replacing an existing one with the same ID
+func (s *WebhookStore) Add(ctx context.Context, hook *Webhook) error {
+	data, err := json.Marshal(hook)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook: %w", err)
+	}
+	if err := s.client.HSet(ctx, webhooksKey, hook.ID, data); err != nil {
+		return err
+	}
+	return s.client.Publish(ctx, WebhooksChannel, hook.ID)
+}
+
+// Remove deletes a webhook and reports whether it existed
+func (s *WebhookStore) Remove(ctx context.Context, id string) (bool, error) {
+	removed, err := s.client.HDel(ctx, webhooksKey, id)
+	if err != nil || removed == 0 {
+		return false, err
+	}
+	return true, s.client.Publish(ctx, WebhooksChannel, id)
+}
+
+// List returns the registered webhooks
+func (s *WebhookStore) List(ctx context.Context) ([]*Webhook, error) {
+	fields, err := s.client.HGetAll(ctx, webhooksKey)
+	if err != nil {
+		return nil, err
+	}
+
+	hooks := make([]*Webhook, 0, len(fields))
+	for id, data := range fields {
+		var hook Webhook
+		if err := json.Unmarshal([]byte(data), &hook); err != nil {
+			return nil, fmt.Errorf("failed to decode webhook %s: %w", id, err)
+		}
+		hooks = append(hooks, &hook)
+	}
+	return hooks, nil
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// BlockWriter writes chain data to Pika using the layout read by
+// BlockReader and TransactionReader
+type BlockWriter struct {
+	client *PikaClient
+}
+
+// NewBlockWriter creates a new block writer
+func NewBlockWriter(client *PikaClient) *BlockWriter {
+	return &BlockWriter{client: client}
+}
+
+// WriteBlock stores a block with its receipts and transactions and indexes
+// it as the canonical block at its height. td may be nil if unknown.
+// The block becomes visible as head only after SetHead.
+func (w *BlockWriter) WriteBlock(ctx context.Context, block *types.Block, receipts types.Receipts, td *big.Int) error {
+	number := block.NumberU64()
+	hash := block.Hash()
+
+	header, err := rlp.EncodeToBytes(block.Header())
+	if err != nil {
+		return fmt.Errorf("failed to encode header: %w", err)
+	}
+	body, err := rlp.EncodeToBytes(block.Body())
+	if err != nil {
+		return fmt.Errorf("failed to encode body: %w", err)
+	}
+	rcpts, err := rlp.EncodeToBytes(receipts)
+	if err != nil {
+		return fmt.Errorf("failed to encode receipts: %w", err)
+	}
+
+	pipe := w.client.Pipeline()
+	pipe.Set(ctx, headerKey(number), header, 0)
+	pipe.Set(ctx, bodyKey(number), body, 0)
+	pipe.Set(ctx, receiptsKey(number), rcpts, 0)
+	pipe.Set(ctx, fmt.Sprintf("idx:blk:hash:%s", hash.Hex()), strconv.FormatUint(number, 10), 0)
+	pipe.Set(ctx, canonicalKey(number), hash.Hex(), 0)
+	indexBloom(ctx, pipe, number, block.Bloom())
+	if td != nil {
+		pipe.Set(ctx, tdKey(number), td.String(), 0)
+	}
+
+	for i, tx := range block.Transactions() {
+		data, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			return fmt.Errorf("failed to encode transaction %s: %w", tx.Hash().Hex(), err)
+		}
+		lookup, err := json.Marshal(&TxLookup{BlockNumber: number, BlockHash: hash.Hex(), Index: uint64(i)})
+		if err != nil {
+			return err
+		}
+		pipe.Set(ctx, fmt.Sprintf("tx:%s", tx.Hash().Hex()), data, 0)
+		pipe.Set(ctx, fmt.Sprintf("tx:lookup:%s", tx.Hash().Hex()), lookup, 0)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to write block %d: %w", number, err)
+	}
+	return nil
+}
+
+// RemoveBlock drops the indexes of a block that was reorged out. Block data
+// stored by number is left to be overwritten by its replacement.
+func (w *BlockWriter) RemoveBlock(ctx context.Context, block *types.Block) error {
+	keys := []string{
+		fmt.Sprintf("idx:blk:hash:%s", block.Hash().Hex()),
+		canonicalKey(block.NumberU64()),
+		tdKey(block.NumberU64()),
+	}
+	for _, tx := range block.Transactions() {
+		keys = append(keys, fmt.Sprintf("tx:lookup:%s", tx.Hash().Hex()))
+	}
+	return w.client.Del(ctx, keys...)
+}
+
+// SetHead makes a block the latest block and announces it on blocks:new
+func (w *BlockWriter) SetHead(ctx context.Context, number uint64, hash common.Hash) error {
+	if err := w.SetLatest(ctx, number); err != nil {
+		return err
+	}
+	return w.client.Publish(ctx, "blocks:new", hash.Hex())
+}
+
+// SetLatest sets the latest block number without announcing it, e.g. when
+// rewinding to a fork point
+func (w *BlockWriter) SetLatest(ctx context.Context, number uint64) error {
+	return w.client.Set(ctx, "idx:latest", []byte(strconv.FormatUint(number, 10)), 0)
+}
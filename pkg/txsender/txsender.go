@@ -0,0 +1,91 @@
+// Package txsender recovers and caches the senders of transactions
+package txsender
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// DefaultCacheSize is the number of recovered senders kept in memory
+const DefaultCacheSize = 100000
+
+// prefetchQueueSize bounds the transactions waiting for background recovery
+const prefetchQueueSize = 4096
+
+// cache maps transaction hashes to their recovered senders.
+// Signature recovery is the most expensive step of rendering full blocks,
+// and decoded transactions do not keep the sender across reads.
+var cache, _ = lru.New[common.Hash, common.Address](DefaultCacheSize)
+
+var (
+	prefetchQueue   = make(chan *types.Transaction, prefetchQueueSize)
+	prefetchStarted sync.Once
+)
+
+// SetCacheSize resizes the sender cache
+func SetCacheSize(size int) {
+	if size > 0 {
+		cache.Resize(size)
+	}
+}
+
+// Recover returns the sender of a transaction, recovering it from the
+// signature only on a cache miss
+func Recover(tx *types.Transaction) (common.Address, error) {
+	return RecoverWith(types.LatestSignerForChainID(tx.ChainId()), tx)
+}
+
+// RecoverWith returns the sender of a transaction as recovered by the
+// signer of a chain, which rejects transactions signed for other chains
+func RecoverWith(signer types.Signer, tx *types.Transaction) (common.Address, error) {
+	// The cache is shared with Recover, which accepts any chain, so a hit
+	// must still be for this signer's chain
+	if tx.Protected() && tx.ChainId().Cmp(signer.ChainID()) != 0 {
+		return common.Address{}, types.ErrInvalidChainId
+	}
+	hash := tx.Hash()
+	if from, ok := cache.Get(hash); ok {
+		return from, nil
+	}
+
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	cache.Add(hash, from)
+	return from, nil
+}
+
+// Prefetch queues the senders of transactions not cached yet for recovery
+// by a fixed pool of workers, one per CPU. Transactions that do not fit in
+// the queue are dropped, as Recover recovers them when they are rendered.
+func Prefetch(txs types.Transactions) {
+	prefetchStarted.Do(func() {
+		for i := 0; i < runtime.NumCPU(); i++ {
+			go prefetchWorker()
+		}
+	})
+
+	for _, tx := range txs {
+		if cache.Contains(tx.Hash()) {
+			continue
+		}
+		select {
+		case prefetchQueue <- tx:
+		default:
+			return
+		}
+	}
+}
+
+// prefetchWorker recovers the senders of queued transactions
+func prefetchWorker() {
+	for tx := range prefetchQueue {
+		Recover(tx)
+	}
+}
@@ -0,0 +1,45 @@
+package txsender
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestPrefetch(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0x000000000000000000000000000000000000dead")
+	signer := types.NewLondonSigner(big.NewInt(1337))
+
+	// More transactions than the queue holds; the overflow is dropped
+	txs := make(types.Transactions, prefetchQueueSize*2)
+	for i := range txs {
+		txs[i] = types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: uint64(i), GasPrice: big.NewInt(1e9), Gas: 21000, To: &to})
+	}
+	Prefetch(txs)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cache.Contains(txs[0].Hash()) {
+		if time.Now().After(deadline) {
+			t.Fatal("sender of a prefetched transaction was not recovered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, tx := range txs {
+		got, err := Recover(tx)
+		if err != nil {
+			t.Fatalf("Recover: %v", err)
+		}
+		if got != from {
+			t.Fatalf("sender = %s, want %s", got, from)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package txvalidate
+
+import (
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// intrinsicGas is the gas a transaction pays before execution under the
+// given rules: the base cost, calldata bytes (cheaper since EIP-2028), init
+// code words (EIP-3860) and access list entries. Transactions are bounded by
+// the size limit, so the sum cannot overflow.
+func intrinsicGas(tx *types.Transaction, rules params.Rules) uint64 {
+	gas := params.TxGas
+	if tx.To() == nil && rules.IsHomestead {
+		gas = params.TxGasContractCreation
+	}
+
+	data := tx.Data()
+	var nonZero uint64
+	for _, b := range data {
+		if b != 0 {
+			nonZero++
+		}
+	}
+	nonZeroGas := params.TxDataNonZeroGasFrontier
+	if rules.IsIstanbul {
+		nonZeroGas = params.TxDataNonZeroGasEIP2028
+	}
+	gas += nonZero * nonZeroGas
+	gas += (uint64(len(data)) - nonZero) * params.TxDataZeroGas
+	if tx.To() == nil && rules.IsShanghai {
+		gas += (uint64(len(data)) + 31) / 32 * params.InitCodeWordGas
+	}
+
+	accessList := tx.AccessList()
+	gas += uint64(len(accessList)) * params.TxAccessListAddressGas
+	gas += uint64(accessList.StorageKeys()) * params.TxAccessListStorageKeyGas
+	return gas
+}
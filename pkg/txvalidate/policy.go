@@ -0,0 +1,81 @@
+package txvalidate
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/config"
+)
+
+// Policy errors, returned for transactions that are valid on chain but not
+// accepted by this deployment
+var (
+	ErrTipTooLow        = errors.New("gas tip below pool minimum")
+	ErrSenderNotAllowed = errors.New("sender not allowed")
+	ErrTargetNotAllowed = errors.New("target not allowed")
+)
+
+// Policy restricts which transactions a deployment accepts beyond the chain
+// rules: a gas tip floor and allow and deny lists of senders and targets. An
+// empty allow list allows everyone not denied.
+type Policy struct {
+	priceLimit   *big.Int
+	allowSenders map[common.Address]bool
+	denySenders  map[common.Address]bool
+	allowTargets map[common.Address]bool
+	denyTargets  map[common.Address]bool
+}
+
+// NewPolicy creates a submission policy from the tx pool settings
+func NewPolicy(cfg config.TxPoolConfig) (*Policy, error) {
+	p := &Policy{priceLimit: new(big.Int).SetUint64(cfg.PriceLimit)}
+
+	var err error
+	if p.allowSenders, err = addressSet("allow_senders", cfg.AllowSenders); err != nil {
+		return nil, err
+	}
+	if p.denySenders, err = addressSet("deny_senders", cfg.DenySenders); err != nil {
+		return nil, err
+	}
+	if p.allowTargets, err = addressSet("allow_targets", cfg.AllowTargets); err != nil {
+		return nil, err
+	}
+	if p.denyTargets, err = addressSet("deny_targets", cfg.DenyTargets); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// addressSet parses a list of addresses from the setting of the given name
+func addressSet(name string, addrs []string) (map[common.Address]bool, error) {
+	set := make(map[common.Address]bool, len(addrs))
+	for _, addr := range addrs {
+		if !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("invalid address %q in %s", addr, name)
+		}
+		set[common.HexToAddress(addr)] = true
+	}
+	return set, nil
+}
+
+// Check applies the policy to a transaction from the given sender. Contract
+// creations have no target and are only subject to the sender lists.
+func (p *Policy) Check(tx *types.Transaction, from common.Address) error {
+	if p.denySenders[from] || (len(p.allowSenders) > 0 && !p.allowSenders[from]) {
+		return withDetails(ErrSenderNotAllowed, Details{"sender": from}, "%s", from.Hex())
+	}
+	if to := tx.To(); to != nil {
+		if p.denyTargets[*to] || (len(p.allowTargets) > 0 && !p.allowTargets[*to]) {
+			return withDetails(ErrTargetNotAllowed, Details{"target": *to}, "%s", to.Hex())
+		}
+	}
+	if tx.GasTipCapIntCmp(p.priceLimit) < 0 {
+		return withDetails(ErrTipTooLow, Details{"maxPriorityFeePerGas": (*hexutil.Big)(tx.GasTipCap()), "min": (*hexutil.Big)(p.priceLimit)},
+			"tip %s, minimum %s", tx.GasTipCap(), p.priceLimit)
+	}
+	return nil
+}
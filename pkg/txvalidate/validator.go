@@ -0,0 +1,299 @@
+package txvalidate
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/forks"
+)
+
+const (
+	// DefaultMaxTxSize is the largest encoded transaction accepted, matching
+	// geth's pool limit of four 32KB slots
+	DefaultMaxTxSize = 4 * 32 * 1024
+
+	// DefaultMaxInitCodeSize is the EIP-3860 limit on contract creation code
+	DefaultMaxInitCodeSize = params.MaxInitCodeSize
+)
+
+// Names of transaction types used in the evm.tx_types setting
+var txTypeNames = map[string]uint8{
+	"legacy":      types.LegacyTxType,
+	"access_list": types.AccessListTxType,
+	"dynamic_fee": types.DynamicFeeTxType,
+	"blob":        types.BlobTxType,
+}
+
+// defaultTxTypes are accepted when evm.tx_types is empty. Blob transactions
+// are left out as the pool does not carry their sidecars.
+var defaultTxTypes = []string{"legacy", "access_list", "dynamic_fee"}
+
+// Validation errors, worded like geth's so that clients recognize them
+var (
+	ErrInvalidChainID     = errors.New("invalid chain id")
+	ErrUnprotectedTx      = errors.New("only replay-protected (EIP-155) transactions allowed over RPC")
+	ErrInvalidSender      = errors.New("invalid sender")
+	ErrTxTypeNotSupported = errors.New("transaction type not supported")
+	ErrOversizedData      = errors.New("oversized data")
+	ErrMaxInitCodeSize    = errors.New("max initcode size exceeded")
+	ErrNegativeValue      = errors.New("negative value")
+	ErrGasLimit           = errors.New("exceeds block gas limit")
+	ErrIntrinsicGas       = errors.New("intrinsic gas too low")
+	ErrFeeCapVeryHigh     = errors.New("max fee per gas higher than 2^256-1")
+	ErrTipAboveFeeCap     = errors.New("max priority fee per gas higher than max fee per gas")
+	ErrFeeCapTooLow       = errors.New("max fee per gas less than block base fee")
+	ErrNonceTooLow        = errors.New("nonce too low")
+	ErrInsufficientFunds  = errors.New("insufficient funds for gas * price + value")
+)
+
+// Validator checks transactions against the rules of a chain before they
+// enter the pool. It is shared by every method that submits transactions.
+type Validator struct {
+	chainConfig      *params.ChainConfig
+	chainID          *big.Int
+	txTypes          map[uint8]bool
+	maxTxSize        uint64
+	maxInitCodeSize  uint64
+	allowUnprotected bool
+	policy           *Policy
+}
+
+// NewValidator creates a validator for a chain from the EVM settings and its
+// fork schedule
+func NewValidator(cfg config.EVMConfig, chainConfig *params.ChainConfig) (*Validator, error) {
+	names := cfg.TxTypes
+	if len(names) == 0 {
+		names = defaultTxTypes
+	}
+	txTypes := make(map[uint8]bool, len(names))
+	for _, name := range names {
+		txType, ok := txTypeNames[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown transaction type %q", name)
+		}
+		txTypes[txType] = true
+	}
+
+	maxTxSize := cfg.MaxTxSize
+	if maxTxSize == 0 {
+		maxTxSize = DefaultMaxTxSize
+	}
+	maxInitCodeSize := cfg.MaxInitCodeSize
+	if maxInitCodeSize == 0 {
+		maxInitCodeSize = DefaultMaxInitCodeSize
+	}
+
+	return &Validator{
+		chainConfig:      chainConfig,
+		chainID:          chainConfig.ChainID,
+		txTypes:          txTypes,
+		maxTxSize:        maxTxSize,
+		maxInitCodeSize:  maxInitCodeSize,
+		allowUnprotected: cfg.AllowUnprotectedTxs,
+	}, nil
+}
+
+// SetPolicy applies a deployment's submission policy on top of the chain
+// rules
+func (v *Validator) SetPolicy(policy *Policy) {
+	v.policy = policy
+}
+
+// ValidateTx checks a transaction against the chain rules and the current
+// head: type, size, chain ID, signature, gas and fee fields, and the policy if
+// one is set. The forks active in the block after head apply. The head may be
+// nil, in which case the latest scheduled forks apply and the block gas limit
+// and base fee are not checked.
+func (v *Validator) ValidateTx(tx *types.Transaction, head *types.Header) error {
+	rules, signer := forks.Next(v.chainConfig, head)
+	if !v.txTypes[tx.Type()] || !typeActive(tx.Type(), rules) {
+		return withDetails(ErrTxTypeNotSupported, Details{"type": tx.Type()}, "type %d", tx.Type())
+	}
+	if size := tx.Size(); size > v.maxTxSize {
+		return withDetails(ErrOversizedData, Details{"size": size, "max": v.maxTxSize}, "size %d, limit %d", size, v.maxTxSize)
+	}
+	if rules.IsShanghai && tx.To() == nil && uint64(len(tx.Data())) > v.maxInitCodeSize {
+		return withDetails(ErrMaxInitCodeSize, Details{"size": len(tx.Data()), "max": v.maxInitCodeSize},
+			"code size %d, limit %d", len(tx.Data()), v.maxInitCodeSize)
+	}
+	if tx.Value().Sign() < 0 {
+		return ErrNegativeValue
+	}
+
+	signer, err := v.signerFor(tx, rules, signer)
+	if err != nil {
+		return err
+	}
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSender, err)
+	}
+	if v.policy != nil {
+		if err := v.policy.Check(tx, from); err != nil {
+			return err
+		}
+	}
+
+	if tx.GasFeeCap().BitLen() > 256 || tx.GasTipCap().BitLen() > 256 {
+		return ErrFeeCapVeryHigh
+	}
+	if tx.GasFeeCapIntCmp(tx.GasTipCap()) < 0 {
+		return withDetails(ErrTipAboveFeeCap, Details{"maxPriorityFeePerGas": (*hexutil.Big)(tx.GasTipCap()), "maxFeePerGas": (*hexutil.Big)(tx.GasFeeCap())},
+			"tip %s, fee cap %s", tx.GasTipCap(), tx.GasFeeCap())
+	}
+
+	if gas := intrinsicGas(tx, rules); tx.Gas() < gas {
+		return withDetails(ErrIntrinsicGas, Details{"got": tx.Gas(), "expected": gas}, "have %d, want %d", tx.Gas(), gas)
+	}
+
+	if head != nil {
+		if tx.Gas() > head.GasLimit {
+			return withDetails(ErrGasLimit, Details{"gas": tx.Gas(), "max": head.GasLimit}, "gas %d, limit %d", tx.Gas(), head.GasLimit)
+		}
+		if head.BaseFee != nil && tx.GasFeeCapIntCmp(head.BaseFee) < 0 {
+			return withDetails(ErrFeeCapTooLow, Details{"maxFeePerGas": (*hexutil.Big)(tx.GasFeeCap()), "baseFee": (*hexutil.Big)(head.BaseFee)},
+				"fee cap %s, base fee %s", tx.GasFeeCap(), head.BaseFee)
+		}
+	}
+	return nil
+}
+
+// signerFor returns the signer recovering the sender of a transaction under
+// the rules of the next block. Unprotected legacy transactions carry no
+// chain ID and are recovered as before EIP-155, if they are allowed at all;
+// all others must be signed for this chain, which requires EIP-155 to be
+// active.
+func (v *Validator) signerFor(tx *types.Transaction, rules params.Rules, signer types.Signer) (types.Signer, error) {
+	if !tx.Protected() {
+		if !v.allowUnprotected {
+			return nil, ErrUnprotectedTx
+		}
+		if !rules.IsHomestead {
+			return types.FrontierSigner{}, nil
+		}
+		return types.HomesteadSigner{}, nil
+	}
+
+	if !rules.IsEIP155 {
+		return nil, withDetails(ErrInvalidChainID, Details{"got": (*hexutil.Big)(tx.ChainId())},
+			"got %d, replay protection is not active before EIP-155", tx.ChainId())
+	}
+	if tx.ChainId().Cmp(v.chainID) != 0 {
+		return nil, withDetails(ErrInvalidChainID, Details{"got": (*hexutil.Big)(tx.ChainId()), "expected": (*hexutil.Big)(v.chainID)},
+			"got %d, expected %d", tx.ChainId(), v.chainID)
+	}
+	return signer, nil
+}
+
+// typeActive reports whether the fork introducing a transaction type is
+// active
+func typeActive(txType uint8, rules params.Rules) bool {
+	switch txType {
+	case types.AccessListTxType:
+		return rules.IsBerlin
+	case types.DynamicFeeTxType:
+		return rules.IsLondon
+	case types.BlobTxType:
+		return rules.IsCancun
+	default:
+		return true
+	}
+}
+
+// ValidateState checks a transaction against its sender's account: the nonce
+// must not be used yet and the balance must cover the maximum cost.
+func (v *Validator) ValidateState(tx *types.Transaction, nonce uint64, balance *big.Int) error {
+	if tx.Nonce() < nonce {
+		return withDetails(ErrNonceTooLow, Details{"got": tx.Nonce(), "expected": nonce}, "got %d, expected >= %d", tx.Nonce(), nonce)
+	}
+	if cost := tx.Cost(); balance.Cmp(cost) < 0 {
+		return withDetails(ErrInsufficientFunds, Details{"balance": (*hexutil.Big)(balance), "required": (*hexutil.Big)(cost)},
+			"balance %s, required %s", balance, cost)
+	}
+	return nil
+}
+
+// Rejected reports whether a validation error is a valid transaction that
+// cannot be accepted now or by this deployment, as opposed to a malformed one
+func Rejected(err error) bool {
+	return errors.Is(err, ErrFeeCapTooLow) || errors.Is(err, ErrNonceTooLow) ||
+		errors.Is(err, ErrInsufficientFunds) || errors.Is(err, ErrGasLimit) ||
+		errors.Is(err, ErrTipTooLow) || errors.Is(err, ErrSenderNotAllowed) ||
+		errors.Is(err, ErrTargetNotAllowed) || errors.Is(err, ErrUnprotectedTx)
+}
+
+// reasons names validation errors in rejection metrics and error data
+var reasons = []struct {
+	err    error
+	reason string
+}{
+	{ErrInvalidChainID, "invalid_chain_id"},
+	{ErrUnprotectedTx, "unprotected_tx"},
+	{ErrInvalidSender, "invalid_sender"},
+	{ErrTxTypeNotSupported, "tx_type_not_supported"},
+	{ErrOversizedData, "oversized_data"},
+	{ErrMaxInitCodeSize, "max_init_code_size"},
+	{ErrNegativeValue, "negative_value"},
+	{ErrGasLimit, "gas_limit"},
+	{ErrIntrinsicGas, "intrinsic_gas"},
+	{ErrFeeCapVeryHigh, "fee_cap_very_high"},
+	{ErrTipAboveFeeCap, "tip_above_fee_cap"},
+	{ErrFeeCapTooLow, "fee_cap_too_low"},
+	{ErrNonceTooLow, "nonce_too_low"},
+	{ErrInsufficientFunds, "insufficient_funds"},
+	{ErrTipTooLow, "tip_too_low"},
+	{ErrSenderNotAllowed, "sender_not_allowed"},
+	{ErrTargetNotAllowed, "target_not_allowed"},
+}
+
+// Reason returns a short name for a validation error, or "invalid" for
+// errors the validator did not produce
+func Reason(err error) string {
+	for _, r := range reasons {
+		if errors.Is(err, r.err) {
+			return r.reason
+		}
+	}
+	return "invalid"
+}
+
+// Details are the values that failed a validation check, keyed by name, e.g.
+// the nonce a transaction has and the one expected
+type Details map[string]interface{}
+
+// detailedError is a validation error carrying the values that failed the
+// check. Its message is the same as without them.
+type detailedError struct {
+	err     error
+	message string
+	details Details
+}
+
+func (e *detailedError) Error() string { return e.message }
+
+func (e *detailedError) Unwrap() error { return e.err }
+
+// withDetails wraps a validation error with the values that failed the
+// check, described in the message after the error's
+func withDetails(err error, details Details, format string, args ...interface{}) error {
+	return &detailedError{
+		err:     err,
+		message: err.Error() + ": " + fmt.Sprintf(format, args...),
+		details: details,
+	}
+}
+
+// ErrorDetails returns the values that failed the check of a validation
+// error, nil if it carries none
+func ErrorDetails(err error) Details {
+	var detailed *detailedError
+	if errors.As(err, &detailed) {
+		return detailed.details
+	}
+	return nil
+}
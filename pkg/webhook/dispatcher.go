@@ -0,0 +1,418 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sunvim/evm_rpc/pkg/api"
+	"github.com/sunvim/evm_rpc/pkg/config"
+	"github.com/sunvim/evm_rpc/pkg/logger"
+	"github.com/sunvim/evm_rpc/pkg/metrics"
+	"github.com/sunvim/evm_rpc/pkg/storage"
+)
+
+// Headers of a delivery. The signature is the hex HMAC-SHA256 of the
+// timestamp, a dot and the body, keyed with the secret of the webhook.
+const (
+	IDHeader        = "X-Webhook-Id"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Payload is the body POSTed to a webhook for a block holding matching logs
+// or transactions, or retracting such a block after a reorg
+type Payload struct {
+	Webhook      string                `json:"webhook"`
+	BlockNumber  hexutil.Uint64        `json:"blockNumber"`
+	BlockHash    common.Hash           `json:"blockHash"`
+	Removed      bool                  `json:"removed"`
+	Logs         []*types.Log          `json:"logs"`
+	Transactions []*api.RPCTransaction `json:"transactions"`
+}
+
+// delivery is a payload waiting to be POSTed
+type delivery struct {
+	hook *storage.Webhook
+	body []byte
+}
+
+// Dispatcher POSTs the logs and transactions of new blocks to the webhooks
+// registered in Pika whose criteria they match, retrying failed deliveries
+// with exponential backoff
+type Dispatcher struct {
+	cfg         config.WebhooksConfig
+	client      *storage.PikaClient
+	store       *storage.WebhookStore
+	blockReader *storage.BlockReader
+	tracker     *storage.CanonicalTracker
+	http        *http.Client
+	hooks       atomic.Pointer[[]*storage.Webhook]
+	queue       chan delivery
+
+	// reloadMu serializes reloads, so that an older copy never replaces a
+	// newer one
+	reloadMu sync.Mutex
+
+	// notified remembers the webhooks notified of recent blocks, which
+	// are told when those blocks are reorged out
+	notifiedMu   sync.Mutex
+	notified     map[common.Hash][]*storage.Webhook
+	notifiedFIFO []common.Hash
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher creates a webhook dispatcher backed by client
+func NewDispatcher(cfg config.WebhooksConfig, client *storage.PikaClient, blockReader *storage.BlockReader) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		cfg:         cfg,
+		client:      client,
+		store:       storage.NewWebhookStore(client),
+		blockReader: blockReader,
+		tracker:     storage.NewCanonicalTracker(blockReader, storage.DefaultCanonicalDepth),
+		http:        &http.Client{Timeout: cfg.Timeout},
+		queue:       make(chan delivery, cfg.QueueSize),
+		notified:    make(map[common.Hash][]*storage.Webhook),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	d.hooks.Store(&[]*storage.Webhook{})
+	return d
+}
+
+// Store returns the store webhooks are registered in
+func (d *Dispatcher) Store() *storage.WebhookStore {
+	return d.store
+}
+
+// Start loads the webhooks, then follows new blocks and webhook changes in
+// the background. The dispatcher starts without webhooks if Pika is
+// unreachable.
+func (d *Dispatcher) Start(ctx context.Context) error {
+	if err := d.reload(ctx); err != nil {
+		logger.Warnf("Failed to load webhooks: %v", err)
+	}
+
+	d.wg.Add(3 + d.cfg.Workers)
+	go func() {
+		defer d.wg.Done()
+		reload := func() {
+			if err := d.reload(d.ctx); err != nil {
+				logger.Warnf("Failed to reload webhooks: %v", err)
+			}
+		}
+		d.client.Listen(d.ctx, storage.WebhooksChannel, reload, func(string) { reload() })
+	}()
+	go d.refresh()
+	go d.followBlocks()
+	for i := 0; i < d.cfg.Workers; i++ {
+		go d.deliver()
+	}
+	return nil
+}
+
+// Stop stops following blocks and waits for the deliveries in flight;
+// queued ones are dropped
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.cancel()
+	d.wg.Wait()
+	d.http.CloseIdleConnections()
+	return nil
+}
+
+// reload replaces the webhooks with those stored in Pika
+func (d *Dispatcher) reload(ctx context.Context) error {
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+
+	hooks, err := d.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	d.hooks.Store(&hooks)
+	metrics.RecordWebhooks(len(hooks))
+	return nil
+}
+
+// refresh reloads the webhooks at the refresh interval, which picks up
+// changes whose notification was missed
+func (d *Dispatcher) refresh() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.reload(d.ctx); err != nil {
+				logger.Warnf("Failed to reload webhooks: %v", err)
+			}
+		}
+	}
+}
+
+// followBlocks matches every block announced on blocks:new against the
+// webhooks
+func (d *Dispatcher) followBlocks() {
+	defer d.wg.Done()
+
+	d.client.Listen(d.ctx, "blocks:new", nil, func(payload string) {
+		if len(*d.hooks.Load()) == 0 {
+			return
+		}
+		block, err := d.blockReader.GetBlockByHash(d.ctx, common.HexToHash(payload))
+		if err != nil {
+			logger.Errorf("Webhooks failed to get block %s: %v", payload, err)
+			return
+		}
+		d.handleNewBlock(block)
+	})
+}
+
+// handleNewBlock notifies the webhooks of a new head, and of the blocks it
+// reorged out first
+func (d *Dispatcher) handleNewBlock(block *types.Block) {
+	update, err := d.tracker.Apply(d.ctx, block)
+	if err != nil {
+		logger.Errorf("Webhooks failed to track canonical chain: %v", err)
+		update = &storage.ChainUpdate{Added: []*types.Block{block}}
+	}
+
+	registered := make(map[string]bool)
+	for _, hook := range *d.hooks.Load() {
+		registered[hook.ID] = true
+	}
+	for _, removed := range update.Removed {
+		for _, hook := range d.takeNotified(removed.Hash) {
+			if !registered[hook.ID] {
+				continue
+			}
+			d.enqueue(hook, &Payload{
+				Webhook:      hook.ID,
+				BlockNumber:  hexutil.Uint64(removed.Number),
+				BlockHash:    removed.Hash,
+				Removed:      true,
+				Logs:         []*types.Log{},
+				Transactions: []*api.RPCTransaction{},
+			})
+		}
+	}
+
+	for _, added := range update.Added {
+		d.notifyBlock(added)
+	}
+}
+
+// notifyBlock enqueues a delivery for every webhook with matching logs or
+// transactions in block
+func (d *Dispatcher) notifyBlock(block *types.Block) {
+	hooks := *d.hooks.Load()
+
+	var logs []*types.Log
+	for _, hook := range hooks {
+		if hook.MatchesLogs() {
+			var err error
+			logs, err = d.blockReader.GetBlockLogs(d.ctx, block.NumberU64())
+			if err != nil {
+				logger.Errorf("Webhooks failed to get logs of block %d: %v", block.NumberU64(), err)
+				return
+			}
+			break
+		}
+	}
+
+	var notified []*storage.Webhook
+	for _, hook := range hooks {
+		payload := &Payload{
+			Webhook:      hook.ID,
+			BlockNumber:  hexutil.Uint64(block.NumberU64()),
+			BlockHash:    block.Hash(),
+			Logs:         matchLogs(hook, logs),
+			Transactions: matchTransactions(hook, block),
+		}
+		if len(payload.Logs) == 0 && len(payload.Transactions) == 0 {
+			continue
+		}
+		d.enqueue(hook, payload)
+		notified = append(notified, hook)
+	}
+	if len(notified) > 0 {
+		d.rememberNotified(block.Hash(), notified)
+	}
+}
+
+// matchLogs returns the logs matching the criteria of a webhook
+func matchLogs(hook *storage.Webhook, logs []*types.Log) []*types.Log {
+	matched := []*types.Log{}
+	if !hook.MatchesLogs() {
+		return matched
+	}
+	query := &api.FilterQuery{Addresses: hook.Addresses, Topics: hook.Topics}
+	for _, log := range logs {
+		if query.Matches(log) {
+			matched = append(matched, log)
+		}
+	}
+	return matched
+}
+
+// matchTransactions returns the transactions of block sent to a recipient
+// of a webhook
+func matchTransactions(hook *storage.Webhook, block *types.Block) []*api.RPCTransaction {
+	matched := []*api.RPCTransaction{}
+	if len(hook.To) == 0 {
+		return matched
+	}
+	for i, tx := range block.Transactions() {
+		if tx.To() == nil {
+			continue
+		}
+		for _, to := range hook.To {
+			if *tx.To() == to {
+				matched = append(matched, api.NewRPCTransaction(tx, block.Hash(), block.NumberU64(), uint64(i)))
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// rememberNotified keeps the webhooks notified of a block within the reorg
+// window
+func (d *Dispatcher) rememberNotified(blockHash common.Hash, hooks []*storage.Webhook) {
+	d.notifiedMu.Lock()
+	defer d.notifiedMu.Unlock()
+
+	if _, exists := d.notified[blockHash]; !exists {
+		d.notifiedFIFO = append(d.notifiedFIFO, blockHash)
+	}
+	d.notified[blockHash] = hooks
+
+	for len(d.notifiedFIFO) > storage.DefaultCanonicalDepth {
+		delete(d.notified, d.notifiedFIFO[0])
+		d.notifiedFIFO = d.notifiedFIFO[1:]
+	}
+}
+
+// takeNotified returns and forgets the webhooks notified of a block
+func (d *Dispatcher) takeNotified(blockHash common.Hash) []*storage.Webhook {
+	d.notifiedMu.Lock()
+	defer d.notifiedMu.Unlock()
+
+	hooks := d.notified[blockHash]
+	delete(d.notified, blockHash)
+	return hooks
+}
+
+// enqueue queues a payload for delivery, dropping it if the queue is full
+func (d *Dispatcher) enqueue(hook *storage.Webhook, payload *Payload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logger.Errorf("Failed to encode webhook payload: %v", err)
+		return
+	}
+	select {
+	case d.queue <- delivery{hook: hook, body: body}:
+	default:
+		logger.Warnf("Webhook queue full, dropped delivery of block %s to %s", payload.BlockHash.Hex(), hook.ID)
+		metrics.RecordWebhookDelivery("dropped", 0)
+	}
+}
+
+// deliver POSTs queued payloads until the dispatcher stops
+func (d *Dispatcher) deliver() {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case job := <-d.queue:
+			d.send(job)
+		}
+	}
+}
+
+// send POSTs a payload, retrying with exponential backoff after transport
+// failures, 429 and 5xx responses
+func (d *Dispatcher) send(job delivery) {
+	start := time.Now()
+	backoff := d.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := d.post(job)
+		if err == nil {
+			metrics.RecordWebhookDelivery("delivered", time.Since(start))
+			return
+		}
+		if !retry || attempt >= d.cfg.MaxRetries {
+			logger.Warnf("Webhook %s delivery failed after %d attempts: %v", job.hook.ID, attempt+1, err)
+			metrics.RecordWebhookDelivery("failed", time.Since(start))
+			return
+		}
+
+		metrics.RecordWebhookRetry()
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth
+// retrying
+func (d *Dispatcher) post(job delivery) (bool, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, job.hook.URL, bytes.NewReader(job.body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, job.hook.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(job.hook.Secret, timestamp, job.body))
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return d.ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook responded %s", resp.Status)
+}
+
+// Sign returns the hex HMAC-SHA256 signature of a delivery, for receivers
+// checking it
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}